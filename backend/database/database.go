@@ -11,6 +11,8 @@ import (
 	"strings"
 	"time"
 
+	"memo-studio/backend/utils"
+
 	_ "github.com/mattn/go-sqlite3"
 	"golang.org/x/crypto/bcrypt"
 )
@@ -174,6 +176,237 @@ func runMigrations() error {
 		ver = 9
 	}
 
+	// v10：rate_limits（限流令牌桶，供多进程共享）
+	if ver < 10 {
+		if err := ensureRateLimitsV10(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 10;`); err != nil {
+			return err
+		}
+		ver = 10
+	}
+
+	// v11：加密笔记（notes.locked、用户密钥库 user_vaults、resources.encrypted）
+	if ver < 11 {
+		if err := ensureEncryptionV11(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 11;`); err != nil {
+			return err
+		}
+		ver = 11
+	}
+
+	// v12：实例设置（instance_settings）与注册邀请码（invite_codes）
+	if ver < 12 {
+		if err := ensureRegistrationV12(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 12;`); err != nil {
+			return err
+		}
+		ver = 12
+	}
+
+	// v13：账户令牌（找回密码/邮箱验证）与 users.email_verified
+	if ver < 13 {
+		if err := ensureUserTokensV13(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 13;`); err != nil {
+			return err
+		}
+		ver = 13
+	}
+
+	// v14：users.role（admin/editor/viewer/guest），is_admin 保留并与 role 同步
+	if ver < 14 {
+		if err := ensureUserRolesV14(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 14;`); err != nil {
+			return err
+		}
+		ver = 14
+	}
+
+	// v15：llm_profiles（按用户保存的大模型配置，user_id 为空表示实例默认）
+	if ver < 15 {
+		if err := ensureLLMProfilesV15(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 15;`); err != nil {
+			return err
+		}
+		ver = 15
+	}
+
+	// v16：llm_profiles.fallback_priority（备用模型链顺序）
+	if ver < 16 {
+		if err := ensureLLMFallbackV16(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 16;`); err != nil {
+			return err
+		}
+		ver = 16
+	}
+
+	// v17：llm_usage（大模型调用记录）与 llm_quotas（用户 token 配额）
+	if ver < 17 {
+		if err := ensureLLMUsageV17(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 17;`); err != nil {
+			return err
+		}
+		ver = 17
+	}
+
+	// v18：llm_cache（大模型响应缓存）与 llm_cache_notes（缓存与笔记的关联，用于失效）
+	if ver < 18 {
+		if err := ensureLLMCacheV18(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 18;`); err != nil {
+			return err
+		}
+		ver = 18
+	}
+
+	// v19：note_summaries（持久化的 AI 总结）与 user_settings（用户级设置）
+	if ver < 19 {
+		if err := ensureNoteSummariesV19(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 19;`); err != nil {
+			return err
+		}
+		ver = 19
+	}
+
+	// v20：note_tags.source 标记标签来源（manual/ai），用于审计自动打标
+	if ver < 20 {
+		if err := ensureNoteTagSourceV20(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 20;`); err != nil {
+			return err
+		}
+		ver = 20
+	}
+
+	// v21：tasks（从笔记 Markdown 复选框解析出的任务）
+	if ver < 21 {
+		if err := ensureTasksV21(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 21;`); err != nil {
+			return err
+		}
+		ver = 21
+	}
+
+	// v22：prompt_templates（用户/实例级提示词模板）
+	if ver < 22 {
+		if err := ensurePromptTemplatesV22(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 22;`); err != nil {
+			return err
+		}
+		ver = 22
+	}
+
+	// v23：digests（定期回顾报告）
+	if ver < 23 {
+		if err := ensureDigestsV23(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 23;`); err != nil {
+			return err
+		}
+		ver = 23
+	}
+
+	// v24：notes.word_count（活动统计按字数汇总）
+	if ver < 24 {
+		if err := ensureNoteWordCountV24(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 24;`); err != nil {
+			return err
+		}
+		ver = 24
+	}
+
+	// v25：insights（洞察历史）
+	if ver < 25 {
+		if err := ensureInsightsV25(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 25;`); err != nil {
+			return err
+		}
+		ver = 25
+	}
+
+	// v26：geocode_cache（在线地理编码结果缓存）
+	if ver < 26 {
+		if err := ensureGeocodeCacheV26(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 26;`); err != nil {
+			return err
+		}
+		ver = 26
+	}
+
+	// v27：resources 增加照片 EXIF（GPS 坐标、拍摄时间、方向、相机）
+	if ver < 27 {
+		if err := ensureResourceExifV27(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 27;`); err != nil {
+			return err
+		}
+		ver = 27
+	}
+
+	// v28：股票自选（stock_watchlist）与笔记提到的股票（note_stocks）
+	if ver < 28 {
+		if err := ensureStocksV28(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 28;`); err != nil {
+			return err
+		}
+		ver = 28
+	}
+
+	// v29：users 增加 password_changed_at（找回密码后使之前签发的登录令牌失效）
+	if ver < 29 {
+		if err := ensurePasswordChangedAtV29(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 29;`); err != nil {
+			return err
+		}
+		ver = 29
+	}
+
+	// v30：rate_limits 增加 full_at（令牌桶恢复满的时间，按各策略的周期清理）
+	if ver < 30 {
+		if err := ensureRateLimitFullAtV30(ctx, conn); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `PRAGMA user_version = 30;`); err != nil {
+			return err
+		}
+		ver = 30
+	}
+
 	return nil
 }
 
@@ -240,6 +473,692 @@ func ensureLocationV9(ctx context.Context, conn *sql.Conn) error {
 	return nil
 }
 
+// v10：限流状态表（MEMO_RATELIMIT_STORE=sqlite 时使用）
+func ensureRateLimitsV10(ctx context.Context, conn *sql.Conn) error {
+	rateLimitsTable := `
+	CREATE TABLE IF NOT EXISTS rate_limits (
+		key TEXT PRIMARY KEY,
+		tokens REAL NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`
+	if _, err := conn.ExecContext(ctx, rateLimitsTable); err != nil {
+		return err
+	}
+	_, _ = conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_rate_limits_updated_at ON rate_limits(updated_at);`)
+	return nil
+}
+
+// v11：加密笔记
+// - notes.locked=1 时 content 存放密文，且不进入 FTS 索引
+// - user_vaults 保存由用户口令派生密钥包裹的数据密钥（口令变更只需重新包裹）
+func ensureEncryptionV11(ctx context.Context, conn *sql.Conn) error {
+	if ok, err := columnExists(ctx, conn, "notes", "locked"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN locked INTEGER NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+	}
+	if ok, err := columnExists(ctx, conn, "resources", "encrypted"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE resources ADD COLUMN encrypted INTEGER NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+	}
+
+	vaultsTable := `
+	CREATE TABLE IF NOT EXISTS user_vaults (
+		user_id INTEGER PRIMARY KEY,
+		salt TEXT NOT NULL,
+		wrapped_key TEXT NOT NULL,
+		key_version INTEGER NOT NULL DEFAULT 1,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	if _, err := conn.ExecContext(ctx, vaultsTable); err != nil {
+		return err
+	}
+
+	// 重建 FTS 触发器：加密笔记只索引空字符串
+	_, _ = conn.ExecContext(ctx, `DROP TRIGGER IF EXISTS notes_ai;`)
+	_, _ = conn.ExecContext(ctx, `DROP TRIGGER IF EXISTS notes_au;`)
+	triggers := []string{
+		`CREATE TRIGGER IF NOT EXISTS notes_ai AFTER INSERT ON notes BEGIN
+			INSERT INTO notes_fts(rowid, content, note_id)
+			VALUES (new.id, CASE WHEN new.locked = 1 THEN '' ELSE COALESCE(new.content, '') END, new.id);
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_au AFTER UPDATE ON notes BEGIN
+			DELETE FROM notes_fts WHERE rowid = old.id;
+			INSERT INTO notes_fts(rowid, content, note_id)
+			VALUES (new.id, CASE WHEN new.locked = 1 THEN '' ELSE COALESCE(new.content, '') END, new.id);
+		END;`,
+	}
+	for _, trg := range triggers {
+		if _, err := conn.ExecContext(ctx, trg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v12：注册策略
+// - instance_settings 为通用键值设置（registration_mode 等），覆盖环境变量默认值
+// - invite_codes.max_uses=0 表示不限次数；expires_at 为空表示永不过期
+func ensureRegistrationV12(ctx context.Context, conn *sql.Conn) error {
+	settingsTable := `
+	CREATE TABLE IF NOT EXISTS instance_settings (
+		key TEXT PRIMARY KEY,
+		value TEXT NOT NULL,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);`
+	if _, err := conn.ExecContext(ctx, settingsTable); err != nil {
+		return err
+	}
+
+	invitesTable := `
+	CREATE TABLE IF NOT EXISTS invite_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT NOT NULL UNIQUE,
+		created_by INTEGER,
+		role TEXT NOT NULL DEFAULT 'user',
+		max_uses INTEGER NOT NULL DEFAULT 1,
+		uses INTEGER NOT NULL DEFAULT 0,
+		expires_at DATETIME,
+		note TEXT NOT NULL DEFAULT '',
+		revoked INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (created_by) REFERENCES users(id) ON DELETE SET NULL
+	);`
+	if _, err := conn.ExecContext(ctx, invitesTable); err != nil {
+		return err
+	}
+
+	if ok, err := columnExists(ctx, conn, "users", "invite_id"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE users ADD COLUMN invite_id INTEGER;`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v13：一次性账户令牌，只保存 SHA-256 哈希，明文仅出现在邮件中
+func ensureUserTokensV13(ctx context.Context, conn *sql.Conn) error {
+	tokensTable := `
+	CREATE TABLE IF NOT EXISTS user_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		purpose TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		email TEXT NOT NULL DEFAULT '',
+		expires_at DATETIME NOT NULL,
+		used_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	if _, err := conn.ExecContext(ctx, tokensTable); err != nil {
+		return err
+	}
+	_, _ = conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_user_tokens_user_purpose ON user_tokens(user_id, purpose);`)
+
+	if ok, err := columnExists(ctx, conn, "users", "email_verified"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE users ADD COLUMN email_verified INTEGER NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v14：角色
+// - 旧数据按 is_admin 回填为 admin/editor
+// - 邀请码的旧角色 user 对应 editor
+func ensureUserRolesV14(ctx context.Context, conn *sql.Conn) error {
+	if ok, err := columnExists(ctx, conn, "users", "role"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'editor';`); err != nil {
+			return err
+		}
+	}
+	if _, err := conn.ExecContext(ctx, `UPDATE users SET role = CASE WHEN is_admin = 1 THEN 'admin' ELSE 'editor' END;`); err != nil {
+		return err
+	}
+	if _, err := conn.ExecContext(ctx, `UPDATE invite_codes SET role = 'editor' WHERE role = 'user';`); err != nil {
+		return err
+	}
+	return nil
+}
+
+// v15：大模型配置
+// - api_key_enc 使用实例密钥加密（utils.EncryptData）
+// - 每个用户（以及实例默认）最多一个 active 配置
+func ensureLLMProfilesV15(ctx context.Context, conn *sql.Conn) error {
+	profilesTable := `
+	CREATE TABLE IF NOT EXISTS llm_profiles (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		name TEXT NOT NULL DEFAULT '',
+		provider TEXT NOT NULL,
+		base_url TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL DEFAULT '',
+		api_key_enc TEXT NOT NULL DEFAULT '',
+		max_tokens INTEGER NOT NULL DEFAULT 0,
+		active INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	if _, err := conn.ExecContext(ctx, profilesTable); err != nil {
+		return err
+	}
+	_, _ = conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_llm_profiles_user_id ON llm_profiles(user_id);`)
+	if _, err := conn.ExecContext(ctx, `CREATE UNIQUE INDEX IF NOT EXISTS idx_llm_profiles_active ON llm_profiles(COALESCE(user_id, 0)) WHERE active = 1;`); err != nil {
+		return err
+	}
+	return nil
+}
+
+// v16：备用模型链
+// - fallback_priority > 0 的配置按从小到大依次作为备用，0 表示不参与
+func ensureLLMFallbackV16(ctx context.Context, conn *sql.Conn) error {
+	ok, err := columnExists(ctx, conn, "llm_profiles", "fallback_priority")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE llm_profiles ADD COLUMN fallback_priority INTEGER NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v17：大模型用量与配额
+// - llm_usage 每次调用一行（含失败），created_at 由应用写入 UTC 时间
+// - llm_quotas 为用户级覆盖，NULL 表示沿用实例默认值，0 表示不限
+func ensureLLMUsageV17(ctx context.Context, conn *sql.Conn) error {
+	usageTable := `
+	CREATE TABLE IF NOT EXISTS llm_usage (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER,
+		endpoint TEXT NOT NULL DEFAULT '',
+		provider TEXT NOT NULL DEFAULT '',
+		model TEXT NOT NULL DEFAULT '',
+		prompt_tokens INTEGER NOT NULL DEFAULT 0,
+		completion_tokens INTEGER NOT NULL DEFAULT 0,
+		total_tokens INTEGER NOT NULL DEFAULT 0,
+		latency_ms INTEGER NOT NULL DEFAULT 0,
+		success INTEGER NOT NULL DEFAULT 1,
+		error_kind TEXT NOT NULL DEFAULT '',
+		fallback INTEGER NOT NULL DEFAULT 0,
+		created_at DATETIME NOT NULL,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	if _, err := conn.ExecContext(ctx, usageTable); err != nil {
+		return err
+	}
+	_, _ = conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_llm_usage_user_created ON llm_usage(user_id, created_at);`)
+	_, _ = conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_llm_usage_created ON llm_usage(created_at);`)
+
+	quotasTable := `
+	CREATE TABLE IF NOT EXISTS llm_quotas (
+		user_id INTEGER PRIMARY KEY,
+		daily_tokens INTEGER,
+		monthly_tokens INTEGER,
+		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+	);`
+	if _, err := conn.ExecContext(ctx, quotasTable); err != nil {
+		return err
+	}
+	return nil
+}
+
+// v18：大模型响应缓存
+// - cache_key 由 用户/厂商/模型/提示词版本/输入哈希 计算得出
+// - 笔记内容修改或删除时，由触发器清除引用该笔记的缓存
+func ensureLLMCacheV18(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS llm_cache (
+			cache_key TEXT PRIMARY KEY,
+			user_id INTEGER,
+			template TEXT NOT NULL,
+			provider TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			response TEXT NOT NULL,
+			answered_by TEXT NOT NULL DEFAULT '',
+			hits INTEGER NOT NULL DEFAULT 0,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_cache_expires ON llm_cache(expires_at);`,
+		`CREATE TABLE IF NOT EXISTS llm_cache_notes (
+			cache_key TEXT NOT NULL,
+			note_id INTEGER NOT NULL,
+			PRIMARY KEY (cache_key, note_id),
+			FOREIGN KEY (cache_key) REFERENCES llm_cache(cache_key) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_llm_cache_notes_note ON llm_cache_notes(note_id);`,
+		`CREATE TRIGGER IF NOT EXISTS notes_llm_cache_au AFTER UPDATE OF content ON notes
+			WHEN old.content IS NOT new.content BEGIN
+			DELETE FROM llm_cache WHERE cache_key IN (SELECT cache_key FROM llm_cache_notes WHERE note_id = old.id);
+			DELETE FROM llm_cache_notes WHERE note_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_llm_cache_ad AFTER DELETE ON notes BEGIN
+			DELETE FROM llm_cache WHERE cache_key IN (SELECT cache_key FROM llm_cache_notes WHERE note_id = old.id);
+			DELETE FROM llm_cache_notes WHERE note_id = old.id;
+		END;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v19：笔记 AI 总结与用户设置
+// - note_summaries 每条笔记保留最新一份总结，source_hash 为生成时正文的哈希，用于判断是否过期
+// - 笔记加密后总结含明文信息，由触发器删除
+// - user_settings 为用户级键值设置（auto_summarize 等）
+func ensureNoteSummariesV19(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS note_summaries (
+			note_id INTEGER PRIMARY KEY,
+			user_id INTEGER,
+			summary TEXT NOT NULL DEFAULT '',
+			highlights TEXT NOT NULL DEFAULT '[]',
+			action_items TEXT NOT NULL DEFAULT '[]',
+			provider TEXT NOT NULL DEFAULT '',
+			model TEXT NOT NULL DEFAULT '',
+			auto INTEGER NOT NULL DEFAULT 0,
+			source_hash TEXT NOT NULL,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TRIGGER IF NOT EXISTS notes_summary_ad AFTER DELETE ON notes BEGIN
+			DELETE FROM note_summaries WHERE note_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_summary_lock AFTER UPDATE OF locked ON notes
+			WHEN new.locked = 1 BEGIN
+			DELETE FROM note_summaries WHERE note_id = new.id;
+		END;`,
+		`CREATE TABLE IF NOT EXISTS user_settings (
+			user_id INTEGER NOT NULL,
+			key TEXT NOT NULL,
+			value TEXT NOT NULL,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (user_id, key),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v20：note_tags.source 标记标签来源（manual/ai），用于审计自动打标
+func ensureNoteTagSourceV20(ctx context.Context, conn *sql.Conn) error {
+	if ok, err := columnExists(ctx, conn, "note_tags", "source"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE note_tags ADD COLUMN source TEXT NOT NULL DEFAULT 'manual';`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v21：任务
+// - 每个 Markdown 复选框一行，随笔记内容变更重新同步（按文本匹配保留 id）
+// - 笔记加密后任务文本属于明文，由触发器删除
+// - 迁移时为已有的未加密笔记回填
+func ensureTasksV21(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS tasks (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			note_id INTEGER NOT NULL,
+			user_id INTEGER,
+			line INTEGER NOT NULL,
+			text TEXT NOT NULL,
+			done INTEGER NOT NULL DEFAULT 0,
+			due_date TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_note ON tasks(note_id);`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_user_open ON tasks(user_id, done, due_date);`,
+		`CREATE TRIGGER IF NOT EXISTS notes_tasks_ad AFTER DELETE ON notes BEGIN
+			DELETE FROM tasks WHERE note_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_tasks_lock AFTER UPDATE OF locked ON notes
+			WHEN new.locked = 1 BEGIN
+			DELETE FROM tasks WHERE note_id = new.id;
+		END;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	type noteRow struct {
+		id      int64
+		userID  sql.NullInt64
+		content string
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT id, user_id, COALESCE(content, '') FROM notes
+		WHERE locked = 0 AND (content LIKE '%[ ]%' OR content LIKE '%[x]%' OR content LIKE '%[X]%')`)
+	if err != nil {
+		return err
+	}
+	var notes []noteRow
+	for rows.Next() {
+		var n noteRow
+		if err := rows.Scan(&n.id, &n.userID, &n.content); err != nil {
+			rows.Close()
+			return err
+		}
+		notes = append(notes, n)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, n := range notes {
+		for _, t := range utils.ParseTasks(n.content) {
+			var due interface{}
+			if t.Due != "" {
+				due = t.Due
+			}
+			if _, err := conn.ExecContext(ctx,
+				`INSERT INTO tasks (note_id, user_id, line, text, done, due_date) VALUES (?, ?, ?, ?, ?, ?)`,
+				n.id, n.userID, t.Line, t.Text, t.Done, due,
+			); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// v22：提示词模板
+// - user_id 为空表示管理员维护的实例模板；同一归属下 name 唯一
+// - output_schema 为可选的 JSON Schema，用于校验模型输出
+func ensurePromptTemplatesV22(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS prompt_templates (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER,
+			name TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			system_prompt TEXT NOT NULL DEFAULT '',
+			user_prompt TEXT NOT NULL,
+			output_schema TEXT NOT NULL DEFAULT '',
+			language TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_prompt_templates_owner_name ON prompt_templates(COALESCE(user_id, 0), name);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v23：定期回顾
+// - 每个用户每种周期（weekly/monthly）每个时段只生成一份
+// - data 为统计结果 JSON，content 为渲染好的 Markdown
+// - delivered_at / delivery_error 记录推送到用户 Webhook 的结果
+func ensureDigestsV23(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS digests (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			period TEXT NOT NULL,
+			period_start DATETIME NOT NULL,
+			period_end DATETIME NOT NULL,
+			timezone TEXT NOT NULL DEFAULT '',
+			title TEXT NOT NULL DEFAULT '',
+			content TEXT NOT NULL DEFAULT '',
+			data TEXT NOT NULL DEFAULT '{}',
+			provider TEXT NOT NULL DEFAULT '',
+			delivered_at DATETIME,
+			delivery_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS idx_digests_user_period ON digests(user_id, period, period_start);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v24：笔记字数
+// - word_count 在写入笔记时计算（加密笔记保留加密前的字数）
+// - 迁移时为已有的未加密笔记回填；补充按用户+时间的索引供活动统计使用
+func ensureNoteWordCountV24(ctx context.Context, conn *sql.Conn) error {
+	if ok, err := columnExists(ctx, conn, "notes", "word_count"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE notes ADD COLUMN word_count INTEGER NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+	}
+	for _, stmt := range []string{
+		`CREATE INDEX IF NOT EXISTS idx_notes_user_created ON notes(user_id, created_at);`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_user_updated ON notes(user_id, updated_at);`,
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	type noteRow struct {
+		id    int64
+		words int
+	}
+	rows, err := conn.QueryContext(ctx, `SELECT id, COALESCE(title, '') || ' ' || COALESCE(content, '') FROM notes WHERE locked = 0`)
+	if err != nil {
+		return err
+	}
+	var notes []noteRow
+	for rows.Next() {
+		var id int64
+		var text string
+		if err := rows.Scan(&id, &text); err != nil {
+			rows.Close()
+			return err
+		}
+		notes = append(notes, noteRow{id: id, words: utils.CountWords(text)})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, n := range notes {
+		if _, err := conn.ExecContext(ctx, `UPDATE notes SET word_count = ? WHERE id = ?`, n.words, n.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v25：洞察历史
+// - params 为生成时的选取条件（JSON），period_start/period_end 为分析的时间窗口（UTC，不限时为空）
+// - data 为完整的洞察结果；stats 为离线统计快照（关键词、情感），供跨时段对比
+func ensureInsightsV25(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS insights (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			params TEXT NOT NULL DEFAULT '{}',
+			period_start DATETIME,
+			period_end DATETIME,
+			provider TEXT NOT NULL DEFAULT '',
+			summary TEXT NOT NULL DEFAULT '',
+			note_count INTEGER NOT NULL DEFAULT 0,
+			data TEXT NOT NULL DEFAULT '{}',
+			stats TEXT NOT NULL DEFAULT '{}',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_insights_user_created ON insights(user_id, created_at);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v26：在线地理编码结果缓存
+// - 按 (provider, query) 缓存，query 为归一化后的地名；found = 0 表示该服务查不到
+func ensureGeocodeCacheV26(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS geocode_cache (
+			provider TEXT NOT NULL,
+			query TEXT NOT NULL,
+			found INTEGER NOT NULL DEFAULT 0,
+			name TEXT NOT NULL DEFAULT '',
+			latitude REAL NOT NULL DEFAULT 0,
+			longitude REAL NOT NULL DEFAULT 0,
+			kind TEXT NOT NULL DEFAULT '',
+			country TEXT NOT NULL DEFAULT '',
+			admin TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME NOT NULL,
+			PRIMARY KEY (provider, query)
+		);`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v27：照片附件的 EXIF
+// - exif_scanned = 1 表示已解析过（没有 EXIF 的图片也会标记，避免重复读取文件）
+// - 加密附件不解析，避免拍摄位置以明文保存
+func ensureResourceExifV27(ctx context.Context, conn *sql.Conn) error {
+	columns := []struct{ name, def string }{
+		{"exif_scanned", "INTEGER NOT NULL DEFAULT 0"},
+		{"latitude", "REAL"},
+		{"longitude", "REAL"},
+		{"altitude", "REAL"},
+		{"taken_at", "DATETIME"},
+		{"orientation", "INTEGER NOT NULL DEFAULT 0"},
+		{"camera", "TEXT NOT NULL DEFAULT ''"},
+	}
+	for _, col := range columns {
+		if ok, err := columnExists(ctx, conn, "resources", col.name); err != nil {
+			return err
+		} else if !ok {
+			if _, err := conn.ExecContext(ctx, `ALTER TABLE resources ADD COLUMN `+col.name+` `+col.def+`;`); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// v28：股票
+// - stock_watchlist 每个用户一份自选股，code 为 6 位代码
+// - note_stocks 笔记正文提到的股票，随内容变更同步；price 等为写笔记时的行情快照（回填的旧笔记没有）
+// - 笔记加密后由触发器删除关联（股票代码属于正文内容）
+func ensureStocksV28(ctx context.Context, conn *sql.Conn) error {
+	stmts := []string{
+		`CREATE TABLE IF NOT EXISTS stock_watchlist (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			user_id INTEGER NOT NULL,
+			code TEXT NOT NULL,
+			market TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL DEFAULT '',
+			memo TEXT NOT NULL DEFAULT '',
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (user_id, code),
+			FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+		);`,
+		`CREATE TABLE IF NOT EXISTS note_stocks (
+			note_id INTEGER NOT NULL,
+			code TEXT NOT NULL,
+			market TEXT NOT NULL DEFAULT '',
+			name TEXT NOT NULL DEFAULT '',
+			source TEXT NOT NULL DEFAULT 'code',
+			price REAL,
+			change_percent REAL,
+			quoted_at DATETIME,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (note_id, code),
+			FOREIGN KEY (note_id) REFERENCES notes(id) ON DELETE CASCADE
+		);`,
+		`CREATE INDEX IF NOT EXISTS idx_note_stocks_code ON note_stocks(code, note_id);`,
+		`CREATE TRIGGER IF NOT EXISTS notes_stocks_ad AFTER DELETE ON notes BEGIN
+			DELETE FROM note_stocks WHERE note_id = old.id;
+		END;`,
+		`CREATE TRIGGER IF NOT EXISTS notes_stocks_lock AFTER UPDATE OF locked ON notes
+			WHEN new.locked = 1 BEGIN
+			DELETE FROM note_stocks WHERE note_id = new.id;
+		END;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v29：password_changed_at 为 UTC 时间，签发时间早于它的 JWT 视为已撤销；从未重置过为 NULL
+func ensurePasswordChangedAtV29(ctx context.Context, conn *sql.Conn) error {
+	if ok, err := columnExists(ctx, conn, "users", "password_changed_at"); err != nil || ok {
+		return err
+	}
+	_, err := conn.ExecContext(ctx, `ALTER TABLE users ADD COLUMN password_changed_at DATETIME;`)
+	return err
+}
+
+// v30：full_at 为令牌桶恢复满的时间（UnixNano），此后删除与未访问过等价；
+// 旧数据按原来的 10 分钟空闲时间回填
+func ensureRateLimitFullAtV30(ctx context.Context, conn *sql.Conn) error {
+	if ok, err := columnExists(ctx, conn, "rate_limits", "full_at"); err != nil {
+		return err
+	} else if !ok {
+		if _, err := conn.ExecContext(ctx, `ALTER TABLE rate_limits ADD COLUMN full_at INTEGER NOT NULL DEFAULT 0;`); err != nil {
+			return err
+		}
+		if _, err := conn.ExecContext(ctx, `UPDATE rate_limits SET full_at = updated_at + ?;`, int64(10*time.Minute)); err != nil {
+			return err
+		}
+	}
+	_, err := conn.ExecContext(ctx, `CREATE INDEX IF NOT EXISTS idx_rate_limits_full_at ON rate_limits(full_at);`)
+	return err
+}
+
 func ensureSchemaV1(ctx context.Context, conn *sql.Conn) error {
 	// 创建笔记表
 	notesTable := `
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	passwordResetTTL = time.Hour
+	emailVerifyTTL   = 48 * time.Hour
+	mailSendTimeout  = 30 * time.Second
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,max=200"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required,min=6,max=100"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// sendMailAsync 后台发送邮件，避免响应时间暴露账号是否存在
+func sendMailAsync(msg services.MailMessage) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), mailSendTimeout)
+		defer cancel()
+		if err := services.GetMailer().Send(ctx, msg); err != nil {
+			log.Printf("[MAIL] 发送失败 to=%s: %v", msg.To, err)
+		}
+	}()
+}
+
+// sendVerificationEmail 为用户当前邮箱签发验证链接
+func sendVerificationEmail(user *models.User) error {
+	if user == nil || strings.TrimSpace(user.Email) == "" || user.EmailVerified {
+		return nil
+	}
+	token, err := models.CreateUserToken(user.ID, models.TokenPurposeEmailVerify, user.Email, emailVerifyTTL)
+	if err != nil {
+		return err
+	}
+	link := services.PublicBaseURL() + "/verify-email?token=" + url.QueryEscape(token)
+	sendMailAsync(services.MailMessage{
+		To:      user.Email,
+		Subject: "请验证你的邮箱",
+		Body: fmt.Sprintf("你好 %s：\n\n请点击以下链接验证邮箱（%d 小时内有效）：\n%s\n\n如果不是你本人操作，请忽略此邮件。\n",
+			user.Username, int(emailVerifyTTL.Hours()), link),
+	})
+	return nil
+}
+
+// ForgotPassword 发送找回密码邮件；无论邮箱是否存在都返回相同结果
+// POST /api/v1/auth/forgot
+func ForgotPassword(c *gin.Context) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	users, err := models.FindUsersByEmail(req.Email)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "处理失败"})
+		return
+	}
+	for _, u := range users {
+		token, err := models.CreateUserToken(u.ID, models.TokenPurposePasswordReset, u.Email, passwordResetTTL)
+		if err != nil {
+			log.Printf("[MAIL] 创建重置令牌失败 user=%d: %v", u.ID, err)
+			continue
+		}
+		link := services.PublicBaseURL() + "/reset-password?token=" + url.QueryEscape(token)
+		sendMailAsync(services.MailMessage{
+			To:      u.Email,
+			Subject: "重置密码",
+			Body: fmt.Sprintf("你好 %s：\n\n我们收到了重置密码的请求。请在 %d 分钟内点击以下链接设置新密码（链接仅可使用一次）：\n%s\n\n如果不是你本人操作，请忽略此邮件，密码不会被修改。\n",
+				u.Username, int(passwordResetTTL.Minutes()), link),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success": true,
+		"message": "如果该邮箱已绑定账号，重置链接已发送",
+	})
+}
+
+// ResetPassword 使用邮件中的令牌设置新密码
+// POST /api/v1/auth/reset
+func ResetPassword(c *gin.Context) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if _, err := models.ResetPasswordWithToken(req.Token, req.NewPassword); err != nil {
+		if errors.Is(err, models.ErrTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "TOKEN_INVALID"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置密码失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "密码已重置，请使用新密码登录"})
+}
+
+// VerifyEmail 确认邮箱
+// POST /api/v1/auth/verify-email
+func VerifyEmail(c *gin.Context) {
+	var req VerifyEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	user, err := models.VerifyEmailWithToken(req.Token)
+	if err != nil {
+		if errors.Is(err, models.ErrTokenInvalid) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "TOKEN_INVALID"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
+
+// ResendEmailVerification 重新发送验证邮件
+// POST /api/v1/users/me/email/verify
+func ResendEmailVerification(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	user, err := models.GetUserByID(userID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if strings.TrimSpace(user.Email) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "尚未设置邮箱"})
+		return
+	}
+	if user.EmailVerified {
+		c.JSON(http.StatusOK, gin.H{"success": true, "message": "邮箱已验证"})
+		return
+	}
+	if err := sendVerificationEmail(user); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "发送验证邮件失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "message": "验证邮件已发送"})
+}
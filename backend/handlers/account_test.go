@@ -0,0 +1,130 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+)
+
+type captureMailer struct {
+	sent chan services.MailMessage
+}
+
+func (m *captureMailer) Send(_ context.Context, msg services.MailMessage) error {
+	m.sent <- msg
+	return nil
+}
+
+func (m *captureMailer) next(t *testing.T) services.MailMessage {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(3 * time.Second):
+		t.Fatalf("no mail sent")
+	}
+	return services.MailMessage{}
+}
+
+var tokenInLink = regexp.MustCompile(`token=([0-9a-f]+)`)
+
+func mailToken(t *testing.T, msg services.MailMessage) string {
+	t.Helper()
+	m := tokenInLink.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no token in mail: %s", msg.Body)
+	}
+	return m[1]
+}
+
+func TestPasswordResetAndEmailVerification(t *testing.T) {
+	r, _, _ := setup(t)
+	mailer := &captureMailer{sent: make(chan services.MailMessage, 8)}
+	services.SetMailer(mailer)
+
+	// 注册后发送验证邮件
+	rr := doJSON(t, r, "POST", "/api/auth/register", "", map[string]any{
+		"username": "frank", "password": "secret123", "email": "Frank@example.com",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("register status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var reg struct {
+		User models.User `json:"user"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &reg)
+	if reg.User.EmailVerified {
+		t.Fatalf("new email should be unverified")
+	}
+	verify := mailToken(t, mailer.next(t))
+	rr = doJSON(t, r, "POST", "/api/auth/verify-email", "", map[string]any{"token": verify})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("verify status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var verified models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &verified)
+	if !verified.EmailVerified {
+		t.Fatalf("email not verified: %+v", verified)
+	}
+
+	// 修改邮箱后需要重新验证
+	auth := authHeader(t, reg.User.ID, "frank", false)
+	rr = doJSON(t, r, "PUT", "/api/users/me", auth, map[string]any{"username": "frank", "email": "frank@new.example.com"})
+	var updated models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.EmailVerified {
+		t.Fatalf("changed email should be unverified")
+	}
+	if msg := mailer.next(t); msg.To != "frank@new.example.com" {
+		t.Fatalf("verification sent to %s", msg.To)
+	}
+
+	// 未知邮箱：相同响应，不发邮件
+	rr = doJSON(t, r, "POST", "/api/auth/forgot", "", map[string]any{"email": "nobody@example.com"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("forgot unknown status=%d", rr.Code)
+	}
+
+	rr = doJSON(t, r, "POST", "/api/auth/forgot", "", map[string]any{"email": "FRANK@new.example.com"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("forgot status=%d", rr.Code)
+	}
+	reset := mailToken(t, mailer.next(t))
+
+	if rr := doJSON(t, r, "POST", "/api/auth/reset", "", map[string]any{"token": "deadbeef", "new_password": "newpass123"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad token status=%d", rr.Code)
+	}
+	// 令牌签发时间精确到秒：等到下一秒再重置，确保旧令牌早于重置时间
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+	if rr := doJSON(t, r, "POST", "/api/auth/reset", "", map[string]any{"token": reset, "new_password": "newpass123"}); rr.Code != http.StatusOK {
+		t.Fatalf("reset status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 重置前签发的登录令牌失效
+	rr = doJSON(t, r, "GET", "/api/users/me", auth, nil)
+	var revoked map[string]any
+	_ = json.Unmarshal(rr.Body.Bytes(), &revoked)
+	if rr.Code != http.StatusUnauthorized || revoked["code"] != "TOKEN_REVOKED" {
+		t.Fatalf("old token status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 令牌只能使用一次
+	if rr := doJSON(t, r, "POST", "/api/auth/reset", "", map[string]any{"token": reset, "new_password": "again123"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("reused token status=%d", rr.Code)
+	}
+	rr = doJSON(t, r, "POST", "/api/auth/login", "", map[string]any{"username": "frank", "password": "newpass123"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login with new password status=%d", rr.Code)
+	}
+	var login struct {
+		Token string `json:"token"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &login)
+	if rr := doJSON(t, r, "GET", "/api/users/me", "Bearer "+login.Token, nil); rr.Code != http.StatusOK {
+		t.Fatalf("new token status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,344 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type PromptTemplateRequest struct {
+	Name         string          `json:"name" binding:"required,max=50"`
+	Description  string          `json:"description" binding:"max=500"`
+	SystemPrompt string          `json:"system_prompt" binding:"max=20000"`
+	UserPrompt   string          `json:"user_prompt" binding:"required,max=20000"`
+	OutputSchema json.RawMessage `json:"output_schema"` // JSON Schema 对象，可省略
+	Language     string          `json:"language" binding:"max=20"`
+}
+
+// RunTemplateRequest 运行模板：按 note_ids / tag / notebook_id / 时间范围选取笔记（条件同时生效）
+type RunTemplateRequest struct {
+	NoteIDs    []int  `json:"note_ids"`
+	Tag        string `json:"tag"`
+	NotebookID int    `json:"notebook_id"`
+	From       string `json:"from"` // YYYY-MM-DD
+	To         string `json:"to"`   // YYYY-MM-DD（含当天）
+	TimeRange  string `json:"time_range"`
+	Language   string `json:"language"`
+	Limit      int    `json:"limit"`
+	Validate   *bool  `json:"validate"` // 默认 true：模板有 output_schema 时校验输出
+}
+
+var templateNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// bindPromptTemplateInput 校验请求并转换为模型层输入
+func bindPromptTemplateInput(c *gin.Context) (models.PromptTemplateInput, bool) {
+	var req PromptTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return models.PromptTemplateInput{}, false
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if !templateNameRe.MatchString(req.Name) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "模板名只能包含小写字母、数字、- 和 _"})
+		return models.PromptTemplateInput{}, false
+	}
+	if strings.TrimSpace(req.UserPrompt) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "user_prompt 不能为空"})
+		return models.PromptTemplateInput{}, false
+	}
+	schema := strings.TrimSpace(string(req.OutputSchema))
+	if schema == "null" {
+		schema = ""
+	}
+	if schema != "" {
+		if _, err := services.ParseJSONSchema(schema); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return models.PromptTemplateInput{}, false
+		}
+	}
+	return models.PromptTemplateInput{
+		Name:         req.Name,
+		Description:  strings.TrimSpace(req.Description),
+		SystemPrompt: req.SystemPrompt,
+		UserPrompt:   req.UserPrompt,
+		OutputSchema: schema,
+		Language:     strings.TrimSpace(req.Language),
+	}, true
+}
+
+func promptTemplateScope(owner *int) string {
+	if owner == nil {
+		return services.TemplateScopeInstance
+	}
+	return services.TemplateScopeUser
+}
+
+func parsePromptTemplateID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模板ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func listPromptTemplates(c *gin.Context, owner *int) {
+	list, err := models.ListPromptTemplates(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取模板失败: " + err.Error()})
+		return
+	}
+	if list == nil {
+		list = []models.PromptTemplate{}
+	}
+	c.JSON(http.StatusOK, gin.H{"templates": list, "scope": promptTemplateScope(owner), "variables": services.TemplateVariables})
+}
+
+func createPromptTemplate(c *gin.Context, owner *int) {
+	in, ok := bindPromptTemplateInput(c)
+	if !ok {
+		return
+	}
+	t, err := models.CreatePromptTemplate(owner, in)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			c.JSON(http.StatusConflict, gin.H{"error": "模板名已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模板失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, t)
+}
+
+func updatePromptTemplate(c *gin.Context, owner *int) {
+	id, ok := parsePromptTemplateID(c)
+	if !ok {
+		return
+	}
+	in, ok := bindPromptTemplateInput(c)
+	if !ok {
+		return
+	}
+	t, err := models.UpdatePromptTemplate(id, owner, in)
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			c.JSON(http.StatusConflict, gin.H{"error": "模板名已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模板失败: " + err.Error()})
+		return
+	}
+	if t == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, t)
+}
+
+func deletePromptTemplate(c *gin.Context, owner *int) {
+	id, ok := parsePromptTemplateID(c)
+	if !ok {
+		return
+	}
+	if err := models.DeletePromptTemplate(id, owner); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除模板失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ListMyPromptTemplates 我的提示词模板，以及可用的实例模板与内置模板
+// GET /api/v1/ai/templates
+func ListMyPromptTemplates(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	mine, err := models.ListPromptTemplates(&userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取模板失败: " + err.Error()})
+		return
+	}
+	instance, err := models.ListPromptTemplates(nil)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取模板失败: " + err.Error()})
+		return
+	}
+	if mine == nil {
+		mine = []models.PromptTemplate{}
+	}
+	if instance == nil {
+		instance = []models.PromptTemplate{}
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"templates": mine,
+		"instance":  instance,
+		"builtin":   services.BuiltinTemplates(),
+		"variables": services.TemplateVariables,
+	})
+}
+
+// CreateMyPromptTemplate 新建个人模板（可与实例/内置模板同名以覆盖）
+// POST /api/v1/ai/templates
+func CreateMyPromptTemplate(c *gin.Context) {
+	if userID, ok := mustUserID(c); ok {
+		createPromptTemplate(c, &userID)
+	}
+}
+
+// UpdateMyPromptTemplate 修改个人模板
+// PUT /api/v1/ai/templates/:id
+func UpdateMyPromptTemplate(c *gin.Context) {
+	if userID, ok := mustUserID(c); ok {
+		updatePromptTemplate(c, &userID)
+	}
+}
+
+// DeleteMyPromptTemplate 删除个人模板
+// DELETE /api/v1/ai/templates/:id
+func DeleteMyPromptTemplate(c *gin.Context) {
+	if userID, ok := mustUserID(c); ok {
+		deletePromptTemplate(c, &userID)
+	}
+}
+
+// AdminListPromptTemplates 实例模板
+// GET /api/v1/admin/ai/templates
+func AdminListPromptTemplates(c *gin.Context) { listPromptTemplates(c, nil) }
+
+// AdminCreatePromptTemplate 新建实例模板（所有用户可用）
+// POST /api/v1/admin/ai/templates
+func AdminCreatePromptTemplate(c *gin.Context) { createPromptTemplate(c, nil) }
+
+// AdminUpdatePromptTemplate 修改实例模板
+// PUT /api/v1/admin/ai/templates/:id
+func AdminUpdatePromptTemplate(c *gin.Context) { updatePromptTemplate(c, nil) }
+
+// AdminDeletePromptTemplate 删除实例模板
+// DELETE /api/v1/admin/ai/templates/:id
+func AdminDeletePromptTemplate(c *gin.Context) { deletePromptTemplate(c, nil) }
+
+// parseDateRange 解析 YYYY-MM-DD 的 from/to（to 含当天）
+func parseDateRange(from, to string) (*time.Time, *time.Time, error) {
+	var f, t *time.Time
+	if v := strings.TrimSpace(from); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return nil, nil, errors.New("from 格式应为 YYYY-MM-DD")
+		}
+		f = &d
+	}
+	if v := strings.TrimSpace(to); v != "" {
+		d, err := time.ParseInLocation("2006-01-02", v, time.Local)
+		if err != nil {
+			return nil, nil, errors.New("to 格式应为 YYYY-MM-DD")
+		}
+		d = d.AddDate(0, 0, 1)
+		t = &d
+	}
+	return f, t, nil
+}
+
+// RunPromptTemplate 把模板应用到选中的笔记上
+// POST /api/v1/ai/run/:template
+func RunPromptTemplate(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req RunTemplateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if len(req.NoteIDs) == 0 && strings.TrimSpace(req.Tag) == "" && req.NotebookID <= 0 && req.From == "" && req.To == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请通过 note_ids、tag、notebook_id 或 from/to 选择笔记"})
+		return
+	}
+
+	tpl, err := services.ResolvePromptTemplate(userID, c.Param("template"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取模板失败: " + err.Error()})
+		return
+	}
+	if tpl == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+
+	from, to, err := parseDateRange(req.From, req.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	notes, err := models.SelectNotes(models.NoteSelection{
+		UserID:     userID,
+		IDs:        req.NoteIDs,
+		Tag:        req.Tag,
+		NotebookID: req.NotebookID,
+		From:       from,
+		To:         to,
+		Limit:      req.Limit,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "选取笔记失败: " + err.Error()})
+		return
+	}
+	if len(notes) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有符合条件的笔记"})
+		return
+	}
+
+	llmService := llmServiceForRequest(c)
+	if !llmService.Configured() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请在模型设置中配置 API Key 启用 AI 功能", "code": "LLM_NOT_CONFIGURED"})
+		return
+	}
+	timeRange := req.TimeRange
+	if timeRange == "" && (req.From != "" || req.To != "") {
+		timeRange = strings.TrimSpace(req.From + " ~ " + req.To)
+	}
+	result, err := llmService.RunTemplate(tpl, notes, services.TemplateRunOptions{
+		TimeRange: timeRange,
+		Language:  req.Language,
+		Validate:  req.Validate == nil || *req.Validate,
+	})
+	if err != nil {
+		if abortIfQuotaExceeded(c, err) {
+			return
+		}
+		var oe *services.TemplateOutputError
+		if errors.As(err, &oe) {
+			c.JSON(http.StatusBadGateway, gin.H{"error": oe.Error(), "code": "LLM_INVALID_OUTPUT", "output": oe.Output})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI 调用失败: " + err.Error(), "code": "LLM_UNAVAILABLE"})
+		return
+	}
+
+	noteIDs := make([]int, 0, len(notes))
+	for _, n := range notes {
+		noteIDs = append(noteIDs, n.ID)
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"template": tpl.Name,
+		"scope":    tpl.Scope,
+		"note_ids": noteIDs,
+		"result":   result,
+	})
+}
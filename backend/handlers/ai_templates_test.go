@@ -0,0 +1,253 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// scriptedLLM 依次返回 replies 中的内容（用完后重复最后一条），并记录每次请求的消息
+func scriptedLLM(t *testing.T, replies ...string) (*httptest.Server, *[][]map[string]string) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests [][]map[string]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Messages []map[string]string `json:"messages"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		mu.Lock()
+		requests = append(requests, body.Messages)
+		i := len(requests) - 1
+		mu.Unlock()
+		if i >= len(replies) {
+			i = len(replies) - 1
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"model":   "fake-model",
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": replies[i]}}},
+			"usage":   map[string]any{"prompt_tokens": 5, "completion_tokens": 5, "total_tokens": 10},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+type runTemplateResponse struct {
+	Template string `json:"template"`
+	Scope    string `json:"scope"`
+	NoteIDs  []int  `json:"note_ids"`
+	Result   struct {
+		Output   string         `json:"output"`
+		JSON     map[string]any `json:"json"`
+		Cached   bool           `json:"cached"`
+		Repaired bool           `json:"repaired"`
+	} `json:"result"`
+}
+
+func TestPromptTemplateCRUDAndScopes(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	rr := doJSON(t, r, "POST", "/api/ai/templates", admin, map[string]any{"name": "Bad Name", "user_prompt": "x"})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid name status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "POST", "/api/ai/templates", admin, map[string]any{"name": "weekly", "user_prompt": "x", "output_schema": []int{1}})
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid schema status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 实例模板 + 同名个人模板
+	rr = doJSON(t, r, "POST", "/api/admin/ai/templates", admin, map[string]any{"name": "weekly", "user_prompt": "实例：{{notes}}"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("admin create status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "POST", "/api/ai/templates", admin, map[string]any{"name": "weekly", "user_prompt": "个人：{{notes}}"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("user create status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var mine struct {
+		ID int `json:"id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &mine)
+	if rr := doJSON(t, r, "POST", "/api/ai/templates", admin, map[string]any{"name": "weekly", "user_prompt": "重复"}); rr.Code != http.StatusConflict {
+		t.Fatalf("duplicate status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "GET", "/api/ai/templates", admin, nil)
+	var list struct {
+		Templates []struct{ Name string } `json:"templates"`
+		Instance  []struct{ Name string } `json:"instance"`
+		Builtin   []struct{ Name string } `json:"builtin"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list.Templates) != 1 || len(list.Instance) != 1 || len(list.Builtin) < 2 {
+		t.Fatalf("list status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 其他用户看不到、也改不了我的个人模板
+	rr = doJSON(t, r, "POST", "/api/users", admin, map[string]any{"username": "bob", "password": "secret123"})
+	var bob struct {
+		ID int `json:"id"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &bob)
+	bobAuth := authHeader(t, bob.ID, "bob", false)
+	if rr := doJSON(t, r, "PUT", "/api/ai/templates/"+itoa(mine.ID), bobAuth, map[string]any{"name": "weekly", "user_prompt": "y"}); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign update status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "PUT", "/api/ai/templates/"+itoa(mine.ID), admin, map[string]any{"name": "weekly", "user_prompt": "改过：{{notes}}", "description": "周报"})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "改过") {
+		t.Fatalf("update status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "DELETE", "/api/ai/templates/"+itoa(mine.ID), admin, nil); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "DELETE", "/api/ai/templates/"+itoa(mine.ID), admin, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("delete again status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestRunPromptTemplateRendersVariables(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	srv, requests := scriptedLLM(t, "一周回顾")
+	useFakeLLM(t, r, admin, srv.URL)
+
+	for _, c := range []string{"周一跑步五公里", "周三读书"} {
+		doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": c, "tags": []string{"日常"}})
+	}
+	doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": "无关笔记"})
+
+	rr := doJSON(t, r, "POST", "/api/ai/templates", admin, map[string]any{
+		"name":        "recap",
+		"user_prompt": "范围={{time_range}} 数量={{count}} 标签={{tags}} 未知={{unknown}}\n{{notes}}",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doJSON(t, r, "POST", "/api/ai/run/recap", admin, map[string]any{}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("no selection status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/ai/run/missing", admin, map[string]any{"tag": "日常"}); rr.Code != http.StatusNotFound {
+		t.Fatalf("missing template status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "POST", "/api/ai/run/recap", admin, map[string]any{"tag": "日常", "time_range": "本周", "language": "en"})
+	var resp runTemplateResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.Scope != "user" || len(resp.NoteIDs) != 2 || resp.Result.Output != "一周回顾" {
+		t.Fatalf("run status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if len(*requests) != 1 {
+		t.Fatalf("llm calls=%d", len(*requests))
+	}
+	var user, system string
+	for _, m := range (*requests)[0] {
+		if m["role"] == "user" {
+			user = m["content"]
+		} else if m["role"] == "system" {
+			system = m["content"]
+		}
+	}
+	for _, want := range []string{"范围=本周", "数量=2", "标签=日常", "未知={{unknown}}", "周一跑步五公里", "周三读书"} {
+		if !strings.Contains(user, want) {
+			t.Fatalf("user prompt missing %q: %s", want, user)
+		}
+	}
+	if strings.Contains(user, "无关笔记") || !strings.Contains(system, "English") {
+		t.Fatalf("prompt user=%s system=%s", user, system)
+	}
+
+	// 相同输入命中缓存
+	rr = doJSON(t, r, "POST", "/api/ai/run/recap", admin, map[string]any{"tag": "日常", "time_range": "本周", "language": "en"})
+	resp = runTemplateResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || !resp.Result.Cached || len(*requests) != 1 {
+		t.Fatalf("cached run status=%d calls=%d body=%s", rr.Code, len(*requests), rr.Body.String())
+	}
+}
+
+func TestRunPromptTemplateValidatesOutputSchema(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	schema := map[string]any{
+		"type":     "object",
+		"required": []string{"mood"},
+		"properties": map[string]any{
+			"mood": map[string]any{"type": "string", "enum": []string{"good", "bad"}},
+		},
+	}
+	doJSON(t, r, "POST", "/api/admin/ai/templates", admin, map[string]any{"name": "mood", "user_prompt": "{{notes}}", "output_schema": schema})
+	doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": "今天心情不错"})
+
+	// 首次输出不符合 schema，修复重试后通过
+	srv, requests := scriptedLLM(t, `{"mood":"great"}`, "```json\n{\"mood\":\"good\"}\n```")
+	useFakeLLM(t, r, admin, srv.URL)
+	rr := doJSON(t, r, "POST", "/api/ai/run/mood", admin, map[string]any{"from": "2000-01-01"})
+	var resp runTemplateResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.Scope != "instance" || !resp.Result.Repaired || resp.Result.JSON["mood"] != "good" || len(*requests) != 2 {
+		t.Fatalf("repair status=%d calls=%d body=%s", rr.Code, len(*requests), rr.Body.String())
+	}
+
+	// 一直不合规：502 并返回原始输出
+	srv2, _ := scriptedLLM(t, "not json")
+	useFakeLLM(t, r, admin, srv2.URL)
+	rr = doJSON(t, r, "POST", "/api/ai/run/mood?refresh=true", admin, map[string]any{"from": "2000-01-01"})
+	if rr.Code != http.StatusBadGateway || !strings.Contains(rr.Body.String(), "LLM_INVALID_OUTPUT") || !strings.Contains(rr.Body.String(), "not json") {
+		t.Fatalf("invalid status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 关闭校验时原样返回
+	rr = doJSON(t, r, "POST", "/api/ai/run/mood?refresh=true", admin, map[string]any{"from": "2000-01-01", "validate": false})
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "not json") {
+		t.Fatalf("no-validate status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSummarizeUsesOverriddenTemplate(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	srv, requests := scriptedLLM(t, `{"summary":"内置"}`, `{"summary":"实例"}`, `{"summary":"个人"}`)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	summarize := func() (string, string) {
+		t.Helper()
+		rr := doJSON(t, r, "POST", "/api/summarize", admin, map[string]any{"content": "今天整理了书架"})
+		var resp struct {
+			Summary string `json:"summary"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("summarize status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		msgs := (*requests)[len(*requests)-1]
+		return resp.Summary, msgs[len(msgs)-1]["content"]
+	}
+
+	if summary, _ := summarize(); summary != "内置" {
+		t.Fatalf("builtin summary = %q", summary)
+	}
+	if rr := doJSON(t, r, "POST", "/api/admin/ai/templates", admin, map[string]any{"name": "summary", "user_prompt": "实例总结：{{notes}}"}); rr.Code != http.StatusCreated {
+		t.Fatalf("instance template status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if summary, prompt := summarize(); summary != "实例" || prompt != "实例总结：今天整理了书架" {
+		t.Fatalf("instance summary=%q prompt=%q", summary, prompt)
+	}
+	if rr := doJSON(t, r, "POST", "/api/ai/templates", admin, map[string]any{"name": "summary", "user_prompt": "个人总结：{{notes}}"}); rr.Code != http.StatusCreated {
+		t.Fatalf("user template status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if summary, prompt := summarize(); summary != "个人" || prompt != "个人总结：今天整理了书架" {
+		t.Fatalf("user summary=%q prompt=%q", summary, prompt)
+	}
+}
@@ -49,10 +49,14 @@ func setup(t *testing.T) (router *gin.Engine, adminID int, storageDir string) {
 	{
 		public.POST("/auth/login", handlers.Login)
 		public.POST("/auth/register", handlers.Register)
+		public.GET("/instance", handlers.GetInstance)
+		public.POST("/auth/forgot", handlers.ForgotPassword)
+		public.POST("/auth/reset", handlers.ResetPassword)
+		public.POST("/auth/verify-email", handlers.VerifyEmail)
 	}
 
 	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware())
+	api.Use(middleware.AuthMiddleware(), middleware.EnforceRolePermissions())
 	{
 		api.GET("/memos", handlers.ListMemos)
 		api.POST("/memos", handlers.CreateMemo)
@@ -65,10 +69,77 @@ func setup(t *testing.T) (router *gin.Engine, adminID int, storageDir string) {
 		api.GET("/review/random", handlers.RandomReview)
 
 		api.POST("/resources", handlers.UploadResource)
+		api.GET("/resources/:id/content", handlers.GetResourceContent)
+
+		api.GET("/notes/:id", handlers.GetNote)
+		api.GET("/notes/:id/summary", handlers.GetNoteSummary)
+		api.POST("/notes/:id/summary", handlers.GenerateNoteSummary)
+		api.DELETE("/notes/:id/summary", handlers.DeleteNoteSummary)
+		api.POST("/notes/:id/suggest-tags", handlers.SuggestNoteTags)
+		api.GET("/tasks", handlers.ListTasks)
+		api.GET("/tasks/:id", handlers.GetTask)
+		api.PATCH("/tasks/:id", handlers.UpdateTask)
+		api.GET("/stats/activity", handlers.GetActivityStats)
+		api.POST("/memos/:id/detect-location", handlers.DetectNoteLocation)
+		api.GET("/memos/:id/photo-location", handlers.GetPhotoLocation)
+		api.POST("/memos/:id/photo-location", handlers.ApplyPhotoLocation)
+		api.GET("/memos/:id/stocks", handlers.GetNoteStocks)
+		api.GET("/stocks/watchlist", handlers.ListWatchlist)
+		api.POST("/stocks/watchlist", handlers.AddWatchlistItem)
+		api.DELETE("/stocks/watchlist/:code", handlers.RemoveWatchlistItem)
+		api.GET("/stocks/:code/notes", handlers.GetStockNotes)
+		api.GET("/stocks/:code/indicators", handlers.GetStockIndicators)
+		api.POST("/stocks/analyze", handlers.AnalyzeStock)
+		api.POST("/stocks/mentions/rescan", handlers.RescanStockMentions)
+		api.GET("/geocode", handlers.Geocode)
+		api.PUT("/memos/:id/location", handlers.UpdateNoteLocation)
+		api.GET("/notes/by-location", handlers.GetNotesByLocation)
+		api.GET("/locations/stats", handlers.GetLocationsStats)
+		api.POST("/locations/batch-detect", handlers.BatchDetectLocations)
+		api.GET("/notes/nearby", handlers.GetNearbyNotes)
+		api.GET("/notes/clusters", handlers.GetNoteClusters)
+		api.GET("/notes/geojson", handlers.ExportNotesGeoJSON)
+		api.GET("/export", handlers.ExportNotes)
+		api.GET("/digests", handlers.ListDigests)
+		api.POST("/digests", handlers.GenerateDigest)
+		api.GET("/digests/:id", handlers.GetDigest)
+		api.DELETE("/digests/:id", handlers.DeleteDigest)
+		api.GET("/ai/templates", handlers.ListMyPromptTemplates)
+		api.POST("/ai/templates", handlers.CreateMyPromptTemplate)
+		api.PUT("/ai/templates/:id", handlers.UpdateMyPromptTemplate)
+		api.DELETE("/ai/templates/:id", handlers.DeleteMyPromptTemplate)
+		api.POST("/ai/run/:template", handlers.RunPromptTemplate)
+		api.POST("/notes/:id/lock", handlers.LockNote)
+		api.DELETE("/notes/:id/lock", handlers.RemoveNoteLock)
+		api.GET("/vault", handlers.GetVaultStatus)
+		api.POST("/vault", handlers.SetupVault)
+		api.POST("/vault/unlock", handlers.UnlockVault)
+		api.PUT("/vault/passphrase", handlers.ChangeVaultPassphrase)
 
 		api.GET("/users/me", handlers.GetMe)
+		api.GET("/roles", handlers.ListRoles)
 		api.PUT("/users/me", handlers.UpdateMe)
 		api.PUT("/users/me/password", handlers.ChangeMyPassword)
+		api.POST("/users/me/email/verify", handlers.ResendEmailVerification)
+		api.GET("/users/me/usage", handlers.GetMyUsage)
+		api.GET("/users/me/settings", handlers.GetMySettings)
+		api.PUT("/users/me/settings", handlers.UpdateMySettings)
+
+		api.POST("/summarize", handlers.SummarizeNote)
+		api.POST("/insights", handlers.GetInsight)
+		api.POST("/insights/compare", handlers.CompareInsights)
+		api.POST("/insights/:type", handlers.GetInsightByType)
+		api.GET("/insights/history", handlers.ListInsightHistory)
+		api.GET("/insights/history/:id", handlers.GetInsightHistory)
+		api.DELETE("/insights/history/:id", handlers.DeleteInsightHistory)
+		api.GET("/models/config", handlers.GetModelConfig)
+		api.POST("/models/active", handlers.SetActiveModel)
+		api.GET("/llm/profiles", handlers.ListMyLLMProfiles)
+		api.POST("/llm/profiles", handlers.CreateMyLLMProfile)
+		api.DELETE("/llm/profiles/active", handlers.DeactivateMyLLMProfile)
+		api.PUT("/llm/profiles/:id", handlers.UpdateMyLLMProfile)
+		api.DELETE("/llm/profiles/:id", handlers.DeleteMyLLMProfile)
+		api.POST("/llm/profiles/:id/activate", handlers.ActivateMyLLMProfile)
 
 		admin := api.Group("/users")
 		admin.Use(middleware.AdminOnly())
@@ -77,6 +148,28 @@ func setup(t *testing.T) (router *gin.Engine, adminID int, storageDir string) {
 			admin.POST("", handlers.AdminCreateUser)
 			admin.PUT("/:id", handlers.AdminUpdateUser)
 			admin.DELETE("/:id", handlers.AdminDeleteUser)
+			admin.PUT("/:id/role", handlers.AdminSetUserRole)
+		}
+
+		instanceAdmin := api.Group("/admin")
+		instanceAdmin.Use(middleware.RequirePermission(models.PermManageInstance))
+		{
+			instanceAdmin.PUT("/instance/registration", handlers.AdminUpdateRegistration)
+			instanceAdmin.GET("/invites", handlers.AdminListInvites)
+			instanceAdmin.POST("/invites", handlers.AdminCreateInvite)
+			instanceAdmin.DELETE("/invites/:id", handlers.AdminRevokeInvite)
+			instanceAdmin.GET("/llm/profiles", handlers.AdminListLLMProfiles)
+			instanceAdmin.POST("/llm/profiles", handlers.AdminCreateLLMProfile)
+			instanceAdmin.POST("/llm/profiles/:id/activate", handlers.AdminActivateLLMProfile)
+			instanceAdmin.GET("/llm/usage", handlers.AdminUsageReport)
+			instanceAdmin.PUT("/llm/quota", handlers.AdminSetLLMQuota)
+			instanceAdmin.PUT("/llm/quota/users/:id", handlers.AdminSetUserLLMQuota)
+			instanceAdmin.GET("/llm/cache", handlers.AdminLLMCacheStats)
+			instanceAdmin.DELETE("/llm/cache", handlers.AdminPurgeLLMCache)
+			instanceAdmin.GET("/ai/templates", handlers.AdminListPromptTemplates)
+			instanceAdmin.POST("/ai/templates", handlers.AdminCreatePromptTemplate)
+			instanceAdmin.PUT("/ai/templates/:id", handlers.AdminUpdatePromptTemplate)
+			instanceAdmin.DELETE("/ai/templates/:id", handlers.AdminDeletePromptTemplate)
 		}
 	}
 
@@ -85,7 +178,7 @@ func setup(t *testing.T) (router *gin.Engine, adminID int, storageDir string) {
 
 func authHeader(t *testing.T, userID int, username string, isAdmin bool) string {
 	t.Helper()
-	token, err := utils.GenerateToken(userID, username, isAdmin)
+	token, err := utils.GenerateToken(userID, username, models.RoleFromLegacy(isAdmin))
 	if err != nil {
 		t.Fatalf("GenerateToken: %v", err)
 	}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
+	"strings"
+
 	"memo-studio/backend/models"
 	"memo-studio/backend/utils"
 
@@ -14,9 +17,10 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
-	Email    string `json:"email"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Email      string `json:"email"`
+	InviteCode string `json:"invite_code"`
 }
 
 type AuthResponse struct {
@@ -40,7 +44,7 @@ func Login(c *gin.Context) {
 	}
 
 	// 生成 token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
@@ -72,15 +76,44 @@ func Register(c *gin.Context) {
 		return
 	}
 
-	// 创建用户
-	user, err := models.CreateUser(req.Username, req.Password, req.Email)
+	// 注册策略
+	policy, err := models.GetRegistrationPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取注册策略失败"})
+		return
+	}
+	req.Email = strings.TrimSpace(req.Email)
+	req.InviteCode = strings.TrimSpace(req.InviteCode)
+	switch policy.Mode {
+	case models.RegistrationClosed:
+		c.JSON(http.StatusForbidden, gin.H{"error": "注册已关闭", "code": "REGISTRATION_CLOSED"})
+		return
+	case models.RegistrationInvite:
+		if req.InviteCode == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "需要邀请码才能注册", "code": "INVITE_REQUIRED"})
+			return
+		}
+	case models.RegistrationDomain:
+		if req.InviteCode == "" && !policy.DomainAllowed(req.Email) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该邮箱域名不允许注册", "code": "EMAIL_DOMAIN_NOT_ALLOWED"})
+			return
+		}
+	}
+
+	// 创建用户（携带邀请码时同时核销）
+	user, err := models.RegisterUser(req.Username, req.Password, req.Email, req.InviteCode)
 	if err != nil {
+		if errors.Is(err, models.ErrInviteInvalid) {
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error(), "code": "INVITE_INVALID"})
+			return
+		}
 		c.JSON(http.StatusBadRequest, gin.H{"error": "用户名已存在"})
 		return
 	}
+	_ = sendVerificationEmail(user)
 
 	// 生成 token
-	token, err := utils.GenerateToken(user.ID, user.Username, user.IsAdmin)
+	token, err := utils.GenerateToken(user.ID, user.Username, user.Role)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
 		return
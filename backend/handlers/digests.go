@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+
+	"memo-studio/backend/middleware"
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+func validDigestPeriod(period string) bool {
+	return period == models.DigestWeekly || period == models.DigestMonthly
+}
+
+// ListDigests 定期回顾列表
+// GET /api/v1/digests?period=weekly|monthly&limit=&offset=
+func ListDigests(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	period := c.Query("period")
+	if period != "" && !validDigestPeriod(period) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 weekly 或 monthly"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	list, total, err := models.ListDigests(userID, period, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回顾失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"digests": list, "total": total, "limit": limit, "offset": offset})
+}
+
+func digestIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的回顾ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetDigest 回顾详情
+// GET /api/v1/digests/:id
+func GetDigest(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := digestIDParam(c)
+	if !ok {
+		return
+	}
+	d, err := models.GetDigest(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取回顾失败: " + err.Error()})
+		return
+	}
+	if d == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回顾不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, d)
+}
+
+// GenerateDigest 立即生成最近一个周期的回顾（不要求开启定期回顾）；
+// 已生成过时直接返回，?refresh=true 重新生成。配置了推送地址时同时推送；
+// 没有 ai 权限的角色不生成 AI 洞察
+// POST /api/v1/digests {"period": "weekly|monthly"}
+func GenerateDigest(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Period string `json:"period" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || !validDigestPeriod(req.Period) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 weekly 或 monthly"})
+		return
+	}
+	st, err := models.GetUserSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取设置失败: " + err.Error()})
+		return
+	}
+	// 没有 ai 权限时只生成基础回顾，不调用大模型
+	if !middleware.HasPermission(c, models.PermAI) {
+		st.DigestAI = false
+	}
+	refresh := c.Query("refresh") == "true" || c.Query("refresh") == "1"
+	d, created, err := services.GenerateDigest(userID, req.Period, st, services.DigestNow(), refresh)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成回顾失败: " + err.Error()})
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+		if st.DigestWebhook != "" {
+			// 推送失败只记录在回顾上，不影响生成结果
+			_ = services.DeliverDigest(d, st.DigestWebhook)
+			if fresh, err := models.GetDigest(d.ID, userID); err == nil && fresh != nil {
+				d = fresh
+			}
+		}
+	}
+	c.JSON(status, d)
+}
+
+// DeleteDigest 删除回顾
+// DELETE /api/v1/digests/:id
+func DeleteDigest(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := digestIDParam(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteDigest(id, userID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "回顾不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除回顾失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+)
+
+type digestData struct {
+	NotesCreated int               `json:"notes_created"`
+	TopTags      []models.TagCount `json:"top_tags"`
+	Sentiment    struct {
+		Positive int `json:"positive"`
+	} `json:"sentiment"`
+	NoteIDs []int `json:"note_ids"`
+}
+
+func TestDigestsScheduledAndDelivered(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	var delivered int32
+	var lastEvent string
+	hook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Event string `json:"event"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		lastEvent = body.Event
+		atomic.AddInt32(&delivered, 1)
+	}))
+	t.Cleanup(hook.Close)
+
+	if rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"digest_webhook": hook.URL}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("loopback webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 测试服务器在本机，需要管理员显式允许
+	t.Setenv("MEMO_WEBHOOK_ALLOW_HOSTS", "127.0.0.1")
+
+	if rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"digest_timezone": "Mars/Base"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad timezone status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"digest_webhook": "ftp://example.com"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad webhook status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{
+		"digest_weekly": true, "digest_timezone": "Asia/Shanghai", "digest_hour": 0, "digest_webhook": hook.URL,
+	})
+	var st models.UserSettings
+	_ = json.Unmarshal(rr.Body.Bytes(), &st)
+	if rr.Code != http.StatusOK || !st.DigestWeekly || st.DigestWeekday != 1 || st.DigestTimezone != "Asia/Shanghai" {
+		t.Fatalf("settings status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 没有笔记活动时不生成；固定时间，避免测试恰好跨越周期边界
+	now := time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC)
+	if n := services.RunDueDigests(now); n != 0 {
+		t.Fatalf("empty period generated=%d", n)
+	}
+
+	// 两条笔记落在上一周期内
+	start, _, _ := services.DigestPeriodBounds(models.DigestWeekly, st, now)
+	for _, content := range []string{"项目进展顺利，很开心", "读书笔记"} {
+		rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": content, "tags": []string{"周记"}})
+		var note models.Note
+		_ = json.Unmarshal(rr.Body.Bytes(), &note)
+		if _, err := database.DB.Exec("UPDATE notes SET created_at = ?, updated_at = ? WHERE id = ?",
+			start.Add(24*time.Hour).UTC().Format("2006-01-02 15:04:05"), start.Add(24*time.Hour).UTC().Format("2006-01-02 15:04:05"), note.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if n := services.RunDueDigests(now); n != 1 {
+		t.Fatalf("generated=%d", n)
+	}
+	if n := services.RunDueDigests(now); n != 0 {
+		t.Fatalf("second run generated=%d", n)
+	}
+	if atomic.LoadInt32(&delivered) != 1 || lastEvent != "digest" {
+		t.Fatalf("delivered=%d event=%q", delivered, lastEvent)
+	}
+
+	rr = doJSON(t, r, "GET", "/api/digests", admin, nil)
+	var list struct {
+		Digests []models.Digest `json:"digests"`
+		Total   int             `json:"total"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || list.Total != 1 || list.Digests[0].Period != "weekly" || list.Digests[0].DeliveredAt == nil {
+		t.Fatalf("list status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var data digestData
+	_ = json.Unmarshal(list.Digests[0].Data, &data)
+	if data.NotesCreated != 2 || len(data.TopTags) != 1 || data.TopTags[0].Name != "周记" || data.TopTags[0].Count != 2 || data.Sentiment.Positive != 1 || len(data.NoteIDs) != 2 {
+		t.Fatalf("digest data=%s", list.Digests[0].Data)
+	}
+	if !list.Digests[0].PeriodStart.Equal(start) {
+		t.Fatalf("period_start=%v want %v", list.Digests[0].PeriodStart, start)
+	}
+}
+
+// fixDigestClock 固定按需生成回顾使用的时间
+func fixDigestClock(t *testing.T, now time.Time) {
+	t.Helper()
+	services.SetDigestClock(func() time.Time { return now })
+	t.Cleanup(func() { services.SetDigestClock(time.Now) })
+}
+
+func TestDigestsGenerateOnDemand(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+	fixDigestClock(t, time.Date(2026, 10, 21, 12, 0, 0, 0, time.UTC))
+
+	if rr := doJSON(t, r, "POST", "/api/digests", admin, map[string]any{"period": "daily"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad period status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr := doJSON(t, r, "POST", "/api/digests", admin, map[string]any{"period": "monthly"})
+	var d models.Digest
+	_ = json.Unmarshal(rr.Body.Bytes(), &d)
+	if rr.Code != http.StatusCreated || d.Period != "monthly" || d.Content == "" {
+		t.Fatalf("generate status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/digests", admin, map[string]any{"period": "monthly"}); rr.Code != http.StatusOK {
+		t.Fatalf("existing status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "POST", "/api/digests?refresh=true", admin, map[string]any{"period": "monthly"})
+	var again models.Digest
+	_ = json.Unmarshal(rr.Body.Bytes(), &again)
+	if rr.Code != http.StatusCreated || again.ID == d.ID {
+		t.Fatalf("refresh status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 其他用户看不到
+	rr = doJSON(t, r, "POST", "/api/users", admin, map[string]any{"username": "dave", "password": "dave12345", "email": "d@example.com"})
+	var dave models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &dave)
+	if rr := doJSON(t, r, "GET", "/api/digests/"+itoa(again.ID), authHeader(t, dave.ID, "dave", false), nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign get status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	if rr := doJSON(t, r, "DELETE", "/api/digests/"+itoa(again.ID), admin, nil); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "GET", "/api/digests/"+itoa(again.ID), admin, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("get deleted status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
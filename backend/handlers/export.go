@@ -12,6 +12,12 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+// exportSkippedNote 导出时跳过的加密笔记
+type exportSkippedNote struct {
+	ID    int    `json:"id"`
+	Title string `json:"title"`
+}
+
 // ExportNotes GET /api/export?format=json|markdown&limit=500
 func ExportNotes(c *gin.Context) {
 	userID, ok := mustUserID(c)
@@ -38,13 +44,28 @@ func ExportNotes(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败: " + err.Error()})
 		return
 	}
-	if notes == nil {
-		notes = []models.Note{}
+	// 加密笔记的内容无法明文导出：跳过并在导出信息中列出，避免导出空白笔记
+	exported := make([]models.Note, 0, len(notes))
+	skipped := []exportSkippedNote{}
+	for _, n := range notes {
+		if n.Locked {
+			skipped = append(skipped, exportSkippedNote{ID: n.ID, Title: n.Title})
+			continue
+		}
+		exported = append(exported, n)
 	}
+	notes = exported
 	if format == "markdown" {
 		var buf bytes.Buffer
 		buf.WriteString("# Memo Studio 导出\n\n")
 		buf.WriteString("导出时间: " + time.Now().Format(time.RFC3339) + "\n\n")
+		if len(skipped) > 0 {
+			buf.WriteString("已跳过 " + strconv.Itoa(len(skipped)) + " 篇加密笔记（需解锁后单独查看）:\n\n")
+			for _, sk := range skipped {
+				buf.WriteString("- " + escapeMarkdownTitle(sk.Title) + " (#" + strconv.Itoa(sk.ID) + ")\n")
+			}
+			buf.WriteString("\n")
+		}
 		buf.WriteString("---\n\n")
 		for i, n := range notes {
 			buf.WriteString("## ")
@@ -74,9 +95,10 @@ func ExportNotes(c *gin.Context) {
 	// json
 	c.Header("Content-Disposition", "attachment; filename=memo-export-"+time.Now().Format("20060102-150405")+".json")
 	c.JSON(http.StatusOK, gin.H{
-		"exported_at": time.Now().Format(time.RFC3339),
-		"count":       len(notes),
-		"notes":       notes,
+		"exported_at":    time.Now().Format(time.RFC3339),
+		"count":          len(notes),
+		"notes":          notes,
+		"skipped_locked": skipped,
 	})
 }
 
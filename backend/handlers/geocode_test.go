@@ -0,0 +1,108 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+func TestGeocodeEndpoint(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		hits.Add(1)
+		if req.URL.Query().Get("q") == "Nowhere Cafe" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"lat":"31.2200","lon":"121.4600","name":"Blue Bottle","addresstype":"amenity","address":{"city":"上海市","country_code":"cn"}}]`))
+	}))
+	defer srv.Close()
+
+	prev := services.GetGeocoder()
+	services.SetGeocoder(services.ChainGeocoder{
+		&services.GazetteerGeocoder{Gazetteer: services.DefaultGazetteer()},
+		&services.CachedGeocoder{
+			Geocoder: &services.NominatimGeocoder{BaseURL: srv.URL, Interval: time.Millisecond},
+			TTL:      time.Hour,
+		},
+	})
+	t.Cleanup(func() { services.SetGeocoder(prev) })
+
+	type geocodeResponse struct {
+		Found bool              `json:"found"`
+		Label string            `json:"label"`
+		Place services.GeoPlace `json:"place"`
+	}
+	geocode := func(q string) geocodeResponse {
+		t.Helper()
+		rr := doJSON(t, r, "GET", "/api/geocode?q="+url.QueryEscape(q), auth, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("geocode %q status=%d body=%s", q, rr.Code, rr.Body.String())
+		}
+		var resp geocodeResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return resp
+	}
+
+	// 离线地名库命中时不请求在线服务
+	resp := geocode("杭州市")
+	if !resp.Found || resp.Label != "杭州" || resp.Place.Provider != "gazetteer" || math.Abs(resp.Place.Latitude-30.2741) > 1e-6 {
+		t.Fatalf("杭州市 = %+v", resp)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("online provider called for gazetteer hit")
+	}
+
+	// 在线结果（包括查不到）写入 geocode_cache，再次查询不再请求
+	for i := 0; i < 2; i++ {
+		resp = geocode("Blue Bottle 静安")
+		if !resp.Found || resp.Place.Name != "Blue Bottle" || resp.Place.Provider != "nominatim" || resp.Place.Latitude != 31.22 {
+			t.Fatalf("Blue Bottle = %+v", resp)
+		}
+		if resp = geocode("Nowhere Cafe"); resp.Found {
+			t.Fatalf("Nowhere Cafe = %+v", resp)
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("online requests = %d, want 2", got)
+	}
+
+	if rr := doJSON(t, r, "GET", "/api/geocode", auth, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("missing q status=%d", rr.Code)
+	}
+}
+
+func TestDetectNoteLocationUsesGazetteer(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	id := createNoteAt(t, r, auth, "下班后在深圳南山区的海边跑步", nil, 0)
+	rr := doJSON(t, r, "POST", "/api/memos/"+itoa(id)+"/detect-location", auth, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("detect status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Detected  bool    `json:"detected"`
+		Location  string  `json:"location"`
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !resp.Detected || resp.Location != "深圳南山区" || math.Abs(resp.Latitude-22.5333) > 1e-6 || math.Abs(resp.Longitude-113.9304) > 1e-6 {
+		t.Fatalf("detect = %+v", resp)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// insightHistoryParams 保存到洞察历史中的生成参数
+type insightHistoryParams struct {
+	TimeRange    string        `json:"time_range"`
+	Perspectives []InsightType `json:"perspectives"`
+	InsightSelection
+	TextNotes int `json:"text_notes,omitempty"` // 旧客户端直接提交的笔记数
+}
+
+// saveInsightHistory 保存洞察及其离线统计快照，返回历史 ID；失败只记录日志，不影响本次响应。
+// 服务端选取时 sel 给出时间窗口（未指定结束时间时截至现在）；客户端提交文本时没有时间窗口
+func saveInsightHistory(userID int, req InsightRequest, sel *models.NoteSelection, notes []services.AnalysisNote, basis insightBasis, response InsightResponse) int {
+	params := insightHistoryParams{
+		TimeRange:        req.TimeRange,
+		Perspectives:     req.Perspectives,
+		InsightSelection: req.InsightSelection,
+		TextNotes:        len(req.Notes),
+	}
+	in := models.SavedInsight{
+		UserID:    userID,
+		Provider:  response.Provider,
+		Summary:   response.Summary,
+		NoteCount: len(notes),
+	}
+	if sel != nil {
+		w := selectionWindow(*sel)
+		in.PeriodStart, in.PeriodEnd = w.From, w.To
+	}
+	var err error
+	if in.Params, err = json.Marshal(params); err == nil {
+		if in.Data, err = json.Marshal(response); err == nil {
+			in.Stats, err = json.Marshal(services.SnapshotNotes(notes, basis.corpus))
+		}
+	}
+	if err != nil {
+		log.Printf("保存洞察历史失败: %v", err)
+		return 0
+	}
+	saved, err := models.CreateSavedInsight(in)
+	if err != nil {
+		log.Printf("保存洞察历史失败: %v", err)
+		return 0
+	}
+	return saved.ID
+}
+
+// ListInsightHistory 洞察历史（不含完整结果）
+// GET /api/v1/insights/history?limit=&offset=
+func ListInsightHistory(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	list, total, err := models.ListSavedInsights(userID, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取洞察历史失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"insights": list, "total": total, "limit": limit, "offset": offset})
+}
+
+func insightHistoryIDParam(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的洞察ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+// GetInsightHistory 洞察历史详情：参数、时间窗口、完整结果与统计快照
+// GET /api/v1/insights/history/:id
+func GetInsightHistory(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := insightHistoryIDParam(c)
+	if !ok {
+		return
+	}
+	in, err := models.GetSavedInsight(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取洞察失败: " + err.Error()})
+		return
+	}
+	if in == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "洞察不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, in)
+}
+
+// DeleteInsightHistory 删除洞察历史
+// DELETE /api/v1/insights/history/:id
+func DeleteInsightHistory(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, ok := insightHistoryIDParam(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteSavedInsight(id, userID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "洞察不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除洞察失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
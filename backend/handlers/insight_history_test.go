@@ -0,0 +1,154 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/models"
+)
+
+type compareResponse struct {
+	Period1 insightResponse `json:"period1"`
+	Period2 insightResponse `json:"period2"`
+	Changes []map[string]string
+	Diff    struct {
+		Notes struct {
+			Before int `json:"before"`
+			After  int `json:"after"`
+		} `json:"notes"`
+		Keywords []struct {
+			Term  string `json:"term"`
+			Trend string `json:"trend"`
+		} `json:"keywords"`
+		Sentiment struct {
+			Shift     float64 `json:"shift"`
+			Direction string  `json:"direction"`
+		} `json:"sentiment"`
+	} `json:"diff"`
+	Windows []struct {
+		From *time.Time `json:"from"`
+		To   *time.Time `json:"to"`
+	} `json:"windows"`
+}
+
+func TestInsightHistoryAndCompareByIDs(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	createNoteAt(t, r, admin, "装修进度拖延，很焦虑", []string{"装修"}, 20)
+	createNoteAt(t, r, admin, "装修验收顺利，非常开心", []string{"装修"}, 1)
+	createNoteAt(t, r, admin, "新家搬家顺利", []string{"装修"}, 1)
+
+	var ids []int
+	for _, body := range []map[string]any{
+		{"tag": "装修", "from": time.Now().AddDate(0, 0, -30).Format("2006-01-02"), "to": time.Now().AddDate(0, 0, -10).Format("2006-01-02")},
+		{"tag": "装修", "time_range": "7d"},
+	} {
+		rr := doJSON(t, r, "POST", "/api/insights", admin, body)
+		var resp struct {
+			ID int `json:"id"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		if rr.Code != http.StatusOK || resp.ID == 0 {
+			t.Fatalf("insight status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		ids = append(ids, resp.ID)
+	}
+
+	rr := doJSON(t, r, "GET", "/api/insights/history", admin, nil)
+	var list struct {
+		Insights []models.SavedInsight `json:"insights"`
+		Total    int                   `json:"total"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || list.Total != 2 || list.Insights[0].ID != ids[1] || list.Insights[0].Data != nil {
+		t.Fatalf("history status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if list.Insights[0].NoteCount != 2 || list.Insights[0].PeriodStart == nil || list.Insights[0].PeriodEnd == nil {
+		t.Fatalf("history item=%+v", list.Insights[0])
+	}
+
+	rr = doJSON(t, r, "GET", "/api/insights/history/"+itoa(ids[0]), admin, nil)
+	var detail models.SavedInsight
+	_ = json.Unmarshal(rr.Body.Bytes(), &detail)
+	var params struct {
+		Tag  string `json:"tag"`
+		From string `json:"from"`
+	}
+	_ = json.Unmarshal(detail.Params, &params)
+	if rr.Code != http.StatusOK || params.Tag != "装修" || params.From == "" || len(detail.Data) == 0 || len(detail.Stats) == 0 {
+		t.Fatalf("detail status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "POST", "/api/insights/compare", admin, map[string]any{"insight_ids": ids})
+	var cmp compareResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &cmp)
+	if rr.Code != http.StatusOK || cmp.Period1.Provider != "basic" || cmp.Diff.Notes.Before != 1 || cmp.Diff.Notes.After != 2 {
+		t.Fatalf("compare status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if cmp.Diff.Sentiment.Direction != "improved" || cmp.Diff.Sentiment.Shift <= 0 || len(cmp.Windows) != 2 {
+		t.Fatalf("compare diff=%+v", cmp.Diff)
+	}
+	trends := map[string]string{}
+	for _, k := range cmp.Diff.Keywords {
+		trends[k.Term] = k.Trend
+	}
+	if trends["顺利"] != "new" || trends["拖延"] != "gone" {
+		t.Fatalf("keyword trends=%v", trends)
+	}
+
+	// 其他用户看不到也不能对比
+	rr = doJSON(t, r, "POST", "/api/users", admin, map[string]any{"username": "dave", "password": "dave12345", "email": "d@example.com"})
+	var dave models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &dave)
+	daveAuth := authHeader(t, dave.ID, "dave", false)
+	if rr := doJSON(t, r, "GET", "/api/insights/history/"+itoa(ids[0]), daveAuth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign detail status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "POST", "/api/insights/compare", daveAuth, map[string]any{"insight_ids": ids}); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign compare status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "POST", "/api/insights/compare", admin, map[string]any{"insight_ids": ids[:1]}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("single id compare status=%d", rr.Code)
+	}
+
+	if rr := doJSON(t, r, "DELETE", "/api/insights/history/"+itoa(ids[0]), admin, nil); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "GET", "/api/insights/history/"+itoa(ids[0]), admin, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("deleted detail status=%d", rr.Code)
+	}
+}
+
+func TestInsightCompareCalendarPeriods(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	now := time.Now()
+	lastMonth := time.Date(now.Year(), now.Month(), 1, 12, 0, 0, 0, time.Local).AddDate(0, 0, -3)
+	old := createNoteAt(t, r, admin, "考试失败，很难过", nil, 0)
+	if _, err := database.DB.Exec("UPDATE notes SET created_at = ? WHERE id = ?", lastMonth.UTC().Format("2006-01-02 15:04:05"), old); err != nil {
+		t.Fatal(err)
+	}
+	recent := createNoteAt(t, r, admin, "考试通过，非常开心", nil, 0)
+
+	rr := doJSON(t, r, "POST", "/api/insights/compare", admin, map[string]any{"period": "month"})
+	var cmp compareResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &cmp)
+	if rr.Code != http.StatusOK || len(cmp.Period1.NoteIDs) != 1 || cmp.Period1.NoteIDs[0] != old || len(cmp.Period2.NoteIDs) != 1 || cmp.Period2.NoteIDs[0] != recent {
+		t.Fatalf("compare status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if cmp.Diff.Sentiment.Direction != "improved" || len(cmp.Windows) != 2 || cmp.Windows[1].From.Day() != 1 {
+		t.Fatalf("compare diff=%+v windows=%+v", cmp.Diff, cmp.Windows)
+	}
+	if len(cmp.Changes) < 3 || cmp.Changes[2]["category"] != "情绪" {
+		t.Fatalf("changes=%v", cmp.Changes)
+	}
+
+	if rr := doJSON(t, r, "POST", "/api/insights/compare", admin, map[string]any{"period": "decade"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad period status=%d", rr.Code)
+	}
+}
@@ -1,11 +1,19 @@
 package handlers
 
 import (
+	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"memo-studio/backend/models"
 	"memo-studio/backend/services"
+	"memo-studio/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,20 +32,42 @@ const (
 	InsightAll        InsightType = "all"           // 全部视角
 )
 
-// InsightRequest 洞察请求
+// InsightRequest 洞察请求：未提交 notes 时按选取条件在服务端读取笔记
 type InsightRequest struct {
-	Notes       []string     `json:"notes"`
+	Notes       []string     `json:"notes"` // 已弃用：客户端直接提交的笔记文本
 	TimeRange   string       `json:"time_range"`
 	Perspectives []InsightType `json:"perspectives"`
+	InsightSelection
+}
+
+// InsightSelection 服务端选取笔记的条件（条件之间为“且”）；
+// 未指定 from/to 时按 time_range（如 7d、4w、3m、1y，all 表示不限）限定
+type InsightSelection struct {
+	NoteIDs    []int  `json:"note_ids"`
+	Tag        string `json:"tag"`
+	NotebookID int    `json:"notebook_id"`
+	From       string `json:"from"` // YYYY-MM-DD
+	To         string `json:"to"`   // YYYY-MM-DD（含当天）
+	Limit      int    `json:"limit"`
 }
 
 // InsightResponse 洞察响应
 type InsightResponse struct {
+	ID           int               `json:"id,omitempty"`       // 洞察历史 ID
 	Summary      string             `json:"summary"`
 	Perspectives []PerspectiveInsight `json:"perspectives"`
 	Highlights   []string          `json:"highlights"`
 	ActionItems  []string          `json:"action_items"`
 	UpdateTime   string            `json:"update_time"`
+	Provider     string            `json:"provider"`           // 实际作答的模型；basic 表示本地规则分析
+	Model        string            `json:"model,omitempty"`
+	Fallback     bool              `json:"fallback,omitempty"` // 是否由备用模型作答
+	Cached       bool              `json:"cached"`             // 是否命中缓存
+	NoteIDs      []int             `json:"note_ids,omitempty"` // 服务端选取时参与分析的笔记
+	Evidence     []services.InsightEvidence `json:"evidence,omitempty"` // AI 结论及依据的笔记
+	Chunks       int               `json:"chunks,omitempty"`   // 超出模型上下文时的分段数
+	Keywords     []services.Keyword   `json:"keywords,omitempty"`   // 以用户笔记库为基准的 TF-IDF 关键词
+	MoodTrend    []services.MoodPoint `json:"mood_trend,omitempty"` // 按创建时间分段的情绪趋势
 }
 
 // PerspectiveInsight 单个视角的洞察
@@ -48,6 +78,7 @@ type PerspectiveInsight struct {
 	Details  []DetailItem `json:"details"`
 	Highlights []string  `json:"highlights"`
 	Score    int        `json:"score"`
+	NoteIDs  []int      `json:"note_ids,omitempty"` // 支撑该视角的笔记
 }
 
 // DetailItem 详细分析项
@@ -56,6 +87,7 @@ type DetailItem struct {
 	Content string `json:"content"`
 	Icon    string `json:"icon"`
 	Count   int    `json:"count"`
+	NoteIDs []int  `json:"note_ids,omitempty"`
 }
 
 // SummarizeResponse 总结响应
@@ -63,17 +95,19 @@ type SummarizeResponse struct {
 	Summary     string   `json:"summary"`
 	Highlights  []string `json:"highlights"`
 	ActionItems []string `json:"action_items"`
+	Provider    string   `json:"provider,omitempty"`
+	Fallback    bool     `json:"fallback,omitempty"`
+	Cached      bool     `json:"cached"`
 }
 
 // GetInsight 获取笔记洞察（多视角）
 // POST /api/insights
 func GetInsight(c *gin.Context) {
-	var req struct {
-		Notes       []string     `json:"notes"`
-		TimeRange   string       `json:"time_range"`
-		Perspectives []InsightType `json:"perspectives"`
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
 	}
-
+	var req InsightRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
 		return
@@ -86,46 +120,87 @@ func GetInsight(c *gin.Context) {
 		req.Perspectives = []InsightType{InsightAll}
 	}
 
-	// 检查是否配置了 LLM
-	hasAPIKey := os.Getenv("OPENAI_API_KEY") != "" ||
-		os.Getenv("LLM_API_KEY") != "" ||
-		os.Getenv("ANTHROPIC_API_KEY") != "" ||
-		os.Getenv("DEEPSEEK_API_KEY") != "" ||
-		os.Getenv("ZHIPU_API_KEY") != ""
+	// 兼容旧客户端：提交了 notes 时直接分析这些文本
+	notes := services.TextsForAnalysis(req.Notes)
+	var selected []models.Note
+	var window *models.NoteSelection
+	if len(req.Notes) == 0 {
+		sel, ok := bindInsightSelection(c, userID, req.InsightSelection, req.TimeRange)
+		if !ok {
+			return
+		}
+		window = &sel
+		var err error
+		if selected, err = models.SelectNotes(sel); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取笔记失败: " + err.Error()})
+			return
+		}
+		notes = services.NotesForAnalysis(selected)
+	}
+
+	// 检查调用者的模型配置是否可用
+	llmService := llmServiceForRequest(c)
+	basis := loadInsightBasis(userID)
 
 	var response InsightResponse
 
-	if hasAPIKey && len(req.Notes) > 0 {
+	if llmService.Configured() && len(notes) > 0 {
 		// 使用 LLM 生成洞察
-		llmService := services.NewLLMService()
-		aiInsight, err := llmService.GenerateInsight(services.InsightRequest{
-			Notes:     req.Notes,
-			TimeRange: req.TimeRange,
-		})
-		
+		var aiInsight *services.InsightResponse
+		var err error
+		if selected != nil {
+			aiInsight, err = llmService.GenerateNoteInsight(selected, insightRangeLabel(req.TimeRange, req.InsightSelection))
+		} else {
+			aiInsight, err = llmService.GenerateInsight(services.InsightRequest{
+				Notes:     req.Notes,
+				TimeRange: req.TimeRange,
+			})
+		}
+
 		if err == nil {
 			// 转换为多视角格式
 			response = convertToMultiPerspective(aiInsight, req)
+			response.Provider, response.Model, response.Fallback = aiInsight.Provider, aiInsight.Model, aiInsight.Fallback
+			response.Cached = aiInsight.Cached
+			response.Evidence, response.Chunks = aiInsight.Evidence, aiInsight.Chunks
 		} else {
-			response = generateBasicInsight(req.Notes, req.TimeRange)
+			if abortIfQuotaExceeded(c, err) {
+				return
+			}
+			log.Printf("AI 洞察失败，使用基础分析: %v", err)
+			response = generateBasicInsight(notes, basis, req.TimeRange)
 		}
 	} else {
 		// 使用基础分析
-		response = generateBasicInsight(req.Notes, req.TimeRange)
+		response = generateBasicInsight(notes, basis, req.TimeRange)
+	}
+	// 情绪趋势由本地分析给出，不依赖模型
+	if response.MoodTrend == nil {
+		response.MoodTrend = services.MoodTrend(notes, "", basis.loc)
 	}
 
+	if response.Provider == "" {
+		response.Provider = basicInsightProvider
+	}
+	response.NoteIDs = insightNoteIDs(notes)
 	response.UpdateTime = time.Now().Format("2006-01-02 15:04:05")
+	response.ID = saveInsightHistory(userID, req, window, notes, basis, response)
 	c.JSON(http.StatusOK, response)
 }
 
 // GetInsightByType 获取特定视角的洞察
 // POST /api/insights/:type
 func GetInsightByType(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	insightType := InsightType(c.Param("type"))
 
 	var req struct {
 		Notes     []string `json:"notes"`
 		TimeRange string   `json:"time_range"`
+		InsightSelection
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -137,16 +212,44 @@ func GetInsightByType(c *gin.Context) {
 		req.TimeRange = "30d"
 	}
 
-	response := generatePerspective(insightType, req.Notes, req.TimeRange)
+	notes := services.TextsForAnalysis(req.Notes)
+	if len(req.Notes) == 0 {
+		sel, ok := bindInsightSelection(c, userID, req.InsightSelection, req.TimeRange)
+		if !ok {
+			return
+		}
+		selected, err := models.SelectNotes(sel)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取笔记失败: " + err.Error()})
+			return
+		}
+		notes = services.NotesForAnalysis(selected)
+	}
+
+	response := generatePerspective(insightType, notes, loadInsightBasis(userID), req.TimeRange)
 	c.JSON(http.StatusOK, response)
 }
 
-// CompareInsights 对比分析
+// CompareInsights 对比分析：默认比较 time_range 内与其前一个等长时段；
+// 也可用 period（week/month/year：本周期至今 vs 上一个完整周期）、period1 / period2 指定两个时段，
+// 或用 insight_ids 对比两条洞察历史（先旧后新）。返回关键词与情绪的变化
 // POST /api/insights/compare
 func CompareInsights(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	var req struct {
 		Notes1 []string `json:"notes1"`
 		Notes2 []string `json:"notes2"`
+
+		InsightIDs []int             `json:"insight_ids"`
+		TimeRange  string            `json:"time_range"`
+		Period     string            `json:"period"`
+		Tag        string            `json:"tag"`
+		NotebookID int               `json:"notebook_id"`
+		Period1    *InsightSelection `json:"period1"`
+		Period2    *InsightSelection `json:"period2"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -154,16 +257,231 @@ func CompareInsights(c *gin.Context) {
 		return
 	}
 
-	insight1 := generateBasicInsight(req.Notes1, "period1")
-	insight2 := generateBasicInsight(req.Notes2, "period2")
+	if len(req.InsightIDs) > 0 {
+		compareSavedInsights(c, userID, req.InsightIDs)
+		return
+	}
+
+	basis := loadInsightBasis(userID)
+	notes1, notes2 := services.TextsForAnalysis(req.Notes1), services.TextsForAnalysis(req.Notes2)
+	var windows []insightWindow
+	if len(req.Notes1) == 0 && len(req.Notes2) == 0 {
+		var sel1, sel2 models.NoteSelection
+		switch {
+		case req.Period1 != nil || req.Period2 != nil:
+			if req.Period1 == nil || req.Period2 == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "period1 与 period2 需同时指定"})
+				return
+			}
+			for _, p := range []*InsightSelection{req.Period1, req.Period2} {
+				if p.Tag == "" {
+					p.Tag = req.Tag
+				}
+				if p.NotebookID == 0 {
+					p.NotebookID = req.NotebookID
+				}
+			}
+			if sel1, ok = bindInsightSelection(c, userID, *req.Period1, "all"); !ok {
+				return
+			}
+			if sel2, ok = bindInsightSelection(c, userID, *req.Period2, "all"); !ok {
+				return
+			}
+		case req.Period != "":
+			start1, start2, ok := calendarPeriods(req.Period, time.Now().In(basis.loc))
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "period 只能是 week、month 或 year"})
+				return
+			}
+			base := models.NoteSelection{UserID: userID, Tag: req.Tag, NotebookID: req.NotebookID}
+			sel1, sel2 = base, base
+			sel1.From, sel1.To = &start1, &start2
+			sel2.From = &start2
+		default:
+			if req.TimeRange == "" {
+				req.TimeRange = "30d"
+			}
+			days, ok := timeRangeDays(req.TimeRange)
+			if !ok {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "time_range 应为 7d、4w、3m 等相对时长，或指定 period、period1/period2"})
+				return
+			}
+			now := time.Now()
+			mid := now.AddDate(0, 0, -days)
+			start := mid.AddDate(0, 0, -days)
+			base := models.NoteSelection{UserID: userID, Tag: req.Tag, NotebookID: req.NotebookID}
+			sel1, sel2 = base, base
+			sel1.From, sel1.To = &start, &mid
+			sel2.From = &mid
+		}
+		selected1, err := models.SelectNotes(sel1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取笔记失败: " + err.Error()})
+			return
+		}
+		selected2, err := models.SelectNotes(sel2)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取笔记失败: " + err.Error()})
+			return
+		}
+		notes1, notes2 = services.NotesForAnalysis(selected1), services.NotesForAnalysis(selected2)
+		windows = []insightWindow{selectionWindow(sel1), selectionWindow(sel2)}
+	}
+
+	insight1 := generateBasicInsight(notes1, basis, "period1")
+	insight2 := generateBasicInsight(notes2, basis, "period2")
+	insight1.NoteIDs = insightNoteIDs(notes1)
+	insight2.NoteIDs = insightNoteIDs(notes2)
+	diff := services.CompareSnapshots(services.SnapshotNotes(notes1, basis.corpus), services.SnapshotNotes(notes2, basis.corpus))
+
+	resp := gin.H{
+		"period1": insight1,
+		"period2": insight2,
+		"changes": generateChanges(diff),
+		"diff":    diff,
+	}
+	if windows != nil {
+		resp["windows"] = windows
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// insightWindow 对比时段的时间窗口；边界为空表示不限
+type insightWindow struct {
+	From *time.Time `json:"from,omitempty"`
+	To   *time.Time `json:"to,omitempty"`
+}
 
+// selectionWindow 选取条件的时间窗口；未指定结束时间时截至现在
+func selectionWindow(sel models.NoteSelection) insightWindow {
+	w := insightWindow{From: sel.From, To: sel.To}
+	if w.To == nil {
+		now := time.Now()
+		w.To = &now
+	}
+	return w
+}
+
+// calendarPeriods 自然周期：上一个完整周期 [start1, start2) 与本周期 start2 至今；周从周一开始
+func calendarPeriods(period string, now time.Time) (start1, start2 time.Time, ok bool) {
+	switch period {
+	case "week":
+		start2 = models.ActivityBucketStart(now, models.ActivityWeek)
+		start1 = start2.AddDate(0, 0, -7)
+	case "month":
+		start2 = models.ActivityBucketStart(now, models.ActivityMonth)
+		start1 = start2.AddDate(0, -1, 0)
+	case "year":
+		start2 = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+		start1 = start2.AddDate(-1, 0, 0)
+	default:
+		return start1, start2, false
+	}
+	return start1, start2, true
+}
+
+// compareSavedInsights 对比两条洞察历史：结果取自保存时的数据，变化基于保存时的统计快照
+func compareSavedInsights(c *gin.Context, userID int, ids []int) {
+	if len(ids) != 2 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "insight_ids 需要两个洞察ID"})
+		return
+	}
+	var saved [2]*models.SavedInsight
+	var insights [2]InsightResponse
+	var snaps [2]services.InsightSnapshot
+	for i, id := range ids {
+		in, err := models.GetSavedInsight(id, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取洞察失败: " + err.Error()})
+			return
+		}
+		if in == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "洞察不存在: " + itoa(id)})
+			return
+		}
+		if err := json.Unmarshal(in.Data, &insights[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "洞察数据损坏: " + err.Error()})
+			return
+		}
+		if err := json.Unmarshal(in.Stats, &snaps[i]); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "洞察数据损坏: " + err.Error()})
+			return
+		}
+		insights[i].ID = in.ID
+		saved[i] = in
+	}
+	diff := services.CompareSnapshots(snaps[0], snaps[1])
 	c.JSON(http.StatusOK, gin.H{
-		"period1":  insight1,
-		"period2":  insight2,
-		"changes":  generateChanges(insight1, insight2),
+		"period1": insights[0],
+		"period2": insights[1],
+		"changes": generateChanges(diff),
+		"diff":    diff,
+		"windows": []insightWindow{
+			{From: saved[0].PeriodStart, To: saved[0].PeriodEnd},
+			{From: saved[1].PeriodStart, To: saved[1].PeriodEnd},
+		},
 	})
 }
 
+// insightRangeRe 相对时间范围，如 7d、4w、3m、1y
+var insightRangeRe = regexp.MustCompile(`^(\d+)([dwmy])$`)
+
+// timeRangeDays 相对时间范围对应的天数；all、空或无法识别时返回 false
+func timeRangeDays(tr string) (int, bool) {
+	m := insightRangeRe.FindStringSubmatch(strings.ToLower(strings.TrimSpace(tr)))
+	if m == nil {
+		return 0, false
+	}
+	n, err := strconv.Atoi(m[1])
+	if err != nil || n <= 0 || n > 3650 {
+		return 0, false
+	}
+	switch m[2] {
+	case "w":
+		n *= 7
+	case "m":
+		n *= 30
+	case "y":
+		n *= 365
+	}
+	return n, true
+}
+
+// bindInsightSelection 把请求中的选取条件转换为查询条件；日期格式错误时写入 400 响应
+func bindInsightSelection(c *gin.Context, userID int, in InsightSelection, timeRange string) (models.NoteSelection, bool) {
+	from, to, err := parseDateRange(in.From, in.To)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.NoteSelection{}, false
+	}
+	if from == nil && to == nil {
+		if days, ok := timeRangeDays(timeRange); ok {
+			start := time.Now().AddDate(0, 0, -days)
+			from = &start
+		}
+	}
+	return models.NoteSelection{
+		UserID:     userID,
+		IDs:        in.NoteIDs,
+		Tag:        in.Tag,
+		NotebookID: in.NotebookID,
+		From:       from,
+		To:         to,
+		Limit:      in.Limit,
+	}, true
+}
+
+// insightRangeLabel 提示词中的时间范围说明
+func insightRangeLabel(timeRange string, in InsightSelection) string {
+	if in.From != "" || in.To != "" {
+		return strings.TrimSpace(in.From + " ~ " + in.To)
+	}
+	if label := formatTimeRange(timeRange); label != "" {
+		return label
+	}
+	return timeRange
+}
+
 // SummarizeNote 总结单条笔记
 // POST /api/summarize
 func SummarizeNote(c *gin.Context) {
@@ -180,13 +498,9 @@ func SummarizeNote(c *gin.Context) {
 		return
 	}
 
-	// 检查是否配置了 LLM
-	hasAPIKey := os.Getenv("OPENAI_API_KEY") != "" ||
-		os.Getenv("LLM_API_KEY") != "" ||
-		os.Getenv("ANTHROPIC_API_KEY") != ""
-
-	if hasAPIKey {
-		llmService := services.NewLLMService()
+	// 检查调用者的模型配置是否可用
+	llmService := llmServiceForRequest(c)
+	if llmService.Configured() {
 		summary, err := llmService.GenerateSummary(services.SummarizeRequest{
 			Content: req.Content,
 		})
@@ -195,11 +509,17 @@ func SummarizeNote(c *gin.Context) {
 			c.JSON(http.StatusOK, summary)
 			return
 		}
+		if abortIfQuotaExceeded(c, err) {
+			return
+		}
+		// 主模型与备用模型均失败
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI 总结失败: " + err.Error(), "code": "LLM_UNAVAILABLE"})
+		return
 	}
 
 	// 返回基础总结
 	c.JSON(http.StatusOK, SummarizeResponse{
-		Summary:    "（请配置 LLM_API_KEY 启用 AI 总结）",
+		Summary:    "（请在模型设置中配置 API Key 启用 AI 总结）",
 		Highlights: []string{},
 		ActionItems: []string{},
 	})
@@ -226,11 +546,12 @@ func BatchSummarize(c *gin.Context) {
 		req.Limit = 10
 	}
 
-	hasAPIKey := os.Getenv("OPENAI_API_KEY") != "" ||
-		os.Getenv("LLM_API_KEY") != ""
+	llmService := llmServiceForRequest(c)
+	hasAPIKey := llmService.Configured()
 
 	results := make([]SummarizeResponse, 0, len(req.Notes))
-	llmService := services.NewLLMService()
+	quotaExceeded := false
+	cacheHits := 0
 
 	for i, note := range req.Notes {
 		if i >= req.Limit {
@@ -238,13 +559,29 @@ func BatchSummarize(c *gin.Context) {
 		}
 
 		var summary SummarizeResponse
-		if hasAPIKey {
+		if hasAPIKey && !quotaExceeded {
 			s, err := llmService.GenerateSummary(services.SummarizeRequest{Content: note})
+			var qe *services.QuotaExceededError
+			if errors.As(err, &qe) {
+				// 配额用完：一条都没完成时直接 429，否则返回已完成部分
+				if len(results) == 0 {
+					abortIfQuotaExceeded(c, err)
+					return
+				}
+				quotaExceeded = true
+				break
+			}
 			if err == nil {
 				summary = SummarizeResponse{
 					Summary:     s.Summary,
 					Highlights:  s.Highlights,
 					ActionItems: s.ActionItems,
+					Provider:    s.Provider,
+					Fallback:    s.Fallback,
+					Cached:      s.Cached,
+				}
+				if s.Cached {
+					cacheHits++
 				}
 			} else {
 				summary = SummarizeResponse{Summary: truncate(note, 100)}
@@ -256,14 +593,44 @@ func BatchSummarize(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"total":   len(req.Notes),
-		"limited": len(results),
-		"results": results,
+		"total":          len(req.Notes),
+		"limited":        len(results),
+		"results":        results,
+		"quota_exceeded": quotaExceeded,
+		"cache_hits":     cacheHits,
 	})
 }
 
 // ========== 辅助函数 ==========
 
+// basicInsightProvider 未调用大模型、由本地规则生成洞察时的 provider 标识
+const basicInsightProvider = "basic"
+
+// llmServiceForRequest 按当前用户的模型配置创建 LLM 服务
+func llmServiceForRequest(c *gin.Context) *services.LLMService {
+	userID := 0
+	if uid := getOptionalUserID(c); uid != nil {
+		userID = *uid
+	}
+	svc := services.NewLLMServiceForUser(userID)
+	svc.Endpoint = routeKey(c)
+	// ?refresh=true 跳过缓存重新生成
+	svc.NoCache = c.Query("refresh") == "true" || c.Query("refresh") == "1"
+	return svc
+}
+
+// routeKey 去掉版本前缀的路由模板，如 "POST /summarize"
+func routeKey(c *gin.Context) string {
+	route := c.FullPath()
+	for _, prefix := range []string{"/api/v1", "/api"} {
+		if strings.HasPrefix(route, prefix+"/") {
+			route = strings.TrimPrefix(route, prefix)
+			break
+		}
+	}
+	return c.Request.Method + " " + route
+}
+
 func truncate(s string, maxLen int) string {
 	if len(s) <= maxLen {
 		return s
@@ -294,26 +661,63 @@ func convertToMultiPerspective(aiInsight *services.InsightResponse, req InsightR
 	}
 }
 
-func generateBasicInsight(notes []string, timeRange string) InsightResponse {
-	count := len(notes)
-	charCount := 0
+// insightKeywordCount 基础分析列出的关键词数
+const insightKeywordCount = 8
+
+// insightBasis 基础分析的用户上下文：词频基准（笔记库）与分段用的时区
+type insightBasis struct {
+	corpus *services.Corpus
+	loc    *time.Location
+}
+
+// loadInsightBasis 读取失败时以分析的笔记自身为词频基准、以服务器时区分段
+func loadInsightBasis(userID int) insightBasis {
+	corpus, err := services.LoadUserCorpus(userID)
+	if err != nil {
+		log.Printf("读取笔记词频失败: %v", err)
+	}
+	return insightBasis{corpus: corpus, loc: userLocation(userID)}
+}
+
+// insightNoteIDs 参与分析的笔记 ID；客户端文本没有 ID
+func insightNoteIDs(notes []services.AnalysisNote) []int {
+	var ids []int
 	for _, n := range notes {
-		charCount += len(n)
+		if n.ID > 0 {
+			ids = append(ids, n.ID)
+		}
+	}
+	return ids
+}
+
+func generateBasicInsight(notes []services.AnalysisNote, basis insightBasis, timeRange string) InsightResponse {
+	count := len(notes)
+	keywords := services.ExtractKeywords(notes, basis.corpus, insightKeywordCount)
+
+	highlights := []string{"继续保持记录习惯"}
+	if len(keywords) > 0 {
+		highlights = append([]string{"最常提到：" + joinKeywords(keywords, 3)}, highlights...)
+	}
+	actionItems := []string{}
+	if a := services.AnalyzeActions(notes); a.OpenTasks > 0 {
+		actionItems = append(actionItems, "还有 "+itoa(a.OpenTasks)+" 个未完成的任务")
 	}
 
 	return InsightResponse{
 		Summary: formatTimeRange(timeRange) + "共记录 " + itoa(count) + " 条笔记",
 		Perspectives: []PerspectiveInsight{
-			generatePerspective(InsightOverview, notes, timeRange),
-			generatePerspective(InsightTopic, notes, timeRange),
-			generatePerspective(InsightSentiment, notes, timeRange),
+			generatePerspective(InsightOverview, notes, basis, timeRange),
+			generatePerspective(InsightTopic, notes, basis, timeRange),
+			generatePerspective(InsightSentiment, notes, basis, timeRange),
 		},
-		Highlights:  []string{"继续保持记录习惯"},
-		ActionItems: []string{},
+		Highlights:  highlights,
+		ActionItems: actionItems,
+		Keywords:    keywords,
+		MoodTrend:   services.MoodTrend(notes, "", basis.loc),
 	}
 }
 
-func generatePerspective(pType InsightType, notes []string, timeRange string) PerspectiveInsight {
+func generatePerspective(pType InsightType, notes []services.AnalysisNote, basis insightBasis, timeRange string) PerspectiveInsight {
 	perspective := PerspectiveInsight{
 		Type:      pType,
 		Highlights: []string{},
@@ -322,25 +726,40 @@ func generatePerspective(pType InsightType, notes []string, timeRange string) Pe
 
 	switch pType {
 	case InsightOverview:
+		words := 0
+		for _, n := range notes {
+			words += utils.CountWords(n.Text)
+		}
 		perspective.Name = "📊 概览"
 		perspective.Summary = "共 " + itoa(len(notes)) + " 条笔记"
 		perspective.Details = []DetailItem{
-			{Title: "笔记数", Content: itoa(len(notes)), Icon: "📝"},
-			{Title: "总字数", Content: itoa(len(notes)) + " 字", Icon: "📏"},
+			{Title: "笔记数", Content: itoa(len(notes)), Icon: "📝", Count: len(notes)},
+			{Title: "总字数", Content: itoa(words) + " 字", Icon: "📏", Count: words},
 		}
 		perspective.Score = 70
+		perspective.NoteIDs = insightNoteIDs(notes)
+
+	case InsightTime:
+		perspective.Name = "⏰ 时间视角"
+		timeStats := analyzeTime(notes, basis.loc)
+		perspective.Summary = timeStats.Summary
+		perspective.Details = timeStats.Details
+		perspective.Highlights = timeStats.Highlights
+		perspective.Score = timeStats.Score
 
 	case InsightTopic:
 		perspective.Name = "🏷️ 主题视角"
-		topicStats := analyzeTopics(notes)
+		topicStats := analyzeTopics(notes, basis.corpus)
 		perspective.Summary = topicStats.Summary
 		perspective.Details = topicStats.Details
+		perspective.Highlights = topicStats.Highlights
 		perspective.Score = topicStats.Score
 
 	case InsightSentiment:
 		perspective.Name = "💭 情感视角"
 		sentimentStats := analyzeSentiment(notes)
 		perspective.Summary = sentimentStats.Summary
+		perspective.Details = sentimentStats.Details
 		perspective.Highlights = sentimentStats.Highlights
 		perspective.Score = sentimentStats.Score
 
@@ -356,6 +775,19 @@ func generatePerspective(pType InsightType, notes []string, timeRange string) Pe
 		perspective.Summary = "记录良好"
 	}
 
+	// 视角的依据笔记：各分析项依据笔记的并集
+	if perspective.NoteIDs == nil {
+		seen := map[int]bool{}
+		for _, d := range perspective.Details {
+			for _, id := range d.NoteIDs {
+				if !seen[id] {
+					seen[id] = true
+					perspective.NoteIDs = append(perspective.NoteIDs, id)
+				}
+			}
+		}
+	}
+
 	return perspective
 }
 
@@ -373,7 +805,16 @@ func formatTimeRange(tr string) string {
 }
 
 func itoa(n int) string {
-	return string(rune('0'+n/1000%10)) + string(rune('0'+n/100%10)) + string(rune('0'+n/10%10)) + string(rune('0'+n%10))
+	return strconv.Itoa(n)
+}
+
+// joinKeywords 前 n 个关键词，以顿号连接
+func joinKeywords(keywords []services.Keyword, n int) string {
+	terms := make([]string, 0, n)
+	for i := 0; i < len(keywords) && i < n; i++ {
+		terms = append(terms, keywords[i].Term)
+	}
+	return strings.Join(terms, "、")
 }
 
 type statsResult struct {
@@ -383,124 +824,166 @@ type statsResult struct {
 	Highlights []string
 }
 
-func analyzeTopics(notes []string) statsResult {
-	topics := map[string][]string{
-		"💻 工作": {"工作", "项目", "任务", "会议"},
-		"📚 学习": {"学习", "读书", "课程", "知识"},
-		"🏃 健康": {"健康", "运动", "锻炼"},
-		"💰 财务": {"钱", "消费", "收入", "理财"},
-	}
-
-	countMap := make(map[string]int)
-	for _, note := range notes {
-		for topic, keywords := range topics {
+// analyzeTopics 主题分类命中情况与 TF-IDF 关键词
+func analyzeTopics(notes []services.AnalysisNote, corpus *services.Corpus) statsResult {
+	var details []DetailItem
+	var maxCount int
+	var topTopic string
+	for topic, keywords := range services.TopicKeywords {
+		var ids []int
+		count := 0
+		for _, note := range notes {
+			hit := false
 			for _, kw := range keywords {
-				if contains(note, kw) {
-					countMap[topic]++
+				if strings.Contains(note.Text, kw) {
+					count++
+					hit = true
 				}
 			}
+			if hit && note.ID > 0 {
+				ids = append(ids, note.ID)
+			}
+		}
+		if count == 0 {
+			continue
 		}
-	}
-
-	var details []DetailItem
-	var maxCount int
-	var topTopic string
-	for topic, count := range countMap {
 		details = append(details, DetailItem{
 			Title:  topic,
 			Content: itoa(count) + " 条",
-			Icon:   string([]byte(topic)[0]),
+			Icon:   strings.Fields(topic)[0],
+			Count:  count,
+			NoteIDs: ids,
 		})
-		if count > maxCount {
+		if count > maxCount || count == maxCount && topic < topTopic {
 			maxCount = count
 			topTopic = topic
 		}
 	}
+	sort.Slice(details, func(i, j int) bool {
+		if details[i].Count != details[j].Count {
+			return details[i].Count > details[j].Count
+		}
+		return details[i].Title < details[j].Title
+	})
+
+	keywords := services.ExtractKeywords(notes, corpus, insightKeywordCount)
+	highlights := []string{}
+	for _, k := range keywords {
+		highlights = append(highlights, k.Term)
+		details = append(details, DetailItem{
+			Title:   k.Term,
+			Content: "出现 " + itoa(k.Count) + " 次",
+			Icon:    "🔑",
+			Count:   k.Count,
+			NoteIDs: k.NoteIDs,
+		})
+	}
 
 	summary := "关注领域较广"
 	score := 50
 	if topTopic != "" {
-		summary = "最关注 " + topTopic[2:] + " 方面"
+		summary = "最关注 " + services.TopicName(topTopic) + " 方面"
 		score = 70
+	} else if len(keywords) > 0 {
+		summary = "最常提到 " + joinKeywords(keywords, 3)
+		score = 60
 	}
 
-	return statsResult{Summary: summary, Details: details, Score: score}
+	return statsResult{Summary: summary, Details: details, Score: score, Highlights: highlights}
 }
 
-func contains(s, substr string) bool {
-	return len(s) >= len(substr) && (s == substr || len(s) > 0 && containsHelper(s, substr))
+// analyzeSentiment 词典情感评分（中英文，考虑否定词与程度副词）
+func analyzeSentiment(notes []services.AnalysisNote) statsResult {
+	s := services.AnalyzeSentiment(notes)
+
+	highlights := []string{}
+	if len(s.PositiveWords) > 0 {
+		highlights = append(highlights, "积极词："+joinTermCounts(s.PositiveWords))
+	}
+	if len(s.NegativeWords) > 0 {
+		highlights = append(highlights, "消极词："+joinTermCounts(s.NegativeWords))
+	}
+	if s.Negative > s.Positive {
+		highlights = append(highlights, "建议适当放松")
+	}
+
+	details := []DetailItem{
+		{Title: "积极", Content: itoa(s.Positive), Icon: "😊", Count: s.Positive, NoteIDs: s.PositiveNoteIDs},
+		{Title: "消极", Content: itoa(s.Negative), Icon: "😔", Count: s.Negative, NoteIDs: s.NegativeNoteIDs},
+		{Title: "中性", Content: itoa(s.Neutral), Icon: "😐", Count: s.Neutral},
+		{Title: "平均得分", Content: strconv.FormatFloat(s.Average, 'f', 2, 64), Icon: "📈"},
+	}
+
+	return statsResult{Summary: s.Label(), Details: details, Score: 50 + int(s.Average*50), Highlights: highlights}
 }
 
-func containsHelper(s, substr string) bool {
-	for i := 0; i <= len(s)-len(substr); i++ {
-		if s[i:i+len(substr)] == substr {
-			return true
+func joinTermCounts(terms []services.TermCount) string {
+	parts := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if t.Count > 1 {
+			parts = append(parts, t.Term+"×"+itoa(t.Count))
+		} else {
+			parts = append(parts, t.Term)
 		}
 	}
-	return false
+	return strings.Join(parts, "、")
 }
 
-func analyzeSentiment(notes []string) statsResult {
-	positive := []string{"开心", "高兴", "成功", "收获", "进步"}
-	negative := []string{"难过", "焦虑", "失败", "困难"}
+// analyzeTime 情绪与记录量随时间的变化
+func analyzeTime(notes []services.AnalysisNote, loc *time.Location) statsResult {
+	trend := services.MoodTrend(notes, "", loc)
+	if len(trend) == 0 {
+		return statsResult{Summary: "缺少笔记时间信息", Score: 50, Highlights: []string{}}
+	}
 
-	posCount, negCount := 0, 0
-	for _, note := range notes {
-		for _, w := range positive {
-			if contains(note, w) {
-				posCount++
-				break
-			}
+	var details []DetailItem
+	busiest := trend[0]
+	for _, p := range trend {
+		if p.Notes > busiest.Notes {
+			busiest = p
 		}
-		for _, w := range negative {
-			if contains(note, w) {
-				negCount++
-				break
-			}
+		if p.Notes == 0 {
+			continue
 		}
+		icon := "😐"
+		if p.Score >= 0.25 {
+			icon = "😊"
+		} else if p.Score <= -0.25 {
+			icon = "😔"
+		}
+		details = append(details, DetailItem{
+			Title:   p.Bucket,
+			Content: itoa(p.Notes) + " 条 · 情绪 " + strconv.FormatFloat(p.Score, 'f', 2, 64),
+			Icon:    icon,
+			Count:   p.Notes,
+		})
 	}
 
-	summary := "情绪平稳"
-	score := 50
 	highlights := []string{}
-
-	if posCount > negCount {
-		summary = "😊 整体积极"
-		score = 75
-		highlights = append(highlights, "正面情绪占主导")
-	} else if negCount > posCount {
-		summary = "😔 有些负面情绪"
-		score = 40
-		highlights = append(highlights, "建议适当放松")
+	if first, last := trend[0], trend[len(trend)-1]; len(trend) > 1 && first.Notes > 0 && last.Notes > 0 {
+		switch diff := last.Score - first.Score; {
+		case diff >= 0.2:
+			highlights = append(highlights, "情绪在好转")
+		case diff <= -0.2:
+			highlights = append(highlights, "情绪有所下滑")
+		}
 	}
 
-	return statsResult{Summary: summary, Score: score, Highlights: highlights}
+	return statsResult{
+		Summary:    "记录最多的时段：" + busiest.Bucket + "（" + itoa(busiest.Notes) + " 条）",
+		Details:    details,
+		Score:      60,
+		Highlights: highlights,
+	}
 }
 
-func analyzeActions(notes []string) statsResult {
-	todoWords := []string{"待办", "计划", "要", "应该"}
-	doneWords := []string{"完成", "解决", "搞定"}
-
-	todoCount, doneCount := 0, 0
-	for _, note := range notes {
-		for _, w := range todoWords {
-			if contains(note, w) {
-				todoCount++
-				break
-			}
-		}
-		for _, w := range doneWords {
-			if contains(note, w) {
-				doneCount++
-				break
-			}
-		}
-	}
+// analyzeActions Markdown 任务完成情况与提到计划/完成的笔记
+func analyzeActions(notes []services.AnalysisNote) statsResult {
+	a := services.AnalyzeActions(notes)
 
 	summary := "有一定行动记录"
 	score := 50
-	if todoCount > 0 {
-		rate := doneCount * 100 / todoCount
+	if rate, ok := a.CompletionRate(); ok {
 		summary = "完成率 " + itoa(rate) + "%"
 		if rate > 70 {
 			score = 85
@@ -509,18 +992,46 @@ func analyzeActions(notes []string) statsResult {
 		}
 	}
 
-	return statsResult{
-		Summary: summary,
-		Details: []DetailItem{
-			{Title: "待办", Content: itoa(todoCount), Icon: "📋"},
-			{Title: "完成", Content: itoa(doneCount), Icon: "✅"},
-		},
-		Score: score,
+	details := []DetailItem{
+		{Title: "待办", Content: itoa(a.TodoNotes), Icon: "📋", Count: a.TodoNotes, NoteIDs: a.TodoNoteIDs},
+		{Title: "完成", Content: itoa(a.DoneNotes), Icon: "✅", Count: a.DoneNotes, NoteIDs: a.DoneNoteIDs},
+	}
+	if a.OpenTasks+a.DoneTasks > 0 {
+		details = append(details,
+			DetailItem{Title: "未完成任务", Content: itoa(a.OpenTasks), Icon: "⬜", Count: a.OpenTasks},
+			DetailItem{Title: "已完成任务", Content: itoa(a.DoneTasks), Icon: "☑️", Count: a.DoneTasks},
+		)
 	}
+
+	return statsResult{Summary: summary, Details: details, Score: score}
 }
 
-func generateChanges(insight1, insight2 InsightResponse) []map[string]string {
-	return []map[string]string{
-		{"category": "记录数量", "before": insight1.Summary, "after": insight2.Summary},
+// generateChanges 对比结果的文字概括
+func generateChanges(diff services.InsightDiff) []map[string]string {
+	changes := []map[string]string{
+		{"category": "记录数量", "before": itoa(diff.Notes.Before) + " 条", "after": itoa(diff.Notes.After) + " 条"},
+		{"category": "字数", "before": itoa(diff.Words.Before) + " 字", "after": itoa(diff.Words.After) + " 字"},
+		{
+			"category": "情绪",
+			"before":   diff.Sentiment.BeforeLabel + "（" + strconv.FormatFloat(diff.Sentiment.Before, 'f', 2, 64) + "）",
+			"after":    diff.Sentiment.AfterLabel + "（" + strconv.FormatFloat(diff.Sentiment.After, 'f', 2, 64) + "）",
+		},
+	}
+	var fading, rising []string
+	for _, k := range diff.Keywords {
+		switch k.Trend {
+		case services.KeywordGone, services.KeywordDown:
+			fading = append(fading, k.Term)
+		case services.KeywordNew, services.KeywordUp:
+			rising = append(rising, k.Term)
+		}
+	}
+	if len(fading) > 0 || len(rising) > 0 {
+		changes = append(changes, map[string]string{
+			"category": "关键词",
+			"before":   strings.Join(fading, "、"),
+			"after":    strings.Join(rising, "、"),
+		})
 	}
+	return changes
 }
@@ -0,0 +1,229 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"testing"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/models"
+)
+
+type insightResponse struct {
+	Provider     string `json:"provider"`
+	Cached       bool   `json:"cached"`
+	NoteIDs      []int  `json:"note_ids"`
+	Chunks       int    `json:"chunks"`
+	Perspectives []struct {
+		Type    string `json:"type"`
+		NoteIDs []int  `json:"note_ids"`
+	} `json:"perspectives"`
+	Evidence []struct {
+		Text    string `json:"text"`
+		NoteIDs []int  `json:"note_ids"`
+	} `json:"evidence"`
+}
+
+func createNoteAt(t *testing.T, r http.Handler, auth, content string, tags []string, daysAgo int) int {
+	t.Helper()
+	rr := doJSON(t, r, "POST", "/api/memos", auth, map[string]any{"content": content, "tags": tags})
+	if rr.Code != http.StatusCreated && rr.Code != http.StatusOK {
+		t.Fatalf("create memo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+	if daysAgo > 0 {
+		if _, err := database.DB.Exec("UPDATE notes SET created_at = datetime('now', ?) WHERE id = ?", fmt.Sprintf("-%d days", daysAgo), note.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return note.ID
+}
+
+func sortedIDs(ids []int) []int {
+	out := append([]int{}, ids...)
+	sort.Ints(out)
+	return out
+}
+
+func TestInsightsSelectNotesServerSide(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	work := createNoteAt(t, r, admin, "项目会议很成功", []string{"工作"}, 0)
+	oldWork := createNoteAt(t, r, admin, "旧的项目会议", []string{"工作"}, 45)
+	createNoteAt(t, r, admin, "周末去爬山，很开心", nil, 0)
+
+	// 默认 30 天 + 标签
+	rr := doJSON(t, r, "POST", "/api/insights", admin, map[string]any{"tag": "工作"})
+	var resp insightResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.Provider != "basic" || fmt.Sprint(resp.NoteIDs) != fmt.Sprint([]int{work}) {
+		t.Fatalf("insight status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	for _, p := range resp.Perspectives {
+		if p.Type == "sentiment" && fmt.Sprint(p.NoteIDs) != fmt.Sprint([]int{work}) {
+			t.Fatalf("sentiment evidence=%v", p.NoteIDs)
+		}
+	}
+
+	rr = doJSON(t, r, "POST", "/api/insights", admin, map[string]any{"tag": "工作", "time_range": "all"})
+	resp = insightResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if fmt.Sprint(sortedIDs(resp.NoteIDs)) != fmt.Sprint(sortedIDs([]int{work, oldWork})) {
+		t.Fatalf("all-time note_ids=%v", resp.NoteIDs)
+	}
+
+	if rr := doJSON(t, r, "POST", "/api/insights", admin, map[string]any{"from": "2024/01/01"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("bad from status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 单视角：主题命中的笔记
+	rr = doJSON(t, r, "POST", "/api/insights/topic", admin, map[string]any{"time_range": "all"})
+	var topic struct {
+		Details []struct {
+			Title   string `json:"title"`
+			NoteIDs []int  `json:"note_ids"`
+		} `json:"details"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &topic)
+	found := false
+	for _, d := range topic.Details {
+		if strings.Contains(d.Title, "工作") {
+			found = fmt.Sprint(sortedIDs(d.NoteIDs)) == fmt.Sprint(sortedIDs([]int{work, oldWork}))
+		}
+	}
+	if rr.Code != http.StatusOK || !found {
+		t.Fatalf("topic status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 对比：最近 30 天 vs 前 30 天
+	rr = doJSON(t, r, "POST", "/api/insights/compare", admin, map[string]any{"tag": "工作"})
+	var cmp struct {
+		Period1 insightResponse `json:"period1"`
+		Period2 insightResponse `json:"period2"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &cmp)
+	if rr.Code != http.StatusOK || fmt.Sprint(cmp.Period1.NoteIDs) != fmt.Sprint([]int{oldWork}) || fmt.Sprint(cmp.Period2.NoteIDs) != fmt.Sprint([]int{work}) {
+		t.Fatalf("compare status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 其他用户选不到我的笔记
+	rr = doJSON(t, r, "POST", "/api/users", admin, map[string]any{"username": "carol", "password": "carol12345", "email": "c@example.com"})
+	var carol models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &carol)
+	rr = doJSON(t, r, "POST", "/api/insights", authHeader(t, carol.ID, "carol", false), map[string]any{"note_ids": []int{work}, "time_range": "all"})
+	resp = insightResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || len(resp.NoteIDs) != 0 {
+		t.Fatalf("foreign insight status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestInsightsMapReduceOverContext(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	// 本地模型上下文 4096：每条约 1500 字的笔记各占一段
+	var ids []int
+	for i := 0; i < 3; i++ {
+		ids = append(ids, createNoteAt(t, r, admin, fmt.Sprintf("第%d篇", i)+strings.Repeat("读书", 750), []string{"长文"}, 0))
+	}
+	reply := fmt.Sprintf(`{"summary":"持续阅读","keywords":["读书"],"evidence":[{"text":"读书","note_ids":[%d,%d,999999]},{"text":"虚构","note_ids":[999999]}]}`, ids[0], ids[2])
+	srv, requests := scriptedLLM(t, reply)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	rr := doJSON(t, r, "POST", "/api/insights", admin, map[string]any{"tag": "长文"})
+	var resp insightResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.Provider != "lmstudio" || resp.Chunks != 3 {
+		t.Fatalf("insight status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 3 次分段 + 1 次合并
+	if len(*requests) != 4 {
+		t.Fatalf("llm calls=%d", len(*requests))
+	}
+	last := (*requests)[3]
+	if !strings.Contains(last[len(last)-1]["content"], "分段洞察") {
+		t.Fatalf("reduce prompt=%v", last)
+	}
+	if first := (*requests)[0]; !strings.Contains(first[len(first)-1]["content"], fmt.Sprintf("[#%d]", ids[2])) {
+		t.Fatalf("map prompt missing note id: %v", first)
+	}
+	// 依据中不存在的笔记 ID 被过滤
+	if len(resp.Evidence) != 1 || fmt.Sprint(resp.Evidence[0].NoteIDs) != fmt.Sprint([]int{ids[0], ids[2]}) {
+		t.Fatalf("evidence=%+v", resp.Evidence)
+	}
+
+	// 再次请求全部命中缓存
+	rr = doJSON(t, r, "POST", "/api/insights", admin, map[string]any{"tag": "长文"})
+	resp = insightResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if !resp.Cached || len(*requests) != 4 {
+		t.Fatalf("cached=%v calls=%d", resp.Cached, len(*requests))
+	}
+}
+
+func TestInsightsOfflineAnalysis(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	happy := createNoteAt(t, r, admin, "排期评审顺利通过，非常开心", []string{"日记"}, 2)
+	sad := createNoteAt(t, r, admin, "排期评审又被推迟，有点焦虑", []string{"日记"}, 1)
+	createNoteAt(t, r, admin, "- [ ] 整理排期评审纪要\n- [x] 发邮件", []string{"日记"}, 0)
+
+	rr := doJSON(t, r, "POST", "/api/insights", admin, map[string]any{"tag": "日记"})
+	var resp struct {
+		Keywords []struct {
+			Term    string `json:"term"`
+			Count   int    `json:"count"`
+			NoteIDs []int  `json:"note_ids"`
+		} `json:"keywords"`
+		MoodTrend []struct {
+			Bucket string  `json:"bucket"`
+			Notes  int     `json:"notes"`
+			Score  float64 `json:"score"`
+		} `json:"mood_trend"`
+		ActionItems  []string `json:"action_items"`
+		Perspectives []struct {
+			Type    string `json:"type"`
+			Details []struct {
+				Title   string `json:"title"`
+				NoteIDs []int  `json:"note_ids"`
+			} `json:"details"`
+		} `json:"perspectives"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("insight status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if len(resp.Keywords) == 0 || resp.Keywords[0].Term != "排期评审" || resp.Keywords[0].Count != 3 {
+		t.Fatalf("keywords=%+v", resp.Keywords)
+	}
+	if len(resp.MoodTrend) != 3 || resp.MoodTrend[0].Score <= 0 || resp.MoodTrend[1].Score >= 0 {
+		t.Fatalf("mood_trend=%+v", resp.MoodTrend)
+	}
+	if len(resp.ActionItems) != 1 {
+		t.Fatalf("action_items=%v", resp.ActionItems)
+	}
+	for _, p := range resp.Perspectives {
+		if p.Type != "sentiment" {
+			continue
+		}
+		if fmt.Sprint(p.Details[0].NoteIDs) != fmt.Sprint([]int{happy}) || fmt.Sprint(p.Details[1].NoteIDs) != fmt.Sprint([]int{sad}) {
+			t.Fatalf("sentiment details=%+v", p.Details)
+		}
+	}
+
+	// 单视角：行动按复选框统计完成率
+	rr = doJSON(t, r, "POST", "/api/insights/action", admin, map[string]any{"tag": "日记"})
+	var action struct {
+		Summary string `json:"summary"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &action)
+	if rr.Code != http.StatusOK || action.Summary != "完成率 50%" {
+		t.Fatalf("action status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateRegistrationRequest struct {
+	Mode           string   `json:"mode" binding:"required"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+type CreateInviteRequest struct {
+	Code           string     `json:"code" binding:"omitempty,min=6,max=64"` // 为空时自动生成
+	Role           string     `json:"role"`
+	MaxUses        *int       `json:"max_uses"`         // 默认 1；0 表示不限次数
+	ExpiresInHours int        `json:"expires_in_hours"` // 与 expires_at 二选一
+	ExpiresAt      *time.Time `json:"expires_at"`
+	Note           string     `json:"note" binding:"max=200"`
+}
+
+func instanceName() string {
+	if v := strings.TrimSpace(os.Getenv("MEMO_INSTANCE_NAME")); v != "" {
+		return v
+	}
+	return "Memo Studio"
+}
+
+func registrationView(p models.RegistrationPolicy) gin.H {
+	domains := p.AllowedDomains
+	if p.Mode != models.RegistrationDomain || domains == nil {
+		domains = []string{}
+	}
+	return gin.H{
+		"mode":            p.Mode,
+		"enabled":         p.Mode != models.RegistrationClosed,
+		"invite_required": p.InviteRequired(),
+		"allowed_domains": domains,
+	}
+}
+
+// GetInstance 实例公开信息（无需认证），客户端据此决定是否显示注册入口
+// GET /api/v1/instance
+func GetInstance(c *gin.Context) {
+	policy, err := models.GetRegistrationPolicy()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取实例设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"name":         instanceName(),
+		"version":      "v1",
+		"registration": registrationView(policy),
+	})
+}
+
+// AdminUpdateRegistration 修改注册策略
+// PUT /api/v1/admin/instance/registration
+func AdminUpdateRegistration(c *gin.Context) {
+	var req UpdateRegistrationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	policy, err := models.SetRegistrationPolicy(models.RegistrationPolicy{
+		Mode:           req.Mode,
+		AllowedDomains: req.AllowedDomains,
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, registrationView(policy))
+}
+
+// AdminListInvites 邀请码列表
+// GET /api/v1/admin/invites
+func AdminListInvites(c *gin.Context) {
+	list, err := models.ListInviteCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取邀请码失败: " + err.Error()})
+		return
+	}
+	if list == nil {
+		list = []models.InviteCode{}
+	}
+	c.JSON(http.StatusOK, list)
+}
+
+// AdminCreateInvite 生成邀请码
+// POST /api/v1/admin/invites
+func AdminCreateInvite(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	role := strings.TrimSpace(req.Role)
+	if role == "" {
+		role = models.RoleEditor
+	}
+	if !models.IsValidRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色: " + role})
+		return
+	}
+	maxUses := 1
+	if req.MaxUses != nil {
+		maxUses = *req.MaxUses
+	}
+	if maxUses < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_uses 不能为负数"})
+		return
+	}
+	expiresAt := req.ExpiresAt
+	if expiresAt == nil && req.ExpiresInHours > 0 {
+		t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+		expiresAt = &t
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "过期时间必须晚于当前时间"})
+		return
+	}
+
+	code := strings.TrimSpace(req.Code)
+	if code == "" {
+		token, err := utils.GenerateSecureToken(6)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成邀请码失败"})
+			return
+		}
+		code = strings.ToUpper(token)
+	}
+
+	inv, err := models.CreateInviteCode(models.CreateInviteInput{
+		Code:      code,
+		CreatedBy: userID,
+		Role:      role,
+		MaxUses:   maxUses,
+		ExpiresAt: expiresAt,
+		Note:      req.Note,
+	})
+	if err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			c.JSON(http.StatusConflict, gin.H{"error": "邀请码已存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建邀请码失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, inv)
+}
+
+// AdminRevokeInvite 撤销邀请码
+// DELETE /api/v1/admin/invites/:id
+func AdminRevokeInvite(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的邀请码ID"})
+		return
+	}
+	if err := models.RevokeInviteCode(id); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "邀请码不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "撤销失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
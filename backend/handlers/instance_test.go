@@ -0,0 +1,95 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"memo-studio/backend/models"
+)
+
+func TestRegistrationPolicyAndInvites(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	instance := func() map[string]any {
+		rr := doJSON(t, r, "GET", "/api/instance", "", nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("instance status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var out struct {
+			Registration map[string]any `json:"registration"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &out)
+		return out.Registration
+	}
+	register := func(username, email, code string) int {
+		rr := doJSON(t, r, "POST", "/api/auth/register", "", map[string]any{
+			"username": username, "password": "secret123", "email": email, "invite_code": code,
+		})
+		return rr.Code
+	}
+
+	// 默认开放注册
+	if reg := instance(); reg["mode"] != "open" || reg["enabled"] != true {
+		t.Fatalf("default registration: %+v", reg)
+	}
+	if code := register("alice", "", ""); code != http.StatusCreated {
+		t.Fatalf("open register status=%d", code)
+	}
+
+	// 关闭注册
+	if rr := doJSON(t, r, "PUT", "/api/admin/instance/registration", auth, map[string]any{"mode": "closed"}); rr.Code != http.StatusOK {
+		t.Fatalf("set closed status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if reg := instance(); reg["enabled"] != false {
+		t.Fatalf("closed registration: %+v", reg)
+	}
+	if code := register("bob", "", ""); code != http.StatusForbidden {
+		t.Fatalf("closed register status=%d", code)
+	}
+
+	// 邀请制：单次邀请码
+	doJSON(t, r, "PUT", "/api/admin/instance/registration", auth, map[string]any{"mode": "invite"})
+	if code := register("bob", "", ""); code != http.StatusForbidden {
+		t.Fatalf("invite register without code status=%d", code)
+	}
+	rr := doJSON(t, r, "POST", "/api/admin/invites", auth, map[string]any{"expires_in_hours": 24})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create invite status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var inv models.InviteCode
+	_ = json.Unmarshal(rr.Body.Bytes(), &inv)
+	if inv.Code == "" || inv.MaxUses != 1 || inv.ExpiresAt == nil {
+		t.Fatalf("bad invite: %+v", inv)
+	}
+	if code := register("bob", "", inv.Code); code != http.StatusCreated {
+		t.Fatalf("invite register status=%d", code)
+	}
+	if code := register("carol", "", inv.Code); code != http.StatusForbidden {
+		t.Fatalf("reused single-use invite status=%d", code)
+	}
+
+	// 撤销后的多次邀请码不可用
+	rr = doJSON(t, r, "POST", "/api/admin/invites", auth, map[string]any{"max_uses": 0, "code": "TEAM-2024"})
+	_ = json.Unmarshal(rr.Body.Bytes(), &inv)
+	if code := register("carol", "", "TEAM-2024"); code != http.StatusCreated {
+		t.Fatalf("multi-use invite status=%d", code)
+	}
+	doJSON(t, r, "DELETE", "/api/admin/invites/"+itoa(inv.ID), auth, nil)
+	if code := register("dave", "", "TEAM-2024"); code != http.StatusForbidden {
+		t.Fatalf("revoked invite status=%d", code)
+	}
+
+	// 域名白名单
+	if rr := doJSON(t, r, "PUT", "/api/admin/instance/registration", auth, map[string]any{"mode": "domain"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("domain mode without domains status=%d", rr.Code)
+	}
+	doJSON(t, r, "PUT", "/api/admin/instance/registration", auth, map[string]any{"mode": "domain", "allowed_domains": []string{"@Example.com"}})
+	if code := register("erin", "erin@gmail.com", ""); code != http.StatusForbidden {
+		t.Fatalf("disallowed domain status=%d", code)
+	}
+	if code := register("erin", "erin@example.com", ""); code != http.StatusCreated {
+		t.Fatalf("allowed domain status=%d", code)
+	}
+}
@@ -0,0 +1,76 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"memo-studio/backend/models"
+)
+
+func TestLLMCacheHitInvalidationAndPurge(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	srv, calls := fakeLLM(t, `{"summary":"ok","highlights":[],"action_items":[]}`, 20)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"title": "t", "content": "cache me"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create memo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+
+	summarize := func(path string) bool {
+		t.Helper()
+		rr := doJSON(t, r, "POST", path, admin, map[string]any{"content": "cache me"})
+		if rr.Code != http.StatusOK {
+			t.Fatalf("summarize status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Cached bool `json:"cached"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		return resp.Cached
+	}
+
+	if summarize("/api/summarize") || !summarize("/api/summarize") || *calls != 1 {
+		t.Fatalf("expected miss then hit, calls=%d", *calls)
+	}
+	// 强制刷新跳过缓存
+	if summarize("/api/summarize?refresh=true") || *calls != 2 {
+		t.Fatalf("refresh should bypass cache, calls=%d", *calls)
+	}
+
+	// 修改笔记内容后缓存失效
+	if rr := doJSON(t, r, "PUT", "/api/memos/"+itoa(note.ID), admin, map[string]any{"content": "changed"}); rr.Code != http.StatusOK {
+		t.Fatalf("update memo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if summarize("/api/summarize") || *calls != 3 {
+		t.Fatalf("edit should invalidate cache, calls=%d", *calls)
+	}
+
+	rr = doJSON(t, r, "GET", "/api/admin/llm/cache", admin, nil)
+	var stats struct {
+		Stats struct {
+			Entries int `json:"entries"`
+		} `json:"stats"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &stats)
+	if rr.Code != http.StatusOK || stats.Stats.Entries != 1 {
+		t.Fatalf("cache stats status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "DELETE", "/api/admin/llm/cache", admin, nil)
+	var purged struct {
+		Purged int `json:"purged"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &purged)
+	if rr.Code != http.StatusOK || purged.Purged != 1 {
+		t.Fatalf("purge status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if summarize("/api/summarize") || *calls != 4 {
+		t.Fatalf("purge should drop entries, calls=%d", *calls)
+	}
+}
@@ -0,0 +1,334 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"memo-studio/backend/middleware"
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type LLMProfileRequest struct {
+	Name      string  `json:"name" binding:"max=100"`
+	Provider  string  `json:"provider" binding:"required"`
+	BaseURL   string  `json:"base_url"`
+	Model     string  `json:"model"`
+	APIKey    *string `json:"api_key"` // 修改时省略表示保留原值，空字符串表示清除
+	MaxTokens int     `json:"max_tokens"`
+	Active    bool    `json:"active"`
+	// FallbackPriority >0 时加入备用模型链，数值越小越先尝试
+	FallbackPriority int `json:"fallback_priority"`
+}
+
+// llmProfileView 对外展示的配置，不返回 API Key
+func llmProfileView(p models.LLMProfile) gin.H {
+	return gin.H{
+		"id":                p.ID,
+		"scope":             llmProfileScope(p.UserID),
+		"name":              p.Name,
+		"provider":          p.Provider,
+		"base_url":          p.BaseURL,
+		"model":             p.Model,
+		"has_api_key":       p.HasAPIKey(),
+		"max_tokens":        p.MaxTokens,
+		"active":            p.Active,
+		"fallback_priority": p.FallbackPriority,
+		"created_at":        p.CreatedAt,
+		"updated_at":        p.UpdatedAt,
+	}
+}
+
+func llmProfileScope(owner *int) string {
+	if owner == nil {
+		return services.ModelSourceInstance
+	}
+	return services.ModelSourceUser
+}
+
+// activeModelView 实际生效的模型（同样不返回 API Key）
+func activeModelView(cfg services.ModelConfig) gin.H {
+	return gin.H{
+		"type":       string(cfg.Type),
+		"name":       cfg.Name,
+		"category":   string(cfg.Category),
+		"model":      cfg.Model,
+		"base_url":   cfg.BaseURL,
+		"max_tokens": cfg.MaxTokens,
+		"context":    cfg.Context,
+		"source":     cfg.Source,
+		"profile_id": cfg.ProfileID,
+		"configured": cfg.APIKey != "" || cfg.Category == services.CategoryLocal,
+	}
+}
+
+// modelHealthView 带熔断/健康状态的模型信息
+func modelHealthView(cfg services.ModelConfig) gin.H {
+	view := activeModelView(cfg)
+	view["health"] = services.DefaultBreakers.Health(services.ProviderKey(cfg))
+	return view
+}
+
+// checkLLMBaseURL 规范化并校验 base_url；非管理员不能指向本机或内网（MEMO_LLM_ALLOW_HOSTS 除外）
+func checkLLMBaseURL(c *gin.Context, raw string) (string, bool) {
+	baseURL := strings.TrimRight(strings.TrimSpace(raw), "/")
+	if baseURL == "" {
+		return "", true
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "base_url 必须是 http(s) 地址"})
+		return "", false
+	}
+	if middleware.CurrentRole(c) != models.RoleAdmin {
+		if err := services.ValidateLLMBaseURL(baseURL); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "base_url 无效: " + err.Error()})
+			return "", false
+		}
+	}
+	return baseURL, true
+}
+
+// bindLLMProfileInput 校验请求并转换为模型层输入（API Key 在此加密）
+func bindLLMProfileInput(c *gin.Context) (*LLMProfileRequest, models.LLMProfileInput, bool) {
+	var req LLMProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return nil, models.LLMProfileInput{}, false
+	}
+	req.Provider = strings.TrimSpace(req.Provider)
+	if _, ok := services.FindModelPreset(req.Provider); !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模型类型: " + req.Provider})
+		return nil, models.LLMProfileInput{}, false
+	}
+	baseURL, ok := checkLLMBaseURL(c, req.BaseURL)
+	if !ok {
+		return nil, models.LLMProfileInput{}, false
+	}
+	req.BaseURL = baseURL
+	if req.MaxTokens < 0 || req.FallbackPriority < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "max_tokens 与 fallback_priority 不能为负数"})
+		return nil, models.LLMProfileInput{}, false
+	}
+	in := models.LLMProfileInput{
+		Name:      req.Name,
+		Provider:  req.Provider,
+		BaseURL:   req.BaseURL,
+		Model:     strings.TrimSpace(req.Model),
+		MaxTokens: req.MaxTokens,
+
+		FallbackPriority: req.FallbackPriority,
+	}
+	if req.APIKey != nil {
+		enc, err := services.EncryptAPIKey(*req.APIKey)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "加密 API Key 失败"})
+			return nil, models.LLMProfileInput{}, false
+		}
+		in.APIKeyEnc = &enc
+	}
+	return &req, in, true
+}
+
+func parseLLMProfileID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的配置ID"})
+		return 0, false
+	}
+	return id, true
+}
+
+func listLLMProfiles(c *gin.Context, owner *int) {
+	list, err := models.ListLLMProfiles(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取模型配置失败: " + err.Error()})
+		return
+	}
+	views := make([]gin.H, 0, len(list))
+	for _, p := range list {
+		views = append(views, llmProfileView(p))
+	}
+	resp := gin.H{"profiles": views}
+	if owner != nil {
+		cfg, err := services.ResolveModelConfig(*owner)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "解析模型配置失败: " + err.Error()})
+			return
+		}
+		resp["effective"] = activeModelView(cfg)
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+func createLLMProfile(c *gin.Context, owner *int) {
+	req, in, ok := bindLLMProfileInput(c)
+	if !ok {
+		return
+	}
+	p, err := models.CreateLLMProfile(owner, in, req.Active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模型配置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, llmProfileView(*p))
+}
+
+func updateLLMProfile(c *gin.Context, owner *int) {
+	id, ok := parseLLMProfileID(c)
+	if !ok {
+		return
+	}
+	req, in, ok := bindLLMProfileInput(c)
+	if !ok {
+		return
+	}
+	p, err := models.UpdateLLMProfile(id, owner, in)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模型配置失败: " + err.Error()})
+		return
+	}
+	if p == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模型配置不存在"})
+		return
+	}
+	if req.Active && !p.Active {
+		if err := models.ActivateLLMProfile(id, owner); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "启用模型配置失败: " + err.Error()})
+			return
+		}
+		p.Active = true
+	}
+	c.JSON(http.StatusOK, llmProfileView(*p))
+}
+
+func deleteLLMProfile(c *gin.Context, owner *int) {
+	id, ok := parseLLMProfileID(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteLLMProfile(id, owner); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "模型配置不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除模型配置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+func activateLLMProfile(c *gin.Context, owner *int) {
+	id, ok := parseLLMProfileID(c)
+	if !ok {
+		return
+	}
+	if err := models.ActivateLLMProfile(id, owner); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "模型配置不存在"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "启用模型配置失败: " + err.Error()})
+		return
+	}
+	p, err := models.GetLLMProfile(id, owner)
+	if err != nil || p == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取模型配置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, llmProfileView(*p))
+}
+
+// ListMyLLMProfiles 我的模型配置及当前生效的模型
+// GET /api/v1/llm/profiles
+func ListMyLLMProfiles(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	listLLMProfiles(c, &userID)
+}
+
+// CreateMyLLMProfile 新建个人模型配置
+// POST /api/v1/llm/profiles
+func CreateMyLLMProfile(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	createLLMProfile(c, &userID)
+}
+
+// UpdateMyLLMProfile 修改个人模型配置
+// PUT /api/v1/llm/profiles/:id
+func UpdateMyLLMProfile(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	updateLLMProfile(c, &userID)
+}
+
+// DeleteMyLLMProfile 删除个人模型配置
+// DELETE /api/v1/llm/profiles/:id
+func DeleteMyLLMProfile(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	deleteLLMProfile(c, &userID)
+}
+
+// ActivateMyLLMProfile 启用个人模型配置
+// POST /api/v1/llm/profiles/:id/activate
+func ActivateMyLLMProfile(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	activateLLMProfile(c, &userID)
+}
+
+// DeactivateMyLLMProfile 停用个人配置，回落到实例默认模型
+// DELETE /api/v1/llm/profiles/active
+func DeactivateMyLLMProfile(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	if err := models.DeactivateLLMProfiles(&userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "停用模型配置失败: " + err.Error()})
+		return
+	}
+	cfg, err := services.ResolveModelConfig(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析模型配置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true, "effective": activeModelView(cfg)})
+}
+
+// AdminListLLMProfiles 实例默认模型配置
+// GET /api/v1/admin/llm/profiles
+func AdminListLLMProfiles(c *gin.Context) { listLLMProfiles(c, nil) }
+
+// AdminCreateLLMProfile 新建实例模型配置
+// POST /api/v1/admin/llm/profiles
+func AdminCreateLLMProfile(c *gin.Context) { createLLMProfile(c, nil) }
+
+// AdminUpdateLLMProfile 修改实例模型配置
+// PUT /api/v1/admin/llm/profiles/:id
+func AdminUpdateLLMProfile(c *gin.Context) { updateLLMProfile(c, nil) }
+
+// AdminDeleteLLMProfile 删除实例模型配置
+// DELETE /api/v1/admin/llm/profiles/:id
+func AdminDeleteLLMProfile(c *gin.Context) { deleteLLMProfile(c, nil) }
+
+// AdminActivateLLMProfile 设为实例默认模型（未设置个人配置的用户使用）
+// POST /api/v1/admin/llm/profiles/:id/activate
+func AdminActivateLLMProfile(c *gin.Context) { activateLLMProfile(c, nil) }
@@ -0,0 +1,227 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+	"memo-studio/backend/utils"
+)
+
+func TestLLMProfilesPerUserWithInstanceDefault(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	rr := doJSON(t, r, "POST", "/api/users", admin, map[string]any{"username": "bob", "password": "secret123"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create user status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var bob models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &bob)
+	bobAuth := authHeader(t, bob.ID, "bob", false)
+
+	// 管理员设置实例默认模型
+	rr = doJSON(t, r, "POST", "/api/admin/llm/profiles", admin, map[string]any{
+		"provider": "deepseek", "api_key": "sk-instance", "active": true,
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create instance profile status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var inst struct {
+		ID        int    `json:"id"`
+		Scope     string `json:"scope"`
+		HasAPIKey bool   `json:"has_api_key"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &inst)
+	if inst.Scope != "instance" || !inst.HasAPIKey {
+		t.Fatalf("instance profile=%s", rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/admin/llm/profiles", bobAuth, map[string]any{"provider": "openai"}); rr.Code != http.StatusForbidden {
+		t.Fatalf("editor create instance profile status=%d", rr.Code)
+	}
+
+	type effective struct {
+		Type       string `json:"type"`
+		Source     string `json:"source"`
+		Configured bool   `json:"configured"`
+	}
+	config := func(auth string) effective {
+		t.Helper()
+		rr := doJSON(t, r, "GET", "/api/models/config", auth, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("config status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		if strings.Contains(rr.Body.String(), "sk-") {
+			t.Fatalf("api key leaked: %s", rr.Body.String())
+		}
+		var e effective
+		_ = json.Unmarshal(rr.Body.Bytes(), &e)
+		return e
+	}
+	if e := config(bobAuth); e.Type != "deepseek" || e.Source != "instance" || !e.Configured {
+		t.Fatalf("bob default=%+v", e)
+	}
+
+	// 个人配置只影响自己，API Key 加密落库
+	rr = doJSON(t, r, "POST", "/api/llm/profiles", bobAuth, map[string]any{
+		"provider": "openai", "model": "gpt-4o", "api_key": "sk-bob", "active": true,
+	})
+	if rr.Code != http.StatusCreated || strings.Contains(rr.Body.String(), "sk-bob") {
+		t.Fatalf("create profile status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var enc string
+	if err := database.DB.QueryRow(`SELECT api_key_enc FROM llm_profiles WHERE user_id = ?`, bob.ID).Scan(&enc); err != nil {
+		t.Fatalf("query profile: %v", err)
+	}
+	if plain, err := utils.DecryptData(enc, utils.InstanceSecret()); enc == "sk-bob" || err != nil || plain != "sk-bob" {
+		t.Fatalf("api key not encrypted: enc=%q plain=%q err=%v", enc, plain, err)
+	}
+	if e := config(bobAuth); e.Type != "openai" || e.Source != "user" || !e.Configured {
+		t.Fatalf("bob profile=%+v", e)
+	}
+	if e := config(admin); e.Type != "deepseek" || e.Source != "instance" {
+		t.Fatalf("admin affected by bob: %+v", e)
+	}
+
+	// 旧接口切换模型同样只写入个人配置
+	rr = doJSON(t, r, "POST", "/api/models/active", bobAuth, map[string]any{"type": "claude"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if e := config(bobAuth); e.Type != "claude" || e.Source != "user" || e.Configured {
+		t.Fatalf("bob after switch=%+v", e)
+	}
+	if e := config(admin); e.Type != "deepseek" {
+		t.Fatalf("admin affected by switch: %+v", e)
+	}
+
+	// 不能修改他人或实例的配置
+	if rr := doJSON(t, r, "PUT", "/api/llm/profiles/"+itoa(inst.ID), bobAuth, map[string]any{"provider": "openai"}); rr.Code != http.StatusNotFound {
+		t.Fatalf("update instance profile via user route status=%d", rr.Code)
+	}
+
+	// 停用个人配置后回落到实例默认
+	if rr := doJSON(t, r, "DELETE", "/api/llm/profiles/active", bobAuth, nil); rr.Code != http.StatusOK {
+		t.Fatalf("deactivate status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if e := config(bobAuth); e.Type != "deepseek" || e.Source != "instance" {
+		t.Fatalf("bob fallback=%+v", e)
+	}
+
+	rr = doJSON(t, r, "GET", "/api/llm/profiles", bobAuth, nil)
+	var list struct {
+		Profiles []map[string]any `json:"profiles"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &list)
+	if rr.Code != http.StatusOK || len(list.Profiles) != 2 {
+		t.Fatalf("list status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLLMProfileBaseURLRejectsInternalForNonAdmin(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+	bob, err := models.AdminCreateUser(models.CreateUserInput{Username: "bob", Password: "secret123", Role: models.RoleEditor})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobAuth := authHeader(t, bob.ID, "bob", false)
+
+	for _, u := range []string{"http://127.0.0.1:11434/v1", "http://169.254.169.254", "http://10.0.0.8/v1", "ftp://example.com"} {
+		rr := doJSON(t, r, "POST", "/api/llm/profiles", bobAuth, map[string]any{"provider": "openai", "base_url": u})
+		if rr.Code != http.StatusBadRequest {
+			t.Fatalf("base_url %s status=%d body=%s", u, rr.Code, rr.Body.String())
+		}
+	}
+	// 旧接口同样校验地址；未知类型按 OpenAI 兼容的本地模型处理
+	if rr := doJSON(t, r, "POST", "/api/models/active", bobAuth, map[string]any{"type": "my-llm", "base_url": "http://127.0.0.1:8080/v1"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("set active internal status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/models/active", bobAuth, map[string]any{"type": "my-llm", "base_url": "https://llm.example.com/v1"}); rr.Code != http.StatusOK {
+		t.Fatalf("set active status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if p, err := models.GetActiveLLMProfile(&bob.ID); err != nil || p == nil || p.Provider != string(services.ModelLocalAI) {
+		t.Fatalf("active profile=%+v err=%v", p, err)
+	}
+	// 管理员可以指向本机模型
+	if rr := doJSON(t, r, "POST", "/api/llm/profiles", admin, map[string]any{"provider": "ollama", "base_url": "http://127.0.0.1:11434/v1"}); rr.Code != http.StatusCreated {
+		t.Fatalf("admin profile status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 管理员通过 MEMO_LLM_ALLOW_HOSTS 放行内网主机
+	t.Setenv("MEMO_LLM_ALLOW_HOSTS", "127.0.0.1")
+	if rr := doJSON(t, r, "POST", "/api/llm/profiles", bobAuth, map[string]any{"provider": "ollama", "base_url": "http://127.0.0.1:11434/v1"}); rr.Code != http.StatusCreated {
+		t.Fatalf("allowed host status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSummarizeFallsBackToBackupModel(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	saved := services.DefaultRetryPolicy
+	services.DefaultRetryPolicy.MaxAttempts = 1
+	t.Cleanup(func() { services.DefaultRetryPolicy = saved })
+
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+	backup := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"model": "backup-model",
+			"choices": []any{map[string]any{"message": map[string]any{
+				"role": "assistant", "content": `{"summary":"备用模型总结","highlights":[],"action_items":[]}`,
+			}}},
+		})
+	}))
+	defer backup.Close()
+
+	if rr := doJSON(t, r, "POST", "/api/llm/profiles", auth, map[string]any{
+		"provider": "lmstudio", "base_url": down.URL, "active": true,
+	}); rr.Code != http.StatusCreated {
+		t.Fatalf("create primary status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/llm/profiles", auth, map[string]any{
+		"provider": "localai", "base_url": backup.URL, "fallback_priority": 1,
+	}); rr.Code != http.StatusCreated {
+		t.Fatalf("create fallback status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr := doJSON(t, r, "POST", "/api/summarize", auth, map[string]any{"content": "今天完成了很多事情"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("summarize status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var summary services.SummarizeResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &summary)
+	if summary.Summary != "备用模型总结" || summary.Provider != "localai" || !summary.Fallback {
+		t.Fatalf("summary=%+v", summary)
+	}
+
+	rr = doJSON(t, r, "GET", "/api/models/config", auth, nil)
+	var cfg struct {
+		Type   string `json:"type"`
+		Health struct {
+			State               string `json:"state"`
+			ConsecutiveFailures int    `json:"consecutive_failures"`
+		} `json:"health"`
+		Fallbacks []struct {
+			Type   string `json:"type"`
+			Health struct {
+				State string `json:"state"`
+			} `json:"health"`
+		} `json:"fallbacks"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &cfg)
+	if cfg.Type != "lmstudio" || cfg.Health.ConsecutiveFailures != 1 || cfg.Health.State != "closed" {
+		t.Fatalf("config=%s", rr.Body.String())
+	}
+	if len(cfg.Fallbacks) != 1 || cfg.Fallbacks[0].Type != "localai" || cfg.Fallbacks[0].Health.State != "closed" {
+		t.Fatalf("fallbacks=%s", rr.Body.String())
+	}
+}
@@ -1,8 +1,15 @@
 package handlers
 
 import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"memo-studio/backend/models"
 	"memo-studio/backend/services"
@@ -13,6 +20,10 @@ import (
 // UpdateNoteLocation 更新笔记位置
 // PUT /api/memos/:id/location
 func UpdateNoteLocation(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记 ID"})
@@ -29,9 +40,17 @@ func UpdateNoteLocation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
 		return
 	}
+	if !validLatLng(req.Latitude, req.Longitude) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "坐标超出范围"})
+		return
+	}
 
 	// 更新笔记位置
-	err = models.UpdateNoteLocation(id, req.Location, req.Latitude, req.Longitude)
+	err = models.UpdateNoteLocation(id, userID, req.Location, req.Latitude, req.Longitude)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
+		return
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新位置失败: " + err.Error()})
 		return
@@ -54,11 +73,18 @@ func UpdateNoteLocation(c *gin.Context) {
 // DetectNoteLocation 检测笔记中的位置（AI 识别）
 // POST /api/memos/:id/detect-location
 func DetectNoteLocation(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记 ID"})
 		return
 	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
 
 	// 获取笔记
 	note, err := models.GetNote(id)
@@ -68,7 +94,7 @@ func DetectNoteLocation(c *gin.Context) {
 	}
 
 	// 从内容中检测位置
-	locationInfo := services.DetectAndExtractLocation(note.Content)
+	locationInfo := services.DetectAndExtractLocation(c.Request.Context(), note.Content)
 
 	if locationInfo == nil {
 		c.JSON(http.StatusOK, gin.H{
@@ -91,11 +117,18 @@ func DetectNoteLocation(c *gin.Context) {
 // SaveDetectedLocation 检测并保存位置
 // POST /api/memos/:id/detect-and-save
 func SaveDetectedLocation(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	id, err := strconv.Atoi(c.Param("id"))
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记 ID"})
 		return
 	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
 
 	// 获取笔记
 	note, err := models.GetNote(id)
@@ -105,7 +138,7 @@ func SaveDetectedLocation(c *gin.Context) {
 	}
 
 	// 检测位置
-	locationInfo := services.DetectAndExtractLocation(note.Content)
+	locationInfo := services.DetectAndExtractLocation(c.Request.Context(), note.Content)
 	if locationInfo == nil {
 		c.JSON(http.StatusOK, gin.H{
 			"detected": false,
@@ -115,7 +148,7 @@ func SaveDetectedLocation(c *gin.Context) {
 	}
 
 	// 保存位置
-	err = models.UpdateNoteLocation(id, locationInfo.Name, locationInfo.Latitude, locationInfo.Longitude)
+	err = models.UpdateNoteLocation(id, userID, locationInfo.Name, locationInfo.Latitude, locationInfo.Longitude)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存位置失败"})
 		return
@@ -133,13 +166,17 @@ func SaveDetectedLocation(c *gin.Context) {
 // GetNotesByLocation 按位置筛选笔记
 // GET /api/notes?location=北京
 func GetNotesByLocation(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	location := c.Query("location")
 	if location == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定 location 参数"})
 		return
 	}
 
-	notes, err := models.GetNotesByLocation(location)
+	notes, err := models.GetNotesByLocation(userID, location)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
 		return
@@ -155,7 +192,11 @@ func GetNotesByLocation(c *gin.Context) {
 // GetLocationsStats 获取所有位置统计
 // GET /api/locations/stats
 func GetLocationsStats(c *gin.Context) {
-	stats, err := models.GetLocationStats()
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	stats, err := models.GetLocationStats(userID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取统计失败"})
 		return
@@ -169,6 +210,10 @@ func GetLocationsStats(c *gin.Context) {
 // BatchDetectLocations 批量检测笔记位置
 // POST /api/locations/batch-detect
 func BatchDetectLocations(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	var req struct {
 		NoteIDs []int `json:"note_ids"`
 	}
@@ -181,11 +226,11 @@ func BatchDetectLocations(c *gin.Context) {
 	results := make(map[int]map[string]interface{})
 	for _, id := range req.NoteIDs {
 		note, err := models.GetNote(id)
-		if err != nil {
+		if err != nil || note.UserID == nil || *note.UserID != userID {
 			continue
 		}
 
-		locationInfo := services.DetectAndExtractLocation(note.Content)
+		locationInfo := services.DetectAndExtractLocation(c.Request.Context(), note.Content)
 		if locationInfo != nil {
 			results[id] = map[string]interface{}{
 				"location":  locationInfo.Name,
@@ -201,3 +246,232 @@ func BatchDetectLocations(c *gin.Context) {
 		"locations": results,
 	})
 }
+
+// Geocode 地名或地址转坐标（离线地名库，及配置的在线服务）
+// GET /api/v1/geocode?q=
+func Geocode(c *gin.Context) {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定 q 参数"})
+		return
+	}
+	if utf8.RuneCountInString(q) > 200 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "查询过长"})
+		return
+	}
+
+	place, err := services.GetGeocoder().Geocode(c.Request.Context(), q)
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": "地理编码失败: " + err.Error(), "code": "GEOCODE_FAILED"})
+		return
+	}
+	if place == nil {
+		c.JSON(http.StatusOK, gin.H{"query": q, "found": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"query": q, "found": true, "place": place, "label": place.Label()})
+}
+
+// 附近查询的默认与最大半径（公里）
+const (
+	defaultNearbyRadiusKm = 5
+	maxNearbyRadiusKm     = 2000
+)
+
+func validLatLng(lat, lng float64) bool {
+	return lat >= -90 && lat <= 90 && lng >= -180 && lng <= 180 && !math.IsNaN(lat) && !math.IsNaN(lng)
+}
+
+// parseBBox 解析 bbox=西,南,东,北（经度在前，与 GeoJSON 一致）；西 > 东 表示跨越 180° 经线
+func parseBBox(s string) (*models.BBox, error) {
+	parts := strings.Split(s, ",")
+	if len(parts) != 4 {
+		return nil, fmt.Errorf("bbox 格式为 西,南,东,北")
+	}
+	var v [4]float64
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+		if err != nil {
+			return nil, fmt.Errorf("bbox 包含无效数字 %q", p)
+		}
+		v[i] = f
+	}
+	b := &models.BBox{West: v[0], South: v[1], East: v[2], North: v[3]}
+	if !validLatLng(b.South, b.West) || !validLatLng(b.North, b.East) || b.South > b.North {
+		return nil, fmt.Errorf("bbox 超出范围")
+	}
+	return b, nil
+}
+
+// queryBBox 读取可选的 bbox 参数；格式错误时写入 400 并返回 false
+func queryBBox(c *gin.Context) (*models.BBox, bool) {
+	raw := strings.TrimSpace(c.Query("bbox"))
+	if raw == "" {
+		return nil, true
+	}
+	b, err := parseBBox(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "code": "INVALID_BBOX"})
+		return nil, false
+	}
+	return b, true
+}
+
+func queryLimit(c *gin.Context, def, upper int) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", strconv.Itoa(def)))
+	if err != nil || limit <= 0 {
+		return def
+	}
+	return min(limit, upper)
+}
+
+// GetNearbyNotes 附近的笔记：lat/lng + radius_km（由近到远），或 bbox 范围内的笔记（按时间倒序）
+// GET /api/v1/notes/nearby?lat=&lng=&radius_km=
+// GET /api/v1/notes/nearby?bbox=西,南,东,北
+func GetNearbyNotes(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	limit := queryLimit(c, 200, models.MaxGeoNotes)
+
+	if c.Query("bbox") != "" {
+		box, ok := queryBBox(c)
+		if !ok {
+			return
+		}
+		notes, err := models.ListGeoNotes(models.GeoQuery{UserID: userID, BBox: box, Limit: limit})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败: " + err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"bbox": box, "count": len(notes), "notes": notes})
+		return
+	}
+
+	lat, errLat := strconv.ParseFloat(c.Query("lat"), 64)
+	lngStr := c.Query("lng")
+	if lngStr == "" {
+		lngStr = c.Query("lon")
+	}
+	lng, errLng := strconv.ParseFloat(lngStr, 64)
+	if errLat != nil || errLng != nil || !validLatLng(lat, lng) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请指定有效的 lat 与 lng，或 bbox"})
+		return
+	}
+	radius := float64(defaultNearbyRadiusKm)
+	if v := c.Query("radius_km"); v != "" {
+		r, err := strconv.ParseFloat(v, 64)
+		if err != nil || r <= 0 || r > maxNearbyRadiusKm || math.IsNaN(r) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("radius_km 需在 0 到 %d 之间", maxNearbyRadiusKm)})
+			return
+		}
+		radius = r
+	}
+
+	notes, err := models.NearbyNotes(userID, lat, lng, radius, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"center":    gin.H{"latitude": lat, "longitude": lng},
+		"radius_km": radius,
+		"count":     len(notes),
+		"notes":     notes,
+	})
+}
+
+// GetNoteClusters 地图聚合：按缩放级别把相邻的笔记合并（每个 256px 瓦片约 4×4 组）
+// GET /api/v1/notes/clusters?zoom=&bbox=
+func GetNoteClusters(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	zoom, err := strconv.Atoi(c.DefaultQuery("zoom", "3"))
+	if err != nil || zoom < 0 || zoom > models.MaxClusterZoom {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("zoom 需在 0 到 %d 之间", models.MaxClusterZoom)})
+		return
+	}
+	box, ok := queryBBox(c)
+	if !ok {
+		return
+	}
+	notes, err := models.ListGeoNotes(models.GeoQuery{UserID: userID, BBox: box})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"zoom":      zoom,
+		"bbox":      box,
+		"total":     len(notes),
+		"truncated": len(notes) >= models.MaxGeoNotes,
+		"clusters":  models.ClusterGeoNotes(notes, zoom),
+	})
+}
+
+// geoJSONFeature GeoJSON 点要素（坐标顺序为 [经度, 纬度]）
+type geoJSONFeature struct {
+	Type       string         `json:"type"`
+	ID         int            `json:"id"`
+	Geometry   geoJSONPoint   `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+type geoJSONPoint struct {
+	Type        string     `json:"type"`
+	Coordinates [2]float64 `json:"coordinates"`
+}
+
+// ExportNotesGeoJSON 导出带坐标的笔记为 GeoJSON FeatureCollection
+// GET /api/v1/notes/geojson?bbox=&download=1
+func ExportNotesGeoJSON(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	box, ok := queryBBox(c)
+	if !ok {
+		return
+	}
+	notes, err := models.ListGeoNotes(models.GeoQuery{UserID: userID, BBox: box})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败: " + err.Error()})
+		return
+	}
+
+	features := make([]geoJSONFeature, 0, len(notes))
+	for _, n := range notes {
+		tagNames := []string{}
+		if tags, err := models.GetTagsByNoteID(n.ID); err == nil {
+			for _, t := range tags {
+				tagNames = append(tagNames, t.Name)
+			}
+		}
+		features = append(features, geoJSONFeature{
+			Type:     "Feature",
+			ID:       n.ID,
+			Geometry: geoJSONPoint{Type: "Point", Coordinates: [2]float64{n.Longitude, n.Latitude}},
+			Properties: map[string]any{
+				"id":         n.ID,
+				"title":      n.Title,
+				"excerpt":    n.Excerpt,
+				"location":   n.Location,
+				"locked":     n.Locked,
+				"tags":       tagNames,
+				"created_at": n.CreatedAt.UTC().Format(time.RFC3339),
+			},
+		})
+	}
+	body, err := json.Marshal(gin.H{"type": "FeatureCollection", "features": features})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "导出失败: " + err.Error()})
+		return
+	}
+	if c.Query("download") == "1" {
+		c.Header("Content-Disposition", "attachment; filename=memo-notes-"+time.Now().Format("20060102-150405")+".geojson")
+	}
+	c.Data(http.StatusOK, "application/geo+json; charset=utf-8", body)
+}
@@ -0,0 +1,258 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"testing"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/models"
+)
+
+func setNoteLocation(t *testing.T, r http.Handler, auth string, id int, name string, lat, lng float64) {
+	t.Helper()
+	rr := doJSON(t, r, "PUT", "/api/memos/"+itoa(id)+"/location", auth, map[string]any{
+		"location": name, "latitude": lat, "longitude": lng,
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("set location status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+type geoNotesResponse struct {
+	Count int              `json:"count"`
+	Notes []models.GeoNote `json:"notes"`
+}
+
+func getGeoNotes(t *testing.T, r http.Handler, auth, query string) geoNotesResponse {
+	t.Helper()
+	rr := doJSON(t, r, "GET", "/api/notes/nearby?"+query, auth, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("nearby %s status=%d body=%s", query, rr.Code, rr.Body.String())
+	}
+	var resp geoNotesResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	return resp
+}
+
+func geoNoteIDs(notes []models.GeoNote) []int {
+	ids := make([]int, 0, len(notes))
+	for _, n := range notes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestLocationRoutesAreUserScoped(t *testing.T) {
+	r, adminID, _ := setup(t)
+	adminAuth := authHeader(t, adminID, "admin", true)
+	u2, err := models.CreateUser("geo2", "password1", "geo2@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	u2Auth := authHeader(t, u2.ID, u2.Username, false)
+
+	mine := createNoteAt(t, r, adminAuth, "在北京开会", nil, 0)
+	setNoteLocation(t, r, adminAuth, mine, "北京", 39.9042, 116.4074)
+	theirs := createNoteAt(t, r, u2Auth, "也在北京", nil, 0)
+	setNoteLocation(t, r, u2Auth, theirs, "北京", 39.9043, 116.4075)
+
+	// 其他用户的笔记：不能修改、检测位置，批量检测时跳过
+	rr := doJSON(t, r, "PUT", "/api/memos/"+itoa(mine)+"/location", u2Auth, map[string]any{"location": "上海", "latitude": 31.23, "longitude": 121.47})
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign update status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr = doJSON(t, r, "POST", "/api/memos/"+itoa(mine)+"/detect-location", u2Auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign detect status=%d", rr.Code)
+	}
+	rr = doJSON(t, r, "POST", "/api/locations/batch-detect", u2Auth, map[string]any{"note_ids": []int{mine, theirs}})
+	var batch struct {
+		Locations map[string]any `json:"locations"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if _, ok := batch.Locations[itoa(mine)]; ok || len(batch.Locations) != 1 {
+		t.Fatalf("batch detect leaked foreign note: %s", rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "GET", "/api/notes/by-location?location="+url.QueryEscape("北京"), adminAuth, nil)
+	var byLoc struct {
+		Notes []models.Note `json:"notes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &byLoc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(byLoc.Notes) != 1 || byLoc.Notes[0].ID != mine {
+		t.Fatalf("by-location = %s", rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "GET", "/api/locations/stats", adminAuth, nil)
+	var stats struct {
+		Locations []models.LocationStat `json:"locations"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if len(stats.Locations) != 1 || stats.Locations[0].Count != 1 || stats.Locations[0].Latitude == nil ||
+		*stats.Locations[0].Latitude != 39.9042 {
+		t.Fatalf("stats = %s", rr.Body.String())
+	}
+
+	if resp := getGeoNotes(t, r, u2Auth, "lat=39.9042&lng=116.4074&radius_km=5"); resp.Count != 1 || resp.Notes[0].ID != theirs {
+		t.Fatalf("u2 nearby = %+v", resp)
+	}
+}
+
+func TestNearbyBBoxClustersAndGeoJSON(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	tiananmen := createNoteAt(t, r, auth, "天安门看升旗", nil, 2)
+	setNoteLocation(t, r, auth, tiananmen, "天安门", 39.9055, 116.3976)
+	guomao := createNoteAt(t, r, auth, "国贸加班", []string{"工作"}, 1)
+	setNoteLocation(t, r, auth, guomao, "国贸", 39.9088, 116.4605)
+	shanghai := createNoteAt(t, r, auth, "上海出差", nil, 0)
+	setNoteLocation(t, r, auth, shanghai, "上海", 31.2304, 121.4737)
+	east := createNoteAt(t, r, auth, "斐济东", nil, 0)
+	setNoteLocation(t, r, auth, east, "斐济", -17.8, 179.9)
+	west := createNoteAt(t, r, auth, "斐济西", nil, 0)
+	setNoteLocation(t, r, auth, west, "斐济", -17.8, -179.9)
+	// 0,0 视为没有坐标
+	unknown := createNoteAt(t, r, auth, "不知道在哪", nil, 0)
+	setNoteLocation(t, r, auth, unknown, "某地", 0, 0)
+
+	resp := getGeoNotes(t, r, auth, "lat=39.9055&lng=116.3976&radius_km=3")
+	if resp.Count != 1 || resp.Notes[0].ID != tiananmen || *resp.Notes[0].DistanceKm != 0 {
+		t.Fatalf("3km = %+v", resp)
+	}
+	resp = getGeoNotes(t, r, auth, "lat=39.9055&lng=116.3976&radius_km=10")
+	if got := geoNoteIDs(resp.Notes); len(got) != 2 || got[0] != tiananmen || got[1] != guomao {
+		t.Fatalf("10km ids = %v", got)
+	}
+	if d := *resp.Notes[1].DistanceKm; math.Abs(d-5.38) > 0.05 {
+		t.Fatalf("tiananmen→guomao = %v km", d)
+	}
+	// 跨越 180° 经线的半径查询
+	resp = getGeoNotes(t, r, auth, "lat=-17.8&lng=180&radius_km=50")
+	if got := geoNoteIDs(resp.Notes); len(got) != 2 {
+		t.Fatalf("antimeridian radius ids = %v", got)
+	}
+
+	resp = getGeoNotes(t, r, auth, "bbox=116,39,117,41")
+	if got := geoNoteIDs(resp.Notes); len(got) != 2 || got[0] != guomao || got[1] != tiananmen {
+		t.Fatalf("bbox ids = %v", got)
+	}
+	resp = getGeoNotes(t, r, auth, "bbox=179,-20,-179,-15")
+	if got := geoNoteIDs(resp.Notes); len(got) != 2 {
+		t.Fatalf("antimeridian bbox ids = %v", got)
+	}
+
+	for _, q := range []string{"lat=91&lng=0", "lat=abc&lng=1", "lat=1&lng=1&radius_km=0", "bbox=1,2,3", "bbox=0,10,1,5"} {
+		if rr := doJSON(t, r, "GET", "/api/notes/nearby?"+q, auth, nil); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s status=%d", q, rr.Code)
+		}
+	}
+
+	clusters := func(query string) []models.GeoCluster {
+		t.Helper()
+		rr := doJSON(t, r, "GET", "/api/notes/clusters?"+query, auth, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("clusters %s status=%d body=%s", query, rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Total    int                 `json:"total"`
+			Clusters []models.GeoCluster `json:"clusters"`
+		}
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("unmarshal: %v", err)
+		}
+		return resp.Clusters
+	}
+	// 低缩放级别：北京的两条合并，上海、斐济两侧各自一组
+	low := clusters("zoom=4")
+	if len(low) != 4 || low[0].Count != 2 {
+		t.Fatalf("zoom 4 clusters = %+v", low)
+	}
+	ids := append([]int(nil), low[0].NoteIDs...)
+	sort.Ints(ids)
+	if ids[0] != tiananmen || ids[1] != guomao || low[0].Note != nil {
+		t.Fatalf("beijing cluster = %+v", low[0])
+	}
+	if low[1].Note == nil || low[1].Count != 1 {
+		t.Fatalf("single cluster should carry the note: %+v", low[1])
+	}
+	// 高缩放级别只看北京范围：两条分开
+	if high := clusters("zoom=14&bbox=116,39,117,41"); len(high) != 2 {
+		t.Fatalf("zoom 14 clusters = %+v", high)
+	}
+	if rr := doJSON(t, r, "GET", "/api/notes/clusters?zoom=30", auth, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("zoom 30 status=%d", rr.Code)
+	}
+
+	rr := doJSON(t, r, "GET", "/api/notes/geojson?download=1", auth, nil)
+	if rr.Code != http.StatusOK || !strings.HasPrefix(rr.Header().Get("Content-Type"), "application/geo+json") ||
+		!strings.Contains(rr.Header().Get("Content-Disposition"), ".geojson") {
+		t.Fatalf("geojson status=%d headers=%v", rr.Code, rr.Header())
+	}
+	var fc struct {
+		Type     string `json:"type"`
+		Features []struct {
+			Type     string `json:"type"`
+			ID       int    `json:"id"`
+			Geometry struct {
+				Type        string     `json:"type"`
+				Coordinates [2]float64 `json:"coordinates"`
+			} `json:"geometry"`
+			Properties struct {
+				Location string   `json:"location"`
+				Tags     []string `json:"tags"`
+			} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &fc); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if fc.Type != "FeatureCollection" || len(fc.Features) != 5 {
+		t.Fatalf("geojson = %s", rr.Body.String())
+	}
+	for _, f := range fc.Features {
+		if f.ID == guomao {
+			if f.Geometry.Type != "Point" || f.Geometry.Coordinates != [2]float64{116.4605, 39.9088} ||
+				f.Properties.Location != "国贸" || len(f.Properties.Tags) != 1 || f.Properties.Tags[0] != "工作" {
+				t.Fatalf("guomao feature = %+v", f)
+			}
+		}
+		if f.ID == unknown {
+			t.Fatalf("note without coordinates exported")
+		}
+	}
+}
+
+func TestNearbyKeepsNearestWhenCandidatesCapped(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	near := createNoteAt(t, r, auth, "楼下咖啡馆", nil, 30)
+	setNoteLocation(t, r, auth, near, "咖啡馆", 39.9055, 116.3976)
+	// 范围内更新、更远的笔记超过候选上限
+	if _, err := database.DB.Exec(
+		`WITH RECURSIVE seq(i) AS (SELECT 1 UNION ALL SELECT i + 1 FROM seq WHERE i < ?)
+		 INSERT INTO notes (user_id, title, content, latitude, longitude, created_at, updated_at)
+		 SELECT ?, '远处', '远处', 39.9055 + 0.05, 116.3976, datetime('now'), datetime('now') FROM seq`,
+		models.MaxGeoNotes+10, adminID,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := getGeoNotes(t, r, auth, "lat=39.9055&lng=116.3976&radius_km=10&limit=1")
+	if resp.Count != 1 || resp.Notes[0].ID != near {
+		t.Fatalf("nearest = %+v", resp.Notes)
+	}
+}
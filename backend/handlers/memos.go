@@ -9,6 +9,7 @@ import (
 
 	"memo-studio/backend/database"
 	"memo-studio/backend/models"
+	"memo-studio/backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -133,6 +134,12 @@ func ListMemos(c *gin.Context) {
 	if notes == nil {
 		notes = []models.Note{}
 	}
+	if includes(c, "summary") {
+		if err := models.AttachNoteSummaries(notes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取总结失败: " + err.Error()})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, notes)
 }
 
@@ -184,6 +191,8 @@ func CreateMemo(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建 memo 失败: " + err.Error()})
 		return
 	}
+	services.QueueNoteJobs(userID, note)
+	syncNoteStocks(userID, note)
 	c.JSON(http.StatusCreated, note)
 }
 
@@ -242,11 +251,20 @@ func UpdateMemo(c *gin.Context) {
 		tagIDs = append(tagIDs, tag.ID)
 	}
 
-	note, err := models.UpdateNote(id, req.Title, req.Content, tagIDs, req.Pinned, req.ContentType, req.ResourceIDs)
+	stored, locked, ok := sealNoteContentIfLocked(c, id, userID, req.Content)
+	if !ok {
+		return
+	}
+
+	note, err := models.UpdateNote(id, req.Title, stored, models.NoteWordCount(req.Title, req.Content), tagIDs, req.Pinned, req.ContentType, req.ResourceIDs)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新 memo 失败: " + err.Error()})
 		return
 	}
+	syncNoteStocks(userID, note)
+	if locked {
+		note.Content = req.Content
+	}
 	c.JSON(http.StatusOK, note)
 }
 
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"os"
 
+	"memo-studio/backend/models"
 	"memo-studio/backend/services"
 
 	"github.com/gin-gonic/gin"
@@ -57,60 +58,110 @@ type LocalHealthRequest struct {
 	BaseURL string `json:"base_url"`
 }
 
-// SetActiveModel 设置当前模型
+// SetActiveModel 设置当前模型（持久化为调用者的模型配置；?scope=instance 时设置实例默认）
 // POST /api/models/active
 func SetActiveModel(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	owner := &userID
+	if c.Query("scope") == services.ModelSourceInstance {
+		if !requirePermission(c, models.PermManageInstance) {
+			return
+		}
+		owner = nil
+	}
+
 	var req SetModelRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
 		return
 	}
 
-	// 验证模型类型
-	valid := false
-	for _, m := range services.DefaultModels() {
-		if string(m.Type) == req.Type {
-			valid = true
-			break
-		}
+	baseURL, ok := checkLLMBaseURL(c, req.BaseURL)
+	if !ok {
+		return
 	}
-	// 本地模型
-	for _, m := range services.LocalModels {
-		if string(m.Type) == req.Type {
-			valid = true
-			break
+	req.BaseURL = baseURL
+
+	// 验证模型类型；未知类型但提供了地址时按自定义本地模型（OpenAI 兼容）处理
+	provider := req.Type
+	preset, valid := services.FindModelPreset(provider)
+	if !valid {
+		if req.BaseURL == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模型类型"})
+			return
 		}
+		provider = string(services.ModelLocalAI)
+		preset, _ = services.FindModelPreset(provider)
 	}
 
-	if !valid && req.BaseURL == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的模型类型"})
+	// 同一厂商复用已有配置（保留其 API Key），否则新建
+	list, err := models.ListLLMProfiles(owner)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取模型配置失败: " + err.Error()})
 		return
 	}
-
-	// 设置环境变量
-	os.Setenv("LLM_MODEL_TYPE", req.Type)
-	if req.BaseURL != "" {
-		os.Setenv("LLM_BASE_URL", req.BaseURL)
+	var profile *models.LLMProfile
+	for i := range list {
+		if list[i].Provider == provider {
+			profile = &list[i]
+			break
+		}
 	}
-	if req.Model != "" {
-		os.Setenv("LLM_MODEL", req.Model)
+	if profile == nil {
+		profile, err = models.CreateLLMProfile(owner, models.LLMProfileInput{
+			Name:     preset.Name,
+			Provider: provider,
+			BaseURL:  req.BaseURL,
+			Model:    req.Model,
+		}, true)
+	} else {
+		in := models.LLMProfileInput{
+			Name:      profile.Name,
+			Provider:  provider,
+			BaseURL:   profile.BaseURL,
+			Model:     profile.Model,
+			MaxTokens: profile.MaxTokens,
+		}
+		if req.BaseURL != "" {
+			in.BaseURL = req.BaseURL
+		}
+		if req.Model != "" {
+			in.Model = req.Model
+		}
+		if profile, err = models.UpdateLLMProfile(profile.ID, owner, in); err == nil && profile != nil {
+			err = models.ActivateLLMProfile(profile.ID, owner)
+			profile.Active = true
+		}
+	}
+	if err != nil || profile == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模型配置失败"})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"success": true,
 		"message": "模型切换成功",
 		"model":   req.Type,
+		"profile": llmProfileView(*profile),
 	})
 }
 
-// AddLocalModel 添加自定义本地模型
+// AddLocalModel 添加自定义本地模型（保存为调用者的模型配置）
 // POST /api/models/local
 func AddLocalModel(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
 	var req struct {
 		Name    string `json:"name"`
 		Type    string `json:"type"` // ollama/lmstudio/localai/anything
 		BaseURL string `json:"base_url"`
 		Model   string `json:"model"`
+		Active  bool   `json:"active"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -122,18 +173,42 @@ func AddLocalModel(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "BaseURL 和 Model 不能为空"})
 		return
 	}
+	baseURL, ok := checkLLMBaseURL(c, req.BaseURL)
+	if !ok {
+		return
+	}
+	req.BaseURL = baseURL
+	if req.Type == "" {
+		req.Type = string(services.ModelOllama)
+	}
+	if preset, ok := services.FindModelPreset(req.Type); !ok || preset.Category != services.CategoryLocal {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的本地模型类型"})
+		return
+	}
 
 	// 验证连接
 	llmService := services.NewLLMService()
 	llmService.SetLocalModel(req.BaseURL, req.Model)
 	healthy, message := llmService.CheckLocalHealth(req.BaseURL)
 
+	profile, err := models.CreateLLMProfile(&userID, models.LLMProfileInput{
+		Name:     req.Name,
+		Provider: req.Type,
+		BaseURL:  req.BaseURL,
+		Model:    req.Model,
+	}, req.Active)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存模型配置失败: " + err.Error()})
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"success":  healthy,
 		"message":  message,
 		"name":     req.Name,
 		"base_url": req.BaseURL,
 		"model":    req.Model,
+		"profile":  llmProfileView(*profile),
 	})
 }
 
@@ -150,6 +225,11 @@ func CheckLocalHealth(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供服务地址"})
 		return
 	}
+	baseURL, ok := checkLLMBaseURL(c, req.BaseURL)
+	if !ok {
+		return
+	}
+	req.BaseURL = baseURL
 
 	llmService := services.NewLLMService()
 	healthy, message := llmService.CheckLocalHealth(req.BaseURL)
@@ -170,8 +250,16 @@ func GetModels(c *gin.Context) {
 		Active: ActiveModelInfo{},
 	}
 
-	// 当前激活的模型
-	activeModel := services.GetActiveModel()
+	// 当前用户实际使用的模型
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	activeModel, err := services.ResolveModelConfig(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析模型配置失败: " + err.Error()})
+		return
+	}
 	response.Active = ActiveModelInfo{
 		Type:     string(activeModel.Type),
 		Name:     activeModel.Name,
@@ -277,20 +365,27 @@ func GetLocalModels(c *gin.Context) {
 	})
 }
 
-// GetModelConfig 获取当前模型配置
+// GetModelConfig 获取当前用户实际使用的模型配置
 // GET /api/models/config
 func GetModelConfig(c *gin.Context) {
-	config := services.GetActiveModel()
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	config, err := services.ResolveModelConfig(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解析模型配置失败: " + err.Error()})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"type":      string(config.Type),
-		"name":      config.Name,
-		"category":  string(config.Category),
-		"model":     config.Model,
-		"base_url":  config.BaseURL,
-		"max_tokens": config.MaxTokens,
-		"context":   config.Context,
-	})
+	// 主模型与备用模型链，附带熔断器健康状态
+	view := modelHealthView(config)
+	fallbacks := make([]gin.H, 0)
+	for _, f := range services.ResolveFallbackChain(userID, config) {
+		fallbacks = append(fallbacks, modelHealthView(f))
+	}
+	view["fallbacks"] = fallbacks
+	c.JSON(http.StatusOK, view)
 }
 
 // GetAvailableModels 获取可用的模型列表（根据环境变量）
@@ -355,6 +450,11 @@ func TestModelConnection(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请提供服务地址"})
 		return
 	}
+	baseURL, ok := checkLLMBaseURL(c, req.BaseURL)
+	if !ok {
+		return
+	}
+	req.BaseURL = baseURL
 
 	llmService := services.NewLLMService()
 	llmService.SetLocalModel(req.BaseURL, req.Model)
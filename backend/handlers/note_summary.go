@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// includes 解析 ?include=summary,xxx
+func includes(c *gin.Context, name string) bool {
+	for _, part := range strings.Split(c.Query("include"), ",") {
+		if strings.TrimSpace(part) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// noteIDParam 解析路径中的笔记ID并校验归属
+func noteIDParam(c *gin.Context) (int, int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记ID"})
+		return 0, 0, false
+	}
+	userID, ok := mustUserID(c)
+	if !ok {
+		return 0, 0, false
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return 0, 0, false
+	}
+	return id, userID, true
+}
+
+// GetNoteSummary 获取笔记已保存的 AI 总结
+// GET /api/v1/notes/:id/summary
+func GetNoteSummary(c *gin.Context) {
+	id, _, ok := noteIDParam(c)
+	if !ok {
+		return
+	}
+	ns, err := models.GetNoteSummary(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取总结失败: " + err.Error()})
+		return
+	}
+	if ns == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "该笔记尚未生成总结"})
+		return
+	}
+	c.JSON(http.StatusOK, ns)
+}
+
+// GenerateNoteSummary 生成并保存笔记 AI 总结（覆盖旧总结）；?refresh=true 跳过缓存
+// POST /api/v1/notes/:id/summary
+func GenerateNoteSummary(c *gin.Context) {
+	id, _, ok := noteIDParam(c)
+	if !ok {
+		return
+	}
+	note, err := models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
+		return
+	}
+	if note.Locked {
+		c.JSON(http.StatusLocked, gin.H{"error": services.ErrNoteLocked.Error(), "code": "VAULT_LOCKED"})
+		return
+	}
+	if strings.TrimSpace(note.Content) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "内容不能为空"})
+		return
+	}
+	llmService := llmServiceForRequest(c)
+	if !llmService.Configured() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请在模型设置中配置 API Key 启用 AI 总结", "code": "LLM_NOT_CONFIGURED"})
+		return
+	}
+
+	ns, cached, err := services.SummarizeAndStoreNote(llmService, note, false)
+	if err != nil {
+		if abortIfQuotaExceeded(c, err) {
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI 总结失败: " + err.Error(), "code": "LLM_UNAVAILABLE"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"summary": ns, "cached": cached})
+}
+
+// DeleteNoteSummary 删除笔记 AI 总结
+// DELETE /api/v1/notes/:id/summary
+func DeleteNoteSummary(c *gin.Context) {
+	id, _, ok := noteIDParam(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteNoteSummary(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "该笔记尚未生成总结"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除总结失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "总结已删除"})
+}
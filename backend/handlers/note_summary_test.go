@@ -0,0 +1,120 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/utils"
+)
+
+func TestNoteSummaryPersistedAndMarkedStale(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	srv, _ := fakeLLM(t, `{"summary":"short","highlights":["h"],"action_items":["a"]}`, 10)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"title": "t", "content": "first draft"})
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+	id := itoa(note.ID)
+
+	if rr := doJSON(t, r, "GET", "/api/notes/"+id+"/summary", admin, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("summary before generate status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "POST", "/api/notes/"+id+"/summary", admin, nil); rr.Code != http.StatusOK {
+		t.Fatalf("generate status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 生成总结会调用大模型，按 ai 权限校验：访客拒绝
+	guest, err := models.AdminCreateUser(models.CreateUserInput{Username: "guest1", Password: "guest12345", Role: models.RoleGuest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	guestToken, _ := utils.GenerateToken(guest.ID, guest.Username, models.RoleGuest)
+	rr = doJSON(t, r, "POST", "/api/notes/"+id+"/summary", "Bearer "+guestToken, nil)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), `"permission":"ai"`) {
+		t.Fatalf("guest generate status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	getNote := func() models.Note {
+		t.Helper()
+		rr := doJSON(t, r, "GET", "/api/notes/"+id+"?include=summary", admin, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("get note status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var n models.Note
+		_ = json.Unmarshal(rr.Body.Bytes(), &n)
+		return n
+	}
+	n := getNote()
+	if n.Summary == nil || n.Summary.Summary != "short" || n.Summary.Stale || n.Summary.Model != "fake-model" {
+		t.Fatalf("summary=%+v", n.Summary)
+	}
+	if rr := doJSON(t, r, "GET", "/api/notes/"+id, admin, nil); strings.Contains(rr.Body.String(), `"summary"`) {
+		t.Fatalf("summary should only be included on request: %s", rr.Body.String())
+	}
+
+	// 编辑后标记为过期
+	if rr := doJSON(t, r, "PUT", "/api/memos/"+id, admin, map[string]any{"content": "second draft"}); rr.Code != http.StatusOK {
+		t.Fatalf("update status=%d", rr.Code)
+	}
+	if n := getNote(); n.Summary == nil || !n.Summary.Stale {
+		t.Fatalf("summary should be stale: %+v", n.Summary)
+	}
+
+	if rr := doJSON(t, r, "DELETE", "/api/notes/"+id+"/summary", admin, nil); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d", rr.Code)
+	}
+	if n := getNote(); n.Summary != nil {
+		t.Fatalf("summary should be deleted: %+v", n.Summary)
+	}
+}
+
+func TestAutoSummarizeLongNotes(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	srv, calls := fakeLLM(t, `{"summary":"auto","highlights":[],"action_items":[]}`, 10)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"auto_summarize": true, "auto_summarize_min_chars": 20})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("settings status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	create := func(content string) string {
+		rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": content})
+		var n models.Note
+		_ = json.Unmarshal(rr.Body.Bytes(), &n)
+		return itoa(n.ID)
+	}
+	shortID := create("too short")
+	longID := create(strings.Repeat("long note ", 5))
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		rr := doJSON(t, r, "GET", "/api/notes/"+longID+"/summary", admin, nil)
+		if rr.Code == http.StatusOK {
+			var ns models.NoteSummary
+			_ = json.Unmarshal(rr.Body.Bytes(), &ns)
+			if !ns.Auto || ns.Summary != "auto" {
+				t.Fatalf("auto summary=%+v", ns)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("auto summary not generated, status=%d", rr.Code)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if rr := doJSON(t, r, "GET", "/api/notes/"+shortID+"/summary", admin, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("short note should not be summarized, status=%d", rr.Code)
+	}
+	if *calls != 1 {
+		t.Fatalf("llm calls=%d", *calls)
+	}
+}
@@ -10,6 +10,7 @@ import (
 
 	"memo-studio/backend/database"
 	"memo-studio/backend/models"
+	"memo-studio/backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -146,6 +147,12 @@ func GetNotes(c *gin.Context) {
 	if notes == nil {
 		notes = []models.Note{}
 	}
+	if includes(c, "summary") {
+		if err := models.AttachNoteSummaries(notes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取总结失败: " + err.Error()})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, notes)
 }
 
@@ -169,6 +176,20 @@ func GetNote(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
 		return
 	}
+	// 加密笔记：携带有效解锁令牌时返回明文，否则内容为空
+	if note.Locked {
+		if dataKey, ok := optionalVaultDataKey(c, userID); ok {
+			if err := openLockedNote(note, dataKey); err == nil {
+				c.Header("Cache-Control", "no-store")
+			}
+		}
+	}
+	if includes(c, "summary") {
+		if note.Summary, err = models.GetNoteSummary(note.ID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "获取总结失败: " + err.Error()})
+			return
+		}
+	}
 	c.JSON(http.StatusOK, note)
 }
 
@@ -226,6 +247,8 @@ func CreateNote(c *gin.Context) {
 		_ = models.SetNoteNotebooks(note.ID, validIDs)
 	}
 
+	services.QueueNoteJobs(userID, note)
+	syncNoteStocks(userID, note)
 	c.JSON(http.StatusCreated, note)
 }
 
@@ -272,11 +295,20 @@ func UpdateNote(c *gin.Context) {
 		tagIDs = append(tagIDs, tag.ID)
 	}
 
-	note, err := models.UpdateNote(id, title, content, tagIDs, false, "markdown", nil)
+	stored, locked, ok := sealNoteContentIfLocked(c, id, userID, content)
+	if !ok {
+		return
+	}
+
+	note, err := models.UpdateNote(id, title, stored, models.NoteWordCount(title, content), tagIDs, false, "markdown", nil)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新笔记失败"})
 		return
 	}
+	syncNoteStocks(userID, note)
+	if locked {
+		note.Content = content
+	}
 
 	if req.NotebookIDs != nil {
 		var validIDs []int
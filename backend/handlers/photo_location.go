@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// photoEXIFExts 会解析 EXIF 的图片扩展名（浏览器上传 HEIC 时常不带 image/ 类型）
+var photoEXIFExts = map[string]bool{".jpg": true, ".jpeg": true, ".heic": true, ".heif": true, ".tif": true, ".tiff": true}
+
+func isPhotoResource(filename, mimeType string) bool {
+	return strings.HasPrefix(strings.ToLower(mimeType), "image/") || photoEXIFExts[strings.ToLower(filepath.Ext(filename))]
+}
+
+// resourceEXIF 转为附件保存的字段；0,0 视为相机未定位，不保存坐标
+func resourceEXIF(info *services.PhotoEXIF) *models.ResourceEXIF {
+	if info == nil {
+		return nil
+	}
+	e := &models.ResourceEXIF{Altitude: info.Altitude, TakenAt: info.TakenAt, Orientation: info.Orientation, Camera: info.Camera()}
+	if info.HasGPS() {
+		e.Latitude, e.Longitude = info.Latitude, info.Longitude
+	}
+	return e
+}
+
+// scanResourceEXIF 解析图片附件的 EXIF 并保存，返回更新后的附件。
+// 加密附件与已解析过的附件原样返回；读取或解析失败只记录日志（同样标记为已解析）
+func scanResourceEXIF(res *models.Resource) *models.Resource {
+	if res.Encrypted || res.EXIFScanned() || !isPhotoResource(res.Filename, res.MimeType) {
+		return res
+	}
+	info, err := services.ReadPhotoEXIF(filepath.Join(storageBaseDir(), filepath.FromSlash(res.StoragePath)))
+	if err != nil {
+		log.Printf("解析附件 %d 的 EXIF 失败: %v", res.ID, err)
+	}
+	if err := models.SetResourceEXIF(res.ID, resourceEXIF(info)); err != nil {
+		log.Printf("保存附件 %d 的 EXIF 失败: %v", res.ID, err)
+		return res
+	}
+	if updated, err := models.GetResource(res.ID); err == nil {
+		return updated
+	}
+	return res
+}
+
+// notePhotoLocation 笔记中带 GPS 的附件：resourceID 为 0 时取第一张，否则取指定附件。
+// 旧附件在这里补做 EXIF 解析。找不到时返回 nil
+func notePhotoLocation(noteID, resourceID int) (*models.Resource, error) {
+	resources, err := models.GetResourcesByNoteID(noteID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range resources {
+		if resourceID != 0 && resources[i].ID != resourceID {
+			continue
+		}
+		if r := scanResourceEXIF(&resources[i]); r.EXIF.HasGPS() {
+			return r, nil
+		}
+	}
+	return nil, nil
+}
+
+// photoLocationName 反查拍摄地点名称；查不到时用坐标表示
+func photoLocationName(c *gin.Context, e *models.ResourceEXIF) (string, bool) {
+	if loc := services.ReverseLocation(c.Request.Context(), *e.Latitude, *e.Longitude); loc != nil {
+		return loc.Name, true
+	}
+	return fmt.Sprintf("%.5f, %.5f", *e.Latitude, *e.Longitude), false
+}
+
+// GetPhotoLocation 根据笔记第一张带 GPS 的照片建议位置（不保存）
+// GET /api/memos/:id/photo-location
+func GetPhotoLocation(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记 ID"})
+		return
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
+
+	res, err := notePhotoLocation(id, 0)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取附件失败: " + err.Error()})
+		return
+	}
+	if res == nil {
+		c.JSON(http.StatusOK, gin.H{
+			"found":   false,
+			"message": "附件中没有带位置信息的照片",
+		})
+		return
+	}
+
+	name, geocoded := photoLocationName(c, res.EXIF)
+	c.JSON(http.StatusOK, gin.H{
+		"found":     true,
+		"resource":  res,
+		"location":  name,
+		"geocoded":  geocoded,
+		"latitude":  *res.EXIF.Latitude,
+		"longitude": *res.EXIF.Longitude,
+		"taken_at":  res.EXIF.TakenAt,
+		"suggest":   "是否使用照片的拍摄位置？",
+	})
+}
+
+// ApplyPhotoLocation 把照片的拍摄位置保存到笔记
+// POST /api/memos/:id/photo-location
+// body（可选）: { "resource_id": 12, "location": "自定义名称" }，不指定附件时取第一张带 GPS 的照片
+func ApplyPhotoLocation(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记 ID"})
+		return
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
+
+	var req struct {
+		ResourceID int    `json:"resource_id"`
+		Location   string `json:"location"`
+	}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求格式错误"})
+			return
+		}
+	}
+
+	res, err := notePhotoLocation(id, req.ResourceID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取附件失败: " + err.Error()})
+		return
+	}
+	if res == nil {
+		msg := "附件中没有带位置信息的照片"
+		if req.ResourceID != 0 {
+			msg = "该附件不属于此笔记或没有位置信息"
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": msg, "code": "NO_PHOTO_LOCATION"})
+		return
+	}
+
+	name := strings.TrimSpace(req.Location)
+	if name == "" {
+		name, _ = photoLocationName(c, res.EXIF)
+	}
+	lat, lng := *res.EXIF.Latitude, *res.EXIF.Longitude
+	if err := models.UpdateNoteLocation(id, userID, name, lat, lng); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存位置失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"success":     true,
+		"message":     "位置已保存",
+		"location":    name,
+		"latitude":    lat,
+		"longitude":   lng,
+		"resource_id": res.ID,
+	})
+}
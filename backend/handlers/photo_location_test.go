@@ -0,0 +1,180 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+)
+
+func uploadFile(t *testing.T, r http.Handler, auth, filename string, content []byte) models.Resource {
+	t.Helper()
+	var mp bytes.Buffer
+	w := multipart.NewWriter(&mp)
+	fw, err := w.CreateFormFile("file", filename)
+	if err != nil {
+		t.Fatalf("CreateFormFile: %v", err)
+	}
+	fw.Write(content)
+	_ = w.Close()
+
+	req := httptest.NewRequest("POST", "/api/resources", &mp)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", auth)
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("upload status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var res models.Resource
+	if err := json.Unmarshal(rr.Body.Bytes(), &res); err != nil {
+		t.Fatalf("unmarshal resource: %v", err)
+	}
+	return res
+}
+
+func createMemoWithResources(t *testing.T, r http.Handler, auth, content string, resourceIDs ...int) int {
+	t.Helper()
+	rr := doJSON(t, r, "POST", "/api/memos", auth, map[string]any{"content": content, "resource_ids": resourceIDs})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create memo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var note models.Note
+	if err := json.Unmarshal(rr.Body.Bytes(), &note); err != nil {
+		t.Fatalf("unmarshal note: %v", err)
+	}
+	return note.ID
+}
+
+func TestUploadPhotoStoresEXIFAndSuggestsLocation(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	prev := services.GetGeocoder()
+	services.SetGeocoder(&services.GazetteerGeocoder{Gazetteer: services.DefaultGazetteer()})
+	t.Cleanup(func() { services.SetGeocoder(prev) })
+
+	jpeg, err := os.ReadFile("testdata/geotagged.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := uploadFile(t, r, auth, "IMG_0001.JPG", jpeg)
+	e := photo.EXIF
+	if e == nil || !e.HasGPS() || math.Abs(*e.Latitude-39.9042) > 1e-6 || math.Abs(*e.Longitude-116.4074) > 1e-6 {
+		t.Fatalf("photo exif = %+v", e)
+	}
+	if e.Orientation != 6 || e.Camera != "Apple iPhone 15 Pro" || *e.Altitude != 43.5 ||
+		e.TakenAt == nil || !e.TakenAt.Equal(time.Date(2024, 5, 1, 0, 30, 0, 0, time.UTC)) {
+		t.Fatalf("photo exif = %+v", e)
+	}
+	plain := uploadFile(t, r, auth, "notes.txt", []byte("hello"))
+	if plain.EXIF != nil {
+		t.Fatalf("plain exif = %+v", plain.EXIF)
+	}
+
+	noteID := createMemoWithResources(t, r, auth, "周末出去走走", plain.ID, photo.ID)
+	rr := doJSON(t, r, "GET", "/api/memos/"+itoa(noteID)+"/photo-location", auth, nil)
+	var suggestion struct {
+		Found     bool            `json:"found"`
+		Resource  models.Resource `json:"resource"`
+		Location  string          `json:"location"`
+		Geocoded  bool            `json:"geocoded"`
+		Latitude  float64         `json:"latitude"`
+		Longitude float64         `json:"longitude"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &suggestion); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if !suggestion.Found || suggestion.Resource.ID != photo.ID || suggestion.Location != "北京天安门" || !suggestion.Geocoded {
+		t.Fatalf("suggestion = %s", rr.Body.String())
+	}
+
+	// 其他用户不能读取或应用
+	u2, err := models.CreateUser("photo2", "password1", "photo2@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	u2Auth := authHeader(t, u2.ID, u2.Username, false)
+	if rr := doJSON(t, r, "GET", "/api/memos/"+itoa(noteID)+"/photo-location", u2Auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign get status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "POST", "/api/memos/"+itoa(noteID)+"/photo-location", u2Auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign apply status=%d", rr.Code)
+	}
+
+	// 指定不含 GPS 的附件
+	rr = doJSON(t, r, "POST", "/api/memos/"+itoa(noteID)+"/photo-location", auth, map[string]any{"resource_id": plain.ID})
+	if rr.Code != http.StatusNotFound {
+		t.Fatalf("plain resource status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "POST", "/api/memos/"+itoa(noteID)+"/photo-location", auth, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("apply status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	note, err := models.GetNote(noteID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if note.Location != "北京天安门" || math.Abs(note.Latitude-39.9042) > 1e-6 {
+		t.Fatalf("note location = %q %v", note.Location, note.Latitude)
+	}
+
+	// 自定义名称
+	rr = doJSON(t, r, "POST", "/api/memos/"+itoa(noteID)+"/photo-location", auth, map[string]any{"location": "长安街"})
+	if note, _ = models.GetNote(noteID); rr.Code != http.StatusOK || note.Location != "长安街" {
+		t.Fatalf("custom name status=%d location=%q", rr.Code, note.Location)
+	}
+
+	// 没有照片的笔记
+	bare := createMemoWithResources(t, r, auth, "只有文字")
+	rr = doJSON(t, r, "GET", "/api/memos/"+itoa(bare)+"/photo-location", auth, nil)
+	if err := json.Unmarshal(rr.Body.Bytes(), &suggestion); err != nil || suggestion.Found {
+		t.Fatalf("bare = %s", rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/memos/"+itoa(bare)+"/photo-location", auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("bare apply status=%d", rr.Code)
+	}
+}
+
+func TestPhotoLocationScansOlderUploads(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	prev := services.GetGeocoder()
+	services.SetGeocoder(&services.GazetteerGeocoder{Gazetteer: services.DefaultGazetteer()})
+	t.Cleanup(func() { services.SetGeocoder(prev) })
+
+	jpeg, err := os.ReadFile("testdata/geotagged.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	photo := uploadFile(t, r, auth, "old.jpeg", jpeg)
+	// 清除 EXIF，模拟升级前上传的附件
+	if err := models.SetResourceEncrypted(photo.ID, false); err != nil {
+		t.Fatal(err)
+	}
+	if res, _ := models.GetResource(photo.ID); res.EXIF != nil || res.EXIFScanned() {
+		t.Fatalf("exif not cleared: %+v", res.EXIF)
+	}
+
+	noteID := createMemoWithResources(t, r, auth, "旧照片", photo.ID)
+	rr := doJSON(t, r, "GET", "/api/memos/"+itoa(noteID)+"/photo-location", auth, nil)
+	var suggestion struct {
+		Found    bool   `json:"found"`
+		Location string `json:"location"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &suggestion); err != nil || !suggestion.Found || suggestion.Location != "北京天安门" {
+		t.Fatalf("suggestion = %s", rr.Body.String())
+	}
+	if res, _ := models.GetResource(photo.ID); !res.EXIFScanned() || !res.EXIF.HasGPS() {
+		t.Fatalf("exif not saved after lazy scan: %+v", res.EXIF)
+	}
+}
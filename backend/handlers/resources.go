@@ -15,6 +15,7 @@ import (
 	"time"
 
 	"memo-studio/backend/models"
+	"memo-studio/backend/utils"
 
 	"github.com/gin-gonic/gin"
 )
@@ -77,6 +78,32 @@ func saveMultipartFile(file multipart.File, dst string) (size int64, sha string,
 	return n, hex.EncodeToString(h.Sum(nil)), nil
 }
 
+// saveEncryptedFile 在内存中加密后写入 dst（先写临时文件再改名），明文不落盘；sha256 按明文计算
+func saveEncryptedFile(file multipart.File, dst, dataKey string) (size int64, sha string, err error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return 0, "", err
+	}
+	sum := sha256.Sum256(data)
+	enc, err := utils.EncryptBytes(data, dataKey)
+	if err != nil {
+		return 0, "", err
+	}
+	if err := ensureDir(filepath.Dir(dst)); err != nil {
+		return 0, "", err
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, enc, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		_ = os.Remove(tmp)
+		return 0, "", err
+	}
+	return int64(len(data)), hex.EncodeToString(sum[:]), nil
+}
+
 func getOptionalUserID(c *gin.Context) *int {
 	v, ok := c.Get("userID")
 	if !ok {
@@ -89,8 +116,8 @@ func getOptionalUserID(c *gin.Context) *int {
 }
 
 // UploadResource 上传附件
-// POST /api/resources (multipart/form-data)
-// form field: file
+// POST /api/resources (multipart/form-data)；照片会解析 EXIF 保存在 exif 字段
+// form field: file, encrypt=true（可选，使用密钥库数据密钥加密存储，需 X-Vault-Token）
 func UploadResource(c *gin.Context) {
 	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxUploadSize)
 
@@ -113,6 +140,17 @@ func UploadResource(c *gin.Context) {
 	defer file.Close()
 
 	userID := getOptionalUserID(c)
+	var dataKey string
+	if encrypt, _ := strconv.ParseBool(c.PostForm("encrypt")); encrypt {
+		if userID == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "未认证"})
+			return
+		}
+		var ok bool
+		if dataKey, ok = vaultDataKey(c, *userID); !ok {
+			return
+		}
+	}
 	userSeg := "public"
 	if userID != nil && *userID > 0 {
 		userSeg = "u" + strconv.Itoa(*userID)
@@ -133,7 +171,16 @@ func UploadResource(c *gin.Context) {
 	relPath := filepath.ToSlash(filepath.Join(userSeg, dateSeg, filename))
 	dst := filepath.Join(storageBaseDir(), filepath.FromSlash(relPath))
 
-	size, sha, err := saveMultipartFile(file, dst)
+	var (
+		size int64
+		sha  string
+	)
+	if dataKey != "" {
+		// 加密存储：sha256 仍按明文计算，便于去重与校验；明文不写入对外提供的存储目录
+		size, sha, err = saveEncryptedFile(file, dst, dataKey)
+	} else {
+		size, sha, err = saveMultipartFile(file, dst)
+	}
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存文件失败: " + err.Error()})
 		return
@@ -147,6 +194,18 @@ func UploadResource(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "写入资源记录失败: " + err.Error()})
 		return
 	}
+	if dataKey != "" {
+		if err := models.SetResourceEncrypted(res.ID, true); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "写入资源记录失败: " + err.Error()})
+			return
+		}
+		if updated, err := models.GetResource(res.ID); err == nil {
+			res = updated
+		}
+	} else {
+		// 照片：解析 EXIF（GPS、拍摄时间、方向）。加密附件不解析，避免拍摄位置以明文保存
+		res = scanResourceEXIF(res)
+	}
 
 	c.JSON(http.StatusCreated, res)
 }
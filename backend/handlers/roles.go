@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"memo-studio/backend/middleware"
+	"memo-studio/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SetUserRoleRequest struct {
+	Role string `json:"role" binding:"required"`
+}
+
+// requirePermission 在处理函数内校验权限；无权限时写入 403 并返回 false
+func requirePermission(c *gin.Context, perm models.Permission) bool {
+	if middleware.HasPermission(c, perm) {
+		return true
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "无权限", "code": "PERMISSION_DENIED", "permission": perm})
+	return false
+}
+
+// ListRoles 角色与权限列表
+// GET /api/v1/roles
+func ListRoles(c *gin.Context) {
+	roles := make([]gin.H, 0, len(models.Roles()))
+	for _, r := range models.Roles() {
+		roles = append(roles, gin.H{"role": r, "permissions": models.RolePermissions(r)})
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"current": middleware.CurrentRole(c),
+		"roles":   roles,
+	})
+}
+
+// AdminSetUserRole 设置用户角色（立即生效，已签发的令牌按新角色鉴权）
+// PUT /api/v1/users/:id/role
+func AdminSetUserRole(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	var req SetUserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if !models.IsValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色: " + req.Role})
+		return
+	}
+	if err := models.SetUserRole(id, req.Role); err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		case errors.Is(err, models.ErrLastAdmin):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "设置角色失败: " + err.Error()})
+		}
+		return
+	}
+	user, err := models.GetUserByID(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取用户失败"})
+		return
+	}
+	c.JSON(http.StatusOK, user)
+}
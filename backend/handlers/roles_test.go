@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/utils"
+)
+
+func TestRoleAssignmentAndReadOnlyRoles(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	rr := doJSON(t, r, "POST", "/api/users", admin, map[string]any{
+		"username": "grace", "password": "secret123",
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create user status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var grace models.User
+	_ = json.Unmarshal(rr.Body.Bytes(), &grace)
+	if grace.Role != models.RoleEditor {
+		t.Fatalf("default role=%q", grace.Role)
+	}
+
+	// editor 可写
+	editor := authHeader(t, grace.ID, "grace", false)
+	if rr := doJSON(t, r, "POST", "/api/memos", editor, map[string]any{"content": "ok"}); rr.Code != http.StatusCreated {
+		t.Fatalf("editor create status=%d", rr.Code)
+	}
+
+	if rr := doJSON(t, r, "PUT", "/api/users/"+itoa(grace.ID)+"/role", admin, map[string]any{"role": "owner"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid role status=%d", rr.Code)
+	}
+	rr = doJSON(t, r, "PUT", "/api/users/"+itoa(grace.ID)+"/role", admin, map[string]any{"role": "viewer"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("set role status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	// 降级立即生效：降级前签发的令牌按新角色鉴权
+	if rr := doJSON(t, r, "POST", "/api/memos", editor, map[string]any{"content": "stale"}); rr.Code != http.StatusForbidden {
+		t.Fatalf("demoted token create status=%d", rr.Code)
+	}
+
+	// 重新登录后令牌携带新角色
+	rr = doJSON(t, r, "POST", "/api/auth/login", "", map[string]any{"username": "grace", "password": "secret123"})
+	var login struct {
+		Token string      `json:"token"`
+		User  models.User `json:"user"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &login)
+	claims, err := utils.ParseToken(login.Token)
+	if err != nil || claims.Role != models.RoleViewer || login.User.Role != models.RoleViewer {
+		t.Fatalf("claims=%+v err=%v user=%+v", claims, err, login.User)
+	}
+	viewer := "Bearer " + login.Token
+
+	// 只读角色：读取与自助修改允许，写入拒绝
+	if rr := doJSON(t, r, "GET", "/api/memos", viewer, nil); rr.Code != http.StatusOK {
+		t.Fatalf("viewer list status=%d", rr.Code)
+	}
+	rr = doJSON(t, r, "POST", "/api/memos", viewer, map[string]any{"content": "nope"})
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("viewer create status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/tags", viewer, map[string]any{"name": "x"}); rr.Code != http.StatusForbidden {
+		t.Fatalf("viewer create tag status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "PUT", "/api/users/me/password", viewer, map[string]any{"old_password": "secret123", "new_password": "secret456"}); rr.Code != http.StatusOK {
+		t.Fatalf("viewer change password status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "GET", "/api/users", viewer, nil); rr.Code != http.StatusForbidden {
+		t.Fatalf("viewer admin route status=%d", rr.Code)
+	}
+
+	// 升级同样立即生效
+	if rr := doJSON(t, r, "PUT", "/api/users/"+itoa(grace.ID)+"/role", admin, map[string]any{"role": "editor"}); rr.Code != http.StatusOK {
+		t.Fatalf("promote status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "POST", "/api/memos", viewer, map[string]any{"content": "ok"}); rr.Code != http.StatusCreated {
+		t.Fatalf("promoted create status=%d", rr.Code)
+	}
+
+	// 不能降级最后一个管理员
+	if rr := doJSON(t, r, "PUT", "/api/users/"+itoa(adminID)+"/role", admin, map[string]any{"role": "editor"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("demote last admin status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "PUT", "/api/users/"+itoa(adminID), admin, map[string]any{"username": "admin", "is_admin": false}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("demote last admin via is_admin status=%d", rr.Code)
+	}
+}
@@ -2,8 +2,11 @@ package handlers
 
 import (
 	"net/http"
+	"strings"
+	"time"
 
 	"memo-studio/backend/models"
+	"memo-studio/backend/services"
 
 	"github.com/gin-gonic/gin"
 )
@@ -21,3 +24,90 @@ func GetStats(c *gin.Context) {
 	}
 	c.JSON(http.StatusOK, stats)
 }
+
+// 活动统计各粒度的默认区间与最大时间段数
+var activityDefaults = map[string]struct {
+	days       int
+	maxBuckets int
+}{
+	models.ActivityDay:   {days: 30, maxBuckets: 731},
+	models.ActivityWeek:  {days: 12 * 7, maxBuckets: 520},
+	models.ActivityMonth: {days: 365, maxBuckets: 240},
+}
+
+// GetActivityStats 写作活动统计：时间序列、年度热力图、连续天数、标签趋势、活跃时段
+// GET /api/v1/stats/activity?from=YYYY-MM-DD&to=YYYY-MM-DD&granularity=day|week|month&tz=
+func GetActivityStats(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	granularity := strings.TrimSpace(c.DefaultQuery("granularity", models.ActivityDay))
+	def, ok := activityDefaults[granularity]
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "granularity 只能是 day、week 或 month"})
+		return
+	}
+
+	loc := userLocation(userID)
+	if tz := strings.TrimSpace(c.Query("tz")); tz != "" {
+		l, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时区: " + tz})
+			return
+		}
+		loc = l
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	to := today.AddDate(0, 0, 1)
+	if s := strings.TrimSpace(c.Query("to")); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 格式应为 YYYY-MM-DD"})
+			return
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	from := models.ActivityBucketStart(to.AddDate(0, 0, -def.days), granularity)
+	if s := strings.TrimSpace(c.Query("from")); s != "" {
+		t, err := time.ParseInLocation("2006-01-02", s, loc)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 格式应为 YYYY-MM-DD"})
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from 不能晚于 to"})
+		return
+	}
+	if models.ActivityBucketCount(from, to, granularity) > def.maxBuckets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "时间范围过大，请缩小范围或使用更粗的粒度", "code": "RANGE_TOO_LARGE"})
+		return
+	}
+
+	stats, err := models.GetActivityStats(models.ActivityQuery{
+		UserID:      userID,
+		Location:    loc,
+		From:        from,
+		To:          to,
+		Granularity: granularity,
+		Now:         now,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取活动统计失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, stats)
+}
+
+// userLocation 用户设置的时区；未设置或读取失败时用服务器时区
+func userLocation(userID int) *time.Location {
+	st, err := models.GetUserSettings(userID)
+	if err != nil {
+		return time.Local
+	}
+	return services.DigestLocation(st.Timezone)
+}
@@ -0,0 +1,140 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/models"
+)
+
+func setNoteTimes(t *testing.T, id int, created, updated string) {
+	t.Helper()
+	if updated == "" {
+		updated = created
+	}
+	if _, err := database.DB.Exec("UPDATE notes SET created_at = ?, updated_at = ? WHERE id = ?", created, updated, id); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getActivity(t *testing.T, r http.Handler, auth, query string) models.ActivityStats {
+	t.Helper()
+	rr := doJSON(t, r, "GET", "/api/stats/activity?"+query, auth, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("activity status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var stats models.ActivityStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	return stats
+}
+
+func TestActivityStatsBucketsInUserTimezone(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	// UTC 3/1 20:00 = 上海 3/2 04:00
+	a := createNoteAt(t, r, admin, "hello world 你好", []string{"工作"}, 0)
+	setNoteTimes(t, a, "2026-03-01 20:00:00", "2026-03-02 20:00:00")
+	b := createNoteAt(t, r, admin, "第二条", []string{"工作"}, 0)
+	setNoteTimes(t, b, "2026-03-01 10:00:00", "")
+
+	// 时区来自用户设置
+	rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"timezone": "Asia/Shanghai"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("settings status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	stats := getActivity(t, r, admin, "from=2026-03-01&to=2026-03-03")
+	if stats.Timezone != "Asia/Shanghai" || len(stats.Series) != 3 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	want := []models.ActivityBucket{
+		{Bucket: "2026-03-01", Created: 1, Words: 3},
+		{Bucket: "2026-03-02", Created: 1, Words: 4},
+		{Bucket: "2026-03-03", Updated: 1},
+	}
+	for i, w := range want {
+		if stats.Series[i] != w {
+			t.Fatalf("series[%d]=%+v want %+v", i, stats.Series[i], w)
+		}
+	}
+	if stats.BusiestHours[4] != 1 || stats.BusiestHours[18] != 1 {
+		t.Fatalf("unexpected hours: %v", stats.BusiestHours)
+	}
+	if len(stats.Tags) != 1 || stats.Tags[0].Tag != "工作" || stats.Tags[0].Total != 2 || len(stats.Tags[0].Series) != 2 {
+		t.Fatalf("unexpected tags: %+v", stats.Tags)
+	}
+
+	// 周从周一开始，月按自然月
+	weekly := getActivity(t, r, admin, "from=2026-03-01&to=2026-03-03&granularity=week")
+	if len(weekly.Series) != 2 || weekly.Series[0].Bucket != "2026-02-23" || weekly.Series[0].Created != 1 || weekly.Series[1].Created != 1 {
+		t.Fatalf("unexpected weekly: %+v", weekly.Series)
+	}
+	monthly := getActivity(t, r, admin, "from=2026-03-01&to=2026-03-31&granularity=month&tz=UTC")
+	if len(monthly.Series) != 1 || monthly.Series[0].Bucket != "2026-03-01" || monthly.Series[0].Created != 2 {
+		t.Fatalf("unexpected monthly: %+v", monthly.Series)
+	}
+}
+
+func TestActivityStatsDaylightSaving(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	// 纽约 2026-03-08 进入夏令时：之前 UTC-5，之后 UTC-4
+	a := createNoteAt(t, r, admin, "before", nil, 0)
+	setNoteTimes(t, a, "2026-03-08 04:30:00", "")
+	b := createNoteAt(t, r, admin, "after", nil, 0)
+	setNoteTimes(t, b, "2026-03-09 03:30:00", "")
+
+	stats := getActivity(t, r, admin, "from=2026-03-07&to=2026-03-08&tz=America/New_York")
+	if stats.Series[0].Created != 1 || stats.Series[1].Created != 1 {
+		t.Fatalf("unexpected series: %+v", stats.Series)
+	}
+	if stats.BusiestHours[23] != 2 {
+		t.Fatalf("unexpected hours: %v", stats.BusiestHours)
+	}
+}
+
+func TestActivityStatsStreaksAndHeatmap(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	for _, days := range []int{1, 2, 3, 10, 11, 12, 13} {
+		createNoteAt(t, r, admin, "日记", nil, days)
+	}
+	createNoteAt(t, r, admin, "日记", nil, 1)
+
+	stats := getActivity(t, r, admin, "tz=UTC")
+	if stats.Streaks.Current != 3 || stats.Streaks.Longest != 4 {
+		t.Fatalf("unexpected streaks: %+v", stats.Streaks)
+	}
+	if len(stats.Series) != 30 || len(stats.Heatmap.Days) < 365 {
+		t.Fatalf("series=%d heatmap=%d", len(stats.Series), len(stats.Heatmap.Days))
+	}
+	if stats.Heatmap.Total != 8 || stats.Heatmap.Max != 2 || stats.Heatmap.To != stats.To {
+		t.Fatalf("unexpected heatmap: total=%d max=%d to=%s", stats.Heatmap.Total, stats.Heatmap.Max, stats.Heatmap.To)
+	}
+}
+
+func TestActivityStatsValidation(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	for _, q := range []string{
+		"granularity=year",
+		"from=2026-03-05&to=2026-03-01",
+		"from=2020-01-01&to=2026-01-01",
+		"tz=Mars/Base",
+		"from=03/01/2026",
+	} {
+		if rr := doJSON(t, r, "GET", "/api/stats/activity?"+q, admin, nil); rr.Code != http.StatusBadRequest {
+			t.Fatalf("%s: status=%d body=%s", q, rr.Code, rr.Body.String())
+		}
+	}
+	if rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"timezone": "Nowhere"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("settings status=%d", rr.Code)
+	}
+}
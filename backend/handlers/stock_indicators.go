@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 指标接口的交易日数
+const (
+	defaultIndicatorDays = 120
+	maxIndicatorDays     = 500
+)
+
+// GetStockIndicators 股票技术指标序列（用于绘图）、最新值与信号
+// GET /api/v1/stocks/:code/indicators?days=120&narrative=1
+// 多取 services.IndicatorWarmupDays 个交易日预热，返回的序列只含最近 days 日；
+// narrative=1 时请大模型解读指标，需要 ai 权限（读请求默认只校验 read）
+func GetStockIndicators(c *gin.Context) {
+	code, _, ok := stockCodeParam(c)
+	if !ok {
+		return
+	}
+	days := defaultIndicatorDays
+	if d, err := strconv.Atoi(c.Query("days")); err == nil && d > 0 {
+		days = min(d, maxIndicatorDays)
+	}
+	withNarrative, _ := strconv.ParseBool(c.Query("narrative"))
+	if withNarrative && !requirePermission(c, models.PermAI) {
+		return
+	}
+
+	history, err := services.GetStockHistory(code, days+services.IndicatorWarmupDays)
+	if err != nil {
+		if errors.Is(err, services.ErrStockNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "未找到该股票的行情数据"})
+			return
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "获取行情失败: " + err.Error(), "code": "MARKET_DATA_UNAVAILABLE"})
+		return
+	}
+
+	ind := services.ComputeIndicators(history)
+	analysis := &services.StockAnalysis{
+		Indicators: ind.Latest(),
+		Signals:    services.IndicatorSignals(ind),
+	}
+	if analysis.Signals == nil {
+		analysis.Signals = []services.AnalysisSignal{}
+	}
+	if len(history) > days {
+		history = history[len(history)-days:]
+	}
+
+	stock := &services.StockInfo{Code: code}
+	if s := services.DefaultStockDirectory().Lookup(code); s != nil {
+		stock.Name = s.Name
+	}
+	if n := len(history); n > 0 {
+		stock.Price = history[n-1].Close
+		if n > 1 && history[n-2].Close > 0 {
+			stock.Change = history[n-1].Close - history[n-2].Close
+			stock.ChangePercent = stock.Change / history[n-2].Close * 100
+		}
+	}
+
+	resp := gin.H{
+		"code":       code,
+		"name":       stock.Name,
+		"days":       len(history),
+		"history":    history,
+		"indicators": ind.Tail(days),
+		"latest":     analysis.Indicators,
+		"signals":    analysis.Signals,
+	}
+	if withNarrative {
+		if !explainStockAnalysis(c, stock, analysis) {
+			return
+		}
+		resp["narrative"] = analysis.Narrative
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// explainStockAnalysis 请大模型解读指标并写入 analysis.Narrative；失败时写入错误响应并返回 false
+func explainStockAnalysis(c *gin.Context, stock *services.StockInfo, analysis *services.StockAnalysis) bool {
+	if analysis.Indicators == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "没有足够的行情数据用于解读"})
+		return false
+	}
+	llmService := llmServiceForRequest(c)
+	if !llmService.Configured() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请在模型设置中配置 API Key 启用 AI 解读", "code": "LLM_NOT_CONFIGURED"})
+		return false
+	}
+	narrative, _, err := llmService.ExplainStockIndicators(stock, analysis)
+	if err != nil {
+		if abortIfQuotaExceeded(c, err) {
+			return false
+		}
+		c.JSON(http.StatusBadGateway, gin.H{"error": "AI 解读失败: " + err.Error(), "code": "LLM_UNAVAILABLE"})
+		return false
+	}
+	analysis.Narrative = narrative
+	return true
+}
@@ -0,0 +1,171 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+	"memo-studio/backend/utils"
+)
+
+// useMarketFixture 用 200 个交易日的合成 K 线替换行情数据源
+func useMarketFixture(t *testing.T) {
+	t.Helper()
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := make([]services.StockHistory, 200)
+	for i := range history {
+		c := 1600 + 40*math.Sin(float64(i)/9) + float64(i)/2
+		history[i] = services.StockHistory{
+			Date: start.AddDate(0, 0, i).Format("2006-01-02"), Open: c - 2, Close: c, High: c + 5, Low: c - 6, Volume: 30000,
+		}
+	}
+	last := history[len(history)-1].Close
+	b, err := json.Marshal(services.MarketFixture{
+		Quote:   &services.StockInfo{Name: "贵州茅台", Price: last, Change: 8, ChangePercent: 0.5, PE: 28},
+		History: history,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "sh600519.json"), b, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	prev := services.GetMarketData()
+	services.SetMarketData(&services.FixtureMarketData{Dir: dir})
+	t.Cleanup(func() { services.SetMarketData(prev) })
+}
+
+func TestStockIndicatorsEndpoint(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+	useMarketFixture(t)
+
+	rr := doJSON(t, r, "GET", "/api/stocks/600519/indicators?days=30", auth, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("indicators status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Code       string                    `json:"code"`
+		Name       string                    `json:"name"`
+		Days       int                       `json:"days"`
+		History    []services.StockHistory   `json:"history"`
+		Indicators map[string]any            `json:"indicators"`
+		Latest     map[string]any            `json:"latest"`
+		Signals    []services.AnalysisSignal `json:"signals"`
+		Narrative  *string                   `json:"narrative"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != "600519" || resp.Name != "贵州茅台" || resp.Days != 30 || len(resp.History) != 30 || resp.Narrative != nil {
+		t.Fatalf("resp = %s", rr.Body.String())
+	}
+	dates, _ := resp.Indicators["dates"].([]any)
+	ma60, _ := resp.Indicators["ma60"].([]any)
+	if len(dates) != 30 || dates[0] != resp.History[0].Date || len(ma60) != 30 {
+		t.Fatalf("indicators = %v", resp.Indicators)
+	}
+	// 预热数据保证返回区间内的 MA60 与 MACD 都已有值
+	if ma60[0] == nil || resp.Latest["ma60"] == nil || resp.Latest["dif"] == nil || resp.Latest["rsi6"] == nil {
+		t.Fatalf("ma60[0]=%v latest=%v", ma60[0], resp.Latest)
+	}
+	for _, s := range resp.Signals {
+		if s.Key == "" || s.Tone == "" {
+			t.Fatalf("signal = %+v", s)
+		}
+	}
+
+	if rr := doJSON(t, r, "GET", "/api/stocks/abc/indicators", auth, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid code status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "GET", "/api/stocks/600036/indicators", auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("unknown stock status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStockIndicatorsNarrative(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+	useMarketFixture(t)
+	// 未配置模型：忽略运行环境中的 API Key
+	for _, name := range []string{"LLM_API_KEY", "OPENAI_API_KEY", "ANTHROPIC_API_KEY", "DEEPSEEK_API_KEY", "ZHIPU_API_KEY", "GEMINI_API_KEY"} {
+		t.Setenv(name, "")
+	}
+
+	rr := doJSON(t, r, "GET", "/api/stocks/600519/indicators?narrative=1", auth, nil)
+	var errResp map[string]any
+	_ = json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if rr.Code != http.StatusBadRequest || errResp["code"] != "LLM_NOT_CONFIGURED" {
+		t.Fatalf("unconfigured status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	srv, calls := fakeLLM(t, "均线多头排列，MACD 位于零轴上方，短线注意回调。", 40)
+	useFakeLLM(t, r, auth, srv.URL)
+
+	for i := 0; i < 2; i++ {
+		rr = doJSON(t, r, "GET", "/api/stocks/600519/indicators?narrative=1", auth, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("narrative status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var resp struct {
+			Narrative string `json:"narrative"`
+		}
+		_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp.Narrative != "均线多头排列，MACD 位于零轴上方，短线注意回调。" {
+			t.Fatalf("narrative = %q", resp.Narrative)
+		}
+	}
+	// 相同指标命中缓存
+	if *calls != 1 {
+		t.Fatalf("llm calls = %d", *calls)
+	}
+
+	rr = doJSON(t, r, "POST", "/api/stocks/analyze", auth, map[string]any{"code": "600519", "narrative": true})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("analyze status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var analyzed struct {
+		Analysis services.StockAnalysis `json:"analysis"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &analyzed); err != nil {
+		t.Fatal(err)
+	}
+	a := analyzed.Analysis
+	if a.Indicators == nil || a.Indicators.MA60 == nil || a.Narrative == "" {
+		t.Fatalf("analysis = %s", rr.Body.String())
+	}
+}
+
+func TestStockIndicatorsNarrativeRequiresAIPermission(t *testing.T) {
+	r, _, _ := setup(t)
+	useMarketFixture(t)
+	guest1, err := models.AdminCreateUser(models.CreateUserInput{Username: "guest1", Password: "guest12345", Role: models.RoleGuest})
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := utils.GenerateToken(guest1.ID, "guest1", models.RoleGuest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest := "Bearer " + token
+
+	if rr := doJSON(t, r, "GET", "/api/stocks/600519/indicators?days=10", guest, nil); rr.Code != http.StatusOK {
+		t.Fatalf("guest indicators status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr := doJSON(t, r, "GET", "/api/stocks/600519/indicators?narrative=1", guest, nil)
+	var errResp map[string]any
+	_ = json.Unmarshal(rr.Body.Bytes(), &errResp)
+	if rr.Code != http.StatusForbidden || errResp["permission"] != "ai" {
+		t.Fatalf("guest narrative status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "POST", "/api/stocks/analyze", guest, map[string]any{"code": "600519", "narrative": true}); rr.Code != http.StatusForbidden {
+		t.Fatalf("guest analyze status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
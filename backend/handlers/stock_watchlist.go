@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// watchlistEntry 自选股及（可选的）实时行情
+type watchlistEntry struct {
+	models.WatchlistItem
+	Quote *services.StockInfo `json:"quote,omitempty"`
+}
+
+// stockCodeParam 解析路径中的股票代码，无效时写入 400
+func stockCodeParam(c *gin.Context) (code, market string, ok bool) {
+	code, market, ok = services.NormalizeStockCode(c.Param("code"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的股票代码", "code": "INVALID_STOCK_CODE"})
+	}
+	return code, market, ok
+}
+
+// syncNoteStocks 新建、编辑笔记后按内容更新股票关联；失败不影响笔记保存，只记录日志，
+// 之后可通过 POST /stocks/mentions/rescan 补建
+func syncNoteStocks(userID int, note *models.Note) {
+	if _, err := services.SyncNoteStockMentions(userID, note, true); err != nil {
+		log.Printf("更新笔记 %d 的股票关联失败: %v", note.ID, err)
+	}
+}
+
+// ListWatchlist 当前用户的自选股，附带提到各股票的笔记数
+// GET /api/v1/stocks/watchlist?quotes=1（quotes=1 时附带实时行情，获取失败的不带 quote）
+func ListWatchlist(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	items, err := models.ListWatchlist(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取自选股失败: " + err.Error()})
+		return
+	}
+	withQuotes, _ := strconv.ParseBool(c.Query("quotes"))
+	quote := services.GetStockQuoter()
+	entries := make([]watchlistEntry, 0, len(items))
+	for _, it := range items {
+		e := watchlistEntry{WatchlistItem: it}
+		if withQuotes {
+			if info, err := quote(it.Market + it.Code); err == nil {
+				e.Quote = info
+			}
+		}
+		entries = append(entries, e)
+	}
+	c.JSON(http.StatusOK, gin.H{"items": entries, "total": len(entries)})
+}
+
+// AddWatchlistItem 加入自选；已在自选中时更新名称与备注
+// POST /api/v1/stocks/watchlist {"code":"600519","name":"贵州茅台","memo":"..."}
+// 未提供名称时使用内置名录中的名称；自选股名称同样用于识别笔记中提到的股票
+func AddWatchlistItem(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Code string `json:"code" binding:"required"`
+		Name string `json:"name"`
+		Memo string `json:"memo"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	code, market, ok := services.NormalizeStockCode(req.Code)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的股票代码", "code": "INVALID_STOCK_CODE"})
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		if s := services.DefaultStockDirectory().Lookup(code); s != nil {
+			name = s.Name
+		}
+	}
+	item, err := models.UpsertWatchlistItem(userID, code, market, name, strings.TrimSpace(req.Memo))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加入自选失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, item)
+}
+
+// RemoveWatchlistItem 移出自选（不影响笔记与股票的关联）
+// DELETE /api/v1/stocks/watchlist/:code
+func RemoveWatchlistItem(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	code, _, ok := stockCodeParam(c)
+	if !ok {
+		return
+	}
+	if err := models.DeleteWatchlistItem(userID, code); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "该股票不在自选中"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "移出自选失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// GetStockNotes 提到某只股票的笔记（投资日志），附带写笔记时的价格快照
+// GET /api/v1/stocks/:code/notes?limit=20&offset=0
+func GetStockNotes(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	code, market, ok := stockCodeParam(c)
+	if !ok {
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	notes, total, err := models.ListStockNotes(userID, code, limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取笔记失败: " + err.Error()})
+		return
+	}
+	item, err := models.GetWatchlistItem(userID, code)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取自选股失败: " + err.Error()})
+		return
+	}
+	name := ""
+	if item != nil {
+		name = item.Name
+	} else if s := services.DefaultStockDirectory().Lookup(code); s != nil {
+		name = s.Name
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"code":     code,
+		"market":   market,
+		"name":     name,
+		"watching": item != nil,
+		"notes":    notes,
+		"total":    total,
+	})
+}
+
+// GetNoteStocks 笔记提到的股票及写笔记时的价格快照
+// GET /api/v1/memos/:id/stocks
+func GetNoteStocks(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记 ID"})
+		return
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
+	stocks, err := models.ListNoteStocks(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取关联股票失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stocks": stocks})
+}
+
+// RescanStockMentions 按当前内容重新识别全部笔记提到的股票（如加入自选后补建关联）。
+// 补建的关联不保存价格快照：现在的价格并非写笔记时的价格
+// POST /api/v1/stocks/mentions/rescan
+func RescanStockMentions(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	notes, err := models.ListUnlockedNoteTexts(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取笔记失败: " + err.Error()})
+		return
+	}
+	linked, links := 0, 0
+	for i := range notes {
+		mentions, err := services.SyncNoteStockMentions(userID, &notes[i], false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新股票关联失败: " + err.Error()})
+			return
+		}
+		if len(mentions) > 0 {
+			linked++
+			links += len(mentions)
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"scanned": len(notes), "linked_notes": linked, "links": links})
+}
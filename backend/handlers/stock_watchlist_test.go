@@ -0,0 +1,194 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+)
+
+func stubStockQuoter(t *testing.T) *int32 {
+	t.Helper()
+	var calls int32
+	prev := services.GetStockQuoter()
+	services.SetStockQuoter(func(code string) (*services.StockInfo, error) {
+		atomic.AddInt32(&calls, 1)
+		switch code {
+		case "sh600519":
+			return &services.StockInfo{Code: "600519", Name: "贵州茅台", Price: 1680.5, ChangePercent: 1.2}, nil
+		case "sh600036":
+			return &services.StockInfo{Code: "600036", Name: "招商银行", Price: 35.2, ChangePercent: -0.4}, nil
+		}
+		return nil, fmt.Errorf("no quote for %s", code)
+	})
+	t.Cleanup(func() { services.SetStockQuoter(prev) })
+	return &calls
+}
+
+func waitNoteStocks(t *testing.T, noteID, quoted int) []models.NoteStock {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		stocks, err := models.ListNoteStocks(noteID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for _, s := range stocks {
+			if s.QuotedAt != nil {
+				n++
+			}
+		}
+		if n >= quoted {
+			return stocks
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("snapshots not saved: %+v", stocks)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestNoteStockLinksAndSnapshots(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+	calls := stubStockQuoter(t)
+
+	first := createMemoWithResources(t, r, auth, "$600519 今天加仓，招行观望")
+	stocks := waitNoteStocks(t, first, 2)
+	if len(stocks) != 2 || stocks[0].Code != "600519" || stocks[0].Source != models.StockSourceCode ||
+		*stocks[0].Price != 1680.5 || stocks[1].Code != "600036" || stocks[1].Source != models.StockSourceName {
+		t.Fatalf("stocks = %+v", stocks)
+	}
+	second := createMemoWithResources(t, r, auth, "贵州茅台 减仓")
+	waitNoteStocks(t, second, 1)
+
+	rr := doJSON(t, r, "GET", "/api/stocks/sh600519/notes", auth, nil)
+	var journal struct {
+		Code     string                  `json:"code"`
+		Name     string                  `json:"name"`
+		Watching bool                    `json:"watching"`
+		Notes    []models.StockNoteEntry `json:"notes"`
+		Total    int                     `json:"total"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &journal); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if rr.Code != http.StatusOK || journal.Code != "600519" || journal.Name != "贵州茅台" || journal.Watching ||
+		journal.Total != 2 || journal.Notes[0].NoteID != second || journal.Notes[1].Price == nil {
+		t.Fatalf("journal = %s", rr.Body.String())
+	}
+	if rr := doJSON(t, r, "GET", "/api/stocks/abc/notes", auth, nil); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid code status=%d", rr.Code)
+	}
+
+	// 编辑：不再提到的删除，仍提到的保留原快照，不重复获取行情
+	before := atomic.LoadInt32(calls)
+	rr = doJSON(t, r, "PUT", "/api/memos/"+itoa(first), auth, map[string]any{"content": "只留 $600519"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	stocks, _ = models.ListNoteStocks(first)
+	if len(stocks) != 1 || stocks[0].Code != "600519" || stocks[0].Price == nil || atomic.LoadInt32(calls) != before {
+		t.Fatalf("after update stocks = %+v calls=%d", stocks, atomic.LoadInt32(calls))
+	}
+
+	// 其他用户看不到
+	u2, err := models.CreateUser("stock2", "password1", "stock2@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	u2Auth := authHeader(t, u2.ID, u2.Username, false)
+	rr = doJSON(t, r, "GET", "/api/stocks/600519/notes", u2Auth, nil)
+	if err := json.Unmarshal(rr.Body.Bytes(), &journal); err != nil || journal.Total != 0 {
+		t.Fatalf("foreign journal = %s", rr.Body.String())
+	}
+	if rr := doJSON(t, r, "GET", "/api/memos/"+itoa(first)+"/stocks", u2Auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign note stocks status=%d", rr.Code)
+	}
+
+	// 删除笔记后关联一并删除
+	if rr := doJSON(t, r, "DELETE", "/api/memos/"+itoa(second), auth, nil); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d", rr.Code)
+	}
+	if stocks, _ := models.ListNoteStocks(second); len(stocks) != 0 {
+		t.Fatalf("links after delete = %+v", stocks)
+	}
+}
+
+func TestStockWatchlist(t *testing.T) {
+	r, adminID, _ := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+	stubStockQuoter(t)
+
+	rr := doJSON(t, r, "POST", "/api/stocks/watchlist", auth, map[string]any{"code": "600519.SS", "memo": "长期持有"})
+	var item models.WatchlistItem
+	if err := json.Unmarshal(rr.Body.Bytes(), &item); err != nil || rr.Code != http.StatusCreated {
+		t.Fatalf("add status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if item.Code != "600519" || item.Market != "sh" || item.Name != "贵州茅台" || item.Memo != "长期持有" {
+		t.Fatalf("item = %+v", item)
+	}
+	if rr := doJSON(t, r, "POST", "/api/stocks/watchlist", auth, map[string]any{"code": "12345"}); rr.Code != http.StatusBadRequest {
+		t.Fatalf("invalid add status=%d", rr.Code)
+	}
+
+	// 名录中没有的股票：自选股名称同样用于识别，补建关联不保存快照
+	note := createMemoWithResources(t, r, auth, "紫光国微的季报不错")
+	if stocks, _ := models.ListNoteStocks(note); len(stocks) != 0 {
+		t.Fatalf("unexpected links = %+v", stocks)
+	}
+	rr = doJSON(t, r, "POST", "/api/stocks/watchlist", auth, map[string]any{"code": "002049", "name": "紫光国微"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("add status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "POST", "/api/stocks/mentions/rescan", auth, nil)
+	var rescan struct {
+		Scanned     int `json:"scanned"`
+		LinkedNotes int `json:"linked_notes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &rescan); err != nil || rescan.LinkedNotes != 1 {
+		t.Fatalf("rescan = %s", rr.Body.String())
+	}
+	stocks, _ := models.ListNoteStocks(note)
+	if len(stocks) != 1 || stocks[0].Code != "002049" || stocks[0].Name != "紫光国微" || stocks[0].QuotedAt != nil {
+		t.Fatalf("rescanned links = %+v", stocks)
+	}
+
+	rr = doJSON(t, r, "GET", "/api/stocks/watchlist?quotes=1", auth, nil)
+	var list struct {
+		Items []struct {
+			models.WatchlistItem
+			Quote *services.StockInfo `json:"quote"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Items) != 2 {
+		t.Fatalf("list = %s", rr.Body.String())
+	}
+	if list.Items[0].Quote == nil || list.Items[0].Quote.Price != 1680.5 || list.Items[1].Quote != nil ||
+		list.Items[1].NoteCount != 1 || list.Items[1].LastNoteAt == nil {
+		t.Fatalf("list = %s", rr.Body.String())
+	}
+
+	// 其他用户的自选互不影响
+	u2, err := models.CreateUser("watch2", "password1", "watch2@example.com")
+	if err != nil {
+		t.Fatalf("CreateUser: %v", err)
+	}
+	u2Auth := authHeader(t, u2.ID, u2.Username, false)
+	if rr := doJSON(t, r, "DELETE", "/api/stocks/watchlist/600519", u2Auth, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("foreign delete status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "DELETE", "/api/stocks/watchlist/sh600519", auth, nil); rr.Code != http.StatusOK {
+		t.Fatalf("delete status=%d", rr.Code)
+	}
+	rr = doJSON(t, r, "GET", "/api/stocks/watchlist", auth, nil)
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Items) != 1 || list.Items[0].Code != "002049" {
+		t.Fatalf("list after delete = %s", rr.Body.String())
+	}
+}
@@ -89,9 +89,11 @@ func GetStockHistory(c *gin.Context) {
 
 // AnalyzeStock 分析股票
 // POST /api/stocks/analyze
+// {"code": "600519", "narrative": true}：narrative 为 true 时请大模型解读技术指标
 func AnalyzeStock(c *gin.Context) {
 	var req struct {
-		Code string `json:"code"`
+		Code      string `json:"code"`
+		Narrative bool   `json:"narrative"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -122,6 +124,9 @@ func AnalyzeStock(c *gin.Context) {
 
 	// 分析股票
 	analysis := services.AnalyzeStock(stock)
+	if req.Narrative && !explainStockAnalysis(c, stock, analysis) {
+		return
+	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"stock":    stock,
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SuggestTagsRequest 标签建议请求
+type SuggestTagsRequest struct {
+	Apply  bool `json:"apply"`   // 直接应用到笔记（来源标记为 ai）
+	MaxNew *int `json:"max_new"` // 新标签数量上限，默认 3
+}
+
+// SuggestNoteTags 为笔记建议标签（优先从已有标签中选择），可选直接应用
+// POST /api/v1/notes/:id/suggest-tags
+func SuggestNoteTags(c *gin.Context) {
+	id, userID, ok := noteIDParam(c)
+	if !ok {
+		return
+	}
+	var req SuggestTagsRequest
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+			return
+		}
+	}
+	maxNew := services.MaxNewTagSuggestions
+	if req.MaxNew != nil {
+		if *req.MaxNew < 0 || *req.MaxNew > services.MaxNewTagSuggestions {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "max_new 取值范围为 0-3"})
+			return
+		}
+		maxNew = *req.MaxNew
+	}
+	// 应用建议会修改笔记，需要写权限
+	if req.Apply && !requirePermission(c, models.PermWrite) {
+		return
+	}
+
+	note, err := models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
+		return
+	}
+	if note.Locked {
+		c.JSON(http.StatusLocked, gin.H{"error": "加密笔记不支持 AI 打标", "code": "VAULT_LOCKED"})
+		return
+	}
+
+	suggestions, provider, err := services.SuggestNoteTags(llmServiceForRequest(c), userID, note, maxNew)
+	if err != nil {
+		if abortIfQuotaExceeded(c, err) {
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成标签建议失败: " + err.Error()})
+		return
+	}
+	if provider == "" {
+		provider = basicInsightProvider
+	}
+
+	resp := gin.H{"suggestions": suggestions, "provider": provider}
+	if req.Apply {
+		applied, err := services.ApplyTagSuggestions(userID, id, suggestions)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "应用标签失败: " + err.Error()})
+			return
+		}
+		resp["applied"] = applied
+	}
+	c.JSON(http.StatusOK, resp)
+}
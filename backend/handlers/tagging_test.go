@@ -0,0 +1,104 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+)
+
+type suggestTagsResponse struct {
+	Suggestions []struct {
+		Name     string `json:"name"`
+		TagID    int    `json:"tag_id"`
+		Existing bool   `json:"existing"`
+	} `json:"suggestions"`
+	Provider string       `json:"provider"`
+	Applied  []models.Tag `json:"applied"`
+}
+
+func TestSuggestTagsConstrainedToVocabulary(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	// 已有标签 "读书"；模型建议的 "不存在的旧标签" 不在词表中应被丢弃，新标签最多 max_new 个
+	srv, _ := fakeLLM(t, `{"existing":["读书","不存在的旧标签"],"new":["阅读笔记","小说","历史"]}`, 10)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": "今天读完一本小说", "tags": []string{"读书"}})
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+	id := itoa(note.ID)
+
+	rr = doJSON(t, r, "POST", "/api/notes/"+id+"/suggest-tags", admin, map[string]any{"max_new": 1})
+	var resp suggestTagsResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || len(resp.Suggestions) != 2 || resp.Provider != "lmstudio" {
+		t.Fatalf("suggest status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if s := resp.Suggestions[0]; s.Name != "读书" || !s.Existing || s.TagID == 0 {
+		t.Fatalf("existing suggestion=%+v", s)
+	}
+	if s := resp.Suggestions[1]; s.Name != "阅读笔记" || s.Existing {
+		t.Fatalf("new suggestion=%+v", s)
+	}
+
+	// 应用：已有的 "读书" 保持手动来源，新标签标记为 ai
+	rr = doJSON(t, r, "POST", "/api/notes/"+id+"/suggest-tags", admin, map[string]any{"max_new": 1, "apply": true})
+	resp = suggestTagsResponse{}
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || len(resp.Applied) != 1 || resp.Applied[0].Name != "阅读笔记" {
+		t.Fatalf("apply status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "GET", "/api/notes/"+id, admin, nil)
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+	sources := map[string]string{}
+	for _, tag := range note.Tags {
+		sources[tag.Name] = tag.Source
+	}
+	if sources["读书"] != "manual" || sources["阅读笔记"] != "ai" {
+		t.Fatalf("tag sources=%v", sources)
+	}
+}
+
+func TestSuggestTagsKeywordFallbackAndAutoTag(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	// 未配置模型：本地规则按主题关键词建议
+	rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": "项目会议记录，明天继续推进任务"})
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+	rr = doJSON(t, r, "POST", "/api/notes/"+itoa(note.ID)+"/suggest-tags", admin, nil)
+	var resp suggestTagsResponse
+	_ = json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.Provider != "basic" || len(resp.Suggestions) != 1 || resp.Suggestions[0].Name != "工作" {
+		t.Fatalf("fallback status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 开启自动打标后，新建笔记在后台应用建议
+	if rr := doJSON(t, r, "PUT", "/api/users/me/settings", admin, map[string]any{"auto_tag": true}); rr.Code != http.StatusOK {
+		t.Fatalf("settings status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"content": "晚上去运动，注意健康"})
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		rr := doJSON(t, r, "GET", "/api/notes/"+itoa(note.ID), admin, nil)
+		var n models.Note
+		_ = json.Unmarshal(rr.Body.Bytes(), &n)
+		if len(n.Tags) == 1 {
+			if n.Tags[0].Name != "健康" || n.Tags[0].Source != "ai" {
+				t.Fatalf("auto tags=%+v", n.Tags)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("auto tag not applied: %s", rr.Body.String())
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
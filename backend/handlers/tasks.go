@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// UpdateTaskRequest 更新任务请求
+type UpdateTaskRequest struct {
+	Done *bool `json:"done" binding:"required"`
+}
+
+// ListTasks 列出笔记中的任务（默认只列未完成）
+// GET /api/v1/tasks?status=open|done|all&note_id=1&due_before=2026-11-01&due_after=...&has_due=true&overdue=true
+func ListTasks(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	limit, offset := models.ParseLimitOffset(c.Query("limit"), c.Query("offset"))
+	q := models.TaskQuery{
+		UserID: userID,
+		Status: strings.TrimSpace(c.Query("status")),
+		Limit:  limit,
+		Offset: offset,
+	}
+	switch q.Status {
+	case "", "open", "done", "all":
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status 只能是 open、done 或 all"})
+		return
+	}
+	if v := strings.TrimSpace(c.Query("note_id")); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记ID"})
+			return
+		}
+		q.NoteID = id
+	}
+	for _, p := range []struct {
+		name string
+		dst  *string
+	}{{"due_before", &q.DueBefore}, {"due_after", &q.DueAfter}} {
+		v := strings.TrimSpace(c.Query(p.name))
+		if v == "" {
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", v); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": p.name + " 格式应为 YYYY-MM-DD"})
+			return
+		}
+		*p.dst = v
+	}
+	hasDue, err := models.ParseBoolParam(c.Query("has_due"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "has_due 参数格式错误"})
+		return
+	}
+	q.HasDue = hasDue
+	// 已逾期：未完成且截止日期早于今天
+	if c.Query("overdue") == "true" {
+		q.Status = "open"
+		q.DueBefore = time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+	}
+
+	tasks, err := models.ListTasks(q)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取任务失败: " + err.Error()})
+		return
+	}
+	if tasks == nil {
+		tasks = []models.Task{}
+	}
+	c.JSON(http.StatusOK, tasks)
+}
+
+// GetTask 获取单个任务
+// GET /api/v1/tasks/:id
+func GetTask(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return
+	}
+	task, err := models.GetTask(id, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取任务失败: " + err.Error()})
+		return
+	}
+	if task == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
+
+// UpdateTask 勾选/取消勾选任务，同步改写笔记中的复选框
+// PATCH /api/v1/tasks/:id
+func UpdateTask(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的任务ID"})
+		return
+	}
+	var req UpdateTaskRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+
+	task, err := models.SetTaskDone(id, userID, *req.Done)
+	switch {
+	case errors.Is(err, models.ErrTaskNoteLocked):
+		c.JSON(http.StatusLocked, gin.H{"error": err.Error(), "code": "VAULT_LOCKED"})
+		return
+	case errors.Is(err, models.ErrTaskOutOfSync):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "code": "TASK_OUT_OF_SYNC"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新任务失败: " + err.Error()})
+		return
+	case task == nil:
+		c.JSON(http.StatusNotFound, gin.H{"error": "任务不存在"})
+		return
+	}
+	c.JSON(http.StatusOK, task)
+}
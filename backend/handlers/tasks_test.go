@@ -0,0 +1,72 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"memo-studio/backend/models"
+)
+
+func TestTasksParsedFromNotesAndToggled(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	content := "# plan\n- [ ] write report @due(2026-11-01)\n- [x] book flight\n```\n- [ ] not a task\n```\n* [ ] call mom"
+	rr := doJSON(t, r, "POST", "/api/memos", admin, map[string]any{"title": "plan", "content": content})
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+
+	listTasks := func(query string) []models.Task {
+		t.Helper()
+		rr := doJSON(t, r, "GET", "/api/tasks"+query, admin, nil)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("list tasks status=%d body=%s", rr.Code, rr.Body.String())
+		}
+		var tasks []models.Task
+		_ = json.Unmarshal(rr.Body.Bytes(), &tasks)
+		return tasks
+	}
+
+	open := listTasks("")
+	if len(open) != 2 || open[0].Text != "write report" || open[0].DueDate == nil || *open[0].DueDate != "2026-11-01" || open[0].Line != 2 {
+		t.Fatalf("open tasks=%+v", open)
+	}
+	if open[1].Text != "call mom" || open[1].NoteTitle != "plan" {
+		t.Fatalf("open tasks=%+v", open)
+	}
+	if all := listTasks("?status=all"); len(all) != 3 {
+		t.Fatalf("all tasks=%+v", all)
+	}
+	if due := listTasks("?due_before=2026-10-31"); len(due) != 0 {
+		t.Fatalf("due_before tasks=%+v", due)
+	}
+
+	// 勾选任务会改写笔记内容，并保留任务 id
+	taskID := open[0].ID
+	rr = doJSON(t, r, "PATCH", "/api/tasks/"+itoa(taskID), admin, map[string]any{"done": true})
+	var task models.Task
+	_ = json.Unmarshal(rr.Body.Bytes(), &task)
+	if rr.Code != http.StatusOK || !task.Done || task.ID != taskID {
+		t.Fatalf("toggle status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	rr = doJSON(t, r, "GET", "/api/notes/"+itoa(note.ID), admin, nil)
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+	want := "# plan\n- [x] write report @due(2026-11-01)\n- [x] book flight\n```\n- [ ] not a task\n```\n* [ ] call mom"
+	if note.Content != want {
+		t.Fatalf("note content=%q", note.Content)
+	}
+
+	// 编辑笔记后重新同步：删除的任务消失，新任务出现
+	rr = doJSON(t, r, "PUT", "/api/memos/"+itoa(note.ID), admin, map[string]any{"title": "plan", "content": "- [ ] call mom\n- [ ] buy milk"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update status=%d", rr.Code)
+	}
+	open = listTasks("?note_id=" + itoa(note.ID))
+	if len(open) != 2 || open[0].Text != "call mom" || open[0].Line != 1 || open[1].Text != "buy milk" {
+		t.Fatalf("tasks after edit=%+v", open)
+	}
+	if rr := doJSON(t, r, "GET", "/api/tasks/"+itoa(taskID), admin, nil); rr.Code != http.StatusNotFound {
+		t.Fatalf("removed task status=%d", rr.Code)
+	}
+}
@@ -0,0 +1,267 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type UpdateLLMQuotaRequest struct {
+	DailyTokens   *int64 `json:"daily_tokens"`   // 0 表示不限
+	MonthlyTokens *int64 `json:"monthly_tokens"` // 0 表示不限
+}
+
+// abortIfQuotaExceeded 配额超限时返回 429；其余错误交给调用方处理
+func abortIfQuotaExceeded(c *gin.Context, err error) bool {
+	var qe *services.QuotaExceededError
+	if !errors.As(err, &qe) {
+		return false
+	}
+	retry := int(time.Until(qe.ResetAt).Seconds()) + 1
+	if retry < 1 {
+		retry = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(retry))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":    qe.Error(),
+		"code":     "LLM_QUOTA_EXCEEDED",
+		"period":   qe.Period,
+		"limit":    qe.Limit,
+		"used":     qe.Used,
+		"reset_at": qe.ResetAt,
+	})
+	return true
+}
+
+// usageRange 解析 from/to（YYYY-MM-DD，含 to 当天），默认本月至今
+func usageRange(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now()
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+	if v := strings.TrimSpace(c.Query("from")); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from 格式应为 YYYY-MM-DD"})
+			return from, to, false
+		}
+		from = t
+	}
+	if v := strings.TrimSpace(c.Query("to")); v != "" {
+		t, err := time.ParseInLocation("2006-01-02", v, now.Location())
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to 格式应为 YYYY-MM-DD"})
+			return from, to, false
+		}
+		to = t.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "to 必须晚于 from"})
+		return from, to, false
+	}
+	return from, to, true
+}
+
+// GetMyUsage 我的 AI 用量与配额
+// GET /api/v1/users/me/usage?from=2024-01-01&to=2024-01-31
+func GetMyUsage(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	from, to, ok := usageRange(c)
+	if !ok {
+		return
+	}
+	_, offset := time.Now().Zone()
+
+	totals, err := models.GetUsageTotals(&userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	byDay, err := models.GetUsageByDay(&userID, from, to, time.Duration(offset)*time.Second)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	byModel, err := models.GetUsageByModel(&userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	byEndpoint, err := models.GetUsageByEndpoint(&userID, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	quota, err := services.GetLLMQuotaStatus(userID, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配额失败: " + err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from,
+		"to":          to,
+		"totals":      totals,
+		"by_day":      byDay,
+		"by_model":    byModel,
+		"by_endpoint": byEndpoint,
+		"quota":       quota,
+	})
+}
+
+// AdminUsageReport 全实例 AI 用量报表
+// GET /api/v1/admin/llm/usage?from=2024-01-01&to=2024-01-31
+func AdminUsageReport(c *gin.Context) {
+	from, to, ok := usageRange(c)
+	if !ok {
+		return
+	}
+	totals, err := models.GetUsageTotals(nil, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	byUser, err := models.GetUsageByUser(from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	byModel, err := models.GetUsageByModel(nil, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	byEndpoint, err := models.GetUsageByEndpoint(nil, from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计用量失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"from":        from,
+		"to":          to,
+		"totals":      totals,
+		"by_user":     byUser,
+		"by_model":    byModel,
+		"by_endpoint": byEndpoint,
+	})
+}
+
+// AdminGetLLMQuota 默认配额与用户级覆盖
+// GET /api/v1/admin/llm/quota
+func AdminGetLLMQuota(c *gin.Context) {
+	def, err := models.GetDefaultLLMQuota()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配额失败: " + err.Error()})
+		return
+	}
+	overrides, err := models.ListLLMQuotaOverrides()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配额失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"default": def, "overrides": overrides})
+}
+
+// AdminSetLLMQuota 修改实例默认配额
+// PUT /api/v1/admin/llm/quota
+func AdminSetLLMQuota(c *gin.Context) {
+	var req UpdateLLMQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	q, err := models.GetDefaultLLMQuota()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配额失败: " + err.Error()})
+		return
+	}
+	if req.DailyTokens != nil {
+		q.DailyTokens = *req.DailyTokens
+	}
+	if req.MonthlyTokens != nil {
+		q.MonthlyTokens = *req.MonthlyTokens
+	}
+	if q.DailyTokens < 0 || q.MonthlyTokens < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配额不能为负数"})
+		return
+	}
+	if err := models.SetDefaultLLMQuota(q); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配额失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, q)
+}
+
+// AdminSetUserLLMQuota 设置用户级配额覆盖；字段为 null 表示沿用默认值
+// PUT /api/v1/admin/llm/quota/users/:id
+func AdminSetUserLLMQuota(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+		return
+	}
+	var req UpdateLLMQuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if (req.DailyTokens != nil && *req.DailyTokens < 0) || (req.MonthlyTokens != nil && *req.MonthlyTokens < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "配额不能为负数"})
+		return
+	}
+	if u, err := models.GetUserByID(id); err != nil || u == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+		return
+	}
+	if err := models.SetLLMQuotaOverride(id, req.DailyTokens, req.MonthlyTokens); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存配额失败: " + err.Error()})
+		return
+	}
+	quota, err := services.GetLLMQuotaStatus(id, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取配额失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"user_id": id, "quota": quota})
+}
+
+// AdminLLMCacheStats 大模型响应缓存统计
+// GET /api/v1/admin/llm/cache
+func AdminLLMCacheStats(c *gin.Context) {
+	stats, err := models.GetLLMCacheStats(time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取缓存统计失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"stats": stats, "ttl_seconds": int64(services.LLMCacheTTL().Seconds())})
+}
+
+// AdminPurgeLLMCache 清除大模型响应缓存
+// DELETE /api/v1/admin/llm/cache?user_id=2&expired=true
+func AdminPurgeLLMCache(c *gin.Context) {
+	var userID *int
+	if v := strings.TrimSpace(c.Query("user_id")); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "无效的用户ID"})
+			return
+		}
+		userID = &id
+	}
+	expiredOnly := c.Query("expired") == "true" || c.Query("expired") == "1"
+	n, err := models.PurgeLLMCache(userID, expiredOnly, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "清除缓存失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "缓存已清除", "purged": n})
+}
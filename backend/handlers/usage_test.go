@@ -0,0 +1,136 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// fakeLLM OpenAI 兼容的假模型服务，每次调用返回固定内容与 token 用量
+func fakeLLM(t *testing.T, content string, totalTokens int) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"model":   "fake-model",
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": content}}},
+			"usage": map[string]any{
+				"prompt_tokens": totalTokens - 5, "completion_tokens": 5, "total_tokens": totalTokens,
+			},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+// useFakeLLM 为用户创建指向假模型服务的启用配置（本地类型，无需 API Key）
+func useFakeLLM(t *testing.T, r http.Handler, auth, baseURL string) {
+	t.Helper()
+	rr := doJSON(t, r, "POST", "/api/llm/profiles", auth, map[string]any{
+		"provider": "lmstudio", "base_url": baseURL, "model": "fake-model", "active": true,
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create llm profile status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLLMUsageRecordedAndQuotaEnforced(t *testing.T) {
+	r, adminID, _ := setup(t)
+	admin := authHeader(t, adminID, "admin", true)
+
+	srv, calls := fakeLLM(t, `{"summary":"ok","highlights":[],"action_items":[]}`, 25)
+	useFakeLLM(t, r, admin, srv.URL)
+
+	if rr := doJSON(t, r, "PUT", "/api/admin/llm/quota/users/"+itoa(adminID), admin, map[string]any{"daily_tokens": 30}); rr.Code != http.StatusOK {
+		t.Fatalf("set quota status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	for i := 0; i < 2; i++ {
+		if rr := doJSON(t, r, "POST", "/api/summarize", admin, map[string]any{"content": "note " + itoa(i)}); rr.Code != http.StatusOK {
+			t.Fatalf("summarize %d status=%d body=%s", i, rr.Code, rr.Body.String())
+		}
+	}
+	rr := doJSON(t, r, "POST", "/api/summarize", admin, map[string]any{"content": "note 3"})
+	if rr.Code != http.StatusTooManyRequests || rr.Header().Get("Retry-After") == "" {
+		t.Fatalf("over quota status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var quotaErr struct {
+		Code   string `json:"code"`
+		Period string `json:"period"`
+		Limit  int64  `json:"limit"`
+		Used   int64  `json:"used"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &quotaErr)
+	if quotaErr.Code != "LLM_QUOTA_EXCEEDED" || quotaErr.Period != "daily" || quotaErr.Limit != 30 || quotaErr.Used != 50 {
+		t.Fatalf("quota error=%s", rr.Body.String())
+	}
+	if *calls != 2 {
+		t.Fatalf("llm calls=%d", *calls)
+	}
+
+	rr = doJSON(t, r, "GET", "/api/users/me/usage", admin, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("usage status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var usage struct {
+		Totals struct {
+			Calls        int   `json:"calls"`
+			PromptTokens int64 `json:"prompt_tokens"`
+			TotalTokens  int64 `json:"total_tokens"`
+		} `json:"totals"`
+		ByEndpoint []struct {
+			Key   string `json:"key"`
+			Calls int    `json:"calls"`
+		} `json:"by_endpoint"`
+		ByModel []struct {
+			Key string `json:"key"`
+		} `json:"by_model"`
+		ByDay []struct {
+			Key string `json:"key"`
+		} `json:"by_day"`
+		Quota struct {
+			Daily struct {
+				Limit     int64 `json:"limit"`
+				Remaining int64 `json:"remaining"`
+			} `json:"daily"`
+		} `json:"quota"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &usage)
+	if usage.Totals.Calls != 2 || usage.Totals.TotalTokens != 50 || usage.Totals.PromptTokens != 40 {
+		t.Fatalf("totals=%s", rr.Body.String())
+	}
+	if len(usage.ByEndpoint) != 1 || usage.ByEndpoint[0].Key != "POST /summarize" || usage.ByEndpoint[0].Calls != 2 {
+		t.Fatalf("by_endpoint=%s", rr.Body.String())
+	}
+	if len(usage.ByModel) != 1 || usage.ByModel[0].Key != "lmstudio/fake-model" || len(usage.ByDay) != 1 {
+		t.Fatalf("breakdown=%s", rr.Body.String())
+	}
+	if usage.Quota.Daily.Limit != 30 || usage.Quota.Daily.Remaining != 0 {
+		t.Fatalf("quota=%s", rr.Body.String())
+	}
+
+	rr = doJSON(t, r, "GET", "/api/admin/llm/usage", admin, nil)
+	var report struct {
+		ByUser []struct {
+			UserID      int    `json:"user_id"`
+			Username    string `json:"username"`
+			TotalTokens int64  `json:"total_tokens"`
+		} `json:"by_user"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &report)
+	if rr.Code != http.StatusOK || len(report.ByUser) != 1 || report.ByUser[0].Username != "admin" || report.ByUser[0].TotalTokens != 50 {
+		t.Fatalf("admin report status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	// 取消覆盖后恢复默认（不限）
+	if rr := doJSON(t, r, "PUT", "/api/admin/llm/quota/users/"+itoa(adminID), admin, map[string]any{"daily_tokens": nil}); rr.Code != http.StatusOK {
+		t.Fatalf("reset quota status=%d", rr.Code)
+	}
+	if rr := doJSON(t, r, "POST", "/api/summarize", admin, map[string]any{"content": "note"}); rr.Code != http.StatusOK {
+		t.Fatalf("summarize after reset status=%d body=%s", rr.Code, rr.Body.String())
+	}
+}
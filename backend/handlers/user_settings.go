@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetMySettings 获取当前用户设置
+// GET /api/v1/users/me/settings
+func GetMySettings(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	st, err := models.GetUserSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取设置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
+
+// UpdateMySettingsRequest 字段为 null 表示保持不变
+type UpdateMySettingsRequest struct {
+	AutoSummarize         *bool `json:"auto_summarize"`
+	AutoSummarizeMinChars *int  `json:"auto_summarize_min_chars"`
+	AutoTag               *bool `json:"auto_tag"`
+
+	Timezone *string `json:"timezone"`
+
+	DigestWeekly   *bool   `json:"digest_weekly"`
+	DigestMonthly  *bool   `json:"digest_monthly"`
+	DigestTimezone *string `json:"digest_timezone"`
+	DigestHour     *int    `json:"digest_hour"`
+	DigestWeekday  *int    `json:"digest_weekday"`
+	DigestMonthDay *int    `json:"digest_month_day"`
+	DigestAI       *bool   `json:"digest_ai"`
+	DigestWebhook  *string `json:"digest_webhook"`
+}
+
+// UpdateMySettings 更新当前用户设置
+// PUT /api/v1/users/me/settings
+func UpdateMySettings(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req UpdateMySettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	st, err := models.GetUserSettings(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取设置失败: " + err.Error()})
+		return
+	}
+	if req.AutoSummarize != nil {
+		st.AutoSummarize = *req.AutoSummarize
+	}
+	if req.AutoSummarizeMinChars != nil {
+		if *req.AutoSummarizeMinChars < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "auto_summarize_min_chars 不能为负数"})
+			return
+		}
+		st.AutoSummarizeMinChars = *req.AutoSummarizeMinChars
+	}
+	if req.AutoTag != nil {
+		st.AutoTag = *req.AutoTag
+	}
+	if req.Timezone != nil {
+		tz := strings.TrimSpace(*req.Timezone)
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时区: " + tz})
+				return
+			}
+		}
+		st.Timezone = tz
+	}
+	if req.DigestWeekly != nil {
+		st.DigestWeekly = *req.DigestWeekly
+	}
+	if req.DigestMonthly != nil {
+		st.DigestMonthly = *req.DigestMonthly
+	}
+	if req.DigestTimezone != nil {
+		tz := strings.TrimSpace(*req.DigestTimezone)
+		if tz != "" {
+			if _, err := time.LoadLocation(tz); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "无效的时区: " + tz})
+				return
+			}
+		}
+		st.DigestTimezone = tz
+	}
+	if req.DigestHour != nil {
+		if *req.DigestHour < 0 || *req.DigestHour > 23 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "digest_hour 应在 0-23 之间"})
+			return
+		}
+		st.DigestHour = *req.DigestHour
+	}
+	if req.DigestWeekday != nil {
+		if *req.DigestWeekday < 0 || *req.DigestWeekday > 6 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "digest_weekday 应在 0-6 之间（0=周日）"})
+			return
+		}
+		st.DigestWeekday = *req.DigestWeekday
+	}
+	if req.DigestMonthDay != nil {
+		if *req.DigestMonthDay < 1 || *req.DigestMonthDay > 28 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "digest_month_day 应在 1-28 之间"})
+			return
+		}
+		st.DigestMonthDay = *req.DigestMonthDay
+	}
+	if req.DigestAI != nil {
+		st.DigestAI = *req.DigestAI
+	}
+	if req.DigestWebhook != nil {
+		webhook := strings.TrimSpace(*req.DigestWebhook)
+		if webhook != "" {
+			if err := services.ValidateWebhookURL(webhook); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		st.DigestWebhook = webhook
+	}
+	if err := models.SaveUserSettings(userID, st); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设置失败: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, st)
+}
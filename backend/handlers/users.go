@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"database/sql"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
@@ -26,12 +27,14 @@ type AdminCreateUserRequest struct {
 	Password string `json:"password" binding:"required,min=6,max=100"`
 	Email    string `json:"email" binding:"max=200"`
 	IsAdmin  bool   `json:"is_admin"`
+	Role     string `json:"role"` // 优先于 is_admin
 }
 
 type AdminUpdateUserRequest struct {
 	Username string `json:"username" binding:"required,min=3,max=50"`
 	Email    string `json:"email" binding:"max=200"`
-	IsAdmin  bool   `json:"is_admin"`
+	IsAdmin  *bool  `json:"is_admin"` // 兼容旧客户端：true 设为 admin，false 将 admin 降为 editor
+	Role     string `json:"role"`     // 优先于 is_admin；都不传时保持原角色
 }
 
 func GetMe(c *gin.Context) {
@@ -69,6 +72,8 @@ func UpdateMe(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败: " + err.Error()})
 		return
 	}
+	// 邮箱变更后重新发送验证邮件
+	_ = sendVerificationEmail(user)
 	c.JSON(http.StatusOK, user)
 }
 
@@ -120,6 +125,7 @@ func AdminCreateUser(c *gin.Context) {
 		Password: req.Password,
 		Email:    req.Email,
 		IsAdmin:  req.IsAdmin,
+		Role:     req.Role,
 	})
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") {
@@ -144,12 +150,33 @@ func AdminUpdateUser(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
 		return
 	}
-	user, err := models.AdminUpdateUser(id, req.Username, req.Email, req.IsAdmin)
+	role := req.Role
+	if role == "" && req.IsAdmin != nil {
+		current, err := models.GetUserByID(id)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "用户不存在"})
+			return
+		}
+		if *req.IsAdmin {
+			role = models.RoleAdmin
+		} else if current.Role == models.RoleAdmin {
+			role = models.RoleEditor
+		}
+	}
+	if role != "" && !models.IsValidRole(role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的角色: " + role})
+		return
+	}
+	user, err := models.AdminUpdateUser(id, req.Username, req.Email, role)
 	if err != nil {
 		if strings.Contains(err.Error(), "UNIQUE") {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "用户名已存在"})
 			return
 		}
+		if errors.Is(err, models.ErrLastAdmin) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "更新用户失败: " + err.Error()})
 		return
 	}
@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+	"memo-studio/backend/utils"
+
+	"github.com/gin-gonic/gin"
+)
+
+// VaultTokenHeader 解锁令牌请求头（由 POST /vault/unlock 返回）
+const VaultTokenHeader = "X-Vault-Token"
+
+type VaultPassphraseRequest struct {
+	Passphrase string `json:"passphrase" binding:"required,min=8,max=200"`
+}
+
+type ChangeVaultPassphraseRequest struct {
+	OldPassphrase string `json:"old_passphrase" binding:"required"`
+	NewPassphrase string `json:"new_passphrase" binding:"required,min=8,max=200"`
+	RotateKey     bool   `json:"rotate_key"` // 同时轮换数据密钥并重新加密全部笔记/附件
+}
+
+// vaultDataKey 从 X-Vault-Token 获取当前用户的数据密钥；失败时写入响应
+func vaultDataKey(c *gin.Context, userID int) (string, bool) {
+	sess, ok := services.GetVaultSession(strings.TrimSpace(c.GetHeader(VaultTokenHeader)), userID)
+	if !ok {
+		c.JSON(http.StatusLocked, gin.H{"error": "加密内容已锁定，请先解锁", "code": "VAULT_LOCKED"})
+		return "", false
+	}
+	return sess.DataKey, true
+}
+
+// optionalVaultDataKey 请求携带了有效解锁令牌时返回数据密钥（不写响应）
+func optionalVaultDataKey(c *gin.Context, userID int) (string, bool) {
+	sess, ok := services.GetVaultSession(strings.TrimSpace(c.GetHeader(VaultTokenHeader)), userID)
+	if !ok {
+		return "", false
+	}
+	return sess.DataKey, true
+}
+
+// sealNoteContentIfLocked 加密笔记在保存前重新加密内容；未加密笔记原样返回
+func sealNoteContentIfLocked(c *gin.Context, noteID, userID int, content string) (string, bool, bool) {
+	locked, err := models.IsNoteLocked(noteID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+		return "", false, false
+	}
+	if !locked {
+		return content, false, true
+	}
+	key, ok := vaultDataKey(c, userID)
+	if !ok {
+		return "", true, false
+	}
+	sealed, err := services.EncryptNoteContent(content, key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+		return "", true, false
+	}
+	return sealed, true, true
+}
+
+// openLockedNote 用会话密钥解密笔记内容
+func openLockedNote(note *models.Note, dataKey string) error {
+	ciphertext, err := models.GetNoteCiphertext(note.ID)
+	if err != nil {
+		return err
+	}
+	plaintext, err := services.DecryptNoteContent(ciphertext, dataKey)
+	if err != nil {
+		return err
+	}
+	note.Content = plaintext
+	return nil
+}
+
+// GetVaultStatus GET /api/vault
+func GetVaultStatus(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	v, err := models.GetUserVault(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询密钥库失败: " + err.Error()})
+		return
+	}
+	_, unlocked := optionalVaultDataKey(c, userID)
+	resp := gin.H{
+		"configured": v != nil,
+		"unlocked":   unlocked,
+	}
+	if v != nil {
+		resp["key_version"] = v.KeyVersion
+		resp["updated_at"] = v.UpdatedAt
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// SetupVault 初始化加密口令
+// POST /api/vault
+func SetupVault(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req VaultPassphraseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	if v, err := models.GetUserVault(userID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询密钥库失败: " + err.Error()})
+		return
+	} else if v != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "已设置加密口令，如需修改请使用 PUT /vault/passphrase"})
+		return
+	}
+
+	dataKey, err := services.NewDataKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+	salt, err := services.NewVaultSalt()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+	wrapped, err := services.WrapDataKey(dataKey, req.Passphrase, salt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+	if _, err := models.CreateUserVault(userID, salt, wrapped); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存密钥库失败: " + err.Error()})
+		return
+	}
+
+	sess, err := services.OpenVaultSession(userID, dataKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建解锁会话失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{
+		"success":     true,
+		"vault_token": sess.Token,
+		"expires_at":  sess.ExpiresAt,
+	})
+}
+
+// UnlockVault 解锁：校验口令并返回会话令牌（后续请求通过 X-Vault-Token 携带）
+// POST /api/vault/unlock
+func UnlockVault(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req struct {
+		Passphrase string `json:"passphrase" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	v, err := models.GetUserVault(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询密钥库失败: " + err.Error()})
+		return
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "尚未设置加密口令"})
+		return
+	}
+	dataKey, err := services.UnwrapDataKey(v.WrappedKey, req.Passphrase, v.Salt)
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "口令错误"})
+		return
+	}
+	sess, err := services.OpenVaultSession(userID, dataKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建解锁会话失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"vault_token": sess.Token,
+		"expires_at":  sess.ExpiresAt,
+	})
+}
+
+// LockVault 结束当前解锁会话
+// POST /api/vault/lock
+func LockVault(c *gin.Context) {
+	services.CloseVaultSession(strings.TrimSpace(c.GetHeader(VaultTokenHeader)))
+	c.JSON(http.StatusOK, gin.H{"success": true})
+}
+
+// ChangeVaultPassphrase 修改加密口令（可选轮换数据密钥）
+// PUT /api/vault/passphrase
+func ChangeVaultPassphrase(c *gin.Context) {
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	var req ChangeVaultPassphraseRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请求参数错误: " + err.Error()})
+		return
+	}
+	v, err := models.GetUserVault(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "查询密钥库失败: " + err.Error()})
+		return
+	}
+	if v == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "尚未设置加密口令"})
+		return
+	}
+	oldKey, err := services.UnwrapDataKey(v.WrappedKey, req.OldPassphrase, v.Salt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "旧口令不正确"})
+		return
+	}
+
+	salt, err := services.NewVaultSalt()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+
+	newKey := oldKey
+	if req.RotateKey {
+		if newKey, err = services.NewDataKey(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+			return
+		}
+	}
+	wrapped, err := services.WrapDataKey(newKey, req.NewPassphrase, salt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成密钥失败"})
+		return
+	}
+
+	rotatedNotes, rotatedResources := 0, 0
+	if !req.RotateKey {
+		if err := models.UpdateUserVaultWrapping(userID, salt, wrapped); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "保存密钥库失败: " + err.Error()})
+			return
+		}
+	} else {
+		rotatedNotes, rotatedResources, err = rotateVaultDataKey(userID, oldKey, newKey, salt, wrapped)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "轮换密钥失败: " + err.Error()})
+			return
+		}
+	}
+
+	services.CloseUserVaultSessions(userID)
+	sess, err := services.OpenVaultSession(userID, newKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建解锁会话失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"success":           true,
+		"rotated":           req.RotateKey,
+		"notes_reencrypted": rotatedNotes,
+		"files_reencrypted": rotatedResources,
+		"vault_token":       sess.Token,
+		"expires_at":        sess.ExpiresAt,
+	})
+}
+
+// rotateVaultDataKey 用新数据密钥重新加密全部笔记与附件
+// 附件先写入临时文件，全部替换成功后才提交数据库事务，任一步失败时数据库与磁盘都保持旧密钥。
+func rotateVaultDataKey(userID int, oldKey, newKey, salt, wrapped string) (int, int, error) {
+	notes, err := models.ListLockedNotes(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := range notes {
+		plaintext, err := services.DecryptNoteContent(notes[i].Ciphertext, oldKey)
+		if err != nil {
+			return 0, 0, err
+		}
+		if notes[i].Ciphertext, err = services.EncryptNoteContent(plaintext, newKey); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	resources, err := models.ListEncryptedResources(userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	var staged []string
+	cleanup := func() {
+		for _, p := range staged {
+			_ = os.Remove(p + ".rotate")
+		}
+	}
+	for _, r := range resources {
+		p := resourceDiskPath(&r)
+		data, err := os.ReadFile(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			cleanup()
+			return 0, 0, err
+		}
+		plain, err := utils.DecryptBytes(data, oldKey)
+		if err != nil {
+			cleanup()
+			return 0, 0, err
+		}
+		sealed, err := utils.EncryptBytes(plain, newKey)
+		if err != nil {
+			cleanup()
+			return 0, 0, err
+		}
+		if err := os.WriteFile(p+".rotate", sealed, 0o644); err != nil {
+			cleanup()
+			return 0, 0, err
+		}
+		staged = append(staged, p)
+	}
+
+	// 先替换全部附件并把旧文件留作 .old，替换或数据库提交失败时还原，
+	// 保证旧密钥失效前每个附件都已换成新密钥加密的内容
+	var swapped []string
+	restore := func() {
+		for _, p := range swapped {
+			if err := os.Rename(p+".old", p); err != nil {
+				log.Printf("还原附件 %s 失败: %v", p, err)
+			}
+		}
+		cleanup()
+	}
+	for _, p := range staged {
+		if err := os.Rename(p, p+".old"); err != nil {
+			restore()
+			return 0, 0, err
+		}
+		if err := os.Rename(p+".rotate", p); err != nil {
+			_ = os.Rename(p+".old", p)
+			restore()
+			return 0, 0, err
+		}
+		swapped = append(swapped, p)
+	}
+	if err := models.RotateUserVaultKey(userID, salt, wrapped, notes); err != nil {
+		restore()
+		return 0, 0, err
+	}
+	for _, p := range swapped {
+		_ = os.Remove(p + ".old")
+	}
+	return len(notes), len(staged), nil
+}
+
+func resourceDiskPath(r *models.Resource) string {
+	return filepath.Join(storageBaseDir(), filepath.FromSlash(r.StoragePath))
+}
+
+// transformFile 读取文件、转换后原子替换
+func transformFile(p string, fn func([]byte) ([]byte, error)) error {
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	out, err := fn(data)
+	if err != nil {
+		return err
+	}
+	tmp := p + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// setNoteResourcesEncrypted 加密（encrypt 为 true）或解密笔记的附件文件并更新标记；
+// 中途失败时把已处理的附件恢复原状。返回的 undo 用于之后保存笔记失败时回滚附件
+func setNoteResourcesEncrypted(note *models.Note, encrypt bool, dataKey string) (func(), error) {
+	seal := func(b []byte) ([]byte, error) { return utils.EncryptBytes(b, dataKey) }
+	open := func(b []byte) ([]byte, error) { return utils.DecryptBytes(b, dataKey) }
+	forward, backward := seal, open
+	if !encrypt {
+		forward, backward = open, seal
+	}
+
+	var done []*models.Resource
+	undo := func() {
+		for i := len(done) - 1; i >= 0; i-- {
+			r := done[i]
+			if err := transformFile(resourceDiskPath(r), backward); err != nil {
+				log.Printf("还原附件 %d 失败: %v", r.ID, err)
+				continue
+			}
+			if err := models.SetResourceEncrypted(r.ID, !encrypt); err != nil {
+				log.Printf("还原附件 %d 的加密标记失败: %v", r.ID, err)
+			}
+		}
+	}
+	for i := range note.Resources {
+		r := &note.Resources[i]
+		if r.Encrypted == encrypt {
+			continue
+		}
+		p := resourceDiskPath(r)
+		if err := transformFile(p, forward); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			undo()
+			return nil, err
+		}
+		if err := models.SetResourceEncrypted(r.ID, encrypt); err != nil {
+			if err := transformFile(p, backward); err != nil {
+				log.Printf("还原附件 %d 失败: %v", r.ID, err)
+			}
+			undo()
+			return nil, err
+		}
+		done = append(done, r)
+	}
+	return undo, nil
+}
+
+// LockNote 加密笔记内容（同时加密其附件文件）
+// POST /api/notes/:id/lock
+func LockNote(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记ID"})
+		return
+	}
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
+	dataKey, ok := vaultDataKey(c, userID)
+	if !ok {
+		return
+	}
+	note, err := models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
+		return
+	}
+	if note.Locked {
+		c.JSON(http.StatusOK, note)
+		return
+	}
+
+	sealed, err := services.EncryptNoteContent(note.Content, dataKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密失败"})
+		return
+	}
+	undo, err := setNoteResourcesEncrypted(note, true, dataKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "加密附件失败: " + err.Error()})
+		return
+	}
+	if err := models.SetNoteEncryption(id, sealed, true); err != nil {
+		undo()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败: " + err.Error()})
+		return
+	}
+
+	note, err = models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取笔记失败"})
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// UnlockNote 返回加密笔记的明文（仅在响应中，不落库）
+// POST /api/notes/:id/unlock
+func UnlockNote(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记ID"})
+		return
+	}
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
+	dataKey, ok := vaultDataKey(c, userID)
+	if !ok {
+		return
+	}
+	note, err := models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
+		return
+	}
+	if note.Locked {
+		if err := openLockedNote(note, dataKey); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "解密失败，密钥不匹配"})
+			return
+		}
+	}
+	c.Header("Cache-Control", "no-store")
+	c.JSON(http.StatusOK, note)
+}
+
+// RemoveNoteLock 取消加密，恢复明文存储
+// DELETE /api/notes/:id/lock
+func RemoveNoteLock(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的笔记ID"})
+		return
+	}
+	userID, ok := mustUserID(c)
+	if !ok {
+		return
+	}
+	if !ensureNoteOwned(c, id, userID) {
+		return
+	}
+	dataKey, ok := vaultDataKey(c, userID)
+	if !ok {
+		return
+	}
+	note, err := models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "笔记不存在"})
+		return
+	}
+	if !note.Locked {
+		c.JSON(http.StatusOK, note)
+		return
+	}
+	if err := openLockedNote(note, dataKey); err != nil {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "解密失败，密钥不匹配"})
+		return
+	}
+	undo, err := setNoteResourcesEncrypted(note, false, dataKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解密附件失败: " + err.Error()})
+		return
+	}
+	if err := models.SetNoteEncryption(id, note.Content, false); err != nil {
+		undo()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败: " + err.Error()})
+		return
+	}
+	note, err = models.GetNote(id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "获取笔记失败"})
+		return
+	}
+	c.JSON(http.StatusOK, note)
+}
+
+// GetResourceContent 读取附件内容（加密附件需要 X-Vault-Token）
+// GET /api/resources/:id/content
+func GetResourceContent(c *gin.Context) {
+	userID, ok := mustUserIDForResource(c)
+	if !ok {
+		return
+	}
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "无效的资源ID"})
+		return
+	}
+	r, err := models.GetResource(id)
+	if err != nil || r.UserID == nil || *r.UserID != userID {
+		if err != nil && err != sql.ErrNoRows {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "查询失败"})
+			return
+		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "资源不存在"})
+		return
+	}
+
+	data, err := os.ReadFile(resourceDiskPath(r))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "文件不存在"})
+		return
+	}
+	if r.Encrypted {
+		dataKey, ok := vaultDataKey(c, userID)
+		if !ok {
+			return
+		}
+		if data, err = utils.DecryptBytes(data, dataKey); err != nil {
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "解密失败，密钥不匹配"})
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+	}
+	mimeType := r.MimeType
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+	c.Data(http.StatusOK, mimeType, data)
+}
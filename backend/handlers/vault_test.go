@@ -0,0 +1,280 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/handlers"
+	"memo-studio/backend/models"
+)
+
+func doVault(t *testing.T, r http.Handler, method, path, auth, vaultToken string, body any) *httptest.ResponseRecorder {
+	t.Helper()
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatalf("encode json: %v", err)
+		}
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", auth)
+	if vaultToken != "" {
+		req.Header.Set(handlers.VaultTokenHeader, vaultToken)
+	}
+	rr := httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestVaultLockedNoteLifecycle(t *testing.T) {
+	r, adminID, storageDir := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	// 附件 + 笔记
+	res, err := models.CreateResource(&adminID, "a.txt", "u1/a.txt", "text/plain", 6, "")
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	resPath := filepath.Join(storageDir, "u1", "a.txt")
+	_ = os.MkdirAll(filepath.Dir(resPath), 0o755)
+	if err := os.WriteFile(resPath, []byte("secret"), 0o644); err != nil {
+		t.Fatalf("write resource: %v", err)
+	}
+	rr := doJSON(t, r, "POST", "/api/memos", auth, map[string]any{
+		"title": "diary", "content": "top secret words", "resource_ids": []int{res.ID},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create memo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+
+	// 未设置口令时无法加密
+	if rr := doVault(t, r, "POST", "/api/notes/"+itoa(note.ID)+"/lock", auth, "", nil); rr.Code != http.StatusLocked {
+		t.Fatalf("lock without vault status=%d body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = doVault(t, r, "POST", "/api/vault", auth, "", map[string]any{"passphrase": "correct horse"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("setup vault status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var unlocked struct {
+		VaultToken string `json:"vault_token"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &unlocked)
+	token := unlocked.VaultToken
+
+	rr = doVault(t, r, "POST", "/api/notes/"+itoa(note.ID)+"/lock", auth, token, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("lock status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var locked models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &locked)
+	if !locked.Locked || locked.Content != "" {
+		t.Fatalf("expected masked locked note: %+v", locked)
+	}
+
+	// 导出时跳过加密笔记，并在导出信息中列出
+	rr = doJSON(t, r, "GET", "/api/export?format=json", auth, nil)
+	var export struct {
+		Notes         []models.Note `json:"notes"`
+		SkippedLocked []struct {
+			ID int `json:"id"`
+		} `json:"skipped_locked"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &export)
+	if rr.Code != http.StatusOK || len(export.Notes) != 0 || len(export.SkippedLocked) != 1 || export.SkippedLocked[0].ID != note.ID {
+		t.Fatalf("export status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doJSON(t, r, "GET", "/api/export?format=markdown", auth, nil); !strings.Contains(rr.Body.String(), "已跳过 1 篇加密笔记") {
+		t.Fatalf("markdown export=%s", rr.Body.String())
+	}
+
+	// 数据库与磁盘均为密文，FTS 不再命中
+	var stored string
+	_ = database.DB.QueryRow(`SELECT content FROM notes WHERE id = ?`, note.ID).Scan(&stored)
+	if strings.Contains(stored, "secret") {
+		t.Fatalf("content stored in plaintext: %q", stored)
+	}
+	if raw, _ := os.ReadFile(resPath); bytes.Equal(raw, []byte("secret")) {
+		t.Fatalf("resource stored in plaintext")
+	}
+	var hits int
+	_ = database.DB.QueryRow(`SELECT COUNT(*) FROM notes_fts WHERE notes_fts MATCH 'secret'`).Scan(&hits)
+	if hits != 0 {
+		t.Fatalf("locked note still indexed: %d", hits)
+	}
+
+	// 携带令牌读取明文
+	rr = doVault(t, r, "GET", "/api/notes/"+itoa(note.ID), auth, token, nil)
+	var opened models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &opened)
+	if opened.Content != "top secret words" {
+		t.Fatalf("decrypted content=%q", opened.Content)
+	}
+	rr = doVault(t, r, "GET", "/api/resources/"+itoa(res.ID)+"/content", auth, token, nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "secret" {
+		t.Fatalf("resource content status=%d body=%q", rr.Code, rr.Body.String())
+	}
+	if rr := doVault(t, r, "GET", "/api/resources/"+itoa(res.ID)+"/content", auth, "", nil); rr.Code != http.StatusLocked {
+		t.Fatalf("resource without token status=%d", rr.Code)
+	}
+
+	// 未解锁时不能修改加密笔记
+	if rr := doVault(t, r, "PUT", "/api/memos/"+itoa(note.ID), auth, "", map[string]any{"title": "diary", "content": "x"}); rr.Code != http.StatusLocked {
+		t.Fatalf("update without token status=%d", rr.Code)
+	}
+	// 携带令牌修改：字数按明文统计，而不是密文
+	rr = doVault(t, r, "PUT", "/api/memos/"+itoa(note.ID), auth, token, map[string]any{
+		"title": "diary", "content": "top secret words", "resource_ids": []int{res.ID},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("update with token status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var words int
+	_ = database.DB.QueryRow(`SELECT word_count FROM notes WHERE id = ?`, note.ID).Scan(&words)
+	if words != 4 {
+		t.Fatalf("word_count=%d, want plaintext count 4", words)
+	}
+
+	// 修改口令并轮换数据密钥，旧令牌失效
+	rr = doVault(t, r, "PUT", "/api/vault/passphrase", auth, token, map[string]any{
+		"old_passphrase": "correct horse", "new_passphrase": "battery staple", "rotate_key": true,
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("change passphrase status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if rr := doVault(t, r, "GET", "/api/resources/"+itoa(res.ID)+"/content", auth, token, nil); rr.Code != http.StatusLocked {
+		t.Fatalf("old token still valid: %d", rr.Code)
+	}
+	if rr := doVault(t, r, "POST", "/api/vault/unlock", auth, "", map[string]any{"passphrase": "correct horse"}); rr.Code != http.StatusUnauthorized {
+		t.Fatalf("old passphrase accepted: %d", rr.Code)
+	}
+	rr = doVault(t, r, "POST", "/api/vault/unlock", auth, "", map[string]any{"passphrase": "battery staple"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("unlock status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &unlocked)
+	token = unlocked.VaultToken
+
+	// 取消加密后恢复明文与索引
+	rr = doVault(t, r, "DELETE", "/api/notes/"+itoa(note.ID)+"/lock", auth, token, nil)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("remove lock status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var plain models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &plain)
+	if plain.Locked || plain.Content != "top secret words" {
+		t.Fatalf("unexpected note after unlock: %+v", plain)
+	}
+	if raw, _ := os.ReadFile(resPath); string(raw) != "secret" {
+		t.Fatalf("resource not restored: %q", raw)
+	}
+}
+
+func TestVaultLockRollsBackAttachmentsOnFailure(t *testing.T) {
+	r, adminID, storageDir := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	good, err := models.CreateResource(&adminID, "a.txt", "u1/a.txt", "text/plain", 6, "")
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	bad, err := models.CreateResource(&adminID, "b.txt", "u1/b.txt", "text/plain", 6, "")
+	if err != nil {
+		t.Fatalf("CreateResource: %v", err)
+	}
+	goodPath := filepath.Join(storageDir, "u1", "a.txt")
+	_ = os.MkdirAll(filepath.Dir(goodPath), 0o755)
+	if err := os.WriteFile(goodPath, []byte("secret"), 0o644); err != nil {
+		t.Fatalf("write resource: %v", err)
+	}
+	// 第二个附件无法读取（路径是目录），加密中途失败
+	if err := os.MkdirAll(filepath.Join(storageDir, "u1", "b.txt"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	rr := doJSON(t, r, "POST", "/api/memos", auth, map[string]any{
+		"title": "diary", "content": "top secret words", "resource_ids": []int{good.ID, bad.ID},
+	})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("create memo status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var note models.Note
+	_ = json.Unmarshal(rr.Body.Bytes(), &note)
+
+	rr = doVault(t, r, "POST", "/api/vault", auth, "", map[string]any{"passphrase": "correct horse"})
+	var unlocked struct {
+		VaultToken string `json:"vault_token"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &unlocked)
+
+	if rr := doVault(t, r, "POST", "/api/notes/"+itoa(note.ID)+"/lock", auth, unlocked.VaultToken, nil); rr.Code != http.StatusInternalServerError {
+		t.Fatalf("lock status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	if raw, _ := os.ReadFile(goodPath); string(raw) != "secret" {
+		t.Fatalf("processed attachment not restored: %q", raw)
+	}
+	if res, _ := models.GetResource(good.ID); res == nil || res.Encrypted {
+		t.Fatalf("attachment flag not restored: %+v", res)
+	}
+	var locked bool
+	_ = database.DB.QueryRow(`SELECT locked FROM notes WHERE id = ?`, note.ID).Scan(&locked)
+	if locked {
+		t.Fatalf("note locked after failure")
+	}
+}
+
+func TestVaultEncryptedUploadNeverWritesPlaintext(t *testing.T) {
+	r, adminID, storageDir := setup(t)
+	auth := authHeader(t, adminID, "admin", true)
+
+	rr := doVault(t, r, "POST", "/api/vault", auth, "", map[string]any{"passphrase": "correct horse"})
+	var unlocked struct {
+		VaultToken string `json:"vault_token"`
+	}
+	_ = json.Unmarshal(rr.Body.Bytes(), &unlocked)
+
+	var mp bytes.Buffer
+	w := multipart.NewWriter(&mp)
+	fw, _ := w.CreateFormFile("file", "diary.txt")
+	fw.Write([]byte("top secret attachment"))
+	_ = w.WriteField("encrypt", "true")
+	_ = w.Close()
+	req := httptest.NewRequest("POST", "/api/resources", &mp)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	req.Header.Set("Authorization", auth)
+	req.Header.Set(handlers.VaultTokenHeader, unlocked.VaultToken)
+	rr = httptest.NewRecorder()
+	r.ServeHTTP(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("upload status=%d body=%s", rr.Code, rr.Body.String())
+	}
+	var res models.Resource
+	_ = json.Unmarshal(rr.Body.Bytes(), &res)
+	if !res.Encrypted || res.Size != int64(len("top secret attachment")) {
+		t.Fatalf("resource=%+v", res)
+	}
+
+	// 存储目录中只有密文，且不残留临时文件
+	_ = filepath.Walk(storageDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(p, ".tmp") {
+			t.Errorf("temp file left behind: %s", p)
+		}
+		if raw, _ := os.ReadFile(p); strings.Contains(string(raw), "top secret") {
+			t.Errorf("plaintext on disk: %s", p)
+		}
+		return nil
+	})
+}
@@ -8,6 +8,8 @@ import (
 	"memo-studio/backend/database"
 	"memo-studio/backend/handlers"
 	"memo-studio/backend/middleware"
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
 	"net/http"
 	"os"
 	"os/signal"
@@ -36,6 +38,9 @@ func main() {
 		log.Fatal("数据库初始化失败:", err)
 	}
 
+	// 定期回顾调度（MEMO_DIGEST_INTERVAL=0 关闭）
+	services.StartDigestScheduler()
+
 	// 创建 Gin 路由（生产环境禁用控制台颜色与调试）
 	r := gin.New()
 	r.Use(gin.Recovery())
@@ -43,6 +48,18 @@ func main() {
 		r.Use(gin.Logger())
 	}
 
+	// 可信代理：仅信任这些地址转发的 X-Forwarded-For / X-Real-IP（逗号分隔，支持 CIDR）
+	// 未设置时不信任任何代理，客户端 IP 取连接对端地址，避免伪造请求头绕过限流
+	var trustedProxies []string
+	for _, p := range strings.Split(os.Getenv("MEMO_TRUSTED_PROXIES"), ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			trustedProxies = append(trustedProxies, p)
+		}
+	}
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatal("MEMO_TRUSTED_PROXIES 配置错误:", err)
+	}
+
 	// 安全响应头
 	r.Use(func(c *gin.Context) {
 		c.Header("X-Content-Type-Options", "nosniff")
@@ -76,7 +93,8 @@ func main() {
 		config.AllowAllOrigins = true
 	}
 	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization"}
+	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Vault-Token"}
+	config.ExposeHeaders = []string{"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"}
 	r.Use(cors.New(config))
 
 	// 健康检查端点（公开，无速率限制）
@@ -92,23 +110,34 @@ func main() {
 	r.Static("/uploads", storageDir)
 
 	// ===== API v1 =====
+	// 速率限制：登录/注册按 IP 严格限流；认证后的路由按用户限流，大模型与转写端点额外叠加更严格的策略
+	authLimit := middleware.StrictRateLimitMiddleware()
+	aiLimit := middleware.RateLimit(middleware.PolicyAI)
+	transcribeLimit := middleware.RateLimit(middleware.PolicyTranscribe)
+
 	v1 := r.Group("/api/v1")
 	{
-		// 公开路由（登录/注册）- 带速率限制
-		v1.Use(middleware.RateLimitMiddleware())
-		{
-			v1.POST("/auth/login", handlers.Login)
-			v1.POST("/auth/register", handlers.Register)
-		}
+		// 公开路由（登录/注册）- 带严格速率限制
+		v1.POST("/auth/login", authLimit, handlers.Login)
+		v1.POST("/auth/register", authLimit, handlers.Register)
+		v1.POST("/auth/forgot", authLimit, handlers.ForgotPassword)
+		v1.POST("/auth/reset", authLimit, handlers.ResetPassword)
+		v1.POST("/auth/verify-email", authLimit, handlers.VerifyEmail)
+		v1.GET("/instance", handlers.GetInstance)
 
 		// 需要认证的路由
 		api := v1.Group("/")
-		api.Use(middleware.AuthMiddleware())
+		api.Use(middleware.AuthMiddleware(), middleware.EnforceRolePermissions(), middleware.RateLimitMiddleware())
 		{
 			api.GET("/auth/me", handlers.GetCurrentUser)
 			api.GET("/users/me", handlers.GetMe)
+			api.GET("/roles", handlers.ListRoles)
 			api.PUT("/users/me", handlers.UpdateMe)
 			api.PUT("/users/me/password", handlers.ChangeMyPassword)
+			api.POST("/users/me/email/verify", authLimit, handlers.ResendEmailVerification)
+			api.GET("/users/me/usage", handlers.GetMyUsage)
+			api.GET("/users/me/settings", handlers.GetMySettings)
+			api.PUT("/users/me/settings", handlers.UpdateMySettings)
 
 			api.GET("/memos", handlers.ListMemos)
 			api.POST("/memos", handlers.CreateMemo)
@@ -120,6 +149,32 @@ func main() {
 			api.GET("/notes/:id", handlers.GetNote)
 			api.PUT("/notes/:id", handlers.UpdateNote)
 			api.DELETE("/notes/:id", handlers.DeleteNote)
+			api.POST("/notes/:id/lock", handlers.LockNote)
+			api.DELETE("/notes/:id/lock", handlers.RemoveNoteLock)
+			api.POST("/notes/:id/unlock", handlers.UnlockNote)
+			api.GET("/notes/:id/summary", handlers.GetNoteSummary)
+			api.POST("/notes/:id/summary", aiLimit, handlers.GenerateNoteSummary)
+			api.DELETE("/notes/:id/summary", handlers.DeleteNoteSummary)
+			api.POST("/notes/:id/suggest-tags", aiLimit, handlers.SuggestNoteTags)
+			api.GET("/tasks", handlers.ListTasks)
+			api.GET("/tasks/:id", handlers.GetTask)
+			api.PATCH("/tasks/:id", handlers.UpdateTask)
+			api.GET("/digests", handlers.ListDigests)
+			api.POST("/digests", aiLimit, handlers.GenerateDigest)
+			api.GET("/digests/:id", handlers.GetDigest)
+			api.DELETE("/digests/:id", handlers.DeleteDigest)
+			api.GET("/ai/templates", handlers.ListMyPromptTemplates)
+			api.POST("/ai/templates", handlers.CreateMyPromptTemplate)
+			api.PUT("/ai/templates/:id", handlers.UpdateMyPromptTemplate)
+			api.DELETE("/ai/templates/:id", handlers.DeleteMyPromptTemplate)
+			api.POST("/ai/run/:template", aiLimit, handlers.RunPromptTemplate)
+
+			// 加密笔记密钥库
+			api.GET("/vault", handlers.GetVaultStatus)
+			api.POST("/vault", handlers.SetupVault)
+			api.POST("/vault/unlock", authLimit, handlers.UnlockVault)
+			api.POST("/vault/lock", handlers.LockVault)
+			api.PUT("/vault/passphrase", authLimit, handlers.ChangeVaultPassphrase)
 			api.DELETE("/notes/batch", handlers.DeleteNotes)
 			api.GET("/search", handlers.SearchNotes)
 
@@ -133,11 +188,12 @@ func main() {
 
 			api.GET("/resources", handlers.ListResources)
 			api.POST("/resources", handlers.UploadResource)
-			api.POST("/resources/transcribe", handlers.UploadResourceAndTranscribe)
+			api.POST("/resources/transcribe", transcribeLimit, handlers.UploadResourceAndTranscribe)
 			api.DELETE("/resources/:id", handlers.DeleteResourceHandler)
+			api.GET("/resources/:id/content", handlers.GetResourceContent)
 
 			// 语音转文本（独立端点）
-			api.POST("/speech-to-text", handlers.SpeechToTextOnly)
+			api.POST("/speech-to-text", transcribeLimit, handlers.SpeechToTextOnly)
 
 			api.GET("/notebooks", handlers.ListNotebooks)
 			api.GET("/notebooks/:id", handlers.GetNotebook)
@@ -147,15 +203,19 @@ func main() {
 			api.GET("/notebooks/:id/notes", handlers.ListNotebookNotes)
 
 			api.GET("/stats", handlers.GetStats)
+			api.GET("/stats/activity", handlers.GetActivityStats)
 			api.GET("/export", handlers.ExportNotes)
 			api.POST("/import", handlers.ImportNotes)
 
 			// AI 洞察与总结
-			api.POST("/insights", handlers.GetInsight)
-			api.POST("/insights/:type", handlers.GetInsightByType)
-			api.POST("/insights/compare", handlers.CompareInsights)
-			api.POST("/summarize", handlers.SummarizeNote)
-			api.POST("/summarize/batch", handlers.BatchSummarize)
+			api.POST("/insights", aiLimit, handlers.GetInsight)
+			api.POST("/insights/:type", aiLimit, handlers.GetInsightByType)
+			api.POST("/insights/compare", aiLimit, handlers.CompareInsights)
+			api.GET("/insights/history", handlers.ListInsightHistory)
+			api.GET("/insights/history/:id", handlers.GetInsightHistory)
+			api.DELETE("/insights/history/:id", handlers.DeleteInsightHistory)
+			api.POST("/summarize", aiLimit, handlers.SummarizeNote)
+			api.POST("/summarize/batch", aiLimit, handlers.BatchSummarize)
 
 			// 大模型管理
 			api.GET("/models", handlers.GetModels)
@@ -166,22 +226,43 @@ func main() {
 			api.POST("/models/active", handlers.SetActiveModel)
 			api.POST("/models/local", handlers.AddLocalModel)
 			api.POST("/models/local/health", handlers.CheckLocalHealth)
-			api.POST("/models/test", handlers.TestModelConnection)
+			api.POST("/models/test", aiLimit, handlers.TestModelConnection)
+
+			// 个人模型配置（API Key 加密保存）
+			api.GET("/llm/profiles", handlers.ListMyLLMProfiles)
+			api.POST("/llm/profiles", handlers.CreateMyLLMProfile)
+			api.DELETE("/llm/profiles/active", handlers.DeactivateMyLLMProfile)
+			api.PUT("/llm/profiles/:id", handlers.UpdateMyLLMProfile)
+			api.DELETE("/llm/profiles/:id", handlers.DeleteMyLLMProfile)
+			api.POST("/llm/profiles/:id/activate", handlers.ActivateMyLLMProfile)
 
 			// 位置管理
 			api.PUT("/memos/:id/location", handlers.UpdateNoteLocation)
 			api.POST("/memos/:id/detect-location", handlers.DetectNoteLocation)
 			api.POST("/memos/:id/detect-and-save", handlers.SaveDetectedLocation)
+			api.GET("/memos/:id/photo-location", handlers.GetPhotoLocation)
+			api.POST("/memos/:id/photo-location", handlers.ApplyPhotoLocation)
 			api.GET("/notes/by-location", handlers.GetNotesByLocation)
+			api.GET("/notes/nearby", handlers.GetNearbyNotes)
+			api.GET("/notes/clusters", handlers.GetNoteClusters)
+			api.GET("/notes/geojson", handlers.ExportNotesGeoJSON)
 			api.GET("/locations/stats", handlers.GetLocationsStats)
 			api.POST("/locations/batch-detect", handlers.BatchDetectLocations)
+			api.GET("/geocode", handlers.Geocode)
 
 			// 股票分析
 			api.GET("/stocks/search", handlers.SearchStocks)
 			api.GET("/stocks/hot", handlers.GetHotStocks)
 			api.GET("/stocks/:code", handlers.GetStockInfo)
 			api.GET("/stocks/:code/history", handlers.GetStockHistory)
-			api.POST("/stocks/analyze", handlers.AnalyzeStock)
+			api.GET("/stocks/:code/indicators", aiLimit, handlers.GetStockIndicators)
+			api.POST("/stocks/analyze", aiLimit, handlers.AnalyzeStock)
+			api.GET("/stocks/watchlist", handlers.ListWatchlist)
+			api.POST("/stocks/watchlist", handlers.AddWatchlistItem)
+			api.DELETE("/stocks/watchlist/:code", handlers.RemoveWatchlistItem)
+			api.GET("/stocks/:code/notes", handlers.GetStockNotes)
+			api.POST("/stocks/mentions/rescan", handlers.RescanStockMentions)
+			api.GET("/memos/:id/stocks", handlers.GetNoteStocks)
 
 			// 用户管理（管理员）
 			admin := api.Group("/users")
@@ -191,6 +272,32 @@ func main() {
 				admin.POST("", handlers.AdminCreateUser)
 				admin.PUT("/:id", handlers.AdminUpdateUser)
 				admin.DELETE("/:id", handlers.AdminDeleteUser)
+				admin.PUT("/:id/role", handlers.AdminSetUserRole)
+			}
+
+			// 实例管理（管理员）：注册策略与邀请码
+			instanceAdmin := api.Group("/admin")
+			instanceAdmin.Use(middleware.RequirePermission(models.PermManageInstance))
+			{
+				instanceAdmin.PUT("/instance/registration", handlers.AdminUpdateRegistration)
+				instanceAdmin.GET("/invites", handlers.AdminListInvites)
+				instanceAdmin.POST("/invites", handlers.AdminCreateInvite)
+				instanceAdmin.DELETE("/invites/:id", handlers.AdminRevokeInvite)
+				instanceAdmin.GET("/llm/profiles", handlers.AdminListLLMProfiles)
+				instanceAdmin.POST("/llm/profiles", handlers.AdminCreateLLMProfile)
+				instanceAdmin.PUT("/llm/profiles/:id", handlers.AdminUpdateLLMProfile)
+				instanceAdmin.DELETE("/llm/profiles/:id", handlers.AdminDeleteLLMProfile)
+				instanceAdmin.POST("/llm/profiles/:id/activate", handlers.AdminActivateLLMProfile)
+				instanceAdmin.GET("/llm/usage", handlers.AdminUsageReport)
+				instanceAdmin.GET("/llm/quota", handlers.AdminGetLLMQuota)
+				instanceAdmin.PUT("/llm/quota", handlers.AdminSetLLMQuota)
+				instanceAdmin.PUT("/llm/quota/users/:id", handlers.AdminSetUserLLMQuota)
+				instanceAdmin.GET("/llm/cache", handlers.AdminLLMCacheStats)
+				instanceAdmin.DELETE("/llm/cache", handlers.AdminPurgeLLMCache)
+				instanceAdmin.GET("/ai/templates", handlers.AdminListPromptTemplates)
+				instanceAdmin.POST("/ai/templates", handlers.AdminCreatePromptTemplate)
+				instanceAdmin.PUT("/ai/templates/:id", handlers.AdminUpdatePromptTemplate)
+				instanceAdmin.DELETE("/ai/templates/:id", handlers.AdminDeletePromptTemplate)
 			}
 		}
 	}
@@ -198,19 +305,25 @@ func main() {
 	// ===== 旧 API 兼容（已废弃，建议迁移到 /api/v1）=====
 	// 登录/注册（无需认证，供前端 /api 前缀使用）
 	legacyAuth := r.Group("/api")
-	legacyAuth.Use(middleware.RateLimitMiddleware())
 	{
-		legacyAuth.POST("/auth/login", handlers.Login)
-		legacyAuth.POST("/auth/register", handlers.Register)
+		legacyAuth.POST("/auth/login", authLimit, handlers.Login)
+		legacyAuth.POST("/auth/register", authLimit, handlers.Register)
+		legacyAuth.POST("/auth/forgot", authLimit, handlers.ForgotPassword)
+		legacyAuth.POST("/auth/reset", authLimit, handlers.ResetPassword)
+		legacyAuth.POST("/auth/verify-email", authLimit, handlers.VerifyEmail)
 	}
 	// 其余旧 API（需要认证）
 	legacy := r.Group("/api")
-	legacy.Use(middleware.AuthMiddleware())
+	legacy.Use(middleware.AuthMiddleware(), middleware.EnforceRolePermissions(), middleware.RateLimitMiddleware())
 	{
 		legacy.GET("/auth/me", handlers.GetCurrentUser)
 		legacy.GET("/users/me", handlers.GetMe)
 		legacy.PUT("/users/me", handlers.UpdateMe)
 		legacy.PUT("/users/me/password", handlers.ChangeMyPassword)
+		legacy.POST("/users/me/email/verify", authLimit, handlers.ResendEmailVerification)
+		legacy.GET("/users/me/usage", handlers.GetMyUsage)
+		legacy.GET("/users/me/settings", handlers.GetMySettings)
+		legacy.PUT("/users/me/settings", handlers.UpdateMySettings)
 
 		legacy.GET("/memos", handlers.ListMemos)
 		legacy.POST("/memos", handlers.CreateMemo)
@@ -222,6 +335,32 @@ func main() {
 		legacy.GET("/notes/:id", handlers.GetNote)
 		legacy.PUT("/notes/:id", handlers.UpdateNote)
 		legacy.DELETE("/notes/:id", handlers.DeleteNote)
+		legacy.POST("/notes/:id/lock", handlers.LockNote)
+		legacy.DELETE("/notes/:id/lock", handlers.RemoveNoteLock)
+		legacy.POST("/notes/:id/unlock", handlers.UnlockNote)
+		legacy.GET("/notes/:id/summary", handlers.GetNoteSummary)
+		legacy.POST("/notes/:id/summary", aiLimit, handlers.GenerateNoteSummary)
+		legacy.DELETE("/notes/:id/summary", handlers.DeleteNoteSummary)
+		legacy.POST("/notes/:id/suggest-tags", aiLimit, handlers.SuggestNoteTags)
+		legacy.GET("/tasks", handlers.ListTasks)
+		legacy.GET("/tasks/:id", handlers.GetTask)
+		legacy.PATCH("/tasks/:id", handlers.UpdateTask)
+		legacy.GET("/digests", handlers.ListDigests)
+		legacy.POST("/digests", aiLimit, handlers.GenerateDigest)
+		legacy.GET("/digests/:id", handlers.GetDigest)
+		legacy.DELETE("/digests/:id", handlers.DeleteDigest)
+		legacy.GET("/ai/templates", handlers.ListMyPromptTemplates)
+		legacy.POST("/ai/templates", handlers.CreateMyPromptTemplate)
+		legacy.PUT("/ai/templates/:id", handlers.UpdateMyPromptTemplate)
+		legacy.DELETE("/ai/templates/:id", handlers.DeleteMyPromptTemplate)
+		legacy.POST("/ai/run/:template", aiLimit, handlers.RunPromptTemplate)
+
+		// 加密笔记密钥库
+		legacy.GET("/vault", handlers.GetVaultStatus)
+		legacy.POST("/vault", handlers.SetupVault)
+		legacy.POST("/vault/unlock", authLimit, handlers.UnlockVault)
+		legacy.POST("/vault/lock", handlers.LockVault)
+		legacy.PUT("/vault/passphrase", authLimit, handlers.ChangeVaultPassphrase)
 		legacy.DELETE("/notes/batch", handlers.DeleteNotes)
 		legacy.GET("/search", handlers.SearchNotes)
 
@@ -235,11 +374,12 @@ func main() {
 
 		legacy.GET("/resources", handlers.ListResources)
 		legacy.POST("/resources", handlers.UploadResource)
-		legacy.POST("/resources/transcribe", handlers.UploadResourceAndTranscribe)
+		legacy.POST("/resources/transcribe", transcribeLimit, handlers.UploadResourceAndTranscribe)
 		legacy.DELETE("/resources/:id", handlers.DeleteResourceHandler)
+		legacy.GET("/resources/:id/content", handlers.GetResourceContent)
 
 		// 语音转文本（独立端点）
-		legacy.POST("/speech-to-text", handlers.SpeechToTextOnly)
+		legacy.POST("/speech-to-text", transcribeLimit, handlers.SpeechToTextOnly)
 
 		legacy.GET("/notebooks", handlers.ListNotebooks)
 		legacy.GET("/notebooks/:id", handlers.GetNotebook)
@@ -249,28 +389,45 @@ func main() {
 		legacy.GET("/notebooks/:id/notes", handlers.ListNotebookNotes)
 
 		legacy.GET("/stats", handlers.GetStats)
+		legacy.GET("/stats/activity", handlers.GetActivityStats)
 		legacy.GET("/export", handlers.ExportNotes)
 		legacy.POST("/import", handlers.ImportNotes)
 
 		// AI 洞察与总结
-		legacy.POST("/insights", handlers.GetInsight)
-		legacy.POST("/summarize", handlers.SummarizeNote)
-		legacy.POST("/summarize/batch", handlers.BatchSummarize)
+		legacy.POST("/insights", aiLimit, handlers.GetInsight)
+		legacy.GET("/insights/history", handlers.ListInsightHistory)
+		legacy.GET("/insights/history/:id", handlers.GetInsightHistory)
+		legacy.DELETE("/insights/history/:id", handlers.DeleteInsightHistory)
+		legacy.POST("/summarize", aiLimit, handlers.SummarizeNote)
+		legacy.POST("/summarize/batch", aiLimit, handlers.BatchSummarize)
 
 		// 位置管理
 		legacy.PUT("/memos/:id/location", handlers.UpdateNoteLocation)
 		legacy.POST("/memos/:id/detect-location", handlers.DetectNoteLocation)
 		legacy.POST("/memos/:id/detect-and-save", handlers.SaveDetectedLocation)
+		legacy.GET("/memos/:id/photo-location", handlers.GetPhotoLocation)
+		legacy.POST("/memos/:id/photo-location", handlers.ApplyPhotoLocation)
 		legacy.GET("/notes/by-location", handlers.GetNotesByLocation)
+		legacy.GET("/notes/nearby", handlers.GetNearbyNotes)
+		legacy.GET("/notes/clusters", handlers.GetNoteClusters)
+		legacy.GET("/notes/geojson", handlers.ExportNotesGeoJSON)
 		legacy.GET("/locations/stats", handlers.GetLocationsStats)
 		legacy.POST("/locations/batch-detect", handlers.BatchDetectLocations)
+		legacy.GET("/geocode", handlers.Geocode)
 
 		// 股票分析
 		legacy.GET("/stocks/search", handlers.SearchStocks)
 		legacy.GET("/stocks/hot", handlers.GetHotStocks)
 		legacy.GET("/stocks/:code", handlers.GetStockInfo)
 		legacy.GET("/stocks/:code/history", handlers.GetStockHistory)
-		legacy.POST("/stocks/analyze", handlers.AnalyzeStock)
+		legacy.GET("/stocks/:code/indicators", aiLimit, handlers.GetStockIndicators)
+		legacy.POST("/stocks/analyze", aiLimit, handlers.AnalyzeStock)
+		legacy.GET("/stocks/watchlist", handlers.ListWatchlist)
+		legacy.POST("/stocks/watchlist", handlers.AddWatchlistItem)
+		legacy.DELETE("/stocks/watchlist/:code", handlers.RemoveWatchlistItem)
+		legacy.GET("/stocks/:code/notes", handlers.GetStockNotes)
+		legacy.POST("/stocks/mentions/rescan", handlers.RescanStockMentions)
+		legacy.GET("/memos/:id/stocks", handlers.GetNoteStocks)
 
 		admin := legacy.Group("/users")
 		admin.Use(middleware.AdminOnly())
@@ -279,6 +436,7 @@ func main() {
 			admin.POST("", handlers.AdminCreateUser)
 			admin.PUT("/:id", handlers.AdminUpdateUser)
 			admin.DELETE("/:id", handlers.AdminDeleteUser)
+			admin.PUT("/:id/role", handlers.AdminSetUserRole)
 		}
 	}
 
@@ -5,6 +5,7 @@ import (
 	"memo-studio/backend/models"
 	"memo-studio/backend/utils"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
@@ -35,34 +36,143 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
-		// 将用户信息存储到上下文
+		state, err := models.GetAuthState(claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "校验认证令牌失败"})
+			c.Abort()
+			return
+		}
+		if state == nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户不存在", "code": "TOKEN_REVOKED"})
+			c.Abort()
+			return
+		}
+		// 找回密码后，之前签发的令牌失效（令牌签发时间精确到秒）
+		if changedAt := state.PasswordChangedAt; changedAt != nil && (claims.IssuedAt == nil || claims.IssuedAt.Time.Before(changedAt.Truncate(time.Second))) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录", "code": "TOKEN_REVOKED"})
+			c.Abort()
+			return
+		}
+
+		// 将用户信息存储到上下文（角色取自数据库，角色变更立即生效）
+		role := state.Role
 		c.Set("userID", claims.UserID)
 		c.Set("username", claims.Username)
-		// 兼容旧 token：如果 claim 未带 is_admin，则从 DB 兜底一次
-		isAdmin := claims.IsAdmin
-		if !isAdmin {
-			if u, err := models.GetUserByID(claims.UserID); err == nil {
-				isAdmin = u.IsAdmin
-			}
+		c.Set("role", role)
+		c.Set("isAdmin", role == models.RoleAdmin)
+
+		c.Next()
+	}
+}
+
+// CurrentRole 当前请求的角色；未认证时返回空字符串
+func CurrentRole(c *gin.Context) string {
+	if v, ok := c.Get("role"); ok {
+		if role, ok := v.(string); ok {
+			return role
 		}
-		c.Set("isAdmin", isAdmin)
+	}
+	return ""
+}
 
+// HasPermission 当前用户是否拥有指定权限
+func HasPermission(c *gin.Context, perm models.Permission) bool {
+	return models.RoleHasPermission(CurrentRole(c), perm)
+}
+
+// RequirePermission 需要指定权限
+func RequirePermission(perm models.Permission) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(c, perm) {
+			abortForbidden(c, perm)
+			return
+		}
 		c.Next()
 	}
 }
 
 // AdminOnly 需要管理员权限
 func AdminOnly() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		v, ok := c.Get("isAdmin")
-		if !ok {
-			c.JSON(http.StatusForbidden, gin.H{"error": "无权限"})
-			c.Abort()
-			return
+	return RequirePermission(models.PermManageUsers)
+}
+
+func abortForbidden(c *gin.Context, perm models.Permission) {
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"error":      "无权限",
+		"code":       "PERMISSION_DENIED",
+		"permission": perm,
+	})
+}
+
+// 不修改数据、只读角色也可调用的非 GET 路由（去掉 /api、/api/v1 前缀后的路由模板）
+var readOnlyWriteRoutes = map[string]bool{
+	"PUT /users/me":                   true,
+	"PUT /users/me/password":          true,
+	"PUT /users/me/settings":          true,
+	"POST /users/me/email/verify":     true,
+	"POST /vault/unlock":              true,
+	"POST /vault/lock":                true,
+	"POST /notes/:id/unlock":          true,
+	"POST /models/local/health":       true,
+	"POST /memos/:id/detect-location": true,
+}
+
+// 调用大模型/转写、但不写入数据的路由；个人模型配置也归入 ai 权限
+var aiRoutes = map[string]bool{
+	"POST /insights":                  true,
+	"POST /insights/:type":            true,
+	"POST /insights/compare":          true,
+	"POST /summarize":                 true,
+	"POST /summarize/batch":           true,
+	"POST /notes/:id/summary":         true,
+	"POST /notes/:id/suggest-tags":    true,
+	"POST /models/test":               true,
+	"POST /models/active":             true,
+	"POST /models/local":              true,
+	"POST /speech-to-text":            true,
+	"POST /stocks/analyze":            true,
+	"POST /llm/profiles":              true,
+	"PUT /llm/profiles/:id":           true,
+	"DELETE /llm/profiles/:id":        true,
+	"DELETE /llm/profiles/active":     true,
+	"POST /llm/profiles/:id/activate": true,
+	"POST /ai/run/:template":          true,
+	"POST /ai/templates":              true,
+	"PUT /ai/templates/:id":           true,
+	"DELETE /ai/templates/:id":        true,
+}
+
+// requiredPermission 按请求方法与路由推导所需权限：读请求需要 read，
+// AI 路由需要 ai，自助路由需要 read，其余写请求需要 write
+func requiredPermission(method, fullPath string) models.Permission {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return models.PermRead
+	}
+	route := fullPath
+	for _, prefix := range []string{"/api/v1", "/api"} {
+		if strings.HasPrefix(route, prefix+"/") {
+			route = strings.TrimPrefix(route, prefix)
+			break
 		}
-		if b, ok := v.(bool); !ok || !b {
-			c.JSON(http.StatusForbidden, gin.H{"error": "无权限"})
-			c.Abort()
+	}
+	key := method + " " + route
+	if aiRoutes[key] {
+		return models.PermAI
+	}
+	if readOnlyWriteRoutes[key] {
+		return models.PermRead
+	}
+	return models.PermWrite
+}
+
+// EnforceRolePermissions 按角色拦截：只读角色（viewer/guest）无法访问任何写路由
+// 需放在 AuthMiddleware 之后
+func EnforceRolePermissions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		perm := requiredPermission(c.Request.Method, c.FullPath())
+		if !HasPermission(c, perm) {
+			abortForbidden(c, perm)
 			return
 		}
 		c.Next()
@@ -1,142 +1,240 @@
 package middleware
 
 import (
+	"log"
+	"math"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
+	"memo-studio/backend/database"
+
 	"github.com/gin-gonic/gin"
 )
 
-// RateLimiter 简单速率限制器
-type RateLimiter struct {
-	requests map[string][]time.Time
-	mu       sync.RWMutex
-	limit    int           // 每时间窗口最大请求数
-	window   time.Duration // 时间窗口
-}
+// 速率限制策略名称（可通过 MEMO_RATELIMIT_<NAME> 覆盖，例如 MEMO_RATELIMIT_AUTH=10/1m）
+const (
+	PolicyDefault    = "default"    // 普通 API
+	PolicyAuth       = "auth"       // 登录/注册
+	PolicyAI         = "ai"         // 大模型相关（洞察/总结/模型测试）
+	PolicyTranscribe = "transcribe" // 语音转写
+)
 
-// NewRateLimiter 创建速率限制器
-func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
-	return &RateLimiter{
-		requests: make(map[string][]time.Time),
-		limit:    limit,
-		window:   window,
-	}
+// RateLimitPolicy 令牌桶策略：每 Period 补充 Rate 个令牌，桶容量为 Burst
+type RateLimitPolicy struct {
+	Name   string
+	Rate   int
+	Period time.Duration
+	Burst  int
 }
 
-// isAllowed 检查请求是否允许
-func (rl *RateLimiter) isAllowed(key string) bool {
-	rl.mu.Lock()
-	defer rl.mu.Unlock()
-
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
+// RateLimitResult 单次取令牌的结果
+type RateLimitResult struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // 桶恢复满所需时间
+	RetryAfter time.Duration // 被拒绝时，下一个令牌可用的等待时间
+}
 
-	// 清理过期记录
-	if times, exists := rl.requests[key]; exists {
-		var valid []time.Time
-		for _, t := range times {
-			if t.After(windowStart) {
-				valid = append(valid, t)
-			}
-		}
-		if len(valid) < len(times) {
-			rl.requests[key] = valid
-		}
+// refillPerSecond 每秒补充的令牌数
+func (p RateLimitPolicy) refillPerSecond() float64 {
+	if p.Period <= 0 {
+		return float64(p.Rate)
 	}
+	return float64(p.Rate) / p.Period.Seconds()
+}
 
-	// 检查是否超过限制
-	if len(rl.requests[key]) >= rl.limit {
-		return false
+// take 根据上一次状态计算本次结果，返回新的令牌数
+// 内存与 SQLite 存储共用此计算，保证行为一致。
+func (p RateLimitPolicy) take(tokens float64, last, now time.Time, seen bool) (float64, RateLimitResult) {
+	burst := float64(p.Burst)
+	if !seen {
+		tokens = burst
+	} else if elapsed := now.Sub(last).Seconds(); elapsed > 0 {
+		tokens = math.Min(burst, tokens+elapsed*p.refillPerSecond())
 	}
 
-	// 记录请求
-	rl.requests[key] = append(rl.requests[key], now)
-	return true
+	res := RateLimitResult{Limit: p.Burst}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = p.secondsFor(1 - tokens)
+	}
+	res.Remaining = int(math.Floor(tokens))
+	res.Reset = p.secondsFor(burst - tokens)
+	return tokens, res
 }
 
-// GetRemaining 获取剩余请求数
-func (rl *RateLimiter) getRemaining(key string) int {
-	rl.mu.RLock()
-	defer rl.mu.RUnlock()
+func (p RateLimitPolicy) secondsFor(missing float64) time.Duration {
+	rate := p.refillPerSecond()
+	if missing <= 0 || rate <= 0 {
+		return 0
+	}
+	return time.Duration(missing / rate * float64(time.Second))
+}
 
-	now := time.Now()
-	windowStart := now.Add(-rl.window)
+// defaultPolicies 内置策略
+var defaultPolicies = map[string]RateLimitPolicy{
+	PolicyDefault:    {Name: PolicyDefault, Rate: 120, Period: time.Minute, Burst: 120},
+	PolicyAuth:       {Name: PolicyAuth, Rate: 10, Period: time.Minute, Burst: 10},
+	PolicyAI:         {Name: PolicyAI, Rate: 20, Period: time.Minute, Burst: 10},
+	PolicyTranscribe: {Name: PolicyTranscribe, Rate: 10, Period: time.Minute, Burst: 5},
+}
 
-	count := 0
-	if times, exists := rl.requests[key]; exists {
-		for _, t := range times {
-			if t.After(windowStart) {
-				count++
-			}
+// ParseRateLimitPolicy 解析 "次数/时长[/突发]" 格式，例如 "30/1m"、"100/1h/20"
+func ParseRateLimitPolicy(name, s string) (RateLimitPolicy, bool) {
+	parts := strings.Split(strings.TrimSpace(s), "/")
+	if len(parts) < 2 || len(parts) > 3 {
+		return RateLimitPolicy{}, false
+	}
+	rate, err := strconv.Atoi(strings.TrimSpace(parts[0]))
+	if err != nil || rate <= 0 {
+		return RateLimitPolicy{}, false
+	}
+	period, err := time.ParseDuration(strings.TrimSpace(parts[1]))
+	if err != nil || period <= 0 {
+		return RateLimitPolicy{}, false
+	}
+	burst := rate
+	if len(parts) == 3 {
+		burst, err = strconv.Atoi(strings.TrimSpace(parts[2]))
+		if err != nil || burst <= 0 {
+			return RateLimitPolicy{}, false
 		}
 	}
+	return RateLimitPolicy{Name: name, Rate: rate, Period: period, Burst: burst}, true
+}
 
-	remaining := rl.limit - count
-	if remaining < 0 {
-		remaining = 0
+// PolicyFor 获取策略（环境变量优先）
+func PolicyFor(name string) RateLimitPolicy {
+	p, ok := defaultPolicies[name]
+	if !ok {
+		p = defaultPolicies[PolicyDefault]
+		p.Name = name
 	}
-	return remaining
+	env := "MEMO_RATELIMIT_" + strings.ToUpper(name)
+	if v := strings.TrimSpace(os.Getenv(env)); v != "" {
+		if parsed, ok := ParseRateLimitPolicy(name, v); ok {
+			return parsed
+		}
+		log.Printf("[WARNING] %s 格式错误（应为 次数/时长[/突发]，如 30/1m），使用默认值", env)
+	}
+	return p
 }
 
 var (
-	globalLimiter     *RateLimiter
-	globalLimiterOnce sync.Once
+	globalStore     RateLimitStore
+	globalStoreOnce sync.Once
+	globalStoreMu   sync.RWMutex
 )
 
-// GetGlobalLimiter 获取全局速率限制器
-func GetGlobalLimiter() *RateLimiter {
-	globalLimiterOnce.Do(func() {
-		globalLimiter = NewRateLimiter(50, time.Minute) // 每分钟50次
+// GetRateLimitStore 获取全局限流存储
+// MEMO_RATELIMIT_STORE=sqlite 时使用数据库共享限流状态（多进程部署），默认内存。
+func GetRateLimitStore() RateLimitStore {
+	globalStoreOnce.Do(func() {
+		var s RateLimitStore
+		if strings.EqualFold(strings.TrimSpace(os.Getenv("MEMO_RATELIMIT_STORE")), "sqlite") && database.DB != nil {
+			s = NewSQLiteStore(database.DB)
+		} else {
+			s = NewMemoryStore()
+		}
+		globalStoreMu.Lock()
+		globalStore = s
+		globalStoreMu.Unlock()
+		go runEviction(s, time.Minute)
 	})
-	return globalLimiter
+	globalStoreMu.RLock()
+	defer globalStoreMu.RUnlock()
+	return globalStore
 }
 
-// RateLimitMiddleware 返回速率限制中间件
-func RateLimitMiddleware() gin.HandlerFunc {
-	limiter := GetGlobalLimiter()
-	
-	return func(c *gin.Context) {
-		// 获取客户端 IP 作为 key
-		clientIP := c.ClientIP()
-		
-		if !limiter.isAllowed(clientIP) {
-			c.Header("Retry-After", "60")
-			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "请求过于频繁，请稍后再试",
-				"code":  "RATE_LIMIT_EXCEEDED",
-			})
-			c.Abort()
-			return
+// SetRateLimitStore 替换全局限流存储（测试或自定义部署使用）
+func SetRateLimitStore(s RateLimitStore) {
+	globalStoreOnce.Do(func() {})
+	globalStoreMu.Lock()
+	defer globalStoreMu.Unlock()
+	globalStore = s
+}
+
+// runEviction 定期清理已恢复满的令牌桶，避免内存/表无限增长；
+// 桶满与从未访问等价，因此周期较长的策略不会因清理而提前重置
+func runEviction(s RateLimitStore, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		if _, err := s.Evict(now); err != nil {
+			log.Printf("[ratelimit] 清理过期 key 失败: %v", err)
 		}
+	}
+}
 
-		// 添加速率限制头信息
-		remaining := limiter.getRemaining(clientIP)
-		c.Header("X-RateLimit-Limit", "50")
-		c.Header("X-RateLimit-Remaining", string(rune('0'+remaining)))
-		
-		c.Next()
+// rateLimitKey 已认证用户按用户 ID 限流，否则按客户端 IP
+// 客户端 IP 依赖 gin 的可信代理配置（见 main.go 中 MEMO_TRUSTED_PROXIES）。
+func rateLimitKey(c *gin.Context) string {
+	if v, ok := c.Get("userID"); ok {
+		if id, ok := v.(int); ok && id > 0 {
+			return "u:" + strconv.Itoa(id)
+		}
 	}
+	return "ip:" + c.ClientIP()
 }
 
-// StrictRateLimitMiddleware 严格速率限制（每分钟30次）
-func StrictRateLimitMiddleware() gin.HandlerFunc {
-	limiter := NewRateLimiter(30, time.Minute)
-	
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// RateLimit 返回指定策略的速率限制中间件，并输出 RateLimit-* 标准响应头
+func RateLimit(policyName string) gin.HandlerFunc {
+	policy := PolicyFor(policyName)
+	policyHeader := strconv.Itoa(policy.Burst) + ";w=" + strconv.Itoa(ceilSeconds(policy.Period))
+
 	return func(c *gin.Context) {
-		clientIP := c.ClientIP()
-		
-		if !limiter.isAllowed(clientIP) {
-			c.Header("Retry-After", "60")
+		store := GetRateLimitStore()
+		key := policy.Name + ":" + rateLimitKey(c)
+
+		res, err := store.Take(key, policy, time.Now())
+		if err != nil {
+			// 存储故障时放行，避免限流组件拖垮整个服务
+			log.Printf("[ratelimit] 存储异常，放行请求: %v", err)
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(res.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.Reset)))
+
+		if !res.Allowed {
+			retry := ceilSeconds(res.RetryAfter)
+			if retry < 1 {
+				retry = 1
+			}
+			c.Header("Retry-After", strconv.Itoa(retry))
 			c.JSON(http.StatusTooManyRequests, gin.H{
-				"error": "请求过于频繁，请稍后再试",
-				"code":  "RATE_LIMIT_EXCEEDED",
+				"error":       "请求过于频繁，请稍后再试",
+				"code":        "RATE_LIMIT_EXCEEDED",
+				"retry_after": retry,
 			})
 			c.Abort()
 			return
 		}
-		
+
 		c.Next()
 	}
 }
+
+// RateLimitMiddleware 普通 API 速率限制
+func RateLimitMiddleware() gin.HandlerFunc {
+	return RateLimit(PolicyDefault)
+}
+
+// StrictRateLimitMiddleware 严格速率限制（登录/注册等敏感端点）
+func StrictRateLimitMiddleware() gin.HandlerFunc {
+	return RateLimit(PolicyAuth)
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"context"
+	"database/sql"
+	"sync"
+	"time"
+)
+
+// RateLimitStore 限流状态存储
+// 实现需保证 Take 对同一 key 的原子性；Evict 删除在 now 之前已恢复满的 key
+// （按各自策略的周期计算，删除后再访问与新 key 等价）。
+type RateLimitStore interface {
+	Take(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error)
+	Evict(now time.Time) (int, error)
+}
+
+// ===== 内存存储（单进程） =====
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // 令牌恢复满的时间
+}
+
+// MemoryStore 进程内令牌桶存储
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]*bucket)}
+}
+
+func (s *MemoryStore) Take(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b, seen := s.buckets[key]
+	if !seen {
+		b = &bucket{}
+		s.buckets[key] = b
+	}
+	tokens, res := policy.take(b.tokens, b.last, now, seen)
+	b.tokens = tokens
+	b.last = now
+	b.full = now.Add(res.Reset)
+	return res, nil
+}
+
+func (s *MemoryStore) Evict(now time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n := 0
+	for k, b := range s.buckets {
+		if !b.full.After(now) {
+			delete(s.buckets, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Len 当前跟踪的 key 数量
+func (s *MemoryStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.buckets)
+}
+
+// ===== SQLite 存储（多进程共享同一数据库文件） =====
+
+// SQLiteStore 基于 rate_limits 表的令牌桶存储
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore 创建 SQLite 存储（表结构由 database 迁移创建）
+func NewSQLiteStore(db *sql.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) Take(key string, policy RateLimitPolicy, now time.Time) (RateLimitResult, error) {
+	ctx := context.Background()
+	// BEGIN IMMEDIATE 需要固定连接：先拿写锁再读，避免多进程并发读到同一状态
+	conn, err := s.db.Conn(ctx)
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `BEGIN IMMEDIATE;`); err != nil {
+		return RateLimitResult{}, err
+	}
+
+	var tokens float64
+	var updatedAt int64
+	seen := true
+	err = conn.QueryRowContext(ctx, `SELECT tokens, updated_at FROM rate_limits WHERE key = ?`, key).Scan(&tokens, &updatedAt)
+	if err == sql.ErrNoRows {
+		seen = false
+	} else if err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK;`)
+		return RateLimitResult{}, err
+	}
+
+	tokens, res := policy.take(tokens, time.Unix(0, updatedAt), now, seen)
+	if _, err := conn.ExecContext(ctx, `
+		INSERT INTO rate_limits (key, tokens, updated_at, full_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET tokens = excluded.tokens, updated_at = excluded.updated_at, full_at = excluded.full_at
+	`, key, tokens, now.UnixNano(), now.Add(res.Reset).UnixNano()); err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK;`)
+		return RateLimitResult{}, err
+	}
+	if _, err := conn.ExecContext(ctx, `COMMIT;`); err != nil {
+		_, _ = conn.ExecContext(ctx, `ROLLBACK;`)
+		return RateLimitResult{}, err
+	}
+	return res, nil
+}
+
+func (s *SQLiteStore) Evict(now time.Time) (int, error) {
+	res, err := s.db.Exec(`DELETE FROM rate_limits WHERE full_at <= ?`, now.UnixNano())
+	if err != nil {
+		return 0, err
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
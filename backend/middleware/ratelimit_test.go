@@ -0,0 +1,117 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"memo-studio/backend/database"
+	"memo-studio/backend/middleware"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseRateLimitPolicy(t *testing.T) {
+	p, ok := middleware.ParseRateLimitPolicy("x", "30/1m/5")
+	if !ok || p.Rate != 30 || p.Period != time.Minute || p.Burst != 5 {
+		t.Fatalf("unexpected policy: %+v ok=%v", p, ok)
+	}
+	if _, ok := middleware.ParseRateLimitPolicy("x", "abc"); ok {
+		t.Fatalf("expected invalid policy")
+	}
+}
+
+func TestStoresTokenBucket(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("MEMO_DB_PATH", filepath.Join(tmp, "notes.db"))
+	t.Setenv("MEMO_ADMIN_PASSWORD", "AdminPass123!")
+	if err := database.Init(); err != nil {
+		t.Fatalf("database.Init: %v", err)
+	}
+
+	stores := map[string]middleware.RateLimitStore{
+		"memory": middleware.NewMemoryStore(),
+		"sqlite": middleware.NewSQLiteStore(database.DB),
+	}
+	policy := middleware.RateLimitPolicy{Name: "t", Rate: 2, Period: time.Second, Burst: 2}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			now := time.Unix(1700000000, 0)
+			for i := 0; i < 2; i++ {
+				res, err := s.Take("k", policy, now)
+				if err != nil || !res.Allowed {
+					t.Fatalf("take %d: allowed=%v err=%v", i, res.Allowed, err)
+				}
+			}
+			res, err := s.Take("k", policy, now)
+			if err != nil || res.Allowed {
+				t.Fatalf("expected deny, got %+v err=%v", res, err)
+			}
+			if res.RetryAfter != 500*time.Millisecond {
+				t.Fatalf("retry after = %v", res.RetryAfter)
+			}
+
+			// 半秒后补充 1 个令牌
+			res, _ = s.Take("k", policy, now.Add(500*time.Millisecond))
+			if !res.Allowed {
+				t.Fatalf("expected refill after 500ms: %+v", res)
+			}
+
+			// 桶在 1.5 秒时恢复满，之前不清理
+			if n, err := s.Evict(now.Add(time.Second)); err != nil || n != 0 {
+				t.Fatalf("evict before full n=%d err=%v", n, err)
+			}
+			n, err := s.Evict(now.Add(1500 * time.Millisecond))
+			if err != nil || n != 1 {
+				t.Fatalf("evict n=%d err=%v", n, err)
+			}
+
+			// 周期较长的策略：空闲 10 分钟后仍保留，恢复满之后才清理
+			hourly := middleware.RateLimitPolicy{Name: "h", Rate: 1, Period: time.Hour, Burst: 3}
+			if _, err := s.Take("h", hourly, now); err != nil {
+				t.Fatal(err)
+			}
+			if n, err := s.Evict(now.Add(10 * time.Minute)); err != nil || n != 0 {
+				t.Fatalf("hourly evicted early n=%d err=%v", n, err)
+			}
+			if n, err := s.Evict(now.Add(time.Hour)); err != nil || n != 1 {
+				t.Fatalf("hourly evict n=%d err=%v", n, err)
+			}
+		})
+	}
+}
+
+func TestRateLimitMiddlewareHeaders(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("MEMO_RATELIMIT_AUTH", "2/1m")
+	middleware.SetRateLimitStore(middleware.NewMemoryStore())
+
+	r := gin.New()
+	r.POST("/login", middleware.StrictRateLimitMiddleware(), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	do := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = "10.0.0.1:1234"
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := do()
+	if rr.Code != http.StatusOK || rr.Header().Get("RateLimit-Limit") != "2" || rr.Header().Get("RateLimit-Remaining") != "1" {
+		t.Fatalf("first: code=%d headers=%v", rr.Code, rr.Header())
+	}
+	_ = do()
+	rr = do()
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "30" {
+		t.Fatalf("Retry-After = %q", rr.Header().Get("Retry-After"))
+	}
+}
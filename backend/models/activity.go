@@ -0,0 +1,397 @@
+package models
+
+import (
+	"fmt"
+	"memo-studio/backend/database"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 活动统计的时间粒度
+const (
+	ActivityDay   = "day"
+	ActivityWeek  = "week"
+	ActivityMonth = "month"
+)
+
+// activityTopTags 标签趋势中列出的标签数
+const activityTopTags = 5
+
+// ActivityQuery 活动统计参数；From/To 为用户时区内的日期零点（To 不含）
+type ActivityQuery struct {
+	UserID      int
+	Location    *time.Location
+	From        time.Time
+	To          time.Time
+	Granularity string
+	Now         time.Time
+}
+
+// ActivityBucket 一个时间段内新建/修改的笔记数与新建笔记的字数
+type ActivityBucket struct {
+	Bucket  string `json:"bucket"` // 时间段起始日期 YYYY-MM-DD
+	Created int    `json:"created"`
+	Updated int    `json:"updated"` // 创建后修改过、最后修改时间落在该时段的笔记
+	Words   int    `json:"words"`
+}
+
+// HeatmapDay 热力图中的一天
+type HeatmapDay struct {
+	Date  string `json:"date"`
+	Count int    `json:"count"`
+	Words int    `json:"words"`
+}
+
+// ActivityHeatmap 最近一年（截至今天）每天新建笔记数
+type ActivityHeatmap struct {
+	From  string       `json:"from"`
+	To    string       `json:"to"`
+	Days  []HeatmapDay `json:"days"`
+	Max   int          `json:"max"`
+	Total int          `json:"total"`
+}
+
+// WritingStreaks 连续记录天数（当天还没写时，截至昨天的连续天数仍算当前连续）
+type WritingStreaks struct {
+	Current      int    `json:"current"`
+	Longest      int    `json:"longest"`
+	LongestStart string `json:"longest_start,omitempty"`
+	LongestEnd   string `json:"longest_end,omitempty"`
+	LastActive   string `json:"last_active,omitempty"`
+}
+
+// TagBucketCount 某个时间段内使用某标签的笔记数
+type TagBucketCount struct {
+	Bucket string `json:"bucket"`
+	Count  int    `json:"count"`
+}
+
+// TagActivity 标签随时间的使用情况
+type TagActivity struct {
+	Tag    string           `json:"tag"`
+	Total  int              `json:"total"`
+	Series []TagBucketCount `json:"series"`
+}
+
+// ActivityStats 写作活动统计
+type ActivityStats struct {
+	Timezone     string           `json:"timezone"`
+	From         string           `json:"from"`
+	To           string           `json:"to"` // 含当天
+	Granularity  string           `json:"granularity"`
+	Series       []ActivityBucket `json:"series"`
+	Heatmap      ActivityHeatmap  `json:"heatmap"`
+	Streaks      WritingStreaks   `json:"streaks"`
+	Tags         []TagActivity    `json:"tags"`
+	BusiestHours [24]int          `json:"busiest_hours"` // 按本地小时统计的新建笔记数
+}
+
+const sqlTimeLayout = "2006-01-02 15:04:05"
+
+// localTimeExpr 把 UTC 时间列换算为本地时间的 SQL 表达式。
+// SQLite 没有时区库，按 [from, to] 内的时区偏移分段（夏令时切换点）生成 CASE；
+// 插入的只有程序生成的时间与整数偏移，不含用户输入
+func localTimeExpr(col string, loc *time.Location, from, to time.Time) string {
+	type segment struct {
+		until  time.Time // 零值表示之后一直使用该偏移
+		offset int
+	}
+	var segments []segment
+	t := from
+	for i := 0; i < 1000; i++ {
+		local := t.In(loc)
+		_, offset := local.Zone()
+		_, end := local.ZoneBounds()
+		if end.IsZero() || !end.Before(to) {
+			segments = append(segments, segment{offset: offset})
+			break
+		}
+		segments = append(segments, segment{until: end, offset: offset})
+		t = end
+	}
+	modifier := func(offset int) string {
+		return fmt.Sprintf("'%+d minutes'", offset/60)
+	}
+	if len(segments) == 1 {
+		return fmt.Sprintf("datetime(%s, %s)", col, modifier(segments[0].offset))
+	}
+	var b strings.Builder
+	b.WriteString("datetime(" + col + ", CASE")
+	for _, s := range segments {
+		if s.until.IsZero() {
+			b.WriteString(" ELSE " + modifier(s.offset))
+			break
+		}
+		fmt.Fprintf(&b, " WHEN datetime(%s) < '%s' THEN %s", col, s.until.UTC().Format(sqlTimeLayout), modifier(s.offset))
+	}
+	b.WriteString(" END)")
+	return b.String()
+}
+
+// activityBucketExpr 本地时间表达式所在时间段的起始日期
+func activityBucketExpr(local, granularity string) string {
+	switch granularity {
+	case ActivityWeek:
+		return "date(" + local + ", 'weekday 0', '-6 days')" // 周一
+	case ActivityMonth:
+		return "strftime('%Y-%m-01', " + local + ")"
+	default:
+		return "date(" + local + ")"
+	}
+}
+
+// ActivityBucketStart 本地日期所在时间段的起始日（周从周一开始）
+func ActivityBucketStart(t time.Time, granularity string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	switch granularity {
+	case ActivityWeek:
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	case ActivityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return day
+	}
+}
+
+func nextActivityBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case ActivityWeek:
+		return t.AddDate(0, 0, 7)
+	case ActivityMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// ActivityBucketCount [from, to) 覆盖的时间段数
+func ActivityBucketCount(from, to time.Time, granularity string) int {
+	n := 0
+	for b := ActivityBucketStart(from, granularity); b.Before(to); b = nextActivityBucket(b, granularity) {
+		n++
+	}
+	return n
+}
+
+// GetActivityStats 按用户时区统计写作活动（分组与连续天数均在 SQL 中计算）
+func GetActivityStats(q ActivityQuery) (*ActivityStats, error) {
+	loc := q.Location
+	now := q.Now.In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	heatFrom := today.AddDate(-1, 0, 1)
+
+	// 时区偏移分段覆盖用户全部笔记（连续天数需要完整历史）
+	rangeFrom := q.From
+	if heatFrom.Before(rangeFrom) {
+		rangeFrom = heatFrom
+	}
+	var earliest string
+	if err := database.DB.QueryRow(`SELECT COALESCE(MIN(datetime(created_at)), '') FROM notes WHERE user_id = ?`, q.UserID).Scan(&earliest); err != nil {
+		return nil, err
+	}
+	if t, err := time.ParseInLocation(sqlTimeLayout, earliest, time.UTC); err == nil && t.Before(rangeFrom) {
+		rangeFrom = t
+	}
+	rangeTo := today.AddDate(0, 0, 1)
+	if q.To.After(rangeTo) {
+		rangeTo = q.To
+	}
+	created := localTimeExpr("n.created_at", loc, rangeFrom, rangeTo)
+	updated := localTimeExpr("n.updated_at", loc, rangeFrom, rangeTo)
+	from, to := q.From.UTC().Format(sqlTimeLayout), q.To.UTC().Format(sqlTimeLayout)
+
+	stats := &ActivityStats{
+		Timezone:    loc.String(),
+		From:        q.From.Format("2006-01-02"),
+		To:          q.To.AddDate(0, 0, -1).Format("2006-01-02"),
+		Granularity: q.Granularity,
+		Series:      []ActivityBucket{},
+		Tags:        []TagActivity{},
+	}
+
+	// 时间序列（补齐没有活动的时间段）
+	index := map[string]int{}
+	for b := ActivityBucketStart(q.From, q.Granularity); b.Before(q.To); b = nextActivityBucket(b, q.Granularity) {
+		key := b.Format("2006-01-02")
+		index[key] = len(stats.Series)
+		stats.Series = append(stats.Series, ActivityBucket{Bucket: key})
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+activityBucketExpr(created, q.Granularity)+`, COUNT(*), COALESCE(SUM(n.word_count), 0)
+		 FROM notes n WHERE n.user_id = ? AND datetime(n.created_at) >= ? AND datetime(n.created_at) < ?
+		 GROUP BY 1`,
+		q.UserID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		var count, words int
+		if err := rows.Scan(&key, &count, &words); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[key]; ok {
+			stats.Series[i].Created, stats.Series[i].Words = count, words
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	rows, err = database.DB.Query(
+		`SELECT `+activityBucketExpr(updated, q.Granularity)+`, COUNT(*)
+		 FROM notes n WHERE n.user_id = ? AND datetime(n.updated_at) >= ? AND datetime(n.updated_at) < ?
+		 AND datetime(n.updated_at) > datetime(n.created_at)
+		 GROUP BY 1`,
+		q.UserID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		var count int
+		if err := rows.Scan(&key, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := index[key]; ok {
+			stats.Series[i].Updated = count
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// 热力图：最近一年每天
+	stats.Heatmap = ActivityHeatmap{From: heatFrom.Format("2006-01-02"), To: today.Format("2006-01-02")}
+	dayIndex := map[string]int{}
+	for d := heatFrom; !d.After(today); d = d.AddDate(0, 0, 1) {
+		key := d.Format("2006-01-02")
+		dayIndex[key] = len(stats.Heatmap.Days)
+		stats.Heatmap.Days = append(stats.Heatmap.Days, HeatmapDay{Date: key})
+	}
+	rows, err = database.DB.Query(
+		`SELECT date(`+created+`), COUNT(*), COALESCE(SUM(n.word_count), 0)
+		 FROM notes n WHERE n.user_id = ? AND datetime(n.created_at) >= ? AND datetime(n.created_at) < ?
+		 GROUP BY 1`,
+		q.UserID, heatFrom.UTC().Format(sqlTimeLayout), today.AddDate(0, 0, 1).UTC().Format(sqlTimeLayout),
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key string
+		var count, words int
+		if err := rows.Scan(&key, &count, &words); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if i, ok := dayIndex[key]; ok {
+			stats.Heatmap.Days[i].Count, stats.Heatmap.Days[i].Words = count, words
+			stats.Heatmap.Total += count
+			if count > stats.Heatmap.Max {
+				stats.Heatmap.Max = count
+			}
+		}
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// 连续天数：有新建笔记的日期按“日期 - 序号”分组，同组即连续
+	streakSQL := `WITH days AS (
+			SELECT DISTINCT date(` + created + `) AS d FROM notes n WHERE n.user_id = ?
+		), runs AS (
+			SELECT d, julianday(d) - ROW_NUMBER() OVER (ORDER BY d) AS grp FROM days
+		)
+		SELECT MIN(d), MAX(d), COUNT(*) FROM runs GROUP BY grp`
+	var longestEnd string
+	if err := database.DB.QueryRow(streakSQL+` ORDER BY COUNT(*) DESC, MAX(d) DESC LIMIT 1`, q.UserID).
+		Scan(&stats.Streaks.LongestStart, &longestEnd, &stats.Streaks.Longest); err == nil {
+		stats.Streaks.LongestEnd = longestEnd
+	}
+	var lastStart, lastEnd string
+	var lastLen int
+	if err := database.DB.QueryRow(streakSQL+` ORDER BY MAX(d) DESC LIMIT 1`, q.UserID).Scan(&lastStart, &lastEnd, &lastLen); err == nil {
+		stats.Streaks.LastActive = lastEnd
+		if lastEnd == today.Format("2006-01-02") || lastEnd == today.AddDate(0, 0, -1).Format("2006-01-02") {
+			stats.Streaks.Current = lastLen
+		}
+	}
+
+	// 标签趋势：区间内最常用的几个标签
+	tagIndex := map[string]int{}
+	rows, err = database.DB.Query(
+		`SELECT `+activityBucketExpr(created, q.Granularity)+`, t.name, COUNT(*)
+		 FROM notes n JOIN note_tags nt ON nt.note_id = n.id JOIN tags t ON t.id = nt.tag_id
+		 WHERE n.user_id = ? AND datetime(n.created_at) >= ? AND datetime(n.created_at) < ?
+		 AND t.id IN (
+			SELECT nt2.tag_id FROM notes n2 JOIN note_tags nt2 ON nt2.note_id = n2.id
+			WHERE n2.user_id = ? AND datetime(n2.created_at) >= ? AND datetime(n2.created_at) < ?
+			GROUP BY nt2.tag_id ORDER BY COUNT(*) DESC, nt2.tag_id LIMIT ?
+		 )
+		 GROUP BY 1, t.id ORDER BY 1`,
+		q.UserID, from, to, q.UserID, from, to, activityTopTags,
+	)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var key, name string
+		var count int
+		if err := rows.Scan(&key, &name, &count); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		i, ok := tagIndex[name]
+		if !ok {
+			i = len(stats.Tags)
+			tagIndex[name] = i
+			stats.Tags = append(stats.Tags, TagActivity{Tag: name, Series: []TagBucketCount{}})
+		}
+		stats.Tags[i].Total += count
+		stats.Tags[i].Series = append(stats.Tags[i].Series, TagBucketCount{Bucket: key, Count: count})
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(stats.Tags, func(i, j int) bool {
+		if stats.Tags[i].Total != stats.Tags[j].Total {
+			return stats.Tags[i].Total > stats.Tags[j].Total
+		}
+		return stats.Tags[i].Tag < stats.Tags[j].Tag
+	})
+
+	// 最活跃的时段
+	rows, err = database.DB.Query(
+		`SELECT CAST(strftime('%H', `+created+`) AS INTEGER), COUNT(*)
+		 FROM notes n WHERE n.user_id = ? AND datetime(n.created_at) >= ? AND datetime(n.created_at) < ?
+		 GROUP BY 1`,
+		q.UserID, from, to,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var hour, count int
+		if err := rows.Scan(&hour, &count); err != nil {
+			return nil, err
+		}
+		if hour >= 0 && hour < 24 {
+			stats.BusiestHours[hour] = count
+		}
+	}
+	return stats, rows.Err()
+}
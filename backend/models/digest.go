@@ -0,0 +1,205 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"memo-studio/backend/database"
+	"time"
+)
+
+// 回顾周期
+const (
+	DigestWeekly  = "weekly"
+	DigestMonthly = "monthly"
+)
+
+// Digest 定期回顾报告
+type Digest struct {
+	ID            int             `json:"id"`
+	UserID        int             `json:"user_id"`
+	Period        string          `json:"period"`
+	PeriodStart   time.Time       `json:"period_start"`
+	PeriodEnd     time.Time       `json:"period_end"`
+	Timezone      string          `json:"timezone"`
+	Title         string          `json:"title"`
+	Content       string          `json:"content"` // Markdown
+	Data          json.RawMessage `json:"data"`    // 统计结果
+	Provider      string          `json:"provider"`
+	DeliveredAt   *time.Time      `json:"delivered_at,omitempty"`
+	DeliveryError string          `json:"delivery_error,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// TagCount 标签及使用次数
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// DigestNoteStats 时段内的笔记统计
+type DigestNoteStats struct {
+	Created int        `json:"notes_created"`
+	Updated int        `json:"notes_updated"` // 时段内修改过的此前创建的笔记
+	TopTags []TagCount `json:"top_tags"`
+}
+
+const digestColumns = `id, user_id, period, period_start, period_end, timezone, title, content, data, provider,
+	delivered_at, delivery_error, created_at`
+
+// digestTime 时段边界统一按 UTC 存储
+func digestTime(t time.Time) string {
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func scanDigest(scanner interface{ Scan(...any) error }) (*Digest, error) {
+	var d Digest
+	var data string
+	var delivered sql.NullTime
+	if err := scanner.Scan(&d.ID, &d.UserID, &d.Period, &d.PeriodStart, &d.PeriodEnd, &d.Timezone, &d.Title, &d.Content,
+		&data, &d.Provider, &delivered, &d.DeliveryError, &d.CreatedAt); err != nil {
+		return nil, err
+	}
+	d.Data = json.RawMessage(data)
+	if delivered.Valid {
+		t := delivered.Time
+		d.DeliveredAt = &t
+	}
+	return &d, nil
+}
+
+// CreateDigest 保存回顾；同一用户、周期、时段已存在时返回已有记录
+func CreateDigest(d Digest) (*Digest, error) {
+	data := string(d.Data)
+	if data == "" {
+		data = "{}"
+	}
+	_, err := database.DB.Exec(
+		`INSERT OR IGNORE INTO digests (user_id, period, period_start, period_end, timezone, title, content, data, provider)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		d.UserID, d.Period, digestTime(d.PeriodStart), digestTime(d.PeriodEnd), d.Timezone, d.Title, d.Content, data, d.Provider,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return GetDigestByPeriod(d.UserID, d.Period, d.PeriodStart)
+}
+
+// GetDigestByPeriod 按周期与起始时间查找；不存在时返回 nil, nil
+func GetDigestByPeriod(userID int, period string, start time.Time) (*Digest, error) {
+	row := database.DB.QueryRow(
+		`SELECT `+digestColumns+` FROM digests WHERE user_id = ? AND period = ? AND period_start = ?`,
+		userID, period, digestTime(start),
+	)
+	d, err := scanDigest(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// GetDigest 读取用户的回顾；不存在时返回 nil, nil
+func GetDigest(id, userID int) (*Digest, error) {
+	row := database.DB.QueryRow(`SELECT `+digestColumns+` FROM digests WHERE id = ? AND user_id = ?`, id, userID)
+	d, err := scanDigest(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return d, err
+}
+
+// ListDigests 按时段倒序列出用户的回顾；period 为空表示全部
+func ListDigests(userID int, period string, limit, offset int) ([]Digest, int, error) {
+	where := "user_id = ?"
+	args := []interface{}{userID}
+	if period != "" {
+		where += " AND period = ?"
+		args = append(args, period)
+	}
+	var total int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM digests WHERE `+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+digestColumns+` FROM digests WHERE `+where+` ORDER BY period_start DESC, id DESC LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	list := []Digest{}
+	for rows.Next() {
+		d, err := scanDigest(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, *d)
+	}
+	return list, total, rows.Err()
+}
+
+// DeleteDigest 删除回顾；不存在时返回 sql.ErrNoRows
+func DeleteDigest(id, userID int) error {
+	res, err := database.DB.Exec(`DELETE FROM digests WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// MarkDigestDelivery 记录推送结果：成功时写入 delivered_at，失败时记录错误
+func MarkDigestDelivery(id int, deliveryErr error) error {
+	if deliveryErr != nil {
+		_, err := database.DB.Exec(`UPDATE digests SET delivery_error = ? WHERE id = ?`, deliveryErr.Error(), id)
+		return err
+	}
+	_, err := database.DB.Exec(`UPDATE digests SET delivered_at = CURRENT_TIMESTAMP, delivery_error = '' WHERE id = ?`, id)
+	return err
+}
+
+// GetDigestNoteStats 统计时段 [from, to) 内新建、修改的笔记与最常用的标签（不含加密笔记）
+func GetDigestNoteStats(userID int, from, to time.Time, topTags int) (*DigestNoteStats, error) {
+	st := &DigestNoteStats{TopTags: []TagCount{}}
+	f, t := digestTime(from), digestTime(to)
+	err := database.DB.QueryRow(
+		`SELECT COUNT(*) FROM notes WHERE user_id = ? AND locked = 0
+		 AND datetime(created_at) >= datetime(?) AND datetime(created_at) < datetime(?)`,
+		userID, f, t,
+	).Scan(&st.Created)
+	if err != nil {
+		return nil, err
+	}
+	err = database.DB.QueryRow(
+		`SELECT COUNT(*) FROM notes WHERE user_id = ? AND locked = 0
+		 AND datetime(created_at) < datetime(?)
+		 AND datetime(updated_at) >= datetime(?) AND datetime(updated_at) < datetime(?)`,
+		userID, f, f, t,
+	).Scan(&st.Updated)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := database.DB.Query(
+		`SELECT t.name, COUNT(*) AS c FROM notes n
+		 JOIN note_tags nt ON nt.note_id = n.id
+		 JOIN tags t ON t.id = nt.tag_id
+		 WHERE n.user_id = ? AND n.locked = 0
+		 AND datetime(n.created_at) >= datetime(?) AND datetime(n.created_at) < datetime(?)
+		 GROUP BY t.id ORDER BY c DESC, t.name LIMIT ?`,
+		userID, f, t, topTags,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tc TagCount
+		if err := rows.Scan(&tc.Name, &tc.Count); err != nil {
+			return nil, err
+		}
+		st.TopTags = append(st.TopTags, tc)
+	}
+	return st, rows.Err()
+}
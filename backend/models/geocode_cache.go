@@ -0,0 +1,54 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"time"
+)
+
+// GeocodeCacheEntry 在线地理编码结果缓存；Found 为 false 表示该服务查不到（同样缓存，避免重复请求）
+type GeocodeCacheEntry struct {
+	Provider  string    `json:"provider"`
+	Query     string    `json:"query"` // 归一化后的查询
+	Found     bool      `json:"found"`
+	Name      string    `json:"name"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Kind      string    `json:"kind"`
+	Country   string    `json:"country"`
+	Admin     string    `json:"admin"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// GetGeocodeCache 读取未过期的缓存；未命中返回 nil, nil
+func GetGeocodeCache(provider, query string, now time.Time) (*GeocodeCacheEntry, error) {
+	var e GeocodeCacheEntry
+	err := database.DB.QueryRow(
+		`SELECT provider, query, found, name, latitude, longitude, kind, country, admin, created_at, expires_at
+		 FROM geocode_cache WHERE provider = ? AND query = ? AND expires_at > ?`,
+		provider, query, now.UTC(),
+	).Scan(&e.Provider, &e.Query, &e.Found, &e.Name, &e.Latitude, &e.Longitude, &e.Kind, &e.Country, &e.Admin,
+		&e.CreatedAt, &e.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// PutGeocodeCache 写入或覆盖缓存
+func PutGeocodeCache(e GeocodeCacheEntry) error {
+	_, err := database.DB.Exec(
+		`INSERT INTO geocode_cache (provider, query, found, name, latitude, longitude, kind, country, admin, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		 ON CONFLICT(provider, query) DO UPDATE SET found = excluded.found, name = excluded.name,
+		   latitude = excluded.latitude, longitude = excluded.longitude, kind = excluded.kind,
+		   country = excluded.country, admin = excluded.admin, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		e.Provider, e.Query, e.Found, e.Name, e.Latitude, e.Longitude, e.Kind, e.Country, e.Admin,
+		e.CreatedAt.UTC(), e.ExpiresAt.UTC(),
+	)
+	return err
+}
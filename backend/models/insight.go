@@ -0,0 +1,137 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"memo-studio/backend/database"
+	"time"
+)
+
+// MaxInsightHistory 每个用户保留的洞察历史条数，超出时删除最早的记录
+const MaxInsightHistory = 200
+
+// SavedInsight 保存的洞察：生成参数、时间窗口、结果与离线统计快照
+type SavedInsight struct {
+	ID          int             `json:"id"`
+	UserID      int             `json:"user_id"`
+	Params      json.RawMessage `json:"params"`
+	PeriodStart *time.Time      `json:"period_start,omitempty"` // 不限时为空
+	PeriodEnd   *time.Time      `json:"period_end,omitempty"`
+	Provider    string          `json:"provider"`
+	Summary     string          `json:"summary"`
+	NoteCount   int             `json:"note_count"`
+	Data        json.RawMessage `json:"data,omitempty"`  // 完整的洞察结果；列表中不返回
+	Stats       json.RawMessage `json:"stats,omitempty"` // 关键词、情感等统计快照；列表中不返回
+	CreatedAt   time.Time       `json:"created_at"`
+}
+
+const insightColumns = `id, user_id, params, period_start, period_end, provider, summary, note_count, data, stats, created_at`
+
+func scanSavedInsight(scanner interface{ Scan(...any) error }) (*SavedInsight, error) {
+	var in SavedInsight
+	var params, data, stats string
+	var start, end sql.NullTime
+	if err := scanner.Scan(&in.ID, &in.UserID, &params, &start, &end, &in.Provider, &in.Summary, &in.NoteCount,
+		&data, &stats, &in.CreatedAt); err != nil {
+		return nil, err
+	}
+	in.Params, in.Data, in.Stats = json.RawMessage(params), json.RawMessage(data), json.RawMessage(stats)
+	if start.Valid {
+		t := start.Time
+		in.PeriodStart = &t
+	}
+	if end.Valid {
+		t := end.Time
+		in.PeriodEnd = &t
+	}
+	return &in, nil
+}
+
+// nullableTime 时间窗口边界按 UTC 存储，nil 存为 NULL
+func nullableTime(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return digestTime(*t)
+}
+
+func rawOrEmpty(raw json.RawMessage) string {
+	if len(raw) == 0 {
+		return "{}"
+	}
+	return string(raw)
+}
+
+// CreateSavedInsight 保存洞察并清理超出 MaxInsightHistory 的旧记录
+func CreateSavedInsight(in SavedInsight) (*SavedInsight, error) {
+	res, err := database.DB.Exec(
+		`INSERT INTO insights (user_id, params, period_start, period_end, provider, summary, note_count, data, stats)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		in.UserID, rawOrEmpty(in.Params), nullableTime(in.PeriodStart), nullableTime(in.PeriodEnd), in.Provider, in.Summary,
+		in.NoteCount, rawOrEmpty(in.Data), rawOrEmpty(in.Stats),
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := database.DB.Exec(
+		`DELETE FROM insights WHERE user_id = ? AND id NOT IN (
+			SELECT id FROM insights WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ?
+		)`,
+		in.UserID, in.UserID, MaxInsightHistory,
+	); err != nil {
+		return nil, err
+	}
+	return GetSavedInsight(int(id), in.UserID)
+}
+
+// GetSavedInsight 读取用户保存的洞察；不存在时返回 nil, nil
+func GetSavedInsight(id, userID int) (*SavedInsight, error) {
+	row := database.DB.QueryRow(`SELECT `+insightColumns+` FROM insights WHERE id = ? AND user_id = ?`, id, userID)
+	in, err := scanSavedInsight(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return in, err
+}
+
+// ListSavedInsights 按生成时间倒序列出洞察历史（不含 data 与 stats）
+func ListSavedInsights(userID, limit, offset int) ([]SavedInsight, int, error) {
+	var total int
+	if err := database.DB.QueryRow(`SELECT COUNT(*) FROM insights WHERE user_id = ?`, userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+insightColumns+` FROM insights WHERE user_id = ? ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?`,
+		userID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	list := []SavedInsight{}
+	for rows.Next() {
+		in, err := scanSavedInsight(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		in.Data, in.Stats = nil, nil
+		list = append(list, *in)
+	}
+	return list, total, rows.Err()
+}
+
+// DeleteSavedInsight 删除洞察；不存在时返回 sql.ErrNoRows
+func DeleteSavedInsight(id, userID int) error {
+	res, err := database.DB.Exec(`DELETE FROM insights WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"memo-studio/backend/database"
+	"os"
+	"strings"
+)
+
+// 注册模式
+const (
+	RegistrationOpen   = "open"   // 任何人可注册
+	RegistrationInvite = "invite" // 需要邀请码
+	RegistrationClosed = "closed" // 关闭注册（仅管理员创建用户）
+	RegistrationDomain = "domain" // 邮箱域名白名单（持有邀请码也可注册）
+)
+
+const (
+	settingRegistrationMode    = "registration_mode"
+	settingRegistrationDomains = "registration_domains"
+)
+
+// RegistrationPolicy 注册策略
+type RegistrationPolicy struct {
+	Mode           string   `json:"mode"`
+	AllowedDomains []string `json:"allowed_domains"`
+}
+
+// InviteRequired 该模式下是否必须使用邀请码
+func (p RegistrationPolicy) InviteRequired() bool {
+	return p.Mode == RegistrationInvite
+}
+
+// DomainAllowed 邮箱域名是否在白名单内（支持 *.example.com 匹配子域名）
+func (p RegistrationPolicy) DomainAllowed(email string) bool {
+	at := strings.LastIndex(email, "@")
+	if at < 0 || at == len(email)-1 {
+		return false
+	}
+	domain := strings.ToLower(strings.TrimSpace(email[at+1:]))
+	for _, d := range p.AllowedDomains {
+		if strings.HasPrefix(d, "*.") {
+			if strings.HasSuffix(domain, d[1:]) {
+				return true
+			}
+			continue
+		}
+		if domain == d {
+			return true
+		}
+	}
+	return false
+}
+
+// IsValidRegistrationMode 校验注册模式
+func IsValidRegistrationMode(mode string) bool {
+	switch mode {
+	case RegistrationOpen, RegistrationInvite, RegistrationClosed, RegistrationDomain:
+		return true
+	}
+	return false
+}
+
+// GetSetting 读取实例设置；不存在时返回 "", false
+func GetSetting(key string) (string, bool, error) {
+	var v string
+	err := database.DB.QueryRow(`SELECT value FROM instance_settings WHERE key = ?`, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// SetSetting 写入实例设置
+func SetSetting(key, value string) error {
+	_, err := database.DB.Exec(
+		`INSERT INTO instance_settings (key, value, updated_at) VALUES (?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		key, value,
+	)
+	return err
+}
+
+func normalizeDomains(list []string) []string {
+	out := make([]string, 0, len(list))
+	seen := map[string]bool{}
+	for _, d := range list {
+		d = strings.ToLower(strings.TrimSpace(d))
+		d = strings.TrimPrefix(d, "@")
+		if d == "" || seen[d] {
+			continue
+		}
+		seen[d] = true
+		out = append(out, d)
+	}
+	return out
+}
+
+// GetRegistrationPolicy 获取注册策略：数据库设置优先，其次环境变量
+// MEMO_REGISTRATION_MODE / MEMO_REGISTRATION_DOMAINS，默认 open。
+func GetRegistrationPolicy() (RegistrationPolicy, error) {
+	p := RegistrationPolicy{
+		Mode:           strings.ToLower(strings.TrimSpace(os.Getenv("MEMO_REGISTRATION_MODE"))),
+		AllowedDomains: normalizeDomains(strings.Split(os.Getenv("MEMO_REGISTRATION_DOMAINS"), ",")),
+	}
+	if v, ok, err := GetSetting(settingRegistrationMode); err != nil {
+		return p, err
+	} else if ok {
+		p.Mode = v
+	}
+	if v, ok, err := GetSetting(settingRegistrationDomains); err != nil {
+		return p, err
+	} else if ok {
+		p.AllowedDomains = normalizeDomains(strings.Split(v, ","))
+	}
+	if !IsValidRegistrationMode(p.Mode) {
+		p.Mode = RegistrationOpen
+	}
+	return p, nil
+}
+
+// SetRegistrationPolicy 保存注册策略
+func SetRegistrationPolicy(p RegistrationPolicy) (RegistrationPolicy, error) {
+	p.Mode = strings.ToLower(strings.TrimSpace(p.Mode))
+	if !IsValidRegistrationMode(p.Mode) {
+		return p, fmt.Errorf("无效的注册模式: %s", p.Mode)
+	}
+	p.AllowedDomains = normalizeDomains(p.AllowedDomains)
+	if p.Mode == RegistrationDomain && len(p.AllowedDomains) == 0 {
+		return p, fmt.Errorf("域名白名单模式需要至少一个域名")
+	}
+	if err := SetSetting(settingRegistrationMode, p.Mode); err != nil {
+		return p, err
+	}
+	if err := SetSetting(settingRegistrationDomains, strings.Join(p.AllowedDomains, ",")); err != nil {
+		return p, err
+	}
+	return p, nil
+}
@@ -0,0 +1,189 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"memo-studio/backend/database"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrInviteInvalid 邀请码不存在、已撤销、已过期或次数已用完
+var ErrInviteInvalid = errors.New("邀请码无效或已失效")
+
+// InviteCode 注册邀请码
+type InviteCode struct {
+	ID        int        `json:"id"`
+	Code      string     `json:"code"`
+	CreatedBy *int       `json:"created_by,omitempty"`
+	Role      string     `json:"role"`     // 注册后授予的角色
+	MaxUses   int        `json:"max_uses"` // 0 表示不限次数
+	Uses      int        `json:"uses"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Note      string     `json:"note"`
+	Revoked   bool       `json:"revoked"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// Usable 邀请码当前是否可用
+func (i *InviteCode) Usable(now time.Time) bool {
+	if i.Revoked {
+		return false
+	}
+	if i.MaxUses > 0 && i.Uses >= i.MaxUses {
+		return false
+	}
+	if i.ExpiresAt != nil && !now.Before(*i.ExpiresAt) {
+		return false
+	}
+	return true
+}
+
+type CreateInviteInput struct {
+	Code      string
+	CreatedBy int
+	Role      string
+	MaxUses   int
+	ExpiresAt *time.Time
+	Note      string
+}
+
+const inviteColumns = `id, code, created_by, role, max_uses, uses, expires_at, note, revoked, created_at`
+
+func scanInvite(scanner interface{ Scan(...any) error }) (*InviteCode, error) {
+	var inv InviteCode
+	var createdBy sql.NullInt64
+	var expiresAt sql.NullTime
+	if err := scanner.Scan(&inv.ID, &inv.Code, &createdBy, &inv.Role, &inv.MaxUses, &inv.Uses, &expiresAt, &inv.Note, &inv.Revoked, &inv.CreatedAt); err != nil {
+		return nil, err
+	}
+	if createdBy.Valid {
+		v := int(createdBy.Int64)
+		inv.CreatedBy = &v
+	}
+	if expiresAt.Valid {
+		t := expiresAt.Time
+		inv.ExpiresAt = &t
+	}
+	return &inv, nil
+}
+
+// CreateInviteCode 创建邀请码
+func CreateInviteCode(in CreateInviteInput) (*InviteCode, error) {
+	if in.Role == "" {
+		in.Role = RoleEditor
+	}
+	var expires interface{}
+	if in.ExpiresAt != nil {
+		expires = in.ExpiresAt.UTC()
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO invite_codes (code, created_by, role, max_uses, expires_at, note) VALUES (?, ?, ?, ?, ?, ?)`,
+		in.Code, in.CreatedBy, in.Role, in.MaxUses, expires, strings.TrimSpace(in.Note),
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetInviteCode(int(id))
+}
+
+// GetInviteCode 根据 ID 获取邀请码
+func GetInviteCode(id int) (*InviteCode, error) {
+	return scanInvite(database.DB.QueryRow(`SELECT `+inviteColumns+` FROM invite_codes WHERE id = ?`, id))
+}
+
+// ListInviteCodes 列出全部邀请码（最新在前）
+func ListInviteCodes() ([]InviteCode, error) {
+	rows, err := database.DB.Query(`SELECT ` + inviteColumns + ` FROM invite_codes ORDER BY created_at DESC, id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []InviteCode
+	for rows.Next() {
+		inv, err := scanInvite(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *inv)
+	}
+	return list, rows.Err()
+}
+
+// RevokeInviteCode 撤销邀请码（保留记录用于审计）
+func RevokeInviteCode(id int) error {
+	res, err := database.DB.Exec(`UPDATE invite_codes SET revoked = 1 WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// RegisterUser 自助注册：inviteCode 非空时在同一事务内核销邀请码，并按邀请码角色创建用户
+func RegisterUser(username, password, email, inviteCode string) (*User, error) {
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	role := RoleEditor
+	var inviteID interface{}
+	if code := strings.TrimSpace(inviteCode); code != "" {
+		inv, err := scanInvite(tx.QueryRow(`SELECT `+inviteColumns+` FROM invite_codes WHERE code = ?`, code))
+		if err == sql.ErrNoRows {
+			return nil, ErrInviteInvalid
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !inv.Usable(time.Now()) {
+			return nil, ErrInviteInvalid
+		}
+		// 条件更新防止并发超用
+		res, err := tx.Exec(
+			`UPDATE invite_codes SET uses = uses + 1 WHERE id = ? AND revoked = 0 AND (max_uses = 0 OR uses < max_uses)`,
+			inv.ID,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return nil, ErrInviteInvalid
+		}
+		if IsValidRole(inv.Role) {
+			role = inv.Role
+		}
+		inviteID = inv.ID
+	}
+
+	res, err := tx.Exec(
+		"INSERT INTO users (username, password, email, is_admin, role, invite_id) VALUES (?, ?, ?, ?, ?, ?)",
+		username, string(hashedPassword), email, role == RoleAdmin, role, inviteID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	userID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetUserByID(int(userID))
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"strings"
+	"time"
+)
+
+// LLMCacheEntry 大模型响应缓存
+type LLMCacheEntry struct {
+	Key        string    `json:"key"`
+	UserID     *int      `json:"user_id,omitempty"`
+	Template   string    `json:"template"`
+	Provider   string    `json:"provider"`
+	Model      string    `json:"model"`
+	Response   string    `json:"-"`
+	AnsweredBy string    `json:"answered_by"`
+	Hits       int       `json:"hits"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// LLMCacheStats 缓存统计
+type LLMCacheStats struct {
+	Entries int   `json:"entries"`
+	Expired int   `json:"expired"`
+	Hits    int64 `json:"hits"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// GetLLMCache 读取未过期的缓存并累加命中次数；未命中返回 nil, nil
+func GetLLMCache(key string, now time.Time) (*LLMCacheEntry, error) {
+	var e LLMCacheEntry
+	var userID sql.NullInt64
+	err := database.DB.QueryRow(
+		`SELECT cache_key, user_id, template, provider, model, response, answered_by, hits, created_at, expires_at
+		 FROM llm_cache WHERE cache_key = ? AND expires_at > ?`,
+		key, now.UTC(),
+	).Scan(&e.Key, &userID, &e.Template, &e.Provider, &e.Model, &e.Response, &e.AnsweredBy, &e.Hits, &e.CreatedAt, &e.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		v := int(userID.Int64)
+		e.UserID = &v
+	}
+	_, _ = database.DB.Exec(`UPDATE llm_cache SET hits = hits + 1 WHERE cache_key = ?`, key)
+	e.Hits++
+	return &e, nil
+}
+
+// PutLLMCache 写入缓存，并关联输入涉及的笔记（笔记修改后缓存自动失效）
+func PutLLMCache(e LLMCacheEntry, noteIDs []int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner interface{}
+	if e.UserID != nil {
+		owner = *e.UserID
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO llm_cache (cache_key, user_id, template, provider, model, response, answered_by, hits, created_at, expires_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?, ?)
+		 ON CONFLICT(cache_key) DO UPDATE SET response = excluded.response, answered_by = excluded.answered_by,
+		   hits = 0, created_at = excluded.created_at, expires_at = excluded.expires_at`,
+		e.Key, owner, e.Template, e.Provider, e.Model, e.Response, e.AnsweredBy, e.CreatedAt.UTC(), e.ExpiresAt.UTC(),
+	); err != nil {
+		return err
+	}
+	for _, id := range noteIDs {
+		if _, err := tx.Exec(`INSERT OR IGNORE INTO llm_cache_notes (cache_key, note_id) VALUES (?, ?)`, e.Key, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FindNoteIDsByContent 按正文匹配用户的笔记（客户端直接提交笔记文本时用于建立缓存关联）
+func FindNoteIDsByContent(userID int, contents []string) ([]int, error) {
+	var ids []int
+	seen := map[int]bool{}
+	for _, content := range contents {
+		content = strings.TrimSpace(content)
+		if content == "" {
+			continue
+		}
+		rows, err := database.DB.Query(`SELECT id FROM notes WHERE user_id = ? AND trim(content) = ?`, userID, content)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return ids, nil
+}
+
+// PurgeLLMCache 清除缓存；userID 非空时只清除该用户，expiredOnly 时只清除已过期条目
+func PurgeLLMCache(userID *int, expiredOnly bool, now time.Time) (int64, error) {
+	where := []string{"1 = 1"}
+	var args []interface{}
+	if userID != nil {
+		where = append(where, "user_id = ?")
+		args = append(args, *userID)
+	}
+	if expiredOnly {
+		where = append(where, "expires_at <= ?")
+		args = append(args, now.UTC())
+	}
+	res, err := database.DB.Exec(`DELETE FROM llm_cache WHERE `+strings.Join(where, " AND "), args...)
+	if err != nil {
+		return 0, err
+	}
+	// 外键级联依赖连接级 PRAGMA，这里显式清理孤立的关联
+	if _, err := database.DB.Exec(`DELETE FROM llm_cache_notes WHERE cache_key NOT IN (SELECT cache_key FROM llm_cache)`); err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetLLMCacheStats 缓存统计
+func GetLLMCacheStats(now time.Time) (LLMCacheStats, error) {
+	var st LLMCacheStats
+	err := database.DB.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(CASE WHEN expires_at <= ? THEN 1 ELSE 0 END), 0),
+		        COALESCE(SUM(hits), 0), COALESCE(SUM(length(response)), 0)
+		 FROM llm_cache`,
+		now.UTC(),
+	).Scan(&st.Entries, &st.Expired, &st.Hits, &st.Bytes)
+	return st, err
+}
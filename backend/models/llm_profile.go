@@ -0,0 +1,235 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"strings"
+	"time"
+)
+
+// LLMProfile 大模型配置；UserID 为空表示管理员设置的实例默认配置
+type LLMProfile struct {
+	ID               int       `json:"id"`
+	UserID           *int      `json:"user_id,omitempty"`
+	Name             string    `json:"name"`
+	Provider         string    `json:"provider"`
+	BaseURL          string    `json:"base_url"`
+	Model            string    `json:"model"`
+	APIKeyEnc        string    `json:"-"` // 加密后的 API Key
+	MaxTokens        int       `json:"max_tokens"`
+	Active           bool      `json:"active"`
+	FallbackPriority int       `json:"fallback_priority"` // >0 时参与备用模型链，越小越优先
+	CreatedAt        time.Time `json:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+// HasAPIKey 是否保存了 API Key
+func (p *LLMProfile) HasAPIKey() bool {
+	return p.APIKeyEnc != ""
+}
+
+type LLMProfileInput struct {
+	Name      string
+	Provider  string
+	BaseURL   string
+	Model     string
+	APIKeyEnc *string // nil 表示不修改
+	MaxTokens int
+
+	FallbackPriority int
+}
+
+const llmProfileColumns = `id, user_id, name, provider, base_url, model, api_key_enc, max_tokens, active, fallback_priority, created_at, updated_at`
+
+func scanLLMProfile(scanner interface{ Scan(...any) error }) (*LLMProfile, error) {
+	var p LLMProfile
+	var userID sql.NullInt64
+	if err := scanner.Scan(&p.ID, &userID, &p.Name, &p.Provider, &p.BaseURL, &p.Model, &p.APIKeyEnc, &p.MaxTokens, &p.Active, &p.FallbackPriority, &p.CreatedAt, &p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		v := int(userID.Int64)
+		p.UserID = &v
+	}
+	return &p, nil
+}
+
+// ownerClause userID 为 nil 时匹配实例默认配置
+func ownerClause(userID *int) (string, []interface{}) {
+	if userID == nil {
+		return "user_id IS NULL", nil
+	}
+	return "user_id = ?", []interface{}{*userID}
+}
+
+// ListLLMProfiles 列出某用户（或实例）的全部配置
+func ListLLMProfiles(userID *int) ([]LLMProfile, error) {
+	where, args := ownerClause(userID)
+	rows, err := database.DB.Query(`SELECT `+llmProfileColumns+` FROM llm_profiles WHERE `+where+` ORDER BY id ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LLMProfile
+	for rows.Next() {
+		p, err := scanLLMProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
+
+// GetLLMProfile 获取配置（限定归属）；不存在时返回 nil, nil
+func GetLLMProfile(id int, userID *int) (*LLMProfile, error) {
+	where, args := ownerClause(userID)
+	args = append([]interface{}{id}, args...)
+	p, err := scanLLMProfile(database.DB.QueryRow(`SELECT `+llmProfileColumns+` FROM llm_profiles WHERE id = ? AND `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// GetActiveLLMProfile 获取当前启用的配置；未设置时返回 nil, nil
+func GetActiveLLMProfile(userID *int) (*LLMProfile, error) {
+	where, args := ownerClause(userID)
+	p, err := scanLLMProfile(database.DB.QueryRow(`SELECT `+llmProfileColumns+` FROM llm_profiles WHERE active = 1 AND `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return p, err
+}
+
+// CreateLLMProfile 新建配置；activate 为 true 时同时设为启用
+func CreateLLMProfile(userID *int, in LLMProfileInput, activate bool) (*LLMProfile, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	apiKey := ""
+	if in.APIKeyEnc != nil {
+		apiKey = *in.APIKeyEnc
+	}
+	var owner interface{}
+	if userID != nil {
+		owner = *userID
+	}
+	res, err := tx.Exec(
+		`INSERT INTO llm_profiles (user_id, name, provider, base_url, model, api_key_enc, max_tokens, fallback_priority) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		owner, strings.TrimSpace(in.Name), in.Provider, in.BaseURL, in.Model, apiKey, in.MaxTokens, in.FallbackPriority,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	if activate {
+		if err := activateLLMProfileTx(tx, int(id), userID); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetLLMProfile(int(id), userID)
+}
+
+// UpdateLLMProfile 修改配置；不存在时返回 nil, nil
+func UpdateLLMProfile(id int, userID *int, in LLMProfileInput) (*LLMProfile, error) {
+	where, args := ownerClause(userID)
+	sets := []string{"name = ?", "provider = ?", "base_url = ?", "model = ?", "max_tokens = ?", "fallback_priority = ?"}
+	vals := []interface{}{strings.TrimSpace(in.Name), in.Provider, in.BaseURL, in.Model, in.MaxTokens, in.FallbackPriority}
+	if in.APIKeyEnc != nil {
+		sets = append(sets, "api_key_enc = ?")
+		vals = append(vals, *in.APIKeyEnc)
+	}
+	vals = append(vals, id)
+	vals = append(vals, args...)
+	res, err := database.DB.Exec(
+		`UPDATE llm_profiles SET `+strings.Join(sets, ", ")+`, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND `+where,
+		vals...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return GetLLMProfile(id, userID)
+}
+
+// DeleteLLMProfile 删除配置
+func DeleteLLMProfile(id int, userID *int) error {
+	where, args := ownerClause(userID)
+	res, err := database.DB.Exec(`DELETE FROM llm_profiles WHERE id = ? AND `+where, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func activateLLMProfileTx(tx *sql.Tx, id int, userID *int) error {
+	where, args := ownerClause(userID)
+	if _, err := tx.Exec(`UPDATE llm_profiles SET active = 0 WHERE active = 1 AND `+where, args...); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`UPDATE llm_profiles SET active = 1, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND `+where, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ActivateLLMProfile 设为启用（同一归属下其余配置自动停用）
+func ActivateLLMProfile(id int, userID *int) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := activateLLMProfileTx(tx, id, userID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeactivateLLMProfiles 停用全部配置；用户随后回落到实例默认配置
+func DeactivateLLMProfiles(userID *int) error {
+	where, args := ownerClause(userID)
+	_, err := database.DB.Exec(`UPDATE llm_profiles SET active = 0 WHERE active = 1 AND `+where, args...)
+	return err
+}
+
+// ListLLMFallbackProfiles 参与备用模型链的配置（按优先级排序）
+func ListLLMFallbackProfiles(userID *int) ([]LLMProfile, error) {
+	where, args := ownerClause(userID)
+	rows, err := database.DB.Query(
+		`SELECT `+llmProfileColumns+` FROM llm_profiles WHERE fallback_priority > 0 AND `+where+` ORDER BY fallback_priority ASC, id ASC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LLMProfile
+	for rows.Next() {
+		p, err := scanLLMProfile(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *p)
+	}
+	return list, rows.Err()
+}
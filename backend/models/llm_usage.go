@@ -0,0 +1,311 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LLMUsage 一次大模型调用记录
+type LLMUsage struct {
+	ID               int       `json:"id"`
+	UserID           *int      `json:"user_id,omitempty"`
+	Endpoint         string    `json:"endpoint"`
+	Provider         string    `json:"provider"`
+	Model            string    `json:"model"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	TotalTokens      int       `json:"total_tokens"`
+	LatencyMs        int64     `json:"latency_ms"`
+	Success          bool      `json:"success"`
+	ErrorKind        string    `json:"error_kind,omitempty"`
+	Fallback         bool      `json:"fallback"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// RecordLLMUsage 写入调用记录
+func RecordLLMUsage(u LLMUsage) error {
+	var owner interface{}
+	if u.UserID != nil {
+		owner = *u.UserID
+	}
+	if u.TotalTokens == 0 {
+		u.TotalTokens = u.PromptTokens + u.CompletionTokens
+	}
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now()
+	}
+	_, err := database.DB.Exec(
+		`INSERT INTO llm_usage (user_id, endpoint, provider, model, prompt_tokens, completion_tokens, total_tokens, latency_ms, success, error_kind, fallback, created_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		owner, u.Endpoint, u.Provider, u.Model, u.PromptTokens, u.CompletionTokens, u.TotalTokens,
+		u.LatencyMs, u.Success, u.ErrorKind, u.Fallback, u.CreatedAt.UTC(),
+	)
+	return err
+}
+
+// TokensUsedSince 用户自 since 起消耗的 token（仅统计成功调用）
+func TokensUsedSince(userID int, since time.Time) (int64, error) {
+	var n int64
+	err := database.DB.QueryRow(
+		`SELECT COALESCE(SUM(total_tokens), 0) FROM llm_usage WHERE user_id = ? AND success = 1 AND created_at >= ?`,
+		userID, since.UTC(),
+	).Scan(&n)
+	return n, err
+}
+
+// UsageTotals 汇总
+type UsageTotals struct {
+	Calls            int     `json:"calls"`
+	FailedCalls      int     `json:"failed_calls"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	TotalTokens      int64   `json:"total_tokens"`
+	AvgLatencyMs     float64 `json:"avg_latency_ms"`
+}
+
+// UsageGroup 分组汇总（按日期、模型、接口或用户）
+type UsageGroup struct {
+	Key      string `json:"key"`
+	UserID   int    `json:"user_id,omitempty"`
+	Username string `json:"username,omitempty"`
+	UsageTotals
+}
+
+const usageAggregates = `COUNT(*), COALESCE(SUM(CASE WHEN success = 0 THEN 1 ELSE 0 END), 0),
+	COALESCE(SUM(prompt_tokens), 0), COALESCE(SUM(completion_tokens), 0), COALESCE(SUM(total_tokens), 0),
+	COALESCE(AVG(latency_ms), 0)`
+
+func scanTotals(scanner interface{ Scan(...any) error }, extra ...any) (UsageTotals, error) {
+	var t UsageTotals
+	dest := append(extra, &t.Calls, &t.FailedCalls, &t.PromptTokens, &t.CompletionTokens, &t.TotalTokens, &t.AvgLatencyMs)
+	err := scanner.Scan(dest...)
+	return t, err
+}
+
+// usageFilter userID 为 nil 时统计全部用户
+func usageFilter(userID *int, from, to time.Time) (string, []interface{}) {
+	where := `created_at >= ? AND created_at < ?`
+	args := []interface{}{from.UTC(), to.UTC()}
+	if userID != nil {
+		where += ` AND user_id = ?`
+		args = append(args, *userID)
+	}
+	return where, args
+}
+
+// GetUsageTotals 区间汇总
+func GetUsageTotals(userID *int, from, to time.Time) (UsageTotals, error) {
+	where, args := usageFilter(userID, from, to)
+	return scanTotals(database.DB.QueryRow(`SELECT `+usageAggregates+` FROM llm_usage WHERE `+where, args...))
+}
+
+// GetUsageByModel 按 厂商/模型 分组
+func GetUsageByModel(userID *int, from, to time.Time) ([]UsageGroup, error) {
+	where, args := usageFilter(userID, from, to)
+	return queryUsageGroups(`SELECT provider || '/' || model, `+usageAggregates+` FROM llm_usage WHERE `+where+
+		` GROUP BY provider, model ORDER BY SUM(total_tokens) DESC`, args...)
+}
+
+// GetUsageByEndpoint 按接口分组
+func GetUsageByEndpoint(userID *int, from, to time.Time) ([]UsageGroup, error) {
+	where, args := usageFilter(userID, from, to)
+	return queryUsageGroups(`SELECT endpoint, `+usageAggregates+` FROM llm_usage WHERE `+where+
+		` GROUP BY endpoint ORDER BY SUM(total_tokens) DESC`, args...)
+}
+
+// GetUsageByDay 按日期分组；offset 为时区偏移，使“日”与用户所在时区一致
+func GetUsageByDay(userID *int, from, to time.Time, offset time.Duration) ([]UsageGroup, error) {
+	where, args := usageFilter(userID, from, to)
+	mod := strconv.Itoa(int(offset.Seconds())) + " seconds"
+	args = append([]interface{}{mod}, args...)
+	return queryUsageGroups(`SELECT date(substr(created_at, 1, 19), ?) AS day, `+usageAggregates+` FROM llm_usage WHERE `+where+
+		` GROUP BY day ORDER BY day ASC`, args...)
+}
+
+// GetUsageByUser 按用户分组（管理员报表）
+func GetUsageByUser(from, to time.Time) ([]UsageGroup, error) {
+	where, args := usageFilter(nil, from, to)
+	rows, err := database.DB.Query(
+		`SELECT COALESCE(u.user_id, 0), COALESCE(users.username, ''), `+usageAggregates+`
+		 FROM llm_usage u LEFT JOIN users ON users.id = u.user_id
+		 WHERE `+strings.ReplaceAll(where, "created_at", "u.created_at")+`
+		 GROUP BY u.user_id ORDER BY SUM(total_tokens) DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []UsageGroup{}
+	for rows.Next() {
+		var g UsageGroup
+		t, err := scanTotals(rows, &g.UserID, &g.Username)
+		if err != nil {
+			return nil, err
+		}
+		g.UsageTotals = t
+		g.Key = strconv.Itoa(g.UserID)
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+func queryUsageGroups(query string, args ...interface{}) ([]UsageGroup, error) {
+	rows, err := database.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []UsageGroup{}
+	for rows.Next() {
+		var g UsageGroup
+		t, err := scanTotals(rows, &g.Key)
+		if err != nil {
+			return nil, err
+		}
+		g.UsageTotals = t
+		list = append(list, g)
+	}
+	return list, rows.Err()
+}
+
+// ===== 配额 =====
+
+const (
+	settingLLMDailyTokens   = "llm_daily_tokens"
+	settingLLMMonthlyTokens = "llm_monthly_tokens"
+)
+
+// LLMQuota token 配额，0 表示不限
+type LLMQuota struct {
+	DailyTokens   int64 `json:"daily_tokens"`
+	MonthlyTokens int64 `json:"monthly_tokens"`
+}
+
+// LLMQuotaOverride 用户级覆盖，nil 字段沿用实例默认值
+type LLMQuotaOverride struct {
+	UserID        int    `json:"user_id"`
+	Username      string `json:"username,omitempty"`
+	DailyTokens   *int64 `json:"daily_tokens"`
+	MonthlyTokens *int64 `json:"monthly_tokens"`
+}
+
+func parseQuotaValue(v string) int64 {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// GetDefaultLLMQuota 实例默认配额：数据库设置优先，其次 MEMO_LLM_DAILY_TOKENS / MEMO_LLM_MONTHLY_TOKENS
+func GetDefaultLLMQuota() (LLMQuota, error) {
+	q := LLMQuota{
+		DailyTokens:   parseQuotaValue(os.Getenv("MEMO_LLM_DAILY_TOKENS")),
+		MonthlyTokens: parseQuotaValue(os.Getenv("MEMO_LLM_MONTHLY_TOKENS")),
+	}
+	if v, ok, err := GetSetting(settingLLMDailyTokens); err != nil {
+		return q, err
+	} else if ok {
+		q.DailyTokens = parseQuotaValue(v)
+	}
+	if v, ok, err := GetSetting(settingLLMMonthlyTokens); err != nil {
+		return q, err
+	} else if ok {
+		q.MonthlyTokens = parseQuotaValue(v)
+	}
+	return q, nil
+}
+
+// SetDefaultLLMQuota 修改实例默认配额
+func SetDefaultLLMQuota(q LLMQuota) error {
+	if err := SetSetting(settingLLMDailyTokens, strconv.FormatInt(q.DailyTokens, 10)); err != nil {
+		return err
+	}
+	return SetSetting(settingLLMMonthlyTokens, strconv.FormatInt(q.MonthlyTokens, 10))
+}
+
+// GetLLMQuotaOverride 用户级覆盖；未设置时返回 nil, nil
+func GetLLMQuotaOverride(userID int) (*LLMQuotaOverride, error) {
+	o := LLMQuotaOverride{UserID: userID}
+	var daily, monthly sql.NullInt64
+	err := database.DB.QueryRow(`SELECT daily_tokens, monthly_tokens FROM llm_quotas WHERE user_id = ?`, userID).Scan(&daily, &monthly)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if daily.Valid {
+		o.DailyTokens = &daily.Int64
+	}
+	if monthly.Valid {
+		o.MonthlyTokens = &monthly.Int64
+	}
+	return &o, nil
+}
+
+// ListLLMQuotaOverrides 全部用户级覆盖
+func ListLLMQuotaOverrides() ([]LLMQuotaOverride, error) {
+	rows, err := database.DB.Query(
+		`SELECT q.user_id, COALESCE(u.username, ''), q.daily_tokens, q.monthly_tokens
+		 FROM llm_quotas q LEFT JOIN users u ON u.id = q.user_id ORDER BY q.user_id ASC`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []LLMQuotaOverride{}
+	for rows.Next() {
+		var o LLMQuotaOverride
+		var daily, monthly sql.NullInt64
+		if err := rows.Scan(&o.UserID, &o.Username, &daily, &monthly); err != nil {
+			return nil, err
+		}
+		if daily.Valid {
+			o.DailyTokens = &daily.Int64
+		}
+		if monthly.Valid {
+			o.MonthlyTokens = &monthly.Int64
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// SetLLMQuotaOverride 设置用户级覆盖；两个字段都为 nil 时删除覆盖
+func SetLLMQuotaOverride(userID int, daily, monthly *int64) error {
+	if daily == nil && monthly == nil {
+		_, err := database.DB.Exec(`DELETE FROM llm_quotas WHERE user_id = ?`, userID)
+		return err
+	}
+	_, err := database.DB.Exec(
+		`INSERT INTO llm_quotas (user_id, daily_tokens, monthly_tokens, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(user_id) DO UPDATE SET daily_tokens = excluded.daily_tokens, monthly_tokens = excluded.monthly_tokens, updated_at = CURRENT_TIMESTAMP`,
+		userID, daily, monthly,
+	)
+	return err
+}
+
+// GetEffectiveLLMQuota 用户实际配额（覆盖值优先，其次实例默认）
+func GetEffectiveLLMQuota(userID int) (LLMQuota, error) {
+	q, err := GetDefaultLLMQuota()
+	if err != nil {
+		return q, err
+	}
+	o, err := GetLLMQuotaOverride(userID)
+	if err != nil || o == nil {
+		return q, err
+	}
+	if o.DailyTokens != nil {
+		q.DailyTokens = *o.DailyTokens
+	}
+	if o.MonthlyTokens != nil {
+		q.MonthlyTokens = *o.MonthlyTokens
+	}
+	return q, nil
+}
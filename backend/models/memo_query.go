@@ -95,9 +95,9 @@ func ListMemos(q MemoQuery) ([]Note, error) {
 	args = append(args, limit, offset)
 
 	// SELECT（tags JOIN 时会产生重复行，所以用 DISTINCT）
-	selectPrefix := "SELECT n.id, n.user_id, n.title, n.content, n.pinned, n.content_type, n.created_at, n.updated_at"
+	selectPrefix := "SELECT n.id, n.user_id, n.title, CASE WHEN n.locked = 1 THEN '' ELSE n.content END, n.pinned, n.locked, n.content_type, n.created_at, n.updated_at"
 	if len(q.Tags) > 0 {
-		selectPrefix = "SELECT DISTINCT n.id, n.user_id, n.title, n.content, n.pinned, n.content_type, n.created_at, n.updated_at"
+		selectPrefix = "SELECT DISTINCT n.id, n.user_id, n.title, CASE WHEN n.locked = 1 THEN '' ELSE n.content END, n.pinned, n.locked, n.content_type, n.created_at, n.updated_at"
 	}
 	sqlStr := selectPrefix + from + where
 	if fts != "" {
@@ -118,7 +118,7 @@ func ListMemos(q MemoQuery) ([]Note, error) {
 		var userID sql.NullInt64
 		var pinnedInt int
 		var contentType string
-		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &contentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
+		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &note.Locked, &contentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if userID.Valid {
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"memo-studio/backend/database"
+	"memo-studio/backend/utils"
 	"strconv"
 	"strings"
 	"time"
@@ -15,6 +16,7 @@ type Note struct {
 	Content     string     `json:"content"`
 	ContentType string     `json:"content_type"`
 	Pinned      bool       `json:"pinned"`
+	Locked      bool       `json:"locked"` // 加密笔记：列表/详情中 content 为空，需解锁后获取
 	Tags        []Tag      `json:"tags"`
 	Resources   []Resource `json:"resources"`
 	NotebookIDs []int      `json:"notebook_ids,omitempty"`
@@ -24,6 +26,8 @@ type Note struct {
 	Longitude float64 `json:"longitude,omitempty"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	// AI 总结（仅在 ?include=summary 时填充）
+	Summary *NoteSummary `json:"summary,omitempty"`
 }
 
 type Tag struct {
@@ -32,6 +36,8 @@ type Tag struct {
 	Name      string    `json:"name"`
 	Color     string    `json:"color"`
 	CreatedAt time.Time `json:"created_at"`
+	// 笔记中的标签来源：manual（手动）/ ai（自动打标），仅在笔记详情/列表中填充
+	Source string `json:"source,omitempty"`
 }
 
 type TagWithCount struct {
@@ -60,8 +66,8 @@ func CreateNote(title, content string, tagIDs []int, pinned bool, contentType st
 	}
 
 	result, err := tx.Exec(
-		"INSERT INTO notes (title, content, pinned, content_type, user_id) VALUES (?, ?, ?, ?, ?)",
-		title, content, pinned, contentType, userParam,
+		"INSERT INTO notes (title, content, pinned, content_type, user_id, word_count) VALUES (?, ?, ?, ?, ?, ?)",
+		title, content, pinned, contentType, userParam, NoteWordCount(title, content),
 	)
 	if err != nil {
 		return nil, err
@@ -97,6 +103,10 @@ func CreateNote(title, content string, tagIDs []int, pinned bool, contentType st
 		}
 	}
 
+	if err = SyncNoteTasks(tx, int(noteID)); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -104,8 +114,13 @@ func CreateNote(title, content string, tagIDs []int, pinned bool, contentType st
 	return GetNote(int(noteID))
 }
 
-// UpdateNote 更新笔记
-func UpdateNote(id int, title, content string, tagIDs []int, pinned bool, contentType string, resourceIDs []int) (*Note, error) {
+// NoteWordCount 笔记字数（标题 + 正文明文）
+func NoteWordCount(title, content string) int {
+	return utils.CountWords(title + " " + content)
+}
+
+// UpdateNote 更新笔记；wordCount 由调用方按明文计算（加密笔记的 content 为密文）
+func UpdateNote(id int, title, content string, wordCount int, tagIDs []int, pinned bool, contentType string, resourceIDs []int) (*Note, error) {
 	if strings.TrimSpace(contentType) == "" {
 		contentType = "markdown"
 	}
@@ -117,13 +132,30 @@ func UpdateNote(id int, title, content string, tagIDs []int, pinned bool, conten
 
 	// 更新笔记
 	_, err = tx.Exec(
-		"UPDATE notes SET title = ?, content = ?, pinned = ?, content_type = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		title, content, pinned, contentType, id,
+		"UPDATE notes SET title = ?, content = ?, pinned = ?, content_type = ?, word_count = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		title, content, pinned, contentType, wordCount, id,
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	// 保留仍存在的标签的来源标记（自动打标的审计信息）
+	sources := map[int]string{}
+	rows, err := tx.Query("SELECT tag_id, source FROM note_tags WHERE note_id = ?", id)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var tagID int
+		var source string
+		if err := rows.Scan(&tagID, &source); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		sources[tagID] = source
+	}
+	rows.Close()
+
 	// 删除旧的标签关联
 	_, err = tx.Exec("DELETE FROM note_tags WHERE note_id = ?", id)
 	if err != nil {
@@ -132,9 +164,13 @@ func UpdateNote(id int, title, content string, tagIDs []int, pinned bool, conten
 
 	// 添加新的标签关联
 	for _, tagID := range tagIDs {
+		source := sources[tagID]
+		if source == "" {
+			source = TagSourceManual
+		}
 		_, err = tx.Exec(
-			"INSERT INTO note_tags (note_id, tag_id) VALUES (?, ?)",
-			id, tagID,
+			"INSERT INTO note_tags (note_id, tag_id, source) VALUES (?, ?, ?)",
+			id, tagID, source,
 		)
 		if err != nil {
 			return nil, err
@@ -160,6 +196,10 @@ func UpdateNote(id int, title, content string, tagIDs []int, pinned bool, conten
 		}
 	}
 
+	if err = SyncNoteTasks(tx, id); err != nil {
+		return nil, err
+	}
+
 	if err = tx.Commit(); err != nil {
 		return nil, err
 	}
@@ -218,9 +258,9 @@ func GetNote(id int) (*Note, error) {
 	var location sql.NullString
 	var latitude, longitude sql.NullFloat64
 	err := database.DB.QueryRow(
-		"SELECT id, user_id, title, content, pinned, content_type, location, latitude, longitude, created_at, updated_at FROM notes WHERE id = ?",
+		"SELECT id, user_id, title, CASE WHEN locked = 1 THEN '' ELSE content END, pinned, locked, content_type, location, latitude, longitude, created_at, updated_at FROM notes WHERE id = ?",
 		id,
-	).Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &contentType, &location, &latitude, &longitude, &note.CreatedAt, &note.UpdatedAt)
+	).Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &note.Locked, &contentType, &location, &latitude, &longitude, &note.CreatedAt, &note.UpdatedAt)
 
 	if err != nil {
 		return nil, err
@@ -268,7 +308,7 @@ func GetNote(id int) (*Note, error) {
 // GetAllNotes 获取所有笔记
 func GetAllNotes() ([]Note, error) {
 	rows, err := database.DB.Query(
-		"SELECT id, user_id, title, content, pinned, content_type, location, latitude, longitude, created_at, updated_at FROM notes ORDER BY created_at DESC",
+		"SELECT id, user_id, title, CASE WHEN locked = 1 THEN '' ELSE content END, pinned, locked, content_type, location, latitude, longitude, created_at, updated_at FROM notes ORDER BY created_at DESC",
 	)
 	if err != nil {
 		return nil, err
@@ -283,7 +323,7 @@ func GetAllNotes() ([]Note, error) {
 		var contentType string
 		var location sql.NullString
 		var latitude, longitude sql.NullFloat64
-		err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &contentType, &location, &latitude, &longitude, &note.CreatedAt, &note.UpdatedAt)
+		err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &note.Locked, &contentType, &location, &latitude, &longitude, &note.CreatedAt, &note.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -341,7 +381,7 @@ func SearchNotes(q string, limit, offset int) ([]Note, error) {
 	}
 
 	rows, err := database.DB.Query(
-		`SELECT n.id, n.user_id, n.title, n.content, n.pinned, n.content_type, n.created_at, n.updated_at
+		`SELECT n.id, n.user_id, n.title, CASE WHEN n.locked = 1 THEN '' ELSE n.content END, n.pinned, n.locked, n.content_type, n.created_at, n.updated_at
 		 FROM notes_fts f
 		 JOIN notes n ON n.id = f.rowid
 		 WHERE notes_fts MATCH ?
@@ -360,7 +400,7 @@ func SearchNotes(q string, limit, offset int) ([]Note, error) {
 		var userID sql.NullInt64
 		var pinnedInt int
 		var contentType string
-		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &contentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
+		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &note.Locked, &contentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
 			return nil, err
 		}
 
@@ -444,7 +484,7 @@ func RandomNotes(userID int, limit int, tagName string, withinDays int) ([]Note,
 
 	args := []interface{}{}
 	query := `
-		SELECT n.id, n.user_id, n.title, n.content, n.pinned, n.content_type, n.created_at, n.updated_at
+		SELECT n.id, n.user_id, n.title, CASE WHEN n.locked = 1 THEN '' ELSE n.content END, n.pinned, n.locked, n.content_type, n.created_at, n.updated_at
 		FROM notes n
 	`
 
@@ -487,7 +527,7 @@ func RandomNotes(userID int, limit int, tagName string, withinDays int) ([]Note,
 		var userID sql.NullInt64
 		var pinnedInt int
 		var contentType string
-		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &contentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
+		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &note.Locked, &contentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if userID.Valid {
@@ -518,7 +558,7 @@ func RandomNotes(userID int, limit int, tagName string, withinDays int) ([]Note,
 // GetTagsByNoteID 获取笔记的标签
 func GetTagsByNoteID(noteID int) ([]Tag, error) {
 	rows, err := database.DB.Query(
-		`SELECT t.id, t.user_id, t.name, t.color, t.created_at 
+		`SELECT t.id, t.user_id, t.name, t.color, t.created_at, nt.source
 		 FROM tags t 
 		 INNER JOIN note_tags nt ON t.id = nt.tag_id 
 		 WHERE nt.note_id = ?`,
@@ -533,7 +573,7 @@ func GetTagsByNoteID(noteID int) ([]Tag, error) {
 	for rows.Next() {
 		var tag Tag
 		var uid sql.NullInt64
-		err := rows.Scan(&tag.ID, &uid, &tag.Name, &tag.Color, &tag.CreatedAt)
+		err := rows.Scan(&tag.ID, &uid, &tag.Name, &tag.Color, &tag.CreatedAt, &tag.Source)
 		if err != nil {
 			return nil, err
 		}
@@ -748,20 +788,26 @@ func abs(x int) int {
 	return x
 }
 
-// UpdateNoteLocation 更新笔记位置
-func UpdateNoteLocation(id int, location string, latitude, longitude float64) error {
-	_, err := database.DB.Exec(
-		"UPDATE notes SET location = ?, latitude = ?, longitude = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
-		location, latitude, longitude, id,
+// UpdateNoteLocation 更新用户笔记的位置；笔记不存在或不属于该用户时返回 sql.ErrNoRows
+func UpdateNoteLocation(id, userID int, location string, latitude, longitude float64) error {
+	res, err := database.DB.Exec(
+		"UPDATE notes SET location = ?, latitude = ?, longitude = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ? AND user_id = ?",
+		location, latitude, longitude, id, userID,
 	)
-	return err
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
-// GetNotesByLocation 按位置获取笔记
-func GetNotesByLocation(location string) ([]Note, error) {
+// GetNotesByLocation 按位置获取用户的笔记
+func GetNotesByLocation(userID int, location string) ([]Note, error) {
 	rows, err := database.DB.Query(
-		"SELECT id, user_id, title, content, pinned, content_type, location, latitude, longitude, created_at, updated_at FROM notes WHERE location = ? ORDER BY created_at DESC",
-		location,
+		"SELECT id, user_id, title, CASE WHEN locked = 1 THEN '' ELSE content END, pinned, locked, content_type, location, latitude, longitude, created_at, updated_at FROM notes WHERE user_id = ? AND location = ? ORDER BY created_at DESC",
+		userID, location,
 	)
 	if err != nil {
 		return nil, err
@@ -776,7 +822,7 @@ func GetNotesByLocation(location string) ([]Note, error) {
 		var contentType string
 		var loc sql.NullString
 		var latitude, longitude sql.NullFloat64
-		err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &contentType, &loc, &latitude, &longitude, &note.CreatedAt, &note.UpdatedAt)
+		err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &pinnedInt, &note.Locked, &contentType, &loc, &latitude, &longitude, &note.CreatedAt, &note.UpdatedAt)
 		if err != nil {
 			return nil, err
 		}
@@ -817,29 +863,73 @@ func GetNotesByLocation(location string) ([]Note, error) {
 
 // LocationStat 位置统计
 type LocationStat struct {
-	Location string `json:"location"`
-	Count    int    `json:"count"`
+	Location  string   `json:"location"`
+	Count     int      `json:"count"`
+	Latitude  *float64 `json:"latitude,omitempty"` // 该地点有坐标的笔记的平均坐标
+	Longitude *float64 `json:"longitude,omitempty"`
 }
 
-// GetLocationStats 获取所有位置统计
-func GetLocationStats() ([]LocationStat, error) {
+// GetLocationStats 获取用户的位置统计
+func GetLocationStats(userID int) ([]LocationStat, error) {
 	rows, err := database.DB.Query(
-		"SELECT location, COUNT(*) as cnt FROM notes WHERE location IS NOT NULL AND location != '' GROUP BY location ORDER BY cnt DESC",
+		`SELECT n.location, COUNT(*) as cnt,
+		        AVG(CASE WHEN `+hasCoordsCond+` THEN n.latitude END),
+		        AVG(CASE WHEN `+hasCoordsCond+` THEN n.longitude END)
+		 FROM notes n WHERE n.user_id = ? AND n.location IS NOT NULL AND n.location != ''
+		 GROUP BY n.location ORDER BY cnt DESC`,
+		userID,
 	)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var stats []LocationStat
+	stats := []LocationStat{}
 	for rows.Next() {
 		var s LocationStat
-		err := rows.Scan(&s.Location, &s.Count)
+		var lat, lng sql.NullFloat64
+		err := rows.Scan(&s.Location, &s.Count, &lat, &lng)
 		if err != nil {
 			return nil, err
 		}
+		if lat.Valid && lng.Valid {
+			s.Latitude, s.Longitude = &lat.Float64, &lng.Float64
+		}
 		stats = append(stats, s)
 	}
 
-	return stats, nil
+	return stats, rows.Err()
+}
+
+// 笔记标签来源
+const (
+	TagSourceManual = "manual"
+	TagSourceAI     = "ai"
+)
+
+// AddNoteTags 为笔记追加标签（已有的标签保持原来源不变），返回新追加的标签ID
+func AddNoteTags(noteID int, tagIDs []int, source string) ([]int, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var added []int
+	for _, tagID := range tagIDs {
+		res, err := tx.Exec(
+			"INSERT OR IGNORE INTO note_tags (note_id, tag_id, source) VALUES (?, ?, ?)",
+			noteID, tagID, source,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			added = append(added, tagID)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return added, nil
 }
@@ -0,0 +1,261 @@
+package models
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"memo-studio/backend/database"
+)
+
+// MaxGeoNotes 单次空间查询最多读取的笔记数
+const MaxGeoNotes = 5000
+
+// earthRadiusKm 地球平均半径
+const earthRadiusKm = 6371.0088
+
+// GeoNote 带坐标的笔记（地图标注用，只含摘要）
+type GeoNote struct {
+	ID         int       `json:"id"`
+	Title      string    `json:"title"`
+	Excerpt    string    `json:"excerpt"`
+	Location   string    `json:"location"`
+	Latitude   float64   `json:"latitude"`
+	Longitude  float64   `json:"longitude"`
+	Locked     bool      `json:"locked"`
+	CreatedAt  time.Time `json:"created_at"`
+	DistanceKm *float64  `json:"distance_km,omitempty"` // 附近查询时为到中心点的距离
+}
+
+// BBox 经纬度范围（GeoJSON 顺序：西、南、东、北）。West > East 表示跨越 180° 经线
+type BBox struct {
+	West  float64 `json:"west"`
+	South float64 `json:"south"`
+	East  float64 `json:"east"`
+	North float64 `json:"north"`
+}
+
+// where 范围条件
+func (b BBox) where() (string, []interface{}) {
+	cond := "n.latitude BETWEEN ? AND ? AND "
+	args := []interface{}{b.South, b.North}
+	if b.West <= b.East {
+		cond += "n.longitude BETWEEN ? AND ?"
+	} else {
+		cond += "(n.longitude >= ? OR n.longitude <= ?)"
+	}
+	return cond, append(args, b.West, b.East)
+}
+
+// RadiusBBox 以 (lat, lng) 为中心、半径 radiusKm 的外接范围；靠近极点时经度取全部
+func RadiusBBox(lat, lng, radiusKm float64) BBox {
+	dLat := radiusKm / earthRadiusKm * 180 / math.Pi
+	b := BBox{South: math.Max(lat-dLat, -90), North: math.Min(lat+dLat, 90), West: -180, East: 180}
+	if b.South <= -90 || b.North >= 90 {
+		return b
+	}
+	dLng := dLat / math.Cos(lat*math.Pi/180)
+	if dLng >= 180 {
+		return b
+	}
+	b.West, b.East = normalizeLng(lng-dLng), normalizeLng(lng+dLng)
+	return b
+}
+
+func normalizeLng(lng float64) float64 {
+	for lng < -180 {
+		lng += 360
+	}
+	for lng > 180 {
+		lng -= 360
+	}
+	return lng
+}
+
+// HaversineKm 两点间的大圆距离（公里）
+func HaversineKm(lat1, lng1, lat2, lng2 float64) float64 {
+	rad := math.Pi / 180
+	dLat := (lat2 - lat1) * rad
+	dLng := (lng2 - lng1) * rad
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1*rad)*math.Cos(lat2*rad)*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusKm * math.Asin(math.Min(1, math.Sqrt(a)))
+}
+
+// GeoQuery 空间查询条件；BBox 为空时不限范围
+type GeoQuery struct {
+	UserID int
+	BBox   *BBox
+	Near   *GeoPoint // 非空时按到该点的近似距离由近到远排序，否则按创建时间倒序
+	Limit  int       // 0 或超过 MaxGeoNotes 时取 MaxGeoNotes
+}
+
+// GeoPoint 经纬度坐标
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// orderBy 按等距圆柱投影下的平方距离排序（经度差取跨 180° 经线后的较小值），
+// 只用于在 SQL 中挑出最近的候选，精确距离由 HaversineKm 计算
+func (p GeoPoint) orderBy() (string, []interface{}) {
+	k := math.Cos(p.Latitude * math.Pi / 180)
+	const dLng = `MIN(ABS(n.longitude - ?), 360 - ABS(n.longitude - ?))`
+	return `(n.latitude - ?) * (n.latitude - ?) + ` + dLng + ` * ` + dLng + ` * ?, n.id DESC`,
+		[]interface{}{p.Latitude, p.Latitude, p.Longitude, p.Longitude, p.Longitude, p.Longitude, k * k}
+}
+
+// hasCoordsCond 有坐标的笔记；0,0 是早期未识别到坐标时的占位值，不算
+const hasCoordsCond = `n.latitude IS NOT NULL AND n.longitude IS NOT NULL AND NOT (n.latitude = 0 AND n.longitude = 0)`
+
+// ListGeoNotes 用户带坐标的笔记，按创建时间倒序（指定 Near 时由近到远）
+func ListGeoNotes(q GeoQuery) ([]GeoNote, error) {
+	where := []string{"n.user_id = ?", hasCoordsCond}
+	args := []interface{}{q.UserID}
+	if q.BBox != nil {
+		cond, a := q.BBox.where()
+		where = append(where, cond)
+		args = append(args, a...)
+	}
+	order := "n.created_at DESC, n.id DESC"
+	if q.Near != nil {
+		var a []interface{}
+		order, a = q.Near.orderBy()
+		args = append(args, a...)
+	}
+	limit := q.Limit
+	if limit <= 0 || limit > MaxGeoNotes {
+		limit = MaxGeoNotes
+	}
+	args = append(args, limit)
+
+	rows, err := database.DB.Query(
+		`SELECT n.id, COALESCE(n.title, ''), CASE WHEN n.locked = 1 THEN '' ELSE COALESCE(n.content, '') END,
+		        COALESCE(n.location, ''), n.latitude, n.longitude, n.locked, n.created_at
+		 FROM notes n WHERE `+strings.Join(where, " AND ")+`
+		 ORDER BY `+order+` LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	notes := []GeoNote{}
+	for rows.Next() {
+		var n GeoNote
+		var content string
+		if err := rows.Scan(&n.ID, &n.Title, &content, &n.Location, &n.Latitude, &n.Longitude, &n.Locked, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.Title = cleanContent(n.Title)
+		n.Excerpt = geoExcerpt(cleanContent(content), 80)
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
+
+// geoExcerpt 合并空白后截取前 limit 个字符
+func geoExcerpt(s string, limit int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if utf8.RuneCountInString(s) <= limit {
+		return s
+	}
+	return string([]rune(s)[:limit]) + "…"
+}
+
+// NearbyNotes 距 (lat, lng) radiusKm 以内的笔记，由近到远；
+// 候选按近似距离取最近的 MaxGeoNotes 条，避免范围内笔记过多时漏掉近处的旧笔记
+func NearbyNotes(userID int, lat, lng, radiusKm float64, limit int) ([]GeoNote, error) {
+	box := RadiusBBox(lat, lng, radiusKm)
+	candidates, err := ListGeoNotes(GeoQuery{UserID: userID, BBox: &box, Near: &GeoPoint{Latitude: lat, Longitude: lng}})
+	if err != nil {
+		return nil, err
+	}
+	notes := []GeoNote{}
+	for _, n := range candidates {
+		d := HaversineKm(lat, lng, n.Latitude, n.Longitude)
+		if d <= radiusKm {
+			d = math.Round(d*1000) / 1000
+			n.DistanceKm = &d
+			notes = append(notes, n)
+		}
+	}
+	sort.SliceStable(notes, func(i, j int) bool { return *notes[i].DistanceKm < *notes[j].DistanceKm })
+	if limit > 0 && len(notes) > limit {
+		notes = notes[:limit]
+	}
+	return notes, nil
+}
+
+// MaxClusterZoom 聚合的最大缩放级别（与常见瓦片地图一致）
+const MaxClusterZoom = 20
+
+// clusterCellsPerTile 每个 256px 瓦片划分的网格数（每边），约 64px 聚为一组
+const clusterCellsPerTile = 4
+
+// clusterSampleIDs 每个聚合返回的笔记 ID 数
+const clusterSampleIDs = 10
+
+// GeoCluster 地图某一缩放级别下相邻笔记的聚合
+type GeoCluster struct {
+	Latitude  float64  `json:"latitude"` // 聚合内笔记坐标的平均值
+	Longitude float64  `json:"longitude"`
+	Count     int      `json:"count"`
+	BBox      BBox     `json:"bbox"`
+	NoteIDs   []int    `json:"note_ids"`       // 最新的若干条
+	Note      *GeoNote `json:"note,omitempty"` // 只有一条笔记时直接给出
+}
+
+// mercatorCell Web 墨卡托投影下点所在的网格
+func mercatorCell(lat, lng float64, zoom int) (int, int) {
+	n := float64(int(1)<<zoom) * clusterCellsPerTile
+	lat = math.Max(math.Min(lat, 85.05112878), -85.05112878)
+	x := (lng + 180) / 360
+	sinLat := math.Sin(lat * math.Pi / 180)
+	y := 0.5 - math.Log((1+sinLat)/(1-sinLat))/(4*math.Pi)
+	cx, cy := int(math.Floor(x*n)), int(math.Floor(y*n))
+	last := int(n) - 1
+	return min(max(cx, 0), last), min(max(cy, 0), last)
+}
+
+// ClusterGeoNotes 按缩放级别把笔记聚合到 Web 墨卡托网格中，按数量降序返回
+func ClusterGeoNotes(notes []GeoNote, zoom int) []GeoCluster {
+	zoom = min(max(zoom, 0), MaxClusterZoom)
+	type cellKey struct{ x, y int }
+	index := map[cellKey]int{}
+	clusters := []GeoCluster{}
+	var sumLat, sumLng []float64
+	for i := range notes {
+		n := &notes[i]
+		x, y := mercatorCell(n.Latitude, n.Longitude, zoom)
+		k := cellKey{x, y}
+		ci, ok := index[k]
+		if !ok {
+			ci = len(clusters)
+			index[k] = ci
+			clusters = append(clusters, GeoCluster{BBox: BBox{West: n.Longitude, East: n.Longitude, South: n.Latitude, North: n.Latitude}, Note: n})
+			sumLat, sumLng = append(sumLat, 0), append(sumLng, 0)
+		}
+		c := &clusters[ci]
+		c.Count++
+		sumLat[ci] += n.Latitude
+		sumLng[ci] += n.Longitude
+		c.BBox.West, c.BBox.East = math.Min(c.BBox.West, n.Longitude), math.Max(c.BBox.East, n.Longitude)
+		c.BBox.South, c.BBox.North = math.Min(c.BBox.South, n.Latitude), math.Max(c.BBox.North, n.Latitude)
+		if len(c.NoteIDs) < clusterSampleIDs {
+			c.NoteIDs = append(c.NoteIDs, n.ID)
+		}
+	}
+	for i := range clusters {
+		c := &clusters[i]
+		c.Latitude = math.Round(sumLat[i]/float64(c.Count)*1e6) / 1e6
+		c.Longitude = math.Round(sumLng[i]/float64(c.Count)*1e6) / 1e6
+		if c.Count > 1 {
+			c.Note = nil
+		}
+	}
+	sort.SliceStable(clusters, func(i, j int) bool { return clusters[i].Count > clusters[j].Count })
+	return clusters
+}
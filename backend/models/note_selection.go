@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MaxNoteSelection 一次选取笔记的数量上限
+const MaxNoteSelection = 500
+
+// NoteSelection 服务端选取笔记（供 AI 分析使用）；条件之间为“且”
+type NoteSelection struct {
+	UserID     int
+	IDs        []int
+	Tag        string
+	NotebookID int
+	From       *time.Time // created_at >= From
+	To         *time.Time // created_at < To
+	Limit      int
+}
+
+// SelectNotes 按条件选取用户的笔记（不含加密笔记），按创建时间倒序；
+// 返回的笔记带标签，不带附件
+func SelectNotes(sel NoteSelection) ([]Note, error) {
+	where := []string{"n.user_id = ?", "n.locked = 0"}
+	args := []interface{}{sel.UserID}
+	if len(sel.IDs) > 0 {
+		placeholders := make([]string, len(sel.IDs))
+		for i, id := range sel.IDs {
+			placeholders[i] = "?"
+			args = append(args, id)
+		}
+		where = append(where, "n.id IN ("+strings.Join(placeholders, ",")+")")
+	}
+	if tag := strings.TrimSpace(sel.Tag); tag != "" {
+		where = append(where, "EXISTS (SELECT 1 FROM note_tags nt JOIN tags t ON t.id = nt.tag_id WHERE nt.note_id = n.id AND t.name = ?)")
+		args = append(args, tag)
+	}
+	if sel.NotebookID > 0 {
+		where = append(where, "EXISTS (SELECT 1 FROM note_notebooks nn WHERE nn.note_id = n.id AND nn.notebook_id = ?)")
+		args = append(args, sel.NotebookID)
+	}
+	// created_at 由 CURRENT_TIMESTAMP 写入（UTC，"YYYY-MM-DD HH:MM:SS"）
+	if sel.From != nil {
+		where = append(where, "datetime(n.created_at) >= datetime(?)")
+		args = append(args, sel.From.UTC().Format("2006-01-02 15:04:05"))
+	}
+	if sel.To != nil {
+		where = append(where, "datetime(n.created_at) < datetime(?)")
+		args = append(args, sel.To.UTC().Format("2006-01-02 15:04:05"))
+	}
+	limit := sel.Limit
+	if limit <= 0 || limit > MaxNoteSelection {
+		limit = MaxNoteSelection
+	}
+	args = append(args, limit)
+
+	rows, err := database.DB.Query(
+		`SELECT n.id, n.user_id, n.title, COALESCE(n.content, ''), n.pinned, n.content_type, n.created_at, n.updated_at
+		 FROM notes n WHERE `+strings.Join(where, " AND ")+`
+		 ORDER BY n.created_at DESC, n.id DESC LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var notes []Note
+	for rows.Next() {
+		var note Note
+		var userID sql.NullInt64
+		if err := rows.Scan(&note.ID, &userID, &note.Title, &note.Content, &note.Pinned, &note.ContentType, &note.CreatedAt, &note.UpdatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if userID.Valid {
+			v := int(userID.Int64)
+			note.UserID = &v
+		}
+		note.Title = cleanContent(note.Title)
+		note.Content = cleanContent(note.Content)
+		notes = append(notes, note)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range notes {
+		tags, err := GetTagsByNoteID(notes[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		notes[i].Tags = tags
+	}
+	return notes, nil
+}
+
+// MaxCorpusNotes 统计用户笔记库词频时读取的笔记上限（最近的笔记）
+const MaxCorpusNotes = 5000
+
+// CorpusVersion 用户笔记库的版本（未加密笔记数与最后修改时间），用于判断词频缓存是否过期
+func CorpusVersion(userID int) (string, error) {
+	var count int
+	var last string
+	err := database.DB.QueryRow(
+		`SELECT COUNT(*), COALESCE(MAX(datetime(updated_at)), '') FROM notes WHERE user_id = ? AND locked = 0`,
+		userID,
+	).Scan(&count, &last)
+	if err != nil {
+		return "", err
+	}
+	return strconv.Itoa(count) + "@" + last, nil
+}
+
+// ForEachNoteText 按创建时间倒序遍历用户最近 limit 条未加密笔记的标题与正文
+func ForEachNoteText(userID, limit int, fn func(text string)) error {
+	if limit <= 0 || limit > MaxCorpusNotes {
+		limit = MaxCorpusNotes
+	}
+	rows, err := database.DB.Query(
+		`SELECT title, COALESCE(content, '') FROM notes WHERE user_id = ? AND locked = 0
+		 ORDER BY created_at DESC, id DESC LIMIT ?`,
+		userID, limit,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var title, content string
+		if err := rows.Scan(&title, &content); err != nil {
+			return err
+		}
+		fn(cleanContent(title) + "\n" + cleanContent(content))
+	}
+	return rows.Err()
+}
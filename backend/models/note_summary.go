@@ -0,0 +1,138 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"memo-studio/backend/database"
+	"strings"
+	"time"
+)
+
+// NoteSummary 持久化的笔记 AI 总结
+type NoteSummary struct {
+	NoteID      int       `json:"note_id"`
+	Summary     string    `json:"summary"`
+	Highlights  []string  `json:"highlights"`
+	ActionItems []string  `json:"action_items"`
+	Provider    string    `json:"provider"`
+	Model       string    `json:"model"`
+	Auto        bool      `json:"auto"`  // 由后台任务自动生成
+	Stale       bool      `json:"stale"` // 生成后笔记内容已修改
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// NoteContentHash 笔记正文哈希，用于判断总结是否过期
+func NoteContentHash(content string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
+
+const noteSummaryColumns = `s.note_id, s.summary, s.highlights, s.action_items, s.provider, s.model, s.auto,
+	s.source_hash, COALESCE(n.content, ''), s.created_at, s.updated_at`
+
+func scanNoteSummary(scanner interface{ Scan(...any) error }) (*NoteSummary, error) {
+	var ns NoteSummary
+	var highlights, actions, hash, content string
+	if err := scanner.Scan(&ns.NoteID, &ns.Summary, &highlights, &actions, &ns.Provider, &ns.Model, &ns.Auto,
+		&hash, &content, &ns.CreatedAt, &ns.UpdatedAt); err != nil {
+		return nil, err
+	}
+	_ = json.Unmarshal([]byte(highlights), &ns.Highlights)
+	_ = json.Unmarshal([]byte(actions), &ns.ActionItems)
+	if ns.Highlights == nil {
+		ns.Highlights = []string{}
+	}
+	if ns.ActionItems == nil {
+		ns.ActionItems = []string{}
+	}
+	ns.Stale = hash != NoteContentHash(content)
+	return &ns, nil
+}
+
+// GetNoteSummary 读取笔记总结；不存在时返回 nil, nil
+func GetNoteSummary(noteID int) (*NoteSummary, error) {
+	row := database.DB.QueryRow(
+		`SELECT `+noteSummaryColumns+` FROM note_summaries s JOIN notes n ON n.id = s.note_id WHERE s.note_id = ?`,
+		noteID,
+	)
+	ns, err := scanNoteSummary(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return ns, err
+}
+
+// AttachNoteSummaries 为笔记列表填充 Summary
+func AttachNoteSummaries(notes []Note) error {
+	if len(notes) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(notes))
+	args := make([]interface{}, len(notes))
+	index := make(map[int]int, len(notes))
+	for i, n := range notes {
+		placeholders[i] = "?"
+		args[i] = n.ID
+		index[n.ID] = i
+	}
+	rows, err := database.DB.Query(
+		`SELECT `+noteSummaryColumns+` FROM note_summaries s JOIN notes n ON n.id = s.note_id
+		 WHERE s.note_id IN (`+strings.Join(placeholders, ",")+`)`,
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		ns, err := scanNoteSummary(rows)
+		if err != nil {
+			return err
+		}
+		if i, ok := index[ns.NoteID]; ok {
+			notes[i].Summary = ns
+		}
+	}
+	return rows.Err()
+}
+
+// SaveNoteSummary 保存（覆盖）笔记总结；content 为生成总结时的笔记正文
+func SaveNoteSummary(ns NoteSummary, userID *int, content string) error {
+	highlights, _ := json.Marshal(nonNilStrings(ns.Highlights))
+	actions, _ := json.Marshal(nonNilStrings(ns.ActionItems))
+	var owner interface{}
+	if userID != nil {
+		owner = *userID
+	}
+	_, err := database.DB.Exec(
+		`INSERT INTO note_summaries (note_id, user_id, summary, highlights, action_items, provider, model, auto, source_hash, created_at, updated_at)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+		 ON CONFLICT(note_id) DO UPDATE SET summary = excluded.summary, highlights = excluded.highlights,
+		   action_items = excluded.action_items, provider = excluded.provider, model = excluded.model,
+		   auto = excluded.auto, source_hash = excluded.source_hash, updated_at = CURRENT_TIMESTAMP`,
+		ns.NoteID, owner, ns.Summary, string(highlights), string(actions), ns.Provider, ns.Model, ns.Auto, NoteContentHash(content),
+	)
+	return err
+}
+
+// DeleteNoteSummary 删除笔记总结；不存在时返回 sql.ErrNoRows
+func DeleteNoteSummary(noteID int) error {
+	res, err := database.DB.Exec(`DELETE FROM note_summaries WHERE note_id = ?`, noteID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func nonNilStrings(list []string) []string {
+	if list == nil {
+		return []string{}
+	}
+	return list
+}
@@ -158,7 +158,7 @@ func ListNotesByNotebookID(notebookID, userID int, limit, offset int) ([]Note, e
 		limit = 50
 	}
 	rows, err := database.DB.Query(`
-		SELECT n.id, n.user_id, n.title, n.content, n.content_type, n.pinned, n.created_at, n.updated_at
+		SELECT n.id, n.user_id, n.title, CASE WHEN n.locked = 1 THEN '' ELSE n.content END, n.content_type, n.pinned, n.locked, n.created_at, n.updated_at
 		FROM notes n
 		INNER JOIN note_notebooks nn ON nn.note_id = n.id AND nn.notebook_id = ?
 		WHERE n.user_id = ?
@@ -174,7 +174,7 @@ func ListNotesByNotebookID(notebookID, userID int, limit, offset int) ([]Note, e
 	for rows.Next() {
 		var note Note
 		var userIDNull sql.NullInt64
-		if err := rows.Scan(&note.ID, &userIDNull, &note.Title, &note.Content, &note.ContentType, &note.Pinned, &note.CreatedAt, &note.UpdatedAt); err != nil {
+		if err := rows.Scan(&note.ID, &userIDNull, &note.Title, &note.Content, &note.ContentType, &note.Pinned, &note.Locked, &note.CreatedAt, &note.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if userIDNull.Valid {
@@ -0,0 +1,138 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"strings"
+	"time"
+)
+
+// PromptTemplate 提示词模板；UserID 为空表示管理员设置的实例模板
+type PromptTemplate struct {
+	ID           int       `json:"id"`
+	UserID       *int      `json:"user_id,omitempty"`
+	Name         string    `json:"name"`
+	Description  string    `json:"description"`
+	SystemPrompt string    `json:"system_prompt"`
+	UserPrompt   string    `json:"user_prompt"`
+	OutputSchema string    `json:"output_schema,omitempty"` // JSON Schema，空表示不校验
+	Language     string    `json:"language,omitempty"`      // 默认输出语言
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+type PromptTemplateInput struct {
+	Name         string
+	Description  string
+	SystemPrompt string
+	UserPrompt   string
+	OutputSchema string
+	Language     string
+}
+
+const promptTemplateColumns = `id, user_id, name, description, system_prompt, user_prompt, output_schema, language, created_at, updated_at`
+
+func scanPromptTemplate(scanner interface{ Scan(...any) error }) (*PromptTemplate, error) {
+	var t PromptTemplate
+	var userID sql.NullInt64
+	if err := scanner.Scan(&t.ID, &userID, &t.Name, &t.Description, &t.SystemPrompt, &t.UserPrompt, &t.OutputSchema, &t.Language, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		v := int(userID.Int64)
+		t.UserID = &v
+	}
+	return &t, nil
+}
+
+// ListPromptTemplates 列出某用户（或实例）的模板
+func ListPromptTemplates(userID *int) ([]PromptTemplate, error) {
+	where, args := ownerClause(userID)
+	rows, err := database.DB.Query(`SELECT `+promptTemplateColumns+` FROM prompt_templates WHERE `+where+` ORDER BY name ASC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []PromptTemplate
+	for rows.Next() {
+		t, err := scanPromptTemplate(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// GetPromptTemplate 获取模板（限定归属）；不存在时返回 nil, nil
+func GetPromptTemplate(id int, userID *int) (*PromptTemplate, error) {
+	where, args := ownerClause(userID)
+	args = append([]interface{}{id}, args...)
+	t, err := scanPromptTemplate(database.DB.QueryRow(`SELECT `+promptTemplateColumns+` FROM prompt_templates WHERE id = ? AND `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// GetPromptTemplateByName 按名称获取模板（限定归属）；不存在时返回 nil, nil
+func GetPromptTemplateByName(name string, userID *int) (*PromptTemplate, error) {
+	where, args := ownerClause(userID)
+	args = append([]interface{}{name}, args...)
+	t, err := scanPromptTemplate(database.DB.QueryRow(`SELECT `+promptTemplateColumns+` FROM prompt_templates WHERE name = ? AND `+where, args...))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// CreatePromptTemplate 新建模板
+func CreatePromptTemplate(userID *int, in PromptTemplateInput) (*PromptTemplate, error) {
+	var owner interface{}
+	if userID != nil {
+		owner = *userID
+	}
+	res, err := database.DB.Exec(
+		`INSERT INTO prompt_templates (user_id, name, description, system_prompt, user_prompt, output_schema, language) VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		owner, strings.TrimSpace(in.Name), in.Description, in.SystemPrompt, in.UserPrompt, in.OutputSchema, in.Language,
+	)
+	if err != nil {
+		return nil, err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	return GetPromptTemplate(int(id), userID)
+}
+
+// UpdatePromptTemplate 修改模板；不存在时返回 nil, nil
+func UpdatePromptTemplate(id int, userID *int, in PromptTemplateInput) (*PromptTemplate, error) {
+	where, args := ownerClause(userID)
+	vals := []interface{}{strings.TrimSpace(in.Name), in.Description, in.SystemPrompt, in.UserPrompt, in.OutputSchema, in.Language, id}
+	res, err := database.DB.Exec(
+		`UPDATE prompt_templates SET name = ?, description = ?, system_prompt = ?, user_prompt = ?, output_schema = ?, language = ?,
+		   updated_at = CURRENT_TIMESTAMP WHERE id = ? AND `+where,
+		append(vals, args...)...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, nil
+	}
+	return GetPromptTemplate(id, userID)
+}
+
+// DeletePromptTemplate 删除模板
+func DeletePromptTemplate(id int, userID *int) error {
+	where, args := ownerClause(userID)
+	res, err := database.DB.Exec(`DELETE FROM prompt_templates WHERE id = ? AND `+where, append([]interface{}{id}, args...)...)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
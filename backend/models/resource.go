@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"memo-studio/backend/database"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,7 +17,69 @@ type Resource struct {
 	MimeType    string    `json:"mime_type"`
 	Size        int64     `json:"size"`
 	Sha256      string    `json:"sha256"`
+	Encrypted   bool      `json:"encrypted"` // 加密附件：磁盘上为密文，需通过 /resources/:id/content 携带解锁令牌读取
 	CreatedAt   time.Time `json:"created_at"`
+
+	EXIF        *ResourceEXIF `json:"exif,omitempty"` // 照片 EXIF，没有时为空
+	exifScanned bool
+}
+
+// ResourceEXIF 照片附件的 EXIF 信息（坐标为 WGS-84）
+type ResourceEXIF struct {
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	Altitude    *float64   `json:"altitude,omitempty"`
+	TakenAt     *time.Time `json:"taken_at,omitempty"`
+	Orientation int        `json:"orientation,omitempty"`
+	Camera      string     `json:"camera,omitempty"`
+}
+
+// HasGPS 是否带坐标
+func (e *ResourceEXIF) HasGPS() bool {
+	return e != nil && e.Latitude != nil && e.Longitude != nil
+}
+
+// EXIFScanned 是否已解析过 EXIF
+func (r *Resource) EXIFScanned() bool {
+	return r.exifScanned
+}
+
+const resourceColumns = `id, user_id, filename, storage_path, mime_type, size, sha256, encrypted, created_at,
+	exif_scanned, latitude, longitude, altitude, taken_at, orientation, camera`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanResource(row rowScanner) (*Resource, error) {
+	var r Resource
+	var user sql.NullInt64
+	var lat, lng, alt sql.NullFloat64
+	var takenAt sql.NullTime
+	var exif ResourceEXIF
+	if err := row.Scan(&r.ID, &user, &r.Filename, &r.StoragePath, &r.MimeType, &r.Size, &r.Sha256, &r.Encrypted, &r.CreatedAt,
+		&r.exifScanned, &lat, &lng, &alt, &takenAt, &exif.Orientation, &exif.Camera); err != nil {
+		return nil, err
+	}
+	if user.Valid {
+		v := int(user.Int64)
+		r.UserID = &v
+	}
+	if lat.Valid && lng.Valid {
+		exif.Latitude, exif.Longitude = &lat.Float64, &lng.Float64
+	}
+	if alt.Valid {
+		exif.Altitude = &alt.Float64
+	}
+	if takenAt.Valid {
+		exif.TakenAt = &takenAt.Time
+	}
+	if exif.Latitude != nil || exif.Altitude != nil || exif.TakenAt != nil || exif.Orientation != 0 || exif.Camera != "" {
+		r.EXIF = &exif
+	}
+	r.StoragePath = normalizeStoragePath(r.StoragePath)
+	r.URL = resourceURLFor(&r)
+	return &r, nil
 }
 
 func normalizeStoragePath(p string) string {
@@ -33,6 +96,14 @@ func resourceURL(storagePath string) string {
 	return "/uploads/" + sp
 }
 
+// resourceURLFor 加密附件不能走 /uploads 静态服务，改为经 API 解密读取
+func resourceURLFor(r *Resource) string {
+	if r.Encrypted {
+		return "/api/v1/resources/" + strconv.Itoa(r.ID) + "/content"
+	}
+	return resourceURL(r.StoragePath)
+}
+
 func CreateResource(userID *int, filename, storagePath, mimeType string, size int64, sha256 string) (*Resource, error) {
 	var userParam interface{} = nil
 	if userID != nil {
@@ -56,28 +127,12 @@ func CreateResource(userID *int, filename, storagePath, mimeType string, size in
 }
 
 func GetResource(id int) (*Resource, error) {
-	var r Resource
-	var user sql.NullInt64
-	err := database.DB.QueryRow(
-		`SELECT id, user_id, filename, storage_path, mime_type, size, sha256, created_at
-		 FROM resources WHERE id = ?`,
-		id,
-	).Scan(&r.ID, &user, &r.Filename, &r.StoragePath, &r.MimeType, &r.Size, &r.Sha256, &r.CreatedAt)
-	if err != nil {
-		return nil, err
-	}
-	if user.Valid {
-		v := int(user.Int64)
-		r.UserID = &v
-	}
-	r.StoragePath = normalizeStoragePath(r.StoragePath)
-	r.URL = resourceURL(r.StoragePath)
-	return &r, nil
+	return scanResource(database.DB.QueryRow(`SELECT `+resourceColumns+` FROM resources WHERE id = ?`, id))
 }
 
 func GetResourcesByNoteID(noteID int) ([]Resource, error) {
 	rows, err := database.DB.Query(
-		`SELECT r.id, r.user_id, r.filename, r.storage_path, r.mime_type, r.size, r.sha256, r.created_at
+		`SELECT `+resourceColumns+`
 		 FROM note_resources nr
 		 JOIN resources r ON r.id = nr.resource_id
 		 WHERE nr.note_id = ?
@@ -92,18 +147,11 @@ func GetResourcesByNoteID(noteID int) ([]Resource, error) {
 
 	var list []Resource
 	for rows.Next() {
-		var r Resource
-		var user sql.NullInt64
-		if err := rows.Scan(&r.ID, &user, &r.Filename, &r.StoragePath, &r.MimeType, &r.Size, &r.Sha256, &r.CreatedAt); err != nil {
+		r, err := scanResource(rows)
+		if err != nil {
 			return nil, err
 		}
-		if user.Valid {
-			v := int(user.Int64)
-			r.UserID = &v
-		}
-		r.StoragePath = normalizeStoragePath(r.StoragePath)
-		r.URL = resourceURL(r.StoragePath)
-		list = append(list, r)
+		list = append(list, *r)
 	}
 	return list, rows.Err()
 }
@@ -136,7 +184,7 @@ func ListResourcesByUserID(userID int, limit, offset int) (*ListResourcesResult,
 	}
 
 	rows, err := database.DB.Query(
-		`SELECT id, user_id, filename, storage_path, mime_type, size, sha256, created_at
+		`SELECT `+resourceColumns+`
 		 FROM resources WHERE user_id = ?
 		 ORDER BY created_at DESC, id DESC
 		 LIMIT ? OFFSET ?`,
@@ -149,18 +197,11 @@ func ListResourcesByUserID(userID int, limit, offset int) (*ListResourcesResult,
 
 	var list []Resource
 	for rows.Next() {
-		var r Resource
-		var user sql.NullInt64
-		if err := rows.Scan(&r.ID, &user, &r.Filename, &r.StoragePath, &r.MimeType, &r.Size, &r.Sha256, &r.CreatedAt); err != nil {
+		r, err := scanResource(rows)
+		if err != nil {
 			return nil, err
 		}
-		if user.Valid {
-			v := int(user.Int64)
-			r.UserID = &v
-		}
-		r.StoragePath = normalizeStoragePath(r.StoragePath)
-		r.URL = resourceURL(r.StoragePath)
-		list = append(list, r)
+		list = append(list, *r)
 	}
 	if list == nil {
 		list = []Resource{}
@@ -184,3 +225,55 @@ func DeleteResource(id int, userID int) error {
 	_, _ = database.DB.Exec(`DELETE FROM note_resources WHERE resource_id = ?`, id)
 	return nil
 }
+
+// SetResourceEncrypted 更新附件加密标记（文件内容由调用方负责加解密）。
+// 同时清除 EXIF：加密后不保留明文拍摄位置，解密后需要时重新解析
+func SetResourceEncrypted(id int, encrypted bool) error {
+	_, err := database.DB.Exec(
+		`UPDATE resources SET encrypted = ?, exif_scanned = 0, latitude = NULL, longitude = NULL, altitude = NULL,
+		   taken_at = NULL, orientation = 0, camera = ''
+		 WHERE id = ?`,
+		encrypted, id,
+	)
+	return err
+}
+
+// ListEncryptedResources 列出用户全部加密附件
+func ListEncryptedResources(userID int) ([]Resource, error) {
+	rows, err := database.DB.Query(
+		`SELECT `+resourceColumns+`
+		 FROM resources WHERE user_id = ? AND encrypted = 1`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Resource
+	for rows.Next() {
+		r, err := scanResource(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *r)
+	}
+	return list, rows.Err()
+}
+
+// SetResourceEXIF 保存附件的 EXIF 解析结果并标记为已解析；exif 为 nil 表示图片没有 EXIF
+func SetResourceEXIF(id int, exif *ResourceEXIF) error {
+	if exif == nil {
+		exif = &ResourceEXIF{}
+	}
+	var takenAt interface{}
+	if exif.TakenAt != nil {
+		takenAt = exif.TakenAt.UTC()
+	}
+	_, err := database.DB.Exec(
+		`UPDATE resources SET exif_scanned = 1, latitude = ?, longitude = ?, altitude = ?, taken_at = ?, orientation = ?, camera = ?
+		 WHERE id = ?`,
+		exif.Latitude, exif.Longitude, exif.Altitude, takenAt, exif.Orientation, exif.Camera, id,
+	)
+	return err
+}
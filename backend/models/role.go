@@ -0,0 +1,61 @@
+package models
+
+// 角色
+const (
+	RoleAdmin  = "admin"  // 管理员：全部权限
+	RoleEditor = "editor" // 编辑者：读写自己的内容、使用 AI（普通用户默认角色）
+	RoleViewer = "viewer" // 查看者：只读，可使用 AI 分析
+	RoleGuest  = "guest"  // 访客：只读
+)
+
+// Permission 权限
+type Permission string
+
+const (
+	PermRead           Permission = "read"            // 读取自己的笔记/标签/附件等
+	PermWrite          Permission = "write"           // 创建、修改、删除内容
+	PermAI             Permission = "ai"              // 调用大模型/转写等计费能力
+	PermManageUsers    Permission = "users:manage"    // 用户与角色管理
+	PermManageInstance Permission = "instance:manage" // 实例设置（注册策略、全局模型配置等）
+)
+
+var rolePermissions = map[string][]Permission{
+	RoleAdmin:  {PermRead, PermWrite, PermAI, PermManageUsers, PermManageInstance},
+	RoleEditor: {PermRead, PermWrite, PermAI},
+	RoleViewer: {PermRead, PermAI},
+	RoleGuest:  {PermRead},
+}
+
+// Roles 全部角色（按权限从高到低）
+func Roles() []string {
+	return []string{RoleAdmin, RoleEditor, RoleViewer, RoleGuest}
+}
+
+// IsValidRole 校验角色
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RolePermissions 角色拥有的权限
+func RolePermissions(role string) []Permission {
+	return rolePermissions[role]
+}
+
+// RoleHasPermission 角色是否拥有某权限；未知角色没有任何权限
+func RoleHasPermission(role string, perm Permission) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleFromLegacy 旧数据/旧令牌只有 is_admin 时推导角色
+func RoleFromLegacy(isAdmin bool) string {
+	if isAdmin {
+		return RoleAdmin
+	}
+	return RoleEditor
+}
@@ -0,0 +1,299 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"memo-studio/backend/database"
+)
+
+// 笔记与股票关联的来源
+const (
+	StockSourceCode = "code" // 正文中的代码，如 $600519、600519.SH
+	StockSourceName = "name" // 正文中的股票名称或简称
+)
+
+// WatchlistItem 自选股
+type WatchlistItem struct {
+	ID         int        `json:"id"`
+	Code       string     `json:"code"`   // 6 位代码
+	Market     string     `json:"market"` // sh / sz
+	Name       string     `json:"name"`
+	Memo       string     `json:"memo"`
+	NoteCount  int        `json:"note_count"` // 提到该股票的笔记数
+	LastNoteAt *time.Time `json:"last_note_at,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+const watchlistSelect = `SELECT w.id, w.code, w.market, w.name, w.memo, w.created_at,
+	(SELECT COUNT(*) FROM note_stocks ns JOIN notes n ON n.id = ns.note_id WHERE ns.code = w.code AND n.user_id = w.user_id),
+	(SELECT MAX(datetime(n.created_at)) FROM note_stocks ns JOIN notes n ON n.id = ns.note_id WHERE ns.code = w.code AND n.user_id = w.user_id)
+	FROM stock_watchlist w`
+
+func scanWatchlistItem(row rowScanner) (*WatchlistItem, error) {
+	var it WatchlistItem
+	var last sql.NullString
+	if err := row.Scan(&it.ID, &it.Code, &it.Market, &it.Name, &it.Memo, &it.CreatedAt, &it.NoteCount, &last); err != nil {
+		return nil, err
+	}
+	// MAX() 的结果没有列类型，按 datetime() 的 UTC 文本解析
+	if last.Valid {
+		if t, err := time.Parse("2006-01-02 15:04:05", last.String); err == nil {
+			it.LastNoteAt = &t
+		}
+	}
+	return &it, nil
+}
+
+// ListWatchlist 用户的自选股，按加入时间排列
+func ListWatchlist(userID int) ([]WatchlistItem, error) {
+	rows, err := database.DB.Query(watchlistSelect+` WHERE w.user_id = ? ORDER BY w.created_at, w.id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []WatchlistItem{}
+	for rows.Next() {
+		it, err := scanWatchlistItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, *it)
+	}
+	return items, rows.Err()
+}
+
+// GetWatchlistItem 获取自选股；不存在返回 nil, nil
+func GetWatchlistItem(userID int, code string) (*WatchlistItem, error) {
+	it, err := scanWatchlistItem(database.DB.QueryRow(watchlistSelect+` WHERE w.user_id = ? AND w.code = ?`, userID, code))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return it, err
+}
+
+// UpsertWatchlistItem 加入自选；已存在时更新名称与备注（name 为空时保留原名称）
+func UpsertWatchlistItem(userID int, code, market, name, memo string) (*WatchlistItem, error) {
+	_, err := database.DB.Exec(
+		`INSERT INTO stock_watchlist (user_id, code, market, name, memo) VALUES (?, ?, ?, ?, ?)
+		 ON CONFLICT(user_id, code) DO UPDATE SET market = excluded.market,
+		   name = CASE WHEN excluded.name = '' THEN stock_watchlist.name ELSE excluded.name END,
+		   memo = excluded.memo`,
+		userID, code, market, name, memo,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return GetWatchlistItem(userID, code)
+}
+
+// DeleteWatchlistItem 移出自选；不存在时返回 sql.ErrNoRows
+func DeleteWatchlistItem(userID int, code string) error {
+	res, err := database.DB.Exec(`DELETE FROM stock_watchlist WHERE user_id = ? AND code = ?`, userID, code)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// NoteStock 笔记提到的股票；Price 等为写笔记时的行情快照
+type NoteStock struct {
+	NoteID        int        `json:"note_id"`
+	Code          string     `json:"code"`
+	Market        string     `json:"market"`
+	Name          string     `json:"name"`
+	Source        string     `json:"source"`
+	Price         *float64   `json:"price,omitempty"`
+	ChangePercent *float64   `json:"change_percent,omitempty"`
+	QuotedAt      *time.Time `json:"quoted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+const noteStockColumns = `note_id, code, market, name, source, price, change_percent, quoted_at, created_at`
+
+func scanNoteStock(row rowScanner) (*NoteStock, error) {
+	var s NoteStock
+	var price, change sql.NullFloat64
+	var quotedAt sql.NullTime
+	if err := row.Scan(&s.NoteID, &s.Code, &s.Market, &s.Name, &s.Source, &price, &change, &quotedAt, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	if price.Valid {
+		s.Price = &price.Float64
+	}
+	if change.Valid {
+		s.ChangePercent = &change.Float64
+	}
+	if quotedAt.Valid {
+		s.QuotedAt = &quotedAt.Time
+	}
+	return &s, nil
+}
+
+// ListNoteStocks 笔记关联的股票，按建立关联的先后（同一次识别内为正文中出现的顺序）
+func ListNoteStocks(noteID int) ([]NoteStock, error) {
+	rows, err := database.DB.Query(`SELECT `+noteStockColumns+` FROM note_stocks WHERE note_id = ? ORDER BY created_at, rowid`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []NoteStock{}
+	for rows.Next() {
+		s, err := scanNoteStock(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *s)
+	}
+	return list, rows.Err()
+}
+
+// SyncNoteStocks 按正文识别结果同步关联：不再提到的删除，新提到的加入，
+// 仍然提到的更新名称与来源并保留行情快照
+func SyncNoteStocks(noteID int, stocks []NoteStock) (err error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	keep := make([]interface{}, 0, len(stocks)+1)
+	keep = append(keep, noteID)
+	placeholders := ""
+	for i, s := range stocks {
+		if i > 0 {
+			placeholders += ","
+		}
+		placeholders += "?"
+		keep = append(keep, s.Code)
+	}
+	del := `DELETE FROM note_stocks WHERE note_id = ?`
+	if len(stocks) > 0 {
+		del += ` AND code NOT IN (` + placeholders + `)`
+	}
+	if _, err = tx.Exec(del, keep...); err != nil {
+		return err
+	}
+	for _, s := range stocks {
+		if _, err = tx.Exec(
+			`INSERT INTO note_stocks (note_id, code, market, name, source) VALUES (?, ?, ?, ?, ?)
+			 ON CONFLICT(note_id, code) DO UPDATE SET market = excluded.market, name = excluded.name, source = excluded.source`,
+			noteID, s.Code, s.Market, s.Name, s.Source,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetNoteStockQuote 保存行情快照
+func SetNoteStockQuote(noteID int, code string, price, changePercent float64, quotedAt time.Time) error {
+	_, err := database.DB.Exec(
+		`UPDATE note_stocks SET price = ?, change_percent = ?, quoted_at = ? WHERE note_id = ? AND code = ?`,
+		price, changePercent, quotedAt.UTC(), noteID, code,
+	)
+	return err
+}
+
+// StockNoteEntry 提到某只股票的笔记（投资日志）
+type StockNoteEntry struct {
+	NoteID        int        `json:"note_id"`
+	Title         string     `json:"title"`
+	Excerpt       string     `json:"excerpt"`
+	Source        string     `json:"source"`
+	Price         *float64   `json:"price,omitempty"` // 写笔记时的价格
+	ChangePercent *float64   `json:"change_percent,omitempty"`
+	QuotedAt      *time.Time `json:"quoted_at,omitempty"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ListStockNotes 用户提到某只股票的笔记，按创建时间倒序
+func ListStockNotes(userID int, code string, limit, offset int) ([]StockNoteEntry, int, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if limit > 100 {
+		limit = 100
+	}
+	if offset < 0 {
+		offset = 0
+	}
+
+	var total int
+	if err := database.DB.QueryRow(
+		`SELECT COUNT(*) FROM note_stocks ns JOIN notes n ON n.id = ns.note_id
+		 WHERE ns.code = ? AND n.user_id = ? AND n.locked = 0`,
+		code, userID,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := database.DB.Query(
+		`SELECT n.id, COALESCE(n.title, ''), COALESCE(n.content, ''), ns.source, ns.price, ns.change_percent, ns.quoted_at,
+		        n.created_at, n.updated_at
+		 FROM note_stocks ns JOIN notes n ON n.id = ns.note_id
+		 WHERE ns.code = ? AND n.user_id = ? AND n.locked = 0
+		 ORDER BY n.created_at DESC, n.id DESC LIMIT ? OFFSET ?`,
+		code, userID, limit, offset,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []StockNoteEntry{}
+	for rows.Next() {
+		var e StockNoteEntry
+		var content string
+		var price, change sql.NullFloat64
+		var quotedAt sql.NullTime
+		if err := rows.Scan(&e.NoteID, &e.Title, &content, &e.Source, &price, &change, &quotedAt, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, 0, err
+		}
+		e.Title = cleanContent(e.Title)
+		e.Excerpt = geoExcerpt(cleanContent(content), 120)
+		if price.Valid {
+			e.Price = &price.Float64
+		}
+		if change.Valid {
+			e.ChangePercent = &change.Float64
+		}
+		if quotedAt.Valid {
+			e.QuotedAt = &quotedAt.Time
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// ListUnlockedNoteTexts 用户全部未加密笔记的 ID、标题与正文（补建股票关联用）
+func ListUnlockedNoteTexts(userID int) ([]Note, error) {
+	rows, err := database.DB.Query(
+		`SELECT id, title, COALESCE(content, '') FROM notes WHERE user_id = ? AND locked = 0 ORDER BY id`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notes []Note
+	for rows.Next() {
+		var n Note
+		if err := rows.Scan(&n.ID, &n.Title, &n.Content); err != nil {
+			return nil, err
+		}
+		notes = append(notes, n)
+	}
+	return notes, rows.Err()
+}
@@ -0,0 +1,287 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"memo-studio/backend/database"
+	"memo-studio/backend/utils"
+	"strings"
+	"time"
+)
+
+// Task 从笔记 Markdown 复选框解析出的任务
+type Task struct {
+	ID        int       `json:"id"`
+	NoteID    int       `json:"note_id"`
+	NoteTitle string    `json:"note_title"`
+	Line      int       `json:"line"`
+	Text      string    `json:"text"`
+	Done      bool      `json:"done"`
+	DueDate   *string   `json:"due_date"` // YYYY-MM-DD
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// TaskQuery 任务查询条件
+type TaskQuery struct {
+	UserID    int
+	Status    string // open（默认）/ done / all
+	NoteID    int
+	DueBefore string // 截止日期早于等于（YYYY-MM-DD）
+	DueAfter  string // 截止日期晚于等于（YYYY-MM-DD）
+	HasDue    *bool
+	Limit     int
+	Offset    int
+}
+
+var (
+	// ErrTaskNoteLocked 任务所在笔记已加密
+	ErrTaskNoteLocked = errors.New("任务所在笔记已加密")
+	// ErrTaskOutOfSync 笔记内容中已找不到该任务
+	ErrTaskOutOfSync = errors.New("笔记内容已变更，任务不存在")
+)
+
+// taskDB *sql.DB 与 *sql.Tx 的公共方法
+type taskDB interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+type storedTask struct {
+	id   int
+	text string
+	used bool
+}
+
+// SyncNoteTasks 按笔记当前内容同步任务：文本相同的任务保留 id，
+// 其余删除或新建；加密笔记的任务全部删除
+func SyncNoteTasks(q taskDB, noteID int) error {
+	var userID sql.NullInt64
+	var content string
+	var locked bool
+	err := q.QueryRow(`SELECT user_id, COALESCE(content, ''), locked FROM notes WHERE id = ?`, noteID).Scan(&userID, &content, &locked)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if locked {
+		_, err := q.Exec(`DELETE FROM tasks WHERE note_id = ?`, noteID)
+		return err
+	}
+
+	rows, err := q.Query(`SELECT id, text FROM tasks WHERE note_id = ? ORDER BY line`, noteID)
+	if err != nil {
+		return err
+	}
+	var existing []*storedTask
+	for rows.Next() {
+		var t storedTask
+		if err := rows.Scan(&t.id, &t.text); err != nil {
+			rows.Close()
+			return err
+		}
+		existing = append(existing, &t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, p := range utils.ParseTasks(content) {
+		var due interface{}
+		if p.Due != "" {
+			due = p.Due
+		}
+		var match *storedTask
+		for _, t := range existing {
+			if !t.used && t.text == p.Text {
+				match = t
+				break
+			}
+		}
+		if match != nil {
+			match.used = true
+			if _, err := q.Exec(
+				`UPDATE tasks SET line = ?, done = ?, due_date = ?, user_id = ?,
+				   updated_at = CASE WHEN done != ? OR COALESCE(due_date, '') != COALESCE(?, '') THEN CURRENT_TIMESTAMP ELSE updated_at END
+				 WHERE id = ?`,
+				p.Line, p.Done, due, userID, p.Done, due, match.id,
+			); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := q.Exec(
+			`INSERT INTO tasks (note_id, user_id, line, text, done, due_date) VALUES (?, ?, ?, ?, ?, ?)`,
+			noteID, userID, p.Line, p.Text, p.Done, due,
+		); err != nil {
+			return err
+		}
+	}
+	for _, t := range existing {
+		if !t.used {
+			if _, err := q.Exec(`DELETE FROM tasks WHERE id = ?`, t.id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+const taskColumns = `t.id, t.note_id, COALESCE(n.title, ''), t.line, t.text, t.done, t.due_date, t.created_at, t.updated_at`
+
+func scanTask(scanner interface{ Scan(...any) error }) (*Task, error) {
+	var t Task
+	var due sql.NullString
+	if err := scanner.Scan(&t.ID, &t.NoteID, &t.NoteTitle, &t.Line, &t.Text, &t.Done, &due, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		return nil, err
+	}
+	if due.Valid {
+		t.DueDate = &due.String
+	}
+	return &t, nil
+}
+
+// ListTasks 列出用户的任务：有截止日期的按日期升序在前，其余按笔记更新时间倒序、行号升序
+func ListTasks(q TaskQuery) ([]Task, error) {
+	where := []string{"t.user_id = ?"}
+	args := []interface{}{q.UserID}
+	switch q.Status {
+	case "done":
+		where = append(where, "t.done = 1")
+	case "all":
+	default:
+		where = append(where, "t.done = 0")
+	}
+	if q.NoteID > 0 {
+		where = append(where, "t.note_id = ?")
+		args = append(args, q.NoteID)
+	}
+	if q.DueBefore != "" {
+		where = append(where, "t.due_date IS NOT NULL AND t.due_date <= ?")
+		args = append(args, q.DueBefore)
+	}
+	if q.DueAfter != "" {
+		where = append(where, "t.due_date IS NOT NULL AND t.due_date >= ?")
+		args = append(args, q.DueAfter)
+	}
+	if q.HasDue != nil {
+		if *q.HasDue {
+			where = append(where, "t.due_date IS NOT NULL")
+		} else {
+			where = append(where, "t.due_date IS NULL")
+		}
+	}
+	if q.Limit <= 0 || q.Limit > 500 {
+		q.Limit = 100
+	}
+	if q.Offset < 0 {
+		q.Offset = 0
+	}
+	args = append(args, q.Limit, q.Offset)
+
+	rows, err := database.DB.Query(
+		`SELECT `+taskColumns+` FROM tasks t JOIN notes n ON n.id = t.note_id
+		 WHERE `+strings.Join(where, " AND ")+`
+		 ORDER BY t.due_date IS NULL, t.due_date, n.updated_at DESC, t.note_id, t.line
+		 LIMIT ? OFFSET ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []Task
+	for rows.Next() {
+		t, err := scanTask(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *t)
+	}
+	return list, rows.Err()
+}
+
+// GetTask 获取用户的任务；不存在时返回 nil, nil
+func GetTask(id, userID int) (*Task, error) {
+	row := database.DB.QueryRow(
+		`SELECT `+taskColumns+` FROM tasks t JOIN notes n ON n.id = t.note_id WHERE t.id = ? AND t.user_id = ?`,
+		id, userID,
+	)
+	t, err := scanTask(row)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return t, err
+}
+
+// SetTaskDone 勾选/取消勾选任务：在同一事务中改写笔记里的复选框并重新同步任务
+func SetTaskDone(id, userID int, done bool) (*Task, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var noteID, line int
+	var text string
+	var current bool
+	err = tx.QueryRow(`SELECT note_id, line, text, done FROM tasks WHERE id = ? AND user_id = ?`, id, userID).
+		Scan(&noteID, &line, &text, &current)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var content string
+	var locked bool
+	if err := tx.QueryRow(`SELECT COALESCE(content, ''), locked FROM notes WHERE id = ?`, noteID).Scan(&content, &locked); err != nil {
+		return nil, err
+	}
+	if locked {
+		return nil, ErrTaskNoteLocked
+	}
+
+	// 行号优先，找不到时按文本匹配（同文本的第一条）
+	target := 0
+	parsed := utils.ParseTasks(content)
+	for _, p := range parsed {
+		if p.Line == line && p.Text == text {
+			target = p.Line
+			break
+		}
+	}
+	if target == 0 {
+		for _, p := range parsed {
+			if p.Text == text {
+				target = p.Line
+				break
+			}
+		}
+	}
+	if target == 0 {
+		return nil, ErrTaskOutOfSync
+	}
+
+	updated, ok := utils.SetTaskChecked(content, target, done)
+	if !ok {
+		return nil, ErrTaskOutOfSync
+	}
+	if updated != content {
+		if _, err := tx.Exec(`UPDATE notes SET content = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?`, updated, noteID); err != nil {
+			return nil, err
+		}
+	}
+	if err := SyncNoteTasks(tx, noteID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetTask(id, userID)
+}
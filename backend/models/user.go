@@ -15,6 +15,8 @@ type User struct {
 	Username  string    `json:"username"`
 	Email     string    `json:"email"`
 	IsAdmin   bool      `json:"is_admin"`
+	Role      string    `json:"role"`
+	EmailVerified bool  `json:"email_verified"`
 	MustChangePassword bool `json:"must_change_password"`
 	CreatedAt time.Time `json:"created_at"`
 }
@@ -28,8 +30,8 @@ func CreateUser(username, password, email string) (*User, error) {
 	}
 
 	result, err := database.DB.Exec(
-		"INSERT INTO users (username, password, email, is_admin) VALUES (?, ?, ?, 0)",
-		username, string(hashedPassword), email,
+		"INSERT INTO users (username, password, email, is_admin, role) VALUES (?, ?, ?, 0, ?)",
+		username, string(hashedPassword), email, RoleEditor,
 	)
 	if err != nil {
 		return nil, err
@@ -48,9 +50,9 @@ func GetUserByUsername(username string) (*User, error) {
 	user := &User{}
 	var password string
 	err := database.DB.QueryRow(
-		"SELECT id, username, password, email, is_admin, must_change_password, created_at FROM users WHERE username = ?",
+		"SELECT id, username, password, email, is_admin, role, email_verified, must_change_password, created_at FROM users WHERE username = ?",
 		username,
-	).Scan(&user.ID, &user.Username, &password, &user.Email, &user.IsAdmin, &user.MustChangePassword, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &password, &user.Email, &user.IsAdmin, &user.Role, &user.EmailVerified, &user.MustChangePassword, &user.CreatedAt)
 
 	if err != nil {
 		return nil, err
@@ -64,9 +66,9 @@ func GetUserByUsername(username string) (*User, error) {
 func GetUserByID(id int) (*User, error) {
 	user := &User{}
 	err := database.DB.QueryRow(
-		"SELECT id, username, email, is_admin, must_change_password, created_at FROM users WHERE id = ?",
+		"SELECT id, username, email, is_admin, role, email_verified, must_change_password, created_at FROM users WHERE id = ?",
 		id,
-	).Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.MustChangePassword, &user.CreatedAt)
+	).Scan(&user.ID, &user.Username, &user.Email, &user.IsAdmin, &user.Role, &user.EmailVerified, &user.MustChangePassword, &user.CreatedAt)
 
 	if err != nil {
 		return nil, err
@@ -81,13 +83,15 @@ func VerifyPassword(username, password string) (*User, error) {
 	var hashedPassword string
 	var email string
 	var isAdmin bool
+	var role string
+	var emailVerified bool
 	var mustChange bool
 	var createdAt time.Time
 
 	err := database.DB.QueryRow(
-		"SELECT id, password, email, is_admin, must_change_password, created_at FROM users WHERE username = ?",
+		"SELECT id, password, email, is_admin, role, email_verified, must_change_password, created_at FROM users WHERE username = ?",
 		username,
-	).Scan(&userID, &hashedPassword, &email, &isAdmin, &mustChange, &createdAt)
+	).Scan(&userID, &hashedPassword, &email, &isAdmin, &role, &emailVerified, &mustChange, &createdAt)
 
 	if err != nil {
 		return nil, err
@@ -104,6 +108,8 @@ func VerifyPassword(username, password string) (*User, error) {
 		Username:  username,
 		Email:     email,
 		IsAdmin:   isAdmin,
+		Role:      role,
+		EmailVerified: emailVerified,
 		MustChangePassword: mustChange,
 		CreatedAt: createdAt,
 	}, nil
@@ -115,9 +121,10 @@ func UpdateMe(userID int, newUsername, newEmail string) (*User, error) {
 	if newUsername == "" {
 		return nil, fmt.Errorf("用户名不能为空")
 	}
+	// 邮箱变更后需要重新验证
 	_, err := database.DB.Exec(
-		"UPDATE users SET username = ?, email = ? WHERE id = ?",
-		newUsername, newEmail, userID,
+		"UPDATE users SET username = ?, email_verified = CASE WHEN email = ? THEN email_verified ELSE 0 END, email = ? WHERE id = ?",
+		newUsername, newEmail, newEmail, userID,
 	)
 	if err != nil {
 		return nil, err
@@ -153,6 +160,7 @@ type CreateUserInput struct {
 	Password string
 	Email    string
 	IsAdmin  bool
+	Role     string // 为空时按 IsAdmin 推导
 }
 
 func AdminCreateUser(in CreateUserInput) (*User, error) {
@@ -168,13 +176,16 @@ func AdminCreateUser(in CreateUserInput) (*User, error) {
 	if err != nil {
 		return nil, err
 	}
-	adminVal := 0
-	if in.IsAdmin {
-		adminVal = 1
+	role := in.Role
+	if role == "" {
+		role = RoleFromLegacy(in.IsAdmin)
+	}
+	if !IsValidRole(role) {
+		return nil, fmt.Errorf("无效的角色: %s", role)
 	}
 	res, err := database.DB.Exec(
-		"INSERT INTO users (username, password, email, is_admin) VALUES (?, ?, ?, ?)",
-		in.Username, string(hashedPassword), in.Email, adminVal,
+		"INSERT INTO users (username, password, email, is_admin, role) VALUES (?, ?, ?, ?, ?)",
+		in.Username, string(hashedPassword), in.Email, role == RoleAdmin, role,
 	)
 	if err != nil {
 		return nil, err
@@ -187,7 +198,7 @@ func AdminCreateUser(in CreateUserInput) (*User, error) {
 }
 
 func AdminListUsers() ([]User, error) {
-	rows, err := database.DB.Query("SELECT id, username, email, is_admin, must_change_password, created_at FROM users ORDER BY id ASC")
+	rows, err := database.DB.Query("SELECT id, username, email, is_admin, role, email_verified, must_change_password, created_at FROM users ORDER BY id ASC")
 	if err != nil {
 		return nil, err
 	}
@@ -195,7 +206,7 @@ func AdminListUsers() ([]User, error) {
 	var list []User
 	for rows.Next() {
 		var u User
-		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.MustChangePassword, &u.CreatedAt); err != nil {
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.Role, &u.EmailVerified, &u.MustChangePassword, &u.CreatedAt); err != nil {
 			return nil, err
 		}
 		list = append(list, u)
@@ -203,23 +214,61 @@ func AdminListUsers() ([]User, error) {
 	return list, rows.Err()
 }
 
-func AdminUpdateUser(id int, username, email string, isAdmin bool) (*User, error) {
+// AdminUpdateUser 修改用户资料与角色；role 为空时保持原角色
+func AdminUpdateUser(id int, username, email, role string) (*User, error) {
 	username = strings.TrimSpace(username)
 	email = strings.TrimSpace(email)
 	if username == "" {
 		return nil, fmt.Errorf("用户名不能为空")
 	}
-	adminVal := 0
-	if isAdmin {
-		adminVal = 1
+	if role != "" {
+		if err := SetUserRole(id, role); err != nil {
+			return nil, err
+		}
 	}
-	_, err := database.DB.Exec("UPDATE users SET username = ?, email = ?, is_admin = ? WHERE id = ?", username, email, adminVal, id)
+	_, err := database.DB.Exec(
+		"UPDATE users SET username = ?, email_verified = CASE WHEN email = ? THEN email_verified ELSE 0 END, email = ? WHERE id = ?",
+		username, email, email, id,
+	)
 	if err != nil {
 		return nil, err
 	}
 	return GetUserByID(id)
 }
 
+// ErrLastAdmin 不能移除最后一个管理员
+var ErrLastAdmin = fmt.Errorf("至少需要保留一个管理员")
+
+// SetUserRole 设置用户角色（同步 is_admin）；不允许降级最后一个管理员
+func SetUserRole(id int, role string) error {
+	if !IsValidRole(role) {
+		return fmt.Errorf("无效的角色: %s", role)
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow("SELECT role FROM users WHERE id = ?", id).Scan(&current); err != nil {
+		return err
+	}
+	if current == RoleAdmin && role != RoleAdmin {
+		var admins int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM users WHERE role = ?", RoleAdmin).Scan(&admins); err != nil {
+			return err
+		}
+		if admins <= 1 {
+			return ErrLastAdmin
+		}
+	}
+	if _, err := tx.Exec("UPDATE users SET role = ?, is_admin = ? WHERE id = ?", role, role == RoleAdmin, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
 func AdminDeleteUser(id int) error {
 	// 防止误删默认管理员（可按需调整）
 	var username string
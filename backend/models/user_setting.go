@@ -0,0 +1,176 @@
+package models
+
+import (
+	"database/sql"
+	"math"
+	"memo-studio/backend/database"
+	"strconv"
+)
+
+// 用户设置键
+const (
+	UserSettingAutoSummarize         = "auto_summarize"
+	UserSettingAutoSummarizeMinChars = "auto_summarize_min_chars"
+	UserSettingAutoTag               = "auto_tag"
+	UserSettingTimezone              = "timezone"
+	UserSettingDigestWeekly          = "digest_weekly"
+	UserSettingDigestMonthly         = "digest_monthly"
+	UserSettingDigestTimezone        = "digest_timezone"
+	UserSettingDigestHour            = "digest_hour"
+	UserSettingDigestWeekday         = "digest_weekday"
+	UserSettingDigestMonthDay        = "digest_month_day"
+	UserSettingDigestAI              = "digest_ai"
+	UserSettingDigestWebhook         = "digest_webhook"
+)
+
+// DefaultAutoSummarizeMinChars 自动总结的最小正文长度（字符数）
+const DefaultAutoSummarizeMinChars = 500
+
+// 定期回顾的默认时间：每周一 / 每月 1 日 8 点
+const (
+	DefaultDigestHour     = 8
+	DefaultDigestWeekday  = 1
+	DefaultDigestMonthDay = 1
+)
+
+// UserSettings 用户级设置
+type UserSettings struct {
+	AutoSummarize         bool `json:"auto_summarize"`           // 新建长笔记后自动生成 AI 总结
+	AutoSummarizeMinChars int  `json:"auto_summarize_min_chars"` // 超过该长度才自动总结
+	AutoTag               bool `json:"auto_tag"`                 // 新建笔记后自动应用标签建议（来源标记为 ai）
+
+	Timezone string `json:"timezone"` // 用户时区（IANA），用于活动统计等按天分组；空表示服务器时区
+
+	DigestWeekly   bool   `json:"digest_weekly"`    // 每周生成回顾（覆盖上一周）
+	DigestMonthly  bool   `json:"digest_monthly"`   // 每月生成回顾（覆盖上一个自然月）
+	DigestTimezone string `json:"digest_timezone"`  // IANA 时区，如 Asia/Shanghai；空表示服务器时区
+	DigestHour     int    `json:"digest_hour"`      // 生成时刻（0-23）
+	DigestWeekday  int    `json:"digest_weekday"`   // 周报生成日（0=周日 … 6=周六）
+	DigestMonthDay int    `json:"digest_month_day"` // 月报生成日（1-28）
+	DigestAI       bool   `json:"digest_ai"`        // 回顾中加入 AI 洞察（消耗 token）
+	DigestWebhook  string `json:"digest_webhook"`   // 生成后以 POST JSON 推送到该地址
+}
+
+// DigestZone 回顾使用的时区：未单独设置时沿用用户时区
+func (st UserSettings) DigestZone() string {
+	if st.DigestTimezone != "" {
+		return st.DigestTimezone
+	}
+	return st.Timezone
+}
+
+// GetUserSetting 读取用户设置；不存在时返回 "", false
+func GetUserSetting(userID int, key string) (string, bool, error) {
+	var v string
+	err := database.DB.QueryRow(`SELECT value FROM user_settings WHERE user_id = ? AND key = ?`, userID, key).Scan(&v)
+	if err == sql.ErrNoRows {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return v, true, nil
+}
+
+// SetUserSetting 写入用户设置
+func SetUserSetting(userID int, key, value string) error {
+	_, err := database.DB.Exec(
+		`INSERT INTO user_settings (user_id, key, value, updated_at) VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+		 ON CONFLICT(user_id, key) DO UPDATE SET value = excluded.value, updated_at = CURRENT_TIMESTAMP`,
+		userID, key, value,
+	)
+	return err
+}
+
+// ListUserIDsWithSetting 设置项为指定值的用户
+func ListUserIDsWithSetting(key, value string) ([]int, error) {
+	rows, err := database.DB.Query(`SELECT user_id FROM user_settings WHERE key = ? AND value = ? ORDER BY user_id`, key, value)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// GetUserSettings 读取用户设置，未设置的项使用默认值
+func GetUserSettings(userID int) (UserSettings, error) {
+	st := UserSettings{
+		AutoSummarizeMinChars: DefaultAutoSummarizeMinChars,
+		DigestHour:            DefaultDigestHour,
+		DigestWeekday:         DefaultDigestWeekday,
+		DigestMonthDay:        DefaultDigestMonthDay,
+	}
+	rows, err := database.DB.Query(`SELECT key, value FROM user_settings WHERE user_id = ?`, userID)
+	if err != nil {
+		return st, err
+	}
+	values := map[string]string{}
+	for rows.Next() {
+		var k, v string
+		if err := rows.Scan(&k, &v); err != nil {
+			rows.Close()
+			return st, err
+		}
+		values[k] = v
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return st, err
+	}
+
+	setBool := func(key string, dst *bool) {
+		if v, ok := values[key]; ok {
+			*dst = v == "true"
+		}
+	}
+	setInt := func(key string, dst *int, min, max int) {
+		if n, err := strconv.Atoi(values[key]); err == nil && n >= min && n <= max {
+			*dst = n
+		}
+	}
+	setBool(UserSettingAutoSummarize, &st.AutoSummarize)
+	setInt(UserSettingAutoSummarizeMinChars, &st.AutoSummarizeMinChars, 0, math.MaxInt32)
+	setBool(UserSettingAutoTag, &st.AutoTag)
+	st.Timezone = values[UserSettingTimezone]
+	setBool(UserSettingDigestWeekly, &st.DigestWeekly)
+	setBool(UserSettingDigestMonthly, &st.DigestMonthly)
+	st.DigestTimezone = values[UserSettingDigestTimezone]
+	setInt(UserSettingDigestHour, &st.DigestHour, 0, 23)
+	setInt(UserSettingDigestWeekday, &st.DigestWeekday, 0, 6)
+	setInt(UserSettingDigestMonthDay, &st.DigestMonthDay, 1, 28)
+	setBool(UserSettingDigestAI, &st.DigestAI)
+	st.DigestWebhook = values[UserSettingDigestWebhook]
+	return st, nil
+}
+
+// SaveUserSettings 保存用户设置
+func SaveUserSettings(userID int, st UserSettings) error {
+	pairs := [][2]string{
+		{UserSettingAutoSummarize, strconv.FormatBool(st.AutoSummarize)},
+		{UserSettingAutoSummarizeMinChars, strconv.Itoa(st.AutoSummarizeMinChars)},
+		{UserSettingAutoTag, strconv.FormatBool(st.AutoTag)},
+		{UserSettingTimezone, st.Timezone},
+		{UserSettingDigestWeekly, strconv.FormatBool(st.DigestWeekly)},
+		{UserSettingDigestMonthly, strconv.FormatBool(st.DigestMonthly)},
+		{UserSettingDigestTimezone, st.DigestTimezone},
+		{UserSettingDigestHour, strconv.Itoa(st.DigestHour)},
+		{UserSettingDigestWeekday, strconv.Itoa(st.DigestWeekday)},
+		{UserSettingDigestMonthDay, strconv.Itoa(st.DigestMonthDay)},
+		{UserSettingDigestAI, strconv.FormatBool(st.DigestAI)},
+		{UserSettingDigestWebhook, st.DigestWebhook},
+	}
+	for _, p := range pairs {
+		if err := SetUserSetting(userID, p[0], p[1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
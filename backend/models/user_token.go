@@ -0,0 +1,199 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"memo-studio/backend/database"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// 账户令牌用途
+const (
+	TokenPurposePasswordReset = "password_reset"
+	TokenPurposeEmailVerify   = "email_verify"
+)
+
+// ErrTokenInvalid 令牌不存在、已使用或已过期
+var ErrTokenInvalid = errors.New("链接无效或已过期")
+
+func hashUserToken(raw string) string {
+	sum := sha256.Sum256([]byte(strings.TrimSpace(raw)))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateUserToken 生成一次性令牌，返回明文（仅用于发送邮件，库中只存哈希）
+// 同一用途的旧令牌会被作废，保证任何时刻只有最新一封邮件有效。
+func CreateUserToken(userID int, purpose, email string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := hex.EncodeToString(b)
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	if _, err := tx.Exec(
+		`UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL`,
+		now, userID, purpose,
+	); err != nil {
+		return "", err
+	}
+	if _, err := tx.Exec(
+		`INSERT INTO user_tokens (user_id, purpose, token_hash, email, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		userID, purpose, hashUserToken(raw), email, now.Add(ttl),
+	); err != nil {
+		return "", err
+	}
+	return raw, tx.Commit()
+}
+
+// consumeUserToken 在事务内核销令牌，返回用户 ID 与签发时的邮箱
+func consumeUserToken(tx *sql.Tx, purpose, raw string) (int, string, error) {
+	if strings.TrimSpace(raw) == "" {
+		return 0, "", ErrTokenInvalid
+	}
+	var (
+		id, userID int
+		email      string
+		expiresAt  time.Time
+	)
+	err := tx.QueryRow(
+		`SELECT id, user_id, email, expires_at FROM user_tokens WHERE token_hash = ? AND purpose = ? AND used_at IS NULL`,
+		hashUserToken(raw), purpose,
+	).Scan(&id, &userID, &email, &expiresAt)
+	if err == sql.ErrNoRows {
+		return 0, "", ErrTokenInvalid
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	now := time.Now().UTC()
+	if !now.Before(expiresAt) {
+		return 0, "", ErrTokenInvalid
+	}
+	res, err := tx.Exec(`UPDATE user_tokens SET used_at = ? WHERE id = ? AND used_at IS NULL`, now, id)
+	if err != nil {
+		return 0, "", err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, "", ErrTokenInvalid
+	}
+	return userID, email, nil
+}
+
+// ResetPasswordWithToken 使用找回密码令牌重置密码，并使之前签发的登录令牌失效
+func ResetPasswordWithToken(raw, newPassword string) (*User, error) {
+	hashed, err := bcrypt.GenerateFromPassword([]byte(newPassword), bcrypt.DefaultCost)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, _, err := consumeUserToken(tx, TokenPurposePasswordReset, raw)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.Exec(`UPDATE users SET password = ?, must_change_password = 0, password_changed_at = ? WHERE id = ?`,
+		string(hashed), time.Now().UTC().Format(sqlTimeLayout), userID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
+
+// AuthState 校验登录令牌时需要的用户状态
+type AuthState struct {
+	Role              string     // 当前角色（以数据库为准，不使用令牌中的角色）
+	PasswordChangedAt *time.Time // 最近一次找回密码的时间，签发早于此时间的登录令牌无效；从未重置时为 nil
+}
+
+// GetAuthState 读取用户的当前角色与找回密码时间；用户不存在时返回 nil, nil
+func GetAuthState(userID int) (*AuthState, error) {
+	var role string
+	var isAdmin bool
+	var changed sql.NullTime
+	err := database.DB.QueryRow(`SELECT COALESCE(role, ''), is_admin, password_changed_at FROM users WHERE id = ?`, userID).
+		Scan(&role, &isAdmin, &changed)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	st := &AuthState{Role: role}
+	if !IsValidRole(st.Role) {
+		st.Role = RoleFromLegacy(isAdmin)
+	}
+	if changed.Valid {
+		t := changed.Time.UTC()
+		st.PasswordChangedAt = &t
+	}
+	return st, nil
+}
+
+// VerifyEmailWithToken 使用验证令牌确认邮箱；签发后邮箱已被修改则令牌失效
+func VerifyEmailWithToken(raw string) (*User, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	userID, email, err := consumeUserToken(tx, TokenPurposeEmailVerify, raw)
+	if err != nil {
+		return nil, err
+	}
+	res, err := tx.Exec(`UPDATE users SET email_verified = 1 WHERE id = ? AND email = ?`, userID, email)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, ErrTokenInvalid
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
+
+// FindUsersByEmail 按邮箱查找用户（忽略大小写；历史数据可能多个账号共用邮箱）
+func FindUsersByEmail(email string) ([]User, error) {
+	email = strings.TrimSpace(email)
+	if email == "" {
+		return nil, nil
+	}
+	rows, err := database.DB.Query(
+		"SELECT id, username, email, is_admin, role, email_verified, must_change_password, created_at FROM users WHERE lower(email) = lower(?)",
+		email,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.IsAdmin, &u.Role, &u.EmailVerified, &u.MustChangePassword, &u.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, u)
+	}
+	return list, rows.Err()
+}
@@ -0,0 +1,126 @@
+package models
+
+import (
+	"database/sql"
+	"memo-studio/backend/database"
+	"time"
+)
+
+// UserVault 用户密钥库（被口令包裹的数据密钥）
+type UserVault struct {
+	UserID     int       `json:"user_id"`
+	Salt       string    `json:"-"`
+	WrappedKey string    `json:"-"`
+	KeyVersion int       `json:"key_version"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// GetUserVault 获取用户密钥库；未设置时返回 nil, nil
+func GetUserVault(userID int) (*UserVault, error) {
+	var v UserVault
+	err := database.DB.QueryRow(
+		`SELECT user_id, salt, wrapped_key, key_version, created_at, updated_at FROM user_vaults WHERE user_id = ?`,
+		userID,
+	).Scan(&v.UserID, &v.Salt, &v.WrappedKey, &v.KeyVersion, &v.CreatedAt, &v.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// CreateUserVault 初始化密钥库
+func CreateUserVault(userID int, salt, wrappedKey string) (*UserVault, error) {
+	_, err := database.DB.Exec(
+		`INSERT INTO user_vaults (user_id, salt, wrapped_key) VALUES (?, ?, ?)`,
+		userID, salt, wrappedKey,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return GetUserVault(userID)
+}
+
+// UpdateUserVaultWrapping 修改口令：仅替换 salt 与包裹后的数据密钥
+func UpdateUserVaultWrapping(userID int, salt, wrappedKey string) error {
+	_, err := database.DB.Exec(
+		`UPDATE user_vaults SET salt = ?, wrapped_key = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`,
+		salt, wrappedKey, userID,
+	)
+	return err
+}
+
+// LockedNote 加密笔记的密文
+type LockedNote struct {
+	ID         int
+	Ciphertext string
+}
+
+// IsNoteLocked 笔记是否已加密
+func IsNoteLocked(noteID int) (bool, error) {
+	var locked bool
+	err := database.DB.QueryRow(`SELECT locked FROM notes WHERE id = ?`, noteID).Scan(&locked)
+	return locked, err
+}
+
+// GetNoteCiphertext 获取加密笔记的密文
+func GetNoteCiphertext(noteID int) (string, error) {
+	var content sql.NullString
+	err := database.DB.QueryRow(`SELECT content FROM notes WHERE id = ? AND locked = 1`, noteID).Scan(&content)
+	return content.String, err
+}
+
+// SetNoteEncryption 写入笔记内容并设置加密标记（不修改 updated_at，加解密不算编辑）；
+// 取消加密后重新解析任务
+func SetNoteEncryption(noteID int, content string, locked bool) error {
+	if _, err := database.DB.Exec(`UPDATE notes SET content = ?, locked = ? WHERE id = ?`, content, locked, noteID); err != nil {
+		return err
+	}
+	if locked {
+		return nil
+	}
+	return SyncNoteTasks(database.DB, noteID)
+}
+
+// ListLockedNotes 列出用户全部加密笔记的密文（用于轮换数据密钥）
+func ListLockedNotes(userID int) ([]LockedNote, error) {
+	rows, err := database.DB.Query(`SELECT id, COALESCE(content, '') FROM notes WHERE user_id = ? AND locked = 1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []LockedNote
+	for rows.Next() {
+		var n LockedNote
+		if err := rows.Scan(&n.ID, &n.Ciphertext); err != nil {
+			return nil, err
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+// RotateUserVaultKey 轮换数据密钥：在同一事务内替换包裹密钥并写入重新加密的笔记
+func RotateUserVaultKey(userID int, salt, wrappedKey string, reencrypted []LockedNote) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(
+		`UPDATE user_vaults SET salt = ?, wrapped_key = ?, key_version = key_version + 1, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?`,
+		salt, wrappedKey, userID,
+	); err != nil {
+		return err
+	}
+	for _, n := range reencrypted {
+		if _, err := tx.Exec(`UPDATE notes SET content = ? WHERE id = ? AND user_id = ? AND locked = 1`, n.Ciphertext, n.ID, userID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
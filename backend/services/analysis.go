@@ -0,0 +1,714 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/utils"
+)
+
+// 离线分析：不调用大模型的情感评分、关键词提取、情绪趋势与行动统计。
+// 洞察接口在模型未配置或调用失败时使用，定期回顾也用它计算情绪。
+
+// 情感标签
+const (
+	SentimentPositive = "positive"
+	SentimentNegative = "negative"
+	SentimentNeutral  = "neutral"
+)
+
+// sentimentThreshold 归一化得分超过该值才算积极/消极
+const sentimentThreshold = 0.25
+
+// negationScope 否定词作用的词数
+const negationScope = 3
+
+// AnalysisNote 参与离线分析的一条笔记；ID 为 0 表示客户端直接提交的文本，CreatedAt 为零值表示时间未知
+type AnalysisNote struct {
+	ID        int
+	Text      string
+	CreatedAt time.Time
+}
+
+// NotesForAnalysis 把笔记转换为分析输入（标题与正文合并）
+func NotesForAnalysis(list []models.Note) []AnalysisNote {
+	notes := make([]AnalysisNote, 0, len(list))
+	for _, n := range list {
+		notes = append(notes, AnalysisNote{ID: n.ID, Text: strings.TrimSpace(n.Title + "\n" + n.Content), CreatedAt: n.CreatedAt})
+	}
+	return notes
+}
+
+// TextsForAnalysis 把客户端提交的文本转换为分析输入
+func TextsForAnalysis(texts []string) []AnalysisNote {
+	notes := make([]AnalysisNote, 0, len(texts))
+	for _, t := range texts {
+		notes = append(notes, AnalysisNote{Text: t})
+	}
+	return notes
+}
+
+// ========== 分词 ==========
+
+// analysisToken 分词结果；Break 表示标点等子句边界
+type analysisToken struct {
+	Text  string
+	Han   bool
+	Break bool
+}
+
+var (
+	analysisDictOnce   sync.Once
+	analysisDict       map[string]bool
+	analysisDictMaxLen int
+)
+
+// chineseDict 中文切分词典：情感词、否定词、程度副词、主题词、行动词与常用词
+func chineseDict() (map[string]bool, int) {
+	analysisDictOnce.Do(func() {
+		analysisDict = map[string]bool{}
+		add := func(w string) {
+			r, _ := utf8.DecodeRuneInString(w)
+			if !unicode.Is(unicode.Han, r) {
+				return
+			}
+			analysisDict[w] = true
+			if n := utf8.RuneCountInString(w); n > analysisDictMaxLen {
+				analysisDictMaxLen = n
+			}
+		}
+		for w := range sentimentLexicon {
+			add(w)
+		}
+		for w := range sentimentNegators {
+			add(w)
+		}
+		for w := range sentimentIntensifiers {
+			add(w)
+		}
+		for _, words := range TopicKeywords {
+			for _, w := range words {
+				add(w)
+			}
+		}
+		for _, w := range actionTodoWords {
+			add(w)
+		}
+		for _, w := range actionDoneWords {
+			add(w)
+		}
+		for _, w := range commonChineseWords {
+			add(w)
+		}
+	})
+	return analysisDict, analysisDictMaxLen
+}
+
+// tokenize 英文按单词（小写）切分；中文按词典正向最长匹配，未收录的字单独成词
+func tokenize(text string) []analysisToken {
+	dict, maxLen := chineseDict()
+	runes := []rune(text)
+	var tokens []analysisToken
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.Is(unicode.Han, r):
+			j := i
+			for j < len(runes) && unicode.Is(unicode.Han, runes[j]) {
+				j++
+			}
+			for k := i; k < j; {
+				size := 1
+				for n := min(maxLen, j-k); n >= 2; n-- {
+					if dict[string(runes[k:k+n])] {
+						size = n
+						break
+					}
+				}
+				tokens = append(tokens, analysisToken{Text: string(runes[k : k+size]), Han: true})
+				k += size
+			}
+			i = j
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			j := i
+			for j < len(runes) {
+				c := runes[j]
+				if unicode.IsLetter(c) && !unicode.Is(unicode.Han, c) || unicode.IsDigit(c) {
+					j++
+					continue
+				}
+				// 英文缩写中的撇号，如 don't
+				if (c == '\'' || c == '’') && j+1 < len(runes) && unicode.IsLetter(runes[j+1]) && j > i {
+					j++
+					continue
+				}
+				break
+			}
+			word := strings.ToLower(strings.ReplaceAll(string(runes[i:j]), "’", "'"))
+			tokens = append(tokens, analysisToken{Text: word})
+			i = j
+		case unicode.IsSpace(r):
+			i++
+		default:
+			if len(tokens) > 0 && !tokens[len(tokens)-1].Break {
+				tokens = append(tokens, analysisToken{Break: true})
+			}
+			i++
+		}
+	}
+	return tokens
+}
+
+// ========== 情感 ==========
+
+// SentimentScore 单条文本的情感得分；Score 在 (-1, 1) 之间
+type SentimentScore struct {
+	Score         float64  `json:"score"`
+	Label         string   `json:"label"`
+	PositiveWords []string `json:"positive_words,omitempty"`
+	NegativeWords []string `json:"negative_words,omitempty"`
+}
+
+// ScoreSentiment 基于词典的情感评分：程度副词放大或减弱紧随的情感词，
+// 否定词使其后几个词内的情感词反转并减半（“不太好”偏消极但弱于“糟糕”）
+func ScoreSentiment(text string) SentimentScore {
+	tokens := tokenize(text)
+	var res SentimentScore
+	var sum float64
+	negate, boost := 0, 1.0
+	isModified := func(i int) bool {
+		if i >= len(tokens) {
+			return false
+		}
+		t := tokens[i].Text
+		_, intensifier := sentimentIntensifiers[t]
+		return sentimentLexicon[t] != 0 || intensifier || sentimentNegators[t]
+	}
+	for i, tok := range tokens {
+		if tok.Break {
+			negate, boost = 0, 1
+			continue
+		}
+		if sentimentNegators[tok.Text] {
+			negate = negationScope
+			continue
+		}
+		// “好”既是程度副词也是情感词：后面跟情感词时按程度副词处理
+		if w, ok := sentimentIntensifiers[tok.Text]; ok && isModified(i+1) {
+			boost *= w
+			continue
+		}
+		if w := sentimentLexicon[tok.Text]; w != 0 {
+			v, word := w*boost, tok.Text
+			if negate > 0 {
+				v = -v / 2
+				if tok.Han {
+					word = "不" + word
+				} else {
+					word = "not " + word
+				}
+			}
+			sum += v
+			if v > 0 {
+				res.PositiveWords = append(res.PositiveWords, word)
+			} else {
+				res.NegativeWords = append(res.NegativeWords, word)
+			}
+			negate, boost = 0, 1
+			continue
+		}
+		boost = 1
+		if negate > 0 {
+			negate--
+		}
+	}
+	res.Score = roundScore(sum / math.Sqrt(sum*sum+4))
+	res.Label = sentimentLabel(res.Score)
+	return res
+}
+
+func sentimentLabel(score float64) string {
+	switch {
+	case score >= sentimentThreshold:
+		return SentimentPositive
+	case score <= -sentimentThreshold:
+		return SentimentNegative
+	default:
+		return SentimentNeutral
+	}
+}
+
+func roundScore(v float64) float64 {
+	return math.Round(v*1000) / 1000
+}
+
+// TermCount 词语及出现次数
+type TermCount struct {
+	Term  string `json:"term"`
+	Count int    `json:"count"`
+}
+
+// SentimentSummary 一组笔记的情感统计（按笔记计数）
+type SentimentSummary struct {
+	Positive        int         `json:"positive"`
+	Negative        int         `json:"negative"`
+	Neutral         int         `json:"neutral"`
+	Average         float64     `json:"average"` // 各笔记得分的平均值
+	PositiveNoteIDs []int       `json:"positive_note_ids,omitempty"`
+	NegativeNoteIDs []int       `json:"negative_note_ids,omitempty"`
+	PositiveWords   []TermCount `json:"positive_words"`
+	NegativeWords   []TermCount `json:"negative_words"`
+}
+
+// Label 情感概括，如 "😊 整体积极"
+func (s SentimentSummary) Label() string {
+	switch {
+	case s.Positive > s.Negative && s.Average > 0:
+		return "😊 整体积极"
+	case s.Negative > s.Positive && s.Average < 0:
+		return "😔 有些负面情绪"
+	default:
+		return "情绪平稳"
+	}
+}
+
+// AnalyzeSentiment 逐条评分并汇总，列出最常出现的情感词
+func AnalyzeSentiment(notes []AnalysisNote) SentimentSummary {
+	var s SentimentSummary
+	pos, neg := map[string]int{}, map[string]int{}
+	var total float64
+	for _, n := range notes {
+		score := ScoreSentiment(n.Text)
+		total += score.Score
+		switch score.Label {
+		case SentimentPositive:
+			s.Positive++
+			if n.ID > 0 {
+				s.PositiveNoteIDs = append(s.PositiveNoteIDs, n.ID)
+			}
+		case SentimentNegative:
+			s.Negative++
+			if n.ID > 0 {
+				s.NegativeNoteIDs = append(s.NegativeNoteIDs, n.ID)
+			}
+		default:
+			s.Neutral++
+		}
+		for _, w := range score.PositiveWords {
+			pos[w]++
+		}
+		for _, w := range score.NegativeWords {
+			neg[w]++
+		}
+	}
+	if len(notes) > 0 {
+		s.Average = roundScore(total / float64(len(notes)))
+	}
+	s.PositiveWords = topTerms(pos, 5)
+	s.NegativeWords = topTerms(neg, 5)
+	return s
+}
+
+func topTerms(counts map[string]int, n int) []TermCount {
+	list := make([]TermCount, 0, len(counts))
+	for t, c := range counts {
+		list = append(list, TermCount{Term: t, Count: c})
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Count != list[j].Count {
+			return list[i].Count > list[j].Count
+		}
+		return list[i].Term < list[j].Term
+	})
+	if len(list) > n {
+		list = list[:n]
+	}
+	return list
+}
+
+// ========== 关键词（TF-IDF） ==========
+
+// maxKeywordTokens 中文关键词最多由几个切分单元组成
+const maxKeywordTokens = 4
+
+// Keyword 关键词：Score 为 TF-IDF 得分，Count 为在分析笔记中出现的次数
+type Keyword struct {
+	Term    string  `json:"term"`
+	Score   float64 `json:"score"`
+	Count   int     `json:"count"`
+	NoteIDs []int   `json:"note_ids,omitempty"`
+}
+
+// Corpus 文档频率统计：用户自己的笔记库作为 IDF 的基准
+type Corpus struct {
+	Docs int
+	DF   map[string]int
+}
+
+// NewCorpus 由一组文本建立词频基准
+func NewCorpus(texts ...string) *Corpus {
+	c := &Corpus{DF: map[string]int{}}
+	for _, t := range texts {
+		c.Add(t)
+	}
+	return c
+}
+
+// Add 加入一篇文档
+func (c *Corpus) Add(text string) {
+	c.Docs++
+	for term := range keywordTerms(text) {
+		c.DF[term]++
+	}
+}
+
+// idf 平滑的逆文档频率
+func (c *Corpus) idf(term string) float64 {
+	return math.Log(float64(c.Docs+1)/float64(c.DF[term]+1)) + 1
+}
+
+// maxCachedCorpora 内存中最多缓存的用户词频基准数，超出时淘汰最久未使用的
+const maxCachedCorpora = 64
+
+var corpusCache = struct {
+	sync.Mutex
+	entries map[int]*cachedCorpus
+	tick    uint64 // 每次访问递增，用于判断最久未使用
+}{entries: map[int]*cachedCorpus{}}
+
+type cachedCorpus struct {
+	version string
+	corpus  *Corpus
+	used    uint64
+}
+
+// getCachedCorpus 版本一致时返回缓存；版本已过期的条目直接删除
+func getCachedCorpus(userID int, version string) *Corpus {
+	corpusCache.Lock()
+	defer corpusCache.Unlock()
+	cached, ok := corpusCache.entries[userID]
+	if !ok {
+		return nil
+	}
+	if cached.version != version {
+		delete(corpusCache.entries, userID)
+		return nil
+	}
+	corpusCache.tick++
+	cached.used = corpusCache.tick
+	return cached.corpus
+}
+
+// putCachedCorpus 写入缓存，超出 maxCachedCorpora 时淘汰最久未使用的条目
+func putCachedCorpus(userID int, version string, c *Corpus) {
+	corpusCache.Lock()
+	defer corpusCache.Unlock()
+	if _, ok := corpusCache.entries[userID]; !ok && len(corpusCache.entries) >= maxCachedCorpora {
+		oldest, oldestUsed := 0, uint64(math.MaxUint64)
+		for id, e := range corpusCache.entries {
+			if e.used < oldestUsed {
+				oldest, oldestUsed = id, e.used
+			}
+		}
+		delete(corpusCache.entries, oldest)
+	}
+	corpusCache.tick++
+	corpusCache.entries[userID] = &cachedCorpus{version: version, corpus: c, used: corpusCache.tick}
+}
+
+// LoadUserCorpus 用户笔记库的词频基准（最近 models.MaxCorpusNotes 条未加密笔记）；
+// 笔记数与最后修改时间不变时复用缓存，缓存最多保留 maxCachedCorpora 个用户
+func LoadUserCorpus(userID int) (*Corpus, error) {
+	version, err := models.CorpusVersion(userID)
+	if err != nil {
+		return nil, err
+	}
+	if c := getCachedCorpus(userID, version); c != nil {
+		return c, nil
+	}
+	c := NewCorpus()
+	if err := models.ForEachNoteText(userID, models.MaxCorpusNotes, c.Add); err != nil {
+		return nil, err
+	}
+	putCachedCorpus(userID, version, c)
+	return c, nil
+}
+
+// isKeywordBreak 关键词不跨越的切分单元：停用词、否定词、程度副词、单字虚词
+func isKeywordBreak(tok analysisToken) bool {
+	if tok.Break || keywordStopWords[tok.Text] || sentimentNegators[tok.Text] {
+		return true
+	}
+	if _, ok := sentimentIntensifiers[tok.Text]; ok {
+		return true
+	}
+	r, size := utf8.DecodeRuneInString(tok.Text)
+	return tok.Han && size == len(tok.Text) && keywordStopChars[r]
+}
+
+// keywordTerms 文本中的候选关键词及次数：英文单词；中文为相邻切分单元组成的 2-4 字词组
+func keywordTerms(text string) map[string]int {
+	terms := map[string]int{}
+	var run []string
+	flush := func() {
+		for i := range run {
+			gram := ""
+			for n := 1; n <= maxKeywordTokens && i+n <= len(run); n++ {
+				gram += run[i+n-1]
+				if l := utf8.RuneCountInString(gram); l >= 2 && l <= 4 {
+					terms[gram]++
+				}
+			}
+		}
+		run = run[:0]
+	}
+	for _, tok := range tokenize(text) {
+		if !tok.Han {
+			flush()
+			if tok.Break || keywordStopWords[tok.Text] || sentimentNegators[tok.Text] || utf8.RuneCountInString(tok.Text) < 2 {
+				continue
+			}
+			if strings.IndexFunc(tok.Text, unicode.IsLetter) < 0 {
+				continue // 纯数字
+			}
+			terms[tok.Text]++
+			continue
+		}
+		if isKeywordBreak(tok) {
+			flush()
+			continue
+		}
+		run = append(run, tok.Text)
+	}
+	flush()
+	return terms
+}
+
+// accidental 词典外的中文词组多为偶然相邻的字：只在一篇笔记里出现过一次的不作为关键词
+func accidental(term string, count int, corpus *Corpus) bool {
+	r, _ := utf8.DecodeRuneInString(term)
+	if !unicode.Is(unicode.Han, r) || count >= 2 || corpus.DF[term] >= 2 {
+		return false
+	}
+	dict, _ := chineseDict()
+	return !dict[term]
+}
+
+// ExtractKeywords 以用户笔记库为基准计算 TF-IDF，返回得分最高的 n 个关键词；
+// 互相包含的中文词组只保留得分更高的一个。corpus 为空时以分析的笔记自身为基准
+func ExtractKeywords(notes []AnalysisNote, corpus *Corpus, n int) []Keyword {
+	if corpus == nil || corpus.Docs == 0 {
+		corpus = NewCorpus()
+		for _, note := range notes {
+			corpus.Add(note.Text)
+		}
+	}
+	counts := map[string]int{}
+	ids := map[string][]int{}
+	for _, note := range notes {
+		for term, c := range keywordTerms(note.Text) {
+			counts[term] += c
+			if note.ID > 0 {
+				ids[term] = append(ids[term], note.ID)
+			}
+		}
+	}
+	candidates := make([]Keyword, 0, len(counts))
+	for term, c := range counts {
+		if accidental(term, c, corpus) {
+			continue
+		}
+		score := (1 + math.Log(float64(c))) * corpus.idf(term)
+		candidates = append(candidates, Keyword{Term: term, Score: score, Count: c, NoteIDs: ids[term]})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if la, lb := utf8.RuneCountInString(a.Term), utf8.RuneCountInString(b.Term); la != lb {
+			return la > lb
+		}
+		return a.Term < b.Term
+	})
+	keywords := []Keyword{}
+	for _, k := range candidates {
+		if len(keywords) >= n {
+			break
+		}
+		overlap := false
+		for _, sel := range keywords {
+			if strings.Contains(sel.Term, k.Term) || strings.Contains(k.Term, sel.Term) {
+				overlap = true
+				break
+			}
+		}
+		if !overlap {
+			k.Score = roundScore(k.Score)
+			keywords = append(keywords, k)
+		}
+	}
+	return keywords
+}
+
+// ========== 情绪趋势 ==========
+
+// MoodPoint 一个时间段内的情绪
+type MoodPoint struct {
+	Bucket   string  `json:"bucket"` // 时间段起始日期 YYYY-MM-DD
+	Notes    int     `json:"notes"`
+	Positive int     `json:"positive"`
+	Negative int     `json:"negative"`
+	Neutral  int     `json:"neutral"`
+	Score    float64 `json:"score"` // 平均得分；没有笔记时为 0
+}
+
+// MoodGranularity 按时间跨度选择趋势粒度：一个月内按天，半年内按周，否则按月
+func MoodGranularity(from, to time.Time) string {
+	switch days := to.Sub(from).Hours() / 24; {
+	case days <= 31:
+		return models.ActivityDay
+	case days <= 183:
+		return models.ActivityWeek
+	default:
+		return models.ActivityMonth
+	}
+}
+
+// MoodTrend 按创建时间分段统计情绪；granularity 为空时按笔记的时间跨度选择，中间没有笔记的时段补零
+func MoodTrend(notes []AnalysisNote, granularity string, loc *time.Location) []MoodPoint {
+	if loc == nil {
+		loc = time.Local
+	}
+	var first, last time.Time
+	for _, n := range notes {
+		if n.CreatedAt.IsZero() {
+			continue
+		}
+		if first.IsZero() || n.CreatedAt.Before(first) {
+			first = n.CreatedAt
+		}
+		if n.CreatedAt.After(last) {
+			last = n.CreatedAt
+		}
+	}
+	trend := []MoodPoint{}
+	if first.IsZero() {
+		return trend
+	}
+	if granularity == "" {
+		granularity = MoodGranularity(first, last)
+	}
+	index := map[string]int{}
+	end := models.ActivityBucketStart(last.In(loc), granularity)
+	for b := models.ActivityBucketStart(first.In(loc), granularity); !b.After(end); b = nextMoodBucket(b, granularity) {
+		index[b.Format("2006-01-02")] = len(trend)
+		trend = append(trend, MoodPoint{Bucket: b.Format("2006-01-02")})
+	}
+	sums := make([]float64, len(trend))
+	for _, n := range notes {
+		if n.CreatedAt.IsZero() {
+			continue
+		}
+		i := index[models.ActivityBucketStart(n.CreatedAt.In(loc), granularity).Format("2006-01-02")]
+		score := ScoreSentiment(n.Text)
+		p := &trend[i]
+		p.Notes++
+		sums[i] += score.Score
+		switch score.Label {
+		case SentimentPositive:
+			p.Positive++
+		case SentimentNegative:
+			p.Negative++
+		default:
+			p.Neutral++
+		}
+	}
+	for i := range trend {
+		if trend[i].Notes > 0 {
+			trend[i].Score = roundScore(sums[i] / float64(trend[i].Notes))
+		}
+	}
+	return trend
+}
+
+func nextMoodBucket(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case models.ActivityWeek:
+		return t.AddDate(0, 0, 7)
+	case models.ActivityMonth:
+		return t.AddDate(0, 1, 0)
+	default:
+		return t.AddDate(0, 0, 1)
+	}
+}
+
+// ========== 行动 ==========
+
+// ActionSummary 行动统计：Markdown 复选框任务，以及提到计划/完成的笔记
+type ActionSummary struct {
+	OpenTasks   int   `json:"open_tasks"`
+	DoneTasks   int   `json:"done_tasks"`
+	TodoNotes   int   `json:"todo_notes"`
+	DoneNotes   int   `json:"done_notes"`
+	TodoNoteIDs []int `json:"todo_note_ids,omitempty"`
+	DoneNoteIDs []int `json:"done_note_ids,omitempty"`
+}
+
+// CompletionRate 完成率（百分比）：有复选框任务时按任务计算，否则按提到完成与计划的笔记数估算
+func (a ActionSummary) CompletionRate() (int, bool) {
+	if total := a.OpenTasks + a.DoneTasks; total > 0 {
+		return a.DoneTasks * 100 / total, true
+	}
+	if a.TodoNotes > 0 {
+		return min(100, a.DoneNotes*100/a.TodoNotes), true
+	}
+	return 0, false
+}
+
+// AnalyzeActions 统计任务与行动相关的笔记
+func AnalyzeActions(notes []AnalysisNote) ActionSummary {
+	todo, done := map[string]bool{}, map[string]bool{}
+	for _, w := range actionTodoWords {
+		todo[w] = true
+	}
+	for _, w := range actionDoneWords {
+		done[w] = true
+	}
+	var a ActionSummary
+	for _, n := range notes {
+		var hasTodo, hasDone bool
+		for _, t := range utils.ParseTasks(n.Text) {
+			if t.Done {
+				a.DoneTasks++
+				hasDone = true
+			} else {
+				a.OpenTasks++
+				hasTodo = true
+			}
+		}
+		for _, tok := range tokenize(n.Text) {
+			hasTodo = hasTodo || todo[tok.Text]
+			hasDone = hasDone || done[tok.Text]
+		}
+		if hasTodo {
+			a.TodoNotes++
+			if n.ID > 0 {
+				a.TodoNoteIDs = append(a.TodoNoteIDs, n.ID)
+			}
+		}
+		if hasDone {
+			a.DoneNotes++
+			if n.ID > 0 {
+				a.DoneNoteIDs = append(a.DoneNoteIDs, n.ID)
+			}
+		}
+	}
+	return a
+}
@@ -0,0 +1,106 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+func TestScoreSentiment(t *testing.T) {
+	cases := []struct {
+		text  string
+		label string
+	}{
+		{"今天项目上线很顺利，非常开心", services.SentimentPositive},
+		{"最近压力好大，有点焦虑，晚上失眠", services.SentimentNegative},
+		{"今天不开心", services.SentimentNegative},
+		{"这家店还不错", services.SentimentPositive},
+		{"周末一点也不开心", services.SentimentNegative},
+		{"I really love this book, it's wonderful", services.SentimentPositive},
+		{"I'm not happy with the result. Terrible day.", services.SentimentNegative},
+		{"Meeting at 3pm in room 201", services.SentimentNeutral},
+		{"读书笔记", services.SentimentNeutral},
+	}
+	for _, c := range cases {
+		if got := services.ScoreSentiment(c.text); got.Label != c.label {
+			t.Errorf("%q: label=%s score=%v want %s", c.text, got.Label, got.Score, c.label)
+		}
+	}
+
+	// 程度副词放大，否定词反转
+	plain, strong := services.ScoreSentiment("开心"), services.ScoreSentiment("非常开心")
+	if strong.Score <= plain.Score {
+		t.Fatalf("intensifier: %v <= %v", strong.Score, plain.Score)
+	}
+	negated := services.ScoreSentiment("not happy")
+	if negated.Score >= 0 || len(negated.NegativeWords) != 1 || negated.NegativeWords[0] != "not happy" {
+		t.Fatalf("negation: %+v", negated)
+	}
+}
+
+func TestExtractKeywordsAgainstCorpus(t *testing.T) {
+	corpus := services.NewCorpus(
+		"今天天气不错", "今天读书", "今天去跑步", "今天项目会议", "项目会议讨论排期",
+	)
+	notes := []services.AnalysisNote{
+		{ID: 1, Text: "今天项目会议"},
+		{ID: 2, Text: "项目会议讨论排期"},
+		{ID: 3, Text: "今天去跑步"},
+	}
+	keywords := services.ExtractKeywords(notes, corpus, 5)
+	if len(keywords) == 0 || keywords[0].Term != "项目会议" || keywords[0].Count != 2 || len(keywords[0].NoteIDs) != 2 {
+		t.Fatalf("keywords=%+v", keywords)
+	}
+	for _, k := range keywords {
+		// 停用词不作为关键词；与“项目会议”互相包含的词组被去重
+		if k.Term == "今天" || k.Term == "项目" || k.Term == "会议" || k.Term == "目会" {
+			t.Fatalf("unexpected keyword %q in %+v", k.Term, keywords)
+		}
+	}
+
+	en := services.ExtractKeywords([]services.AnalysisNote{{Text: "The garden and the garden roses"}}, nil, 3)
+	if len(en) == 0 || en[0].Term != "garden" || en[0].Count != 2 {
+		t.Fatalf("english keywords=%+v", en)
+	}
+}
+
+func TestMoodTrendAndActions(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2026, 3, d, 12, 0, 0, 0, time.UTC) }
+	notes := []services.AnalysisNote{
+		{ID: 1, Text: "很焦虑", CreatedAt: day(1)},
+		{ID: 2, Text: "非常开心", CreatedAt: day(3)},
+		{ID: 3, Text: "- [ ] 买菜\n- [x] 写周报", CreatedAt: day(3)},
+	}
+	trend := services.MoodTrend(notes, "", time.UTC)
+	if len(trend) != 3 || trend[0].Negative != 1 || trend[1].Notes != 0 || trend[2].Notes != 2 || trend[2].Positive != 1 {
+		t.Fatalf("trend=%+v", trend)
+	}
+	if weekly := services.MoodTrend(notes, "week", time.UTC); len(weekly) != 2 || weekly[0].Bucket != "2026-02-23" {
+		t.Fatalf("weekly=%+v", weekly)
+	}
+
+	a := services.AnalyzeActions(append(notes, services.AnalysisNote{ID: 4, Text: "明天要完成报告"}))
+	if a.OpenTasks != 1 || a.DoneTasks != 1 || a.TodoNotes != 2 || a.DoneNotes != 2 {
+		t.Fatalf("actions=%+v", a)
+	}
+	if rate, ok := a.CompletionRate(); !ok || rate != 50 {
+		t.Fatalf("rate=%d ok=%v", rate, ok)
+	}
+}
+
+func TestCompareSnapshots(t *testing.T) {
+	before := services.SnapshotNotes([]services.AnalysisNote{{Text: "加班很累，项目延期"}, {Text: "项目延期，压力大"}}, nil)
+	after := services.SnapshotNotes([]services.AnalysisNote{{Text: "项目顺利上线，很开心"}}, nil)
+	diff := services.CompareSnapshots(before, after)
+	if diff.Notes.Delta != -1 || diff.Sentiment.Direction != services.SentimentImproved || diff.Sentiment.Negative.Delta != -2 {
+		t.Fatalf("diff=%+v", diff)
+	}
+	trends := map[string]string{}
+	for _, k := range diff.Keywords {
+		trends[k.Term] = k.Trend
+	}
+	if trends["项目延期"] != services.KeywordGone || trends["上线"] != services.KeywordNew || diff.Keywords[0].Term != "项目延期" {
+		t.Fatalf("keywords=%+v", diff.Keywords)
+	}
+}
@@ -0,0 +1,366 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"memo-studio/backend/models"
+)
+
+// DefaultDigestInterval 调度器检查到期回顾的间隔
+const DefaultDigestInterval = 10 * time.Minute
+
+// digestTopTags 回顾中列出的常用标签数
+const digestTopTags = 5
+
+// digestWebhookTimeout 推送回顾的超时时间
+const digestWebhookTimeout = 10 * time.Second
+
+// DigestSentiment 回顾时段内的情绪统计（按笔记计数）
+type DigestSentiment struct {
+	Positive int     `json:"positive"`
+	Negative int     `json:"negative"`
+	Average  float64 `json:"average"` // 平均情感得分（-1 ~ 1）
+	Label    string  `json:"label"`
+}
+
+// DigestData 回顾的统计结果（存入 digests.data）
+type DigestData struct {
+	models.DigestNoteStats
+	Topics    []models.TagCount `json:"topics"` // 主题关键词命中次数
+	Sentiment DigestSentiment   `json:"sentiment"`
+	Insight   *InsightResponse  `json:"insight,omitempty"` // 开启 AI 且模型可用时
+	NoteIDs   []int             `json:"note_ids"`
+}
+
+// DigestLocation 用户回顾使用的时区；空或无效时用服务器时区
+func DigestLocation(tz string) *time.Location {
+	if tz = strings.TrimSpace(tz); tz != "" {
+		if loc, err := time.LoadLocation(tz); err == nil {
+			return loc
+		}
+	}
+	return time.Local
+}
+
+// DigestPeriodBounds 最近一个已到生成时间的周期：时段 [start, end) 与生成时间 due。
+// 周报覆盖生成日之前的 7 天；月报覆盖上一个自然月。
+func DigestPeriodBounds(period string, st models.UserSettings, now time.Time) (start, end, due time.Time) {
+	loc := DigestLocation(st.DigestZone())
+	n := now.In(loc)
+	// 生成时间按当地钟点构造，夏令时切换当天也是 DigestHour 点
+	if period == models.DigestMonthly {
+		end = time.Date(n.Year(), n.Month(), 1, 0, 0, 0, 0, loc)
+		due = time.Date(n.Year(), n.Month(), st.DigestMonthDay, st.DigestHour, 0, 0, 0, loc)
+		if n.Before(due) {
+			end, due = end.AddDate(0, -1, 0), due.AddDate(0, -1, 0)
+		}
+		return end.AddDate(0, -1, 0), end, due
+	}
+	today := time.Date(n.Year(), n.Month(), n.Day(), 0, 0, 0, 0, loc)
+	end = today.AddDate(0, 0, -((int(n.Weekday()) - st.DigestWeekday + 7) % 7))
+	due = time.Date(end.Year(), end.Month(), end.Day(), st.DigestHour, 0, 0, 0, loc)
+	if n.Before(due) {
+		end, due = end.AddDate(0, 0, -7), due.AddDate(0, 0, -7)
+	}
+	return end.AddDate(0, 0, -7), end, due
+}
+
+// countSentiment 按词典情感评分统计积极/消极的笔记数
+func countSentiment(notes []models.Note) DigestSentiment {
+	summary := AnalyzeSentiment(NotesForAnalysis(notes))
+	return DigestSentiment{
+		Positive: summary.Positive,
+		Negative: summary.Negative,
+		Average:  summary.Average,
+		Label:    summary.Label(),
+	}
+}
+
+// countTopics 主题关键词命中次数，按次数倒序
+func countTopics(notes []models.Note) []models.TagCount {
+	topics := []models.TagCount{}
+	for topic, keywords := range TopicKeywords {
+		count := 0
+		for _, n := range notes {
+			for _, kw := range keywords {
+				count += strings.Count(n.Title+"\n"+n.Content, kw)
+			}
+		}
+		if count > 0 {
+			topics = append(topics, models.TagCount{Name: TopicName(topic), Count: count})
+		}
+	}
+	sort.Slice(topics, func(i, j int) bool {
+		if topics[i].Count != topics[j].Count {
+			return topics[i].Count > topics[j].Count
+		}
+		return topics[i].Name < topics[j].Name
+	})
+	return topics
+}
+
+func containsAnyWord(text string, words []string) bool {
+	for _, w := range words {
+		if strings.Contains(text, w) {
+			return true
+		}
+	}
+	return false
+}
+
+// digestTitle 如 "周回顾 2026-10-12 ~ 2026-10-18"、"月回顾 2026-09"
+func digestTitle(period string, start, end time.Time) string {
+	if period == models.DigestMonthly {
+		return "月回顾 " + start.Format("2006-01")
+	}
+	return "周回顾 " + start.Format("2006-01-02") + " ~ " + end.AddDate(0, 0, -1).Format("2006-01-02")
+}
+
+// renderDigest 把统计结果渲染为 Markdown
+func renderDigest(title string, data DigestData) string {
+	var b strings.Builder
+	b.WriteString("# " + title + "\n\n")
+	fmt.Fprintf(&b, "- 新建笔记 %d 条，修改 %d 条\n", data.Created, data.Updated)
+	if len(data.TopTags) > 0 {
+		parts := make([]string, 0, len(data.TopTags))
+		for _, t := range data.TopTags {
+			parts = append(parts, fmt.Sprintf("%s(%d)", t.Name, t.Count))
+		}
+		b.WriteString("- 常用标签：" + strings.Join(parts, "、") + "\n")
+	}
+	if len(data.Topics) > 0 {
+		parts := make([]string, 0, len(data.Topics))
+		for _, t := range data.Topics {
+			parts = append(parts, fmt.Sprintf("%s %d 次", t.Name, t.Count))
+		}
+		b.WriteString("- 关注主题：" + strings.Join(parts, "、") + "\n")
+	}
+	fmt.Fprintf(&b, "- 情绪：%s（积极 %d / 消极 %d）\n", data.Sentiment.Label, data.Sentiment.Positive, data.Sentiment.Negative)
+	if in := data.Insight; in != nil {
+		b.WriteString("\n## AI 洞察\n\n")
+		if in.Summary != "" {
+			b.WriteString(in.Summary + "\n\n")
+		}
+		if len(in.Keywords) > 0 {
+			b.WriteString("- 关键词：" + strings.Join(in.Keywords, "、") + "\n")
+		}
+		if len(in.Trends) > 0 {
+			b.WriteString("- 趋势：" + strings.Join(in.Trends, "；") + "\n")
+		}
+		if len(in.Tips) > 0 {
+			b.WriteString("- 建议：" + strings.Join(in.Tips, "；") + "\n")
+		}
+	}
+	return b.String()
+}
+
+// GenerateDigest 生成并保存用户最近一个已到期周期的回顾；
+// 已存在时直接返回（refresh 为 true 时删除后重新生成）。created 表示本次新生成
+func GenerateDigest(userID int, period string, st models.UserSettings, now time.Time, refresh bool) (d *models.Digest, created bool, err error) {
+	start, end, _ := DigestPeriodBounds(period, st, now)
+	existing, err := models.GetDigestByPeriod(userID, period, start)
+	if err != nil {
+		return nil, false, err
+	}
+	if existing != nil {
+		if !refresh {
+			return existing, false, nil
+		}
+		if err := models.DeleteDigest(existing.ID, userID); err != nil {
+			return nil, false, err
+		}
+	}
+
+	stats, err := models.GetDigestNoteStats(userID, start, end, digestTopTags)
+	if err != nil {
+		return nil, false, err
+	}
+	notes, err := models.SelectNotes(models.NoteSelection{UserID: userID, From: &start, To: &end})
+	if err != nil {
+		return nil, false, err
+	}
+	data := DigestData{
+		DigestNoteStats: *stats,
+		Topics:          countTopics(notes),
+		Sentiment:       countSentiment(notes),
+		NoteIDs:         []int{},
+	}
+	for _, n := range notes {
+		data.NoteIDs = append(data.NoteIDs, n.ID)
+	}
+
+	title := digestTitle(period, start, end)
+	provider := "basic"
+	if st.DigestAI && len(notes) > 0 {
+		svc := NewLLMServiceForUser(userID)
+		svc.Endpoint = "digest " + period
+		if svc.Configured() {
+			insight, err := svc.GenerateNoteInsight(notes, title)
+			if err != nil {
+				// AI 失败（含配额用完）时仍生成基础回顾
+				log.Printf("用户 %d 的%s AI 洞察失败: %v", userID, title, err)
+			} else {
+				data.Insight = insight
+				provider = insight.Provider
+			}
+		}
+	}
+
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return nil, false, err
+	}
+	d, err = models.CreateDigest(models.Digest{
+		UserID:      userID,
+		Period:      period,
+		PeriodStart: start,
+		PeriodEnd:   end,
+		Timezone:    DigestLocation(st.DigestZone()).String(),
+		Title:       title,
+		Content:     renderDigest(title, data),
+		Data:        payload,
+		Provider:    provider,
+	})
+	return d, d != nil, err
+}
+
+// DeliverDigest 以 POST JSON 推送回顾，并记录推送结果；详细错误只写日志
+func DeliverDigest(d *models.Digest, webhook string) error {
+	err := postDigest(d, webhook)
+	var stored error
+	if err != nil {
+		log.Printf("推送回顾 %d 失败: %v", d.ID, err)
+		stored = errors.New(webhookErrorMessage(err))
+	}
+	if markErr := models.MarkDigestDelivery(d.ID, stored); markErr != nil {
+		log.Printf("记录回顾 %d 推送结果失败: %v", d.ID, markErr)
+	}
+	return err
+}
+
+func postDigest(d *models.Digest, webhook string) error {
+	body, err := json.Marshal(map[string]any{"event": "digest", "digest": d})
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), digestWebhookTimeout)
+	defer cancel()
+	return PostWebhook(ctx, webhook, body)
+}
+
+// RunDueDigests 为开启回顾的用户生成已到期、尚未生成的回顾（时段内没有笔记活动时跳过），
+// 并推送到用户配置的地址；返回新生成的数量
+func RunDueDigests(now time.Time) int {
+	generated := 0
+	for _, period := range []string{models.DigestWeekly, models.DigestMonthly} {
+		key := models.UserSettingDigestWeekly
+		if period == models.DigestMonthly {
+			key = models.UserSettingDigestMonthly
+		}
+		userIDs, err := models.ListUserIDsWithSetting(key, "true")
+		if err != nil {
+			log.Printf("读取回顾订阅失败: %v", err)
+			continue
+		}
+		for _, userID := range userIDs {
+			st, err := models.GetUserSettings(userID)
+			if err != nil {
+				log.Printf("读取用户 %d 设置失败: %v", userID, err)
+				continue
+			}
+			start, end, _ := DigestPeriodBounds(period, st, now)
+			if existing, err := models.GetDigestByPeriod(userID, period, start); err != nil || existing != nil {
+				continue
+			}
+			stats, err := models.GetDigestNoteStats(userID, start, end, 0)
+			if err != nil || stats.Created+stats.Updated == 0 {
+				continue
+			}
+			// 角色已没有 ai 权限时只生成基础回顾
+			if auth, err := models.GetAuthState(userID); err != nil || auth == nil || !models.RoleHasPermission(auth.Role, models.PermAI) {
+				st.DigestAI = false
+			}
+			d, created, err := GenerateDigest(userID, period, st, now, false)
+			if err != nil {
+				log.Printf("生成用户 %d 的回顾失败: %v", userID, err)
+				continue
+			}
+			if !created {
+				continue
+			}
+			generated++
+			if st.DigestWebhook != "" {
+				if err := DeliverDigest(d, st.DigestWebhook); err != nil {
+					log.Printf("推送回顾 %d 失败: %v", d.ID, err)
+				}
+			}
+		}
+	}
+	return generated
+}
+
+var (
+	digestClockMu sync.RWMutex
+	digestClock   = time.Now
+)
+
+// DigestNow 按需生成回顾时使用的当前时间
+func DigestNow() time.Time {
+	digestClockMu.RLock()
+	defer digestClockMu.RUnlock()
+	return digestClock()
+}
+
+// SetDigestClock 替换当前时间来源（测试中固定时间，避免跨越周期边界）
+func SetDigestClock(now func() time.Time) {
+	digestClockMu.Lock()
+	defer digestClockMu.Unlock()
+	digestClock = now
+}
+
+// DigestInterval 调度间隔：MEMO_DIGEST_INTERVAL（如 "10m"）；0 表示关闭定期回顾
+func DigestInterval() time.Duration {
+	v := strings.TrimSpace(os.Getenv("MEMO_DIGEST_INTERVAL"))
+	if v == "" {
+		return DefaultDigestInterval
+	}
+	if v == "0" {
+		return 0
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return DefaultDigestInterval
+	}
+	return d
+}
+
+var digestSchedulerOnce sync.Once
+
+// StartDigestScheduler 启动定期回顾调度（只启动一次）
+func StartDigestScheduler() {
+	interval := DigestInterval()
+	if interval <= 0 {
+		log.Printf("定期回顾已关闭（MEMO_DIGEST_INTERVAL=0）")
+		return
+	}
+	digestSchedulerOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for now := range ticker.C {
+				if n := RunDueDigests(now); n > 0 {
+					log.Printf("已生成 %d 份定期回顾", n)
+				}
+			}
+		}()
+	})
+}
@@ -0,0 +1,67 @@
+package services_test
+
+import (
+	"testing"
+	"time"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/services"
+)
+
+func TestDigestPeriodBounds(t *testing.T) {
+	shanghai, _ := time.LoadLocation("Asia/Shanghai")
+	st := models.UserSettings{DigestTimezone: "Asia/Shanghai", DigestHour: 8, DigestWeekday: 1, DigestMonthDay: 3}
+	const layout = "2006-01-02 15:04"
+
+	cases := []struct {
+		name, period, now, start, end string
+	}{
+		// 周一 8 点之后：覆盖上周一到周日
+		{"weekly due", models.DigestWeekly, "2026-10-19 09:00", "2026-10-12 00:00", "2026-10-19 00:00"},
+		// 周一 8 点之前：仍是再上一周
+		{"weekly before hour", models.DigestWeekly, "2026-10-19 07:59", "2026-10-05 00:00", "2026-10-12 00:00"},
+		{"weekly midweek", models.DigestWeekly, "2026-10-22 12:00", "2026-10-12 00:00", "2026-10-19 00:00"},
+		// 月报在 3 号 8 点后覆盖上个自然月
+		{"monthly due", models.DigestMonthly, "2026-10-03 08:00", "2026-09-01 00:00", "2026-10-01 00:00"},
+		{"monthly before day", models.DigestMonthly, "2026-10-02 23:00", "2026-08-01 00:00", "2026-09-01 00:00"},
+		{"monthly january", models.DigestMonthly, "2026-01-15 00:00", "2025-12-01 00:00", "2026-01-01 00:00"},
+	}
+	for _, tc := range cases {
+		now, _ := time.ParseInLocation(layout, tc.now, shanghai)
+		start, end, _ := services.DigestPeriodBounds(tc.period, st, now.UTC())
+		if got := start.In(shanghai).Format(layout); got != tc.start {
+			t.Errorf("%s: start=%s want %s", tc.name, got, tc.start)
+		}
+		if got := end.In(shanghai).Format(layout); got != tc.end {
+			t.Errorf("%s: end=%s want %s", tc.name, got, tc.end)
+		}
+	}
+}
+
+func TestDigestPeriodBoundsDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip("时区数据不可用")
+	}
+	const layout = "2006-01-02 15:04"
+	// 2026-03-08（周日）凌晨 2 点切换夏令时，生成时间仍是当地 8 点
+	st := models.UserSettings{DigestTimezone: "America/New_York", DigestHour: 8, DigestWeekday: 0, DigestMonthDay: 8}
+	now := time.Date(2026, 3, 8, 8, 30, 0, 0, ny)
+	_, end, due := services.DigestPeriodBounds(models.DigestWeekly, st, now.UTC())
+	if got := due.In(ny).Format(layout); got != "2026-03-08 08:00" {
+		t.Fatalf("weekly due=%s", got)
+	}
+	if got := end.In(ny).Format(layout); got != "2026-03-08 00:00" {
+		t.Fatalf("weekly end=%s", got)
+	}
+	_, _, due = services.DigestPeriodBounds(models.DigestMonthly, st, now.UTC())
+	if got := due.In(ny).Format(layout); got != "2026-03-08 08:00" {
+		t.Fatalf("monthly due=%s", got)
+	}
+	// 11 月切回标准时间当天同样如此
+	st.DigestMonthDay = 1
+	_, _, due = services.DigestPeriodBounds(models.DigestMonthly, st, time.Date(2026, 11, 1, 8, 0, 0, 0, ny))
+	if got := due.In(ny).Format(layout); got != "2026-11-01 08:00" {
+		t.Fatalf("monthly fall-back due=%s", got)
+	}
+}
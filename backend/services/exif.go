@@ -0,0 +1,364 @@
+package services
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"time"
+)
+
+// PhotoEXIF 照片 EXIF 中与笔记相关的信息（坐标为 WGS-84）
+type PhotoEXIF struct {
+	Latitude    *float64   `json:"latitude,omitempty"`
+	Longitude   *float64   `json:"longitude,omitempty"`
+	Altitude    *float64   `json:"altitude,omitempty"` // 米，海平面以下为负
+	TakenAt     *time.Time `json:"taken_at,omitempty"`
+	Orientation int        `json:"orientation,omitempty"` // 1–8，见 EXIF Orientation
+	Make        string     `json:"make,omitempty"`
+	Model       string     `json:"model,omitempty"`
+}
+
+// HasGPS 是否带有效坐标（0,0 视为相机未定位）
+func (e *PhotoEXIF) HasGPS() bool {
+	return e != nil && e.Latitude != nil && e.Longitude != nil && !(*e.Latitude == 0 && *e.Longitude == 0)
+}
+
+// Camera 相机型号；型号里已带厂商名时不重复
+func (e *PhotoEXIF) Camera() string {
+	if e.Make == "" || strings.HasPrefix(strings.ToLower(e.Model), strings.ToLower(e.Make)) {
+		return e.Model
+	}
+	return strings.TrimSpace(e.Make + " " + e.Model)
+}
+
+func (e *PhotoEXIF) empty() bool {
+	return e.Latitude == nil && e.Longitude == nil && e.Altitude == nil && e.TakenAt == nil &&
+		e.Orientation == 0 && e.Make == "" && e.Model == ""
+}
+
+// MaxEXIFScanBytes 读取图片时最多读取的字节数（HEIC 的 Exif 数据块可能在文件靠后的位置）
+const MaxEXIFScanBytes = 32 << 20
+
+// ErrNoEXIF 文件中没有 EXIF 数据
+var ErrNoEXIF = errors.New("没有 EXIF 数据")
+
+// ReadPhotoEXIF 读取图片文件的 EXIF；没有 EXIF 时返回 nil, nil
+func ReadPhotoEXIF(path string) (*PhotoEXIF, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, MaxEXIFScanBytes))
+	if err != nil {
+		return nil, err
+	}
+	info, err := ParsePhotoEXIF(data)
+	if err == ErrNoEXIF {
+		return nil, nil
+	}
+	return info, err
+}
+
+// ParsePhotoEXIF 解析 JPEG、HEIC/HEIF（及其他 ISO BMFF 容器）与 TIFF 中的 EXIF
+func ParsePhotoEXIF(data []byte) (*PhotoEXIF, error) {
+	tiff := findTIFFHeader(data)
+	if tiff == nil {
+		return nil, ErrNoEXIF
+	}
+	info, err := parseTIFF(tiff)
+	if err != nil {
+		return nil, err
+	}
+	if info.empty() {
+		return nil, ErrNoEXIF
+	}
+	return info, nil
+}
+
+var exifMarker = []byte("Exif\x00\x00")
+
+func isTIFFHeader(b []byte) bool {
+	return len(b) >= 8 && (bytes.HasPrefix(b, []byte("II*\x00")) || bytes.HasPrefix(b, []byte("MM\x00*")))
+}
+
+// findTIFFHeader 定位 EXIF 的 TIFF 结构
+func findTIFFHeader(data []byte) []byte {
+	switch {
+	case isTIFFHeader(data):
+		return data
+	case len(data) > 4 && data[0] == 0xFF && data[1] == 0xD8:
+		return jpegEXIF(data)
+	case len(data) > 12 && string(data[4:8]) == "ftyp":
+		// HEIC 的 Exif 数据块为 4 字节偏移 + "Exif\0\0" + TIFF，这里直接查找标记，不解析 iloc
+		for rest := data; ; {
+			i := bytes.Index(rest, exifMarker)
+			if i < 0 {
+				return nil
+			}
+			if t := rest[i+len(exifMarker):]; isTIFFHeader(t) {
+				return t
+			}
+			rest = rest[i+1:]
+		}
+	}
+	return nil
+}
+
+// jpegEXIF 遍历 JPEG 段，取 APP1 中的 EXIF
+func jpegEXIF(data []byte) []byte {
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return nil
+		}
+		marker := data[i+1]
+		if marker == 0xFF { // 填充字节
+			i++
+			continue
+		}
+		if marker == 0xD9 || marker == 0xDA { // EOI / SOS 之后是图像数据
+			return nil
+		}
+		if marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 { // 无长度字段
+			i += 2
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + n
+		if n < 2 || end > len(data) {
+			return nil
+		}
+		if seg := data[i+4 : end]; marker == 0xE1 && bytes.HasPrefix(seg, exifMarker) && isTIFFHeader(seg[len(exifMarker):]) {
+			return seg[len(exifMarker):]
+		}
+		i = end
+	}
+	return nil
+}
+
+// EXIF 标签
+const (
+	tagMake             = 0x010F
+	tagModel            = 0x0110
+	tagOrientation      = 0x0112
+	tagDateTime         = 0x0132
+	tagExifIFD          = 0x8769
+	tagGPSIFD           = 0x8825
+	tagDateTimeOriginal = 0x9003
+	tagOffsetTimeOrig   = 0x9011
+	tagGPSLatitudeRef   = 0x01
+	tagGPSLatitude      = 0x02
+	tagGPSLongitudeRef  = 0x03
+	tagGPSLongitude     = 0x04
+	tagGPSAltitudeRef   = 0x05
+	tagGPSAltitude      = 0x06
+	tagGPSTimeStamp     = 0x07
+	tagGPSDateStamp     = 0x1D
+	maxIFDEntries       = 1024
+	exifTypeASCII       = 2
+	exifTypeShort       = 3
+	exifTypeLong        = 4
+	exifTypeRational    = 5
+	exifTypeSRational   = 10
+)
+
+// exifTypeSizes 各数据类型的单个值字节数
+var exifTypeSizes = map[uint16]int{1: 1, 2: 1, 3: 2, 4: 4, 5: 8, 6: 1, 7: 1, 8: 2, 9: 4, 10: 8, 11: 4, 12: 8}
+
+type tiffReader struct {
+	data  []byte
+	order binary.ByteOrder
+}
+
+type ifdEntry struct {
+	typ   uint16
+	count int
+	value []byte
+}
+
+// ifd 读取 offset 处的目录项
+func (t *tiffReader) ifd(offset uint32) (map[uint16]ifdEntry, error) {
+	if uint64(offset)+2 > uint64(len(t.data)) {
+		return nil, fmt.Errorf("EXIF 目录偏移越界: %d", offset)
+	}
+	n := int(t.order.Uint16(t.data[offset:]))
+	if n > maxIFDEntries {
+		return nil, fmt.Errorf("EXIF 目录项过多: %d", n)
+	}
+	entries := make(map[uint16]ifdEntry, n)
+	for i := 0; i < n; i++ {
+		p := int(offset) + 2 + i*12
+		if p+12 > len(t.data) {
+			return nil, errors.New("EXIF 目录被截断")
+		}
+		e := t.data[p : p+12]
+		typ := t.order.Uint16(e[2:])
+		count := t.order.Uint32(e[4:])
+		size, ok := exifTypeSizes[typ]
+		if !ok || uint64(count)*uint64(size) > uint64(len(t.data)) {
+			continue
+		}
+		total := int(count) * size
+		value := e[8:12]
+		if total > 4 {
+			off := t.order.Uint32(e[8:])
+			if uint64(off)+uint64(total) > uint64(len(t.data)) {
+				continue
+			}
+			value = t.data[off : int(off)+total]
+		}
+		entries[t.order.Uint16(e[0:])] = ifdEntry{typ: typ, count: int(count), value: value[:min(total, len(value))]}
+	}
+	return entries, nil
+}
+
+func (t *tiffReader) ascii(e ifdEntry, ok bool) string {
+	if !ok || e.typ != exifTypeASCII {
+		return ""
+	}
+	s, _, _ := strings.Cut(string(e.value), "\x00")
+	return strings.TrimSpace(s)
+}
+
+func (t *tiffReader) uint(e ifdEntry, ok bool) (uint32, bool) {
+	if !ok || e.count < 1 {
+		return 0, false
+	}
+	switch e.typ {
+	case exifTypeShort:
+		return uint32(t.order.Uint16(e.value)), true
+	case exifTypeLong:
+		return t.order.Uint32(e.value), true
+	case 1, 7:
+		return uint32(e.value[0]), true
+	}
+	return 0, false
+}
+
+// rationals 读取（有符号）分数数组
+func (t *tiffReader) rationals(e ifdEntry, ok bool) []float64 {
+	if !ok || (e.typ != exifTypeRational && e.typ != exifTypeSRational) {
+		return nil
+	}
+	out := make([]float64, 0, e.count)
+	for i := 0; i < e.count; i++ {
+		num, den := t.order.Uint32(e.value[i*8:]), t.order.Uint32(e.value[i*8+4:])
+		if den == 0 {
+			return nil
+		}
+		if e.typ == exifTypeSRational {
+			out = append(out, float64(int32(num))/float64(int32(den)))
+		} else {
+			out = append(out, float64(num)/float64(den))
+		}
+	}
+	return out
+}
+
+func parseTIFF(data []byte) (*PhotoEXIF, error) {
+	t := &tiffReader{data: data, order: binary.LittleEndian}
+	if data[0] == 'M' {
+		t.order = binary.BigEndian
+	}
+	ifd0, err := t.ifd(t.order.Uint32(data[4:]))
+	if err != nil {
+		return nil, err
+	}
+
+	info := &PhotoEXIF{}
+	info.Make = t.ascii(lookupEntry(ifd0, tagMake))
+	info.Model = t.ascii(lookupEntry(ifd0, tagModel))
+	if v, ok := t.uint(lookupEntry(ifd0, tagOrientation)); ok && v >= 1 && v <= 8 {
+		info.Orientation = int(v)
+	}
+
+	taken := t.ascii(lookupEntry(ifd0, tagDateTime))
+	var offset string
+	if p, ok := t.uint(lookupEntry(ifd0, tagExifIFD)); ok {
+		if sub, err := t.ifd(p); err == nil {
+			if s := t.ascii(lookupEntry(sub, tagDateTimeOriginal)); s != "" {
+				taken = s
+			}
+			offset = t.ascii(lookupEntry(sub, tagOffsetTimeOrig))
+		}
+	}
+
+	var gpsTime *time.Time
+	if p, ok := t.uint(lookupEntry(ifd0, tagGPSIFD)); ok {
+		if gps, err := t.ifd(p); err == nil {
+			lat := dmsToDegrees(t.rationals(lookupEntry(gps, tagGPSLatitude)), t.ascii(lookupEntry(gps, tagGPSLatitudeRef)), "S")
+			lng := dmsToDegrees(t.rationals(lookupEntry(gps, tagGPSLongitude)), t.ascii(lookupEntry(gps, tagGPSLongitudeRef)), "W")
+			if lat != nil && lng != nil && math.Abs(*lat) <= 90 && math.Abs(*lng) <= 180 {
+				info.Latitude, info.Longitude = lat, lng
+			}
+			if alt := t.rationals(lookupEntry(gps, tagGPSAltitude)); len(alt) == 1 {
+				a := alt[0]
+				if ref, ok := t.uint(lookupEntry(gps, tagGPSAltitudeRef)); ok && ref == 1 {
+					a = -a
+				}
+				info.Altitude = &a
+			}
+			gpsTime = gpsTimestamp(t.ascii(lookupEntry(gps, tagGPSDateStamp)), t.rationals(lookupEntry(gps, tagGPSTimeStamp)))
+		}
+	}
+	info.TakenAt = exifTakenAt(taken, offset, gpsTime)
+	return info, nil
+}
+
+func lookupEntry(m map[uint16]ifdEntry, tag uint16) (ifdEntry, bool) {
+	e, ok := m[tag]
+	return e, ok
+}
+
+// dmsToDegrees 度、分、秒 → 十进制度；ref 为 negRef（S/W）时取负
+func dmsToDegrees(dms []float64, ref, negRef string) *float64 {
+	if len(dms) == 0 || len(dms) > 3 {
+		return nil
+	}
+	v := 0.0
+	for i, div := range []float64{1, 60, 3600}[:len(dms)] {
+		v += dms[i] / div
+	}
+	if strings.EqualFold(ref, negRef) {
+		v = -v
+	}
+	v = math.Round(v*1e7) / 1e7
+	return &v
+}
+
+// gpsTimestamp GPS 日期（YYYY:MM:DD）与时间（时、分、秒），均为 UTC
+func gpsTimestamp(date string, hms []float64) *time.Time {
+	if date == "" || len(hms) != 3 {
+		return nil
+	}
+	d, err := time.Parse("2006:01:02", date)
+	if err != nil {
+		return nil
+	}
+	ts := d.Add(time.Duration(hms[0]*float64(time.Hour) + hms[1]*float64(time.Minute) + hms[2]*float64(time.Second)))
+	return &ts
+}
+
+// exifTakenAt 拍摄时间：EXIF 时间是拍摄地的本地时间，有 OffsetTimeOriginal 时按其换算；
+// 没有时区时优先用 GPS 的 UTC 时间，都没有时按 UTC 记录本地时间
+func exifTakenAt(local, offset string, gpsTime *time.Time) *time.Time {
+	if local != "" {
+		if offset != "" {
+			if ts, err := time.Parse("2006:01:02 15:04:05-07:00", local+offset); err == nil {
+				return &ts
+			}
+		}
+		if gpsTime != nil {
+			return gpsTime
+		}
+		if ts, err := time.Parse("2006:01:02 15:04:05", local); err == nil {
+			return &ts
+		}
+	}
+	return gpsTime
+}
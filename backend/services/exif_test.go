@@ -0,0 +1,272 @@
+package services_test
+
+import (
+	"context"
+	"encoding/binary"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+type byteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// exifTag 测试用 EXIF 目录项；ptr > 0 时为指向第 ptr 个目录的 LONG
+type exifTag struct {
+	id, typ uint16
+	count   uint32
+	data    []byte
+	ptr     int
+}
+
+func asciiTag(id uint16, s string) exifTag {
+	return exifTag{id: id, typ: 2, count: uint32(len(s) + 1), data: append([]byte(s), 0)}
+}
+
+func rationalTag(order byteOrder, id uint16, vals ...[2]uint32) exifTag {
+	b := make([]byte, 0, 8*len(vals))
+	for _, v := range vals {
+		b = order.AppendUint32(b, v[0])
+		b = order.AppendUint32(b, v[1])
+	}
+	return exifTag{id: id, typ: 5, count: uint32(len(vals)), data: b}
+}
+
+func shortTag(order byteOrder, id, v uint16) exifTag {
+	return exifTag{id: id, typ: 3, count: 1, data: order.AppendUint16(nil, v)}
+}
+
+// buildTIFF 依次写入各目录，超过 4 字节的值放在末尾的数据区
+func buildTIFF(order byteOrder, ifds ...[]exifTag) []byte {
+	offsets := make([]int, len(ifds))
+	pos := 8
+	for i, tags := range ifds {
+		offsets[i] = pos
+		pos += 2 + 12*len(tags) + 4
+	}
+	out := []byte("II*\x00")
+	if order == binary.BigEndian {
+		out = []byte("MM\x00*")
+	}
+	out = order.AppendUint32(out, 8)
+	var data []byte
+	for _, tags := range ifds {
+		out = order.AppendUint16(out, uint16(len(tags)))
+		for _, tag := range tags {
+			out = order.AppendUint16(out, tag.id)
+			if tag.ptr > 0 {
+				out = order.AppendUint16(out, 4)
+				out = order.AppendUint32(out, 1)
+				out = order.AppendUint32(out, uint32(offsets[tag.ptr]))
+				continue
+			}
+			out = order.AppendUint16(out, tag.typ)
+			out = order.AppendUint32(out, tag.count)
+			if len(tag.data) <= 4 {
+				out = append(out, append(tag.data, make([]byte, 4-len(tag.data))...)...)
+			} else {
+				out = order.AppendUint32(out, uint32(pos+len(data)))
+				data = append(data, tag.data...)
+			}
+		}
+		out = order.AppendUint32(out, 0)
+	}
+	return append(out, data...)
+}
+
+// sampleTIFF 北京天安门附近拍摄的照片：39°54'15.12"N 116°24'26.64"E，海拔 43.5 米
+func sampleTIFF(order byteOrder) []byte {
+	return buildTIFF(order,
+		[]exifTag{
+			asciiTag(0x010F, "Apple"),
+			asciiTag(0x0110, "iPhone 15 Pro"),
+			shortTag(order, 0x0112, 6),
+			{id: 0x8769, ptr: 1},
+			{id: 0x8825, ptr: 2},
+		},
+		[]exifTag{
+			asciiTag(0x9003, "2024:05:01 08:30:00"),
+			asciiTag(0x9011, "+08:00"),
+		},
+		[]exifTag{
+			asciiTag(0x01, "N"),
+			rationalTag(order, 0x02, [2]uint32{39, 1}, [2]uint32{54, 1}, [2]uint32{1512, 100}),
+			asciiTag(0x03, "E"),
+			rationalTag(order, 0x04, [2]uint32{116, 1}, [2]uint32{24, 1}, [2]uint32{2664, 100}),
+			{id: 0x05, typ: 1, count: 1, data: []byte{0}},
+			rationalTag(order, 0x06, [2]uint32{87, 2}),
+		},
+	)
+}
+
+// jpegWithEXIF 最小 JPEG：SOI、APP0、APP1(EXIF)、SOS、EOI
+func jpegWithEXIF(tiff []byte) []byte {
+	out := []byte{0xFF, 0xD8, 0xFF, 0xE0, 0x00, 0x10}
+	out = append(out, []byte("JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00")...)
+	app1 := append([]byte("Exif\x00\x00"), tiff...)
+	out = append(out, 0xFF, 0xE1)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(app1)+2))
+	out = append(out, app1...)
+	return append(out, 0xFF, 0xDA, 0x00, 0x02, 0x00, 0xFF, 0xD9)
+}
+
+func assertSamplePhoto(t *testing.T, info *services.PhotoEXIF) {
+	t.Helper()
+	if !info.HasGPS() || math.Abs(*info.Latitude-39.9042) > 1e-6 || math.Abs(*info.Longitude-116.4074) > 1e-6 {
+		t.Fatalf("gps = %v,%v", info.Latitude, info.Longitude)
+	}
+	if info.Altitude == nil || *info.Altitude != 43.5 {
+		t.Fatalf("altitude = %v", info.Altitude)
+	}
+	if info.Orientation != 6 || info.Camera() != "Apple iPhone 15 Pro" {
+		t.Fatalf("orientation=%d camera=%q", info.Orientation, info.Camera())
+	}
+	want := time.Date(2024, 5, 1, 0, 30, 0, 0, time.UTC)
+	if info.TakenAt == nil || !info.TakenAt.Equal(want) {
+		t.Fatalf("taken_at = %v, want %v", info.TakenAt, want)
+	}
+}
+
+func TestParsePhotoEXIF(t *testing.T) {
+	for _, order := range []byteOrder{binary.LittleEndian, binary.BigEndian} {
+		info, err := services.ParsePhotoEXIF(jpegWithEXIF(sampleTIFF(order)))
+		if err != nil {
+			t.Fatalf("%v: %v", order, err)
+		}
+		assertSamplePhoto(t, info)
+	}
+
+	// HEIC：Exif 数据块在 mdat 中，前有 4 字节偏移；前面恰好出现的 "Exif\0\0" 不是 TIFF 头时跳过
+	heic := append([]byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heic"), []byte("Exif\x00\x00garbage!")...)
+	heic = append(heic, []byte("\x00\x00\x00\x00mdat\x00\x00\x00\x06")...)
+	heic = append(append(heic, []byte("Exif\x00\x00")...), sampleTIFF(binary.BigEndian)...)
+	info, err := services.ParsePhotoEXIF(heic)
+	if err != nil {
+		t.Fatalf("heic: %v", err)
+	}
+	assertSamplePhoto(t, info)
+
+	// 南纬、西经
+	order := binary.LittleEndian
+	info, err = services.ParsePhotoEXIF(buildTIFF(order,
+		[]exifTag{{id: 0x8825, ptr: 1}},
+		[]exifTag{
+			asciiTag(0x01, "S"),
+			rationalTag(order, 0x02, [2]uint32{3386, 100}, [2]uint32{0, 1}, [2]uint32{0, 1}),
+			asciiTag(0x03, "W"),
+			rationalTag(order, 0x04, [2]uint32{7065, 100}, [2]uint32{0, 1}, [2]uint32{0, 1}),
+		},
+	))
+	if err != nil || *info.Latitude != -33.86 || *info.Longitude != -70.65 || info.TakenAt != nil {
+		t.Fatalf("southern = %+v, %v", info, err)
+	}
+
+	for name, data := range map[string][]byte{
+		"png":         []byte("\x89PNG\r\n\x1a\nrest"),
+		"jpeg 无 EXIF": {0xFF, 0xD8, 0xFF, 0xDA, 0x00, 0x02, 0xFF, 0xD9},
+		"截断":          jpegWithEXIF(sampleTIFF(order))[:40],
+	} {
+		if info, err := services.ParsePhotoEXIF(data); err != services.ErrNoEXIF {
+			t.Fatalf("%s: info=%+v err=%v", name, info, err)
+		}
+	}
+	// 目录偏移越界不能 panic
+	bad := sampleTIFF(order)
+	order.PutUint32(bad[4:], 1<<30)
+	if _, err := services.ParsePhotoEXIF(bad); err == nil {
+		t.Fatalf("expected error for bad offset")
+	}
+}
+
+func TestReadPhotoEXIF(t *testing.T) {
+	dir := t.TempDir()
+	photo := filepath.Join(dir, "a.jpg")
+	if err := os.WriteFile(photo, jpegWithEXIF(sampleTIFF(binary.LittleEndian)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	info, err := services.ReadPhotoEXIF(photo)
+	if err != nil {
+		t.Fatalf("ReadPhotoEXIF: %v", err)
+	}
+	assertSamplePhoto(t, info)
+
+	plain := filepath.Join(dir, "b.jpg")
+	if err := os.WriteFile(plain, []byte{0xFF, 0xD8, 0xFF, 0xD9}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := services.ReadPhotoEXIF(plain); info != nil || err != nil {
+		t.Fatalf("plain = %+v, %v", info, err)
+	}
+}
+
+func TestGazetteerNearest(t *testing.T) {
+	g := services.DefaultGazetteer()
+	if p := g.Nearest(39.9042, 116.4074); p == nil || p.Name != "天安门" || p.Label() != "北京天安门" {
+		t.Fatalf("tiananmen = %+v", p)
+	}
+	// 附近没有景点时取区县
+	if p := g.Nearest(39.90, 116.50); p == nil || p.Name != "朝阳区" {
+		t.Fatalf("chaoyang = %+v", p)
+	}
+	if p := g.Nearest(0.5, -30); p != nil {
+		t.Fatalf("ocean = %+v", p)
+	}
+}
+
+func TestReverseGeocodeProviders(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v3/geocode/regeo":
+			w.Write([]byte(`{"status":"1","info":"OK","regeocode":{"formatted_address":"北京市东城区东华门街道",
+				"addressComponent":{"country":"中国","province":"北京市","city":[],"district":"东城区","township":"东华门街道"}}}`))
+		case "/reverse":
+			if r.URL.Query().Get("lat") == "0.000000" {
+				w.Write([]byte(`{"error":"Unable to geocode"}`))
+				return
+			}
+			w.Write([]byte(`{"lat":"48.8584","lon":"2.2945","name":"Gros-Caillou","addresstype":"suburb",
+				"address":{"city":"Paris","country_code":"fr"}}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	ctx := context.Background()
+
+	p, err := (&services.AmapGeocoder{Key: "k", BaseURL: srv.URL}).ReverseGeocode(ctx, 39.9163, 116.3972)
+	if err != nil {
+		t.Fatalf("amap: %v", err)
+	}
+	// 直辖市 city 为空，用省级名称作上级
+	if p == nil || p.Name != "东城区" || p.Admin != "北京市" || p.Label() != "北京市东城区" || p.Latitude != 39.9163 {
+		t.Fatalf("amap place = %+v", p)
+	}
+
+	n := &services.NominatimGeocoder{BaseURL: srv.URL, Interval: time.Millisecond}
+	if p, err := n.ReverseGeocode(ctx, 48.8584, 2.2945); err != nil || p == nil || p.Name != "Gros-Caillou" ||
+		p.Kind != services.GeoKindDistrict || p.Admin != "Paris" {
+		t.Fatalf("nominatim = %+v, %v", p, err)
+	}
+	if p, err := n.ReverseGeocode(ctx, 0, 0); err != nil || p != nil {
+		t.Fatalf("nominatim ocean = %+v, %v", p, err)
+	}
+
+	// 组合时在线服务优先，离线地名库兜底
+	gaz := &services.GazetteerGeocoder{Gazetteer: services.DefaultGazetteer()}
+	chain := services.ChainGeocoder{gaz, &services.AmapGeocoder{Key: "k", BaseURL: srv.URL}}
+	if p, err := chain.ReverseGeocode(ctx, 39.9163, 116.3972); err != nil || p.Provider != "amap" {
+		t.Fatalf("chain = %+v, %v", p, err)
+	}
+	chain = services.ChainGeocoder{gaz, &services.AmapGeocoder{Key: "k", BaseURL: srv.URL + "/down"}}
+	if p, err := chain.ReverseGeocode(ctx, 39.9163, 116.3972); err != nil || p.Provider != "gazetteer" || p.Name != "故宫" {
+		t.Fatalf("fallback = %+v, %v", p, err)
+	}
+}
@@ -0,0 +1,480 @@
+package services
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"memo-studio/backend/models"
+)
+
+//go:embed data/gazetteer.tsv
+var builtinGazetteer string
+
+// 地点类型，按具体程度从低到高
+const (
+	GeoKindCountry  = "country"
+	GeoKindProvince = "province"
+	GeoKindCity     = "city"
+	GeoKindDistrict = "district"
+	GeoKindPlace    = "place" // 景点、商圈等
+)
+
+// geoKindRank 地点的具体程度：正文中同时出现多个地点时取最具体的
+func geoKindRank(kind string) int {
+	switch kind {
+	case GeoKindCountry:
+		return 0
+	case GeoKindProvince:
+		return 1
+	case GeoKindCity:
+		return 2
+	case GeoKindDistrict:
+		return 3
+	default:
+		return 4
+	}
+}
+
+// GeoPlace 地理编码结果（WGS-84 坐标）
+type GeoPlace struct {
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Kind      string  `json:"kind,omitempty"`
+	Country   string  `json:"country,omitempty"` // ISO 3166 国家代码
+	Admin     string  `json:"admin,omitempty"`   // 上级行政区（区县为所属城市）
+	Provider  string  `json:"provider,omitempty"`
+}
+
+// Label 展示名称：区县和景点带上所属城市，如“北京朝阳区”
+func (p GeoPlace) Label() string {
+	if (p.Kind == GeoKindDistrict || p.Kind == GeoKindPlace) && p.Admin != "" &&
+		p.Admin != p.Name && !strings.HasPrefix(p.Name, p.Admin) && isHan(p.Admin) {
+		return p.Admin + p.Name
+	}
+	return p.Name
+}
+
+type gazetteerEntry struct {
+	GeoPlace
+	NameEn     string
+	Aliases    []string
+	Population int64
+}
+
+// Gazetteer 离线地名库：支持中英文名称、别名，以及去掉“市/区/县”等后缀的写法
+type Gazetteer struct {
+	entries []gazetteerEntry
+	names   map[string][]int // 名称、英文名与别名
+	loose   map[string][]int // 去掉行政后缀的名称，精确匹配不到时使用
+	scan    map[string][]int // 可在正文中直接识别的名称
+	maxScan int              // scan 中最长名称的字符数
+}
+
+// 去掉后缀后用于匹配的行政区划后缀（长的在前）
+var adminSuffixes = []string{"特别行政区", "维吾尔自治区", "壮族自治区", "回族自治区", "自治区", "自治州", "新区", "地区", "省", "市", "区", "县"}
+
+// NewGazetteer 空地名库
+func NewGazetteer() *Gazetteer {
+	return &Gazetteer{names: map[string][]int{}, loose: map[string][]int{}, scan: map[string][]int{}}
+}
+
+// Len 地名条数
+func (g *Gazetteer) Len() int {
+	return len(g.entries)
+}
+
+// normalizeGeoQuery 统一大小写、空白和撇号，作为地名索引与缓存键
+func normalizeGeoQuery(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.NewReplacer("'", "", "’", "", "·", "", "-", " ", "_", " ").Replace(s)
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func isHan(s string) bool {
+	for _, r := range s {
+		if !unicode.Is(unicode.Han, r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+func stripAdminSuffix(name string) string {
+	for _, suffix := range adminSuffixes {
+		if rest := strings.TrimSuffix(name, suffix); rest != name && utf8.RuneCountInString(rest) >= 2 {
+			return rest
+		}
+	}
+	return name
+}
+
+// maxScanRunes 正文识别时名称的最大字符数（GeoNames 的别名里有很长的全称）
+const maxScanRunes = 24
+
+// scannable 正文中识别的名称：中文至少 2 个字，英文至少 4 个字母（避免 “LA”“SZ” 之类的误判）
+func scannable(key string) bool {
+	if isASCII(key) {
+		return len(key) >= 4
+	}
+	return utf8.RuneCountInString(key) >= 2
+}
+
+// Add 加入一条地名并建立索引
+func (g *Gazetteer) Add(e gazetteerEntry) {
+	idx := len(g.entries)
+	g.entries = append(g.entries, e)
+
+	keys := append([]string{e.Name, e.NameEn}, e.Aliases...)
+	for i, k := range keys {
+		keys[i] = normalizeGeoQuery(k)
+	}
+	index := func(m map[string][]int, key string) {
+		if key == "" {
+			return
+		}
+		if ids := m[key]; len(ids) > 0 && ids[len(ids)-1] == idx {
+			return
+		}
+		m[key] = append(m[key], idx)
+	}
+	for _, k := range keys {
+		index(g.names, k)
+		if isHan(k) {
+			index(g.loose, stripAdminSuffix(k))
+		}
+		if n := utf8.RuneCountInString(k); scannable(k) && n <= maxScanRunes {
+			index(g.scan, k)
+			if n > g.maxScan {
+				g.maxScan = n
+			}
+		}
+	}
+}
+
+// LoadGazetteerFile 从文件加载地名（格式见 Parse）
+func (g *Gazetteer) LoadGazetteerFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return g.Parse(f)
+}
+
+// Parse 读取制表符分隔的地名数据，支持两种格式：
+//   - 内置格式：name, name_en, aliases, latitude, longitude, kind, country, admin, population
+//   - GeoNames 导出格式（allCountries.txt、cities15000.txt 等，19 列）
+func (g *Gazetteer) Parse(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 64*1024), 4*1024*1024) // GeoNames 的别名列可能很长
+	line := 0
+	for sc.Scan() {
+		line++
+		text := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(text) == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		cols := strings.Split(text, "\t")
+		var (
+			e   gazetteerEntry
+			err error
+		)
+		if len(cols) >= 15 {
+			e, err = parseGeoNamesRow(cols)
+		} else {
+			e, err = parseGazetteerRow(cols)
+		}
+		if err != nil {
+			return fmt.Errorf("第 %d 行: %w", line, err)
+		}
+		g.Add(e)
+	}
+	return sc.Err()
+}
+
+func splitAliases(s string) []string {
+	var out []string
+	for _, a := range strings.Split(s, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			out = append(out, a)
+		}
+	}
+	return out
+}
+
+func parseLatLon(latStr, lonStr string) (float64, float64, error) {
+	lat, err := strconv.ParseFloat(strings.TrimSpace(latStr), 64)
+	if err != nil || lat < -90 || lat > 90 {
+		return 0, 0, fmt.Errorf("无效的纬度 %q", latStr)
+	}
+	lon, err := strconv.ParseFloat(strings.TrimSpace(lonStr), 64)
+	if err != nil || lon < -180 || lon > 180 {
+		return 0, 0, fmt.Errorf("无效的经度 %q", lonStr)
+	}
+	return lat, lon, nil
+}
+
+func parseGazetteerRow(cols []string) (gazetteerEntry, error) {
+	if len(cols) < 5 {
+		return gazetteerEntry{}, fmt.Errorf("至少需要 name、name_en、aliases、latitude、longitude 五列")
+	}
+	for len(cols) < 9 {
+		cols = append(cols, "")
+	}
+	lat, lon, err := parseLatLon(cols[3], cols[4])
+	if err != nil {
+		return gazetteerEntry{}, err
+	}
+	e := gazetteerEntry{
+		GeoPlace: GeoPlace{
+			Name:      strings.TrimSpace(cols[0]),
+			Latitude:  lat,
+			Longitude: lon,
+			Kind:      strings.TrimSpace(cols[5]),
+			Country:   strings.ToUpper(strings.TrimSpace(cols[6])),
+			Admin:     strings.TrimSpace(cols[7]),
+		},
+		NameEn:  strings.TrimSpace(cols[1]),
+		Aliases: splitAliases(cols[2]),
+	}
+	if e.Name == "" {
+		return gazetteerEntry{}, fmt.Errorf("名称为空")
+	}
+	if e.Kind == "" {
+		e.Kind = GeoKindCity
+	}
+	e.Population, _ = strconv.ParseInt(strings.TrimSpace(cols[8]), 10, 64)
+	return e, nil
+}
+
+// parseGeoNamesRow GeoNames 列：geonameid, name, asciiname, alternatenames, latitude, longitude,
+// feature class, feature code, country code, cc2, admin1 code, admin2, admin3, admin4, population, ...
+func parseGeoNamesRow(cols []string) (gazetteerEntry, error) {
+	lat, lon, err := parseLatLon(cols[4], cols[5])
+	if err != nil {
+		return gazetteerEntry{}, err
+	}
+	e := gazetteerEntry{
+		GeoPlace: GeoPlace{
+			Latitude:  lat,
+			Longitude: lon,
+			Kind:      geoNamesKind(cols[6], cols[7]),
+			Country:   strings.ToUpper(strings.TrimSpace(cols[8])),
+			Admin:     strings.TrimSpace(cols[10]),
+		},
+		NameEn:  strings.TrimSpace(cols[2]),
+		Aliases: splitAliases(cols[3]),
+	}
+	e.Name = strings.TrimSpace(cols[1])
+	// 有中文别名时用作展示名称
+	for _, a := range e.Aliases {
+		if isHan(a) {
+			e.Name = a
+			e.Aliases = append(e.Aliases, strings.TrimSpace(cols[1]))
+			break
+		}
+	}
+	if e.Name == "" {
+		return gazetteerEntry{}, fmt.Errorf("名称为空")
+	}
+	e.Population, _ = strconv.ParseInt(strings.TrimSpace(cols[14]), 10, 64)
+	return e, nil
+}
+
+func geoNamesKind(class, code string) string {
+	switch {
+	case class == "A" && strings.HasPrefix(code, "PCL"):
+		return GeoKindCountry
+	case class == "A" && code == "ADM1":
+		return GeoKindProvince
+	case class == "A":
+		return GeoKindDistrict
+	case class == "P" && code == "PPLX":
+		return GeoKindDistrict
+	case class == "P":
+		return GeoKindCity
+	default:
+		return GeoKindPlace
+	}
+}
+
+// best 从同名候选中选取：上级行政区出现在 context 中的优先，其次人口多的
+func (g *Gazetteer) best(ids []int, context string) *GeoPlace {
+	bestIdx, bestScore := -1, int64(-1)
+	for _, id := range ids {
+		e := g.entries[id]
+		score := e.Population
+		if e.Admin != "" && context != "" && strings.Contains(context, normalizeGeoQuery(e.Admin)) {
+			score += 1 << 40
+		}
+		if score > bestScore {
+			bestIdx, bestScore = id, score
+		}
+	}
+	if bestIdx < 0 {
+		return nil
+	}
+	p := g.entries[bestIdx].GeoPlace
+	return &p
+}
+
+// Lookup 按名称查找地点：先精确匹配名称与别名，再匹配去掉行政后缀的写法，
+// 最后把查询当作地址（如“广东省深圳市南山区”）取其中最具体的地点。找不到返回 nil
+func (g *Gazetteer) Lookup(query string) *GeoPlace {
+	q := normalizeGeoQuery(query)
+	if q == "" {
+		return nil
+	}
+	if ids := g.names[q]; len(ids) > 0 {
+		return g.best(ids, q)
+	}
+	if isHan(q) {
+		if ids := g.loose[stripAdminSuffix(q)]; len(ids) > 0 {
+			return g.best(ids, q)
+		}
+	}
+	return g.FindIn(query)
+}
+
+type gazetteerMatch struct {
+	ids []int
+	pos int
+}
+
+// FindIn 识别正文中提到的地点，多个地点时取最具体的（景点 > 区县 > 城市 > 省 > 国家），
+// 同样具体时取最先出现的。中文按最长匹配，英文按整词匹配
+func (g *Gazetteer) FindIn(text string) *GeoPlace {
+	if g.maxScan == 0 || text == "" {
+		return nil
+	}
+	runes := []rune(strings.ToLower(text))
+	var matches []gazetteerMatch
+	for i := 0; i < len(runes); {
+		// 英文名称必须从词首开始
+		if isWordRune(runes[i]) && i > 0 && isWordRune(runes[i-1]) {
+			i++
+			continue
+		}
+		matched := 0
+		for n := min(g.maxScan, len(runes)-i); n >= 2; n-- {
+			end := i + n
+			if isWordRune(runes[end-1]) && end < len(runes) && isWordRune(runes[end]) {
+				continue // 英文名称必须在词尾结束
+			}
+			if ids := g.scan[normalizeGeoQuery(string(runes[i:end]))]; len(ids) > 0 {
+				matches = append(matches, gazetteerMatch{ids: ids, pos: i})
+				matched = n
+				break
+			}
+		}
+		if matched > 0 {
+			i += matched
+		} else {
+			i++
+		}
+	}
+	if len(matches) == 0 {
+		return nil
+	}
+
+	context := normalizeGeoQuery(text)
+	var best *GeoPlace
+	bestRank := -1
+	for _, m := range matches {
+		p := g.best(m.ids, context)
+		if r := geoKindRank(p.Kind); r > bestRank {
+			best, bestRank = p, r
+		}
+	}
+	return best
+}
+
+// reverseRadiusKm 反查时各类地点的覆盖半径（公里）；国家和省份范围太大，不参与反查
+func reverseRadiusKm(kind string) float64 {
+	switch kind {
+	case GeoKindCity:
+		return 50
+	case GeoKindDistrict:
+		return 12
+	case GeoKindPlace:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// Nearest 坐标附近最具体的地点（景点 > 区县 > 城市），同样具体时取最近的；
+// 附近没有收录的地点时返回 nil
+func (g *Gazetteer) Nearest(lat, lng float64) *GeoPlace {
+	bestIdx, bestRank, bestDist := -1, -1, 0.0
+	for i, e := range g.entries {
+		radius := reverseRadiusKm(e.Kind)
+		if radius == 0 {
+			continue
+		}
+		d := models.HaversineKm(lat, lng, e.Latitude, e.Longitude)
+		if d > radius {
+			continue
+		}
+		if r := geoKindRank(e.Kind); r > bestRank || (r == bestRank && d < bestDist) {
+			bestIdx, bestRank, bestDist = i, r, d
+		}
+	}
+	if bestIdx < 0 {
+		return nil
+	}
+	p := g.entries[bestIdx].GeoPlace
+	return &p
+}
+
+// isWordRune 英文单词字符（中文逐字匹配，不受词边界限制）
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+var (
+	defaultGazetteer     *Gazetteer
+	defaultGazetteerOnce sync.Once
+)
+
+// DefaultGazetteer 内置地名库，另加 MEMO_GAZETTEER_PATH 指定的文件（逗号分隔，可为 GeoNames 导出文件）
+func DefaultGazetteer() *Gazetteer {
+	defaultGazetteerOnce.Do(func() {
+		g := NewGazetteer()
+		if err := g.Parse(strings.NewReader(builtinGazetteer)); err != nil {
+			log.Printf("加载内置地名库失败: %v", err)
+		}
+		for _, path := range strings.Split(os.Getenv("MEMO_GAZETTEER_PATH"), ",") {
+			if path = strings.TrimSpace(path); path == "" {
+				continue
+			}
+			before := g.Len()
+			if err := g.LoadGazetteerFile(path); err != nil {
+				log.Printf("加载地名库 %s 失败: %v", path, err)
+				continue
+			}
+			log.Printf("已加载地名库 %s（%d 条）", path, g.Len()-before)
+		}
+		defaultGazetteer = g
+	})
+	return defaultGazetteer
+}
@@ -0,0 +1,654 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"memo-studio/backend/models"
+)
+
+// Geocoder 地理编码接口：地名或地址 → 坐标。查不到时返回 nil, nil
+type Geocoder interface {
+	Name() string
+	Geocode(ctx context.Context, query string) (*GeoPlace, error)
+}
+
+// ReverseGeocoder 逆地理编码接口：坐标（WGS-84）→ 地点。查不到时返回 nil, nil
+type ReverseGeocoder interface {
+	Name() string
+	ReverseGeocode(ctx context.Context, lat, lng float64) (*GeoPlace, error)
+}
+
+// GazetteerGeocoder 离线地名库
+type GazetteerGeocoder struct {
+	Gazetteer *Gazetteer
+}
+
+func (g *GazetteerGeocoder) Name() string { return "gazetteer" }
+
+func (g *GazetteerGeocoder) Geocode(_ context.Context, query string) (*GeoPlace, error) {
+	p := g.Gazetteer.Lookup(query)
+	if p != nil {
+		p.Provider = g.Name()
+	}
+	return p, nil
+}
+
+// ReverseGeocode 取坐标附近最具体的已收录地点
+func (g *GazetteerGeocoder) ReverseGeocode(_ context.Context, lat, lng float64) (*GeoPlace, error) {
+	p := g.Gazetteer.Nearest(lat, lng)
+	if p != nil {
+		p.Provider = g.Name()
+	}
+	return p, nil
+}
+
+// ChainGeocoder 依次尝试多个地理编码服务，返回第一个结果；全部出错时返回最后一个错误
+type ChainGeocoder []Geocoder
+
+func (c ChainGeocoder) Name() string {
+	names := make([]string, 0, len(c))
+	for _, g := range c {
+		names = append(names, g.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (c ChainGeocoder) Geocode(ctx context.Context, query string) (*GeoPlace, error) {
+	var lastErr error
+	for _, g := range c {
+		p, err := g.Geocode(ctx, query)
+		if err != nil {
+			log.Printf("地理编码 %s 失败: %v", g.Name(), err)
+			lastErr = err
+			continue
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// ReverseGeocode 依次尝试支持逆地理编码的服务。离线地名库只能给出附近的城市或区县，
+// 放在在线服务之后兜底
+func (c ChainGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (*GeoPlace, error) {
+	var online, offline []ReverseGeocoder
+	for _, g := range c {
+		rg, ok := g.(ReverseGeocoder)
+		if !ok {
+			continue
+		}
+		if _, isGazetteer := g.(*GazetteerGeocoder); isGazetteer {
+			offline = append(offline, rg)
+		} else {
+			online = append(online, rg)
+		}
+	}
+	var lastErr error
+	for _, g := range append(online, offline...) {
+		p, err := g.ReverseGeocode(ctx, lat, lng)
+		if err != nil {
+			log.Printf("逆地理编码 %s 失败: %v", g.Name(), err)
+			lastErr = err
+			continue
+		}
+		if p != nil {
+			return p, nil
+		}
+	}
+	return nil, lastErr
+}
+
+// geocodeNotFoundTTL 查不到的结果缓存时间（地名库更新或地名写法变化后可再次查询）
+const geocodeNotFoundTTL = 24 * time.Hour
+
+// CachedGeocoder 把在线服务的结果缓存到 geocode_cache 表；出错的请求不缓存
+type CachedGeocoder struct {
+	Geocoder Geocoder
+	TTL      time.Duration
+}
+
+func (c *CachedGeocoder) Name() string { return c.Geocoder.Name() }
+
+func (c *CachedGeocoder) Geocode(ctx context.Context, query string) (*GeoPlace, error) {
+	key := normalizeGeoQuery(query)
+	if key == "" {
+		return nil, nil
+	}
+	return c.cached(key, func() (*GeoPlace, error) { return c.Geocoder.Geocode(ctx, query) })
+}
+
+// ReverseGeocode 坐标按约 10 米的精度作为缓存键；被包装的服务不支持逆地理编码时返回 nil, nil
+func (c *CachedGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (*GeoPlace, error) {
+	rg, ok := c.Geocoder.(ReverseGeocoder)
+	if !ok {
+		return nil, nil
+	}
+	key := fmt.Sprintf("@%.4f,%.4f", lat, lng)
+	return c.cached(key, func() (*GeoPlace, error) { return rg.ReverseGeocode(ctx, lat, lng) })
+}
+
+// cached 先查缓存，未命中时调用 fetch 并写入缓存
+func (c *CachedGeocoder) cached(key string, fetch func() (*GeoPlace, error)) (*GeoPlace, error) {
+	now := time.Now()
+	if e, err := models.GetGeocodeCache(c.Name(), key, now); err != nil {
+		log.Printf("读取地理编码缓存失败: %v", err)
+	} else if e != nil {
+		if !e.Found {
+			return nil, nil
+		}
+		return &GeoPlace{Name: e.Name, Latitude: e.Latitude, Longitude: e.Longitude, Kind: e.Kind,
+			Country: e.Country, Admin: e.Admin, Provider: e.Provider}, nil
+	}
+
+	p, err := fetch()
+	if err != nil {
+		return nil, err
+	}
+	entry := models.GeocodeCacheEntry{Provider: c.Name(), Query: key, CreatedAt: now, ExpiresAt: now.Add(geocodeNotFoundTTL)}
+	if p != nil {
+		entry.Found, entry.Name, entry.Latitude, entry.Longitude = true, p.Name, p.Latitude, p.Longitude
+		entry.Kind, entry.Country, entry.Admin = p.Kind, p.Country, p.Admin
+		entry.ExpiresAt = now.Add(c.TTL)
+	}
+	if err := models.PutGeocodeCache(entry); err != nil {
+		log.Printf("写入地理编码缓存失败: %v", err)
+	}
+	return p, nil
+}
+
+var defaultGeocodeClient = &http.Client{Timeout: 10 * time.Second}
+
+func geocodeGetJSON(ctx context.Context, client *http.Client, endpoint string, header http.Header, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if client == nil {
+		client = defaultGeocodeClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// AmapGeocoder 高德地理编码（Web 服务 API）。高德返回 GCJ-02 坐标，这里转换为 WGS-84
+type AmapGeocoder struct {
+	Key     string
+	BaseURL string // 默认 https://restapi.amap.com
+	Client  *http.Client
+}
+
+func (a *AmapGeocoder) Name() string { return "amap" }
+
+func (a *AmapGeocoder) Geocode(ctx context.Context, query string) (*GeoPlace, error) {
+	base := strings.TrimRight(a.BaseURL, "/")
+	if base == "" {
+		base = "https://restapi.amap.com"
+	}
+	params := url.Values{"key": {a.Key}, "address": {query}, "output": {"JSON"}}
+	var resp struct {
+		Status   string `json:"status"`
+		Info     string `json:"info"`
+		Geocodes []struct {
+			FormattedAddress string          `json:"formatted_address"`
+			Country          string          `json:"country"`
+			Province         json.RawMessage `json:"province"` // 为空时是 []
+			City             json.RawMessage `json:"city"`
+			District         json.RawMessage `json:"district"`
+			Location         string          `json:"location"` // "经度,纬度"
+			Level            string          `json:"level"`
+		} `json:"geocodes"`
+	}
+	if err := geocodeGetJSON(ctx, a.Client, base+"/v3/geocode/geo?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "1" {
+		return nil, fmt.Errorf("高德地理编码失败: %s", resp.Info)
+	}
+	if len(resp.Geocodes) == 0 {
+		return nil, nil
+	}
+	g := resp.Geocodes[0]
+	parts := strings.Split(g.Location, ",")
+	if len(parts) != 2 {
+		return nil, nil
+	}
+	lat, lon, err := parseLatLon(parts[1], parts[0])
+	if err != nil {
+		return nil, err
+	}
+	lat, lon = GCJ02ToWGS84(lat, lon)
+	p := &GeoPlace{Latitude: lat, Longitude: lon, Kind: amapKind(g.Level), Provider: a.Name()}
+	province, city, district := amapString(g.Province), amapString(g.City), amapString(g.District)
+	switch p.Kind {
+	case GeoKindProvince:
+		p.Name = province
+	case GeoKindCity:
+		p.Name, p.Admin = city, province
+	case GeoKindDistrict:
+		p.Name, p.Admin = district, city
+	default:
+		p.Name, p.Admin = g.FormattedAddress, city
+	}
+	if p.Name == "" {
+		p.Name = g.FormattedAddress
+	}
+	if p.Admin == "" {
+		p.Admin = province
+	}
+	if g.Country == "中国" {
+		p.Country = "CN"
+	}
+	return p, nil
+}
+
+// ReverseGeocode 高德逆地理编码，返回坐标所在的区县（有乡镇街道时为街道）
+func (a *AmapGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (*GeoPlace, error) {
+	base := strings.TrimRight(a.BaseURL, "/")
+	if base == "" {
+		base = "https://restapi.amap.com"
+	}
+	gLat, gLng := WGS84ToGCJ02(lat, lng)
+	params := url.Values{"key": {a.Key}, "location": {fmt.Sprintf("%.6f,%.6f", gLng, gLat)}, "output": {"JSON"}}
+	var resp struct {
+		Status    string `json:"status"`
+		Info      string `json:"info"`
+		Regeocode struct {
+			FormattedAddress json.RawMessage `json:"formatted_address"`
+			AddressComponent struct {
+				Country  json.RawMessage `json:"country"`
+				Province json.RawMessage `json:"province"`
+				City     json.RawMessage `json:"city"` // 直辖市为 []
+				District json.RawMessage `json:"district"`
+				Township json.RawMessage `json:"township"`
+			} `json:"addressComponent"`
+		} `json:"regeocode"`
+	}
+	if err := geocodeGetJSON(ctx, a.Client, base+"/v3/geocode/regeo?"+params.Encode(), nil, &resp); err != nil {
+		return nil, err
+	}
+	if resp.Status != "1" {
+		return nil, fmt.Errorf("高德逆地理编码失败: %s", resp.Info)
+	}
+	ac := resp.Regeocode.AddressComponent
+	province, city, district := amapString(ac.Province), amapString(ac.City), amapString(ac.District)
+	if city == "" {
+		city = province
+	}
+	p := &GeoPlace{Latitude: lat, Longitude: lng, Provider: a.Name()}
+	switch {
+	case district != "":
+		p.Name, p.Admin, p.Kind = district, city, GeoKindDistrict
+	case city != "":
+		p.Name, p.Admin, p.Kind = city, province, GeoKindCity
+	default:
+		// 境外或海上：高德不返回行政区
+		if addr := amapString(resp.Regeocode.FormattedAddress); addr != "" {
+			p.Name, p.Kind = addr, GeoKindPlace
+		} else {
+			return nil, nil
+		}
+	}
+	if p.Admin == p.Name {
+		p.Admin = province
+	}
+	if amapString(ac.Country) == "中国" {
+		p.Country = "CN"
+	}
+	return p, nil
+}
+
+// amapString 高德字段为空时返回 []，有值时是字符串
+func amapString(raw json.RawMessage) string {
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	return ""
+}
+
+func amapKind(level string) string {
+	switch level {
+	case "国家":
+		return GeoKindCountry
+	case "省":
+		return GeoKindProvince
+	case "市":
+		return GeoKindCity
+	case "区县", "开发区":
+		return GeoKindDistrict
+	default:
+		return GeoKindPlace
+	}
+}
+
+// NominatimGeocoder OpenStreetMap Nominatim。公共实例要求标明 User-Agent 且每秒最多 1 次请求
+type NominatimGeocoder struct {
+	BaseURL   string // 默认 https://nominatim.openstreetmap.org
+	UserAgent string
+	Email     string
+	Interval  time.Duration // 两次请求的最小间隔，默认 1s
+	Client    *http.Client
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+func (n *NominatimGeocoder) Name() string { return "nominatim" }
+
+// wait 按 Interval 限制请求频率
+func (n *NominatimGeocoder) wait(ctx context.Context) error {
+	interval := n.Interval
+	if interval == 0 {
+		interval = time.Second
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if d := time.Until(n.last.Add(interval)); d > 0 {
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+	n.last = time.Now()
+	return nil
+}
+
+func (n *NominatimGeocoder) Geocode(ctx context.Context, query string) (*GeoPlace, error) {
+	base := strings.TrimRight(n.BaseURL, "/")
+	if base == "" {
+		base = "https://nominatim.openstreetmap.org"
+	}
+	params := url.Values{
+		"q":               {query},
+		"format":          {"jsonv2"},
+		"limit":           {"1"},
+		"addressdetails":  {"1"},
+		"accept-language": {"zh-CN,zh,en"},
+	}
+	if n.Email != "" {
+		params.Set("email", n.Email)
+	}
+	ua := n.userAgent()
+	if err := n.wait(ctx); err != nil {
+		return nil, err
+	}
+	var results []nominatimResult
+	if err := geocodeGetJSON(ctx, n.Client, base+"/search?"+params.Encode(), http.Header{"User-Agent": {ua}}, &results); err != nil {
+		return nil, err
+	}
+	if len(results) == 0 {
+		return nil, nil
+	}
+	return results[0].place(n.Name())
+}
+
+// ReverseGeocode Nominatim /reverse，精确到街区（zoom=14）
+func (n *NominatimGeocoder) ReverseGeocode(ctx context.Context, lat, lng float64) (*GeoPlace, error) {
+	base := strings.TrimRight(n.BaseURL, "/")
+	if base == "" {
+		base = "https://nominatim.openstreetmap.org"
+	}
+	params := url.Values{
+		"lat":             {strconv.FormatFloat(lat, 'f', 6, 64)},
+		"lon":             {strconv.FormatFloat(lng, 'f', 6, 64)},
+		"zoom":            {"14"},
+		"format":          {"jsonv2"},
+		"addressdetails":  {"1"},
+		"accept-language": {"zh-CN,zh,en"},
+	}
+	if n.Email != "" {
+		params.Set("email", n.Email)
+	}
+	if err := n.wait(ctx); err != nil {
+		return nil, err
+	}
+	var result nominatimResult
+	if err := geocodeGetJSON(ctx, n.Client, base+"/reverse?"+params.Encode(), http.Header{"User-Agent": {n.userAgent()}}, &result); err != nil {
+		return nil, err
+	}
+	if result.Error != "" || result.Lat == "" {
+		return nil, nil // 海上等无结果时返回 {"error": "Unable to geocode"}
+	}
+	return result.place(n.Name())
+}
+
+func (n *NominatimGeocoder) userAgent() string {
+	if n.UserAgent == "" {
+		return "Memo-Studio-Geocoder"
+	}
+	return n.UserAgent
+}
+
+type nominatimResult struct {
+	Lat         string            `json:"lat"`
+	Lon         string            `json:"lon"`
+	Name        string            `json:"name"`
+	DisplayName string            `json:"display_name"`
+	AddressType string            `json:"addresstype"`
+	Address     map[string]string `json:"address"`
+	Error       string            `json:"error"`
+}
+
+func (r nominatimResult) place(provider string) (*GeoPlace, error) {
+	lat, lon, err := parseLatLon(r.Lat, r.Lon)
+	if err != nil {
+		return nil, err
+	}
+	p := &GeoPlace{
+		Name:      r.Name,
+		Latitude:  lat,
+		Longitude: lon,
+		Kind:      nominatimKind(r.AddressType),
+		Country:   strings.ToUpper(r.Address["country_code"]),
+		Provider:  provider,
+	}
+	if p.Name == "" {
+		p.Name, _, _ = strings.Cut(r.DisplayName, ",")
+	}
+	switch p.Kind {
+	case GeoKindDistrict, GeoKindPlace:
+		p.Admin = firstNonEmpty(r.Address["city"], r.Address["town"], r.Address["state"])
+	case GeoKindCity:
+		p.Admin = r.Address["state"]
+	}
+	return p, nil
+}
+
+func nominatimKind(addressType string) string {
+	switch addressType {
+	case "country":
+		return GeoKindCountry
+	case "state", "province", "region":
+		return GeoKindProvince
+	case "city", "town", "village", "municipality":
+		return GeoKindCity
+	case "city_district", "district", "borough", "suburb", "county":
+		return GeoKindDistrict
+	default:
+		return GeoKindPlace
+	}
+}
+
+// GCJ-02（国测局坐标，高德/腾讯地图使用）与 WGS-84 的换算；境外坐标不做偏移
+const (
+	gcjAxis = 6378245.0
+	gcjEE   = 0.00669342162296594323
+)
+
+func outOfChina(lat, lon float64) bool {
+	return lon < 72.004 || lon > 137.8347 || lat < 0.8293 || lat > 55.8271
+}
+
+func gcjTransformLat(x, y float64) float64 {
+	ret := -100.0 + 2.0*x + 3.0*y + 0.2*y*y + 0.1*x*y + 0.2*math.Sqrt(math.Abs(x))
+	ret += (20.0*math.Sin(6.0*x*math.Pi) + 20.0*math.Sin(2.0*x*math.Pi)) * 2.0 / 3.0
+	ret += (20.0*math.Sin(y*math.Pi) + 40.0*math.Sin(y/3.0*math.Pi)) * 2.0 / 3.0
+	ret += (160.0*math.Sin(y/12.0*math.Pi) + 320*math.Sin(y*math.Pi/30.0)) * 2.0 / 3.0
+	return ret
+}
+
+func gcjTransformLon(x, y float64) float64 {
+	ret := 300.0 + x + 2.0*y + 0.1*x*x + 0.1*x*y + 0.1*math.Sqrt(math.Abs(x))
+	ret += (20.0*math.Sin(6.0*x*math.Pi) + 20.0*math.Sin(2.0*x*math.Pi)) * 2.0 / 3.0
+	ret += (20.0*math.Sin(x*math.Pi) + 40.0*math.Sin(x/3.0*math.Pi)) * 2.0 / 3.0
+	ret += (150.0*math.Sin(x/12.0*math.Pi) + 300.0*math.Sin(x/30.0*math.Pi)) * 2.0 / 3.0
+	return ret
+}
+
+func gcjOffset(lat, lon float64) (float64, float64) {
+	dLat := gcjTransformLat(lon-105.0, lat-35.0)
+	dLon := gcjTransformLon(lon-105.0, lat-35.0)
+	radLat := lat / 180.0 * math.Pi
+	magic := math.Sin(radLat)
+	magic = 1 - gcjEE*magic*magic
+	sqrtMagic := math.Sqrt(magic)
+	dLat = (dLat * 180.0) / ((gcjAxis * (1 - gcjEE)) / (magic * sqrtMagic) * math.Pi)
+	dLon = (dLon * 180.0) / (gcjAxis / sqrtMagic * math.Cos(radLat) * math.Pi)
+	return dLat, dLon
+}
+
+// WGS84ToGCJ02 WGS-84 → GCJ-02
+func WGS84ToGCJ02(lat, lon float64) (float64, float64) {
+	if outOfChina(lat, lon) {
+		return lat, lon
+	}
+	dLat, dLon := gcjOffset(lat, lon)
+	return lat + dLat, lon + dLon
+}
+
+// GCJ02ToWGS84 GCJ-02 → WGS-84（迭代求逆，误差在厘米级）
+func GCJ02ToWGS84(lat, lon float64) (float64, float64) {
+	if outOfChina(lat, lon) {
+		return lat, lon
+	}
+	wLat, wLon := lat, lon
+	for i := 0; i < 5; i++ {
+		gLat, gLon := WGS84ToGCJ02(wLat, wLon)
+		wLat, wLon = wLat-(gLat-lat), wLon-(gLon-lon)
+	}
+	return wLat, wLon
+}
+
+// DefaultGeocodeCacheTTL 在线地理编码结果的默认缓存时间
+const DefaultGeocodeCacheTTL = 90 * 24 * time.Hour
+
+// GeocodeCacheTTL MEMO_GEOCODE_CACHE_TTL（如 "720h"，或秒数）；0 表示不缓存
+func GeocodeCacheTTL() time.Duration {
+	v := strings.TrimSpace(os.Getenv("MEMO_GEOCODE_CACHE_TTL"))
+	if v == "" {
+		return DefaultGeocodeCacheTTL
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return max(d, 0)
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	return DefaultGeocodeCacheTTL
+}
+
+// GeocoderFromEnv 按 MEMO_GEOCODER（逗号分隔，默认 gazetteer）依次组合地理编码服务：
+// gazetteer 为离线地名库；amap 需要 AMAP_KEY；nominatim 可用 NOMINATIM_URL 指向自建实例。
+// 在线服务的结果缓存到 geocode_cache 表
+func GeocoderFromEnv() Geocoder {
+	names := strings.Split(os.Getenv("MEMO_GEOCODER"), ",")
+	ttl := GeocodeCacheTTL()
+	cached := func(g Geocoder) Geocoder {
+		if ttl <= 0 {
+			return g
+		}
+		return &CachedGeocoder{Geocoder: g, TTL: ttl}
+	}
+
+	var chain ChainGeocoder
+	for _, name := range names {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "", "gazetteer", "offline":
+			chain = append(chain, &GazetteerGeocoder{Gazetteer: DefaultGazetteer()})
+		case "amap":
+			key := strings.TrimSpace(os.Getenv("AMAP_KEY"))
+			if key == "" {
+				log.Printf("MEMO_GEOCODER 包含 amap，但未设置 AMAP_KEY，已跳过")
+				continue
+			}
+			chain = append(chain, cached(&AmapGeocoder{Key: key, BaseURL: os.Getenv("AMAP_BASE_URL")}))
+		case "nominatim":
+			email := strings.TrimSpace(os.Getenv("NOMINATIM_EMAIL"))
+			ua := "Memo-Studio-Geocoder"
+			if email != "" {
+				ua += " (" + email + ")"
+			}
+			chain = append(chain, cached(&NominatimGeocoder{BaseURL: os.Getenv("NOMINATIM_URL"), UserAgent: ua, Email: email}))
+		default:
+			log.Printf("未知的地理编码服务: %s", name)
+		}
+	}
+	if len(chain) == 0 {
+		chain = append(chain, &GazetteerGeocoder{Gazetteer: DefaultGazetteer()})
+	}
+	if len(chain) == 1 {
+		return chain[0]
+	}
+	return chain
+}
+
+var (
+	geocoder     Geocoder
+	geocoderOnce sync.Once
+	geocoderMu   sync.RWMutex
+)
+
+// GetGeocoder 默认地理编码服务（见 GeocoderFromEnv）
+func GetGeocoder() Geocoder {
+	geocoderOnce.Do(func() {
+		geocoderMu.Lock()
+		defer geocoderMu.Unlock()
+		if geocoder == nil {
+			geocoder = GeocoderFromEnv()
+		}
+	})
+	geocoderMu.RLock()
+	defer geocoderMu.RUnlock()
+	return geocoder
+}
+
+// ReverseGeocode 用默认地理编码服务反查坐标；服务不支持逆地理编码时返回 nil, nil
+func ReverseGeocode(ctx context.Context, lat, lng float64) (*GeoPlace, error) {
+	if rg, ok := GetGeocoder().(ReverseGeocoder); ok {
+		return rg.ReverseGeocode(ctx, lat, lng)
+	}
+	return nil, nil
+}
+
+// SetGeocoder 替换地理编码实现（测试或自定义部署）
+func SetGeocoder(g Geocoder) {
+	geocoderOnce.Do(func() {})
+	geocoderMu.Lock()
+	defer geocoderMu.Unlock()
+	geocoder = g
+}
@@ -0,0 +1,168 @@
+package services_test
+
+import (
+	"context"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+func TestGazetteerLookup(t *testing.T) {
+	g := services.DefaultGazetteer()
+	cases := []struct {
+		query, label string
+		lat          float64
+	}{
+		{"深圳", "深圳", 22.5431},
+		{"深圳市", "深圳", 22.5431},
+		{"Shenzhen", "深圳", 22.5431},
+		{"xian", "西安", 34.3416},
+		{"Xi'an", "西安", 34.3416},
+		{"海淀", "北京海淀区", 39.9593},
+		{"广东省深圳市南山区", "深圳南山区", 22.5333},
+		{"new  york", "纽约", 40.7128},
+		{"中国香港", "香港", 22.3193},
+	}
+	for _, tc := range cases {
+		p := g.Lookup(tc.query)
+		if p == nil {
+			t.Errorf("Lookup(%q) = nil", tc.query)
+			continue
+		}
+		if p.Label() != tc.label || math.Abs(p.Latitude-tc.lat) > 1e-6 {
+			t.Errorf("Lookup(%q) = %s (%v, %v), want %s %v", tc.query, p.Label(), p.Latitude, p.Longitude, tc.label, tc.lat)
+		}
+	}
+	if p := g.Lookup("火星基地"); p != nil {
+		t.Errorf("Lookup(火星基地) = %+v, want nil", p)
+	}
+}
+
+func TestGazetteerFindIn(t *testing.T) {
+	g := services.DefaultGazetteer()
+	cases := map[string]string{
+		"周末在北京市朝阳区的三里屯逛街":                 "北京三里屯",
+		"去上海出差，在中国银行开了个会":                 "上海",
+		"Flew from London to New York":    "伦敦",
+		"晚上在 Hong Kong 转机":                "香港",
+		"今天在杭州西湖边散步":                      "杭州西湖",
+		"开了一下午会":                          "",
+		"SHOW time, LA vibes, SZ weather": "",
+	}
+	for text, want := range cases {
+		got := ""
+		if p := g.FindIn(text); p != nil {
+			got = p.Label()
+		}
+		if got != want {
+			t.Errorf("FindIn(%q) = %q, want %q", text, got, want)
+		}
+	}
+	// 英文地名按整词匹配
+	if p := g.FindIn("Romeo and Juliet"); p != nil {
+		t.Errorf("FindIn(Romeo) = %+v, want nil", p)
+	}
+}
+
+func TestGazetteerParse(t *testing.T) {
+	data := strings.Join([]string{
+		"# 自定义地名",
+		"望湖楼\tWanghu Tower\t望湖楼遗址\t30.2590\t120.1500\tplace\tCN\t杭州\t0",
+		// GeoNames 导出格式
+		"1816670\tBeijing\tBeijing\tPeking,Pekin,北京,北京市\t39.9075\t116.39723\tP\tPPLC\tCN\t\t22\t\t\t\t18960744\t\t49\tAsia/Shanghai\t2024-01-01",
+	}, "\n")
+	g := services.NewGazetteer()
+	if err := g.Parse(strings.NewReader(data)); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if g.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", g.Len())
+	}
+	if p := g.Lookup("peking"); p == nil || p.Name != "北京" || p.Kind != services.GeoKindCity || p.Country != "CN" {
+		t.Fatalf("Lookup(peking) = %+v", p)
+	}
+	if p := g.FindIn("在望湖楼喝茶"); p == nil || p.Label() != "杭州望湖楼" {
+		t.Fatalf("FindIn(望湖楼) = %+v", p)
+	}
+
+	if err := services.NewGazetteer().Parse(strings.NewReader("坏数据\tBad\t\tabc\t120")); err == nil {
+		t.Fatalf("expected error for invalid latitude")
+	}
+}
+
+func TestGCJ02RoundTrip(t *testing.T) {
+	lat, lon := 39.9042, 116.4074
+	gLat, gLon := services.WGS84ToGCJ02(lat, lon)
+	if math.Abs(gLat-lat) < 1e-4 || math.Abs(gLon-lon) < 1e-4 {
+		t.Fatalf("expected GCJ-02 offset, got %v,%v", gLat, gLon)
+	}
+	wLat, wLon := services.GCJ02ToWGS84(gLat, gLon)
+	if math.Abs(wLat-lat) > 1e-6 || math.Abs(wLon-lon) > 1e-6 {
+		t.Fatalf("round trip = %v,%v, want %v,%v", wLat, wLon, lat, lon)
+	}
+	// 境外坐标不偏移
+	if la, lo := services.WGS84ToGCJ02(51.5074, -0.1278); la != 51.5074 || lo != -0.1278 {
+		t.Fatalf("london shifted to %v,%v", la, lo)
+	}
+}
+
+func TestNominatimGeocoder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/search" || r.Header.Get("User-Agent") != "memo-test" {
+			t.Errorf("unexpected request %s UA=%q", r.URL.Path, r.Header.Get("User-Agent"))
+		}
+		if r.URL.Query().Get("q") == "Nowhere" {
+			w.Write([]byte(`[]`))
+			return
+		}
+		w.Write([]byte(`[{"lat":"48.8584","lon":"2.2945","name":"埃菲尔铁塔","display_name":"埃菲尔铁塔, 巴黎, 法国",
+			"addresstype":"attraction","address":{"city":"巴黎","country_code":"fr"}}]`))
+	}))
+	defer srv.Close()
+
+	n := &services.NominatimGeocoder{BaseURL: srv.URL, UserAgent: "memo-test", Interval: time.Millisecond}
+	p, err := n.Geocode(context.Background(), "Eiffel Tower")
+	if err != nil {
+		t.Fatalf("Geocode: %v", err)
+	}
+	if p == nil || p.Name != "埃菲尔铁塔" || p.Admin != "巴黎" || p.Country != "FR" || p.Kind != services.GeoKindPlace ||
+		p.Latitude != 48.8584 || p.Longitude != 2.2945 {
+		t.Fatalf("place = %+v", p)
+	}
+	if p, err := n.Geocode(context.Background(), "Nowhere"); err != nil || p != nil {
+		t.Fatalf("Nowhere = %+v, %v", p, err)
+	}
+}
+
+func TestAmapGeocoder(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("key") != "k" {
+			w.Write([]byte(`{"status":"0","info":"INVALID_USER_KEY"}`))
+			return
+		}
+		w.Write([]byte(`{"status":"1","info":"OK","count":"1","geocodes":[{"formatted_address":"北京市朝阳区",
+			"country":"中国","province":"北京市","city":"北京市","district":"朝阳区","location":"116.449716,39.927119","level":"区县"}]}`))
+	}))
+	defer srv.Close()
+
+	p, err := (&services.AmapGeocoder{Key: "k", BaseURL: srv.URL}).Geocode(context.Background(), "北京市朝阳区")
+	if err != nil {
+		t.Fatalf("Geocode: %v", err)
+	}
+	if p == nil || p.Name != "朝阳区" || p.Admin != "北京市" || p.Kind != services.GeoKindDistrict || p.Country != "CN" {
+		t.Fatalf("place = %+v", p)
+	}
+	// GCJ-02 转为 WGS-84 后向西南偏移几百米
+	if p.Longitude >= 116.449716 || p.Latitude >= 39.927119 || math.Abs(p.Longitude-116.449716) > 0.01 {
+		t.Fatalf("coords not converted: %v,%v", p.Latitude, p.Longitude)
+	}
+
+	if _, err := (&services.AmapGeocoder{Key: "bad", BaseURL: srv.URL}).Geocode(context.Background(), "北京"); err == nil {
+		t.Fatalf("expected error for invalid key")
+	}
+}
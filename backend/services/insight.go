@@ -0,0 +1,307 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"memo-studio/backend/models"
+)
+
+// DefaultContextTokens 模型未声明上下文长度（云端模型）时按此估算
+const DefaultContextTokens = 8192
+
+// insightReserveTokens 每次调用为提示词和模型输出预留的 token
+const insightReserveTokens = 2048
+
+// minInsightBudget 单次调用放入笔记的最少 token（上下文过小时兜底）
+const minInsightBudget = 512
+
+// noteInsightPrompt 对带 ID 的笔记生成洞察，并要求给出每条结论的依据笔记
+const noteInsightPrompt = `分析以下笔记，提供洞察报告（用中文，JSON 格式）。
+每条笔记以 [#ID] 开头；请在 evidence 中为每个关键词、趋势和建议列出依据的笔记 ID（只能使用上面出现过的 ID）：
+
+{
+  "summary": "整体总结（1-2句话）",
+  "keywords": ["关键词1", "关键词2", "关键词3"],
+  "categories": ["分类1", "分类2"],
+  "sentiment": "positive/negative/neutral",
+  "trends": ["趋势1", "趋势2"],
+  "tips": ["建议1", "建议2"],
+  "evidence": [{"text": "对应的关键词/趋势/建议", "note_ids": [1, 2]}]
+}
+
+笔记内容：
+{{notes}}
+
+时间范围：{{time_range}}`
+
+// insightReducePrompt 合并分段洞察
+const insightReducePrompt = `以下是对同一批笔记分段分析得到的多份洞察（JSON 数组），请合并为一份完整的洞察报告。
+格式与每份分段洞察相同（用中文，JSON 格式）；去掉重复的结论，evidence 中的 note_ids 只能来自分段洞察的 evidence。
+
+分段洞察：
+{{partials}}
+
+时间范围：{{time_range}}`
+
+// InsightEvidence 一条洞察结论及支撑它的笔记
+type InsightEvidence struct {
+	Text    string `json:"text"`
+	NoteIDs []int  `json:"note_ids"`
+}
+
+// insightPartial 单次调用（分段或合并）的洞察结果
+type insightPartial struct {
+	Summary    string            `json:"summary"`
+	Keywords   []string          `json:"keywords"`
+	Categories []string          `json:"categories"`
+	Sentiment  string            `json:"sentiment"`
+	Trends     []string          `json:"trends"`
+	Tips       []string          `json:"tips"`
+	Evidence   []InsightEvidence `json:"evidence"`
+
+	noteIDs []int // 该结果覆盖的笔记，用于缓存关联
+}
+
+// insightChunk 一段放得进上下文的笔记
+type insightChunk struct {
+	Text    string
+	NoteIDs []int
+}
+
+// EstimateTokens 粗略估算 token 数：中日韩等宽字符每个计 1 个 token，其余字符按每 4 个计 1 个 token
+func EstimateTokens(s string) int {
+	wide, other := 0, 0
+	for _, r := range s {
+		if r >= 0x2E80 {
+			wide++
+		} else {
+			other++
+		}
+	}
+	return wide + (other+3)/4
+}
+
+// truncateTokens 按估算 token 截断文本
+func truncateTokens(s string, max int) string {
+	if EstimateTokens(s) <= max {
+		return s
+	}
+	// 以 1/4 token 为单位累计，和 EstimateTokens 的估算一致
+	budget, used := max*4, 0
+	for i, r := range s {
+		cost := 1
+		if r >= 0x2E80 {
+			cost = 4
+		}
+		if used+cost > budget {
+			return s[:i] + "…"
+		}
+		used += cost
+	}
+	return s
+}
+
+// ContextTokens 主模型的上下文长度
+func (s *LLMService) ContextTokens() int {
+	if s.Model.Context > 0 {
+		return s.Model.Context
+	}
+	return DefaultContextTokens
+}
+
+// insightBudget 单次调用可放入的笔记 token 数
+func (s *LLMService) insightBudget() int {
+	budget := s.ContextTokens() - insightReserveTokens
+	if budget < minInsightBudget {
+		budget = minInsightBudget
+	}
+	return budget
+}
+
+// chunkNotesForInsight 按预算把笔记顺序分段；单条超出预算的笔记截断后独占一段
+func chunkNotesForInsight(notes []models.Note, budget int) []insightChunk {
+	var chunks []insightChunk
+	var cur insightChunk
+	used := 0
+	for _, n := range notes {
+		header := fmt.Sprintf("[#%d] %s", n.ID, n.CreatedAt.Format("2006-01-02"))
+		if t := strings.TrimSpace(n.Title); t != "" {
+			header += " " + t
+		}
+		text := truncateTokens(header+"\n"+strings.TrimSpace(n.Content), budget)
+		cost := EstimateTokens(text)
+		if used > 0 && used+cost > budget {
+			chunks = append(chunks, cur)
+			cur, used = insightChunk{}, 0
+		}
+		if cur.Text != "" {
+			cur.Text += "\n---\n"
+		}
+		cur.Text += text
+		cur.NoteIDs = append(cur.NoteIDs, n.ID)
+		used += cost
+	}
+	if used > 0 {
+		chunks = append(chunks, cur)
+	}
+	return chunks
+}
+
+// parseInsightPartial 解析模型输出；不是 JSON 时整段作为 summary
+func parseInsightPartial(content string) insightPartial {
+	result := strings.TrimSpace(content)
+	result = strings.TrimPrefix(result, "```json")
+	result = strings.TrimPrefix(result, "```")
+	result = strings.TrimSuffix(result, "```")
+	result = strings.TrimSpace(result)
+
+	var p insightPartial
+	if err := json.Unmarshal([]byte(result), &p); err != nil {
+		p = insightPartial{Summary: result}
+	}
+	return p
+}
+
+// insightRun 一次洞察生成中的多次模型调用
+type insightRun struct {
+	svc       *LLMService
+	ctx       context.Context
+	timeRange string
+	last      *ChatResult
+	fallback  bool
+	cached    bool
+	calls     int
+}
+
+func (r *insightRun) chat(template, prompt string, noteIDs []int) (insightPartial, error) {
+	messages := []ChatMessage{
+		{Role: "system", Content: "你是一个笔记分析助手。请用中文回复严格的 JSON 格式。"},
+		{Role: "user", Content: prompt},
+	}
+	res, cached, err := r.svc.cachedChat(r.ctx, template, messages, noteIDs, nil)
+	if err != nil {
+		return insightPartial{}, err
+	}
+	r.calls++
+	r.last = res
+	r.fallback = r.fallback || res.Fallback
+	r.cached = r.cached && cached
+	p := parseInsightPartial(res.Content)
+	p.noteIDs = noteIDs
+	return p, nil
+}
+
+// reduce 合并多份分段洞察
+func (r *insightRun) reduce(parts []insightPartial) (insightPartial, error) {
+	payload, _ := json.Marshal(parts)
+	var ids []int
+	for _, p := range parts {
+		ids = append(ids, p.noteIDs...)
+	}
+	prompt := RenderPrompt(insightReducePrompt, map[string]string{
+		"partials":   string(payload),
+		"time_range": r.timeRange,
+	})
+	return r.chat(PromptInsightReduceVersion, prompt, ids)
+}
+
+// groupInsightPartials 按预算分组待合并的结果；每组至少两份，保证每轮数量减少
+func groupInsightPartials(parts []insightPartial, budget int) [][]insightPartial {
+	var groups [][]insightPartial
+	var cur []insightPartial
+	used := 0
+	for _, p := range parts {
+		b, _ := json.Marshal(p)
+		cost := EstimateTokens(string(b))
+		if len(cur) >= 2 && used+cost > budget {
+			groups = append(groups, cur)
+			cur, used = nil, 0
+		}
+		cur = append(cur, p)
+		used += cost
+	}
+	if len(cur) == 1 && len(groups) > 0 {
+		groups[len(groups)-1] = append(groups[len(groups)-1], cur[0])
+	} else if len(cur) > 0 {
+		groups = append(groups, cur)
+	}
+	return groups
+}
+
+// sanitizeEvidence 只保留本次选取范围内的笔记 ID，去重并丢弃没有依据的结论
+func sanitizeEvidence(evidence []InsightEvidence, allowed map[int]bool) []InsightEvidence {
+	out := make([]InsightEvidence, 0, len(evidence))
+	for _, e := range evidence {
+		text := strings.TrimSpace(e.Text)
+		if text == "" {
+			continue
+		}
+		seen := map[int]bool{}
+		var ids []int
+		for _, id := range e.NoteIDs {
+			if allowed[id] && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		if len(ids) > 0 {
+			out = append(out, InsightEvidence{Text: text, NoteIDs: ids})
+		}
+	}
+	return out
+}
+
+// GenerateNoteInsight 对服务端选取的笔记生成洞察：超出模型上下文时先分段分析再合并，
+// 结果中的 evidence 给出每条结论依据的笔记 ID
+func (s *LLMService) GenerateNoteInsight(notes []models.Note, timeRange string) (*InsightResponse, error) {
+	budget := s.insightBudget()
+	chunks := chunkNotesForInsight(notes, budget)
+	run := &insightRun{svc: s, ctx: context.Background(), timeRange: timeRange, cached: true}
+
+	parts := make([]insightPartial, 0, len(chunks))
+	for _, ch := range chunks {
+		prompt := RenderPrompt(noteInsightPrompt, map[string]string{
+			"notes":      ch.Text,
+			"time_range": timeRange,
+		})
+		p, err := run.chat(PromptNoteInsightVersion, prompt, ch.NoteIDs)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+	for len(parts) > 1 {
+		var next []insightPartial
+		for _, group := range groupInsightPartials(parts, budget) {
+			merged, err := run.reduce(group)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, merged)
+		}
+		parts = next
+	}
+
+	allowed := make(map[int]bool, len(notes))
+	noteIDs := make([]int, 0, len(notes))
+	for _, n := range notes {
+		allowed[n.ID] = true
+		noteIDs = append(noteIDs, n.ID)
+	}
+	insight := &InsightResponse{NoteIDs: noteIDs, Chunks: len(chunks)}
+	if len(parts) == 1 {
+		p := parts[0]
+		insight.Summary, insight.Keywords, insight.Categories = p.Summary, p.Keywords, p.Categories
+		insight.Sentiment, insight.Trends, insight.Tips = p.Sentiment, p.Trends, p.Tips
+		insight.Evidence = sanitizeEvidence(p.Evidence, allowed)
+	}
+	if run.last != nil {
+		insight.Provider, insight.Model = run.last.Provider, run.last.Model
+	}
+	insight.Fallback = run.fallback
+	insight.Cached = run.calls > 0 && run.cached
+	return insight, nil
+}
@@ -0,0 +1,168 @@
+package services
+
+import (
+	"sort"
+
+	"memo-studio/backend/utils"
+)
+
+// insightSnapshotKeywords 快照中保留的关键词数
+const insightSnapshotKeywords = 30
+
+// insightDiffKeywords 对比结果中列出的关键词变化数
+const insightDiffKeywords = 10
+
+// sentimentShiftThreshold 平均情感得分变化超过该值才算好转/下滑
+const sentimentShiftThreshold = 0.1
+
+// InsightSnapshot 一组笔记的离线统计快照，随洞察历史保存，供跨时段对比
+type InsightSnapshot struct {
+	Notes     int              `json:"notes"`
+	Words     int              `json:"words"`
+	Keywords  []Keyword        `json:"keywords"`
+	Sentiment SentimentSummary `json:"sentiment"`
+}
+
+// SnapshotNotes 统计笔记数、字数、关键词与情感
+func SnapshotNotes(notes []AnalysisNote, corpus *Corpus) InsightSnapshot {
+	snap := InsightSnapshot{
+		Notes:     len(notes),
+		Keywords:  ExtractKeywords(notes, corpus, insightSnapshotKeywords),
+		Sentiment: AnalyzeSentiment(notes),
+	}
+	for _, n := range notes {
+		snap.Words += utils.CountWords(n.Text)
+	}
+	return snap
+}
+
+// CountDelta 数量变化
+type CountDelta struct {
+	Before int `json:"before"`
+	After  int `json:"after"`
+	Delta  int `json:"delta"`
+}
+
+// 关键词变化趋势
+const (
+	KeywordNew  = "new"  // 新出现
+	KeywordGone = "gone" // 不再出现
+	KeywordUp   = "up"
+	KeywordDown = "down"
+	KeywordSame = "same"
+)
+
+// KeywordDelta 关键词在两个时段的出现次数
+type KeywordDelta struct {
+	Term   string `json:"term"`
+	Before int    `json:"before"`
+	After  int    `json:"after"`
+	Delta  int    `json:"delta"`
+	Trend  string `json:"trend"`
+}
+
+// 情绪变化方向
+const (
+	SentimentImproved = "improved"
+	SentimentDeclined = "declined"
+	SentimentStable   = "stable"
+)
+
+// SentimentShift 两个时段的情感变化
+type SentimentShift struct {
+	Before      float64    `json:"before"` // 平均得分
+	After       float64    `json:"after"`
+	Shift       float64    `json:"shift"`
+	Direction   string     `json:"direction"`
+	BeforeLabel string     `json:"before_label"`
+	AfterLabel  string     `json:"after_label"`
+	Positive    CountDelta `json:"positive"` // 积极笔记数
+	Negative    CountDelta `json:"negative"` // 消极笔记数
+}
+
+// InsightDiff 两个时段（before → after）的对比
+type InsightDiff struct {
+	Notes     CountDelta     `json:"notes"`
+	Words     CountDelta     `json:"words"`
+	Keywords  []KeywordDelta `json:"keywords"` // 按变化幅度排序
+	Sentiment SentimentShift `json:"sentiment"`
+}
+
+func countDelta(before, after int) CountDelta {
+	return CountDelta{Before: before, After: after, Delta: after - before}
+}
+
+// CompareSnapshots 对比两个快照；关键词只比较各自快照中的高频词
+func CompareSnapshots(before, after InsightSnapshot) InsightDiff {
+	diff := InsightDiff{
+		Notes:    countDelta(before.Notes, after.Notes),
+		Words:    countDelta(before.Words, after.Words),
+		Keywords: []KeywordDelta{},
+	}
+
+	counts := map[string]*KeywordDelta{}
+	for _, k := range before.Keywords {
+		counts[k.Term] = &KeywordDelta{Term: k.Term, Before: k.Count}
+	}
+	for _, k := range after.Keywords {
+		if d, ok := counts[k.Term]; ok {
+			d.After = k.Count
+		} else {
+			counts[k.Term] = &KeywordDelta{Term: k.Term, After: k.Count}
+		}
+	}
+	for _, d := range counts {
+		d.Delta = d.After - d.Before
+		switch {
+		case d.Before == 0:
+			d.Trend = KeywordNew
+		case d.After == 0:
+			d.Trend = KeywordGone
+		case d.Delta > 0:
+			d.Trend = KeywordUp
+		case d.Delta < 0:
+			d.Trend = KeywordDown
+		default:
+			d.Trend = KeywordSame
+		}
+		diff.Keywords = append(diff.Keywords, *d)
+	}
+	sort.Slice(diff.Keywords, func(i, j int) bool {
+		a, b := diff.Keywords[i], diff.Keywords[j]
+		if abs(a.Delta) != abs(b.Delta) {
+			return abs(a.Delta) > abs(b.Delta)
+		}
+		if a.After != b.After {
+			return a.After > b.After
+		}
+		return a.Term < b.Term
+	})
+	if len(diff.Keywords) > insightDiffKeywords {
+		diff.Keywords = diff.Keywords[:insightDiffKeywords]
+	}
+
+	shift := roundScore(after.Sentiment.Average - before.Sentiment.Average)
+	diff.Sentiment = SentimentShift{
+		Before:      before.Sentiment.Average,
+		After:       after.Sentiment.Average,
+		Shift:       shift,
+		Direction:   SentimentStable,
+		BeforeLabel: before.Sentiment.Label(),
+		AfterLabel:  after.Sentiment.Label(),
+		Positive:    countDelta(before.Sentiment.Positive, after.Sentiment.Positive),
+		Negative:    countDelta(before.Sentiment.Negative, after.Sentiment.Negative),
+	}
+	if shift >= sentimentShiftThreshold {
+		diff.Sentiment.Direction = SentimentImproved
+	} else if shift <= -sentimentShiftThreshold {
+		diff.Sentiment.Direction = SentimentDeclined
+	}
+	return diff
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
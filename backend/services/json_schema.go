@@ -0,0 +1,164 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// ValidateJSONSchema 用 JSON Schema 的常用子集校验值：
+// type、properties、required、additionalProperties(false)、items、enum、
+// minItems/maxItems、minLength/maxLength、minimum/maximum。
+// value 为 json.Unmarshal 到 interface{} 的结果
+func ValidateJSONSchema(schema map[string]any, value any) error {
+	return validateSchemaAt("$", schema, value)
+}
+
+// ParseJSONSchema 解析 JSON Schema 文本；必须是 JSON 对象
+func ParseJSONSchema(raw string) (map[string]any, error) {
+	var schema map[string]any
+	if err := json.Unmarshal([]byte(raw), &schema); err != nil {
+		return nil, fmt.Errorf("JSON Schema 格式错误: %w", err)
+	}
+	if schema == nil {
+		return nil, fmt.Errorf("JSON Schema 必须是对象")
+	}
+	return schema, nil
+}
+
+func validateSchemaAt(path string, schema map[string]any, value any) error {
+	if t, ok := schema["type"]; ok {
+		var types []string
+		switch v := t.(type) {
+		case string:
+			types = []string{v}
+		case []any:
+			for _, x := range v {
+				if s, ok := x.(string); ok {
+					types = append(types, s)
+				}
+			}
+		}
+		if len(types) > 0 && !matchesAnyType(types, value) {
+			return fmt.Errorf("%s: 类型应为 %s，实际为 %s", path, strings.Join(types, "/"), jsonTypeOf(value))
+		}
+	}
+
+	if enum, ok := schema["enum"].([]any); ok {
+		found := false
+		for _, e := range enum {
+			if jsonEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: 取值不在枚举范围内", path)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		if req, ok := schema["required"].([]any); ok {
+			for _, r := range req {
+				name, _ := r.(string)
+				if _, ok := v[name]; name != "" && !ok {
+					return fmt.Errorf("%s: 缺少必填字段 %s", path, name)
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			sub, ok := props[k].(map[string]any)
+			if !ok {
+				if ap, ok := schema["additionalProperties"].(bool); ok && !ap {
+					return fmt.Errorf("%s: 不允许的字段 %s", path, k)
+				}
+				continue
+			}
+			if err := validateSchemaAt(path+"."+k, sub, v[k]); err != nil {
+				return err
+			}
+		}
+	case []any:
+		if n, ok := schemaNumber(schema, "minItems"); ok && float64(len(v)) < n {
+			return fmt.Errorf("%s: 至少需要 %d 项", path, int(n))
+		}
+		if n, ok := schemaNumber(schema, "maxItems"); ok && float64(len(v)) > n {
+			return fmt.Errorf("%s: 最多允许 %d 项", path, int(n))
+		}
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				if err := validateSchemaAt(fmt.Sprintf("%s[%d]", path, i), items, item); err != nil {
+					return err
+				}
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if n, ok := schemaNumber(schema, "minLength"); ok && length < n {
+			return fmt.Errorf("%s: 长度至少为 %d", path, int(n))
+		}
+		if n, ok := schemaNumber(schema, "maxLength"); ok && length > n {
+			return fmt.Errorf("%s: 长度最多为 %d", path, int(n))
+		}
+	case float64:
+		if n, ok := schemaNumber(schema, "minimum"); ok && v < n {
+			return fmt.Errorf("%s: 不能小于 %v", path, n)
+		}
+		if n, ok := schemaNumber(schema, "maximum"); ok && v > n {
+			return fmt.Errorf("%s: 不能大于 %v", path, n)
+		}
+	}
+	return nil
+}
+
+func schemaNumber(schema map[string]any, key string) (float64, bool) {
+	n, ok := schema[key].(float64)
+	return n, ok
+}
+
+func matchesAnyType(types []string, value any) bool {
+	actual := jsonTypeOf(value)
+	for _, t := range types {
+		if t == actual || (t == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func jsonTypeOf(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func jsonEqual(a, b any) bool {
+	ja, _ := json.Marshal(a)
+	jb, _ := json.Marshal(b)
+	return string(ja) == string(jb)
+}
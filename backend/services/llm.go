@@ -1,10 +1,9 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
-	"fmt"
-	"io"
+	"log"
 	"net/http"
 	"os"
 	"strings"
@@ -24,6 +23,7 @@ const (
 	ModelQwen      ModelType = "qwen"       // 阿里通义千问
 	ModelKimi      ModelType = "kimi"       // 月之暗面 Kimi
 	ModelSpark     ModelType = "spark"      // 讯飞星火
+	ModelGemini    ModelType = "gemini"     // Google Gemini
 
 	// 本地模型
 	ModelOllama    ModelType = "ollama"     // Ollama 本地模型
@@ -51,6 +51,9 @@ type ModelConfig struct {
 	MaxTokens int            `json:"max_tokens"`  // 最大 token
 	Context   int            `json:"context"`     // 上下文长度（本地模型）
 	GPU       bool           `json:"gpu"`         // 是否支持 GPU
+	Source    string         `json:"source,omitempty"`     // 配置来源 user/instance/env
+	ProfileID int            `json:"profile_id,omitempty"` // 来自 llm_profiles 时的配置 ID
+	RestrictPrivate bool     `json:"-"`                    // base_url 由普通用户填写：禁止连接本机与内网地址
 }
 
 // LocalModelInfo 本地模型信息
@@ -102,7 +105,7 @@ func DefaultModels() []ModelConfig {
 			Type:     ModelDeepSeek,
 			Name:     "DeepSeek Chat",
 			Category: CategoryCloud,
-			BaseURL:  "https://api.deepseek.com/chat",
+			BaseURL:  "https://api.deepseek.com/v1",
 			Model:    "deepseek-chat",
 			MaxTokens: 4096,
 		},
@@ -146,6 +149,14 @@ func DefaultModels() []ModelConfig {
 			Model:    "general",
 			MaxTokens: 4096,
 		},
+		{
+			Type:     ModelGemini,
+			Name:     "Google Gemini",
+			Category: CategoryCloud,
+			BaseURL:  "https://generativelanguage.googleapis.com/v1beta",
+			Model:    "gemini-1.5-flash",
+			MaxTokens: 8192,
+		},
 
 		// ===== 本地模型 =====
 		{
@@ -323,7 +334,8 @@ func GetActiveModel() ModelConfig {
 
 // overrideFromEnv 从环境变量覆盖配置
 func overrideFromEnv(m ModelConfig) ModelConfig {
-	if apiKey := os.Getenv("LLM_API_KEY"); apiKey != "" {
+	m.Source = ModelSourceEnv
+	if apiKey := envAPIKey(m.Type); apiKey != "" {
 		m.APIKey = apiKey
 	}
 	if baseURL := os.Getenv("LLM_BASE_URL"); baseURL != "" {
@@ -376,7 +388,18 @@ type Usage struct {
 
 // LLMService 大模型服务
 type LLMService struct {
-	Model ModelConfig
+	Model     ModelConfig
+	Fallbacks []ModelConfig    // 主模型失败或熔断时依次尝试
+	Client    *http.Client     // 为空时使用默认客户端
+	Retry     *RetryPolicy     // 为空时使用 DefaultRetryPolicy
+	Breakers  *BreakerRegistry // 为空时使用 DefaultBreakers
+
+	// 用量统计与配额：UserID 为 0 时不记录、不限额
+	UserID   int
+	Endpoint string
+
+	// NoCache 跳过缓存读取（仍会写入新结果），用于强制刷新
+	NoCache bool
 }
 
 // NewLLMService 创建 LLM 服务
@@ -417,101 +440,72 @@ func (s *LLMService) SetLocalModel(baseURL, modelName string) {
 
 // Chat 聊天
 func (s *LLMService) Chat(messages []ChatMessage) (string, error) {
-	req := ChatRequest{
-		Model:       s.Model.Model,
-		Messages:    messages,
-		MaxTokens:   s.Model.MaxTokens,
-		Temperature: 0.7,
-		Stream:     false,
-	}
-
-	body := s.buildRequestBody(req)
-	resp, err := s.sendRequest(body)
+	result, err := s.ChatContext(context.Background(), messages)
 	if err != nil {
 		return "", err
 	}
-
-	return s.parseResponse(resp)
+	return result.Content, nil
 }
 
-// buildRequestBody 构建请求体
-func (s *LLMService) buildRequestBody(req ChatRequest) map[string]interface{} {
-	body := map[string]interface{}{
-		"model":    req.Model,
-		"messages": req.Messages,
-		"stream":   false,
-	}
-	
-	if req.MaxTokens > 0 {
-		body["max_tokens"] = req.MaxTokens
-	}
-	if req.Temperature > 0 {
-		body["temperature"] = req.Temperature
-	}
-	
-	return body
-}
-
-// sendRequest 发送请求
-func (s *LLMService) sendRequest(body map[string]interface{}) ([]byte, error) {
-	jsonBody, err := json.Marshal(body)
-	if err != nil {
-		return nil, fmt.Errorf("序列化请求失败: %v", err)
-	}
-
-	httpReq, err := http.NewRequest("POST", s.Model.BaseURL+"/chat/completions", bytes.NewReader(jsonBody))
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
+// ChatContext 聊天（可取消）：按主模型、备用模型的顺序调用，
+// 每个模型内部按重试策略重试，熔断中的模型直接跳过。
+// 返回结果中的 Provider/Model 为实际作答的模型。
+func (s *LLMService) ChatContext(ctx context.Context, messages []ChatMessage) (*ChatResult, error) {
+	policy := DefaultRetryPolicy
+	if s.Retry != nil {
+		policy = *s.Retry
+	}
+	breakers := s.Breakers
+	if breakers == nil {
+		breakers = DefaultBreakers
+	}
+	if s.UserID > 0 {
+		if err := CheckLLMQuota(s.UserID, time.Now()); err != nil {
+			return nil, err
+		}
 	}
 
-	s.setHeaders(httpReq)
-
-	client := &http.Client{Timeout: 120 * time.Second}
-	resp, err := client.Do(httpReq)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %v", err)
+	var lastErr error
+	for i, cfg := range s.Chain() {
+		key := ProviderKey(cfg)
+		if !breakers.Allow(key) {
+			continue
+		}
+		req := ChatRequest{
+			Model:       cfg.Model,
+			Messages:    messages,
+			MaxTokens:   cfg.MaxTokens,
+			Temperature: 0.7,
+		}
+		start := time.Now()
+		res, err := callWithRetry(ctx, NewProvider(cfg, s.Client), key, req, policy, breakers)
+		s.recordUsage(cfg, res, err, time.Since(start), i > 0)
+		if err == nil {
+			res.Fallback = i > 0
+			return res, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+		if i < len(s.Fallbacks) {
+			log.Printf("模型 %s 调用失败，切换备用模型: %v", cfg.Name, err)
+		}
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		respBody, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API 错误 (%d): %s", resp.StatusCode, string(respBody))
+	if lastErr == nil {
+		lastErr = ErrNoProviderAvailable
 	}
-
-	return io.ReadAll(resp.Body)
+	return nil, lastErr
 }
 
-// setHeaders 设置请求头
-func (s *LLMService) setHeaders(req *http.Request) {
-	req.Header.Set("Content-Type", "application/json")
-	
-	// 云端模型
-	switch s.Model.Type {
-	case ModelClaude:
-		req.Header.Set("x-api-key", s.Model.APIKey)
-		req.Header.Set("anthropic-version", "2023-06-01")
-	case ModelOpenAI, ModelKimi, ModelGLM, ModelYi, ModelQwen, ModelDeepSeek, ModelSpark:
-		req.Header.Set("Authorization", "Bearer "+s.Model.APIKey)
-	case ModelOllama, ModelLocalAI, ModelLMStudio, ModelAnything:
-		// 本地模型通常不需要认证
-		if s.Model.APIKey != "" {
-			req.Header.Set("Authorization", "Bearer "+s.Model.APIKey)
-		}
-	}
+// Chain 主模型 + 备用模型
+func (s *LLMService) Chain() []ModelConfig {
+	return append([]ModelConfig{s.Model}, s.Fallbacks...)
 }
 
-// parseResponse 解析响应
-func (s *LLMService) parseResponse(respBody []byte) (string, error) {
-	var resp ChatResponse
-	if err := json.Unmarshal(respBody, &resp); err != nil {
-		return "", fmt.Errorf("解析响应失败: %v", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", fmt.Errorf("无返回结果")
-	}
-
-	return resp.Choices[0].Message.Content, nil
+// Provider 当前模型对应的适配器
+func (s *LLMService) Provider() LLMProvider {
+	return NewProvider(s.Model, s.Client)
 }
 
 // CheckLocalHealth 检查本地模型服务健康状态
@@ -544,39 +538,36 @@ type InsightResponse struct {
 	Sentiment  string   `json:"sentiment"`
 	Trends     []string `json:"trends"`
 	Tips       []string `json:"tips"`
+	// 服务端选取笔记时：参与分析的笔记、各结论的依据笔记、分段数
+	NoteIDs  []int             `json:"note_ids,omitempty"`
+	Evidence []InsightEvidence `json:"evidence,omitempty"`
+	Chunks   int               `json:"chunks,omitempty"`
+	// 实际作答的模型
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"`
+	Cached   bool   `json:"cached"`
 }
 
-// GenerateInsight 生成洞察
+// GenerateInsight 生成洞察（insight 模板，可被用户或实例的同名模板覆盖）
 func (s *LLMService) GenerateInsight(req InsightRequest) (*InsightResponse, error) {
-	notes := strings.Join(req.Notes, "\n---\n")
-	
-	prompt := fmt.Sprintf(`分析以下笔记，提供洞察报告（用中文，JSON 格式）：
-
-{
-  "summary": "整体总结（1-2句话）",
-  "keywords": ["关键词1", "关键词2", "关键词3"],
-  "categories": ["分类1", "分类2"],
-  "sentiment": "positive/negative/neutral",
-  "trends": ["趋势1", "趋势2"],
-  "tips": ["建议1", "建议2"]
-}
-
-笔记内容：
-%s
-
-时间范围：%s`, notes, req.TimeRange)
-
-	messages := []ChatMessage{
-		{Role: "system", Content: "你是一个笔记分析助手。请用中文回复严格的 JSON 格式。"},
-		{Role: "user", Content: prompt},
+	tpl, err := s.templateFor("insight")
+	if err != nil {
+		return nil, err
 	}
+	messages := BuildTemplateMessages(tpl, map[string]string{
+		"notes":      strings.Join(req.Notes, "\n---\n"),
+		"time_range": req.TimeRange,
+		"language":   tpl.Language,
+	}, tpl.Language, "")
 
-	result, err := s.Chat(messages)
+	chat, cached, err := s.cachedChat(context.Background(), tpl.Version, messages, nil, req.Notes)
 	if err != nil {
 		return nil, err
 	}
 
 	// 清理 markdown 代码块
+	result := chat.Content
 	result = strings.TrimPrefix(result, "```json")
 	result = strings.TrimPrefix(result, "```")
 	result = strings.TrimSuffix(result, "```")
@@ -584,8 +575,10 @@ func (s *LLMService) GenerateInsight(req InsightRequest) (*InsightResponse, erro
 
 	var insight InsightResponse
 	if err := json.Unmarshal([]byte(result), &insight); err != nil {
-		return &InsightResponse{Summary: result}, nil
+		insight = InsightResponse{Summary: result}
 	}
+	insight.Provider, insight.Model, insight.Fallback = chat.Provider, chat.Model, chat.Fallback
+	insight.Cached = cached
 
 	return &insight, nil
 }
@@ -600,32 +593,28 @@ type SummarizeResponse struct {
 	Summary    string   `json:"summary"`
 	Highlights []string `json:"highlights"`
 	ActionItems []string `json:"action_items"`
+	// 实际作答的模型
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+	Fallback bool   `json:"fallback,omitempty"`
+	Cached   bool   `json:"cached"`
 }
 
-// GenerateSummary 生成总结
+// GenerateSummary 生成总结（summary 模板，可被用户或实例的同名模板覆盖）
 func (s *LLMService) GenerateSummary(req SummarizeRequest) (*SummarizeResponse, error) {
-	prompt := fmt.Sprintf(`请对以下内容进行总结，用中文回复严格的 JSON 格式：
-
-{
-  "summary": "内容总结（简洁）",
-  "highlights": ["要点1", "要点2"],
-  "action_items": ["可执行的任务或建议"]
-}
-
-内容：
-%s`, req.Content)
-
-	messages := []ChatMessage{
-		{Role: "system", Content: "你是一个笔记总结助手。请用中文回复严格的 JSON 格式。"},
-		{Role: "user", Content: prompt},
+	tpl, err := s.templateFor("summary")
+	if err != nil {
+		return nil, err
 	}
+	messages := BuildTemplateMessages(tpl, map[string]string{"notes": req.Content, "language": tpl.Language}, tpl.Language, "")
 
-	result, err := s.Chat(messages)
+	chat, cached, err := s.cachedChat(context.Background(), tpl.Version, messages, nil, []string{req.Content})
 	if err != nil {
 		return nil, err
 	}
 
 	// 清理 markdown 代码块
+	result := chat.Content
 	result = strings.TrimPrefix(result, "```json")
 	result = strings.TrimPrefix(result, "```")
 	result = strings.TrimSuffix(result, "```")
@@ -633,8 +622,10 @@ func (s *LLMService) GenerateSummary(req SummarizeRequest) (*SummarizeResponse,
 
 	var summary SummarizeResponse
 	if err := json.Unmarshal([]byte(result), &summary); err != nil {
-		return &SummarizeResponse{Summary: result}, nil
+		summary = SummarizeResponse{Summary: result}
 	}
+	summary.Provider, summary.Model, summary.Fallback = chat.Provider, chat.Model, chat.Fallback
+	summary.Cached = cached
 
 	return &summary, nil
 }
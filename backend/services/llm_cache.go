@@ -0,0 +1,135 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+)
+
+// 提示词模板版本：修改模板时递增，旧缓存自然不再命中
+const (
+	PromptSummaryVersion = "summary/v1"
+	PromptInsightVersion = "insight/v1"
+
+	PromptNoteInsightVersion   = "insight-notes/v1"
+	PromptInsightReduceVersion = "insight-reduce/v1"
+)
+
+// DefaultLLMCacheTTL 缓存默认有效期
+const DefaultLLMCacheTTL = 24 * time.Hour
+
+// LLMCacheTTL 缓存有效期：MEMO_LLM_CACHE_TTL（如 "6h"，或秒数）；0 表示关闭缓存
+func LLMCacheTTL() time.Duration {
+	v := strings.TrimSpace(os.Getenv("MEMO_LLM_CACHE_TTL"))
+	if v == "" {
+		return DefaultLLMCacheTTL
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		if d < 0 {
+			return 0
+		}
+		return d
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	return DefaultLLMCacheTTL
+}
+
+// LLMCacheKey 缓存键：用户 + 主模型厂商/模型 + 提示词版本 + 输入内容哈希
+func LLMCacheKey(userID int, cfg ModelConfig, template string, messages []ChatMessage) string {
+	input, _ := json.Marshal(messages)
+	inputHash := sha256.Sum256(input)
+	h := sha256.New()
+	for _, part := range []string{
+		strconv.Itoa(userID),
+		string(cfg.Type),
+		cfg.BaseURL,
+		cfg.Model,
+		template,
+		hex.EncodeToString(inputHash[:]),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// cachedChat 带缓存的聊天：命中时不调用模型；未命中时调用并写入缓存。
+// noteIDs / notes 为本次输入涉及的笔记ID与正文，用于关联笔记以便内容变更时失效。
+// 返回值 cached 表示结果来自缓存。
+func (s *LLMService) cachedChat(ctx context.Context, template string, messages []ChatMessage, noteIDs []int, notes []string) (*ChatResult, bool, error) {
+	key := LLMCacheKey(s.UserID, s.Model, template, messages)
+	if res := s.cacheLookup(key); res != nil {
+		return res, true, nil
+	}
+	res, err := s.ChatContext(ctx, messages)
+	if err != nil {
+		return nil, false, err
+	}
+	s.cacheStore(key, template, res, noteIDs, notes)
+	return res, false, nil
+}
+
+// cacheLookup 读取未过期的缓存；缓存关闭、NoCache 或未命中时返回 nil
+func (s *LLMService) cacheLookup(key string) *ChatResult {
+	if s.NoCache || LLMCacheTTL() <= 0 {
+		return nil
+	}
+	entry, err := models.GetLLMCache(key, time.Now())
+	if err != nil {
+		log.Printf("读取大模型缓存失败: %v", err)
+		return nil
+	}
+	if entry == nil {
+		return nil
+	}
+	var res ChatResult
+	if err := json.Unmarshal([]byte(entry.Response), &res); err != nil {
+		return nil
+	}
+	return &res
+}
+
+// cacheStore 写入缓存（缓存关闭时跳过），并关联输入涉及的笔记：
+// noteIDs 为已知的笔记ID，notes 为需按正文匹配的笔记内容；写入失败只记日志
+func (s *LLMService) cacheStore(key, template string, res *ChatResult, noteIDs []int, notes []string) {
+	ttl := LLMCacheTTL()
+	if ttl <= 0 {
+		return
+	}
+	now := time.Now()
+	payload, _ := json.Marshal(ChatResult{Content: res.Content, Model: res.Model, Provider: res.Provider, Fallback: res.Fallback})
+	entry := models.LLMCacheEntry{
+		Key:        key,
+		Template:   template,
+		Provider:   string(s.Model.Type),
+		Model:      s.Model.Model,
+		Response:   string(payload),
+		AnsweredBy: res.Provider,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(ttl),
+	}
+	if s.UserID > 0 {
+		uid := s.UserID
+		entry.UserID = &uid
+		if len(notes) > 0 {
+			matched, err := models.FindNoteIDsByContent(uid, notes)
+			if err != nil {
+				log.Printf("关联缓存笔记失败: %v", err)
+			}
+			noteIDs = append(noteIDs, matched...)
+		}
+	}
+	if err := models.PutLLMCache(entry, noteIDs); err != nil {
+		log.Printf("写入大模型缓存失败: %v", err)
+	}
+}
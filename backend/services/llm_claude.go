@@ -0,0 +1,115 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// claudeAPIVersion Anthropic Messages API 版本
+const claudeAPIVersion = "2023-06-01"
+
+// claudeDefaultMaxTokens Messages API 要求必须提供 max_tokens
+const claudeDefaultMaxTokens = 1024
+
+// ClaudeProvider Anthropic Messages API（system 独立字段、x-api-key 认证、内容块响应）
+type ClaudeProvider struct {
+	cfg    ModelConfig
+	client *http.Client
+}
+
+func NewClaudeProvider(cfg ModelConfig, client *http.Client) LLMProvider {
+	return &ClaudeProvider{cfg: cfg, client: client}
+}
+
+func (p *ClaudeProvider) Name() string { return string(ModelClaude) }
+
+type claudeResponse struct {
+	Model   string `json:"model"`
+	Content []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"content"`
+	Usage struct {
+		InputTokens  int `json:"input_tokens"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+type claudeErrorBody struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+func (p *ClaudeProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResult, error) {
+	system, messages := splitSystem(req.Messages)
+	maxTokens := req.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = claudeDefaultMaxTokens
+	}
+	body := map[string]interface{}{
+		"model":      firstNonEmpty(req.Model, p.cfg.Model),
+		"messages":   messages,
+		"max_tokens": maxTokens,
+	}
+	if system != "" {
+		body["system"] = system
+	}
+	if req.Temperature > 0 {
+		body["temperature"] = req.Temperature
+	}
+	headers := map[string]string{
+		"x-api-key":         p.cfg.APIKey,
+		"anthropic-version": claudeAPIVersion,
+	}
+
+	raw, err := postJSON(ctx, p.client, p.Name(), strings.TrimRight(p.cfg.BaseURL, "/")+"/messages", headers, body,
+		func(resp *http.Response, b []byte) *LLMError {
+			var eb claudeErrorBody
+			_ = json.Unmarshal(b, &eb)
+			msg := eb.Error.Message
+			if msg == "" {
+				msg = upstreamErrorText(b)
+			}
+			e := classifyHTTPError(p.Name(), resp, eb.Error.Type, msg)
+			switch eb.Error.Type {
+			case "rate_limit_error":
+				e.Kind = LLMErrRateLimit
+			case "overloaded_error", "api_error":
+				e.Kind = LLMErrUnavailable
+			case "authentication_error", "permission_error":
+				e.Kind = LLMErrAuth
+			}
+			return e
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp claudeResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, invalidResponse(p.Name(), err)
+	}
+	var parts []string
+	for _, block := range resp.Content {
+		if block.Type == "text" {
+			parts = append(parts, block.Text)
+		}
+	}
+	if len(parts) == 0 {
+		return nil, invalidResponse(p.Name(), nil)
+	}
+	return &ChatResult{
+		Content:  strings.Join(parts, ""),
+		Model:    firstNonEmpty(resp.Model, p.cfg.Model),
+		Provider: p.Name(),
+		Usage: Usage{
+			PromptTokens:     resp.Usage.InputTokens,
+			CompletionTokens: resp.Usage.OutputTokens,
+			TotalTokens:      resp.Usage.InputTokens + resp.Usage.OutputTokens,
+		},
+	}, nil
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// GeminiProvider Google Gemini generateContent API（contents/parts 结构，assistant 角色称为 model）
+type GeminiProvider struct {
+	cfg    ModelConfig
+	client *http.Client
+}
+
+func NewGeminiProvider(cfg ModelConfig, client *http.Client) LLMProvider {
+	return &GeminiProvider{cfg: cfg, client: client}
+}
+
+func (p *GeminiProvider) Name() string { return string(ModelGemini) }
+
+type geminiPart struct {
+	Text string `json:"text"`
+}
+
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+type geminiResponse struct {
+	Candidates []struct {
+		Content geminiContent `json:"content"`
+	} `json:"candidates"`
+	UsageMetadata struct {
+		PromptTokenCount     int `json:"promptTokenCount"`
+		CandidatesTokenCount int `json:"candidatesTokenCount"`
+		TotalTokenCount      int `json:"totalTokenCount"`
+	} `json:"usageMetadata"`
+	ModelVersion string `json:"modelVersion"`
+}
+
+type geminiErrorBody struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+func (p *GeminiProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResult, error) {
+	system, messages := splitSystem(req.Messages)
+	contents := make([]geminiContent, 0, len(messages))
+	for _, m := range messages {
+		role := "user"
+		if m.Role == "assistant" {
+			role = "model"
+		}
+		contents = append(contents, geminiContent{Role: role, Parts: []geminiPart{{Text: m.Content}}})
+	}
+	body := map[string]interface{}{"contents": contents}
+	if system != "" {
+		body["systemInstruction"] = geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	gen := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		gen["maxOutputTokens"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		gen["temperature"] = req.Temperature
+	}
+	if len(gen) > 0 {
+		body["generationConfig"] = gen
+	}
+
+	model := firstNonEmpty(req.Model, p.cfg.Model)
+	endpoint := strings.TrimRight(p.cfg.BaseURL, "/") + "/models/" + url.PathEscape(model) + ":generateContent"
+	headers := map[string]string{"x-goog-api-key": p.cfg.APIKey}
+
+	raw, err := postJSON(ctx, p.client, p.Name(), endpoint, headers, body,
+		func(resp *http.Response, b []byte) *LLMError {
+			var eb geminiErrorBody
+			_ = json.Unmarshal(b, &eb)
+			msg := eb.Error.Message
+			if msg == "" {
+				msg = upstreamErrorText(b)
+			}
+			e := classifyHTTPError(p.Name(), resp, eb.Error.Status, msg)
+			switch {
+			case eb.Error.Status == "RESOURCE_EXHAUSTED":
+				e.Kind = LLMErrRateLimit
+			case eb.Error.Status == "UNAUTHENTICATED" || eb.Error.Status == "PERMISSION_DENIED":
+				e.Kind = LLMErrAuth
+			case strings.Contains(strings.ToLower(msg), "api key not valid"):
+				// 无效 Key 时 Gemini 返回 400 INVALID_ARGUMENT
+				e.Kind = LLMErrAuth
+			}
+			return e
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp geminiResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, invalidResponse(p.Name(), err)
+	}
+	if len(resp.Candidates) == 0 {
+		return nil, invalidResponse(p.Name(), nil)
+	}
+	var parts []string
+	for _, part := range resp.Candidates[0].Content.Parts {
+		parts = append(parts, part.Text)
+	}
+	if len(parts) == 0 {
+		return nil, invalidResponse(p.Name(), nil)
+	}
+	return &ChatResult{
+		Content:  strings.Join(parts, ""),
+		Model:    firstNonEmpty(resp.ModelVersion, model),
+		Provider: p.Name(),
+		Usage: Usage{
+			PromptTokens:     resp.UsageMetadata.PromptTokenCount,
+			CompletionTokens: resp.UsageMetadata.CandidatesTokenCount,
+			TotalTokens:      resp.UsageMetadata.TotalTokenCount,
+		},
+	}, nil
+}
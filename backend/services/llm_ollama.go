@@ -0,0 +1,94 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// OllamaProvider Ollama 原生 /api/chat 接口
+type OllamaProvider struct {
+	cfg    ModelConfig
+	client *http.Client
+}
+
+func NewOllamaProvider(cfg ModelConfig, client *http.Client) LLMProvider {
+	return &OllamaProvider{cfg: cfg, client: client}
+}
+
+func (p *OllamaProvider) Name() string { return string(ModelOllama) }
+
+// ollamaRoot 预置地址指向 OpenAI 兼容的 /v1，原生接口位于服务根路径
+func ollamaRoot(baseURL string) string {
+	root := strings.TrimRight(baseURL, "/")
+	return strings.TrimSuffix(root, "/v1")
+}
+
+type ollamaResponse struct {
+	Model   string      `json:"model"`
+	Message ChatMessage `json:"message"`
+	Done    bool        `json:"done"`
+	// token 统计
+	PromptEvalCount int `json:"prompt_eval_count"`
+	EvalCount       int `json:"eval_count"`
+}
+
+func (p *OllamaProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResult, error) {
+	body := map[string]interface{}{
+		"model":    firstNonEmpty(req.Model, p.cfg.Model),
+		"messages": req.Messages,
+		"stream":   false,
+	}
+	options := map[string]interface{}{}
+	if req.MaxTokens > 0 {
+		options["num_predict"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		options["temperature"] = req.Temperature
+	}
+	if p.cfg.Context > 0 {
+		options["num_ctx"] = p.cfg.Context
+	}
+	if len(options) > 0 {
+		body["options"] = options
+	}
+	headers := map[string]string{}
+	if p.cfg.APIKey != "" {
+		headers["Authorization"] = "Bearer " + p.cfg.APIKey
+	}
+
+	raw, err := postJSON(ctx, p.client, p.Name(), ollamaRoot(p.cfg.BaseURL)+"/api/chat", headers, body,
+		func(resp *http.Response, b []byte) *LLMError {
+			var eb struct {
+				Error string `json:"error"`
+			}
+			_ = json.Unmarshal(b, &eb)
+			msg := eb.Error
+			if msg == "" {
+				msg = upstreamErrorText(b)
+			}
+			return classifyHTTPError(p.Name(), resp, "", msg)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ollamaResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, invalidResponse(p.Name(), err)
+	}
+	if resp.Message.Content == "" {
+		return nil, invalidResponse(p.Name(), nil)
+	}
+	return &ChatResult{
+		Content:  resp.Message.Content,
+		Model:    firstNonEmpty(resp.Model, p.cfg.Model),
+		Provider: p.Name(),
+		Usage: Usage{
+			PromptTokens:     resp.PromptEvalCount,
+			CompletionTokens: resp.EvalCount,
+			TotalTokens:      resp.PromptEvalCount + resp.EvalCount,
+		},
+	}, nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// OpenAIProvider OpenAI Chat Completions 及其兼容接口（DeepSeek、GLM、Kimi、LM Studio 等）
+type OpenAIProvider struct {
+	cfg    ModelConfig
+	client *http.Client
+}
+
+func NewOpenAIProvider(cfg ModelConfig, client *http.Client) LLMProvider {
+	return &OpenAIProvider{cfg: cfg, client: client}
+}
+
+func (p *OpenAIProvider) Name() string { return string(p.cfg.Type) }
+
+type openAIErrorBody struct {
+	Error struct {
+		Message string      `json:"message"`
+		Type    string      `json:"type"`
+		Code    interface{} `json:"code"` // 各家兼容实现可能是字符串或数字
+	} `json:"error"`
+}
+
+func (p *OpenAIProvider) Chat(ctx context.Context, req ChatRequest) (*ChatResult, error) {
+	body := map[string]interface{}{
+		"model":    firstNonEmpty(req.Model, p.cfg.Model),
+		"messages": req.Messages,
+		"stream":   false,
+	}
+	if req.MaxTokens > 0 {
+		body["max_tokens"] = req.MaxTokens
+	}
+	if req.Temperature > 0 {
+		body["temperature"] = req.Temperature
+	}
+	headers := map[string]string{}
+	if p.cfg.APIKey != "" {
+		headers["Authorization"] = "Bearer " + p.cfg.APIKey
+	}
+
+	raw, err := postJSON(ctx, p.client, p.Name(), strings.TrimRight(p.cfg.BaseURL, "/")+"/chat/completions", headers, body,
+		func(resp *http.Response, b []byte) *LLMError {
+			var eb openAIErrorBody
+			_ = json.Unmarshal(b, &eb)
+			code := eb.Error.Type
+			if s, ok := eb.Error.Code.(string); ok && s != "" {
+				code = s
+			}
+			msg := eb.Error.Message
+			if msg == "" {
+				msg = upstreamErrorText(b)
+			}
+			return classifyHTTPError(p.Name(), resp, code, msg)
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ChatResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		return nil, invalidResponse(p.Name(), err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, invalidResponse(p.Name(), nil)
+	}
+	return &ChatResult{
+		Content:  resp.Choices[0].Message.Content,
+		Model:    firstNonEmpty(resp.Model, p.cfg.Model),
+		Provider: p.Name(),
+		Usage:    resp.Usage,
+	}, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,193 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"memo-studio/backend/models"
+	"memo-studio/backend/utils"
+)
+
+// 模型配置来源
+const (
+	ModelSourceUser     = "user"     // 用户自己的配置
+	ModelSourceInstance = "instance" // 管理员设置的实例默认配置
+	ModelSourceEnv      = "env"      // 环境变量（兼容旧部署）
+)
+
+// providerKeyEnv 各厂商专用的 API Key 环境变量
+var providerKeyEnv = map[ModelType]string{
+	ModelOpenAI:   "OPENAI_API_KEY",
+	ModelClaude:   "ANTHROPIC_API_KEY",
+	ModelDeepSeek: "DEEPSEEK_API_KEY",
+	ModelGLM:      "ZHIPU_API_KEY",
+	ModelGemini:   "GEMINI_API_KEY",
+}
+
+// FindModelPreset 按厂商类型查找预置配置（云端优先，其次本地）
+func FindModelPreset(provider string) (ModelConfig, bool) {
+	for _, m := range DefaultModels() {
+		if string(m.Type) == provider {
+			return m, true
+		}
+	}
+	for _, m := range LocalModels {
+		if string(m.Type) == provider {
+			return m, true
+		}
+	}
+	return ModelConfig{}, false
+}
+
+// EncryptAPIKey 使用实例密钥加密 API Key；空字符串原样返回
+func EncryptAPIKey(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", nil
+	}
+	return utils.EncryptData(raw, utils.InstanceSecret())
+}
+
+// ProfileModelConfig 将保存的配置转换为 ModelConfig（解密 API Key，未填写的字段取预置值）
+func ProfileModelConfig(p *models.LLMProfile) (ModelConfig, error) {
+	cfg, ok := FindModelPreset(p.Provider)
+	if !ok {
+		return ModelConfig{}, fmt.Errorf("未知的模型类型: %s", p.Provider)
+	}
+	if p.Name != "" {
+		cfg.Name = p.Name
+	}
+	if p.BaseURL != "" {
+		cfg.BaseURL = p.BaseURL
+	}
+	if p.Model != "" {
+		cfg.Model = p.Model
+	}
+	if p.MaxTokens > 0 {
+		cfg.MaxTokens = p.MaxTokens
+	}
+	if p.APIKeyEnc != "" {
+		key, err := utils.DecryptData(p.APIKeyEnc, utils.InstanceSecret())
+		if err != nil {
+			return ModelConfig{}, fmt.Errorf("解密 API Key 失败（实例密钥可能已更换）: %v", err)
+		}
+		cfg.APIKey = key
+	}
+	if p.UserID != nil {
+		cfg.Source = ModelSourceUser
+		// 普通用户自定义的地址不能访问本机与内网（管理员与实例配置不受限）
+		if p.BaseURL != "" {
+			owner, err := models.GetAuthState(*p.UserID)
+			if err != nil {
+				return ModelConfig{}, err
+			}
+			cfg.RestrictPrivate = owner == nil || owner.Role != models.RoleAdmin
+		}
+	} else {
+		cfg.Source = ModelSourceInstance
+	}
+	cfg.ProfileID = p.ID
+	return cfg, nil
+}
+
+// ResolveModelConfig 解析用户实际使用的模型：
+// 用户启用的配置 > 实例默认配置 > 环境变量
+func ResolveModelConfig(userID int) (ModelConfig, error) {
+	if userID > 0 {
+		p, err := models.GetActiveLLMProfile(&userID)
+		if err != nil {
+			return ModelConfig{}, err
+		}
+		if p != nil {
+			return ProfileModelConfig(p)
+		}
+	}
+	p, err := models.GetActiveLLMProfile(nil)
+	if err != nil {
+		return ModelConfig{}, err
+	}
+	if p != nil {
+		return ProfileModelConfig(p)
+	}
+	return GetActiveModel(), nil
+}
+
+// NewLLMServiceForUser 按用户配置创建 LLM 服务；解析失败时回落到环境变量配置
+func NewLLMServiceForUser(userID int) *LLMService {
+	cfg, err := ResolveModelConfig(userID)
+	if err != nil {
+		log.Printf("解析用户 %d 的模型配置失败: %v", userID, err)
+		svc := NewLLMService()
+		svc.UserID = userID
+		return svc
+	}
+	return &LLMService{Model: cfg, Fallbacks: ResolveFallbackChain(userID, cfg), UserID: userID}
+}
+
+// ResolveFallbackChain 备用模型链：用户配置 > 实例配置（fallback_priority 排序）> LLM_FALLBACK_CHAIN。
+// 跳过与主模型相同或缺少 API Key 的云端模型。
+func ResolveFallbackChain(userID int, primary ModelConfig) []ModelConfig {
+	seen := map[string]bool{ProviderKey(primary): true}
+	var chain []ModelConfig
+	add := func(cfg ModelConfig) {
+		key := ProviderKey(cfg)
+		if seen[key] || (cfg.APIKey == "" && cfg.Category != CategoryLocal) {
+			return
+		}
+		seen[key] = true
+		chain = append(chain, cfg)
+	}
+
+	owners := []*int{nil}
+	if userID > 0 {
+		owners = []*int{&userID, nil}
+	}
+	for _, owner := range owners {
+		list, err := models.ListLLMFallbackProfiles(owner)
+		if err != nil {
+			log.Printf("读取备用模型配置失败: %v", err)
+			continue
+		}
+		for i := range list {
+			cfg, err := ProfileModelConfig(&list[i])
+			if err != nil {
+				log.Printf("备用模型配置 %d 不可用: %v", list[i].ID, err)
+				continue
+			}
+			add(cfg)
+		}
+	}
+
+	// 环境变量：逗号分隔的模型类型，如 LLM_FALLBACK_CHAIN=deepseek,ollama
+	for _, t := range strings.Split(os.Getenv("LLM_FALLBACK_CHAIN"), ",") {
+		cfg, ok := FindModelPreset(strings.TrimSpace(t))
+		if !ok {
+			continue
+		}
+		// LLM_API_KEY 属于主模型，备用模型只使用厂商专用变量
+		if name, ok := providerKeyEnv[cfg.Type]; ok {
+			cfg.APIKey = os.Getenv(name)
+		}
+		cfg.Source = ModelSourceEnv
+		add(cfg)
+	}
+	return chain
+}
+
+// Configured 是否具备调用条件（云端模型需要 API Key，本地模型无需认证）
+func (s *LLMService) Configured() bool {
+	return s.Model.APIKey != "" || s.Model.Category == CategoryLocal
+}
+
+// envAPIKey 环境变量中的 API Key：LLM_API_KEY 优先，其次厂商专用变量
+func envAPIKey(t ModelType) string {
+	if v := os.Getenv("LLM_API_KEY"); v != "" {
+		return v
+	}
+	if name, ok := providerKeyEnv[t]; ok {
+		return os.Getenv(name)
+	}
+	return ""
+}
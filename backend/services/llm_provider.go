@@ -0,0 +1,285 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LLMProvider 一类大模型 API 的适配器。
+// 新增厂商只需实现该接口，并通过 RegisterProvider 绑定到对应的 ModelType。
+type LLMProvider interface {
+	// Name 厂商标识（用于日志、错误与熔断统计）
+	Name() string
+	// Chat 发送一次非流式对话；失败时返回 *LLMError
+	Chat(ctx context.Context, req ChatRequest) (*ChatResult, error)
+}
+
+// ChatResult 统一的对话结果
+type ChatResult struct {
+	Content  string `json:"content"`
+	Model    string `json:"model"`
+	Provider string `json:"provider"`
+	Usage    Usage  `json:"usage"`
+	Fallback bool   `json:"fallback"` // 是否由备用模型作答
+}
+
+// ProviderFactory 根据模型配置创建适配器
+type ProviderFactory func(cfg ModelConfig, client *http.Client) LLMProvider
+
+var (
+	providerMu        sync.RWMutex
+	providerFactories = map[ModelType]ProviderFactory{
+		ModelClaude: NewClaudeProvider,
+		ModelGemini: NewGeminiProvider,
+		ModelOllama: NewOllamaProvider,
+	}
+)
+
+// RegisterProvider 为模型类型注册适配器；未注册的类型使用 OpenAI 兼容适配器
+func RegisterProvider(t ModelType, f ProviderFactory) {
+	providerMu.Lock()
+	defer providerMu.Unlock()
+	providerFactories[t] = f
+}
+
+// defaultLLMClient 调用大模型的 HTTP 客户端（本地模型推理可能较慢）
+var defaultLLMClient = &http.Client{Timeout: 120 * time.Second}
+
+// llmAllowHostsEnv 普通用户的模型配置允许连接的内网主机（逗号分隔的主机名或 IP）
+const llmAllowHostsEnv = "MEMO_LLM_ALLOW_HOSTS"
+
+// ErrLLMBaseURLBlocked 普通用户填写的模型地址指向本机或内网
+var ErrLLMBaseURLBlocked = errors.New("模型地址指向本机或内网，已拒绝")
+
+// restrictedLLMClient 普通用户自定义 base_url 使用的客户端：连接前检查解析后的 IP，不走代理，不跟随重定向
+var restrictedLLMClient = &http.Client{
+	Timeout: 120 * time.Second,
+	Transport: &http.Transport{
+		DialContext:         guardedDialContext(30*time.Second, ErrLLMBaseURLBlocked),
+		TLSHandshakeTimeout: 30 * time.Second,
+		IdleConnTimeout:     90 * time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+}
+
+// ValidateLLMBaseURL 校验普通用户填写的 base_url：只允许 http(s)，
+// 不能直接指向本机或内网（MEMO_LLM_ALLOW_HOSTS 中的主机除外）；域名在调用时解析后再检查
+func ValidateLLMBaseURL(raw string) error {
+	return validatePublicURL(raw, llmAllowHostsEnv, ErrLLMBaseURLBlocked)
+}
+
+// llmClientFor 配置要求限制内网地址且主机不在白名单中时使用受限客户端
+func llmClientFor(cfg ModelConfig) *http.Client {
+	if cfg.RestrictPrivate {
+		if u, err := url.Parse(cfg.BaseURL); err != nil || !hostAllowedByEnv(llmAllowHostsEnv, u.Hostname()) {
+			return restrictedLLMClient
+		}
+	}
+	return defaultLLMClient
+}
+
+// NewProvider 按模型配置选择适配器；client 为空时使用默认客户端
+// （普通用户自定义的地址使用禁止连接内网的客户端）
+func NewProvider(cfg ModelConfig, client *http.Client) LLMProvider {
+	if client == nil {
+		client = llmClientFor(cfg)
+	}
+	providerMu.RLock()
+	f, ok := providerFactories[cfg.Type]
+	providerMu.RUnlock()
+	if !ok {
+		f = NewOpenAIProvider
+	}
+	return f(cfg, client)
+}
+
+// LLMErrorKind 错误类别（与具体厂商无关）
+type LLMErrorKind string
+
+const (
+	LLMErrRateLimit       LLMErrorKind = "rate_limit"       // 限流或配额耗尽
+	LLMErrAuth            LLMErrorKind = "auth"             // API Key 无效或无权限
+	LLMErrContextLength   LLMErrorKind = "context_length"   // 输入超出上下文长度
+	LLMErrBadRequest      LLMErrorKind = "bad_request"      // 其他请求错误（模型不存在、参数错误等）
+	LLMErrUnavailable     LLMErrorKind = "unavailable"      // 服务端错误或过载
+	LLMErrNetwork         LLMErrorKind = "network"          // 网络错误或超时
+	LLMErrInvalidResponse LLMErrorKind = "invalid_response" // 响应无法解析或为空
+)
+
+// LLMError 大模型调用错误
+type LLMError struct {
+	Provider   string
+	Kind       LLMErrorKind
+	StatusCode int
+	Message    string
+	RetryAfter time.Duration // 服务端建议的重试等待时间（来自 Retry-After）
+	Err        error
+}
+
+func (e *LLMError) Error() string {
+	if e.StatusCode > 0 {
+		return fmt.Sprintf("%s API 错误 (%d, %s): %s", e.Provider, e.StatusCode, e.Kind, e.Message)
+	}
+	return fmt.Sprintf("%s 调用失败 (%s): %s", e.Provider, e.Kind, e.Message)
+}
+
+func (e *LLMError) Unwrap() error { return e.Err }
+
+// Retryable 是否值得重试（限流、服务端错误、网络错误）
+func (e *LLMError) Retryable() bool {
+	switch e.Kind {
+	case LLMErrRateLimit, LLMErrUnavailable, LLMErrNetwork:
+		return true
+	}
+	return false
+}
+
+// AsLLMError 提取 *LLMError
+func AsLLMError(err error) (*LLMError, bool) {
+	var le *LLMError
+	if errors.As(err, &le) {
+		return le, true
+	}
+	return nil, false
+}
+
+// contextLengthHints 各厂商“超出上下文”错误信息中的常见片段
+var contextLengthHints = []string{
+	"context_length", "context length", "context window", "maximum context",
+	"prompt is too long", "too many tokens", "token limit", "exceeds the maximum",
+}
+
+func looksLikeContextLength(s string) bool {
+	s = strings.ToLower(s)
+	for _, h := range contextLengthHints {
+		if strings.Contains(s, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// classifyHTTPError 按状态码与错误信息归类；code 为厂商返回的错误码/类型
+func classifyHTTPError(provider string, resp *http.Response, code, message string) *LLMError {
+	e := &LLMError{
+		Provider:   provider,
+		StatusCode: resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(resp.StatusCode)
+	}
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e.Kind = LLMErrRateLimit
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		e.Kind = LLMErrAuth
+	case looksLikeContextLength(code) || looksLikeContextLength(message):
+		e.Kind = LLMErrContextLength
+	case resp.StatusCode >= 500:
+		e.Kind = LLMErrUnavailable
+	default:
+		e.Kind = LLMErrBadRequest
+	}
+	return e
+}
+
+// parseRetryAfter 解析 Retry-After（秒数或 HTTP 日期）
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil {
+		if secs <= 0 {
+			return 0
+		}
+		return time.Duration(secs * float64(time.Second))
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := t.Sub(now); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// postJSON 发送 JSON 请求；非 2xx 时交给 onError 解析厂商错误体
+func postJSON(ctx context.Context, client *http.Client, provider, url string, headers map[string]string, payload interface{},
+	onError func(resp *http.Response, body []byte) *LLMError) ([]byte, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("序列化请求失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		if v != "" {
+			req.Header.Set(k, v)
+		}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		if errors.Is(err, ErrLLMBaseURLBlocked) {
+			return nil, &LLMError{Provider: provider, Kind: LLMErrBadRequest, Message: ErrLLMBaseURLBlocked.Error(), Err: err}
+		}
+		return nil, &LLMError{Provider: provider, Kind: LLMErrNetwork, Message: err.Error(), Err: err}
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if err != nil {
+		return nil, &LLMError{Provider: provider, Kind: LLMErrNetwork, Message: err.Error(), Err: err}
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, onError(resp, body)
+	}
+	return body, nil
+}
+
+// maxUpstreamErrorRunes 错误信息中保留的上游响应长度
+const maxUpstreamErrorRunes = 200
+
+// upstreamErrorText 无法解析的上游错误响应：截断后放入错误信息，避免把任意响应内容原样返回给调用者
+func upstreamErrorText(b []byte) string {
+	s := strings.TrimSpace(string(b))
+	if r := []rune(s); len(r) > maxUpstreamErrorRunes {
+		return string(r[:maxUpstreamErrorRunes]) + "…"
+	}
+	return s
+}
+
+func invalidResponse(provider string, err error) *LLMError {
+	msg := "无返回结果"
+	if err != nil {
+		msg = "解析响应失败: " + err.Error()
+	}
+	return &LLMError{Provider: provider, Kind: LLMErrInvalidResponse, Message: msg, Err: err}
+}
+
+// splitSystem 拆出 system 消息（Claude/Gemini 的 system 不在消息列表中）
+func splitSystem(messages []ChatMessage) (string, []ChatMessage) {
+	var system []string
+	rest := make([]ChatMessage, 0, len(messages))
+	for _, m := range messages {
+		if m.Role == "system" {
+			system = append(system, m.Content)
+			continue
+		}
+		rest = append(rest, m)
+	}
+	return strings.Join(system, "\n\n"), rest
+}
@@ -0,0 +1,352 @@
+package services_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+// fakeAPI 模拟一类大模型 API：校验请求是否符合该厂商的原生格式，并按需返回成功或各类错误。
+// 新增适配器时在 conformanceAPIs 中补充一项即可跑完整套一致性测试。
+type fakeAPI struct {
+	name     string
+	modelTyp services.ModelType
+	baseURL  func(srv string) string
+	path     string
+	// checkRequest 校验认证头与请求体（system 的位置、字段名等）
+	checkRequest func(t *testing.T, r *http.Request, body map[string]any)
+	reply        func(w http.ResponseWriter, content string)
+	fail         func(w http.ResponseWriter, kind services.LLMErrorKind)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func statusFor(kind services.LLMErrorKind) int {
+	switch kind {
+	case services.LLMErrRateLimit:
+		return http.StatusTooManyRequests
+	case services.LLMErrAuth:
+		return http.StatusUnauthorized
+	case services.LLMErrUnavailable:
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+func messagesOf(t *testing.T, body map[string]any, key string) []map[string]any {
+	t.Helper()
+	raw, ok := body[key].([]any)
+	if !ok {
+		t.Fatalf("missing %s in request: %v", key, body)
+	}
+	out := make([]map[string]any, 0, len(raw))
+	for _, m := range raw {
+		out = append(out, m.(map[string]any))
+	}
+	return out
+}
+
+var conformanceAPIs = []fakeAPI{
+	{
+		name:     "openai",
+		modelTyp: services.ModelDeepSeek,
+		baseURL:  func(srv string) string { return srv + "/v1" },
+		path:     "/v1/chat/completions",
+		checkRequest: func(t *testing.T, r *http.Request, body map[string]any) {
+			if got := r.Header.Get("Authorization"); got != "Bearer test-key" {
+				t.Errorf("Authorization=%q", got)
+			}
+			msgs := messagesOf(t, body, "messages")
+			if msgs[0]["role"] != "system" {
+				t.Errorf("system message should stay in messages: %v", msgs)
+			}
+		},
+		reply: func(w http.ResponseWriter, content string) {
+			writeJSON(w, 200, map[string]any{
+				"model":   "test-model",
+				"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": content}}},
+				"usage":   map[string]any{"prompt_tokens": 3, "completion_tokens": 2, "total_tokens": 5},
+			})
+		},
+		fail: func(w http.ResponseWriter, kind services.LLMErrorKind) {
+			code := "error"
+			if kind == services.LLMErrContextLength {
+				code = "context_length_exceeded"
+			}
+			writeJSON(w, statusFor(kind), map[string]any{"error": map[string]any{"message": "failed", "code": code}})
+		},
+	},
+	{
+		name:     "claude",
+		modelTyp: services.ModelClaude,
+		baseURL:  func(srv string) string { return srv + "/v1" },
+		path:     "/v1/messages",
+		checkRequest: func(t *testing.T, r *http.Request, body map[string]any) {
+			if got := r.Header.Get("x-api-key"); got != "test-key" {
+				t.Errorf("x-api-key=%q", got)
+			}
+			if r.Header.Get("anthropic-version") == "" || r.Header.Get("Authorization") != "" {
+				t.Errorf("unexpected headers: %v", r.Header)
+			}
+			if body["system"] != "be brief" {
+				t.Errorf("system=%v", body["system"])
+			}
+			if _, ok := body["max_tokens"]; !ok {
+				t.Errorf("max_tokens is required")
+			}
+			for _, m := range messagesOf(t, body, "messages") {
+				if m["role"] == "system" {
+					t.Errorf("system message must not be in messages")
+				}
+			}
+		},
+		reply: func(w http.ResponseWriter, content string) {
+			writeJSON(w, 200, map[string]any{
+				"model":   "test-model",
+				"content": []any{map[string]any{"type": "text", "text": content}},
+				"usage":   map[string]any{"input_tokens": 3, "output_tokens": 2},
+			})
+		},
+		fail: func(w http.ResponseWriter, kind services.LLMErrorKind) {
+			typ, msg := "invalid_request_error", "bad"
+			switch kind {
+			case services.LLMErrRateLimit:
+				typ = "rate_limit_error"
+			case services.LLMErrAuth:
+				typ = "authentication_error"
+			case services.LLMErrUnavailable:
+				typ = "overloaded_error"
+			case services.LLMErrContextLength:
+				msg = "prompt is too long: 250000 tokens > 200000 maximum"
+			}
+			writeJSON(w, statusFor(kind), map[string]any{"type": "error", "error": map[string]any{"type": typ, "message": msg}})
+		},
+	},
+	{
+		name:     "gemini",
+		modelTyp: services.ModelGemini,
+		baseURL:  func(srv string) string { return srv + "/v1beta" },
+		path:     "/v1beta/models/test-model:generateContent",
+		checkRequest: func(t *testing.T, r *http.Request, body map[string]any) {
+			if got := r.Header.Get("x-goog-api-key"); got != "test-key" {
+				t.Errorf("x-goog-api-key=%q", got)
+			}
+			sys, _ := body["systemInstruction"].(map[string]any)
+			if sys == nil {
+				t.Errorf("missing systemInstruction: %v", body)
+			}
+			for _, c := range messagesOf(t, body, "contents") {
+				if c["role"] != "user" && c["role"] != "model" {
+					t.Errorf("unexpected role %v", c["role"])
+				}
+			}
+		},
+		reply: func(w http.ResponseWriter, content string) {
+			writeJSON(w, 200, map[string]any{
+				"candidates":    []any{map[string]any{"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": content}}}}},
+				"usageMetadata": map[string]any{"promptTokenCount": 3, "candidatesTokenCount": 2, "totalTokenCount": 5},
+			})
+		},
+		fail: func(w http.ResponseWriter, kind services.LLMErrorKind) {
+			status, msg := "INVALID_ARGUMENT", "bad"
+			switch kind {
+			case services.LLMErrRateLimit:
+				status = "RESOURCE_EXHAUSTED"
+			case services.LLMErrAuth:
+				status = "UNAUTHENTICATED"
+			case services.LLMErrUnavailable:
+				status = "UNAVAILABLE"
+			case services.LLMErrContextLength:
+				msg = "The input token count exceeds the maximum number of tokens allowed"
+			}
+			writeJSON(w, statusFor(kind), map[string]any{"error": map[string]any{"code": statusFor(kind), "message": msg, "status": status}})
+		},
+	},
+	{
+		name:     "ollama",
+		modelTyp: services.ModelOllama,
+		baseURL:  func(srv string) string { return srv + "/v1" },
+		path:     "/api/chat",
+		checkRequest: func(t *testing.T, r *http.Request, body map[string]any) {
+			if body["stream"] != false {
+				t.Errorf("stream must be false")
+			}
+			if opts, _ := body["options"].(map[string]any); opts == nil || opts["num_predict"] == nil {
+				t.Errorf("max tokens should map to options.num_predict: %v", body)
+			}
+			messagesOf(t, body, "messages")
+		},
+		reply: func(w http.ResponseWriter, content string) {
+			writeJSON(w, 200, map[string]any{
+				"model":   "test-model",
+				"message": map[string]any{"role": "assistant", "content": content},
+				"done":    true, "prompt_eval_count": 3, "eval_count": 2,
+			})
+		},
+		fail: func(w http.ResponseWriter, kind services.LLMErrorKind) {
+			msg := "failed"
+			if kind == services.LLMErrContextLength {
+				msg = "input exceeds the model context length"
+			}
+			writeJSON(w, statusFor(kind), map[string]any{"error": msg})
+		},
+	},
+}
+
+func newConformanceProvider(api fakeAPI, srvURL string) services.LLMProvider {
+	return services.NewProvider(services.ModelConfig{
+		Type:      api.modelTyp,
+		BaseURL:   api.baseURL(srvURL),
+		Model:     "test-model",
+		APIKey:    "test-key",
+		MaxTokens: 256,
+	}, &http.Client{Timeout: 5 * time.Second})
+}
+
+var conformanceMessages = []services.ChatMessage{
+	{Role: "system", Content: "be brief"},
+	{Role: "user", Content: "hello"},
+	{Role: "assistant", Content: "hi"},
+	{Role: "user", Content: "how are you"},
+}
+
+func TestProviderConformance(t *testing.T) {
+	for _, api := range conformanceAPIs {
+		api := api
+		t.Run(api.name, func(t *testing.T) {
+			t.Run("chat", func(t *testing.T) {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.Method != http.MethodPost || r.URL.Path != api.path {
+						t.Errorf("request %s %s, want POST %s", r.Method, r.URL.Path, api.path)
+					}
+					var body map[string]any
+					if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+						t.Fatalf("decode body: %v", err)
+					}
+					api.checkRequest(t, r, body)
+					api.reply(w, "fine, thanks")
+				}))
+				defer srv.Close()
+
+				p := newConformanceProvider(api, srv.URL)
+				res, err := p.Chat(context.Background(), services.ChatRequest{Model: "test-model", Messages: conformanceMessages, MaxTokens: 256})
+				if err != nil {
+					t.Fatalf("chat: %v", err)
+				}
+				if res.Content != "fine, thanks" || res.Provider != p.Name() {
+					t.Fatalf("result=%+v", res)
+				}
+				if res.Usage.PromptTokens != 3 || res.Usage.CompletionTokens != 2 || res.Usage.TotalTokens != 5 {
+					t.Fatalf("usage=%+v", res.Usage)
+				}
+			})
+
+			for _, kind := range []services.LLMErrorKind{
+				services.LLMErrRateLimit, services.LLMErrAuth, services.LLMErrContextLength, services.LLMErrUnavailable,
+			} {
+				kind := kind
+				t.Run("error_"+string(kind), func(t *testing.T) {
+					srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+						if kind == services.LLMErrRateLimit {
+							w.Header().Set("Retry-After", "7")
+						}
+						api.fail(w, kind)
+					}))
+					defer srv.Close()
+
+					_, err := newConformanceProvider(api, srv.URL).Chat(context.Background(), services.ChatRequest{Messages: conformanceMessages})
+					le, ok := services.AsLLMError(err)
+					if !ok {
+						t.Fatalf("want *LLMError, got %v", err)
+					}
+					if le.Kind != kind {
+						t.Fatalf("kind=%s want %s (%v)", le.Kind, kind, le)
+					}
+					if kind == services.LLMErrRateLimit && le.RetryAfter != 7*time.Second {
+						t.Fatalf("retry after=%v", le.RetryAfter)
+					}
+					if le.Retryable() != (kind == services.LLMErrRateLimit || kind == services.LLMErrUnavailable) {
+						t.Fatalf("retryable=%v for %s", le.Retryable(), kind)
+					}
+				})
+			}
+
+			t.Run("empty_response", func(t *testing.T) {
+				srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					writeJSON(w, 200, map[string]any{})
+				}))
+				defer srv.Close()
+				_, err := newConformanceProvider(api, srv.URL).Chat(context.Background(), services.ChatRequest{Messages: conformanceMessages})
+				if le, ok := services.AsLLMError(err); !ok || le.Kind != services.LLMErrInvalidResponse {
+					t.Fatalf("err=%v", err)
+				}
+			})
+		})
+	}
+}
+
+func TestProviderNetworkError(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	p := services.NewProvider(services.ModelConfig{Type: services.ModelOpenAI, BaseURL: url, Model: "m"}, nil)
+	_, err := p.Chat(context.Background(), services.ChatRequest{Messages: []services.ChatMessage{{Role: "user", Content: "x"}}})
+	if le, ok := services.AsLLMError(err); !ok || le.Kind != services.LLMErrNetwork || !le.Retryable() {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+func TestProviderRestrictPrivate(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+		_, _ = w.Write([]byte(strings.Repeat("secret ", 100)))
+	}))
+	defer srv.Close()
+	req := services.ChatRequest{Messages: []services.ChatMessage{{Role: "user", Content: "x"}}}
+
+	// 普通用户配置的内网地址在连接前拒绝，且不重试
+	p := services.NewProvider(services.ModelConfig{Type: services.ModelOpenAI, BaseURL: srv.URL, Model: "m", RestrictPrivate: true}, nil)
+	_, err := p.Chat(context.Background(), req)
+	if le, ok := services.AsLLMError(err); !ok || le.Kind != services.LLMErrBadRequest || le.Retryable() {
+		t.Fatalf("err=%v", err)
+	}
+
+	// 白名单中的主机放行；无法解析的上游错误体截断后返回
+	t.Setenv("MEMO_LLM_ALLOW_HOSTS", "127.0.0.1")
+	p = services.NewProvider(services.ModelConfig{Type: services.ModelOpenAI, BaseURL: srv.URL, Model: "m", RestrictPrivate: true}, nil)
+	_, err = p.Chat(context.Background(), req)
+	le, ok := services.AsLLMError(err)
+	if !ok || le.Kind != services.LLMErrUnavailable || len([]rune(le.Message)) > 201 || !strings.HasSuffix(le.Message, "…") {
+		t.Fatalf("err=%v", err)
+	}
+}
+
+type echoProvider struct{}
+
+func (echoProvider) Name() string { return "echo" }
+func (echoProvider) Chat(_ context.Context, req services.ChatRequest) (*services.ChatResult, error) {
+	last := req.Messages[len(req.Messages)-1].Content
+	return &services.ChatResult{Content: strings.ToUpper(last), Provider: "echo"}, nil
+}
+
+func TestRegisterProvider(t *testing.T) {
+	const typ services.ModelType = "echo-test"
+	services.RegisterProvider(typ, func(services.ModelConfig, *http.Client) services.LLMProvider { return echoProvider{} })
+
+	svc := &services.LLMService{Model: services.ModelConfig{Type: typ}}
+	out, err := svc.Chat([]services.ChatMessage{{Role: "user", Content: "ping"}})
+	if err != nil || out != "PING" {
+		t.Fatalf("out=%q err=%v", out, err)
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// RetryPolicy 单个厂商的重试策略（仅对限流、服务端错误与网络错误重试）
+type RetryPolicy struct {
+	MaxAttempts    int           // 含首次调用
+	BaseDelay      time.Duration // 指数退避基数
+	MaxDelay       time.Duration // 单次退避上限
+	MaxRetryAfter  time.Duration // Retry-After 超过该值时不再等待，直接切换备用模型
+	AttemptTimeout time.Duration // 单次调用超时，0 表示只受 HTTP 客户端超时约束
+	// Sleep 等待函数，测试时可替换；为空时按 ctx 可取消地等待
+	Sleep func(ctx context.Context, d time.Duration) error
+}
+
+// DefaultRetryPolicy 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    3,
+	BaseDelay:      500 * time.Millisecond,
+	MaxDelay:       8 * time.Second,
+	MaxRetryAfter:  30 * time.Second,
+	AttemptTimeout: 60 * time.Second,
+}
+
+// backoff 第 attempt 次失败后的等待时间；服务端给出 Retry-After 时优先遵循。
+// 返回 false 表示不应继续等待（Retry-After 过长）。
+func (p RetryPolicy) backoff(attempt int, retryAfter time.Duration) (time.Duration, bool) {
+	if retryAfter > 0 {
+		if p.MaxRetryAfter > 0 && retryAfter > p.MaxRetryAfter {
+			return 0, false
+		}
+		return retryAfter, true
+	}
+	d := p.BaseDelay << uint(attempt-1)
+	if d <= 0 || (p.MaxDelay > 0 && d > p.MaxDelay) {
+		d = p.MaxDelay
+	}
+	if d <= 0 {
+		return 0, true
+	}
+	// equal jitter：一半固定、一半随机，避免多个请求同时重试
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(d-half)+1)), true
+}
+
+func (p RetryPolicy) sleep(ctx context.Context, d time.Duration) error {
+	if p.Sleep != nil {
+		return p.Sleep(ctx, d)
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+// CircuitState 熔断器状态
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"    // 正常
+	CircuitOpen     CircuitState = "open"      // 熔断中，直接跳过
+	CircuitHalfOpen CircuitState = "half_open" // 冷却结束，放行一次探测
+)
+
+// ProviderHealth 厂商健康状态
+type ProviderHealth struct {
+	Key                 string       `json:"key"`
+	State               CircuitState `json:"state"`
+	ConsecutiveFailures int          `json:"consecutive_failures"`
+	LastError           string       `json:"last_error,omitempty"`
+	LastErrorAt         *time.Time   `json:"last_error_at,omitempty"`
+	LastSuccessAt       *time.Time   `json:"last_success_at,omitempty"`
+	OpenUntil           *time.Time   `json:"open_until,omitempty"`
+}
+
+type circuitBreaker struct {
+	state     CircuitState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastErr   string
+	lastErrAt time.Time
+	lastOKAt  time.Time
+}
+
+// BreakerRegistry 按厂商（类型 + 地址 + 模型）维护熔断器
+type BreakerRegistry struct {
+	Threshold int           // 连续失败多少次后熔断
+	Cooldown  time.Duration // 熔断持续时间
+
+	mu       sync.Mutex
+	breakers map[string]*circuitBreaker
+	now      func() time.Time
+}
+
+// NewBreakerRegistry 创建熔断器集合
+func NewBreakerRegistry(threshold int, cooldown time.Duration) *BreakerRegistry {
+	return &BreakerRegistry{
+		Threshold: threshold,
+		Cooldown:  cooldown,
+		breakers:  map[string]*circuitBreaker{},
+		now:       time.Now,
+	}
+}
+
+// DefaultBreakers 进程内共享的熔断器
+var DefaultBreakers = NewBreakerRegistry(5, 30*time.Second)
+
+// ProviderKey 熔断与健康统计的键
+func ProviderKey(cfg ModelConfig) string {
+	return string(cfg.Type) + "|" + cfg.BaseURL + "|" + cfg.Model
+}
+
+func (r *BreakerRegistry) get(key string) *circuitBreaker {
+	b, ok := r.breakers[key]
+	if !ok {
+		b = &circuitBreaker{state: CircuitClosed}
+		r.breakers[key] = b
+	}
+	return b
+}
+
+// Allow 是否允许调用；熔断冷却结束后只放行一个探测请求
+func (r *BreakerRegistry) Allow(key string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.get(key)
+	switch b.state {
+	case CircuitOpen:
+		if r.now().Sub(b.openedAt) < r.Cooldown {
+			return false
+		}
+		b.state = CircuitHalfOpen
+		b.probing = true
+		return true
+	case CircuitHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// Success 记录成功：关闭熔断器
+func (r *BreakerRegistry) Success(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.get(key)
+	b.state = CircuitClosed
+	b.failures = 0
+	b.probing = false
+	b.lastOKAt = r.now()
+}
+
+// Failure 记录失败：连续失败达到阈值或探测失败时熔断
+func (r *BreakerRegistry) Failure(key string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.get(key)
+	b.failures++
+	b.probing = false
+	b.lastErrAt = r.now()
+	if err != nil {
+		b.lastErr = err.Error()
+	}
+	if b.state == CircuitHalfOpen || (r.Threshold > 0 && b.failures >= r.Threshold) {
+		b.state = CircuitOpen
+		b.openedAt = r.now()
+	}
+}
+
+// Health 健康状态快照
+func (r *BreakerRegistry) Health(key string) ProviderHealth {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := r.get(key)
+	h := ProviderHealth{
+		Key:                 key,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastErr,
+	}
+	if !b.lastErrAt.IsZero() {
+		t := b.lastErrAt
+		h.LastErrorAt = &t
+	}
+	if !b.lastOKAt.IsZero() {
+		t := b.lastOKAt
+		h.LastSuccessAt = &t
+	}
+	if b.state == CircuitOpen {
+		t := b.openedAt.Add(r.Cooldown)
+		h.OpenUntil = &t
+	}
+	return h
+}
+
+// tripsBreaker 是否计入熔断失败：配置类错误（认证、参数、上下文过长）说明服务可达，不计入
+func tripsBreaker(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	le, ok := AsLLMError(err)
+	if !ok {
+		return true
+	}
+	switch le.Kind {
+	case LLMErrAuth, LLMErrBadRequest, LLMErrContextLength:
+		return false
+	}
+	return true
+}
+
+// ErrNoProviderAvailable 所有模型均处于熔断状态
+var ErrNoProviderAvailable = &LLMError{Provider: "llm", Kind: LLMErrUnavailable, Message: "所有模型暂时不可用（熔断中）"}
+
+// callWithRetry 带重试地调用单个厂商，并更新熔断器
+func callWithRetry(ctx context.Context, p LLMProvider, key string, req ChatRequest, policy RetryPolicy, breakers *BreakerRegistry) (*ChatResult, error) {
+	attempts := policy.MaxAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+	var lastErr error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 && !breakers.Allow(key) {
+			break
+		}
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if policy.AttemptTimeout > 0 {
+			attemptCtx, cancel = context.WithTimeout(ctx, policy.AttemptTimeout)
+		}
+		res, err := p.Chat(attemptCtx, req)
+		cancel()
+		if err == nil {
+			breakers.Success(key)
+			return res, nil
+		}
+		lastErr = err
+		if tripsBreaker(err) {
+			breakers.Failure(key, err)
+		} else {
+			breakers.Success(key)
+		}
+
+		le, ok := AsLLMError(err)
+		if !ok || !le.Retryable() || attempt == attempts || ctx.Err() != nil {
+			break
+		}
+		delay, wait := policy.backoff(attempt, le.RetryAfter)
+		if !wait {
+			break
+		}
+		if err := policy.sleep(ctx, delay); err != nil {
+			break
+		}
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,212 @@
+package services_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+// scriptedServer OpenAI 兼容的假服务：前 failures 次返回 status，之后成功
+func scriptedServer(t *testing.T, failures int32, status int, retryAfter string) (*httptest.Server, *int32) {
+	t.Helper()
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		if failures < 0 || n <= failures {
+			if retryAfter != "" {
+				w.Header().Set("Retry-After", retryAfter)
+			}
+			writeJSON(w, status, map[string]any{"error": map[string]any{"message": "boom"}})
+			return
+		}
+		writeJSON(w, 200, map[string]any{
+			"model":   "m",
+			"choices": []any{map[string]any{"message": map[string]any{"role": "assistant", "content": "ok from " + r.Host}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls
+}
+
+func cfgFor(t services.ModelType, url string) services.ModelConfig {
+	return services.ModelConfig{Type: t, Name: string(t), BaseURL: url, Model: "m", APIKey: "k"}
+}
+
+type sleepRecorder struct{ slept []time.Duration }
+
+func (s *sleepRecorder) policy(attempts int) *services.RetryPolicy {
+	return &services.RetryPolicy{
+		MaxAttempts:   attempts,
+		BaseDelay:     100 * time.Millisecond,
+		MaxDelay:      time.Second,
+		MaxRetryAfter: 10 * time.Second,
+		Sleep: func(_ context.Context, d time.Duration) error {
+			s.slept = append(s.slept, d)
+			return nil
+		},
+	}
+}
+
+var hello = []services.ChatMessage{{Role: "user", Content: "hi"}}
+
+func TestRetryHonorsRetryAfter(t *testing.T) {
+	srv, calls := scriptedServer(t, 1, http.StatusTooManyRequests, "2")
+	rec := &sleepRecorder{}
+	svc := &services.LLMService{
+		Model:    cfgFor(services.ModelDeepSeek, srv.URL),
+		Retry:    rec.policy(3),
+		Breakers: services.NewBreakerRegistry(5, time.Minute),
+	}
+	res, err := svc.ChatContext(context.Background(), hello)
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if *calls != 2 || res.Fallback || res.Provider != "deepseek" {
+		t.Fatalf("calls=%d result=%+v", *calls, res)
+	}
+	if len(rec.slept) != 1 || rec.slept[0] != 2*time.Second {
+		t.Fatalf("slept=%v", rec.slept)
+	}
+}
+
+func TestRetryJitteredBackoffThenFallback(t *testing.T) {
+	primary, primaryCalls := scriptedServer(t, -1, http.StatusServiceUnavailable, "")
+	backup, backupCalls := scriptedServer(t, 0, 0, "")
+	rec := &sleepRecorder{}
+	svc := &services.LLMService{
+		Model:     cfgFor(services.ModelDeepSeek, primary.URL),
+		Fallbacks: []services.ModelConfig{cfgFor(services.ModelLMStudio, backup.URL)},
+		Retry:     rec.policy(3),
+		Breakers:  services.NewBreakerRegistry(5, time.Minute),
+	}
+	res, err := svc.ChatContext(context.Background(), hello)
+	if err != nil {
+		t.Fatalf("chat: %v", err)
+	}
+	if *primaryCalls != 3 || *backupCalls != 1 {
+		t.Fatalf("primary=%d backup=%d", *primaryCalls, *backupCalls)
+	}
+	if !res.Fallback || res.Provider != "lmstudio" {
+		t.Fatalf("result=%+v", res)
+	}
+	// 第 n 次退避落在 [base*2^(n-1)/2, base*2^(n-1)]
+	if len(rec.slept) != 2 {
+		t.Fatalf("slept=%v", rec.slept)
+	}
+	for i, d := range rec.slept {
+		max := 100 * time.Millisecond << uint(i)
+		if d < max/2 || d > max {
+			t.Fatalf("backoff %d = %v, want within [%v, %v]", i+1, d, max/2, max)
+		}
+	}
+}
+
+func TestRetryAfterTooLongSkipsToFallback(t *testing.T) {
+	primary, primaryCalls := scriptedServer(t, -1, http.StatusTooManyRequests, "3600")
+	backup, _ := scriptedServer(t, 0, 0, "")
+	rec := &sleepRecorder{}
+	svc := &services.LLMService{
+		Model:     cfgFor(services.ModelDeepSeek, primary.URL),
+		Fallbacks: []services.ModelConfig{cfgFor(services.ModelKimi, backup.URL)},
+		Retry:     rec.policy(3),
+		Breakers:  services.NewBreakerRegistry(5, time.Minute),
+	}
+	res, err := svc.ChatContext(context.Background(), hello)
+	if err != nil || res.Provider != "kimi" {
+		t.Fatalf("res=%+v err=%v", res, err)
+	}
+	if *primaryCalls != 1 || len(rec.slept) != 0 {
+		t.Fatalf("calls=%d slept=%v", *primaryCalls, rec.slept)
+	}
+}
+
+func TestAuthErrorNotRetriedAndDoesNotTripBreaker(t *testing.T) {
+	srv, calls := scriptedServer(t, -1, http.StatusUnauthorized, "")
+	breakers := services.NewBreakerRegistry(1, time.Minute)
+	cfg := cfgFor(services.ModelDeepSeek, srv.URL)
+	svc := &services.LLMService{Model: cfg, Retry: (&sleepRecorder{}).policy(3), Breakers: breakers}
+
+	for i := 0; i < 2; i++ {
+		_, err := svc.ChatContext(context.Background(), hello)
+		if le, ok := services.AsLLMError(err); !ok || le.Kind != services.LLMErrAuth {
+			t.Fatalf("err=%v", err)
+		}
+	}
+	if *calls != 2 {
+		t.Fatalf("calls=%d", *calls)
+	}
+	if h := breakers.Health(services.ProviderKey(cfg)); h.State != services.CircuitClosed {
+		t.Fatalf("health=%+v", h)
+	}
+}
+
+func TestCircuitBreakerOpensAndRecovers(t *testing.T) {
+	var healthy atomic.Bool
+	var primaryCalls int32
+	primary := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&primaryCalls, 1)
+		if !healthy.Load() {
+			writeJSON(w, http.StatusBadGateway, map[string]any{"error": map[string]any{"message": "down"}})
+			return
+		}
+		writeJSON(w, 200, map[string]any{"choices": []any{map[string]any{"message": map[string]any{"content": "primary"}}}})
+	}))
+	defer primary.Close()
+	backup, _ := scriptedServer(t, 0, 0, "")
+
+	breakers := services.NewBreakerRegistry(2, 50*time.Millisecond)
+	cfg := cfgFor(services.ModelDeepSeek, primary.URL)
+	svc := &services.LLMService{
+		Model:     cfg,
+		Fallbacks: []services.ModelConfig{cfgFor(services.ModelLMStudio, backup.URL)},
+		Retry:     (&sleepRecorder{}).policy(1),
+		Breakers:  breakers,
+	}
+	key := services.ProviderKey(cfg)
+
+	for i := 0; i < 2; i++ {
+		if res, err := svc.ChatContext(context.Background(), hello); err != nil || !res.Fallback {
+			t.Fatalf("call %d: res=%+v err=%v", i, res, err)
+		}
+	}
+	h := breakers.Health(key)
+	if h.State != services.CircuitOpen || h.ConsecutiveFailures != 2 || h.OpenUntil == nil || h.LastError == "" {
+		t.Fatalf("health=%+v", h)
+	}
+
+	// 熔断期间不再请求主模型
+	if _, err := svc.ChatContext(context.Background(), hello); err != nil {
+		t.Fatalf("chat while open: %v", err)
+	}
+	if primaryCalls != 2 {
+		t.Fatalf("primary called while open: %d", primaryCalls)
+	}
+
+	// 冷却后放行探测，成功即恢复
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	res, err := svc.ChatContext(context.Background(), hello)
+	if err != nil || res.Fallback || res.Content != "primary" {
+		t.Fatalf("probe res=%+v err=%v", res, err)
+	}
+	if h := breakers.Health(key); h.State != services.CircuitClosed || h.LastSuccessAt == nil {
+		t.Fatalf("health after recovery=%+v", h)
+	}
+}
+
+func TestAllProvidersOpen(t *testing.T) {
+	breakers := services.NewBreakerRegistry(1, time.Minute)
+	cfg := cfgFor(services.ModelDeepSeek, "http://127.0.0.1:1")
+	breakers.Failure(services.ProviderKey(cfg), nil)
+
+	svc := &services.LLMService{Model: cfg, Breakers: breakers}
+	_, err := svc.ChatContext(context.Background(), hello)
+	if le, ok := services.AsLLMError(err); !ok || le.Kind != services.LLMErrUnavailable {
+		t.Fatalf("err=%v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"memo-studio/backend/models"
+)
+
+// 配额周期
+const (
+	QuotaPeriodDaily   = "daily"
+	QuotaPeriodMonthly = "monthly"
+)
+
+// QuotaExceededError 用户 token 配额已用完
+type QuotaExceededError struct {
+	Period  string
+	Limit   int64
+	Used    int64
+	ResetAt time.Time
+}
+
+func (e *QuotaExceededError) Error() string {
+	name := "今日"
+	if e.Period == QuotaPeriodMonthly {
+		name = "本月"
+	}
+	return fmt.Sprintf("%s AI 用量已达上限（%d/%d tokens），将于 %s 重置", name, e.Used, e.Limit, e.ResetAt.Format("2006-01-02 15:04"))
+}
+
+// QuotaWindow 单个周期的配额使用情况
+type QuotaWindow struct {
+	Limit     int64     `json:"limit"` // 0 表示不限
+	Used      int64     `json:"used"`
+	Remaining int64     `json:"remaining"` // 不限时为 -1
+	ResetAt   time.Time `json:"reset_at"`
+}
+
+// QuotaStatus 用户配额状态
+type QuotaStatus struct {
+	Daily   QuotaWindow `json:"daily"`
+	Monthly QuotaWindow `json:"monthly"`
+}
+
+// quotaWindows 日/月周期起点与重置时间（服务器本地时区）
+func quotaWindows(now time.Time) (dayStart, dayReset, monthStart, monthReset time.Time) {
+	y, m, d := now.Date()
+	dayStart = time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	monthStart = time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	return dayStart, dayStart.AddDate(0, 0, 1), monthStart, monthStart.AddDate(0, 1, 0)
+}
+
+func newQuotaWindow(limit, used int64, reset time.Time) QuotaWindow {
+	w := QuotaWindow{Limit: limit, Used: used, Remaining: -1, ResetAt: reset}
+	if limit > 0 {
+		w.Remaining = limit - used
+		if w.Remaining < 0 {
+			w.Remaining = 0
+		}
+	}
+	return w
+}
+
+// GetLLMQuotaStatus 用户当前配额使用情况
+func GetLLMQuotaStatus(userID int, now time.Time) (QuotaStatus, error) {
+	q, err := models.GetEffectiveLLMQuota(userID)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+	dayStart, dayReset, monthStart, monthReset := quotaWindows(now)
+	daily, err := models.TokensUsedSince(userID, dayStart)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+	monthly, err := models.TokensUsedSince(userID, monthStart)
+	if err != nil {
+		return QuotaStatus{}, err
+	}
+	return QuotaStatus{
+		Daily:   newQuotaWindow(q.DailyTokens, daily, dayReset),
+		Monthly: newQuotaWindow(q.MonthlyTokens, monthly, monthReset),
+	}, nil
+}
+
+// CheckLLMQuota 调用前检查配额；超限时返回 *QuotaExceededError
+func CheckLLMQuota(userID int, now time.Time) error {
+	st, err := GetLLMQuotaStatus(userID, now)
+	if err != nil {
+		return err
+	}
+	if st.Monthly.Limit > 0 && st.Monthly.Used >= st.Monthly.Limit {
+		return &QuotaExceededError{Period: QuotaPeriodMonthly, Limit: st.Monthly.Limit, Used: st.Monthly.Used, ResetAt: st.Monthly.ResetAt}
+	}
+	if st.Daily.Limit > 0 && st.Daily.Used >= st.Daily.Limit {
+		return &QuotaExceededError{Period: QuotaPeriodDaily, Limit: st.Daily.Limit, Used: st.Daily.Used, ResetAt: st.Daily.ResetAt}
+	}
+	return nil
+}
+
+// recordUsage 记录一次厂商调用（含重试耗时）；写入失败只记日志
+func (s *LLMService) recordUsage(cfg ModelConfig, res *ChatResult, err error, latency time.Duration, fallback bool) {
+	if s.UserID <= 0 {
+		return
+	}
+	uid := s.UserID
+	u := models.LLMUsage{
+		UserID:    &uid,
+		Endpoint:  s.Endpoint,
+		Provider:  string(cfg.Type),
+		Model:     cfg.Model,
+		LatencyMs: latency.Milliseconds(),
+		Success:   err == nil,
+		Fallback:  fallback,
+	}
+	if res != nil {
+		u.Provider = res.Provider
+		u.Model = firstNonEmpty(res.Model, cfg.Model)
+		u.PromptTokens = res.Usage.PromptTokens
+		u.CompletionTokens = res.Usage.CompletionTokens
+		u.TotalTokens = res.Usage.TotalTokens
+	}
+	if le, ok := AsLLMError(err); ok {
+		u.ErrorKind = string(le.Kind)
+	} else if err != nil {
+		u.ErrorKind = "error"
+	}
+	if werr := models.RecordLLMUsage(u); werr != nil {
+		log.Printf("记录大模型用量失败: %v", werr)
+	}
+}
@@ -1,6 +1,8 @@
 package services
 
 import (
+	"context"
+	"log"
 	"strings"
 	"unicode/utf8"
 )
@@ -64,6 +66,11 @@ var KnownLocations = map[string][]string{
 
 // ExtractLocation 从文本中提取地点
 func ExtractLocation(content string) string {
+	// 0. 地名库中的地名（取最具体的一个）
+	if place := DefaultGazetteer().FindIn(content); place != nil {
+		return place.Label()
+	}
+
 	// 1. 检查已知的地点
 	for canonical, variants := range KnownLocations {
 		for _, variant := range variants {
@@ -161,54 +168,62 @@ type LocationWithCoords struct {
 	Longitude float64 `json:"longitude"`
 }
 
-// GetLocationCoords 获取地点的坐标（模拟数据）
-// 在实际应用中，可以调用地理编码 API（如高德、Google Maps）
-func GetLocationCoords(locationName string) *LocationWithCoords {
-	// 中国主要城市坐标（示例数据）
-	coords := map[string][2]float64{
-		"北京":     {39.9042, 116.4074},
-		"上海":     {31.2304, 121.4737},
-		"广州":     {23.1291, 113.2644},
-		"深圳":     {22.5431, 114.0579},
-		"杭州":     {30.2741, 120.1551},
-		"成都":     {30.5728, 104.0668},
-		"重庆":     {29.4316, 106.9123},
-		"武汉":     {30.5928, 114.3055},
-		"西安":     {34.3416, 108.9398},
-		"南京":     {32.0603, 118.7969},
-		"天津":     {39.1256, 117.1909},
-		"东京":     {35.6762, 139.6503},
-		"纽约":     {40.7128, -74.0060},
-		"伦敦":     {51.5074, -0.1278},
-		"巴黎":     {48.8566, 2.3522},
-		"悉尼":     {-33.8688, 151.2093},
-		"洛杉矶":    {34.0522, -118.2437},
-		"旧金山":    {37.7749, -122.4194},
-		"新加坡":    {1.3521, 103.8198},
-		"香港":     {22.3193, 114.1694},
-		"台北":     {25.0330, 121.5654},
-	}
-
-	if coord, ok := coords[locationName]; ok {
-		return &LocationWithCoords{
-			Name:      locationName,
-			Latitude:  coord[0],
-			Longitude: coord[1],
-		}
+// GetLocationCoords 获取地点的坐标：依次查询离线地名库和配置的在线服务（见 GeocoderFromEnv）
+func GetLocationCoords(ctx context.Context, locationName string) *LocationWithCoords {
+	place, err := GetGeocoder().Geocode(ctx, locationName)
+	if err != nil {
+		log.Printf("地理编码失败 %q: %v", locationName, err)
+		return nil
+	}
+	if place == nil {
+		return nil
+	}
+
+	return &LocationWithCoords{
+		Name:      place.Label(),
+		Latitude:  place.Latitude,
+		Longitude: place.Longitude,
+	}
+}
+
+// ReverseLocation 坐标反查地点名称（如照片的拍摄位置），坐标保持不变；查不到时返回 nil
+func ReverseLocation(ctx context.Context, lat, lng float64) *LocationWithCoords {
+	place, err := ReverseGeocode(ctx, lat, lng)
+	if err != nil {
+		log.Printf("逆地理编码失败 (%.5f, %.5f): %v", lat, lng, err)
+		return nil
+	}
+	if place == nil {
+		return nil
 	}
 
-	return nil
+	return &LocationWithCoords{
+		Name:      place.Label(),
+		Latitude:  lat,
+		Longitude: lng,
+	}
 }
 
 // DetectAndExtractLocation 检测并提取地点，返回标准名称和坐标
-func DetectAndExtractLocation(content string) *LocationWithCoords {
+func DetectAndExtractLocation(ctx context.Context, content string) *LocationWithCoords {
+	// 地名库能直接识别时不再查询
+	if place := DefaultGazetteer().FindIn(content); place != nil {
+		return &LocationWithCoords{
+			Name:      place.Label(),
+			Latitude:  place.Latitude,
+			Longitude: place.Longitude,
+		}
+	}
+
 	location := ExtractLocation(content)
 	if location == "" {
 		return nil
 	}
 
-	coords := GetLocationCoords(location)
+	coords := GetLocationCoords(ctx, location)
 	if coords != nil {
+		// 保留正文中的写法，在线服务返回的名称可能是完整地址
+		coords.Name = location
 		return coords
 	}
 
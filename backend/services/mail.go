@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MailMessage 纯文本邮件
+type MailMessage struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer 邮件发送接口
+type Mailer interface {
+	Send(ctx context.Context, msg MailMessage) error
+}
+
+// SMTPMailer 通过 SMTP 发送（服务器支持时自动 STARTTLS）
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, msg MailMessage) error {
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(addr, auth, m.From, []string{msg.To}, buildMailBytes(m.From, msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// OutboxMailer 本地开发用：把邮件写入目录（.eml），Dir 为空时只打印日志（隐去链接中的令牌）
+type OutboxMailer struct {
+	Dir  string
+	From string
+	mu   sync.Mutex
+}
+
+func (m *OutboxMailer) Send(_ context.Context, msg MailMessage) error {
+	data := buildMailBytes(m.From, msg)
+	if m.Dir == "" {
+		log.Printf("[MAIL] to=%s subject=%s\n%s", msg.To, msg.Subject, redactMailBody(msg.Body))
+		return nil
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.eml", time.Now().Format("20060102-150405.000000000"), sanitizeMailName(msg.To))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// mailTokenRe 邮件链接中的一次性令牌（找回密码、邮箱验证）
+var mailTokenRe = regexp.MustCompile(`([?&]token=)[^\s&#]+`)
+
+// redactMailBody 打印到日志前隐去链接中的令牌，避免能读日志的人借此重置密码
+func redactMailBody(body string) string {
+	return mailTokenRe.ReplaceAllString(body, "${1}[已隐藏]")
+}
+
+func sanitizeMailName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+func buildMailBytes(from string, msg MailMessage) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from + "\r\n")
+	b.WriteString("To: " + msg.To + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("utf-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+var (
+	mailer     Mailer
+	mailerOnce sync.Once
+	mailerMu   sync.RWMutex
+)
+
+// GetMailer 根据环境变量选择实现：
+// MEMO_SMTP_HOST 存在时使用 SMTP，否则写入 MEMO_MAIL_OUTBOX 目录（未设置则只打印日志）
+func GetMailer() Mailer {
+	mailerOnce.Do(func() {
+		mailerMu.Lock()
+		defer mailerMu.Unlock()
+		if mailer != nil {
+			return
+		}
+		from := strings.TrimSpace(os.Getenv("MEMO_MAIL_FROM"))
+		if from == "" {
+			from = "Memo Studio <no-reply@localhost>"
+		}
+		if host := strings.TrimSpace(os.Getenv("MEMO_SMTP_HOST")); host != "" {
+			port, _ := strconv.Atoi(os.Getenv("MEMO_SMTP_PORT"))
+			if port <= 0 {
+				port = 587
+			}
+			mailer = &SMTPMailer{
+				Host:     host,
+				Port:     port,
+				Username: os.Getenv("MEMO_SMTP_USERNAME"),
+				Password: os.Getenv("MEMO_SMTP_PASSWORD"),
+				From:     from,
+			}
+			return
+		}
+		mailer = &OutboxMailer{Dir: strings.TrimSpace(os.Getenv("MEMO_MAIL_OUTBOX")), From: from}
+	})
+	mailerMu.RLock()
+	defer mailerMu.RUnlock()
+	return mailer
+}
+
+// SetMailer 替换邮件实现（测试或自定义部署）
+func SetMailer(m Mailer) {
+	mailerOnce.Do(func() {})
+	mailerMu.Lock()
+	defer mailerMu.Unlock()
+	mailer = m
+}
+
+// PublicBaseURL 邮件中链接使用的前端地址
+func PublicBaseURL() string {
+	if v := strings.TrimRight(strings.TrimSpace(os.Getenv("MEMO_PUBLIC_URL")), "/"); v != "" {
+		return v
+	}
+	return "http://localhost:9000"
+}
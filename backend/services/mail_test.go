@@ -0,0 +1,32 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"memo-studio/backend/services"
+)
+
+func TestOutboxMailerRedactsTokensInLog(t *testing.T) {
+	var buf bytes.Buffer
+	prev := log.Writer()
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(prev) })
+
+	m := &services.OutboxMailer{From: "Memo Studio <no-reply@localhost>"}
+	err := m.Send(context.Background(), services.MailMessage{
+		To:      "frank@example.com",
+		Subject: "重置密码",
+		Body:    "请点击以下链接设置新密码：\nhttp://localhost:5173/reset-password?token=0123abcdef&from=mail\n",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "0123abcdef") || !strings.Contains(out, "reset-password?token=[已隐藏]&from=mail") {
+		t.Fatalf("log = %s", out)
+	}
+}
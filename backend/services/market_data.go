@@ -0,0 +1,423 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MarketDataProvider 行情数据源。symbol 为带市场前缀的代码，如 sh600519；
+// History 按日期升序返回最近 days 个交易日的日 K 线
+type MarketDataProvider interface {
+	Name() string
+	Quote(ctx context.Context, symbol string) (*StockInfo, error)
+	History(ctx context.Context, symbol string, days int) ([]StockHistory, error)
+}
+
+// FundFlowProvider 提供资金流向的数据源（可选）
+type FundFlowProvider interface {
+	FundFlow(ctx context.Context, symbol string) (*StockFundFlow, error)
+}
+
+// ErrStockNotFound 数据源中没有该股票（代码不存在或未收录）
+var ErrStockNotFound = errors.New("未找到该股票")
+
+// marketDataClient 行情接口共用的 HTTP 客户端
+var marketDataClient = &http.Client{Timeout: 8 * time.Second}
+
+// marketGet 请求行情接口并返回响应体；非 200 视为错误
+func marketGet(ctx context.Context, client *http.Client, endpoint string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if client == nil {
+		client = marketDataClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return nil, fmt.Errorf("读取数据失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP %d", resp.StatusCode)
+	}
+	return body, nil
+}
+
+// marketSymbol 统一为数据源使用的代码（sh600519），无效时返回空串
+func marketSymbol(code string) string {
+	c, market, ok := NormalizeStockCode(code)
+	if !ok {
+		return ""
+	}
+	return market + c
+}
+
+// marketName 代码所属交易所的中文名
+func marketName(symbol string) string {
+	if strings.HasPrefix(symbol, "sh") {
+		return "上海"
+	}
+	return "深圳"
+}
+
+// lastDays 保留最近 days 条（history 已按日期升序）
+func lastDays(history []StockHistory, days int) []StockHistory {
+	if days > 0 && len(history) > days {
+		return history[len(history)-days:]
+	}
+	return history
+}
+
+// ChainMarketData 依次尝试多个数据源，返回第一个成功的结果
+type ChainMarketData []MarketDataProvider
+
+func (c ChainMarketData) Name() string {
+	names := make([]string, 0, len(c))
+	for _, p := range c {
+		names = append(names, p.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (c ChainMarketData) Quote(ctx context.Context, symbol string) (*StockInfo, error) {
+	var lastErr error
+	for _, p := range c {
+		info, err := p.Quote(ctx, symbol)
+		if err == nil {
+			return info, nil
+		}
+		if !errors.Is(err, ErrStockNotFound) {
+			log.Printf("行情数据源 %s 获取 %s 失败: %v", p.Name(), symbol, err)
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = ErrStockNotFound
+	}
+	return nil, lastErr
+}
+
+func (c ChainMarketData) History(ctx context.Context, symbol string, days int) ([]StockHistory, error) {
+	var lastErr error
+	for _, p := range c {
+		history, err := p.History(ctx, symbol, days)
+		if err == nil {
+			return history, nil
+		}
+		if !errors.Is(err, ErrStockNotFound) {
+			log.Printf("行情数据源 %s 获取 %s 历史数据失败: %v", p.Name(), symbol, err)
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = ErrStockNotFound
+	}
+	return nil, lastErr
+}
+
+// FundFlow 依次尝试支持资金流向的数据源
+func (c ChainMarketData) FundFlow(ctx context.Context, symbol string) (*StockFundFlow, error) {
+	lastErr := errors.New("没有支持资金流向的行情数据源")
+	for _, p := range c {
+		fp, ok := p.(FundFlowProvider)
+		if !ok {
+			continue
+		}
+		flow, err := fp.FundFlow(ctx, symbol)
+		if err == nil {
+			return flow, nil
+		}
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+// ===== 行情缓存：按 A 股交易时段决定缓存时间 =====
+
+// 上交所、深交所交易时间（北京时间）：9:15 集合竞价开始，11:30–13:00 午休，15:00 收盘。
+// 不区分法定节假日：节假日按工作日处理，只是缓存时间偏短
+var chinaMarketZone = time.FixedZone("CST", 8*3600)
+
+const (
+	marketOpenMinute      = 9*60 + 15
+	marketLunchMinute     = 11*60 + 30
+	marketAfternoonMinute = 13 * 60
+	marketCloseMinute     = 15 * 60
+)
+
+// 默认缓存时间
+const (
+	DefaultQuoteCacheTTL   = 15 * time.Second // 交易时段内的实时行情
+	DefaultHistoryCacheTTL = 5 * time.Minute  // 交易时段内的日 K 线（当日 K 线仍在变化）
+	maxClosedCacheTTL      = 12 * time.Hour   // 休市时缓存到下次开盘，但不超过该时长
+)
+
+// MarketOpen 给定时刻是否处于交易时段（含集合竞价）
+func MarketOpen(t time.Time) bool {
+	t = t.In(chinaMarketZone)
+	if wd := t.Weekday(); wd == time.Saturday || wd == time.Sunday {
+		return false
+	}
+	m := t.Hour()*60 + t.Minute()
+	return (m >= marketOpenMinute && m < marketLunchMinute) || (m >= marketAfternoonMinute && m < marketCloseMinute)
+}
+
+// nextMarketOpen 下一次开盘（或午后开市）的时刻
+func nextMarketOpen(t time.Time) time.Time {
+	t = t.In(chinaMarketZone)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, chinaMarketZone)
+	m := t.Hour()*60 + t.Minute()
+	if wd := t.Weekday(); wd != time.Saturday && wd != time.Sunday {
+		if m < marketOpenMinute {
+			return day.Add(marketOpenMinute * time.Minute)
+		}
+		if m >= marketLunchMinute && m < marketAfternoonMinute {
+			return day.Add(marketAfternoonMinute * time.Minute)
+		}
+	}
+	for {
+		day = day.AddDate(0, 0, 1)
+		if wd := day.Weekday(); wd != time.Saturday && wd != time.Sunday {
+			return day.Add(marketOpenMinute * time.Minute)
+		}
+	}
+}
+
+// marketCacheTTL 交易时段内用 live；休市时数据不再变化，缓存到下次开盘
+func marketCacheTTL(now time.Time, live time.Duration) time.Duration {
+	if MarketOpen(now) {
+		return live
+	}
+	return min(nextMarketOpen(now).Sub(now), maxClosedCacheTTL)
+}
+
+type marketCacheEntry struct {
+	value     any
+	expiresAt time.Time
+}
+
+// CachedMarketData 在内存中缓存行情（错误不缓存）
+type CachedMarketData struct {
+	Provider   MarketDataProvider
+	QuoteTTL   time.Duration    // 交易时段内实时行情的缓存时间，默认 DefaultQuoteCacheTTL
+	HistoryTTL time.Duration    // 交易时段内日 K 线的缓存时间，默认 DefaultHistoryCacheTTL
+	Now        func() time.Time // 测试用
+
+	mu      sync.Mutex
+	entries map[string]marketCacheEntry
+}
+
+func (c *CachedMarketData) Name() string { return c.Provider.Name() }
+
+func (c *CachedMarketData) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *CachedMarketData) get(key string) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !c.now().Before(e.expiresAt) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *CachedMarketData) put(key string, value any, live time.Duration) {
+	now := c.now()
+	ttl := marketCacheTTL(now, live)
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = map[string]marketCacheEntry{}
+	}
+	// 顺手清理过期条目，避免长期运行后无限增长
+	if len(c.entries) >= 1024 {
+		for k, e := range c.entries {
+			if !now.Before(e.expiresAt) {
+				delete(c.entries, k)
+			}
+		}
+	}
+	c.entries[key] = marketCacheEntry{value: value, expiresAt: now.Add(ttl)}
+}
+
+func (c *CachedMarketData) quoteTTL() time.Duration {
+	if c.QuoteTTL > 0 {
+		return c.QuoteTTL
+	}
+	return DefaultQuoteCacheTTL
+}
+
+func (c *CachedMarketData) historyTTL() time.Duration {
+	if c.HistoryTTL > 0 {
+		return c.HistoryTTL
+	}
+	return DefaultHistoryCacheTTL
+}
+
+// Quote 返回缓存的副本，调用方修改不影响缓存
+func (c *CachedMarketData) Quote(ctx context.Context, symbol string) (*StockInfo, error) {
+	key := "quote:" + symbol
+	if v, ok := c.get(key); ok {
+		info := *v.(*StockInfo)
+		return &info, nil
+	}
+	info, err := c.Provider.Quote(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	cached := *info
+	c.put(key, &cached, c.quoteTTL())
+	return info, nil
+}
+
+// History 缓存按 days 区分
+func (c *CachedMarketData) History(ctx context.Context, symbol string, days int) ([]StockHistory, error) {
+	key := "history:" + symbol + ":" + strconv.Itoa(days)
+	if v, ok := c.get(key); ok {
+		return append([]StockHistory(nil), v.([]StockHistory)...), nil
+	}
+	history, err := c.Provider.History(ctx, symbol, days)
+	if err != nil {
+		return nil, err
+	}
+	c.put(key, append([]StockHistory(nil), history...), c.historyTTL())
+	return history, nil
+}
+
+// FundFlow 与实时行情相同的缓存时间
+func (c *CachedMarketData) FundFlow(ctx context.Context, symbol string) (*StockFundFlow, error) {
+	fp, ok := c.Provider.(FundFlowProvider)
+	if !ok {
+		return nil, errors.New("行情数据源不支持资金流向")
+	}
+	key := "fundflow:" + symbol
+	if v, ok := c.get(key); ok {
+		flow := *v.(*StockFundFlow)
+		return &flow, nil
+	}
+	flow, err := fp.FundFlow(ctx, symbol)
+	if err != nil {
+		return nil, err
+	}
+	cached := *flow
+	c.put(key, &cached, c.quoteTTL())
+	return flow, nil
+}
+
+// parseEnvDuration 解析 "15s"、"5m" 或秒数；未设置或无效时返回 def
+func parseEnvDuration(name string, def time.Duration) time.Duration {
+	v := strings.TrimSpace(os.Getenv(name))
+	if v == "" {
+		return def
+	}
+	if d, err := time.ParseDuration(v); err == nil {
+		return max(d, 0)
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	return def
+}
+
+// MarketDataFromEnv 按 MEMO_MARKET_DATA（逗号分隔，默认 sina,eastmoney）依次组合行情数据源：
+// sina 新浪财经；eastmoney 东方财富（支持资金流向）；fixture 读取 MEMO_MARKET_FIXTURES_DIR
+// 下的 JSON 文件，用于离线开发和测试。MEMO_MARKET_QUOTE_TTL 设为 0 时不缓存
+func MarketDataFromEnv() MarketDataProvider {
+	var chain ChainMarketData
+	onlyFixtures := true
+	for _, name := range strings.Split(os.Getenv("MEMO_MARKET_DATA"), ",") {
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "":
+		case "sina":
+			chain = append(chain, &SinaMarketData{})
+			onlyFixtures = false
+		case "eastmoney":
+			chain = append(chain, &EastmoneyMarketData{})
+			onlyFixtures = false
+		case "fixture", "fixtures", "mock":
+			dir := strings.TrimSpace(os.Getenv("MEMO_MARKET_FIXTURES_DIR"))
+			if dir == "" {
+				log.Printf("MEMO_MARKET_DATA 包含 fixture，但未设置 MEMO_MARKET_FIXTURES_DIR，已跳过")
+				continue
+			}
+			chain = append(chain, &FixtureMarketData{Dir: dir})
+		default:
+			log.Printf("未知的行情数据源: %s", name)
+		}
+	}
+	if len(chain) == 0 {
+		chain = ChainMarketData{&SinaMarketData{}, &EastmoneyMarketData{}}
+		onlyFixtures = false
+	}
+	var p MarketDataProvider = chain
+	if len(chain) == 1 {
+		p = chain[0]
+	}
+	// 本地文件无需缓存
+	quoteTTL := parseEnvDuration("MEMO_MARKET_QUOTE_TTL", DefaultQuoteCacheTTL)
+	if onlyFixtures || quoteTTL <= 0 {
+		return p
+	}
+	return &CachedMarketData{
+		Provider:   p,
+		QuoteTTL:   quoteTTL,
+		HistoryTTL: parseEnvDuration("MEMO_MARKET_HISTORY_TTL", DefaultHistoryCacheTTL),
+	}
+}
+
+var (
+	marketData     MarketDataProvider
+	marketDataOnce sync.Once
+	marketDataMu   sync.RWMutex
+)
+
+// GetMarketData 默认行情数据源（见 MarketDataFromEnv）
+func GetMarketData() MarketDataProvider {
+	marketDataOnce.Do(func() {
+		marketDataMu.Lock()
+		defer marketDataMu.Unlock()
+		if marketData == nil {
+			marketData = MarketDataFromEnv()
+		}
+	})
+	marketDataMu.RLock()
+	defer marketDataMu.RUnlock()
+	return marketData
+}
+
+// SetMarketData 替换行情数据源（测试或自定义部署）
+func SetMarketData(p MarketDataProvider) {
+	marketDataOnce.Do(func() {})
+	marketDataMu.Lock()
+	defer marketDataMu.Unlock()
+	marketData = p
+}
@@ -0,0 +1,307 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+// recordedMarketServer 用 testdata/market 下录制的接口响应模拟新浪与东方财富
+func recordedMarketServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		var file string
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/list="):
+			if r.Header.Get("Referer") == "" {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			file = "sina_quote_unknown.txt"
+			if strings.TrimPrefix(r.URL.Path, "/list=") == "sh600519" {
+				file = "sina_quote_sh600519.txt"
+			}
+		case strings.HasSuffix(r.URL.Path, "KL_MarketDataService.getKLineData"):
+			file = "sina_kline_unknown.json"
+			if q.Get("symbol") == "sh600519" {
+				file = "sina_kline_sh600519.json"
+			}
+		case r.URL.Path == "/api/qt/stock/get":
+			switch q.Get("secid") {
+			case "1.600519":
+				file = "eastmoney_quote_600519.json"
+			case "0.000002":
+				file = "eastmoney_quote_suspended.json"
+			default:
+				file = "eastmoney_quote_unknown.json"
+			}
+		case r.URL.Path == "/api/qt/stock/kline/get":
+			file = "eastmoney_kline_unknown.json"
+			if q.Get("secid") == "1.600519" {
+				file = "eastmoney_kline_600519.json"
+			}
+		case r.URL.Path == "/api/qt/ulist.np/get" && q.Get("secids") == "1.600519":
+			file = "eastmoney_fflow_600519.json"
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		b, err := os.ReadFile(filepath.Join("testdata", "market", file))
+		if err != nil {
+			t.Errorf("read fixture: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func near(a, b, eps float64) bool { return math.Abs(a-b) <= eps }
+
+// 所有数据源对同一只股票应给出一致的结果（单位：成交量为手，成交额为万元）
+func TestMarketDataProviderContract(t *testing.T) {
+	srv := recordedMarketServer(t)
+	providers := []services.MarketDataProvider{
+		&services.SinaMarketData{QuoteURL: srv.URL, HistoryURL: srv.URL},
+		&services.EastmoneyMarketData{QuoteURL: srv.URL, HistoryURL: srv.URL},
+		&services.FixtureMarketData{Dir: filepath.Join("testdata", "market", "fixtures")},
+	}
+	ctx := context.Background()
+	for _, p := range providers {
+		t.Run(p.Name(), func(t *testing.T) {
+			q, err := p.Quote(ctx, "sh600519")
+			if err != nil {
+				t.Fatalf("Quote: %v", err)
+			}
+			if q.Code != "sh600519" || q.Name != "贵州茅台" || q.Market != "上海" {
+				t.Fatalf("quote identity = %q %q %q", q.Code, q.Name, q.Market)
+			}
+			if q.Price != 1712.3 || q.PreClose != 1698.16 || q.Open != 1705 || q.High != 1718.88 || q.Low != 1700.01 ||
+				!near(q.Change, 14.14, 0.005) || !near(q.ChangePercent, 0.83, 0.005) ||
+				q.Volume != 23456 || !near(q.Turnover, 401234.5678, 1) {
+				t.Fatalf("quote = %+v", q)
+			}
+			if !strings.HasPrefix(q.UpdateTime, "2024-05-10 15:00") {
+				t.Fatalf("update time = %q", q.UpdateTime)
+			}
+
+			h, err := p.History(ctx, "sh600519", 3)
+			if err != nil {
+				t.Fatalf("History: %v", err)
+			}
+			if len(h) != 3 || h[0].Date != "2024-05-08" || h[2].Date != "2024-05-10" {
+				t.Fatalf("history = %+v", h)
+			}
+			last := h[2]
+			if last.Open != 1705 || last.Close != 1712.3 || last.High != 1718.88 || last.Low != 1700.01 || last.Volume != 23456 {
+				t.Fatalf("last bar = %+v", last)
+			}
+			if all, err := p.History(ctx, "sh600519", 30); err != nil || len(all) != 5 {
+				t.Fatalf("History(30) = %d, %v", len(all), err)
+			}
+
+			if _, err := p.Quote(ctx, "sz300999"); !errors.Is(err, services.ErrStockNotFound) {
+				t.Fatalf("unknown quote err = %v", err)
+			}
+			if _, err := p.History(ctx, "sz300999", 10); !errors.Is(err, services.ErrStockNotFound) {
+				t.Fatalf("unknown history err = %v", err)
+			}
+		})
+	}
+}
+
+func TestEastmoneySuspendedAndFundFlow(t *testing.T) {
+	srv := recordedMarketServer(t)
+	em := &services.EastmoneyMarketData{QuoteURL: srv.URL, HistoryURL: srv.URL}
+	q, err := em.Quote(context.Background(), "sz000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Name != "万科A" || q.Market != "深圳" || q.Price != 7.02 || q.Change != 0 || q.Volume != 0 || q.PE != 0 {
+		t.Fatalf("suspended quote = %+v", q)
+	}
+
+	flow, err := em.FundFlow(context.Background(), "sh600519")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if flow.MainNetInflow != 123456789 || flow.MainNetInflowRate != 3.08 || flow.SmallNetInflow != -77777888 ||
+		flow.UpdateTime != "2024-05-10 15:00:03" {
+		t.Fatalf("fund flow = %+v", flow)
+	}
+}
+
+func TestMarketDataHTTPErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "busy", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	sina := &services.SinaMarketData{QuoteURL: srv.URL, HistoryURL: srv.URL}
+	if _, err := sina.Quote(context.Background(), "sh600519"); err == nil || errors.Is(err, services.ErrStockNotFound) {
+		t.Fatalf("err = %v", err)
+	}
+
+	// 失败的数据源跳过，取下一个
+	chain := services.ChainMarketData{sina, &services.FixtureMarketData{Dir: filepath.Join("testdata", "market", "fixtures")}}
+	if q, err := chain.Quote(context.Background(), "sh600519"); err != nil || q.Name != "贵州茅台" {
+		t.Fatalf("chain quote = %+v, %v", q, err)
+	}
+	if _, err := chain.Quote(context.Background(), "sz300999"); err == nil {
+		t.Fatal("chain should fail for unknown stock")
+	}
+}
+
+type countingMarketData struct {
+	quotes, histories int
+}
+
+func (c *countingMarketData) Name() string { return "counting" }
+
+func (c *countingMarketData) Quote(_ context.Context, symbol string) (*services.StockInfo, error) {
+	c.quotes++
+	return &services.StockInfo{Code: symbol, Price: float64(c.quotes)}, nil
+}
+
+func (c *countingMarketData) History(_ context.Context, symbol string, days int) ([]services.StockHistory, error) {
+	c.histories++
+	return []services.StockHistory{{Date: "2024-05-10", Close: float64(c.histories)}}, nil
+}
+
+func TestCachedMarketDataFollowsTradingHours(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	now := time.Date(2024, 5, 10, 10, 0, 0, 0, cst) // 周五上午交易时段
+	inner := &countingMarketData{}
+	cached := &services.CachedMarketData{Provider: inner, Now: func() time.Time { return now }}
+	ctx := context.Background()
+	quote := func() float64 {
+		q, err := cached.Quote(ctx, "sh600519")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return q.Price
+	}
+
+	if quote() != 1 || quote() != 1 {
+		t.Fatal("quote should be cached within ttl")
+	}
+	now = now.Add(services.DefaultQuoteCacheTTL + time.Second)
+	if quote() != 2 {
+		t.Fatal("quote should refresh after ttl")
+	}
+
+	// 午休：缓存到 13:00
+	now = time.Date(2024, 5, 10, 11, 45, 0, 0, cst)
+	if quote() != 3 {
+		t.Fatal("lunch break should fetch once")
+	}
+	now = time.Date(2024, 5, 10, 12, 59, 0, 0, cst)
+	if quote() != 3 {
+		t.Fatal("quote should be cached during lunch break")
+	}
+	now = time.Date(2024, 5, 10, 13, 0, 30, 0, cst)
+	if quote() != 4 {
+		t.Fatal("quote should refresh when afternoon session opens")
+	}
+
+	// 周五收盘后缓存到下周一开盘（最长 12 小时）
+	now = time.Date(2024, 5, 10, 15, 30, 0, 0, cst)
+	if quote() != 5 {
+		t.Fatal("after close should fetch once")
+	}
+	now = now.Add(11 * time.Hour)
+	if quote() != 5 {
+		t.Fatal("quote should be cached after close")
+	}
+	now = now.Add(2 * time.Hour)
+	if quote() != 6 {
+		t.Fatal("closed-market cache should be capped")
+	}
+
+	// 日 K 线在交易时段内按 HistoryTTL 缓存，不同 days 分别缓存
+	now = time.Date(2024, 5, 13, 9, 30, 0, 0, cst)
+	for i := 0; i < 3; i++ {
+		if _, err := cached.History(ctx, "sh600519", 60); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := cached.History(ctx, "sh600519", 20); err != nil {
+		t.Fatal(err)
+	}
+	if inner.histories != 2 {
+		t.Fatalf("history fetches = %d", inner.histories)
+	}
+	now = now.Add(services.DefaultHistoryCacheTTL + time.Second)
+	if h, _ := cached.History(ctx, "sh600519", 60); h[0].Close != 3 {
+		t.Fatalf("history should refresh after ttl: %+v", h)
+	}
+}
+
+func TestMarketOpen(t *testing.T) {
+	cst := time.FixedZone("CST", 8*3600)
+	cases := []struct {
+		at   time.Time
+		open bool
+	}{
+		{time.Date(2024, 5, 10, 9, 14, 0, 0, cst), false},
+		{time.Date(2024, 5, 10, 9, 15, 0, 0, cst), true},
+		{time.Date(2024, 5, 10, 11, 30, 0, 0, cst), false},
+		{time.Date(2024, 5, 10, 14, 59, 0, 0, cst), true},
+		{time.Date(2024, 5, 10, 15, 0, 0, 0, cst), false},
+		{time.Date(2024, 5, 11, 10, 0, 0, 0, cst), false},                      // 周六
+		{time.Date(2024, 5, 10, 2, 0, 0, 0, time.UTC), true},                   // 北京时间 10:00
+		{time.Date(2024, 5, 10, 7, 0, 0, 0, time.UTC).Add(-time.Second), true}, // 北京时间 14:59:59
+	}
+	for _, tc := range cases {
+		if got := services.MarketOpen(tc.at); got != tc.open {
+			t.Errorf("MarketOpen(%v) = %v", tc.at, got)
+		}
+	}
+}
+
+func TestMarketDataFromEnv(t *testing.T) {
+	dir := filepath.Join("testdata", "market", "fixtures")
+	t.Setenv("MEMO_MARKET_FIXTURES_DIR", dir)
+
+	t.Setenv("MEMO_MARKET_DATA", "fixture")
+	if _, ok := services.MarketDataFromEnv().(*services.FixtureMarketData); !ok {
+		t.Fatal("fixture only should not be cached")
+	}
+	t.Setenv("MEMO_MARKET_DATA", "fixture,eastmoney")
+	c, ok := services.MarketDataFromEnv().(*services.CachedMarketData)
+	if !ok || c.Name() != "fixture,eastmoney" {
+		t.Fatalf("provider = %#v", services.MarketDataFromEnv())
+	}
+	t.Setenv("MEMO_MARKET_QUOTE_TTL", "0")
+	if _, ok := services.MarketDataFromEnv().(services.ChainMarketData); !ok {
+		t.Fatal("ttl 0 should disable cache")
+	}
+
+	// GetStockInfo 等函数使用可替换的默认数据源，并接受多种代码写法
+	prev := services.GetMarketData()
+	services.SetMarketData(&services.FixtureMarketData{Dir: dir})
+	t.Cleanup(func() { services.SetMarketData(prev) })
+	if q, err := services.GetStockInfo("600519.SH"); err != nil || q.Code != "sh600519" {
+		t.Fatalf("GetStockInfo = %+v, %v", q, err)
+	}
+	if h, err := services.GetStockHistory("600519", 2); err != nil || len(h) != 2 || h[1].Date != "2024-05-10" {
+		t.Fatalf("GetStockHistory = %+v, %v", h, err)
+	}
+	if f, err := services.GetStockFundFlow("sh600519"); err != nil || f.MainNetInflow != 123456789 {
+		t.Fatalf("GetStockFundFlow = %+v, %v", f, err)
+	}
+	if _, err := services.GetStockInfo("abc"); err == nil {
+		t.Fatal("invalid code should fail")
+	}
+}
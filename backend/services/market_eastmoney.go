@@ -0,0 +1,242 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EastmoneyMarketData 东方财富：push2 实时行情与资金流向，push2his 日 K 线
+type EastmoneyMarketData struct {
+	QuoteURL   string // 默认 https://push2.eastmoney.com
+	HistoryURL string // 默认 https://push2his.eastmoney.com
+	Client     *http.Client
+}
+
+func (e *EastmoneyMarketData) Name() string { return "eastmoney" }
+
+// eastmoneySecID sh600519 → 1.600519，sz000001 → 0.000001
+func eastmoneySecID(symbol string) string {
+	if strings.HasPrefix(symbol, "sh") {
+		return "1." + symbol[2:]
+	}
+	return "0." + strings.TrimPrefix(symbol, "sz")
+}
+
+func (e *EastmoneyMarketData) quoteBase() string {
+	if base := strings.TrimRight(e.QuoteURL, "/"); base != "" {
+		return base
+	}
+	return "https://push2.eastmoney.com"
+}
+
+// emNumber 东方财富的数值字段：fltt=2 时为小数，停牌等无数据时为 "-"
+type emNumber float64
+
+func (n *emNumber) UnmarshalJSON(b []byte) error {
+	if len(b) > 0 && b[0] == '"' {
+		var s string
+		if err := json.Unmarshal(b, &s); err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			f = 0
+		}
+		*n = emNumber(f)
+		return nil
+	}
+	if bytes.Equal(b, []byte("null")) {
+		*n = 0
+		return nil
+	}
+	var f float64
+	if err := json.Unmarshal(b, &f); err != nil {
+		return err
+	}
+	*n = emNumber(f)
+	return nil
+}
+
+func (e *EastmoneyMarketData) Quote(ctx context.Context, symbol string) (*StockInfo, error) {
+	params := url.Values{
+		"secid":  {eastmoneySecID(symbol)},
+		"fltt":   {"2"},
+		"invt":   {"2"},
+		"fields": {"f43,f44,f45,f46,f47,f48,f57,f58,f60,f86,f116,f162,f167,f169,f170"},
+	}
+	body, err := marketGet(ctx, e.Client, e.quoteBase()+"/api/qt/stock/get?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseEastmoneyQuote(body, symbol)
+}
+
+// parseEastmoneyQuote 字段：f43 现价、f44 最高、f45 最低、f46 开盘、f47 成交量（手）、f48 成交额（元）、
+// f57 代码、f58 名称、f60 昨收、f86 时间戳、f116 总市值（元）、f162 市盈率、f167 市净率、f169 涨跌额、f170 涨跌幅。
+// 未知代码时 data 为 null
+func parseEastmoneyQuote(body []byte, symbol string) (*StockInfo, error) {
+	var resp struct {
+		RC   int `json:"rc"`
+		Data *struct {
+			Price     emNumber `json:"f43"`
+			High      emNumber `json:"f44"`
+			Low       emNumber `json:"f45"`
+			Open      emNumber `json:"f46"`
+			Volume    emNumber `json:"f47"`
+			Amount    emNumber `json:"f48"`
+			Code      string   `json:"f57"`
+			Name      string   `json:"f58"`
+			PreClose  emNumber `json:"f60"`
+			Timestamp int64    `json:"f86"`
+			MarketCap emNumber `json:"f116"`
+			PE        emNumber `json:"f162"`
+			PB        emNumber `json:"f167"`
+			Change    emNumber `json:"f169"`
+			ChangePct emNumber `json:"f170"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析东方财富行情数据失败: %v", err)
+	}
+	d := resp.Data
+	if d == nil || d.Name == "" {
+		return nil, ErrStockNotFound
+	}
+	info := &StockInfo{
+		Code:          symbol,
+		Name:          d.Name,
+		Market:        marketName(symbol),
+		Price:         float64(d.Price),
+		Change:        float64(d.Change),
+		ChangePercent: float64(d.ChangePct),
+		Open:          float64(d.Open),
+		PreClose:      float64(d.PreClose),
+		High:          float64(d.High),
+		Low:           float64(d.Low),
+		Volume:        int64(d.Volume),
+		Turnover:      float64(d.Amount) / 10000,
+		PE:            float64(d.PE),
+		PB:            float64(d.PB),
+		MarketCap:     float64(d.MarketCap) / 1e8,
+	}
+	if info.Price == 0 {
+		info.Price = info.PreClose
+	}
+	if info.MarketCap > 0 {
+		info.MarketCapStr = fmt.Sprintf("%.2f亿", info.MarketCap)
+	}
+	if d.Timestamp > 0 {
+		info.UpdateTime = time.Unix(d.Timestamp, 0).In(chinaMarketZone).Format("2006-01-02 15:04:05")
+	}
+	return info, nil
+}
+
+func (e *EastmoneyMarketData) History(ctx context.Context, symbol string, days int) ([]StockHistory, error) {
+	base := strings.TrimRight(e.HistoryURL, "/")
+	if base == "" {
+		base = "https://push2his.eastmoney.com"
+	}
+	params := url.Values{
+		"secid":   {eastmoneySecID(symbol)},
+		"fields1": {"f1,f2,f3"},
+		"fields2": {"f51,f52,f53,f54,f55,f56"},
+		"klt":     {"101"}, // 日 K
+		"fqt":     {"1"},   // 前复权
+		"end":     {"20500101"},
+		"lmt":     {strconv.Itoa(days)},
+	}
+	body, err := marketGet(ctx, e.Client, base+"/api/qt/stock/kline/get?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseEastmoneyKLine(body, days)
+}
+
+// parseEastmoneyKLine klines 每行为 "日期,开盘,收盘,最高,最低,成交量（手）"
+func parseEastmoneyKLine(body []byte, days int) ([]StockHistory, error) {
+	var resp struct {
+		Data *struct {
+			KLines []string `json:"klines"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析东方财富 K 线数据失败: %v", err)
+	}
+	if resp.Data == nil || len(resp.Data.KLines) == 0 {
+		return nil, ErrStockNotFound
+	}
+	history := make([]StockHistory, 0, len(resp.Data.KLines))
+	for _, line := range resp.Data.KLines {
+		f := strings.Split(line, ",")
+		if len(f) < 6 {
+			continue
+		}
+		history = append(history, StockHistory{
+			Date:   f[0],
+			Open:   parseFloat(f[1]),
+			Close:  parseFloat(f[2]),
+			High:   parseFloat(f[3]),
+			Low:    parseFloat(f[4]),
+			Volume: parseInt64(f[5]),
+		})
+	}
+	return lastDays(history, days), nil
+}
+
+// FundFlow 当日资金流向：f62 主力净流入、f184 主力净占比、f66 超大单、f72 大单、f78 中单、f84 小单（元）
+func (e *EastmoneyMarketData) FundFlow(ctx context.Context, symbol string) (*StockFundFlow, error) {
+	params := url.Values{
+		"secids": {eastmoneySecID(symbol)},
+		"fltt":   {"2"},
+		"fields": {"f12,f14,f62,f184,f66,f72,f78,f84,f124"},
+	}
+	body, err := marketGet(ctx, e.Client, e.quoteBase()+"/api/qt/ulist.np/get?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return parseEastmoneyFundFlow(body, symbol)
+}
+
+func parseEastmoneyFundFlow(body []byte, symbol string) (*StockFundFlow, error) {
+	var resp struct {
+		Data *struct {
+			Diff []struct {
+				Code      string   `json:"f12"`
+				Main      emNumber `json:"f62"`
+				MainRate  emNumber `json:"f184"`
+				Super     emNumber `json:"f66"`
+				Large     emNumber `json:"f72"`
+				Medium    emNumber `json:"f78"`
+				Small     emNumber `json:"f84"`
+				Timestamp int64    `json:"f124"`
+			} `json:"diff"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("解析东方财富资金流向失败: %v", err)
+	}
+	if resp.Data == nil || len(resp.Data.Diff) == 0 {
+		return nil, ErrStockNotFound
+	}
+	d := resp.Data.Diff[0]
+	flow := &StockFundFlow{
+		Code:              symbol,
+		MainNetInflow:     float64(d.Main),
+		MainNetInflowRate: float64(d.MainRate),
+		SuperNetInflow:    float64(d.Super),
+		LargeNetInflow:    float64(d.Large),
+		MediumNetInflow:   float64(d.Medium),
+		SmallNetInflow:    float64(d.Small),
+	}
+	if d.Timestamp > 0 {
+		flow.UpdateTime = time.Unix(d.Timestamp, 0).In(chinaMarketZone).Format("2006-01-02 15:04:05")
+	}
+	return flow, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// FixtureMarketData 从本地 JSON 文件读取行情，用于离线开发与测试。
+// 每只股票一个文件 <Dir>/sh600519.json：
+//
+//	{"quote": {...StockInfo}, "history": [{...StockHistory}], "fund_flow": {...StockFundFlow}}
+//
+// 文件每次读取，修改后立即生效；没有文件时返回 ErrStockNotFound
+type FixtureMarketData struct {
+	Dir string
+}
+
+// MarketFixture 行情文件内容
+type MarketFixture struct {
+	Quote    *StockInfo     `json:"quote"`
+	History  []StockHistory `json:"history"`
+	FundFlow *StockFundFlow `json:"fund_flow,omitempty"`
+}
+
+func (f *FixtureMarketData) Name() string { return "fixture" }
+
+func (f *FixtureMarketData) load(symbol string) (*MarketFixture, error) {
+	b, err := os.ReadFile(filepath.Join(f.Dir, symbol+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrStockNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var fx MarketFixture
+	if err := json.Unmarshal(b, &fx); err != nil {
+		return nil, fmt.Errorf("解析行情文件 %s 失败: %v", symbol+".json", err)
+	}
+	return &fx, nil
+}
+
+func (f *FixtureMarketData) Quote(_ context.Context, symbol string) (*StockInfo, error) {
+	fx, err := f.load(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if fx.Quote == nil {
+		return nil, ErrStockNotFound
+	}
+	info := *fx.Quote
+	info.Code = symbol
+	if info.Market == "" {
+		info.Market = marketName(symbol)
+	}
+	return &info, nil
+}
+
+// History 文件中的记录可以是任意顺序，返回时按日期升序
+func (f *FixtureMarketData) History(_ context.Context, symbol string, days int) ([]StockHistory, error) {
+	fx, err := f.load(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if len(fx.History) == 0 {
+		return nil, ErrStockNotFound
+	}
+	history := append([]StockHistory(nil), fx.History...)
+	sort.SliceStable(history, func(i, j int) bool { return history[i].Date < history[j].Date })
+	return lastDays(history, days), nil
+}
+
+func (f *FixtureMarketData) FundFlow(_ context.Context, symbol string) (*StockFundFlow, error) {
+	fx, err := f.load(symbol)
+	if err != nil {
+		return nil, err
+	}
+	if fx.FundFlow == nil {
+		return nil, ErrStockNotFound
+	}
+	flow := *fx.FundFlow
+	flow.Code = symbol
+	return &flow, nil
+}
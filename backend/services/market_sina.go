@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// SinaMarketData 新浪财经：hq.sinajs.cn 实时行情（GBK 编码）与 K 线接口
+type SinaMarketData struct {
+	QuoteURL   string // 默认 https://hq.sinajs.cn
+	HistoryURL string // 默认 https://quotes.sina.cn
+	Client     *http.Client
+}
+
+func (s *SinaMarketData) Name() string { return "sina" }
+
+// 新浪接口校验 Referer
+var sinaHeader = http.Header{
+	"Referer":    {"https://finance.sina.com.cn"},
+	"User-Agent": {"Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36"},
+}
+
+func (s *SinaMarketData) Quote(ctx context.Context, symbol string) (*StockInfo, error) {
+	base := strings.TrimRight(s.QuoteURL, "/")
+	if base == "" {
+		base = "https://hq.sinajs.cn"
+	}
+	body, err := marketGet(ctx, s.Client, base+"/list="+url.QueryEscape(symbol), sinaHeader)
+	if err != nil {
+		return nil, err
+	}
+	return parseSinaQuote(body, symbol)
+}
+
+// parseSinaQuote 解析 var hq_str_sh600519="贵州茅台,开盘,昨收,现价,最高,最低,买一,卖一,成交量(股),成交额(元),
+// 五档买卖盘×20,日期,时间,状态"; 未知代码返回空字符串
+func parseSinaQuote(body []byte, symbol string) (*StockInfo, error) {
+	text := string(body)
+	if !utf8.Valid(body) {
+		if decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(body); err == nil {
+			text = string(decoded)
+		}
+	}
+	start := strings.IndexByte(text, '"')
+	end := strings.LastIndexByte(text, '"')
+	if start < 0 || end <= start {
+		return nil, fmt.Errorf("新浪行情数据格式错误")
+	}
+	data := text[start+1 : end]
+	if data == "" {
+		return nil, ErrStockNotFound
+	}
+	parts := strings.Split(data, ",")
+	if len(parts) < 32 {
+		return nil, fmt.Errorf("新浪行情数据不完整")
+	}
+
+	info := &StockInfo{
+		Code:       symbol,
+		Name:       strings.TrimSpace(parts[0]),
+		Market:     marketName(symbol),
+		Open:       parseFloat(parts[1]),
+		PreClose:   parseFloat(parts[2]),
+		Price:      parseFloat(parts[3]),
+		High:       parseFloat(parts[4]),
+		Low:        parseFloat(parts[5]),
+		Volume:     parseInt64(parts[8]) / 100,   // 股 → 手
+		Turnover:   parseFloat(parts[9]) / 10000, // 元 → 万元
+		UpdateTime: strings.TrimSpace(parts[30] + " " + parts[31]),
+	}
+	// 停牌或集合竞价前现价为 0，按昨收计算
+	if info.Price == 0 {
+		info.Price = info.PreClose
+	}
+	if info.PreClose > 0 {
+		info.Change = info.Price - info.PreClose
+		info.ChangePercent = info.Change / info.PreClose * 100
+	}
+	return info, nil
+}
+
+func (s *SinaMarketData) History(ctx context.Context, symbol string, days int) ([]StockHistory, error) {
+	base := strings.TrimRight(s.HistoryURL, "/")
+	if base == "" {
+		base = "https://quotes.sina.cn"
+	}
+	params := url.Values{"symbol": {symbol}, "scale": {"240"}, "ma": {"no"}, "datalen": {strconv.Itoa(days)}}
+	body, err := marketGet(ctx, s.Client, base+"/cn/api/json.php/KL_MarketDataService.getKLineData?"+params.Encode(), sinaHeader)
+	if err != nil {
+		return nil, err
+	}
+	return parseSinaKLine(body, days)
+}
+
+// parseSinaKLine 解析 [{"day":"2024-05-06","open":"1700.000",...,"volume":"3000000"}]；
+// 数值为字符串，成交量单位为股。未知代码返回 null
+func parseSinaKLine(body []byte, days int) ([]StockHistory, error) {
+	var rows []struct {
+		Day    string      `json:"day"`
+		Open   json.Number `json:"open"`
+		High   json.Number `json:"high"`
+		Low    json.Number `json:"low"`
+		Close  json.Number `json:"close"`
+		Volume json.Number `json:"volume"`
+	}
+	if err := json.Unmarshal(body, &rows); err != nil {
+		return nil, fmt.Errorf("解析新浪 K 线数据失败: %v", err)
+	}
+	if len(rows) == 0 {
+		return nil, ErrStockNotFound
+	}
+	history := make([]StockHistory, 0, len(rows))
+	for _, r := range rows {
+		day := r.Day
+		if len(day) > 10 {
+			day = day[:10]
+		}
+		if _, err := time.Parse("2006-01-02", day); err != nil {
+			continue
+		}
+		history = append(history, StockHistory{
+			Date:   day,
+			Open:   parseFloat(r.Open.String()),
+			Close:  parseFloat(r.Close.String()),
+			High:   parseFloat(r.High.String()),
+			Low:    parseFloat(r.Low.String()),
+			Volume: parseInt64(r.Volume.String()) / 100,
+		})
+	}
+	return lastDays(history, days), nil
+}
@@ -0,0 +1,113 @@
+package services
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"memo-studio/backend/models"
+)
+
+// ===== 新建笔记后的后台任务（自动总结、自动打标、股票行情快照），单协程顺序执行 =====
+
+const noteJobQueueSize = 100
+
+// 后台任务类型
+const (
+	noteJobSummary     = "summary"
+	noteJobTags        = "tags"
+	noteJobStockQuotes = "stock-quotes"
+)
+
+var (
+	noteJobQueue chan noteJob
+	noteJobOnce  sync.Once
+)
+
+type noteJob struct {
+	kind   string
+	userID int
+	noteID int
+}
+
+// QueueNoteJobs 按用户设置为新笔记安排后台任务：
+// 开启自动总结且正文足够长时生成总结，开启自动打标时应用标签建议。
+// 队列已满时丢弃（用户仍可手动触发）
+func QueueNoteJobs(userID int, note *models.Note) {
+	if note == nil || note.Locked || userID <= 0 {
+		return
+	}
+	st, err := models.GetUserSettings(userID)
+	if err != nil {
+		return
+	}
+	if st.AutoSummarize && utf8.RuneCountInString(strings.TrimSpace(note.Content)) >= st.AutoSummarizeMinChars {
+		enqueueNoteJob(noteJob{kind: noteJobSummary, userID: userID, noteID: note.ID})
+	}
+	if st.AutoTag && strings.TrimSpace(note.Title+note.Content) != "" {
+		enqueueNoteJob(noteJob{kind: noteJobTags, userID: userID, noteID: note.ID})
+	}
+}
+
+func enqueueNoteJob(job noteJob) {
+	noteJobOnce.Do(func() {
+		noteJobQueue = make(chan noteJob, noteJobQueueSize)
+		go runNoteJobWorker(noteJobQueue)
+	})
+	select {
+	case noteJobQueue <- job:
+	default:
+		log.Printf("后台任务队列已满，跳过笔记 %d 的 %s 任务", job.noteID, job.kind)
+	}
+}
+
+func runNoteJobWorker(queue <-chan noteJob) {
+	for job := range queue {
+		var err error
+		switch job.kind {
+		case noteJobSummary:
+			err = runAutoSummary(job)
+		case noteJobTags:
+			err = runAutoTag(job)
+		case noteJobStockQuotes:
+			err = runStockQuotes(job)
+		}
+		if err != nil {
+			log.Printf("笔记 %d 的 %s 任务失败: %v", job.noteID, job.kind, err)
+		}
+	}
+}
+
+func runAutoSummary(job noteJob) error {
+	note, err := models.GetNote(job.noteID)
+	if err != nil || note == nil || note.Locked {
+		return nil
+	}
+	// 排队期间已有（手动）总结时不覆盖
+	if existing, err := models.GetNoteSummary(job.noteID); err != nil || existing != nil {
+		return err
+	}
+	svc := NewLLMServiceForUser(job.userID)
+	if !svc.Configured() {
+		return nil
+	}
+	svc.Endpoint = "JOB auto-summary"
+	_, _, err = SummarizeAndStoreNote(svc, note, true)
+	return err
+}
+
+func runAutoTag(job noteJob) error {
+	note, err := models.GetNote(job.noteID)
+	if err != nil || note == nil || note.Locked {
+		return nil
+	}
+	svc := NewLLMServiceForUser(job.userID)
+	svc.Endpoint = "JOB auto-tag"
+	suggestions, _, err := SuggestNoteTags(svc, job.userID, note, MaxNewTagSuggestions)
+	if err != nil {
+		return err
+	}
+	_, err = ApplyTagSuggestions(job.userID, job.noteID, suggestions)
+	return err
+}
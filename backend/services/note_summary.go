@@ -0,0 +1,35 @@
+package services
+
+import (
+	"errors"
+
+	"memo-studio/backend/models"
+)
+
+// ErrNoteLocked 加密笔记不支持 AI 总结
+var ErrNoteLocked = errors.New("加密笔记不支持 AI 总结")
+
+// SummarizeAndStoreNote 调用大模型总结笔记并保存；auto 表示由后台任务触发
+func SummarizeAndStoreNote(svc *LLMService, note *models.Note, auto bool) (*models.NoteSummary, bool, error) {
+	if note.Locked {
+		return nil, false, ErrNoteLocked
+	}
+	res, err := svc.GenerateSummary(SummarizeRequest{Content: note.Content})
+	if err != nil {
+		return nil, false, err
+	}
+	ns := models.NoteSummary{
+		NoteID:      note.ID,
+		Summary:     res.Summary,
+		Highlights:  res.Highlights,
+		ActionItems: res.ActionItems,
+		Provider:    res.Provider,
+		Model:       res.Model,
+		Auto:        auto,
+	}
+	if err := models.SaveNoteSummary(ns, note.UserID, note.Content); err != nil {
+		return nil, false, err
+	}
+	saved, err := models.GetNoteSummary(note.ID)
+	return saved, res.Cached, err
+}
@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 用户可填写地址的出站请求（推送地址、模型 base_url）共用的内网地址检查，防止 SSRF
+
+// cgnatNet 运营商级 NAT 地址段 100.64.0.0/10
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// blockedPrivateIP 本机、私有、链路本地（含云厂商元数据地址）、CGNAT、未指定与组播地址
+func blockedPrivateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		ip.IsMulticast() || cgnatNet.Contains(ip) || (ip.To4() != nil && ip.To4()[0] == 0)
+}
+
+// hostAllowedByEnv 管理员通过环境变量（逗号分隔的主机名或 IP）允许的内网主机
+func hostAllowedByEnv(env, host string) bool {
+	for _, h := range strings.Split(os.Getenv(env), ",") {
+		if h = strings.TrimSpace(h); h != "" && strings.EqualFold(h, host) {
+			return true
+		}
+	}
+	return false
+}
+
+// validatePublicURL 只允许 http/https，且不能直接指向本机或内网（allowEnv 中的主机除外）；
+// 域名在连接时解析后再由 guardedDialContext 检查
+func validatePublicURL(raw, allowEnv string, blocked error) error {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("地址必须是 http(s) URL")
+	}
+	host := u.Hostname()
+	if hostAllowedByEnv(allowEnv, host) {
+		return nil
+	}
+	if ip := net.ParseIP(host); (ip != nil && blockedPrivateIP(ip)) || strings.EqualFold(host, "localhost") {
+		return blocked
+	}
+	return nil
+}
+
+// guardedDialContext 在 DNS 解析之后、建立连接之前检查目标 IP（防止 DNS 重绑定），命中时返回 blocked
+func guardedDialContext(timeout time.Duration, blocked error) func(ctx context.Context, network, address string) (net.Conn, error) {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(_, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || blockedPrivateIP(ip) {
+				return blocked
+			}
+			return nil
+		},
+	}
+	return dialer.DialContext
+}
@@ -0,0 +1,369 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"memo-studio/backend/models"
+)
+
+// 模板来源
+const (
+	TemplateScopeUser     = "user"
+	TemplateScopeInstance = "instance"
+	TemplateScopeBuiltin  = "builtin"
+)
+
+// PromptTemplate 解析后的提示词模板
+type PromptTemplate struct {
+	ID           int    `json:"id,omitempty"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Scope        string `json:"scope"`
+	SystemPrompt string `json:"system_prompt"`
+	UserPrompt   string `json:"user_prompt"`
+	OutputSchema string `json:"output_schema,omitempty"`
+	Language     string `json:"language,omitempty"`
+	// Version 参与缓存键：内置模板为版本常量，自定义模板随修改时间变化
+	Version string `json:"-"`
+}
+
+// 内置模板（/summarize、/insights 与 /ai/run 使用；用户或实例可用同名模板覆盖）
+var builtinTemplates = map[string]PromptTemplate{
+	"summary": {
+		Name:         "summary",
+		Description:  "总结笔记内容，提取要点与待办",
+		SystemPrompt: "你是一个笔记总结助手。请用中文回复严格的 JSON 格式。",
+		UserPrompt: `请对以下内容进行总结，用中文回复严格的 JSON 格式：
+
+{
+  "summary": "内容总结（简洁）",
+  "highlights": ["要点1", "要点2"],
+  "action_items": ["可执行的任务或建议"]
+}
+
+内容：
+{{notes}}`,
+		OutputSchema: `{"type":"object","required":["summary"],"properties":{"summary":{"type":"string"},"highlights":{"type":"array","items":{"type":"string"}},"action_items":{"type":"array","items":{"type":"string"}}}}`,
+		Version:      PromptSummaryVersion,
+	},
+	"insight": {
+		Name:         "insight",
+		Description:  "分析一组笔记，给出关键词、情绪、趋势与建议",
+		SystemPrompt: "你是一个笔记分析助手。请用中文回复严格的 JSON 格式。",
+		UserPrompt: `分析以下笔记，提供洞察报告（用中文，JSON 格式）：
+
+{
+  "summary": "整体总结（1-2句话）",
+  "keywords": ["关键词1", "关键词2", "关键词3"],
+  "categories": ["分类1", "分类2"],
+  "sentiment": "positive/negative/neutral",
+  "trends": ["趋势1", "趋势2"],
+  "tips": ["建议1", "建议2"]
+}
+
+笔记内容：
+{{notes}}
+
+时间范围：{{time_range}}`,
+		OutputSchema: `{"type":"object","required":["summary"],"properties":{"summary":{"type":"string"},"keywords":{"type":"array","items":{"type":"string"}},"categories":{"type":"array","items":{"type":"string"}},"sentiment":{"type":"string"},"trends":{"type":"array","items":{"type":"string"}},"tips":{"type":"array","items":{"type":"string"}}}}`,
+		Version:      PromptInsightVersion,
+	},
+}
+
+// BuiltinTemplates 内置模板列表（按名称排序）
+func BuiltinTemplates() []PromptTemplate {
+	list := make([]PromptTemplate, 0, len(builtinTemplates))
+	for _, t := range builtinTemplates {
+		t.Scope = TemplateScopeBuiltin
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// IsBuiltinTemplate 是否为内置模板名
+func IsBuiltinTemplate(name string) bool {
+	_, ok := builtinTemplates[name]
+	return ok
+}
+
+func fromStoredTemplate(t models.PromptTemplate, scope string) *PromptTemplate {
+	return &PromptTemplate{
+		ID:           t.ID,
+		Name:         t.Name,
+		Description:  t.Description,
+		Scope:        scope,
+		SystemPrompt: t.SystemPrompt,
+		UserPrompt:   t.UserPrompt,
+		OutputSchema: t.OutputSchema,
+		Language:     t.Language,
+		Version:      fmt.Sprintf("tpl/%d/%d", t.ID, t.UpdatedAt.Unix()),
+	}
+}
+
+// ResolvePromptTemplate 按 用户模板 > 实例模板 > 内置模板 的顺序查找；找不到时返回 nil, nil
+func ResolvePromptTemplate(userID int, name string) (*PromptTemplate, error) {
+	if userID > 0 {
+		t, err := models.GetPromptTemplateByName(name, &userID)
+		if err != nil {
+			return nil, err
+		}
+		if t != nil {
+			return fromStoredTemplate(*t, TemplateScopeUser), nil
+		}
+	}
+	t, err := models.GetPromptTemplateByName(name, nil)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		return fromStoredTemplate(*t, TemplateScopeInstance), nil
+	}
+	if b, ok := builtinTemplates[name]; ok {
+		b.Scope = TemplateScopeBuiltin
+		return &b, nil
+	}
+	return nil, nil
+}
+
+// templateFor /summarize、/insights 等内置接口使用的模板：与 /ai/run 相同，
+// 用户或实例的同名模板优先于内置模板
+func (s *LLMService) templateFor(name string) (*PromptTemplate, error) {
+	tpl, err := ResolvePromptTemplate(s.UserID, name)
+	if err != nil {
+		return nil, fmt.Errorf("读取模板 %s 失败: %w", name, err)
+	}
+	if tpl == nil {
+		b := builtinTemplates[name]
+		b.Scope = TemplateScopeBuiltin
+		tpl = &b
+	}
+	return tpl, nil
+}
+
+var templateVarRe = regexp.MustCompile(`\{\{\s*([a-zA-Z_][a-zA-Z0-9_]*)\s*\}\}`)
+
+// RenderPrompt 替换 {{name}} 变量；未提供的变量原样保留
+func RenderPrompt(text string, vars map[string]string) string {
+	return templateVarRe.ReplaceAllStringFunc(text, func(m string) string {
+		name := templateVarRe.FindStringSubmatch(m)[1]
+		if v, ok := vars[name]; ok {
+			return v
+		}
+		return m
+	})
+}
+
+// TemplateVariables 模板支持的变量及说明
+var TemplateVariables = map[string]string{
+	"notes":      "选中笔记的内容（多条以 --- 分隔）",
+	"time_range": "时间范围说明",
+	"tags":       "选中笔记的标签（逗号分隔）",
+	"count":      "选中笔记数量",
+	"date":       "当天日期（YYYY-MM-DD）",
+	"language":   "输出语言",
+}
+
+// languageInstructions 常用输出语言的指令
+var languageInstructions = map[string]string{
+	"zh": "请使用简体中文回答。",
+	"en": "Respond in English.",
+	"ja": "日本語で回答してください。",
+	"ko": "한국어로 답변해 주세요.",
+	"fr": "Réponds en français.",
+	"de": "Antworte auf Deutsch.",
+	"es": "Responde en español.",
+}
+
+// LanguageInstruction 输出语言指令；未知语言代码按名称直接要求
+func LanguageInstruction(lang string) string {
+	lang = strings.TrimSpace(lang)
+	if lang == "" {
+		return ""
+	}
+	if v, ok := languageInstructions[strings.ToLower(lang)]; ok {
+		return v
+	}
+	return fmt.Sprintf("Respond in %s.", lang)
+}
+
+// FormatNotesForPrompt 把笔记格式化为提示词中的 {{notes}}
+func FormatNotesForPrompt(notes []models.Note) string {
+	parts := make([]string, 0, len(notes))
+	for _, n := range notes {
+		header := n.CreatedAt.Format("2006-01-02")
+		if t := strings.TrimSpace(n.Title); t != "" {
+			header += " " + t
+		}
+		parts = append(parts, "## "+header+"\n"+strings.TrimSpace(n.Content))
+	}
+	return strings.Join(parts, "\n---\n")
+}
+
+// NoteTagNames 笔记标签名（去重、按名称排序）
+func NoteTagNames(notes []models.Note) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, n := range notes {
+		for _, t := range n.Tags {
+			if !seen[t.Name] {
+				seen[t.Name] = true
+				names = append(names, t.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ErrTemplateOutputInvalid 模型输出未通过 JSON Schema 校验（含一次修复重试）
+var ErrTemplateOutputInvalid = errors.New("模型输出未通过 JSON Schema 校验")
+
+// TemplateOutputError 输出校验失败的详情
+type TemplateOutputError struct {
+	Reason string
+	Output string
+}
+
+func (e *TemplateOutputError) Error() string {
+	return ErrTemplateOutputInvalid.Error() + ": " + e.Reason
+}
+
+func (e *TemplateOutputError) Unwrap() error { return ErrTemplateOutputInvalid }
+
+// TemplateRunOptions 模板运行参数
+type TemplateRunOptions struct {
+	TimeRange string
+	Language  string // 覆盖模板默认语言
+	Validate  bool   // 模板定义了 output_schema 时校验输出
+}
+
+// TemplateRunResult 模板运行结果
+type TemplateRunResult struct {
+	Output   string `json:"output"`
+	JSON     any    `json:"json,omitempty"`
+	Provider string `json:"provider"`
+	Model    string `json:"model"`
+	Fallback bool   `json:"fallback,omitempty"`
+	Cached   bool   `json:"cached"`
+	Repaired bool   `json:"repaired,omitempty"` // 首次输出未通过校验，经修复重试后通过
+}
+
+// BuildTemplateMessages 渲染模板为对话消息
+func BuildTemplateMessages(tpl *PromptTemplate, vars map[string]string, language string, schema string) []ChatMessage {
+	system := RenderPrompt(tpl.SystemPrompt, vars)
+	extra := []string{}
+	if instr := LanguageInstruction(language); instr != "" {
+		extra = append(extra, instr)
+	}
+	if schema != "" {
+		extra = append(extra, "输出必须是符合以下 JSON Schema 的 JSON，不要包含其他文字：\n"+schema)
+	}
+	if len(extra) > 0 {
+		system = strings.TrimSpace(system + "\n\n" + strings.Join(extra, "\n"))
+	}
+	var messages []ChatMessage
+	if system != "" {
+		messages = append(messages, ChatMessage{Role: "system", Content: system})
+	}
+	return append(messages, ChatMessage{Role: "user", Content: RenderPrompt(tpl.UserPrompt, vars)})
+}
+
+// RunTemplate 把模板应用到笔记上：渲染变量、调用模型（带缓存），
+// 定义了 output_schema 且要求校验时，首次输出不合格会带上错误信息重试一次
+func (s *LLMService) RunTemplate(tpl *PromptTemplate, notes []models.Note, opts TemplateRunOptions) (*TemplateRunResult, error) {
+	language := opts.Language
+	if language == "" {
+		language = tpl.Language
+	}
+	vars := map[string]string{
+		"notes":      FormatNotesForPrompt(notes),
+		"time_range": opts.TimeRange,
+		"tags":       strings.Join(NoteTagNames(notes), ", "),
+		"count":      fmt.Sprintf("%d", len(notes)),
+		"date":       time.Now().Format("2006-01-02"),
+		"language":   language,
+	}
+
+	var schema map[string]any
+	schemaText := ""
+	if opts.Validate && strings.TrimSpace(tpl.OutputSchema) != "" {
+		var err error
+		if schema, err = ParseJSONSchema(tpl.OutputSchema); err != nil {
+			return nil, err
+		}
+		schemaText = tpl.OutputSchema
+	}
+	messages := BuildTemplateMessages(tpl, vars, language, schemaText)
+
+	noteIDs := make([]int, 0, len(notes))
+	for _, n := range notes {
+		noteIDs = append(noteIDs, n.ID)
+	}
+	key := LLMCacheKey(s.UserID, s.Model, tpl.Version, messages)
+	if res := s.cacheLookup(key); res != nil {
+		out := &TemplateRunResult{Output: res.Content, Provider: res.Provider, Model: res.Model, Fallback: res.Fallback, Cached: true}
+		if schema == nil {
+			return out, nil
+		}
+		// 缓存中的结果都已通过校验；校验规则变化时重新生成
+		if v, err := parseAndValidate(res.Content, schema); err == nil {
+			out.JSON = v
+			return out, nil
+		}
+	}
+
+	ctx := context.Background()
+	res, err := s.ChatContext(ctx, messages)
+	if err != nil {
+		return nil, err
+	}
+	out := &TemplateRunResult{Output: res.Content, Provider: res.Provider, Model: res.Model, Fallback: res.Fallback}
+	if schema != nil {
+		v, verr := parseAndValidate(res.Content, schema)
+		if verr != nil {
+			repair := append(append([]ChatMessage{}, messages...),
+				ChatMessage{Role: "assistant", Content: res.Content},
+				ChatMessage{Role: "user", Content: "上面的输出未通过校验：" + verr.Error() + "。请只返回修正后的 JSON。"},
+			)
+			res, err = s.ChatContext(ctx, repair)
+			if err != nil {
+				return nil, err
+			}
+			if v, verr = parseAndValidate(res.Content, schema); verr != nil {
+				return nil, &TemplateOutputError{Reason: verr.Error(), Output: res.Content}
+			}
+			out = &TemplateRunResult{Output: res.Content, Provider: res.Provider, Model: res.Model, Fallback: res.Fallback, Repaired: true}
+		}
+		out.JSON = v
+	}
+	s.cacheStore(key, tpl.Version, res, noteIDs, nil)
+	return out, nil
+}
+
+// stripCodeFence 去掉 markdown 代码块包裹
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	s = strings.TrimPrefix(s, "```json")
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
+
+func parseAndValidate(output string, schema map[string]any) (any, error) {
+	var v any
+	if err := json.Unmarshal([]byte(stripCodeFence(output)), &v); err != nil {
+		return nil, fmt.Errorf("不是有效的 JSON: %v", err)
+	}
+	if err := ValidateJSONSchema(schema, v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
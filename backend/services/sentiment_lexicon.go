@@ -0,0 +1,114 @@
+package services
+
+// 离线情感分析使用的中英文情感词典：正数为积极、负数为消极，绝对值为强度（1-3）。
+// 中文按最长匹配切分，所以“不错”“不好”这类固定搭配直接收录为词条。
+var sentimentLexicon = map[string]float64{
+	// 中文 · 积极
+	"开心": 2, "高兴": 2, "快乐": 2, "愉快": 2, "幸福": 3, "满足": 2, "满意": 2, "喜欢": 2,
+	"喜爱": 2, "热爱": 3, "享受": 2, "兴奋": 2, "激动": 1, "惊喜": 2, "感动": 2, "感激": 2,
+	"感谢": 2, "感恩": 2, "温暖": 2, "舒服": 2, "轻松": 1, "放松": 1, "平静": 1, "安心": 2,
+	"踏实": 2, "自信": 2, "充实": 2, "顺利": 2, "成功": 2, "收获": 2, "进步": 2, "成长": 1,
+	"突破": 2, "完美": 3, "优秀": 2, "精彩": 2, "漂亮": 1, "美好": 2, "有趣": 1, "好玩": 1,
+	"期待": 1, "希望": 1, "乐观": 2, "积极": 1, "高效": 2, "专注": 1, "值得": 1, "骄傲": 2,
+	"欣慰": 2, "痛快": 2, "棒": 2, "赞": 2, "爽": 2, "好": 1, "不错": 2,
+	"哈哈": 1, "笑": 1, "爱": 2,
+
+	// 中文 · 消极
+	"难过": -2, "伤心": -2, "悲伤": -3, "痛苦": -3, "失望": -2, "沮丧": -2, "郁闷": -2, "烦": -1,
+	"烦躁": -2, "烦恼": -2, "焦虑": -2, "担心": -1, "担忧": -2, "紧张": -1, "害怕": -2, "恐惧": -3,
+	"生气": -2, "愤怒": -3, "讨厌": -2, "后悔": -2, "孤独": -2, "寂寞": -2, "无聊": -1, "疲惫": -2,
+	"累": -1, "困": -1, "崩溃": -3, "绝望": -3, "压力": -1, "失败": -2, "困难": -1, "麻烦": -1,
+	"糟糕": -2, "倒霉": -2, "委屈": -2, "遗憾": -1, "尴尬": -1, "迷茫": -2, "失眠": -2, "拖延": -1,
+	"生病": -2, "头疼": -2, "难受": -2, "不好": -1, "不爽": -2, "不开心": -2, "哭": -2, "痛": -2,
+	"差": -1, "烂": -2, "错过": -1, "抱怨": -1, "吵架": -2, "争吵": -2, "内耗": -2, "心累": -2,
+
+	// English · positive
+	"happy": 2, "glad": 2, "joy": 2, "joyful": 2, "love": 2, "loved": 2, "like": 1, "enjoy": 2,
+	"enjoyed": 2, "great": 2, "good": 1, "nice": 1, "excellent": 3, "amazing": 3, "awesome": 3,
+	"wonderful": 3, "fantastic": 3, "perfect": 3, "beautiful": 2, "fun": 1, "excited": 2,
+	"exciting": 2, "grateful": 2, "thankful": 2, "proud": 2, "calm": 1, "relaxed": 1, "peaceful": 2,
+	"confident": 2, "hopeful": 1, "success": 2, "successful": 2, "progress": 1, "productive": 2,
+	"win": 2, "won": 2, "achieved": 2, "accomplished": 2, "satisfied": 2, "pleased": 2,
+	"delighted": 3, "inspired": 2, "motivated": 2, "better": 1, "best": 2, "smooth": 1, "cheerful": 2,
+
+	// English · negative
+	"sad": -2, "unhappy": -2, "upset": -2, "angry": -2, "mad": -2, "annoyed": -1, "frustrated": -2,
+	"frustrating": -2, "anxious": -2, "anxiety": -2, "worried": -2, "worry": -1, "stress": -1,
+	"stressed": -2, "tired": -1, "exhausted": -2, "bored": -1, "boring": -1, "lonely": -2,
+	"depressed": -3, "terrible": -3, "awful": -3, "horrible": -3, "bad": -1, "worse": -2,
+	"worst": -3, "hate": -3, "hated": -3, "fail": -2, "failed": -2, "failure": -2, "problem": -1,
+	"difficult": -1, "hard": -1, "pain": -2, "painful": -2, "sick": -2, "hurt": -2, "afraid": -2,
+	"scared": -2, "fear": -2, "regret": -2, "disappointed": -2, "disappointing": -2, "mess": -1,
+	"lost": -1, "cry": -2, "cried": -2, "broke": -1, "broken": -2, "overwhelmed": -2,
+}
+
+// sentimentNegators 否定词：作用于其后几个词内的第一个情感词
+var sentimentNegators = map[string]bool{
+	"不": true, "没": true, "没有": true, "别": true, "未": true, "无": true, "并不": true, "不太": true,
+	"不是": true, "毫不": true, "从不": true, "一点也不": true,
+	"not": true, "no": true, "never": true, "without": true, "hardly": true, "nothing": true,
+	"don't": true, "doesn't": true, "didn't": true, "isn't": true, "wasn't": true, "aren't": true,
+	"weren't": true, "can't": true, "cannot": true, "couldn't": true, "won't": true, "wouldn't": true,
+	"shouldn't": true, "haven't": true, "hasn't": true, "hadn't": true,
+}
+
+// sentimentIntensifiers 程度副词：放大（>1）或减弱（<1）紧随其后的情感词
+var sentimentIntensifiers = map[string]float64{
+	"很": 1.3, "非常": 1.6, "特别": 1.5, "十分": 1.5, "太": 1.5, "超": 1.5, "超级": 1.6, "极其": 1.8,
+	"真": 1.3, "好": 1.3, "挺": 1.2, "相当": 1.4, "更": 1.2, "最": 1.6, "有点": 0.7, "有些": 0.7,
+	"稍微": 0.6, "比较": 0.9, "略": 0.6,
+	"very": 1.5, "really": 1.4, "so": 1.3, "extremely": 1.8, "super": 1.5, "quite": 1.2, "too": 1.3,
+	"incredibly": 1.8, "totally": 1.5, "slightly": 0.6, "somewhat": 0.7, "kinda": 0.7, "pretty": 1.2,
+}
+
+// 行动视角的中英文提示词：计划中的事与已完成的事
+var (
+	actionTodoWords = []string{"待办", "计划", "打算", "准备", "需要", "记得", "明天要", "todo", "plan", "planning", "need", "should", "tomorrow"}
+	actionDoneWords = []string{"完成", "搞定", "解决", "做完", "写完", "done", "finished", "completed", "solved", "shipped"}
+)
+
+// commonChineseWords 常用词：切分中文时作为整体，避免关键词跨词截断（如“项目会议”不会产生“目会”）
+var commonChineseWords = []string{
+	"今天", "明天", "昨天", "现在", "时候", "时间", "周末", "晚上", "早上", "上午", "下午", "中午",
+	"朋友", "家人", "同事", "老板", "孩子", "父母", "妈妈", "爸爸", "老师", "客户", "团队",
+	"工作", "项目", "任务", "会议", "需求", "方案", "报告", "计划", "目标", "进度", "上线", "代码",
+	"学习", "读书", "课程", "知识", "考试", "笔记", "文章", "电影", "音乐", "旅行", "旅游", "爬山",
+	"跑步", "运动", "锻炼", "健身", "健康", "睡觉", "睡眠", "吃饭", "做饭", "散步", "游泳",
+	"理财", "收入", "消费", "投资", "股票", "基金", "工资", "房租",
+	"因为", "所以", "但是", "然后", "已经", "可以", "还是", "一个", "什么", "自己", "觉得",
+	"这个", "那个", "我们", "他们", "你们", "一些", "一下", "一起", "如果", "虽然", "还有",
+	"应该", "可能", "需要", "开始", "结束", "继续", "感觉", "事情", "问题", "东西",
+}
+
+// keywordStopWords 关键词提取时忽略的虚词与高频泛用词
+var keywordStopWords = map[string]bool{
+	"今天": true, "明天": true, "昨天": true, "现在": true, "时候": true, "因为": true, "所以": true,
+	"但是": true, "然后": true, "已经": true, "可以": true, "还是": true, "一个": true, "什么": true,
+	"自己": true, "觉得": true, "这个": true, "那个": true, "我们": true, "他们": true, "你们": true,
+	"一些": true, "一下": true, "一起": true, "如果": true, "虽然": true, "还有": true, "应该": true,
+	"可能": true, "需要": true, "感觉": true, "事情": true, "东西": true, "没有": true,
+
+	"the": true, "a": true, "an": true, "and": true, "or": true, "but": true, "if": true, "of": true,
+	"to": true, "in": true, "on": true, "at": true, "for": true, "with": true, "by": true, "from": true,
+	"as": true, "is": true, "are": true, "was": true, "were": true, "be": true, "been": true,
+	"being": true, "am": true, "do": true, "does": true, "did": true, "have": true, "has": true,
+	"had": true, "i": true, "me": true, "my": true, "we": true, "our": true, "you": true,
+	"your": true, "he": true, "she": true, "it": true, "its": true, "they": true, "them": true,
+	"their": true, "this": true, "that": true, "these": true, "those": true, "there": true,
+	"here": true, "what": true, "which": true, "who": true, "when": true, "where": true, "why": true,
+	"how": true, "all": true, "any": true, "some": true, "more": true, "most": true, "other": true,
+	"so": true, "than": true, "too": true, "very": true, "can": true, "will": true, "just": true,
+	"not": true, "no": true, "about": true, "into": true, "up": true, "out": true, "then": true,
+	"also": true, "would": true, "could": true, "should": true, "today": true, "tomorrow": true,
+	"yesterday": true, "really": true, "get": true, "got": true, "im": true, "it's": true, "i'm": true,
+}
+
+// keywordStopChars 中文关键词不跨越的单字虚词
+var keywordStopChars = map[rune]bool{
+	'的': true, '了': true, '是': true, '在': true, '我': true, '你': true, '他': true, '她': true,
+	'它': true, '们': true, '这': true, '那': true, '和': true, '与': true, '就': true, '都': true,
+	'也': true, '还': true, '又': true, '很': true, '吗': true, '呢': true, '吧': true, '啊': true,
+	'呀': true, '把': true, '被': true, '给': true, '让': true, '个': true, '着': true, '过': true,
+	'而': true, '及': true, '或': true, '但': true, '么': true, '之': true, '其': true, '从': true,
+	'得': true, '地': true, '去': true, '来': true, '不': true, '没': true, '太': true, '挺': true,
+}
@@ -1,10 +1,10 @@
 package services
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"net/url"
 	"strings"
 	"time"
@@ -78,43 +78,13 @@ type StockSearch struct {
 	Market string `json:"market"`
 }
 
-// GetStockInfo 获取股票实时信息
+// GetStockInfo 获取股票实时信息（数据源见 MarketDataFromEnv）
 func GetStockInfo(stockCode string) (*StockInfo, error) {
-	// 转换股票代码格式
-	code := formatStockCode(stockCode)
-	if code == "" {
+	symbol := marketSymbol(stockCode)
+	if symbol == "" {
 		return nil, fmt.Errorf("无效的股票代码")
 	}
-
-	// 使用新浪财经 API
-	apiURL := fmt.Sprintf("https://hq.sinajs.cn/list=%s", code)
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
-	}
-	req.Header.Set("Referer", "http://finance.sina.com.cn")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取数据失败: %v", err)
-	}
-
-	// 解析新浪财经数据格式
-	// 格式: var hq_str_sh600519="贵州茅台,1680.50,1665.00,1685.00,1690.00,1660.00,1670.00,23456789,3.89亿,0.14%,28.5,1680.50,2026-02-17 10:30:00";
-	stockInfo, err := parseSinaResponse(string(body), code)
-	if err != nil {
-		return nil, err
-	}
-
-	return stockInfo, nil
+	return GetMarketData().Quote(context.Background(), symbol)
 }
 
 // formatStockCode 格式化股票代码
@@ -139,51 +109,17 @@ func formatStockCode(code string) string {
 	return ""
 }
 
-// GetStockFundFlow 获取股票资金流向
+// GetStockFundFlow 获取股票资金流向（需要支持资金流向的数据源，如东方财富）
 func GetStockFundFlow(stockCode string) (*StockFundFlow, error) {
-	code := formatStockCode(stockCode)
-	if code == "" {
+	symbol := marketSymbol(stockCode)
+	if symbol == "" {
 		return nil, fmt.Errorf("无效的股票代码")
 	}
-
-	// 使用东方财富资金流向 API
-	apiURL := fmt.Sprintf("http://push2.eastmoney.com/api/qt/stock/get?secid=%s&fields=f43,f50,f51,f52,f53,f54,f55,f57,f58,f59,f60,f61,f62,f63,f64,f65,f66,f67,f68,f69,f70",
-		getSecID(code))
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, fmt.Errorf("读取数据失败: %v", err)
-	}
-
-	var result struct {
-		Data struct {
-			F43 float64 `json:"f43"` // 主力净流入
-		} `json:"data"`
-	}
-
-	if err := json.Unmarshal(body, &result); err != nil {
-		return nil, fmt.Errorf("解析数据失败: %v", err)
+	fp, ok := GetMarketData().(FundFlowProvider)
+	if !ok {
+		return nil, fmt.Errorf("行情数据源不支持资金流向")
 	}
-
-	return &StockFundFlow{
-		Code:          stockCode,
-		MainNetInflow: result.Data.F43,
-		UpdateTime:    time.Now().Format("2006-01-02 15:04:05"),
-	}, nil
-}
-
-// getSecID 获取东方财富 secid
-func getSecID(code string) string {
-	if strings.HasPrefix(code, "sh") {
-		return "1." + code[2:]
-	}
-	return "0." + code[2:]
+	return fp.FundFlow(context.Background(), symbol)
 }
 
 // GetStockFinance 获取股票财务数据
@@ -193,23 +129,7 @@ func GetStockFinance(stockCode string) (*StockFinance, error) {
 		return nil, fmt.Errorf("无效的股票代码")
 	}
 
-	// 使用新浪财经财务数据
-	apiURL := fmt.Sprintf("https://hq.sinajs.cn/list=%s", code)
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("创建请求失败: %v", err)
-	}
-	req.Header.Set("Referer", "http://finance.sina.com.cn")
-	req.Header.Set("User-Agent", "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36")
-
-	client := &http.Client{Timeout: 10 * time.Second}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 解析财务数据（简化版）
+	// 暂无财务数据源，返回空数据（简化版）
 	return &StockFinance{
 		Code:       stockCode,
 		ReportDate: time.Now().Format("2006-01-02"),
@@ -227,62 +147,13 @@ func GetStockHolders(stockCode string) ([]StockHolder, error) {
 	return []StockHolder{}, nil
 }
 
-// parseSinaResponse 解析新浪财经响应
-func parseSinaResponse(response, code string) (*StockInfo, error) {
-	// 提取数据部分
-	start := strings.Index(response, "=")
-	if start == -1 {
-		return nil, fmt.Errorf("数据格式错误")
-	}
-
-	dataStr := response[start+2 : len(response)-2]
-	parts := strings.Split(dataStr, ",")
-
-	if len(parts) < 32 {
-		return nil, fmt.Errorf("数据不完整")
-	}
-
-	// 解析数据
-	stockInfo := &StockInfo{
-		Code:       code,
-		Name:       parts[0],
-		Open:       parseFloat(parts[1]),
-		PreClose:   parseFloat(parts[2]),
-		Price:      parseFloat(parts[3]), // 当前价
-		High:       parseFloat(parts[4]),
-		Low:        parseFloat(parts[5]),
-		Volume:     parseInt64(parts[8]),
-		Turnover:   parseFloat(parts[9]),
-		Change:     parseFloat(parts[31]),
-		UpdateTime: parts[30],
-	}
-
-	// 计算涨跌幅
-	if stockInfo.PreClose > 0 {
-		stockInfo.ChangePercent = (stockInfo.Change / stockInfo.PreClose) * 100
-	}
-
-	// 设置市场
-	if strings.HasPrefix(code, "sh") {
-		stockInfo.Market = "上海"
-	} else {
-		stockInfo.Market = "深圳"
-	}
-
-	// 估算 PE 和市值（需要额外 API）
-	stockInfo.PE = 0
-	stockInfo.MarketCap = 0
-
-	return stockInfo, nil
-}
-
 // GetStockList 获取股票列表
 func GetStockList(keyword string) ([]StockSearch, error) {
 	// 使用同花顺股票API
 	apiURL := fmt.Sprintf("http://search.tianyancha.com/api/v4/stock/search?keyword=%s",
 		url.QueryEscape(keyword))
 
-	resp, err := http.Get(apiURL)
+	resp, err := marketDataClient.Get(apiURL)
 	if err != nil {
 		return nil, err
 	}
@@ -333,56 +204,23 @@ func parseInt64(s string) int64 {
 	return int64(f)
 }
 
-// GetStockHistory 获取股票历史数据
+// maxHistoryDays 一次最多获取的交易日数
+const maxHistoryDays = 1000
+
+// GetStockHistory 获取最近 days 个交易日的日 K 线，按日期升序
 func GetStockHistory(stockCode string, days int) ([]StockHistory, error) {
-	code := formatStockCode(stockCode)
-	if code == "" {
+	symbol := marketSymbol(stockCode)
+	if symbol == "" {
 		return nil, fmt.Errorf("无效的股票代码")
 	}
 
-	// 使用新浪财经历史数据 API
-	// 格式: https://finance.sina.com.cn/realstock/company/sh600519/nc.shtml
-	apiURL := fmt.Sprintf("https://quotes.sina.cn/cn/api/json.php/KL_MarketDataService.getKLineData?symbol=%s&scale=240&ma=no&datalen=%d",
-		code, days)
-
-	resp, err := http.Get(apiURL)
-	if err != nil {
-		return nil, err
+	if days <= 0 {
+		days = 30
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// 解析 JSON
-	var data []struct {
-		D string  `json:"d"` // 日期
-		O float64 `json:"o"` // 开盘
-		C float64 `json:"c"` // 收盘
-		H float64 `json:"h"` // 最高
-		L float64 `json:"l"` // 最低
-		V int64   `json:"v"` // 成交量
+	if days > maxHistoryDays {
+		days = maxHistoryDays
 	}
-
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
-	}
-
-	history := make([]StockHistory, 0, len(data))
-	for _, d := range data {
-		history = append(history, StockHistory{
-			Date:   d.D,
-			Open:   d.O,
-			Close:  d.C,
-			High:   d.H,
-			Low:    d.L,
-			Volume: d.V,
-		})
-	}
-
-	return history, nil
+	return GetMarketData().History(context.Background(), symbol, days)
 }
 
 // StockHistory 股票历史数据
@@ -392,7 +230,7 @@ type StockHistory struct {
 	Close  float64 `json:"close"`
 	High   float64 `json:"high"`
 	Low    float64 `json:"low"`
-	Volume int64   `json:"volume"`
+	Volume int64   `json:"volume"` // 成交量（手）
 }
 
 // StockAnalysis 股票分析结果
@@ -402,17 +240,30 @@ type StockAnalysis struct {
 	Suggestion  string        `json:"suggestion"`
 	Risks       []string     `json:"risks"`
 	Tips        []string     `json:"tips"`
+	Indicators  *IndicatorSnapshot `json:"indicators,omitempty"` // 最近一个交易日的技术指标
+	Narrative   string        `json:"narrative,omitempty"`  // AI 对指标的解读
 }
 
 // AnalysisSignal 分析信号
 type AnalysisSignal struct {
-	Type string `json:"type"` // technical, volume, valuation
+	Type string `json:"type"` // technical, volume, valuation, volatility
+	Key  string `json:"key,omitempty"`  // 技术指标信号标识，如 macd_golden_cross
+	Tone string `json:"tone,omitempty"` // bullish, bearish, neutral
 	Icon string `json:"icon"`
 	Text string `json:"text"`
 }
 
-// AnalyzeStock 分析股票
+// analysisHistoryDays 分析时获取的交易日数，足够计算 MA60 与 MACD
+const analysisHistoryDays = 120
+
+// AnalyzeStock 分析股票；获取不到 K 线时只根据当日行情分析
 func AnalyzeStock(stock *StockInfo) *StockAnalysis {
+	history, _ := GetStockHistory(stock.Code, analysisHistoryDays)
+	return AnalyzeStockWithHistory(stock, history)
+}
+
+// AnalyzeStockWithHistory 根据当日行情与日 K 线（按日期升序）分析股票
+func AnalyzeStockWithHistory(stock *StockInfo, history []StockHistory) *StockAnalysis {
 	analysis := &StockAnalysis{
 		Summary: fmt.Sprintf("%s（%s）今日%s%.2f元（%.2f%%），当前价格¥%.2f",
 			stock.Name,
@@ -468,10 +319,24 @@ func AnalyzeStock(stock *StockInfo) *StockAnalysis {
 		}
 	}
 
-	// 建议
-	if stock.Change > 3 {
+	// 技术指标
+	score := 0
+	if len(history) > 0 {
+		ind := ComputeIndicators(history)
+		analysis.Indicators = ind.Latest()
+		technical := IndicatorSignals(ind)
+		score = signalScore(technical)
+		analysis.Signals = append(analysis.Signals, technical...)
+	}
+
+	// 建议：技术指标明显偏多或偏空时以指标为准，否则看当日涨跌幅
+	if score >= 2 {
+		analysis.Suggestion = "多项技术指标偏多，可持有，回调时关注均线支撑"
+	} else if score <= -2 {
+		analysis.Suggestion = "多项技术指标偏空，建议控制仓位观望，注意止损"
+	} else if stock.ChangePercent > 3 {
 		analysis.Suggestion = "涨幅较大，建议减仓或观望"
-	} else if stock.Change < -3 {
+	} else if stock.ChangePercent < -3 {
 		analysis.Suggestion = "跌幅较大，关注支撑位，可适当补仓"
 	} else if stock.Change > 0 {
 		analysis.Suggestion = "可持有，关注上方压力位"
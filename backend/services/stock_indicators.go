@@ -0,0 +1,501 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// IndicatorValues 指标序列，与 K 线逐日对齐；数据不足的位置为 NaN，JSON 中输出 null
+type IndicatorValues []float64
+
+func (v IndicatorValues) MarshalJSON() ([]byte, error) {
+	b := make([]byte, 0, len(v)*10+2)
+	b = append(b, '[')
+	for i, x := range v {
+		if i > 0 {
+			b = append(b, ',')
+		}
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			b = append(b, "null"...)
+		} else {
+			b = strconv.AppendFloat(b, math.Round(x*1e4)/1e4, 'f', -1, 64)
+		}
+	}
+	return append(b, ']'), nil
+}
+
+// at 第 i 个值，越界时为 NaN
+func (v IndicatorValues) at(i int) float64 {
+	if i < 0 || i >= len(v) {
+		return math.NaN()
+	}
+	return v[i]
+}
+
+func nanSeries(n int) IndicatorValues {
+	v := make(IndicatorValues, n)
+	for i := range v {
+		v[i] = math.NaN()
+	}
+	return v
+}
+
+// MACDSeries MACD(12,26,9)：DIF 为快慢 EMA 之差，DEA 为 DIF 的 9 日 EMA，柱状值为 2×(DIF−DEA)
+type MACDSeries struct {
+	DIF  IndicatorValues `json:"dif"`
+	DEA  IndicatorValues `json:"dea"`
+	Hist IndicatorValues `json:"hist"`
+}
+
+// RSISeries 6、12、24 日相对强弱指标
+type RSISeries struct {
+	RSI6  IndicatorValues `json:"rsi6"`
+	RSI12 IndicatorValues `json:"rsi12"`
+	RSI24 IndicatorValues `json:"rsi24"`
+}
+
+// KDJSeries KDJ(9,3,3)
+type KDJSeries struct {
+	K IndicatorValues `json:"k"`
+	D IndicatorValues `json:"d"`
+	J IndicatorValues `json:"j"`
+}
+
+// BollSeries 布林带(20,2)
+type BollSeries struct {
+	Upper  IndicatorValues `json:"upper"`
+	Middle IndicatorValues `json:"middle"`
+	Lower  IndicatorValues `json:"lower"`
+}
+
+// StockIndicators 按日 K 线计算的技术指标，各序列与 Dates 对齐
+type StockIndicators struct {
+	Dates      []string        `json:"dates"`
+	Close      IndicatorValues `json:"close"`
+	MA5        IndicatorValues `json:"ma5"`
+	MA10       IndicatorValues `json:"ma10"`
+	MA20       IndicatorValues `json:"ma20"`
+	MA60       IndicatorValues `json:"ma60"`
+	MACD       MACDSeries      `json:"macd"`
+	RSI        RSISeries       `json:"rsi"`
+	KDJ        KDJSeries       `json:"kdj"`
+	Boll       BollSeries      `json:"boll"`
+	Volatility IndicatorValues `json:"volatility"` // 20 日年化波动率（%）
+}
+
+// 指标参数
+const (
+	macdFast, macdSlow, macdSignal = 12, 26, 9
+	kdjPeriod                      = 9
+	bollPeriod, bollWidth          = 20, 2.0
+	volatilityPeriod               = 20
+	tradingDaysPerYear             = 252
+
+	// IndicatorWarmupDays 指标稳定所需的额外交易日（MA60 需要 60 日，MACD 的 EMA 需要更长的预热）
+	IndicatorWarmupDays = 60
+)
+
+// movingAverage n 日简单移动平均
+func movingAverage(x []float64, n int) IndicatorValues {
+	out := nanSeries(len(x))
+	sum := 0.0
+	for i, v := range x {
+		sum += v
+		if i >= n {
+			sum -= x[i-n]
+		}
+		if i >= n-1 {
+			out[i] = sum / float64(n)
+		}
+	}
+	return out
+}
+
+// ema 指数移动平均，以第一个有效值为初值（与常见行情软件一致）；NaN 视为尚无数据
+func ema(x []float64, n int) IndicatorValues {
+	out := nanSeries(len(x))
+	alpha := 2 / float64(n+1)
+	prev := math.NaN()
+	for i, v := range x {
+		if math.IsNaN(v) {
+			continue
+		}
+		if math.IsNaN(prev) {
+			prev = v
+		} else {
+			prev = alpha*v + (1-alpha)*prev
+		}
+		out[i] = prev
+	}
+	return out
+}
+
+// macd 前 slow-1 个 DIF 与其后 signal-1 个 DEA 尚未稳定，置为 NaN
+func macd(closes []float64) MACDSeries {
+	fast, slow := ema(closes, macdFast), ema(closes, macdSlow)
+	dif := nanSeries(len(closes))
+	for i := macdSlow - 1; i < len(closes); i++ {
+		dif[i] = fast[i] - slow[i]
+	}
+	dea := ema(dif, macdSignal)
+	hist := nanSeries(len(closes))
+	for i := range dea {
+		if i < macdSlow+macdSignal-2 {
+			dea[i] = math.NaN()
+			continue
+		}
+		hist[i] = 2 * (dif[i] - dea[i])
+	}
+	return MACDSeries{DIF: dif, DEA: dea, Hist: hist}
+}
+
+// rsi Wilder 平滑：上涨幅度均值 /（上涨 + 下跌幅度均值）× 100
+func rsi(closes []float64, n int) IndicatorValues {
+	out := nanSeries(len(closes))
+	var up, down float64
+	for i := 1; i < len(closes); i++ {
+		change := closes[i] - closes[i-1]
+		gain, loss := math.Max(change, 0), math.Max(-change, 0)
+		if i == 1 {
+			up, down = gain, loss
+		} else {
+			up = (up*float64(n-1) + gain) / float64(n)
+			down = (down*float64(n-1) + loss) / float64(n)
+		}
+		if i < n {
+			continue
+		}
+		if up+down == 0 {
+			out[i] = 50
+		} else {
+			out[i] = up / (up + down) * 100
+		}
+	}
+	return out
+}
+
+// kdj RSV =（收盘 − n 日最低）/（n 日最高 − n 日最低）× 100，K、D 为前值与新值 2:1 加权，初值 50
+func kdj(history []StockHistory) KDJSeries {
+	n := len(history)
+	s := KDJSeries{K: nanSeries(n), D: nanSeries(n), J: nanSeries(n)}
+	k, d := 50.0, 50.0
+	for i := kdjPeriod - 1; i < n; i++ {
+		low, high := history[i].Low, history[i].High
+		for j := i - kdjPeriod + 1; j < i; j++ {
+			low, high = math.Min(low, history[j].Low), math.Max(high, history[j].High)
+		}
+		rsv := 50.0
+		if high > low {
+			rsv = (history[i].Close - low) / (high - low) * 100
+		}
+		k = (2*k + rsv) / 3
+		d = (2*d + k) / 3
+		s.K[i], s.D[i], s.J[i] = k, d, 3*k-2*d
+	}
+	return s
+}
+
+// stddev 标准差；sample 为 true 时除以 n−1
+func stddev(x []float64, sample bool) float64 {
+	if len(x) < 2 {
+		return math.NaN()
+	}
+	mean := 0.0
+	for _, v := range x {
+		mean += v
+	}
+	mean /= float64(len(x))
+	sum := 0.0
+	for _, v := range x {
+		sum += (v - mean) * (v - mean)
+	}
+	n := float64(len(x))
+	if sample {
+		n--
+	}
+	return math.Sqrt(sum / n)
+}
+
+func bollinger(closes []float64, mid IndicatorValues) BollSeries {
+	s := BollSeries{Upper: nanSeries(len(closes)), Middle: mid, Lower: nanSeries(len(closes))}
+	for i := bollPeriod - 1; i < len(closes); i++ {
+		sd := stddev(closes[i-bollPeriod+1:i+1], false)
+		s.Upper[i], s.Lower[i] = mid[i]+bollWidth*sd, mid[i]-bollWidth*sd
+	}
+	return s
+}
+
+// volatility 近 n 日对数收益率的样本标准差，年化后以百分比表示
+func volatility(closes []float64, n int) IndicatorValues {
+	out := nanSeries(len(closes))
+	returns := make([]float64, len(closes))
+	for i := 1; i < len(closes); i++ {
+		if closes[i-1] > 0 && closes[i] > 0 {
+			returns[i] = math.Log(closes[i] / closes[i-1])
+		}
+	}
+	for i := n; i < len(closes); i++ {
+		out[i] = stddev(returns[i-n+1:i+1], true) * math.Sqrt(tradingDaysPerYear) * 100
+	}
+	return out
+}
+
+// ComputeIndicators 计算技术指标；history 须按日期升序
+func ComputeIndicators(history []StockHistory) *StockIndicators {
+	n := len(history)
+	ind := &StockIndicators{Dates: make([]string, n), Close: make(IndicatorValues, n)}
+	for i, h := range history {
+		ind.Dates[i], ind.Close[i] = h.Date, h.Close
+	}
+	closes := []float64(ind.Close)
+	ind.MA5 = movingAverage(closes, 5)
+	ind.MA10 = movingAverage(closes, 10)
+	ind.MA20 = movingAverage(closes, 20)
+	ind.MA60 = movingAverage(closes, 60)
+	ind.MACD = macd(closes)
+	ind.RSI = RSISeries{RSI6: rsi(closes, 6), RSI12: rsi(closes, 12), RSI24: rsi(closes, 24)}
+	ind.KDJ = kdj(history)
+	ind.Boll = bollinger(closes, movingAverage(closes, bollPeriod))
+	ind.Volatility = volatility(closes, volatilityPeriod)
+	return ind
+}
+
+// Tail 只保留最近 n 个交易日（用于去掉预热数据后绘图）
+func (ind *StockIndicators) Tail(n int) *StockIndicators {
+	if n <= 0 || n >= len(ind.Dates) {
+		return ind
+	}
+	from := len(ind.Dates) - n
+	cut := func(v IndicatorValues) IndicatorValues { return v[from:] }
+	return &StockIndicators{
+		Dates:      ind.Dates[from:],
+		Close:      cut(ind.Close),
+		MA5:        cut(ind.MA5),
+		MA10:       cut(ind.MA10),
+		MA20:       cut(ind.MA20),
+		MA60:       cut(ind.MA60),
+		MACD:       MACDSeries{DIF: cut(ind.MACD.DIF), DEA: cut(ind.MACD.DEA), Hist: cut(ind.MACD.Hist)},
+		RSI:        RSISeries{RSI6: cut(ind.RSI.RSI6), RSI12: cut(ind.RSI.RSI12), RSI24: cut(ind.RSI.RSI24)},
+		KDJ:        KDJSeries{K: cut(ind.KDJ.K), D: cut(ind.KDJ.D), J: cut(ind.KDJ.J)},
+		Boll:       BollSeries{Upper: cut(ind.Boll.Upper), Middle: cut(ind.Boll.Middle), Lower: cut(ind.Boll.Lower)},
+		Volatility: cut(ind.Volatility),
+	}
+}
+
+// IndicatorSnapshot 最近一个交易日的指标值；数据不足的为 null
+type IndicatorSnapshot struct {
+	Date       string   `json:"date"`
+	Close      float64  `json:"close"`
+	MA5        *float64 `json:"ma5"`
+	MA10       *float64 `json:"ma10"`
+	MA20       *float64 `json:"ma20"`
+	MA60       *float64 `json:"ma60"`
+	DIF        *float64 `json:"dif"`
+	DEA        *float64 `json:"dea"`
+	MACD       *float64 `json:"macd"`
+	RSI6       *float64 `json:"rsi6"`
+	RSI12      *float64 `json:"rsi12"`
+	RSI24      *float64 `json:"rsi24"`
+	K          *float64 `json:"k"`
+	D          *float64 `json:"d"`
+	J          *float64 `json:"j"`
+	BollUpper  *float64 `json:"boll_upper"`
+	BollMiddle *float64 `json:"boll_middle"`
+	BollLower  *float64 `json:"boll_lower"`
+	Volatility *float64 `json:"volatility"`
+}
+
+// Latest 最近一个交易日的指标；没有数据时返回 nil
+func (ind *StockIndicators) Latest() *IndicatorSnapshot {
+	i := len(ind.Dates) - 1
+	if i < 0 {
+		return nil
+	}
+	val := func(v IndicatorValues) *float64 {
+		x := v.at(i)
+		if math.IsNaN(x) {
+			return nil
+		}
+		x = math.Round(x*1e4) / 1e4
+		return &x
+	}
+	return &IndicatorSnapshot{
+		Date:       ind.Dates[i],
+		Close:      ind.Close[i],
+		MA5:        val(ind.MA5),
+		MA10:       val(ind.MA10),
+		MA20:       val(ind.MA20),
+		MA60:       val(ind.MA60),
+		DIF:        val(ind.MACD.DIF),
+		DEA:        val(ind.MACD.DEA),
+		MACD:       val(ind.MACD.Hist),
+		RSI6:       val(ind.RSI.RSI6),
+		RSI12:      val(ind.RSI.RSI12),
+		RSI24:      val(ind.RSI.RSI24),
+		K:          val(ind.KDJ.K),
+		D:          val(ind.KDJ.D),
+		J:          val(ind.KDJ.J),
+		BollUpper:  val(ind.Boll.Upper),
+		BollMiddle: val(ind.Boll.Middle),
+		BollLower:  val(ind.Boll.Lower),
+		Volatility: val(ind.Volatility),
+	}
+}
+
+// 信号倾向
+const (
+	SignalBullish = "bullish"
+	SignalBearish = "bearish"
+	SignalNeutral = "neutral"
+)
+
+// signalLookbackDays 交叉信号只看最近几个交易日
+const signalLookbackDays = 3
+
+// crossAt a 在第 i 日上穿 b 返回 1，下穿返回 -1，否则 0
+func crossAt(a, b IndicatorValues, i int) int {
+	a0, b0, a1, b1 := a.at(i-1), b.at(i-1), a.at(i), b.at(i)
+	if math.IsNaN(a0) || math.IsNaN(b0) || math.IsNaN(a1) || math.IsNaN(b1) {
+		return 0
+	}
+	switch {
+	case a0 <= b0 && a1 > b1:
+		return 1
+	case a0 >= b0 && a1 < b1:
+		return -1
+	}
+	return 0
+}
+
+// recentCross 最近 signalLookbackDays 个交易日内最后一次交叉的方向与日期下标
+func recentCross(a, b IndicatorValues) (dir, at int) {
+	last := len(a) - 1
+	for i := last; i > last-signalLookbackDays && i > 0; i-- {
+		if d := crossAt(a, b, i); d != 0 {
+			return d, i
+		}
+	}
+	return 0, -1
+}
+
+// IndicatorSignals 根据技术指标生成信号：均线、MACD、KDJ 交叉，RSI/KDJ 超买超卖，
+// 突破布林带，均线排列与波动率
+func IndicatorSignals(ind *StockIndicators) []AnalysisSignal {
+	var signals []AnalysisSignal
+	last := len(ind.Dates) - 1
+	if last < 1 {
+		return signals
+	}
+	add := func(key, tone, icon, text string) {
+		signals = append(signals, AnalysisSignal{Type: "technical", Key: key, Tone: tone, Icon: icon, Text: text})
+	}
+	day := func(i int) string { return ind.Dates[i] }
+
+	if dir, i := recentCross(ind.MA5, ind.MA20); dir > 0 {
+		add("ma_golden_cross", SignalBullish, "📈", fmt.Sprintf("%s MA5 上穿 MA20 形成金叉，短期走势转强", day(i)))
+	} else if dir < 0 {
+		add("ma_death_cross", SignalBearish, "📉", fmt.Sprintf("%s MA5 下穿 MA20 形成死叉，短期走势转弱", day(i)))
+	}
+	ma5, ma10, ma20, ma60 := ind.MA5.at(last), ind.MA10.at(last), ind.MA20.at(last), ind.MA60.at(last)
+	if !math.IsNaN(ma60) {
+		if ma5 > ma10 && ma10 > ma20 && ma20 > ma60 {
+			add("ma_bullish_alignment", SignalBullish, "🚀", "均线多头排列（MA5 > MA10 > MA20 > MA60），中期趋势向上")
+		} else if ma5 < ma10 && ma10 < ma20 && ma20 < ma60 {
+			add("ma_bearish_alignment", SignalBearish, "🧊", "均线空头排列（MA5 < MA10 < MA20 < MA60），中期趋势向下")
+		}
+	}
+
+	if dir, i := recentCross(ind.MACD.DIF, ind.MACD.DEA); dir != 0 {
+		axis := "零轴下方"
+		if ind.MACD.DIF.at(i) > 0 {
+			axis = "零轴上方"
+		}
+		if dir > 0 {
+			add("macd_golden_cross", SignalBullish, "📈", fmt.Sprintf("%s MACD 在%s金叉（DIF 上穿 DEA）", day(i), axis))
+		} else {
+			add("macd_death_cross", SignalBearish, "📉", fmt.Sprintf("%s MACD 在%s死叉（DIF 下穿 DEA）", day(i), axis))
+		}
+	}
+
+	if dir, i := recentCross(ind.KDJ.K, ind.KDJ.D); dir > 0 {
+		add("kdj_golden_cross", SignalBullish, "📈", fmt.Sprintf("%s KDJ 金叉（K 上穿 D）", day(i)))
+	} else if dir < 0 {
+		add("kdj_death_cross", SignalBearish, "📉", fmt.Sprintf("%s KDJ 死叉（K 下穿 D）", day(i)))
+	}
+	if j := ind.KDJ.J.at(last); j > 100 {
+		add("kdj_overbought", SignalBearish, "🔥", fmt.Sprintf("KDJ 的 J 值 %.1f 超过 100，短线超买", j))
+	} else if j < 0 {
+		add("kdj_oversold", SignalBullish, "❄️", fmt.Sprintf("KDJ 的 J 值 %.1f 低于 0，短线超卖", j))
+	}
+
+	if r := ind.RSI.RSI6.at(last); r >= 80 {
+		add("rsi_overbought", SignalBearish, "🔥", fmt.Sprintf("RSI6 为 %.1f，进入超买区（≥ 80）", r))
+	} else if r <= 20 {
+		add("rsi_oversold", SignalBullish, "❄️", fmt.Sprintf("RSI6 为 %.1f，进入超卖区（≤ 20）", r))
+	}
+
+	if c, up, low := ind.Close.at(last), ind.Boll.Upper.at(last), ind.Boll.Lower.at(last); c > up {
+		add("boll_break_upper", SignalNeutral, "⬆️", fmt.Sprintf("收盘价 %.2f 突破布林上轨 %.2f，走势强但偏离均值", c, up))
+	} else if c < low {
+		add("boll_break_lower", SignalNeutral, "⬇️", fmt.Sprintf("收盘价 %.2f 跌破布林下轨 %.2f，走势弱但可能超跌", c, low))
+	}
+
+	if v := ind.Volatility.at(last); v >= 50 {
+		signals = append(signals, AnalysisSignal{Type: "volatility", Key: "high_volatility", Tone: SignalNeutral, Icon: "🌊",
+			Text: fmt.Sprintf("20 日年化波动率 %.1f%%，波动剧烈", v)})
+	} else if v <= 15 {
+		signals = append(signals, AnalysisSignal{Type: "volatility", Key: "low_volatility", Tone: SignalNeutral, Icon: "🌤️",
+			Text: fmt.Sprintf("20 日年化波动率 %.1f%%，走势平稳", v)})
+	}
+	return signals
+}
+
+// signalScore 看多信号 +1，看空信号 −1
+func signalScore(signals []AnalysisSignal) int {
+	score := 0
+	for _, s := range signals {
+		switch s.Tone {
+		case SignalBullish:
+			score++
+		case SignalBearish:
+			score--
+		}
+	}
+	return score
+}
+
+// PromptStockNarrativeVersion 技术指标解读提示词版本
+const PromptStockNarrativeVersion = "stock-narrative/v1"
+
+// ExplainStockIndicators 请大模型根据最新技术指标与信号写一段解读
+func (s *LLMService) ExplainStockIndicators(stock *StockInfo, analysis *StockAnalysis) (string, *ChatResult, error) {
+	data, _ := json.MarshalIndent(struct {
+		Code       string             `json:"code"`
+		Name       string             `json:"name"`
+		Price      float64            `json:"price,omitempty"`
+		ChangePct  float64            `json:"change_percent,omitempty"`
+		Indicators *IndicatorSnapshot `json:"indicators"`
+		Signals    []AnalysisSignal   `json:"signals"`
+	}{stock.Code, stock.Name, stock.Price, stock.ChangePercent, analysis.Indicators, analysis.Signals}, "", "  ")
+
+	prompt := fmt.Sprintf(`下面是一只 A 股的最新技术指标（MA 为均线，DIF/DEA/MACD 为 MACD 指标，RSI、KDJ、BOLL 为布林带，volatility 为 20 日年化波动率 %%）和程序识别出的信号：
+
+%s
+
+请用中文写一段 150 字以内的解读：说明当前趋势、动能与超买超卖状态，指出信号之间是否矛盾，以及需要关注的价位。不要给出确定性的买卖建议，只输出解读正文。`, data)
+
+	messages := []ChatMessage{
+		{Role: "system", Content: "你是一个严谨的股票技术分析助手，只根据给出的数据解读，不编造数据。"},
+		{Role: "user", Content: prompt},
+	}
+
+	chat, _, err := s.cachedChat(context.Background(), PromptStockNarrativeVersion, messages, nil, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	return strings.TrimSpace(chat.Content), chat, nil
+}
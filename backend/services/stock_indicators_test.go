@@ -0,0 +1,174 @@
+package services_test
+
+import (
+	"encoding/json"
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"memo-studio/backend/services"
+)
+
+// barsFromCloses 由收盘价构造日 K 线，最高/最低为收盘价 ±1
+func barsFromCloses(closes []float64) []services.StockHistory {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	bars := make([]services.StockHistory, len(closes))
+	for i, c := range closes {
+		bars[i] = services.StockHistory{
+			Date:  start.AddDate(0, 0, i).Format("2006-01-02"),
+			Open:  c,
+			Close: c,
+			High:  c + 1,
+			Low:   c - 1,
+		}
+	}
+	return bars
+}
+
+func approx(a, b float64) bool { return math.Abs(a-b) < 1e-6 }
+
+func signalKeys(signals []services.AnalysisSignal) string {
+	keys := make([]string, 0, len(signals))
+	for _, s := range signals {
+		keys = append(keys, s.Key)
+	}
+	return strings.Join(keys, ",")
+}
+
+func TestComputeIndicatorsKnownValues(t *testing.T) {
+	// 收盘价 1, 2, ..., 80
+	closes := make([]float64, 80)
+	for i := range closes {
+		closes[i] = float64(i + 1)
+	}
+	ind := services.ComputeIndicators(barsFromCloses(closes))
+
+	if !math.IsNaN(ind.MA5[3]) || !approx(ind.MA5[4], 3) || !approx(ind.MA20[79], 70.5) || !approx(ind.MA60[79], 50.5) {
+		t.Fatalf("ma5[3]=%v ma5[4]=%v ma20=%v ma60=%v", ind.MA5[3], ind.MA5[4], ind.MA20[79], ind.MA60[79])
+	}
+	// 单边上涨：RSI 为 100，DIF 为正且在 DEA 之上
+	if !math.IsNaN(ind.RSI.RSI6[5]) || !approx(ind.RSI.RSI6[6], 100) || !approx(ind.RSI.RSI24[79], 100) {
+		t.Fatalf("rsi6[5]=%v rsi6[6]=%v rsi24=%v", ind.RSI.RSI6[5], ind.RSI.RSI6[6], ind.RSI.RSI24[79])
+	}
+	if !math.IsNaN(ind.MACD.DIF[24]) || !math.IsNaN(ind.MACD.DEA[32]) || math.IsNaN(ind.MACD.DEA[33]) {
+		t.Fatalf("macd warmup dif[24]=%v dea[32]=%v dea[33]=%v", ind.MACD.DIF[24], ind.MACD.DEA[32], ind.MACD.DEA[33])
+	}
+	if dif, dea := ind.MACD.DIF[79], ind.MACD.DEA[79]; !(dif > 0 && dif >= dea) || !approx(ind.MACD.Hist[79], 2*(dif-dea)) {
+		t.Fatalf("dif=%v dea=%v hist=%v", dif, dea, ind.MACD.Hist[79])
+	}
+	// 布林中轨即 MA20，上下轨对称；1..20 的总体标准差为 sqrt(33.25)
+	if mid, up, low := ind.Boll.Middle[19], ind.Boll.Upper[19], ind.Boll.Lower[19]; !approx(mid, 10.5) || !approx(up-mid, 2*math.Sqrt(33.25)) || !approx(mid-low, up-mid) {
+		t.Fatalf("boll = %v %v %v", up, mid, low)
+	}
+	if k := ind.KDJ.K[79]; k < 50 || k > 100 {
+		t.Fatalf("k = %v", k)
+	}
+
+	if len(ind.Tail(10).Dates) != 10 || ind.Tail(10).MA5[9] != ind.MA5[79] || ind.Tail(0) != ind {
+		t.Fatal("Tail")
+	}
+	latest := ind.Latest()
+	if latest.Date != "2024-03-20" || latest.Close != 80 || latest.MA60 == nil || *latest.MA60 != 50.5 {
+		t.Fatalf("latest = %+v", latest)
+	}
+}
+
+func TestComputeIndicatorsFlatSeries(t *testing.T) {
+	closes := make([]float64, 40)
+	for i := range closes {
+		closes[i] = 10
+	}
+	ind := services.ComputeIndicators(barsFromCloses(closes))
+	last := len(closes) - 1
+	if !approx(ind.RSI.RSI6[last], 50) || !approx(ind.KDJ.K[last], 50) || !approx(ind.MACD.DIF[last], 0) || !approx(ind.Volatility[last], 0) {
+		t.Fatalf("rsi=%v k=%v dif=%v vol=%v", ind.RSI.RSI6[last], ind.KDJ.K[last], ind.MACD.DIF[last], ind.Volatility[last])
+	}
+	if got := signalKeys(services.IndicatorSignals(ind)); got != "low_volatility" {
+		t.Fatalf("signals = %s", got)
+	}
+	// 数据不足的位置输出 null，其余保留 4 位小数
+	b, err := json.Marshal(services.IndicatorValues{math.NaN(), 1.234567, 2})
+	if err != nil || string(b) != "[null,1.2346,2]" {
+		t.Fatalf("json = %s, %v", b, err)
+	}
+	b, _ = json.Marshal(ind.Latest())
+	if !strings.Contains(string(b), `"ma60":null`) {
+		t.Fatalf("latest json = %s", b)
+	}
+}
+
+func TestIndicatorSignalsCrossovers(t *testing.T) {
+	// 60 日阴跌后连续大涨，找到 MA5 上穿 MA20 的那一天
+	closes := make([]float64, 0, 80)
+	for i := 0; i < 60; i++ {
+		closes = append(closes, 100-float64(i)*0.5)
+	}
+	var ind *services.StockIndicators
+	for len(closes) < 80 {
+		closes = append(closes, closes[len(closes)-1]+3)
+		ind = services.ComputeIndicators(barsFromCloses(closes))
+		last := len(closes) - 1
+		if ind.MA5[last] > ind.MA20[last] {
+			break
+		}
+	}
+	signals := services.IndicatorSignals(ind)
+	var golden *services.AnalysisSignal
+	for i := range signals {
+		if signals[i].Key == "ma_golden_cross" {
+			golden = &signals[i]
+		}
+		if strings.HasSuffix(signals[i].Key, "death_cross") {
+			t.Fatalf("unexpected %s", signals[i].Key)
+		}
+	}
+	if golden == nil || golden.Tone != services.SignalBullish || !strings.Contains(golden.Text, ind.Dates[len(ind.Dates)-1]) {
+		t.Fatalf("signals = %+v", signals)
+	}
+
+	// 反过来：长期上涨后连续大跌出现死叉
+	for i := range closes {
+		closes[i] = 200 - closes[i]
+	}
+	keys := signalKeys(services.IndicatorSignals(services.ComputeIndicators(barsFromCloses(closes))))
+	if !strings.Contains(keys, "ma_death_cross") || strings.Contains(keys, "golden_cross") {
+		t.Fatalf("signals = %s", keys)
+	}
+}
+
+func TestAnalyzeStockWithHistory(t *testing.T) {
+	// 没有 K 线时按涨跌幅（而不是涨跌额）给建议
+	stock := &services.StockInfo{Code: "sh600519", Name: "贵州茅台", Price: 1500, Change: 15, ChangePercent: 1}
+	a := services.AnalyzeStockWithHistory(stock, nil)
+	if a.Indicators != nil || a.Suggestion != "可持有，关注上方压力位" {
+		t.Fatalf("analysis = %+v", a)
+	}
+
+	// 横盘后向上突破：均线、MACD、KDJ 同时金叉，看多信号占优
+	closes := make([]float64, 0, 82)
+	for i := 0; i < 80; i++ {
+		closes = append(closes, 100)
+	}
+	closes = append(closes, 101, 102)
+	a = services.AnalyzeStockWithHistory(stock, barsFromCloses(closes))
+	if a.Indicators == nil || a.Indicators.MA60 == nil || a.Indicators.Date != "2024-03-22" {
+		t.Fatalf("indicators = %+v", a.Indicators)
+	}
+	keys := signalKeys(a.Signals)
+	for _, key := range []string{"ma_golden_cross", "ma_bullish_alignment", "macd_golden_cross", "kdj_golden_cross", "rsi_overbought"} {
+		if !strings.Contains(keys, key) {
+			t.Fatalf("missing %s in %s", key, keys)
+		}
+	}
+	if a.Suggestion != "多项技术指标偏多，可持有，回调时关注均线支撑" {
+		t.Fatalf("suggestion = %s (%s)", a.Suggestion, keys)
+	}
+
+	// 向下跌破则相反
+	closes[80], closes[81] = 99, 98
+	a = services.AnalyzeStockWithHistory(stock, barsFromCloses(closes))
+	if keys := signalKeys(a.Signals); !strings.Contains(keys, "macd_death_cross") || a.Suggestion != "多项技术指标偏空，建议控制仓位观望，注意止损" {
+		t.Fatalf("suggestion = %s (%s)", a.Suggestion, keys)
+	}
+}
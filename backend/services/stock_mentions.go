@@ -0,0 +1,353 @@
+package services
+
+import (
+	"bufio"
+	_ "embed"
+	"io"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"memo-studio/backend/models"
+)
+
+//go:embed data/stocks.tsv
+var builtinStockDirectory string
+
+// StockDirectory 股票名录：按代码查名称，按名称或简称在正文中识别股票
+type StockDirectory struct {
+	entries []StockSearch
+	codes   map[string]int // 代码 -> entries 下标
+	names   map[string]int // 名称与简称 -> entries 下标
+	maxName int            // names 中最长名称的字符数
+}
+
+// NewStockDirectory 空名录
+func NewStockDirectory() *StockDirectory {
+	return &StockDirectory{codes: map[string]int{}, names: map[string]int{}}
+}
+
+// Len 股票条数
+func (d *StockDirectory) Len() int {
+	return len(d.entries)
+}
+
+// Add 加入一只股票；名称与简称少于 2 个字的不用于正文识别
+func (d *StockDirectory) Add(s StockSearch, aliases ...string) {
+	if i, ok := d.codes[s.Code]; ok {
+		// 同一代码再次加入时只补充名称
+		d.addName(s.Name, i)
+		for _, a := range aliases {
+			d.addName(a, i)
+		}
+		return
+	}
+	d.entries = append(d.entries, s)
+	i := len(d.entries) - 1
+	d.codes[s.Code] = i
+	d.addName(s.Name, i)
+	for _, a := range aliases {
+		d.addName(a, i)
+	}
+}
+
+func (d *StockDirectory) addName(name string, i int) {
+	name = strings.TrimSpace(name)
+	n := utf8.RuneCountInString(name)
+	if n < 2 {
+		return
+	}
+	if _, exists := d.names[name]; exists {
+		return
+	}
+	d.names[name] = i
+	d.maxName = max(d.maxName, n)
+}
+
+// Parse 读取名录：code<TAB>name<TAB>aliases（逗号分隔），# 开头为注释
+func (d *StockDirectory) Parse(r io.Reader) error {
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimRight(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		cols := strings.Split(line, "\t")
+		if len(cols) < 2 {
+			continue
+		}
+		code, market, ok := NormalizeStockCode(cols[0])
+		if !ok {
+			continue
+		}
+		var aliases []string
+		if len(cols) > 2 {
+			aliases = splitAliases(cols[2])
+		}
+		d.Add(StockSearch{Code: code, Name: strings.TrimSpace(cols[1]), Market: market}, aliases...)
+	}
+	return sc.Err()
+}
+
+// Lookup 按代码查找（支持 sh600519、600519.SH 等写法）
+func (d *StockDirectory) Lookup(code string) *StockSearch {
+	code, _, ok := NormalizeStockCode(code)
+	if !ok {
+		return nil
+	}
+	if i, ok := d.codes[code]; ok {
+		s := d.entries[i]
+		return &s
+	}
+	return nil
+}
+
+var (
+	defaultStockDirectory     *StockDirectory
+	defaultStockDirectoryOnce sync.Once
+)
+
+// DefaultStockDirectory 内置股票名录
+func DefaultStockDirectory() *StockDirectory {
+	defaultStockDirectoryOnce.Do(func() {
+		d := NewStockDirectory()
+		if err := d.Parse(strings.NewReader(builtinStockDirectory)); err != nil {
+			log.Printf("加载内置股票名录失败: %v", err)
+		}
+		defaultStockDirectory = d
+	})
+	return defaultStockDirectory
+}
+
+// NormalizeStockCode 统一股票代码写法：600519、sh600519、SH600519、600519.SH（.SS）
+// 均返回 ("600519", "sh", true)；未带市场时按代码首位判断（0/3 深圳，5/6 上海）
+func NormalizeStockCode(s string) (code, market string, ok bool) {
+	s = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(s), "$")))
+	switch {
+	case len(s) == 8 && (strings.HasPrefix(s, "sh") || strings.HasPrefix(s, "sz")):
+		code, market = s[2:], s[:2]
+	case len(s) == 9 && s[6] == '.':
+		code, market = s[:6], s[7:]
+		if market == "ss" {
+			market = "sh"
+		}
+		if market != "sh" && market != "sz" {
+			return "", "", false
+		}
+	case len(s) == 6:
+		code = s
+	default:
+		return "", "", false
+	}
+	for i := 0; i < len(code); i++ {
+		if code[i] < '0' || code[i] > '9' {
+			return "", "", false
+		}
+	}
+	if market == "" {
+		f := formatStockCode(code)
+		if f == "" {
+			return "", "", false
+		}
+		market = f[:2]
+	}
+	return code, market, true
+}
+
+// StockMention 正文中提到的股票
+type StockMention struct {
+	Code   string `json:"code"`
+	Market string `json:"market"`
+	Name   string `json:"name"`
+	Source string `json:"source"` // code / name
+}
+
+// 正文中的股票代码：$600519、$sh600519、sh600519、600519.SH；裸 6 位数字过于常见，不识别
+var stockCodePattern = regexp.MustCompile(`(?i)\$(?:s[hz])?\d{6}(?:\.s[hzs])?|\bs[hz]\d{6}\b|\b\d{6}\.s[hzs]\b`)
+
+type stockMatch struct {
+	StockMention
+	pos int
+}
+
+// Mentions 识别正文中提到的股票，按首次出现的顺序去重。
+// extra 为额外可识别的股票（如用户自选股），名称优先于内置名录
+func (d *StockDirectory) Mentions(text string, extra []StockSearch) []StockMention {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	names := map[string]StockSearch{}
+	maxName := d.maxName
+	for _, s := range extra {
+		if n := utf8.RuneCountInString(s.Name); n >= 2 {
+			names[s.Name] = s
+			maxName = max(maxName, n)
+		}
+	}
+
+	var matches []stockMatch
+	for _, loc := range stockCodePattern.FindAllStringIndex(text, -1) {
+		// $6005191 之类更长的数字不是股票代码
+		if loc[1] < len(text) && text[loc[1]] >= '0' && text[loc[1]] <= '9' {
+			continue
+		}
+		code, market, ok := NormalizeStockCode(text[loc[0]:loc[1]])
+		if !ok {
+			continue
+		}
+		m := stockMatch{StockMention: StockMention{Code: code, Market: market, Source: models.StockSourceCode}, pos: loc[0]}
+		if s := d.Lookup(code); s != nil {
+			m.Name = s.Name
+		}
+		for _, s := range extra {
+			if s.Code == code && s.Name != "" {
+				m.Name = s.Name
+			}
+		}
+		matches = append(matches, m)
+	}
+
+	// 名称：在每个位置取最长的匹配
+	if maxName > 0 {
+		offset := 0
+		runes := []rune(text)
+		for i := 0; i < len(runes); {
+			matched := 0
+			for n := min(maxName, len(runes)-i); n >= 2; n-- {
+				key := string(runes[i : i+n])
+				s, ok := names[key]
+				if !ok {
+					var idx int
+					if idx, ok = d.names[key]; ok {
+						s = d.entries[idx]
+					}
+				}
+				if ok {
+					matches = append(matches, stockMatch{
+						StockMention: StockMention{Code: s.Code, Market: s.Market, Name: s.Name, Source: models.StockSourceName},
+						pos:          offset,
+					})
+					matched = n
+					break
+				}
+			}
+			if matched == 0 {
+				matched = 1
+			}
+			for _, r := range runes[i : i+matched] {
+				offset += utf8.RuneLen(r)
+			}
+			i += matched
+		}
+	}
+
+	// 按出现位置排序后去重
+	for i := 1; i < len(matches); i++ {
+		for j := i; j > 0 && matches[j].pos < matches[j-1].pos; j-- {
+			matches[j], matches[j-1] = matches[j-1], matches[j]
+		}
+	}
+	seen := map[string]bool{}
+	var out []StockMention
+	for _, m := range matches {
+		if seen[m.Code] {
+			continue
+		}
+		seen[m.Code] = true
+		if m.Market == "" {
+			if _, market, ok := NormalizeStockCode(m.Code); ok {
+				m.Market = market
+			}
+		}
+		out = append(out, m.StockMention)
+	}
+	return out
+}
+
+// DetectStockMentions 用内置名录和用户自选股识别笔记提到的股票
+func DetectStockMentions(userID int, text string) []StockMention {
+	var extra []StockSearch
+	if userID > 0 {
+		if items, err := models.ListWatchlist(userID); err == nil {
+			for _, it := range items {
+				extra = append(extra, StockSearch{Code: it.Code, Name: it.Name, Market: it.Market})
+			}
+		}
+	}
+	return DefaultStockDirectory().Mentions(text, extra)
+}
+
+// StockQuoter 获取实时行情，用于保存写笔记时的价格快照
+type StockQuoter func(code string) (*StockInfo, error)
+
+var (
+	stockQuoter   StockQuoter = GetStockInfo
+	stockQuoterMu sync.RWMutex
+)
+
+// GetStockQuoter 当前的行情来源
+func GetStockQuoter() StockQuoter {
+	stockQuoterMu.RLock()
+	defer stockQuoterMu.RUnlock()
+	return stockQuoter
+}
+
+// SetStockQuoter 替换行情来源（测试或离线环境）
+func SetStockQuoter(q StockQuoter) {
+	stockQuoterMu.Lock()
+	defer stockQuoterMu.Unlock()
+	stockQuoter = q
+}
+
+// SyncNoteStockMentions 按笔记当前内容更新与股票的关联；加密笔记不保留关联。
+// snapshot 为 true 时在后台为尚无快照的关联保存当前价格（新建、编辑笔记时），
+// 为 false 时只建立关联（补建历史笔记的关联，此时的价格并非写笔记时的价格）
+func SyncNoteStockMentions(userID int, note *models.Note, snapshot bool) ([]StockMention, error) {
+	if note == nil || note.ID <= 0 {
+		return nil, nil
+	}
+	if note.Locked {
+		return nil, models.SyncNoteStocks(note.ID, nil)
+	}
+	mentions := DetectStockMentions(userID, note.Title+"\n"+note.Content)
+	links := make([]models.NoteStock, 0, len(mentions))
+	for _, m := range mentions {
+		links = append(links, models.NoteStock{Code: m.Code, Market: m.Market, Name: m.Name, Source: m.Source})
+	}
+	if err := models.SyncNoteStocks(note.ID, links); err != nil {
+		return nil, err
+	}
+	if snapshot && len(mentions) > 0 {
+		enqueueNoteJob(noteJob{kind: noteJobStockQuotes, userID: userID, noteID: note.ID})
+	}
+	return mentions, nil
+}
+
+// runStockQuotes 为笔记中尚无快照的股票保存当前行情
+func runStockQuotes(job noteJob) error {
+	stocks, err := models.ListNoteStocks(job.noteID)
+	if err != nil {
+		return err
+	}
+	quote := GetStockQuoter()
+	for _, s := range stocks {
+		if s.QuotedAt != nil {
+			continue
+		}
+		info, err := quote(s.Market + s.Code)
+		if err != nil {
+			log.Printf("获取 %s 行情失败: %v", s.Code, err)
+			continue
+		}
+		if info == nil || info.Price <= 0 {
+			continue // 停牌或无效数据
+		}
+		if err := models.SetNoteStockQuote(job.noteID, s.Code, info.Price, info.ChangePercent, time.Now()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
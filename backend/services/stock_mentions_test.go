@@ -0,0 +1,91 @@
+package services_test
+
+import (
+	"reflect"
+	"testing"
+
+	"memo-studio/backend/services"
+)
+
+func TestNormalizeStockCode(t *testing.T) {
+	cases := []struct {
+		in, code, market string
+		ok               bool
+	}{
+		{"600519", "600519", "sh", true},
+		{"$600519", "600519", "sh", true},
+		{"SH600519", "600519", "sh", true},
+		{"sz000001", "000001", "sz", true},
+		{"600519.SS", "600519", "sh", true},
+		{"300750.sz", "300750", "sz", true},
+		{"688981", "688981", "sh", true},
+		{"600519.HK", "", "", false},
+		{"900901", "", "", false}, // B 股不支持
+		{"60051", "", "", false},
+		{"abcdef", "", "", false},
+	}
+	for _, tc := range cases {
+		code, market, ok := services.NormalizeStockCode(tc.in)
+		if code != tc.code || market != tc.market || ok != tc.ok {
+			t.Errorf("NormalizeStockCode(%q) = %q, %q, %v", tc.in, code, market, ok)
+		}
+	}
+}
+
+func TestStockMentions(t *testing.T) {
+	d := services.DefaultStockDirectory()
+	if d.Len() < 50 {
+		t.Fatalf("builtin directory has %d entries", d.Len())
+	}
+	if s := d.Lookup("sz300750"); s == nil || s.Name != "宁德时代" {
+		t.Fatalf("Lookup = %+v", s)
+	}
+
+	type mention = services.StockMention
+	cases := []struct {
+		name  string
+		text  string
+		extra []services.StockSearch
+		want  []mention
+	}{
+		{
+			name: "codes and names in order",
+			text: "今天加仓宁王，$600519 继续拿着；招行和贵州茅台再看看",
+			want: []mention{
+				{Code: "300750", Market: "sz", Name: "宁德时代", Source: "name"},
+				{Code: "600519", Market: "sh", Name: "贵州茅台", Source: "code"},
+				{Code: "600036", Market: "sh", Name: "招商银行", Source: "name"},
+			},
+		},
+		{
+			name: "prefixed and suffixed codes",
+			text: "对比 sz000002 和 601318.SH，以及未收录的 $002049",
+			want: []mention{
+				{Code: "000002", Market: "sz", Name: "万科A", Source: "code"},
+				{Code: "601318", Market: "sh", Name: "中国平安", Source: "code"},
+				{Code: "002049", Market: "sz", Source: "code"},
+			},
+		},
+		{
+			name: "longest name wins",
+			text: "万科A 的年报",
+			want: []mention{{Code: "000002", Market: "sz", Name: "万科A", Source: "name"}},
+		},
+		{
+			name: "plain numbers and longer digits are ignored",
+			text: "订单号 600519，金额 $6005190，施工行业",
+		},
+		{
+			name:  "watchlist names",
+			text:  "紫光国微的季报",
+			extra: []services.StockSearch{{Code: "002049", Name: "紫光国微", Market: "sz"}},
+			want:  []mention{{Code: "002049", Market: "sz", Name: "紫光国微", Source: "name"}},
+		},
+	}
+	for _, tc := range cases {
+		got := d.Mentions(tc.text, tc.extra)
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: Mentions = %+v, want %+v", tc.name, got, tc.want)
+		}
+	}
+}
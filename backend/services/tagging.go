@@ -0,0 +1,241 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"memo-studio/backend/models"
+)
+
+// PromptTagsVersion 打标提示词版本
+const PromptTagsVersion = "tags/v1"
+
+// 每次建议的数量上限
+const (
+	MaxTagSuggestions    = 5
+	MaxNewTagSuggestions = 3
+)
+
+// TopicKeywords 主题关键词（洞察的主题视角与本地打标共用）
+var TopicKeywords = map[string][]string{
+	"💻 工作": {"工作", "项目", "任务", "会议"},
+	"📚 学习": {"学习", "读书", "课程", "知识"},
+	"🏃 健康": {"健康", "运动", "锻炼"},
+	"💰 财务": {"钱", "消费", "收入", "理财"},
+}
+
+// TopicName 去掉图标的主题名，如 "💻 工作" -> "工作"
+func TopicName(topic string) string {
+	fields := strings.Fields(topic)
+	if len(fields) == 0 {
+		return topic
+	}
+	return fields[len(fields)-1]
+}
+
+// TagSuggestion 标签建议
+type TagSuggestion struct {
+	Name     string `json:"name"`
+	TagID    int    `json:"tag_id,omitempty"` // 已有标签的ID；新标签为空
+	Existing bool   `json:"existing"`
+}
+
+// tagVocabulary 用户已有标签（按小写名称索引）
+type tagVocabulary map[string]models.Tag
+
+func newTagVocabulary(tags []models.Tag) tagVocabulary {
+	v := make(tagVocabulary, len(tags))
+	for _, t := range tags {
+		v[strings.ToLower(strings.TrimSpace(t.Name))] = t
+	}
+	return v
+}
+
+// collect 合并建议：已有标签优先、去重，新标签最多 maxNew 个
+func (v tagVocabulary) collect(existing, fresh []string, maxNew int) []TagSuggestion {
+	out := []TagSuggestion{}
+	seen := map[string]bool{}
+	add := func(name string, allowNew bool) {
+		name = strings.TrimPrefix(strings.TrimSpace(name), "#")
+		key := strings.ToLower(name)
+		if name == "" || seen[key] || len(out) >= MaxTagSuggestions || len([]rune(name)) > 50 {
+			return
+		}
+		if t, ok := v[key]; ok {
+			seen[key] = true
+			out = append(out, TagSuggestion{Name: t.Name, TagID: t.ID, Existing: true})
+			return
+		}
+		if !allowNew || maxNew <= 0 {
+			return
+		}
+		seen[key] = true
+		maxNew--
+		out = append(out, TagSuggestion{Name: name})
+	}
+	for _, name := range existing {
+		add(name, false)
+	}
+	for _, name := range fresh {
+		add(name, true)
+	}
+	return out
+}
+
+// KeywordTagSuggestions 本地规则打标：正文中出现的已有标签 + 命中关键词的主题
+func KeywordTagSuggestions(content string, vocabulary []models.Tag) []TagSuggestion {
+	lower := strings.ToLower(content)
+	var existing []string
+	for _, t := range vocabulary {
+		if name := strings.TrimSpace(t.Name); name != "" && strings.Contains(lower, strings.ToLower(name)) {
+			existing = append(existing, t.Name)
+		}
+	}
+	sort.Strings(existing)
+
+	type topicHit struct {
+		name  string
+		count int
+	}
+	var hits []topicHit
+	for topic, keywords := range TopicKeywords {
+		count := 0
+		for _, kw := range keywords {
+			count += strings.Count(content, kw)
+		}
+		if count > 0 {
+			hits = append(hits, topicHit{TopicName(topic), count})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].count != hits[j].count {
+			return hits[i].count > hits[j].count
+		}
+		return hits[i].name < hits[j].name
+	})
+	// 主题名与已有标签同名时 collect 会识别为已有标签
+	var topics []string
+	for _, h := range hits {
+		topics = append(topics, h.name)
+	}
+	return newTagVocabulary(vocabulary).collect(existing, topics, MaxNewTagSuggestions)
+}
+
+// SuggestTags 调用大模型建议标签，优先从用户已有标签中选择，另外最多提出 maxNew 个新标签
+func (s *LLMService) SuggestTags(content string, vocabulary []models.Tag, maxNew int) ([]TagSuggestion, *ChatResult, error) {
+	names := make([]string, 0, len(vocabulary))
+	for _, t := range vocabulary {
+		names = append(names, t.Name)
+	}
+	sort.Strings(names)
+	existing, _ := json.Marshal(names)
+
+	prompt := fmt.Sprintf(`为下面的笔记挑选标签，用中文回复严格的 JSON 格式：
+
+{
+  "existing": ["从已有标签中选择的标签"],
+  "new": ["已有标签无法覆盖时建议的新标签，最多 %d 个"]
+}
+
+已有标签：%s
+
+笔记内容：
+%s`, maxNew, existing, content)
+
+	messages := []ChatMessage{
+		{Role: "system", Content: "你是一个笔记分类助手。标签应简短（2-6 个字），优先复用已有标签。请用中文回复严格的 JSON 格式。"},
+		{Role: "user", Content: prompt},
+	}
+
+	chat, _, err := s.cachedChat(context.Background(), PromptTagsVersion, messages, nil, []string{content})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	result := chat.Content
+	result = strings.TrimPrefix(result, "```json")
+	result = strings.TrimPrefix(result, "```")
+	result = strings.TrimSuffix(result, "```")
+	result = strings.TrimSpace(result)
+
+	var parsed struct {
+		Existing []string `json:"existing"`
+		New      []string `json:"new"`
+	}
+	if err := json.Unmarshal([]byte(result), &parsed); err != nil {
+		return nil, chat, &LLMError{Provider: chat.Provider, Kind: LLMErrInvalidResponse, Message: "标签建议不是有效的 JSON", Err: err}
+	}
+	// 模型把已有标签放进 new 时，collect 会识别为已有标签
+	return newTagVocabulary(vocabulary).collect(parsed.Existing, parsed.New, maxNew), chat, nil
+}
+
+// SuggestNoteTags 为笔记建议标签：已配置模型时调用大模型，失败时退回本地规则。
+// 配额超限错误直接返回；provider 为空表示由本地规则生成
+func SuggestNoteTags(svc *LLMService, userID int, note *models.Note, maxNew int) ([]TagSuggestion, string, error) {
+	if note.Locked {
+		return nil, "", ErrNoteLocked
+	}
+	vocabulary, err := models.GetAllTags(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	content := strings.TrimSpace(note.Title + "\n" + note.Content)
+	if svc != nil && svc.Configured() {
+		suggestions, chat, err := svc.SuggestTags(content, vocabulary, maxNew)
+		if err == nil {
+			return suggestions, chat.Provider, nil
+		}
+		var qe *QuotaExceededError
+		if errors.As(err, &qe) {
+			return nil, "", err
+		}
+		log.Printf("AI 打标失败，使用本地规则: %v", err)
+	}
+	suggestions := KeywordTagSuggestions(content, vocabulary)
+	if maxNew < MaxNewTagSuggestions {
+		// 本地规则同样遵守新标签数量上限
+		kept := suggestions[:0]
+		for _, sg := range suggestions {
+			if !sg.Existing {
+				if maxNew <= 0 {
+					continue
+				}
+				maxNew--
+			}
+			kept = append(kept, sg)
+		}
+		suggestions = kept
+	}
+	return suggestions, "", nil
+}
+
+// ApplyTagSuggestions 把建议的标签加到笔记上（新标签会先创建），来源标记为 ai；
+// 返回本次新加到笔记上的标签
+func ApplyTagSuggestions(userID, noteID int, suggestions []TagSuggestion) ([]models.Tag, error) {
+	var ids []int
+	byID := map[int]models.Tag{}
+	for _, sg := range suggestions {
+		tag, err := models.CreateTagIfNotExists(sg.Name, userID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, tag.ID)
+		byID[tag.ID] = *tag
+	}
+	added, err := models.AddNoteTags(noteID, ids, models.TagSourceAI)
+	if err != nil {
+		return nil, err
+	}
+	applied := make([]models.Tag, 0, len(added))
+	for _, id := range added {
+		t := byID[id]
+		t.Source = models.TagSourceAI
+		applied = append(applied, t)
+	}
+	return applied, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"memo-studio/backend/utils"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// 加密笔记的密钥体系：
+//   口令 --argon2id(salt)--> 包裹密钥(KEK) --AES-GCM--> 数据密钥(DEK) --AES-GCM--> 笔记/附件
+// 数据库只保存 salt 与被包裹的 DEK；修改口令只需重新包裹 DEK，轮换 DEK 才需要重新加密数据。
+
+// ErrVaultPassphrase 口令错误
+var ErrVaultPassphrase = errors.New("口令错误")
+
+// VaultSessionTTL 解锁会话有效期
+const VaultSessionTTL = 30 * time.Minute
+
+// argon2id 参数（OWASP 推荐的最低配置之一）
+const (
+	vaultKDFTime    = 2
+	vaultKDFMemory  = 64 * 1024
+	vaultKDFThreads = 2
+	vaultKDFKeyLen  = 32
+)
+
+// NewVaultSalt 生成随机盐（hex）
+func NewVaultSalt() (string, error) {
+	return utils.GenerateSecureToken(16)
+}
+
+// NewDataKey 生成随机数据密钥（hex）
+func NewDataKey() (string, error) {
+	return utils.GenerateSecureToken(32)
+}
+
+// deriveVaultKey 由口令派生包裹密钥
+func deriveVaultKey(passphrase, salt string) string {
+	saltBytes, err := hex.DecodeString(salt)
+	if err != nil {
+		saltBytes = []byte(salt)
+	}
+	key := argon2.IDKey([]byte(passphrase), saltBytes, vaultKDFTime, vaultKDFMemory, vaultKDFThreads, vaultKDFKeyLen)
+	return hex.EncodeToString(key)
+}
+
+// WrapDataKey 用口令包裹数据密钥
+func WrapDataKey(dataKey, passphrase, salt string) (string, error) {
+	return utils.EncryptData(dataKey, deriveVaultKey(passphrase, salt))
+}
+
+// UnwrapDataKey 用口令解开数据密钥；口令错误时返回 ErrVaultPassphrase
+func UnwrapDataKey(wrapped, passphrase, salt string) (string, error) {
+	dataKey, err := utils.DecryptData(wrapped, deriveVaultKey(passphrase, salt))
+	if err != nil {
+		return "", ErrVaultPassphrase
+	}
+	return dataKey, nil
+}
+
+// EncryptNoteContent 加密笔记内容
+func EncryptNoteContent(plaintext, dataKey string) (string, error) {
+	if dataKey == "" {
+		return "", errors.New("数据密钥为空")
+	}
+	return utils.EncryptData(plaintext, dataKey)
+}
+
+// DecryptNoteContent 解密笔记内容
+func DecryptNoteContent(ciphertext, dataKey string) (string, error) {
+	if dataKey == "" {
+		return "", errors.New("数据密钥为空")
+	}
+	return utils.DecryptData(ciphertext, dataKey)
+}
+
+// ===== 解锁会话（仅保存在内存中，进程重启即失效） =====
+
+// VaultSession 解锁会话
+type VaultSession struct {
+	Token     string
+	UserID    int
+	DataKey   string
+	ExpiresAt time.Time
+}
+
+var (
+	vaultSessions   = map[string]*VaultSession{}
+	vaultSessionsMu sync.Mutex
+)
+
+// OpenVaultSession 创建解锁会话
+func OpenVaultSession(userID int, dataKey string) (*VaultSession, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	sess := &VaultSession{
+		Token:     token,
+		UserID:    userID,
+		DataKey:   dataKey,
+		ExpiresAt: time.Now().Add(VaultSessionTTL),
+	}
+
+	vaultSessionsMu.Lock()
+	defer vaultSessionsMu.Unlock()
+	now := time.Now()
+	for k, s := range vaultSessions {
+		if now.After(s.ExpiresAt) {
+			delete(vaultSessions, k)
+		}
+	}
+	vaultSessions[token] = sess
+	return sess, nil
+}
+
+// GetVaultSession 根据令牌获取属于该用户的有效会话
+func GetVaultSession(token string, userID int) (*VaultSession, bool) {
+	if token == "" {
+		return nil, false
+	}
+	vaultSessionsMu.Lock()
+	defer vaultSessionsMu.Unlock()
+	sess, ok := vaultSessions[token]
+	if !ok || sess.UserID != userID {
+		return nil, false
+	}
+	if time.Now().After(sess.ExpiresAt) {
+		delete(vaultSessions, token)
+		return nil, false
+	}
+	return sess, true
+}
+
+// CloseVaultSession 结束会话
+func CloseVaultSession(token string) {
+	vaultSessionsMu.Lock()
+	defer vaultSessionsMu.Unlock()
+	delete(vaultSessions, token)
+}
+
+// CloseUserVaultSessions 结束用户的全部会话（口令/密钥变更后调用）
+func CloseUserVaultSessions(userID int) {
+	vaultSessionsMu.Lock()
+	defer vaultSessionsMu.Unlock()
+	for k, s := range vaultSessions {
+		if s.UserID == userID {
+			delete(vaultSessions, k)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ErrWebhookBlocked 推送地址解析到本机、内网等地址
+var ErrWebhookBlocked = errors.New("推送地址指向本机或内网，已拒绝")
+
+// ErrWebhookRedirect 推送地址返回重定向
+var ErrWebhookRedirect = errors.New("推送地址不允许重定向")
+
+// webhookAllowHostsEnv 允许推送到的内网主机（逗号分隔的主机名或 IP）
+const webhookAllowHostsEnv = "MEMO_WEBHOOK_ALLOW_HOSTS"
+
+// webhookHostAllowed 管理员通过 MEMO_WEBHOOK_ALLOW_HOSTS 允许的内网推送地址
+func webhookHostAllowed(host string) bool {
+	return hostAllowedByEnv(webhookAllowHostsEnv, host)
+}
+
+// newWebhookClient 推送专用客户端：在 DNS 解析之后、建立连接之前检查目标 IP（防止 DNS 重绑定），
+// 不走代理，不跟随重定向；allowPrivate 为 true 时不检查 IP
+func newWebhookClient(allowPrivate bool) *http.Client {
+	dial := (&net.Dialer{Timeout: digestWebhookTimeout}).DialContext
+	if !allowPrivate {
+		dial = guardedDialContext(digestWebhookTimeout, ErrWebhookBlocked)
+	}
+	return &http.Client{
+		Timeout: digestWebhookTimeout,
+		Transport: &http.Transport{
+			DialContext:         dial,
+			TLSHandshakeTimeout: digestWebhookTimeout,
+			IdleConnTimeout:     30 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error { return ErrWebhookRedirect },
+	}
+}
+
+// ValidateWebhookURL 推送地址只允许 http/https，且不能直接指向本机或内网（MEMO_WEBHOOK_ALLOW_HOSTS 中的主机除外）；
+// 域名在推送时解析后再检查
+func ValidateWebhookURL(raw string) error {
+	err := validatePublicURL(raw, webhookAllowHostsEnv, ErrWebhookBlocked)
+	if err != nil && !errors.Is(err, ErrWebhookBlocked) {
+		return errors.New("推送地址必须是 http(s) URL")
+	}
+	return err
+}
+
+// PostWebhook 以 POST JSON 推送到用户配置的地址，非 2xx 时返回错误
+func PostWebhook(ctx context.Context, webhook string, body []byte) error {
+	if err := ValidateWebhookURL(webhook); err != nil {
+		return err
+	}
+	u, _ := url.Parse(strings.TrimSpace(webhook))
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Memo-Studio-Digest")
+	client := newWebhookClient(webhookHostAllowed(u.Hostname()))
+	defer client.CloseIdleConnections()
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("推送地址返回 %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// webhookErrorMessage 保存并返回给用户的推送错误：只区分被拒绝的地址与其他失败，
+// 不暴露连接错误与状态码，避免被用来探测内网端口
+func webhookErrorMessage(err error) string {
+	switch {
+	case errors.Is(err, ErrWebhookBlocked):
+		return ErrWebhookBlocked.Error()
+	case errors.Is(err, ErrWebhookRedirect):
+		return ErrWebhookRedirect.Error()
+	default:
+		return "推送失败，请检查推送地址是否可用"
+	}
+}
@@ -0,0 +1,85 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"memo-studio/backend/services"
+)
+
+func TestValidateWebhookURLRejectsInternal(t *testing.T) {
+	for _, raw := range []string{
+		"ftp://example.com", "http://127.0.0.1/hook", "http://localhost:8080", "http://10.0.0.5", "http://192.168.1.1",
+		"http://169.254.169.254/latest/meta-data", "http://100.64.0.1", "http://0.0.0.0:9000", "http://[::1]/", "http://[fd00::1]/",
+	} {
+		if err := services.ValidateWebhookURL(raw); err == nil {
+			t.Errorf("%s accepted", raw)
+		}
+	}
+	if err := services.ValidateWebhookURL("https://hooks.example.com/digest"); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("MEMO_WEBHOOK_ALLOW_HOSTS", "nas.local, 127.0.0.1")
+	if err := services.ValidateWebhookURL("http://127.0.0.1:8080/hook"); err != nil {
+		t.Fatalf("allowlisted: %v", err)
+	}
+}
+
+// resolvesInternal 主机名是否只解析到本机或内网地址
+func resolvesInternal(host string) bool {
+	ips, err := net.LookupIP(host)
+	if err != nil || len(ips) == 0 {
+		return false
+	}
+	for _, ip := range ips {
+		if !ip.IsLoopback() && !ip.IsPrivate() {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPostWebhookBlocksInternalTargets(t *testing.T) {
+	var hits int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+	}))
+	t.Cleanup(target.Close)
+	ctx := context.Background()
+
+	if err := services.PostWebhook(ctx, target.URL, []byte("{}")); !errors.Is(err, services.ErrWebhookBlocked) {
+		t.Fatalf("loopback err = %v", err)
+	}
+
+	// 域名在解析后、连接前检查：本机主机名解析到内网地址时同样拒绝
+	if host, _ := os.Hostname(); resolvesInternal(host) {
+		if err := services.PostWebhook(ctx, strings.Replace(target.URL, "127.0.0.1", host, 1), []byte("{}")); !errors.Is(err, services.ErrWebhookBlocked) {
+			t.Fatalf("hostname %s err = %v", host, err)
+		}
+	}
+
+	// 白名单内的地址也不跟随重定向到本机其他服务
+	redirect := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/admin", http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(redirect.Close)
+	t.Setenv("MEMO_WEBHOOK_ALLOW_HOSTS", "127.0.0.1")
+	if err := services.PostWebhook(ctx, redirect.URL, []byte("{}")); !errors.Is(err, services.ErrWebhookRedirect) {
+		t.Fatalf("redirect err = %v", err)
+	}
+	if n := atomic.LoadInt32(&hits); n != 0 {
+		t.Fatalf("internal target hit %d times", n)
+	}
+
+	if err := services.PostWebhook(ctx, target.URL, []byte("{}")); err != nil || atomic.LoadInt32(&hits) != 1 {
+		t.Fatalf("allowlisted err = %v hits=%d", err, hits)
+	}
+}
@@ -19,23 +19,10 @@ func EncryptData(plaintext, key string) (string, error) {
 		return plaintext, nil
 	}
 
-	keyBytes := deriveKey(key)
-	block, err := aes.NewCipher(keyBytes)
+	ciphertext, err := EncryptBytes([]byte(plaintext), key)
 	if err != nil {
 		return "", err
 	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
-	}
-
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
-	}
-
-	ciphertext := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
@@ -50,29 +37,63 @@ func DecryptData(encryptedText, key string) (string, error) {
 		return "", fmt.Errorf("invalid encrypted data")
 	}
 
-	keyBytes := deriveKey(key)
-	block, err := aes.NewCipher(keyBytes)
+	plaintext, err := DecryptBytes(ciphertext, key)
 	if err != nil {
 		return "", err
 	}
+	return string(plaintext), nil
+}
+
+// EncryptBytes 加密二进制数据（nonce 前置），用于附件文件
+func EncryptBytes(plaintext []byte, key string) ([]byte, error) {
+	if key == "" {
+		return nil, fmt.Errorf("empty key")
+	}
 
-	gcm, err := cipher.NewGCM(block)
+	gcm, err := newGCM(key)
 	if err != nil {
-		return "", err
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, plaintext, nil), nil
+}
+
+// DecryptBytes 解密 EncryptBytes 的输出
+func DecryptBytes(ciphertext []byte, key string) ([]byte, error) {
+	if key == "" {
+		return nil, fmt.Errorf("empty key")
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
 	}
 
 	nonceSize := gcm.NonceSize()
 	if len(ciphertext) < nonceSize {
-		return "", fmt.Errorf("ciphertext too short")
+		return nil, fmt.Errorf("ciphertext too short")
 	}
 
 	nonce, ciphertext := ciphertext[:nonceSize], ciphertext[nonceSize:]
 	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
 	if err != nil {
-		return "", fmt.Errorf("decryption failed")
+		return nil, fmt.Errorf("decryption failed")
 	}
 
-	return string(plaintext), nil
+	return plaintext, nil
+}
+
+func newGCM(key string) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(deriveKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
 }
 
 // deriveKey 从用户密钥派生 AES-256 密钥
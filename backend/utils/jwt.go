@@ -22,21 +22,34 @@ func init() {
 type Claims struct {
 	UserID   int    `json:"user_id"`
 	Username string `json:"username"`
-	IsAdmin  bool   `json:"is_admin"`
+	Role     string `json:"role"`
+	IsAdmin  bool   `json:"is_admin"` // 兼容旧客户端，等价于 role == "admin"
 	jwt.RegisteredClaims
 }
 
+// EffectiveRole 令牌中的角色；旧令牌没有 role 时按 is_admin 推导
+func (c *Claims) EffectiveRole() string {
+	if c.Role != "" {
+		return c.Role
+	}
+	if c.IsAdmin {
+		return "admin"
+	}
+	return "editor"
+}
+
 // GenerateToken 生成 JWT token (默认7天有效期)
-func GenerateToken(userID int, username string, isAdmin bool) (string, error) {
-	return GenerateTokenWithExpiry(userID, username, isAdmin, 7*24*time.Hour)
+func GenerateToken(userID int, username string, role string) (string, error) {
+	return GenerateTokenWithExpiry(userID, username, role, 7*24*time.Hour)
 }
 
 // GenerateTokenWithExpiry 生成带自定义有效期的 JWT token
-func GenerateTokenWithExpiry(userID int, username string, isAdmin bool, expiry time.Duration) (string, error) {
+func GenerateTokenWithExpiry(userID int, username string, role string, expiry time.Duration) (string, error) {
 	claims := Claims{
 		UserID:   userID,
 		Username: username,
-		IsAdmin:  isAdmin,
+		Role:     role,
+		IsAdmin:  role == "admin",
 		RegisteredClaims: jwt.RegisteredClaims{
 			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
@@ -66,10 +79,24 @@ func ParseToken(tokenString string) (*Claims, error) {
 }
 
 // RefreshToken 刷新 token (延长有效期)
-func RefreshToken(tokenString string) (string, error) {
+// currentRole 返回用户在数据库中的当前角色，不沿用旧令牌中的角色，避免降级前的权限被无限续期
+func RefreshToken(tokenString string, currentRole func(userID int) (string, error)) (string, error) {
 	claims, err := ParseToken(tokenString)
 	if err != nil {
 		return "", err
 	}
-	return GenerateTokenWithExpiry(claims.UserID, claims.Username, claims.IsAdmin, 7*24*time.Hour)
+	role, err := currentRole(claims.UserID)
+	if err != nil {
+		return "", err
+	}
+	return GenerateTokenWithExpiry(claims.UserID, claims.Username, role, 7*24*time.Hour)
+}
+
+// InstanceSecret 实例级加密密钥（用于加密存储的第三方凭据）
+// 优先使用 MEMO_SECRET_KEY；未设置时复用 JWT 密钥，更换后已保存的密文将无法解密。
+func InstanceSecret() string {
+	if v := os.Getenv("MEMO_SECRET_KEY"); v != "" {
+		return v
+	}
+	return string(jwtSecret)
 }
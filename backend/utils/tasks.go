@@ -0,0 +1,74 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// ParsedTask Markdown 复选框任务（- [ ] / - [x]）
+type ParsedTask struct {
+	Line int    // 所在行号（从 1 开始）
+	Text string // 去掉复选框与 @due(...) 的任务文本
+	Done bool
+	Due  string // YYYY-MM-DD，未设置时为空
+}
+
+var (
+	taskLineRe = regexp.MustCompile(`^(\s*(?:[-*+]|\d+[.)])\s+\[)([ xX])(\]\s+)(.*)$`)
+	taskDueRe  = regexp.MustCompile(`@due\((\d{4}-\d{2}-\d{2})\)`)
+)
+
+// ParseTasks 解析 Markdown 中的复选框任务；围栏代码块内的内容不解析
+func ParseTasks(content string) []ParsedTask {
+	var tasks []ParsedTask
+	inFence := false
+	for i, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		m := taskLineRe.FindStringSubmatch(strings.TrimRight(line, "\r"))
+		if m == nil {
+			continue
+		}
+		text := m[4]
+		due := ""
+		if dm := taskDueRe.FindStringSubmatch(text); dm != nil {
+			if _, err := time.Parse("2006-01-02", dm[1]); err == nil {
+				due = dm[1]
+			}
+			text = taskDueRe.ReplaceAllString(text, "")
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if text == "" {
+			continue
+		}
+		tasks = append(tasks, ParsedTask{Line: i + 1, Text: text, Done: m[2] != " ", Due: due})
+	}
+	return tasks
+}
+
+// SetTaskChecked 改写指定行的复选框状态；该行不是任务行时返回 false
+func SetTaskChecked(content string, line int, done bool) (string, bool) {
+	lines := strings.Split(content, "\n")
+	if line < 1 || line > len(lines) {
+		return content, false
+	}
+	m := taskLineRe.FindStringSubmatchIndex(lines[line-1])
+	if m == nil {
+		return content, false
+	}
+	mark := " "
+	if done {
+		mark = "x"
+	}
+	// m[4]:m[5] 为复选框内的字符
+	l := lines[line-1]
+	lines[line-1] = l[:m[4]] + mark + l[m[5]:]
+	return strings.Join(lines, "\n"), true
+}
@@ -0,0 +1,24 @@
+package utils
+
+import "unicode"
+
+// CountWords 统计字数：中日韩文字每个字计 1，其余按连续的字母/数字计 1 个单词
+func CountWords(s string) int {
+	count := 0
+	inWord := false
+	for _, r := range s {
+		switch {
+		case unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul):
+			count++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '\'' && inWord:
+			if !inWord {
+				count++
+				inWord = true
+			}
+		default:
+			inWord = false
+		}
+	}
+	return count
+}